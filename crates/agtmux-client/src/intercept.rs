@@ -0,0 +1,56 @@
+//! [`Interceptor`]: observe and decorate every call made through a
+//! [`Client`](crate::Client) (logging, timing, metadata injection).
+
+use std::time::Duration;
+
+use serde_json::{Map, Value};
+
+use crate::Error;
+
+/// One outgoing call as seen by interceptors.
+#[derive(Debug, Clone, PartialEq)]
+#[non_exhaustive]
+pub struct Request {
+    pub method: String,
+    pub params: Value,
+    /// Sent as the envelope's `meta` object when non-empty (e.g. a client
+    /// name or token). The daemon ignores keys it does not know.
+    pub meta: Map<String, Value>,
+}
+
+impl Request {
+    pub(crate) fn new(method: &str, params: Value) -> Self {
+        Self {
+            method: method.to_string(),
+            params,
+            meta: Map::new(),
+        }
+    }
+
+    /// JSON-RPC envelope for this request.
+    pub(crate) fn envelope(&self) -> Value {
+        let mut envelope = serde_json::json!({
+            "jsonrpc": "2.0",
+            "method": self.method,
+            "params": self.params,
+            "id": 1,
+        });
+        if !self.meta.is_empty() {
+            envelope["meta"] = Value::Object(self.meta.clone());
+        }
+        envelope
+    }
+}
+
+/// Hooks run around every call, in registration order
+/// ([`Client::with_interceptor`](crate::Client::with_interceptor)).
+///
+/// `on_request` runs once per call before the first attempt; retries resend
+/// the same request. `on_response` runs once with the final outcome and the
+/// total time including retries. `on_request` also decorates the
+/// [`WatchLoop`](crate::WatchLoop) subscription request.
+pub trait Interceptor: Send + Sync {
+    fn on_request(&self, _request: &mut Request) {}
+
+    fn on_response(&self, _request: &Request, _result: &Result<Value, Error>, _elapsed: Duration) {}
+}
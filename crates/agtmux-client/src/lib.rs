@@ -0,0 +1,1981 @@
+//! agtmux-client: async client for the agtmux daemon's JSON-RPC API
+//! (newline-delimited JSON-RPC 2.0 over a Unix domain socket, one request
+//! per connection).
+//!
+//! ```no_run
+//! # async fn demo() -> Result<(), agtmux_client::Error> {
+//! let client = agtmux_client::Client::new("/run/user/1000/agtmux/agtmuxd.sock");
+//! let caps = client.capabilities().await?;
+//! println!("daemon {} ({} methods)", caps.version, caps.methods.len());
+//! for pane in client.list_panes().await? {
+//!     println!("{} {}", pane["pane_id"], pane["activity_state"]);
+//! }
+//! # Ok(())
+//! # }
+//! ```
+//!
+//! # Stability
+//!
+//! This crate follows semver. While at 0.x, breaking changes bump the minor
+//! version (0.1 → 0.2); patch releases are additive only.
+//!
+//! - [`Error`] is `#[non_exhaustive]`; [`Error::code`] strings never change
+//!   meaning once released.
+//! - Typed responses ([`DaemonInfo`], [`Capabilities`], [`PaneLabel`]) are
+//!   `#[non_exhaustive]` so new daemon fields can be added in a minor release.
+//! - Pane and session payloads are returned as `serde_json::Value`: their
+//!   schema is versioned by the daemon (`agtmux json` `schema_version`), not
+//!   by this crate. Use [`Client::capabilities`] to detect optional methods.
+//!
+//! With the `testing` feature, `testing::FakeDaemon` provides a scriptable
+//! in-process daemon for unit tests.
+//!
+//! For live updates use [`WatchLoop`], which follows the daemon's streaming
+//! `watch` method and reconnects on its own.
+//!
+//! Calls are retried on transient connection failures per [`RetryPolicy`]
+//! (on by default; [`Client::with_retry`] to tune or disable), and reuse
+//! idle keep-alive connections per [`PoolConfig`] ([`Client::with_pool`]).
+//! [`Interceptor`]s registered with [`Client::with_interceptor`] see every
+//! request and its outcome.
+
+use std::collections::BTreeMap;
+use std::sync::Arc;
+
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use thiserror::Error;
+use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
+use tokio::net::UnixStream;
+
+mod intercept;
+mod pager;
+mod pool;
+mod retry;
+#[cfg(any(test, feature = "testing"))]
+pub mod testing;
+mod watch;
+
+pub use intercept::{Interceptor, Request};
+pub use pager::ListPanesPager;
+pub use pool::{PoolConfig, PoolStats};
+pub use retry::RetryPolicy;
+pub use watch::{ConnectionState, EventFilter, WatchLoop, WatchUpdate};
+
+/// Failure talking to the daemon.
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum Error {
+    #[error("cannot connect to daemon at {socket_path}: {reason}")]
+    Unreachable {
+        socket_path: String,
+        reason: std::io::Error,
+    },
+
+    /// The daemon answered with a JSON-RPC error object.
+    #[error("RPC error {code}: {message}")]
+    Rpc { code: i64, message: String },
+
+    #[error("invalid daemon response: {0}")]
+    Protocol(String),
+
+    #[error("daemon io error: {0}")]
+    Io(#[from] std::io::Error),
+}
+
+/// Kill calls [`Client::kill_panes`] has in flight at once.
+const KILL_FAN_OUT: usize = 8;
+
+/// JSON-RPC methods the daemon serves (advertised by `daemon.capabilities`).
+pub const METHODS: &[&str] = &[
+    "list_panes",
+    "list_sessions",
+    "list_source_health",
+    "state_changed",
+    "summary_changed",
+    "watch",
+    "latency_status",
+    "source.hello",
+    "source.heartbeat",
+    "source.ingest",
+    "list_source_registry",
+    "label.set",
+    "label.clear",
+    "label.list",
+    "task.set",
+    "task.clear",
+    "task.list",
+    "alerts.list",
+    "alerts.ack",
+    "pane.new_window",
+    "pane.split",
+    "pane.kill",
+    "window.kill",
+    "pane.respawn",
+    "pane.restart",
+    "pane.run",
+    "pane.send",
+    "pane.transcript",
+    "pane.output",
+    "pane.search",
+    "recording.list",
+    "recording.replay",
+    "macro.list",
+    "macro.run",
+    "responder.status",
+    "responder.set_enabled",
+    "restart.events",
+    "actions.history",
+    "schedule.list",
+    "schedule.cancel",
+    "group.add",
+    "group.remove",
+    "group.list",
+    "group.send",
+    "group.kill",
+    "daemon.info",
+    "daemon.capabilities",
+    "debug.metrics",
+];
+
+/// JSON-RPC `error.code` values the daemon returns. The server uses these
+/// constants too, so they cannot drift apart.
+pub mod codes {
+    pub const METHOD_NOT_FOUND: i64 = -32601;
+    pub const INVALID_PARAMS: i64 = -32602;
+    /// `source.ingest` rejected by the trust guard (`strict_admission`).
+    pub const ADMISSION_REJECTED: i64 = -32001;
+    /// `pane_id` does not name a pane the daemon knows.
+    pub const PANE_NOT_FOUND: i64 = -32002;
+    /// `alerts.ack` `id` does not name an unresolved alert.
+    pub const ALERT_NOT_FOUND: i64 = -32003;
+    /// A pane action was refused by a guard (e.g. killing a busy agent
+    /// without `force`).
+    pub const ACTION_REFUSED: i64 = -32004;
+    /// tmux failed to run a pane action.
+    pub const ACTION_FAILED: i64 = -32005;
+    /// The caller's scope (`[access]`: peer uid or `meta.token`) does not
+    /// allow the method.
+    pub const FORBIDDEN: i64 = -32006;
+    /// Input or target refused by the daemon's `[send_policy]`.
+    pub const POLICY_VIOLATION: i64 = -32007;
+}
+
+/// Typed view of an [`Error::Rpc`] code, for matching without parsing the
+/// message.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum RpcErrorKind {
+    MethodNotFound,
+    InvalidParams,
+    AdmissionRejected,
+    PaneNotFound,
+    AlertNotFound,
+    ActionRefused,
+    ActionFailed,
+    Forbidden,
+    PolicyViolation,
+    /// A code this client version does not know.
+    Other(i64),
+}
+
+impl RpcErrorKind {
+    pub fn from_code(code: i64) -> Self {
+        match code {
+            codes::METHOD_NOT_FOUND => Self::MethodNotFound,
+            codes::INVALID_PARAMS => Self::InvalidParams,
+            codes::ADMISSION_REJECTED => Self::AdmissionRejected,
+            codes::PANE_NOT_FOUND => Self::PaneNotFound,
+            codes::ALERT_NOT_FOUND => Self::AlertNotFound,
+            codes::ACTION_REFUSED => Self::ActionRefused,
+            codes::ACTION_FAILED => Self::ActionFailed,
+            codes::FORBIDDEN => Self::Forbidden,
+            codes::POLICY_VIOLATION => Self::PolicyViolation,
+            other => Self::Other(other),
+        }
+    }
+}
+
+impl Error {
+    /// Stable machine-readable code for scripts.
+    pub fn code(&self) -> &'static str {
+        match self {
+            Self::Unreachable { .. } => "ERR_DAEMON_UNREACHABLE",
+            Self::Rpc { code, .. } => match RpcErrorKind::from_code(*code) {
+                RpcErrorKind::MethodNotFound => "ERR_METHOD_NOT_FOUND",
+                RpcErrorKind::InvalidParams => "ERR_INVALID_PARAMS",
+                RpcErrorKind::AdmissionRejected => "ERR_ADMISSION_REJECTED",
+                RpcErrorKind::PaneNotFound => "ERR_PANE_NOT_FOUND",
+                RpcErrorKind::AlertNotFound => "ERR_ALERT_NOT_FOUND",
+                RpcErrorKind::ActionRefused => "ERR_ACTION_REFUSED",
+                RpcErrorKind::ActionFailed => "ERR_ACTION_FAILED",
+                RpcErrorKind::Forbidden => "ERR_FORBIDDEN",
+                RpcErrorKind::PolicyViolation => "ERR_POLICY_VIOLATION",
+                RpcErrorKind::Other(_) => "ERR_RPC",
+            },
+            Self::Protocol(_) => "ERR_PROTOCOL",
+            Self::Io(_) => "ERR_IO",
+        }
+    }
+
+    /// The daemon's error kind, or None if the call failed before/outside
+    /// the RPC (connection, protocol).
+    ///
+    /// ```
+    /// use agtmux_client::{Error, RpcErrorKind, codes};
+    ///
+    /// let err = Error::Rpc { code: codes::PANE_NOT_FOUND, message: "unknown pane".into() };
+    /// assert_eq!(err.rpc_kind(), Some(RpcErrorKind::PaneNotFound));
+    /// ```
+    pub fn rpc_kind(&self) -> Option<RpcErrorKind> {
+        match self {
+            Self::Rpc { code, .. } => Some(RpcErrorKind::from_code(*code)),
+            _ => None,
+        }
+    }
+}
+
+/// `list_panes {since_cursor}` result: the panes added or changed since the
+/// cursor and the ids of those removed.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct PaneListDelta {
+    /// Pass to the next [`Client::list_panes_since`].
+    pub cursor: u64,
+    /// The cursor could not be resumed from: `panes` is the whole list.
+    #[serde(default)]
+    pub full: bool,
+    pub panes: Vec<Value>,
+    #[serde(default)]
+    pub removed: Vec<String>,
+}
+
+impl PaneListDelta {
+    /// Bring a copy of the pane list up to date (changed panes are replaced
+    /// in place, new ones appended) and return the next cursor.
+    pub fn apply(self, panes: &mut Vec<Value>) -> u64 {
+        if self.full {
+            *panes = self.panes;
+            return self.cursor;
+        }
+        let pane_id = |pane: &Value| pane["pane_id"].as_str().unwrap_or("").to_string();
+        panes.retain(|pane| !self.removed.contains(&pane_id(pane)));
+        for pane in self.panes {
+            match panes.iter_mut().find(|p| pane_id(p) == pane_id(&pane)) {
+                Some(old) => *old = pane,
+                None => panes.push(pane),
+            }
+        }
+        self.cursor
+    }
+}
+
+/// `daemon.info` result.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct DaemonInfo {
+    /// Per-process nonce that sources echo back in `source.hello`.
+    pub nonce: String,
+    pub version: String,
+    pub pid: u32,
+}
+
+/// `daemon.capabilities` result.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct Capabilities {
+    pub version: String,
+    /// RPC method names the daemon serves.
+    pub methods: Vec<String>,
+    pub features: Vec<Feature>,
+}
+
+impl Capabilities {
+    /// Whether the daemon serves `method`.
+    pub fn has_method(&self, method: &str) -> bool {
+        self.methods.iter().any(|m| m == method)
+    }
+
+    /// Whether feature `name` is enabled (false if unknown to the daemon).
+    pub fn is_enabled(&self, name: &str) -> bool {
+        self.features.iter().any(|f| f.name == name && f.enabled)
+    }
+}
+
+/// One entry of the daemon's feature flag registry.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct Feature {
+    pub name: String,
+    /// `"stable"` or `"experimental"`.
+    pub stage: String,
+    pub enabled: bool,
+    pub default: bool,
+    pub description: String,
+}
+
+/// `label.set` / `label.list` entry.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct PaneLabel {
+    pub pane_id: String,
+    /// `None` after `label.clear`.
+    pub label: Option<String>,
+}
+
+/// Task metadata attached to a pane (`task.set`).
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct TaskMeta {
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub title: Option<String>,
+    /// Ticket / issue URL.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub url: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub owner: Option<String>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub tags: Vec<String>,
+}
+
+impl TaskMeta {
+    /// Task with just a title; set the other fields with struct update
+    /// syntax.
+    pub fn titled(title: &str) -> Self {
+        Self {
+            title: Some(title.to_string()),
+            ..Self::default()
+        }
+    }
+}
+
+/// `task.set` / `task.list` entry.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct PaneTask {
+    pub pane_id: String,
+    /// `None` after `task.clear`.
+    pub task: Option<TaskMeta>,
+}
+
+/// `alerts.list` / `alerts.ack` entry: a fired `[[alerts]]` rule that has
+/// not resolved yet.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct Alert {
+    pub id: u64,
+    /// Name of the rule that fired.
+    pub rule: String,
+    pub pane_id: String,
+    pub session_name: Option<String>,
+    pub provider: Option<String>,
+    /// Activity state name, e.g. `"WaitingApproval"`.
+    pub state: String,
+    /// RFC 3339 time the pane entered `state`.
+    pub since: String,
+    /// RFC 3339 time the alert fired.
+    pub fired_at: String,
+    pub acked: bool,
+    /// Task metadata of the pane when the alert fired.
+    #[serde(default)]
+    pub task: Option<TaskMeta>,
+}
+
+/// Result of a pane action (`pane.new_window`, `pane.split`, `pane.kill`,
+/// `window.kill`, `pane.respawn`, `pane.restart`, `pane.run`).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ActionResult {
+    /// Method that ran.
+    pub action: String,
+    /// Created pane for `pane.new_window` / `pane.split`, else the target.
+    pub pane_id: String,
+    /// `session:window.pane` address of the created pane (`pane.new_window`,
+    /// `pane.split`, `pane.run`).
+    #[serde(default)]
+    pub address: Option<String>,
+    /// `pane.run`: agent launched (`claude`, `codex`, or `custom`).
+    #[serde(default)]
+    pub agent: Option<String>,
+    /// `pane.run`: an idle shell pane was reused instead of a new window.
+    #[serde(default)]
+    pub reused: bool,
+    /// `pane.restart`: command the agent was relaunched with.
+    #[serde(default)]
+    pub command: Option<String>,
+    pub request_ref: Option<String>,
+    /// The daemon returned the stored result of an earlier call with the
+    /// same `request_ref` instead of acting again.
+    pub replayed: bool,
+}
+
+/// Result of [`Client::export_transcript`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct Transcript {
+    pub pane_id: String,
+    /// `claude` or `codex`.
+    pub provider: String,
+    pub session_id: String,
+    /// Session file the transcript was read from (on the daemon host).
+    pub source: String,
+    /// Number of user / assistant turns.
+    pub messages: usize,
+    /// The transcript, unless it was archived.
+    pub markdown: Option<String>,
+    /// File written when `archive_dir` was given.
+    pub archive_path: Option<String>,
+}
+
+/// `macro.list` entry: a `[[macros]]` definition of the daemon.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct MacroInfo {
+    pub name: String,
+    pub description: Option<String>,
+    /// `{param}` placeholders [`Client::run_macro`] must fill.
+    pub params: Vec<String>,
+    /// Number of steps.
+    pub steps: usize,
+}
+
+/// Result of [`Client::run_macro`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct MacroRun {
+    pub name: String,
+    pub pane_id: String,
+    pub steps: usize,
+    /// First step run (`from_step` of the call).
+    pub from_step: usize,
+    /// The steps that ran, in order.
+    pub results: Vec<MacroStepResult>,
+    /// Lines captured by the macro's `output` steps, in order.
+    pub output: Vec<String>,
+    pub request_ref: Option<String>,
+    /// See [`ActionResult::replayed`].
+    pub replayed: bool,
+}
+
+/// Result of [`Client::pane_output`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct PaneOutput {
+    pub pane_id: String,
+    /// Output lines, oldest first: all captured lines, or with `since` only
+    /// those after the cursor.
+    pub lines: Vec<String>,
+    /// Pass as `since` to get only later lines next time.
+    pub cursor: String,
+    /// Whether `lines` is the whole capture (no `since`, or its lines are no
+    /// longer on screen).
+    pub full: bool,
+    /// RFC 3339 timestamp of the capture.
+    pub captured_at: String,
+}
+
+/// Result of [`Client::search_output`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct SearchResult {
+    pub q: String,
+    /// Panes captured.
+    pub searched: usize,
+    /// Panes with at least one matching line, in `list_panes` order.
+    pub panes: Vec<SearchHit>,
+    /// Pane id → capture error.
+    pub failed: BTreeMap<String, String>,
+}
+
+/// A pane whose output matched a [`Client::search_output`] query.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct SearchHit {
+    pub pane_id: String,
+    pub session_name: Option<String>,
+    pub window_name: Option<String>,
+    pub provider: Option<String>,
+    pub label: Option<String>,
+    pub title: Option<String>,
+    /// The first matching lines (at most 20).
+    pub matches: Vec<SearchMatch>,
+    /// All matching lines, including those not returned.
+    pub total: usize,
+}
+
+/// A matching line of a [`SearchHit`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct SearchMatch {
+    /// 1-based line number in the captured output.
+    pub line: usize,
+    pub text: String,
+}
+
+/// `recording.list` entry: a pane runtime recorded by the daemon's
+/// `[recorder]`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct Recording {
+    /// `3-20261015T070000`: pane number and birth time.
+    pub runtime: String,
+    pub pane_id: String,
+    #[serde(default)]
+    pub session_name: Option<String>,
+    #[serde(default)]
+    pub window_name: Option<String>,
+    #[serde(default)]
+    pub provider: Option<String>,
+    pub started_at: String,
+    /// Compressed size on disk.
+    pub bytes: u64,
+    #[serde(default)]
+    pub updated_at: Option<String>,
+}
+
+/// `recording.replay` result.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct Replay {
+    pub runtime: String,
+    /// The recording's `meta.json`.
+    pub meta: Value,
+    pub records: Vec<ReplayRecord>,
+    /// Last screen of the pane (the current one while it is alive).
+    #[serde(default)]
+    pub screen: Option<Vec<String>>,
+    /// When the pane went away; `None` while it is recorded.
+    #[serde(default)]
+    pub ended_at: Option<String>,
+    /// Older rows (records, for a raw replay) left out to keep the reply
+    /// bounded.
+    pub truncated: usize,
+}
+
+/// Rows that scrolled into the pane's history between two captures, or
+/// that the pane printed (`pipe-pane` backend).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ReplayRecord {
+    pub at: String,
+    #[serde(default)]
+    pub lines: Vec<String>,
+    /// Output as the pane printed it, escape sequences and all; only in a
+    /// [`Client::replay_recording_raw`] reply.
+    #[serde(default)]
+    pub raw: Option<String>,
+    /// Output before these rows may be missing.
+    #[serde(default)]
+    pub gap: bool,
+}
+
+/// One step of a [`MacroRun`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct MacroStepResult {
+    /// Index in the macro's steps.
+    pub step: usize,
+    /// `send`, `key`, `wait` or `output`.
+    pub kind: String,
+    pub elapsed_ms: u64,
+    /// Lines captured by an `output` step.
+    pub lines: Option<usize>,
+}
+
+/// `responder.status`: the auto-responder's kill switch, rules and audit
+/// trail.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ResponderStatus {
+    pub enabled: bool,
+    /// Switched off with `responder.set_enabled false`, which config
+    /// reloads do not undo.
+    #[serde(default)]
+    pub switched_off: bool,
+    pub rules: Vec<ResponderRuleCount>,
+    /// Responses typed into panes, oldest first.
+    pub audit: Vec<AutoResponse>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ResponderRuleCount {
+    pub name: String,
+    /// Responses since the daemon started.
+    pub responses: u64,
+}
+
+/// Audit entry: one approval prompt answered by a `[responder]` rule.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct AutoResponse {
+    pub id: u64,
+    pub rule: String,
+    pub pane_id: String,
+    pub session_name: Option<String>,
+    pub provider: Option<String>,
+    /// Text or key name typed into the pane.
+    pub sent: String,
+    /// Capture line that matched the rule's pattern.
+    pub matched: Option<String>,
+    /// RFC 3339 time of the response.
+    pub at: String,
+}
+
+/// `restart.events` entry: an `[[auto_restart]]` respawn of a crashed
+/// agent pane, or the policy giving up on it.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct RestartEvent {
+    pub id: u64,
+    pub policy: String,
+    pub pane_id: String,
+    pub session_name: String,
+    pub provider: String,
+    /// Exit status of the crashed process; None if killed by a signal.
+    pub exit_status: Option<i32>,
+    /// 1-based restart number (for `gave_up`, the restarts used).
+    pub attempt: u32,
+    /// `restarted` or `gave_up`.
+    pub outcome: String,
+    /// RFC 3339 time of the event.
+    pub at: String,
+}
+
+/// Caller recorded in an [`ActionRecord`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ActionActor {
+    pub uid: u32,
+    pub pid: Option<i32>,
+    /// `meta.client` the caller sent (`agtmux/0.9.0`).
+    pub client: Option<String>,
+    /// `[[access.tokens]]` name, if the caller used a token.
+    pub token: Option<String>,
+}
+
+/// `actions.history` entry: one pane action, group write or macro run.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ActionRecord {
+    pub id: u64,
+    /// RFC 3339 time of the call.
+    pub at: String,
+    pub method: String,
+    pub actor: ActionActor,
+    /// Pane ids named by the request or reached by the action.
+    pub targets: Vec<String>,
+    pub group: Option<String>,
+    /// Text, key, macro name, command, ... as sent.
+    pub detail: serde_json::Map<String, Value>,
+    pub ok: bool,
+    pub error: Option<String>,
+    pub request_ref: Option<String>,
+    pub replayed: bool,
+}
+
+/// Pending `pane.send` (`schedule.list`, [`Client::schedule_send`]).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct ScheduledSend {
+    pub id: u64,
+    /// RFC 3339 time it runs at.
+    pub due: String,
+    pub created_at: String,
+    /// `pane.send` params it runs with.
+    pub params: Value,
+    pub actor: ActionActor,
+}
+
+/// `group.list` entry: a named pane group.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct GroupInfo {
+    pub name: String,
+    /// Member pane ids, sorted.
+    pub panes: Vec<String>,
+    /// tmux sessions the members live in.
+    pub sessions: Vec<String>,
+    pub summary: GroupSummary,
+}
+
+/// Aggregated state of a group's members.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct GroupSummary {
+    pub total: usize,
+    pub managed: usize,
+    pub unmanaged: usize,
+    /// Managed members by activity state (`Running`, `Idle`, ...).
+    pub states: BTreeMap<String, u32>,
+    /// Managed members by provider.
+    pub providers: BTreeMap<String, u32>,
+}
+
+/// Result of [`Client::group_send`] / [`Client::group_kill`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct GroupAction {
+    pub action: String,
+    pub group: String,
+    /// Members the action succeeded on.
+    pub panes: Vec<String>,
+    /// Pane id → error, for members it failed on.
+    pub failed: BTreeMap<String, String>,
+    pub request_ref: Option<String>,
+    /// See [`ActionResult::replayed`].
+    pub replayed: bool,
+}
+
+/// Optional settings for panes created by [`Client::new_window`] and
+/// [`Client::split_pane`].
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct NewPane {
+    /// Window name (`new_window` only).
+    pub name: Option<String>,
+    pub cwd: Option<String>,
+    /// Command run instead of the shell.
+    pub command: Option<String>,
+    /// Idempotency key (see [`ActionResult::replayed`]).
+    pub request_ref: Option<String>,
+}
+
+/// `pane.run` request: launch an agent with an initial prompt.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct RunAgent {
+    /// `claude` or `codex`; any name with `command` set.
+    pub agent: String,
+    /// Initial prompt, passed as the command's last argument.
+    pub prompt: String,
+    /// Custom command line instead of the built-in agent binary.
+    pub command: Option<String>,
+    /// Session for a new window (or `reuse_idle` lookup).
+    pub session: Option<String>,
+    /// Type the command into this idle shell pane instead.
+    pub pane_id: Option<String>,
+    /// Prefer an idle shell pane in `session` over a new window.
+    pub reuse_idle: bool,
+    pub cwd: Option<String>,
+    pub request_ref: Option<String>,
+}
+
+/// `pane.send` request: the same text or key for several panes, given as
+/// `pane_ids` or selected by a filter (`session` / `states` / `agent`,
+/// matching managed agent panes).
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct SendBatch {
+    pub pane_ids: Vec<String>,
+    pub session: Option<String>,
+    /// Activity states, e.g. `idle`, `waiting_input`.
+    pub states: Vec<String>,
+    /// Provider, e.g. `claude`.
+    pub agent: Option<String>,
+    /// Typed literally, then Enter unless `no_enter`.
+    pub text: String,
+    /// tmux key name (`C-c`, `Escape`) pressed instead of typing `text`.
+    pub key: Option<String>,
+    pub no_enter: bool,
+    pub request_ref: Option<String>,
+}
+
+/// Result of [`Client::send_batch`].
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[non_exhaustive]
+pub struct SendResult {
+    pub action: String,
+    /// Panes the text / key was sent to.
+    pub panes: Vec<String>,
+    /// Pane id → error, for panes it failed on.
+    pub failed: BTreeMap<String, String>,
+    pub request_ref: Option<String>,
+    /// See [`ActionResult::replayed`].
+    pub replayed: bool,
+}
+
+/// Handle to a daemon socket. Cheap to clone; clones share one connection
+/// pool, so a `Client` can be shared across tasks.
+#[derive(Clone)]
+pub struct Client {
+    socket_path: String,
+    retry: RetryPolicy,
+    pool: Arc<pool::Pool>,
+    interceptors: Vec<Arc<dyn Interceptor>>,
+    /// `daemon.info` nonce of the daemon process last seen, shared by clones.
+    daemon_nonce: Arc<std::sync::Mutex<Option<String>>>,
+}
+
+impl std::fmt::Debug for Client {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.debug_struct("Client")
+            .field("socket_path", &self.socket_path)
+            .field("retry", &self.retry)
+            .field("pool", &self.pool)
+            .field("interceptors", &self.interceptors.len())
+            .finish()
+    }
+}
+
+impl Client {
+    pub fn new(socket_path: impl Into<String>) -> Self {
+        Self {
+            socket_path: socket_path.into(),
+            retry: RetryPolicy::default(),
+            pool: pool::Pool::new(PoolConfig::default()),
+            interceptors: Vec::new(),
+            daemon_nonce: Arc::default(),
+        }
+    }
+
+    /// Add an interceptor; it runs after those already registered.
+    pub fn with_interceptor(mut self, interceptor: impl Interceptor + 'static) -> Self {
+        self.interceptors.push(Arc::new(interceptor));
+        self
+    }
+
+    /// Replace the connection pool settings ([`PoolConfig::disabled`] for a
+    /// connection per call). Starts a new, empty pool.
+    pub fn with_pool(mut self, config: PoolConfig) -> Self {
+        self.pool = pool::Pool::new(config);
+        self
+    }
+
+    /// Connection counters, for exporting as metrics.
+    pub fn pool_stats(&self) -> PoolStats {
+        self.pool.stats()
+    }
+
+    /// Replace the retry policy ([`RetryPolicy::none`] to fail fast).
+    pub fn with_retry(mut self, retry: RetryPolicy) -> Self {
+        self.retry = retry;
+        self
+    }
+
+    pub fn socket_path(&self) -> &str {
+        &self.socket_path
+    }
+
+    /// Raw call: send `method` with `params` and return the `result` value,
+    /// retrying transient failures per the client's [`RetryPolicy`].
+    pub async fn call(&self, method: &str, params: Value) -> Result<Value, Error> {
+        let request = self.prepare(method, params);
+        let start = std::time::Instant::now();
+        // A `request_ref` is only deduplicated by the daemon process that saw
+        // it: note which one that is before sending, if a resend may follow.
+        let by_ref = !retry::idempotent(&request.method)
+            && retry::has_request_ref(&request.params)
+            && self.retry.retries();
+        let daemon = if by_ref {
+            self.daemon_nonce().await
+        } else {
+            None
+        };
+        let mut attempt = 1;
+        let result = loop {
+            match self.call_once(&request).await {
+                Err(e)
+                    if self
+                        .retry
+                        .should_retry(&request.method, &request.params, &e, attempt) =>
+                {
+                    tokio::time::sleep(self.retry.backoff(attempt)).await;
+                    if by_ref
+                        && matches!(e, Error::Io(_))
+                        && (daemon.is_none() || self.fetch_daemon_nonce().await != daemon)
+                    {
+                        // Restarted (or unknown): the ref may run again.
+                        break Err(e);
+                    }
+                    attempt += 1;
+                }
+                result => break result,
+            }
+        };
+        let elapsed = start.elapsed();
+        for interceptor in &self.interceptors {
+            interceptor.on_response(&request, &result, elapsed);
+        }
+        result
+    }
+
+    /// Build a request and let every interceptor decorate it.
+    pub(crate) fn prepare(&self, method: &str, params: Value) -> Request {
+        let mut request = Request::new(method, params);
+        for interceptor in &self.interceptors {
+            interceptor.on_request(&mut request);
+        }
+        request
+    }
+
+    /// Nonce of the daemon process, cached per client; None if the daemon
+    /// cannot be asked.
+    async fn daemon_nonce(&self) -> Option<String> {
+        let cached = self.daemon_nonce.lock().expect("nonce lock").clone();
+        match cached {
+            Some(nonce) => Some(nonce),
+            None => self.fetch_daemon_nonce().await,
+        }
+    }
+
+    /// Ask the daemon for its nonce and remember it.
+    async fn fetch_daemon_nonce(&self) -> Option<String> {
+        let request = self.prepare("daemon.info", serde_json::json!({}));
+        let info = self.call_once(&request).await.ok()?;
+        let nonce = info["nonce"].as_str()?.to_string();
+        *self.daemon_nonce.lock().expect("nonce lock") = Some(nonce.clone());
+        Some(nonce)
+    }
+
+    async fn call_once(&self, request: &Request) -> Result<Value, Error> {
+        let method = request.method.as_str();
+        let mut req = request.envelope().to_string();
+        req.push('\n');
+
+        let line = loop {
+            let (mut conn, reused) = match self.pool.checkout() {
+                Some(conn) => (conn, true),
+                None => (self.connect().await?, false),
+            };
+            if let Err(e) = self.send(&mut conn, &req).await {
+                // The daemon closed a pooled connection (idle timeout,
+                // restart) and never saw the request: try a fresh one.
+                if reused {
+                    continue;
+                }
+                return Err(e);
+            }
+            match self.receive(&mut conn).await {
+                Ok(Some(line)) => {
+                    self.pool.checkin(conn);
+                    break line;
+                }
+                // Sent, but the pooled connection went away without a reply:
+                // the daemon may have run the call, so resend only calls
+                // that are safe to run twice (`request_ref` calls go through
+                // the restart check in `call`).
+                Ok(None) | Err(_) if reused && retry::idempotent(method) => {
+                    continue;
+                }
+                Ok(None) => {
+                    return Err(Error::Io(std::io::Error::new(
+                        std::io::ErrorKind::UnexpectedEof,
+                        "daemon closed the connection without a response",
+                    )));
+                }
+                Err(e) => return Err(e),
+            }
+        };
+
+        let response: Value = serde_json::from_str(line.trim())
+            .map_err(|e| Error::Protocol(format!("{e} (method {method})")))?;
+
+        if let Some(error) = response.get("error") {
+            return Err(Error::Rpc {
+                code: error["code"].as_i64().unwrap_or(0),
+                message: error["message"]
+                    .as_str()
+                    .map_or_else(|| error.to_string(), String::from),
+            });
+        }
+
+        Ok(response["result"].clone())
+    }
+
+    async fn connect(&self) -> Result<pool::Conn, Error> {
+        let stream = UnixStream::connect(&self.socket_path)
+            .await
+            .map_err(|reason| Error::Unreachable {
+                socket_path: self.socket_path.clone(),
+                reason,
+            })?;
+        self.pool.record_open();
+        Ok(BufReader::new(stream))
+    }
+
+    /// Write one request line.
+    async fn send(&self, conn: &mut pool::Conn, req: &str) -> Result<(), Error> {
+        conn.get_mut().write_all(req.as_bytes()).await?;
+        if !self.pool.enabled() {
+            // No reuse: half-close so the daemon sees EOF right after the reply.
+            conn.get_mut().shutdown().await?;
+        }
+        Ok(())
+    }
+
+    /// Read the response line (None on EOF).
+    async fn receive(&self, conn: &mut pool::Conn) -> Result<Option<String>, Error> {
+        let mut line = String::new();
+        if conn.read_line(&mut line).await? == 0 {
+            return Ok(None);
+        }
+        Ok(Some(line))
+    }
+
+    /// Call and deserialize the result into `T`.
+    async fn call_typed<T: serde::de::DeserializeOwned>(
+        &self,
+        method: &str,
+        params: Value,
+    ) -> Result<T, Error> {
+        let result = self.call(method, params).await?;
+        serde_json::from_value(result)
+            .map_err(|e| Error::Protocol(format!("{e} (method {method})")))
+    }
+
+    /// `list_panes`: one JSON object per tmux pane.
+    pub async fn list_panes(&self) -> Result<Vec<Value>, Error> {
+        self.call_typed("list_panes", serde_json::json!({})).await
+    }
+
+    /// `list_panes` restricted to panes whose working directory is in git
+    /// repository `repo` (root path or directory name) and/or on `branch`.
+    pub async fn list_panes_in_git(
+        &self,
+        repo: Option<&str>,
+        branch: Option<&str>,
+    ) -> Result<Vec<Value>, Error> {
+        self.call_typed(
+            "list_panes",
+            serde_json::json!({"repo": repo, "branch": branch}),
+        )
+        .await
+    }
+
+    /// `list_panes` with only `fields` in each entry (plus `pane_id`), e.g.
+    /// `["activity_state", "provider"]` for an overview of a large fleet.
+    /// `list_panes` also takes `sort` and `offset` paging; use [`call`](Self::call).
+    pub async fn list_panes_fields(&self, fields: &[&str]) -> Result<Vec<Value>, Error> {
+        self.call_typed("list_panes", serde_json::json!({"fields": fields}))
+            .await
+    }
+
+    /// `list_panes` changes since `cursor` (0 for everything), for keeping a
+    /// copy current without re-fetching every pane; see [`PaneListDelta`].
+    /// Cursors do not survive a daemon restart: start over from 0 after a
+    /// connection error.
+    pub async fn list_panes_since(&self, cursor: u64) -> Result<PaneListDelta, Error> {
+        self.call_typed("list_panes", serde_json::json!({"since_cursor": cursor}))
+            .await
+    }
+
+    /// `list_panes` in pages of `page_size`, for large servers.
+    pub fn list_panes_paged(&self, page_size: u32) -> ListPanesPager<'_> {
+        ListPanesPager::new(self, page_size)
+    }
+
+    /// `list_sessions`: one JSON object per tmux session.
+    pub async fn list_sessions(&self) -> Result<Vec<Value>, Error> {
+        self.call_typed("list_sessions", serde_json::json!({}))
+            .await
+    }
+
+    pub async fn daemon_info(&self) -> Result<DaemonInfo, Error> {
+        self.call_typed("daemon.info", serde_json::json!({})).await
+    }
+
+    pub async fn capabilities(&self) -> Result<Capabilities, Error> {
+        self.call_typed("daemon.capabilities", serde_json::json!({}))
+            .await
+    }
+
+    /// `label.set`. Fails with [`RpcErrorKind::PaneNotFound`] for unknown panes.
+    pub async fn set_label(&self, pane_id: &str, label: &str) -> Result<PaneLabel, Error> {
+        self.call_typed(
+            "label.set",
+            serde_json::json!({"pane_id": pane_id, "label": label}),
+        )
+        .await
+    }
+
+    /// `label.clear`. Returns whether a label was removed.
+    pub async fn clear_label(&self, pane_id: &str) -> Result<bool, Error> {
+        let result = self
+            .call("label.clear", serde_json::json!({"pane_id": pane_id}))
+            .await?;
+        Ok(result["cleared"].as_bool().unwrap_or(false))
+    }
+
+    pub async fn list_labels(&self) -> Result<Vec<PaneLabel>, Error> {
+        self.call_typed("label.list", serde_json::json!({})).await
+    }
+
+    /// `task.set`: attach `task` to a pane, replacing any earlier one. Fails
+    /// with [`RpcErrorKind::PaneNotFound`] for unknown panes and
+    /// [`RpcErrorKind::InvalidParams`] for an empty task or a non-http(s)
+    /// URL.
+    pub async fn set_task(&self, pane_id: &str, task: &TaskMeta) -> Result<PaneTask, Error> {
+        let params = serde_json::json!({
+            "pane_id": pane_id,
+            "title": task.title,
+            "url": task.url,
+            "owner": task.owner,
+            "tags": task.tags,
+        });
+        self.call_typed("task.set", params).await
+    }
+
+    /// `task.clear`. Returns whether a task was removed.
+    pub async fn clear_task(&self, pane_id: &str) -> Result<bool, Error> {
+        let result = self
+            .call("task.clear", serde_json::json!({"pane_id": pane_id}))
+            .await?;
+        Ok(result["cleared"].as_bool().unwrap_or(false))
+    }
+
+    pub async fn list_tasks(&self) -> Result<Vec<PaneTask>, Error> {
+        self.call_typed("task.list", serde_json::json!({})).await
+    }
+
+    /// `alerts.list`: unresolved alerts, oldest first.
+    pub async fn list_alerts(&self) -> Result<Vec<Alert>, Error> {
+        self.call_typed("alerts.list", serde_json::json!({})).await
+    }
+
+    /// `alerts.ack`. Fails with [`RpcErrorKind::AlertNotFound`] once the
+    /// alert resolved.
+    pub async fn ack_alert(&self, id: u64) -> Result<Alert, Error> {
+        self.call_typed("alerts.ack", serde_json::json!({"id": id}))
+            .await
+    }
+
+    /// `pane.new_window` in `session` (name or id).
+    pub async fn new_window(&self, session: &str, pane: &NewPane) -> Result<ActionResult, Error> {
+        let params = serde_json::json!({
+            "session": session,
+            "name": pane.name,
+            "cwd": pane.cwd,
+            "command": pane.command,
+            "request_ref": pane.request_ref,
+        });
+        self.call_typed("pane.new_window", params).await
+    }
+
+    /// `pane.split`: side by side when `horizontal`, else stacked.
+    pub async fn split_pane(
+        &self,
+        pane_id: &str,
+        horizontal: bool,
+        pane: &NewPane,
+    ) -> Result<ActionResult, Error> {
+        let params = serde_json::json!({
+            "pane_id": pane_id,
+            "direction": if horizontal { "horizontal" } else { "vertical" },
+            "cwd": pane.cwd,
+            "command": pane.command,
+            "request_ref": pane.request_ref,
+        });
+        self.call_typed("pane.split", params).await
+    }
+
+    /// `pane.kill`, or `window.kill` for the pane's whole window. Fails
+    /// with [`RpcErrorKind::ActionRefused`] for a busy agent unless `force`.
+    pub async fn kill_pane(
+        &self,
+        pane_id: &str,
+        whole_window: bool,
+        force: bool,
+        request_ref: Option<&str>,
+    ) -> Result<ActionResult, Error> {
+        let method = if whole_window {
+            "window.kill"
+        } else {
+            "pane.kill"
+        };
+        let params =
+            serde_json::json!({"pane_id": pane_id, "force": force, "request_ref": request_ref});
+        self.call_typed(method, params).await
+    }
+
+    /// `pane.kill` for every pane of `pane_ids`, a few at a time over the
+    /// connection pool, with one result per pane: a pane that fails does not
+    /// stop the others. With `request_ref`, pane `%3` is killed with
+    /// `"{request_ref}/%3"`, so repeating the whole call is safe.
+    pub async fn kill_panes(
+        &self,
+        pane_ids: &[&str],
+        force: bool,
+        request_ref: Option<&str>,
+    ) -> BTreeMap<String, Result<ActionResult, Error>> {
+        let slots = Arc::new(tokio::sync::Semaphore::new(KILL_FAN_OUT));
+        let mut kills = tokio::task::JoinSet::new();
+        for pane_id in pane_ids {
+            let slot = Arc::clone(&slots)
+                .acquire_owned()
+                .await
+                .expect("semaphore is never closed");
+            let client = self.clone();
+            let pane_id = pane_id.to_string();
+            let request_ref = request_ref.map(|r| format!("{r}/{pane_id}"));
+            kills.spawn(async move {
+                let result = client
+                    .kill_pane(&pane_id, false, force, request_ref.as_deref())
+                    .await;
+                drop(slot);
+                (pane_id, result)
+            });
+        }
+        let mut results = BTreeMap::new();
+        while let Some(done) = kills.join_next().await {
+            let (pane_id, result) = done.expect("kill task panicked");
+            results.insert(pane_id, result);
+        }
+        results
+    }
+
+    /// `pane.respawn`: restart a dead pane (`kill` restarts a live one),
+    /// optionally with a different `command`.
+    pub async fn respawn_pane(
+        &self,
+        pane_id: &str,
+        command: Option<&str>,
+        kill: bool,
+        request_ref: Option<&str>,
+    ) -> Result<ActionResult, Error> {
+        let params = serde_json::json!({
+            "pane_id": pane_id,
+            "command": command,
+            "kill": kill,
+            "request_ref": request_ref,
+        });
+        self.call_typed("pane.respawn", params).await
+    }
+
+    /// `pane.restart`: kill the pane's agent and relaunch it with the
+    /// detected provider's command (or `command`). With `if_state` (e.g.
+    /// `["error"]`) the daemon refuses unless the agent is in one of them.
+    pub async fn restart_agent(
+        &self,
+        pane_id: &str,
+        if_state: &[&str],
+        command: Option<&str>,
+        request_ref: Option<&str>,
+    ) -> Result<ActionResult, Error> {
+        let params = serde_json::json!({
+            "pane_id": pane_id,
+            "if_state": if_state,
+            "command": command,
+            "request_ref": request_ref,
+        });
+        self.call_typed("pane.restart", params).await
+    }
+
+    /// `pane.send`: type the same text (or press the same key) in every
+    /// pane of `send`. Fails before sending anything if a listed pane is
+    /// unknown or no pane matches the filter.
+    pub async fn send_batch(&self, send: &SendBatch) -> Result<SendResult, Error> {
+        self.call_typed("pane.send", send_params(send)).await
+    }
+
+    /// `pane.send` with `at` (RFC 3339) or `after` (`10m`, `2h`): park the
+    /// send in the daemon until it is due. Targets and filters are resolved
+    /// when it runs.
+    pub async fn schedule_send(
+        &self,
+        send: &SendBatch,
+        at: Option<&str>,
+        after: Option<&str>,
+    ) -> Result<ScheduledSend, Error> {
+        let mut params = send_params(send);
+        params["at"] = at.into();
+        params["after"] = after.into();
+        self.call_typed("pane.send", params).await
+    }
+
+    /// `schedule.list`: pending sends, soonest first.
+    pub async fn scheduled_sends(&self) -> Result<Vec<ScheduledSend>, Error> {
+        self.call_typed("schedule.list", serde_json::json!({}))
+            .await
+    }
+
+    /// `schedule.cancel`: drop a pending send before it runs.
+    pub async fn cancel_scheduled_send(&self, id: u64) -> Result<(), Error> {
+        let _: Value = self
+            .call_typed("schedule.cancel", serde_json::json!({"id": id}))
+            .await?;
+        Ok(())
+    }
+
+    /// `pane.run`: start an agent and return its pane (`pane_id`, `address`).
+    pub async fn run_agent(&self, run: &RunAgent) -> Result<ActionResult, Error> {
+        let params = serde_json::json!({
+            "agent": run.agent,
+            "prompt": run.prompt,
+            "command": run.command,
+            "session": run.session,
+            "pane_id": run.pane_id,
+            "reuse_idle": run.reuse_idle,
+            "cwd": run.cwd,
+            "request_ref": run.request_ref,
+        });
+        self.call_typed("pane.run", params).await
+    }
+
+    /// `pane.transcript`: the conversation of the agent in `pane_id` as
+    /// markdown. With `archive_dir` (absolute, on the daemon host) the
+    /// daemon writes it to `<archive_dir>/<provider>-<session>.md` instead
+    /// of returning it.
+    pub async fn export_transcript(
+        &self,
+        pane_id: &str,
+        archive_dir: Option<&str>,
+    ) -> Result<Transcript, Error> {
+        let params = serde_json::json!({"pane_id": pane_id, "archive_dir": archive_dir});
+        self.call_typed("pane.transcript", params).await
+    }
+
+    /// `macro.list`: macros defined in the daemon config.
+    pub async fn list_macros(&self) -> Result<Vec<MacroInfo>, Error> {
+        self.call_typed("macro.list", serde_json::json!({})).await
+    }
+
+    /// `macro.run`: run macro `name` against `pane_id`, filling its
+    /// `{param}` placeholders from `params`. A failing step aborts the rest
+    /// with [`RpcErrorKind::ActionFailed`].
+    pub async fn run_macro(
+        &self,
+        name: &str,
+        pane_id: &str,
+        params: &BTreeMap<String, String>,
+        request_ref: Option<&str>,
+    ) -> Result<MacroRun, Error> {
+        let params = serde_json::json!({
+            "name": name,
+            "pane_id": pane_id,
+            "params": params,
+            "request_ref": request_ref,
+        });
+        self.call_typed("macro.run", params).await
+    }
+
+    /// `pane.output`: the last `lines` (default 50) lines of `pane_id`. With
+    /// the `cursor` of an earlier reply as `since`, only the lines printed
+    /// after it (see [`PaneOutput::full`]).
+    pub async fn pane_output(
+        &self,
+        pane_id: &str,
+        lines: Option<u64>,
+        since: Option<&str>,
+    ) -> Result<PaneOutput, Error> {
+        let params = serde_json::json!({"pane_id": pane_id, "lines": lines, "since": since});
+        self.call_typed("pane.output", params).await
+    }
+
+    /// `pane.search`: capture the last `lines` (default 200) of every pane
+    /// in `pane_ids` (all panes if empty) and return those whose output
+    /// contains `q`, a literal string (`pane.search` also takes `regex:
+    /// true`).
+    pub async fn search_output(
+        &self,
+        q: &str,
+        pane_ids: &[&str],
+        ignore_case: bool,
+        lines: Option<u64>,
+    ) -> Result<SearchResult, Error> {
+        let params = serde_json::json!({
+            "q": q,
+            "pane_ids": pane_ids,
+            "ignore_case": ignore_case,
+            "lines": lines,
+        });
+        self.call_typed("pane.search", params).await
+    }
+
+    /// `recording.list`: pane runtimes recorded on disk, oldest first.
+    pub async fn recordings(&self) -> Result<Vec<Recording>, Error> {
+        self.call_typed("recording.list", serde_json::json!({}))
+            .await
+    }
+
+    /// `recording.replay`: a runtime's recorded output, from `since` (RFC
+    /// 3339 or an age like `1h`) if given. Works after the pane was killed.
+    pub async fn replay_recording(
+        &self,
+        runtime: &str,
+        since: Option<&str>,
+    ) -> Result<Replay, Error> {
+        let params = serde_json::json!({"runtime": runtime, "since": since});
+        self.call_typed("recording.replay", params).await
+    }
+
+    /// [`Client::replay_recording`] with `pipe-pane` output left as the
+    /// pane printed it, in `raw` records.
+    pub async fn replay_recording_raw(
+        &self,
+        runtime: &str,
+        since: Option<&str>,
+    ) -> Result<Replay, Error> {
+        let params = serde_json::json!({"runtime": runtime, "since": since, "raw": true});
+        self.call_typed("recording.replay", params).await
+    }
+
+    /// `macro.run` from step `from_step` on, e.g. the step a failed run
+    /// named in its error.
+    pub async fn resume_macro(
+        &self,
+        name: &str,
+        pane_id: &str,
+        params: &BTreeMap<String, String>,
+        from_step: usize,
+        request_ref: Option<&str>,
+    ) -> Result<MacroRun, Error> {
+        let params = serde_json::json!({
+            "name": name,
+            "pane_id": pane_id,
+            "params": params,
+            "from_step": from_step,
+            "request_ref": request_ref,
+        });
+        self.call_typed("macro.run", params).await
+    }
+
+    /// `macro.run` with inline `steps` (`[{"send": "..."}, {"wait":
+    /// "WaitingInput", "timeout_secs": 60}, {"key": "y"}]`, the
+    /// `[[macros]]` step format) instead of a configured macro.
+    pub async fn run_pipeline(
+        &self,
+        pane_id: &str,
+        steps: &[Value],
+        params: &BTreeMap<String, String>,
+        from_step: usize,
+        request_ref: Option<&str>,
+    ) -> Result<MacroRun, Error> {
+        let params = serde_json::json!({
+            "pane_id": pane_id,
+            "steps": steps,
+            "params": params,
+            "from_step": from_step,
+            "request_ref": request_ref,
+        });
+        self.call_typed("macro.run", params).await
+    }
+
+    /// `responder.status`: kill switch, rules and audit trail (only the
+    /// entries of `rule` if given).
+    pub async fn responder_status(&self, rule: Option<&str>) -> Result<ResponderStatus, Error> {
+        self.call_typed("responder.status", serde_json::json!({"rule": rule}))
+            .await
+    }
+
+    /// `responder.set_enabled`: flip the auto-responder kill switch. Off
+    /// stays off across config reloads; `enabled = false` in `[responder]`
+    /// still keeps it off after `true`. Returns the new state.
+    pub async fn set_responder_enabled(&self, enabled: bool) -> Result<bool, Error> {
+        let result: Value = self
+            .call_typed(
+                "responder.set_enabled",
+                serde_json::json!({"enabled": enabled}),
+            )
+            .await?;
+        Ok(result["enabled"].as_bool().unwrap_or(enabled))
+    }
+
+    /// `restart.events`: recent auto-restarts and give-ups, oldest first.
+    pub async fn restart_events(&self) -> Result<Vec<RestartEvent>, Error> {
+        self.call_typed("restart.events", serde_json::json!({}))
+            .await
+    }
+
+    /// `actions.history`: recent action calls, oldest first. `since` is RFC
+    /// 3339 or an age (`30m`, `2h`, `1d`); `target` a pane id; `action_type`
+    /// a method or a prefix ending in `*` (`group.*`).
+    pub async fn action_history(
+        &self,
+        since: Option<&str>,
+        target: Option<&str>,
+        action_type: Option<&str>,
+        limit: Option<u32>,
+    ) -> Result<Vec<ActionRecord>, Error> {
+        let params = serde_json::json!({
+            "since": since,
+            "target": target,
+            "action_type": action_type,
+            "limit": limit,
+        });
+        self.call_typed("actions.history", params).await
+    }
+
+    /// `group.add`: add panes to `group`, creating it. Returns the members.
+    pub async fn add_to_group(&self, group: &str, pane_ids: &[&str]) -> Result<Vec<String>, Error> {
+        let params = serde_json::json!({"group": group, "pane_ids": pane_ids});
+        let result: Value = self.call_typed("group.add", params).await?;
+        Ok(serde_json::from_value(result["panes"].clone()).unwrap_or_default())
+    }
+
+    /// `group.remove`: remove `pane_ids` from `group`, or delete the group
+    /// when None. Returns the remaining members (empty once deleted).
+    pub async fn remove_from_group(
+        &self,
+        group: &str,
+        pane_ids: Option<&[&str]>,
+    ) -> Result<Vec<String>, Error> {
+        let params = serde_json::json!({"group": group, "pane_ids": pane_ids});
+        let result: Value = self.call_typed("group.remove", params).await?;
+        Ok(serde_json::from_value(result["panes"].clone()).unwrap_or_default())
+    }
+
+    /// `group.list`: all groups with their aggregated summaries.
+    pub async fn list_groups(&self) -> Result<Vec<GroupInfo>, Error> {
+        self.call_typed("group.list", serde_json::json!({})).await
+    }
+
+    /// `group.send`: type `text` (then Enter unless `enter` is false) into
+    /// every member of `group`.
+    pub async fn group_send(
+        &self,
+        group: &str,
+        text: &str,
+        enter: bool,
+        request_ref: Option<&str>,
+    ) -> Result<GroupAction, Error> {
+        let params = serde_json::json!({
+            "group": group,
+            "text": text,
+            "enter": enter,
+            "request_ref": request_ref,
+        });
+        self.call_typed("group.send", params).await
+    }
+
+    /// `group.kill`: kill every member of `group`. Without `force` the call
+    /// is refused while a member agent is busy, as for [`Client::kill_pane`].
+    pub async fn group_kill(
+        &self,
+        group: &str,
+        force: bool,
+        request_ref: Option<&str>,
+    ) -> Result<GroupAction, Error> {
+        let params =
+            serde_json::json!({"group": group, "force": force, "request_ref": request_ref});
+        self.call_typed("group.kill", params).await
+    }
+}
+
+/// `pane.send` params of `send`.
+fn send_params(send: &SendBatch) -> Value {
+    let mut params = serde_json::json!({
+        "text": send.text,
+        "key": send.key,
+        "enter": !send.no_enter && send.key.is_none(),
+        "request_ref": send.request_ref,
+    });
+    if send.pane_ids.is_empty() {
+        params["session"] = send.session.clone().into();
+        params["state"] = send.states.clone().into();
+        params["agent"] = send.agent.clone().into();
+    } else {
+        params["pane_ids"] = send.pane_ids.clone().into();
+    }
+    params
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tokio::net::UnixListener;
+
+    /// Fake daemon: answers successive connections with `replies`; `None`
+    /// closes the connection without answering. Returns the requests seen.
+    async fn serve(replies: Vec<Option<Value>>) -> (Client, tokio::task::JoinHandle<Vec<Value>>) {
+        let dir = std::env::temp_dir().join(format!(
+            "agtmux-client-test-{}-{}",
+            std::process::id(),
+            std::time::SystemTime::now()
+                .duration_since(std::time::UNIX_EPOCH)
+                .expect("clock")
+                .as_nanos()
+        ));
+        std::fs::create_dir_all(&dir).expect("temp dir");
+        let path = dir.join("d.sock");
+        let listener = UnixListener::bind(&path).expect("bind");
+        let handle = tokio::spawn(async move {
+            let mut requests = Vec::new();
+            for reply in replies {
+                let (stream, _) = listener.accept().await.expect("accept");
+                let (reader, mut writer) = stream.into_split();
+                let mut line = String::new();
+                BufReader::new(reader)
+                    .read_line(&mut line)
+                    .await
+                    .expect("read");
+                requests.push(serde_json::from_str(line.trim()).expect("request json"));
+                if let Some(reply) = reply {
+                    let mut out = reply.to_string();
+                    out.push('\n');
+                    writer.write_all(out.as_bytes()).await.expect("write");
+                }
+            }
+            let _ = std::fs::remove_dir_all(&dir);
+            requests
+        });
+        (Client::new(path.to_string_lossy()), handle)
+    }
+
+    async fn serve_once(reply: Value) -> (Client, tokio::task::JoinHandle<Vec<Value>>) {
+        serve(vec![Some(reply)]).await
+    }
+
+    #[tokio::test]
+    async fn missing_socket_is_unreachable() {
+        let err = Client::new("/nonexistent/agtmux-test.sock")
+            .list_panes()
+            .await
+            .expect_err("no daemon");
+        assert!(matches!(err, Error::Unreachable { .. }));
+        assert_eq!(err.code(), "ERR_DAEMON_UNREACHABLE");
+    }
+
+    #[tokio::test]
+    async fn rpc_error_keeps_code_and_message() {
+        let (client, server) = serve_once(serde_json::json!({
+            "jsonrpc": "2.0",
+            "id": 1,
+            "error": {"code": -32002, "message": "unknown pane: \"%9\""},
+        }))
+        .await;
+        let err = client.set_label("%9", "x").await.expect_err("rpc error");
+        assert_eq!(err.code(), "ERR_PANE_NOT_FOUND");
+        assert_eq!(err.rpc_kind(), Some(RpcErrorKind::PaneNotFound));
+        assert_eq!(
+            Error::Rpc {
+                code: -32099,
+                message: String::new()
+            }
+            .rpc_kind(),
+            Some(RpcErrorKind::Other(-32099))
+        );
+
+        let requests = server.await.expect("server");
+        assert_eq!(requests[0]["method"], "label.set");
+        assert_eq!(requests[0]["params"]["pane_id"], "%9");
+    }
+
+    #[tokio::test]
+    async fn dropped_connection_retried_for_idempotent_methods() {
+        let ok = serde_json::json!({"jsonrpc": "2.0", "id": 1, "result": []});
+        let (client, server) = serve(vec![None, Some(ok)]).await;
+        let panes = client.list_panes().await.expect("retried");
+        assert!(panes.is_empty());
+        assert_eq!(server.await.expect("server").len(), 2);
+
+        let (client, server) = serve(vec![None]).await;
+        let err = client
+            .call("source.ingest", serde_json::json!({}))
+            .await
+            .expect_err("not replayed");
+        assert_eq!(err.code(), "ERR_IO");
+        assert_eq!(server.await.expect("server").len(), 1);
+    }
+
+    #[tokio::test]
+    async fn pane_list_deltas_keep_a_copy_current() {
+        let (client, server) = serve_once(serde_json::json!({
+            "jsonrpc": "2.0",
+            "id": 1,
+            "result": {
+                "cursor": 9,
+                "full": false,
+                "panes": [{"pane_id": "%2", "label": "api"}, {"pane_id": "%4"}],
+                "removed": ["%3"],
+            },
+        }))
+        .await;
+        let mut panes = vec![
+            serde_json::json!({"pane_id": "%2"}),
+            serde_json::json!({"pane_id": "%3"}),
+        ];
+        let delta = client.list_panes_since(7).await.expect("delta");
+        assert_eq!(delta.apply(&mut panes), 9);
+        assert_eq!(
+            panes,
+            [
+                serde_json::json!({"pane_id": "%2", "label": "api"}),
+                serde_json::json!({"pane_id": "%4"}),
+            ]
+        );
+        let requests = server.await.expect("server");
+        assert_eq!(requests[0]["params"]["since_cursor"], 7);
+
+        let (client, server) = serve_once(serde_json::json!({
+            "jsonrpc": "2.0",
+            "id": 1,
+            "result": [{"pane_id": "%2", "activity_state": "Idle"}],
+        }))
+        .await;
+        let panes = client
+            .list_panes_fields(&["activity_state"])
+            .await
+            .expect("panes");
+        assert_eq!(panes[0]["activity_state"], "Idle");
+        let requests = server.await.expect("server");
+        assert_eq!(
+            requests[0]["params"]["fields"],
+            serde_json::json!(["activity_state"])
+        );
+    }
+
+    #[tokio::test]
+    async fn capabilities_deserializes_and_ignores_unknown_fields() {
+        let (client, _server) = serve_once(serde_json::json!({
+            "jsonrpc": "2.0",
+            "id": 1,
+            "result": {
+                "version": "0.1.0",
+                "methods": ["list_panes", "daemon.capabilities"],
+                "features": [{
+                    "name": "strict_admission",
+                    "stage": "experimental",
+                    "enabled": true,
+                    "default": false,
+                    "description": "d",
+                }],
+                "added_later": 1,
+            },
+        }))
+        .await;
+        let caps = client.capabilities().await.expect("capabilities");
+        assert!(caps.has_method("list_panes"));
+        assert!(!caps.has_method("watch"));
+        assert!(caps.is_enabled("strict_admission"));
+        assert!(!caps.is_enabled("claude_jsonl"));
+    }
+
+    #[tokio::test]
+    async fn kill_panes_reports_each_pane() {
+        use crate::testing::{FakeDaemon, Reply};
+
+        let daemon = FakeDaemon::start().await.expect("start");
+        daemon.on(
+            "pane.kill",
+            Reply::result(serde_json::json!({"action": "pane.kill", "pane_id": "%1",
+                "request_ref": null, "replayed": false})),
+        );
+        daemon.on_once("pane.kill", Reply::error(codes::ACTION_REFUSED, "busy"));
+        let results = daemon
+            .client()
+            .kill_panes(&["%1", "%2"], false, Some("cleanup"))
+            .await;
+        assert_eq!(results.len(), 2);
+        assert_eq!(results.values().filter(|r| r.is_ok()).count(), 1);
+        let mut refs: Vec<Value> = daemon
+            .calls_to("pane.kill")
+            .into_iter()
+            .map(|c| c.params["request_ref"].clone())
+            .collect();
+        refs.sort_by_key(Value::to_string);
+        assert_eq!(refs, ["cleanup/%1", "cleanup/%2"]);
+    }
+
+    #[tokio::test]
+    async fn request_refs_are_resent_only_to_the_same_daemon() {
+        use crate::testing::{FakeDaemon, Reply};
+
+        let killed = serde_json::json!({"action": "pane.kill", "pane_id": "%1",
+            "request_ref": "r1", "replayed": true});
+        let daemon = FakeDaemon::start().await.expect("start");
+        let client = Client::new(daemon.socket_path())
+            .with_retry(RetryPolicy::default().base_delay(std::time::Duration::from_millis(1)));
+        daemon.on("pane.kill", Reply::result(killed));
+        daemon.on_once("pane.kill", Reply::Close);
+        client
+            .kill_pane("%1", false, false, Some("r1"))
+            .await
+            .expect("same daemon: resent and replayed");
+        assert_eq!(daemon.calls_to("pane.kill").len(), 2);
+
+        // The daemon that got the call is gone; a new one would run it again.
+        let restarted = FakeDaemon::start().await.expect("start");
+        let client = Client::new(restarted.socket_path())
+            .with_retry(RetryPolicy::default().base_delay(std::time::Duration::from_millis(1)));
+        restarted.on_once(
+            "daemon.info",
+            Reply::result(serde_json::json!({"nonce": "before", "pid": 1})),
+        );
+        restarted.on_once("pane.kill", Reply::Close);
+        let err = client
+            .kill_pane("%1", false, false, Some("r2"))
+            .await
+            .expect_err("not resent after a restart");
+        assert_eq!(err.code(), "ERR_IO");
+        assert_eq!(restarted.calls_to("pane.kill").len(), 1);
+        assert_eq!(restarted.calls_to("daemon.info").len(), 2);
+    }
+
+    #[tokio::test]
+    async fn pooled_connection_is_reused() {
+        let dir = std::env::temp_dir().join(format!("agtmux-pool-test-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("temp dir");
+        let path = dir.join("d.sock");
+        let _ = std::fs::remove_file(&path);
+        let listener = UnixListener::bind(&path).expect("bind");
+        // Keep-alive daemon: answers every line on the one connection.
+        tokio::spawn(async move {
+            let (stream, _) = listener.accept().await.expect("accept");
+            let (reader, mut writer) = stream.into_split();
+            let mut lines = BufReader::new(reader).lines();
+            while let Some(_request) = lines.next_line().await.expect("read") {
+                let reply = serde_json::json!({"jsonrpc": "2.0", "id": 1, "result": []});
+                writer
+                    .write_all(format!("{reply}\n").as_bytes())
+                    .await
+                    .expect("write");
+            }
+        });
+
+        let client = Client::new(path.to_string_lossy());
+        client.list_panes().await.expect("first");
+        client
+            .clone()
+            .list_panes()
+            .await
+            .expect("second, via clone");
+        let stats = client.pool_stats();
+        assert_eq!((stats.opened, stats.reused, stats.idle), (1, 1, 1));
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[tokio::test]
+    async fn closed_pooled_connection_falls_back_to_fresh_one() {
+        let dir =
+            std::env::temp_dir().join(format!("agtmux-pool-closed-test-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("temp dir");
+        let path = dir.join("d.sock");
+        let _ = std::fs::remove_file(&path);
+        let listener = UnixListener::bind(&path).expect("bind");
+        // One request per connection, like daemons without keep-alive;
+        // `closed` fires once the first connection is gone.
+        let (closed_tx, closed_rx) = tokio::sync::oneshot::channel();
+        let server = tokio::spawn(async move {
+            let mut closed_tx = Some(closed_tx);
+            for _ in 0..2 {
+                let (stream, _) = listener.accept().await.expect("accept");
+                let (reader, mut writer) = stream.into_split();
+                let mut lines = BufReader::new(reader).lines();
+                lines.next_line().await.expect("read").expect("request");
+                let reply = serde_json::json!({"jsonrpc": "2.0", "id": 1, "result": {}});
+                writer
+                    .write_all(format!("{reply}\n").as_bytes())
+                    .await
+                    .expect("write");
+                drop((lines, writer));
+                if let Some(tx) = closed_tx.take() {
+                    let _ = tx.send(());
+                }
+            }
+        });
+
+        let client = Client::new(path.to_string_lossy()).with_retry(RetryPolicy::none());
+        client
+            .call("source.heartbeat", serde_json::json!({}))
+            .await
+            .expect("first");
+        // The pooled connection is closed, so writing to it fails.
+        closed_rx.await.expect("first connection closed");
+        client
+            .call("source.heartbeat", serde_json::json!({}))
+            .await
+            .expect("second");
+        server.await.expect("server");
+        assert_eq!(client.pool_stats().opened, 2);
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[tokio::test]
+    async fn pooled_connection_lost_after_the_request_is_not_resent() {
+        let dir =
+            std::env::temp_dir().join(format!("agtmux-pool-lost-test-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("temp dir");
+        let path = dir.join("d.sock");
+        let _ = std::fs::remove_file(&path);
+        let listener = UnixListener::bind(&path).expect("bind");
+        // Answers the first request, reads the second and hangs up.
+        let server = tokio::spawn(async move {
+            let (stream, _) = listener.accept().await.expect("accept");
+            let (reader, mut writer) = stream.into_split();
+            let mut lines = BufReader::new(reader).lines();
+            lines.next_line().await.expect("read").expect("first");
+            let reply = serde_json::json!({"jsonrpc": "2.0", "id": 1, "result": {}});
+            writer
+                .write_all(format!("{reply}\n").as_bytes())
+                .await
+                .expect("write");
+            lines.next_line().await.expect("read").expect("second");
+            drop((lines, writer));
+            let third =
+                tokio::time::timeout(std::time::Duration::from_millis(200), listener.accept())
+                    .await;
+            third.is_ok()
+        });
+
+        let client = Client::new(path.to_string_lossy()).with_retry(RetryPolicy::none());
+        client
+            .call("source.heartbeat", serde_json::json!({}))
+            .await
+            .expect("first");
+        let err = client
+            .call("source.heartbeat", serde_json::json!({}))
+            .await
+            .expect_err("the daemon may have run it");
+        assert_eq!(err.code(), "ERR_IO");
+        assert!(!server.await.expect("server"), "not resent");
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[tokio::test]
+    async fn interceptors_decorate_and_observe_calls() {
+        #[derive(Default)]
+        struct Recorder(std::sync::Mutex<Vec<String>>);
+
+        impl Interceptor for Arc<Recorder> {
+            fn on_request(&self, request: &mut Request) {
+                request
+                    .meta
+                    .insert("client".to_string(), serde_json::json!("test/1.0"));
+            }
+
+            fn on_response(
+                &self,
+                request: &Request,
+                result: &Result<Value, Error>,
+                _elapsed: std::time::Duration,
+            ) {
+                let outcome = match result {
+                    Ok(_) => "ok",
+                    Err(e) => e.code(),
+                };
+                self.0
+                    .lock()
+                    .expect("lock")
+                    .push(format!("{} {outcome}", request.method));
+            }
+        }
+
+        let (client, server) = serve_once(serde_json::json!({
+            "jsonrpc": "2.0",
+            "id": 1,
+            "error": {"code": -32601, "message": "method not found"},
+        }))
+        .await;
+        let recorder = Arc::new(Recorder::default());
+        let client = client.with_interceptor(Arc::clone(&recorder));
+        client.list_labels().await.expect_err("rpc error");
+
+        let requests = server.await.expect("server");
+        assert_eq!(requests[0]["meta"]["client"], "test/1.0");
+        assert_eq!(
+            *recorder.0.lock().expect("lock"),
+            vec!["label.list ERR_METHOD_NOT_FOUND".to_string()]
+        );
+    }
+
+    #[tokio::test]
+    async fn shape_mismatch_is_protocol_error() {
+        let (client, _server) = serve_once(serde_json::json!({
+            "jsonrpc": "2.0",
+            "id": 1,
+            "result": {"pid": "not a number"},
+        }))
+        .await;
+        let err = client.daemon_info().await.expect_err("bad shape");
+        assert_eq!(err.code(), "ERR_PROTOCOL");
+        assert!(err.to_string().contains("daemon.info"), "{err}");
+    }
+}
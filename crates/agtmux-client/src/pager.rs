@@ -0,0 +1,110 @@
+//! [`ListPanesPager`]: walk `list_panes` in pages.
+
+use serde_json::Value;
+
+use crate::{Client, Error};
+
+/// Pages through `list_panes` (`limit` / `after` params) in pane id order.
+///
+/// Daemons without paging answer with the full array, which is returned as
+/// a single page.
+#[derive(Debug)]
+pub struct ListPanesPager<'a> {
+    client: &'a Client,
+    page_size: u32,
+    after: Option<String>,
+    done: bool,
+}
+
+impl<'a> ListPanesPager<'a> {
+    pub(crate) fn new(client: &'a Client, page_size: u32) -> Self {
+        Self {
+            client,
+            page_size: page_size.max(1),
+            after: None,
+            done: false,
+        }
+    }
+
+    /// Next page, or None once every page has been returned.
+    pub async fn next_page(&mut self) -> Result<Option<Vec<Value>>, Error> {
+        if self.done {
+            return Ok(None);
+        }
+        let params = serde_json::json!({"limit": self.page_size, "after": self.after});
+        let result = self.client.call("list_panes", params).await?;
+        let (panes, next_after) = match result {
+            Value::Array(panes) => (panes, None),
+            mut page => {
+                let panes = match page["panes"].take() {
+                    Value::Array(panes) => panes,
+                    _ => {
+                        return Err(Error::Protocol(
+                            "list_panes page without panes (method list_panes)".to_string(),
+                        ));
+                    }
+                };
+                (panes, page["next_after"].as_str().map(String::from))
+            }
+        };
+        self.done = next_after.is_none();
+        self.after = next_after;
+        Ok(Some(panes))
+    }
+
+    /// Remaining pages concatenated.
+    pub async fn collect_all(mut self) -> Result<Vec<Value>, Error> {
+        let mut all = Vec::new();
+        while let Some(page) = self.next_page().await? {
+            all.extend(page);
+        }
+        Ok(all)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use crate::testing::{FakeDaemon, Reply};
+
+    #[tokio::test]
+    async fn walks_pages_until_cursor_ends() {
+        let daemon = FakeDaemon::start().await.expect("start");
+        daemon.on_once(
+            "list_panes",
+            Reply::result(serde_json::json!({"panes": [{"pane_id": "%1"}], "next_after": "%1"})),
+        );
+        daemon.on_once(
+            "list_panes",
+            Reply::result(serde_json::json!({"panes": [{"pane_id": "%2"}], "next_after": null})),
+        );
+        let client = daemon.client();
+        let all = client
+            .list_panes_paged(1)
+            .collect_all()
+            .await
+            .expect("pages");
+        assert_eq!(all.len(), 2);
+
+        let calls = daemon.calls_to("list_panes");
+        assert_eq!(calls.len(), 2);
+        assert!(calls[0].params["after"].is_null());
+        assert_eq!(calls[1].params["after"], "%1");
+        assert_eq!(calls[1].params["limit"], 1);
+    }
+
+    #[tokio::test]
+    async fn plain_array_is_a_single_page() {
+        let daemon = FakeDaemon::start().await.expect("start");
+        daemon.on(
+            "list_panes",
+            Reply::result(serde_json::json!([{"pane_id": "%1"}, {"pane_id": "%2"}])),
+        );
+        let client = daemon.client();
+        let mut pager = client.list_panes_paged(1);
+        assert_eq!(
+            pager.next_page().await.expect("page").map(|p| p.len()),
+            Some(2)
+        );
+        assert_eq!(pager.next_page().await.expect("done"), None);
+    }
+}
@@ -0,0 +1,121 @@
+//! Keep-alive connection pool shared by clones of a [`Client`](crate::Client).
+
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, Instant};
+
+use tokio::io::BufReader;
+use tokio::net::UnixStream;
+
+/// Idle connection reuse settings. The daemon closes connections idle for
+/// 30s, so `idle_timeout` must stay well below that.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct PoolConfig {
+    max_idle: usize,
+    idle_timeout: Duration,
+}
+
+impl Default for PoolConfig {
+    /// Up to 2 idle connections, each reused for at most 5s of idleness.
+    fn default() -> Self {
+        Self {
+            max_idle: 2,
+            idle_timeout: Duration::from_secs(5),
+        }
+    }
+}
+
+impl PoolConfig {
+    /// Connection per call (no reuse).
+    pub fn disabled() -> Self {
+        Self {
+            max_idle: 0,
+            ..Self::default()
+        }
+    }
+
+    pub fn max_idle(mut self, max_idle: usize) -> Self {
+        self.max_idle = max_idle;
+        self
+    }
+
+    pub fn idle_timeout(mut self, timeout: Duration) -> Self {
+        self.idle_timeout = timeout;
+        self
+    }
+}
+
+/// Connection counters for metrics, from [`Client::pool_stats`](crate::Client::pool_stats).
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct PoolStats {
+    /// New connections opened.
+    pub opened: u64,
+    /// Calls served by an idle pooled connection.
+    pub reused: u64,
+    /// Connections currently idle in the pool.
+    pub idle: usize,
+}
+
+pub(crate) type Conn = BufReader<UnixStream>;
+
+#[derive(Debug, Default)]
+pub(crate) struct Pool {
+    config: PoolConfig,
+    idle: Mutex<Vec<(Conn, Instant)>>,
+    opened: AtomicU64,
+    reused: AtomicU64,
+}
+
+impl Pool {
+    pub(crate) fn new(config: PoolConfig) -> Arc<Self> {
+        Arc::new(Self {
+            config,
+            ..Self::default()
+        })
+    }
+
+    /// Whether connections are kept for reuse at all.
+    pub(crate) fn enabled(&self) -> bool {
+        self.config.max_idle > 0
+    }
+
+    /// Most recently used idle connection that is still open, if any.
+    pub(crate) fn checkout(&self) -> Option<Conn> {
+        let mut idle = self.idle.lock().expect("pool lock");
+        while let Some((conn, since)) = idle.pop() {
+            if since.elapsed() < self.config.idle_timeout && is_open(conn.get_ref()) {
+                self.reused.fetch_add(1, Ordering::Relaxed);
+                return Some(conn);
+            }
+        }
+        None
+    }
+
+    /// Return a connection after a complete request/response exchange.
+    pub(crate) fn checkin(&self, conn: Conn) {
+        let mut idle = self.idle.lock().expect("pool lock");
+        if idle.len() < self.config.max_idle {
+            idle.push((conn, Instant::now()));
+        }
+    }
+
+    pub(crate) fn record_open(&self) {
+        self.opened.fetch_add(1, Ordering::Relaxed);
+    }
+
+    pub(crate) fn stats(&self) -> PoolStats {
+        PoolStats {
+            opened: self.opened.load(Ordering::Relaxed),
+            reused: self.reused.load(Ordering::Relaxed),
+            idle: self.idle.lock().expect("pool lock").len(),
+        }
+    }
+}
+
+/// False if the daemon closed the connection (idle timeout, restart, or a
+/// daemon that only serves one request per connection) or sent stray data.
+fn is_open(stream: &UnixStream) -> bool {
+    let mut probe = [0u8; 1];
+    matches!(stream.try_read(&mut probe), Err(e) if e.kind() == std::io::ErrorKind::WouldBlock)
+}
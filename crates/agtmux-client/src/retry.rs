@@ -0,0 +1,213 @@
+//! [`RetryPolicy`]: exponential backoff with jitter for transient failures
+//! (typically the daemon restarting between two calls).
+
+use std::time::Duration;
+
+use serde_json::Value;
+
+use crate::Error;
+
+/// Methods that are safe to replay: reads, and label writes (setting the same
+/// label twice is a no-op). `source.*` calls mutate ingest state and are not.
+const IDEMPOTENT_METHODS: &[&str] = &[
+    "list_panes",
+    "list_sessions",
+    "list_source_health",
+    "list_source_registry",
+    "state_changed",
+    "summary_changed",
+    "latency_status",
+    "label.set",
+    "label.clear",
+    "label.list",
+    "daemon.info",
+    "daemon.capabilities",
+    "debug.metrics",
+    "task.list",
+    "alerts.list",
+    "group.list",
+    "schedule.list",
+    "macro.list",
+    "recording.list",
+    "responder.status",
+    "restart.events",
+    "pane.search",
+    "pane.output",
+];
+
+/// How [`Client`](crate::Client) retries a failed call.
+///
+/// A connection that cannot be opened is retried for every method, since the
+/// request never reached the daemon. A connection lost mid-call is retried
+/// only for idempotent methods and for calls with a `request_ref`, which the
+/// daemon answers once and replays. The daemon keeps those refs in memory
+/// only, so a `request_ref` call is resent only if `daemon.info` still
+/// reports the daemon process the call went to; after a restart the error
+/// is returned. RPC and protocol errors are never retried.
+///
+/// The delay before retry `n` is drawn from `[d/2, d]` with
+/// `d = min(base_delay * 2^(n-1), max_delay)`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct RetryPolicy {
+    max_attempts: u32,
+    base_delay: Duration,
+    max_delay: Duration,
+}
+
+impl Default for RetryPolicy {
+    /// 3 attempts, 100ms → 200ms (at most ~300ms of waiting).
+    fn default() -> Self {
+        Self {
+            max_attempts: 3,
+            base_delay: Duration::from_millis(100),
+            max_delay: Duration::from_secs(1),
+        }
+    }
+}
+
+impl RetryPolicy {
+    /// Single attempt, errors surface immediately.
+    pub fn none() -> Self {
+        Self {
+            max_attempts: 1,
+            ..Self::default()
+        }
+    }
+
+    /// Total attempts including the first (minimum 1).
+    pub fn max_attempts(mut self, attempts: u32) -> Self {
+        self.max_attempts = attempts.max(1);
+        self
+    }
+
+    pub fn base_delay(mut self, delay: Duration) -> Self {
+        self.base_delay = delay;
+        self
+    }
+
+    pub fn max_delay(mut self, delay: Duration) -> Self {
+        self.max_delay = delay;
+        self
+    }
+
+    /// Whether any call is tried more than once.
+    pub(crate) fn retries(&self) -> bool {
+        self.max_attempts > 1
+    }
+
+    /// Whether a call to `method` with `params` that failed with `err` on
+    /// attempt `attempt` (1-based) should be tried again.
+    pub(crate) fn should_retry(
+        &self,
+        method: &str,
+        params: &Value,
+        err: &Error,
+        attempt: u32,
+    ) -> bool {
+        if attempt >= self.max_attempts {
+            return false;
+        }
+        match err {
+            Error::Unreachable { .. } => true,
+            Error::Io(_) => replayable(method, params),
+            _ => false,
+        }
+    }
+
+    /// Delay before retry number `retry` (1-based).
+    pub(crate) fn backoff(&self, retry: u32) -> Duration {
+        let exp = self
+            .base_delay
+            .saturating_mul(1u32 << (retry - 1).min(16))
+            .min(self.max_delay);
+        exp / 2 + (exp / 2).mul_f64(unit_random())
+    }
+}
+
+/// Whether resending `method` with `params` after a lost connection cannot
+/// run it twice: idempotent methods, and calls the daemon deduplicates by
+/// `request_ref` (as long as the same daemon process answers).
+pub(crate) fn replayable(method: &str, params: &Value) -> bool {
+    idempotent(method) || has_request_ref(params)
+}
+
+/// Whether `method` is safe to run twice on any daemon.
+pub(crate) fn idempotent(method: &str) -> bool {
+    IDEMPOTENT_METHODS.contains(&method)
+}
+
+pub(crate) fn has_request_ref(params: &Value) -> bool {
+    params
+        .get("request_ref")
+        .is_some_and(|r| r.as_str().is_some_and(|r| !r.is_empty()))
+}
+
+/// Uniform value in `[0, 1)`, good enough for jitter (no `rand` dependency:
+/// `RandomState` is randomly keyed per process and per instance).
+fn unit_random() -> f64 {
+    use std::hash::{BuildHasher, Hasher};
+    let bits = std::collections::hash_map::RandomState::new()
+        .build_hasher()
+        .finish();
+    (bits >> 11) as f64 / (1u64 << 53) as f64
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn io_error() -> Error {
+        Error::Io(std::io::Error::from(std::io::ErrorKind::UnexpectedEof))
+    }
+
+    #[test]
+    fn retries_only_transient_and_idempotent() {
+        let policy = RetryPolicy::default();
+        let unreachable = Error::Unreachable {
+            socket_path: "/x".to_string(),
+            reason: std::io::Error::from(std::io::ErrorKind::ConnectionRefused),
+        };
+        let none = Value::Null;
+        assert!(policy.should_retry("source.ingest", &none, &unreachable, 1));
+        assert!(policy.should_retry("list_panes", &none, &io_error(), 1));
+        assert!(policy.should_retry("pane.search", &none, &io_error(), 1));
+        assert!(!policy.should_retry("source.ingest", &none, &io_error(), 1));
+        let rpc = Error::Rpc {
+            code: -32602,
+            message: "bad".to_string(),
+        };
+        assert!(!policy.should_retry("list_panes", &none, &rpc, 1));
+        assert!(
+            !policy.should_retry("list_panes", &none, &io_error(), 3),
+            "budget"
+        );
+        assert!(!RetryPolicy::none().should_retry("list_panes", &none, &unreachable, 1));
+    }
+
+    #[test]
+    fn retries_actions_with_a_request_ref() {
+        let policy = RetryPolicy::default();
+        let send = serde_json::json!({"pane_id": "%1", "text": "y"});
+        assert!(!policy.should_retry("pane.send", &send, &io_error(), 1));
+        let mut with_ref = send.clone();
+        with_ref["request_ref"] = "deploy-42".into();
+        assert!(policy.should_retry("pane.send", &with_ref, &io_error(), 1));
+        with_ref["request_ref"] = "".into();
+        assert!(!policy.should_retry("pane.send", &with_ref, &io_error(), 1));
+    }
+
+    #[test]
+    fn backoff_grows_with_jitter_and_caps() {
+        let policy = RetryPolicy::default()
+            .base_delay(Duration::from_millis(100))
+            .max_delay(Duration::from_millis(300));
+        for _ in 0..20 {
+            let first = policy.backoff(1);
+            assert!(first >= Duration::from_millis(50) && first <= Duration::from_millis(100));
+            let second = policy.backoff(2);
+            assert!(second >= Duration::from_millis(100) && second <= Duration::from_millis(200));
+            let capped = policy.backoff(10);
+            assert!(capped >= Duration::from_millis(150) && capped <= Duration::from_millis(300));
+        }
+    }
+}
@@ -0,0 +1,351 @@
+//! [`FakeDaemon`]: an in-process stand-in for `agtmux daemon` so downstream
+//! tools can unit test against [`Client`] without tmux or a real daemon.
+//! Enabled with the `testing` feature:
+//!
+//! ```toml
+//! [dev-dependencies]
+//! agtmux-client = { version = "0.1", features = ["testing"] }
+//! ```
+//!
+//! ```no_run
+//! # async fn demo() -> std::io::Result<()> {
+//! use agtmux_client::testing::{FakeDaemon, Reply};
+//!
+//! let daemon = FakeDaemon::start().await?;
+//! daemon.on("list_panes", Reply::result(serde_json::json!([{"pane_id": "%1"}])));
+//! let panes = daemon.client().list_panes().await.expect("scripted");
+//! assert_eq!(panes.len(), 1);
+//! assert_eq!(daemon.calls_to("list_panes").len(), 1);
+//! # Ok(())
+//! # }
+//! ```
+
+use std::collections::{HashMap, VecDeque};
+use std::path::PathBuf;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{Arc, Mutex};
+
+use serde_json::{Map, Value};
+use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
+use tokio::net::{UnixListener, UnixStream};
+
+use crate::{Client, METHODS, codes};
+
+/// Scripted answer to one call.
+#[derive(Debug, Clone, PartialEq)]
+#[non_exhaustive]
+pub enum Reply {
+    Result(Value),
+    Error {
+        code: i64,
+        message: String,
+    },
+    /// Close the connection without answering (daemon crash or restart).
+    Close,
+}
+
+impl Reply {
+    pub fn result(value: Value) -> Self {
+        Self::Result(value)
+    }
+
+    pub fn error(code: i64, message: impl Into<String>) -> Self {
+        Self::Error {
+            code,
+            message: message.into(),
+        }
+    }
+}
+
+/// A call the fake received.
+#[derive(Debug, Clone, PartialEq)]
+#[non_exhaustive]
+pub struct RecordedCall {
+    pub method: String,
+    pub params: Value,
+    /// Envelope `meta` (set by interceptors), empty if absent.
+    pub meta: Map<String, Value>,
+}
+
+#[derive(Debug, Default)]
+struct Script {
+    once: HashMap<String, VecDeque<Reply>>,
+    sticky: HashMap<String, Reply>,
+    calls: Vec<RecordedCall>,
+}
+
+impl Script {
+    fn reply_for(&mut self, method: &str) -> Reply {
+        if let Some(reply) = self.once.get_mut(method).and_then(VecDeque::pop_front) {
+            return reply;
+        }
+        if let Some(reply) = self.sticky.get(method) {
+            return reply.clone();
+        }
+        default_reply(method)
+    }
+}
+
+/// Fake daemon listening on a socket in a private temp dir. Serves until
+/// dropped; the dir is removed on drop.
+pub struct FakeDaemon {
+    socket_path: String,
+    dir: PathBuf,
+    script: Arc<Mutex<Script>>,
+    task: tokio::task::JoinHandle<()>,
+}
+
+impl FakeDaemon {
+    /// Bind and start serving. Must be called inside a tokio runtime.
+    pub async fn start() -> std::io::Result<Self> {
+        static NEXT: AtomicU64 = AtomicU64::new(0);
+        let dir = std::env::temp_dir().join(format!(
+            "agtmux-fake-{}-{}",
+            std::process::id(),
+            NEXT.fetch_add(1, Ordering::Relaxed)
+        ));
+        std::fs::create_dir_all(&dir)?;
+        let path = dir.join("agtmuxd.sock");
+        let _ = std::fs::remove_file(&path);
+        let listener = UnixListener::bind(&path)?;
+
+        let script = Arc::new(Mutex::new(Script::default()));
+        let accept_script = Arc::clone(&script);
+        let task = tokio::spawn(async move {
+            while let Ok((stream, _)) = listener.accept().await {
+                tokio::spawn(serve(stream, Arc::clone(&accept_script)));
+            }
+        });
+        Ok(Self {
+            socket_path: path.to_string_lossy().into_owned(),
+            dir,
+            script,
+            task,
+        })
+    }
+
+    pub fn socket_path(&self) -> &str {
+        &self.socket_path
+    }
+
+    /// Client for this daemon, with retries disabled so scripted failures
+    /// surface on the first attempt.
+    pub fn client(&self) -> Client {
+        Client::new(self.socket_path.clone()).with_retry(crate::RetryPolicy::none())
+    }
+
+    /// Answer every call to `method` with `reply` (replaces the default).
+    pub fn on(&self, method: &str, reply: Reply) {
+        self.lock().sticky.insert(method.to_string(), reply);
+    }
+
+    /// Answer the next call to `method` with `reply`; queued replies are used
+    /// in order before falling back to [`on`](Self::on) or the default. For
+    /// `watch`, each queued `Result` is streamed as one frame.
+    pub fn on_once(&self, method: &str, reply: Reply) {
+        self.lock()
+            .once
+            .entry(method.to_string())
+            .or_default()
+            .push_back(reply);
+    }
+
+    /// Every call received so far, in arrival order.
+    pub fn calls(&self) -> Vec<RecordedCall> {
+        self.lock().calls.clone()
+    }
+
+    pub fn calls_to(&self, method: &str) -> Vec<RecordedCall> {
+        self.lock()
+            .calls
+            .iter()
+            .filter(|c| c.method == method)
+            .cloned()
+            .collect()
+    }
+
+    fn lock(&self) -> std::sync::MutexGuard<'_, Script> {
+        self.script.lock().expect("fake daemon lock")
+    }
+}
+
+impl Drop for FakeDaemon {
+    fn drop(&mut self) {
+        self.task.abort();
+        let _ = std::fs::remove_dir_all(&self.dir);
+    }
+}
+
+/// Empty-but-valid answers, so unscripted calls behave like an idle daemon.
+fn default_reply(method: &str) -> Reply {
+    let empty_changes = serde_json::json!({"changes": [], "version": 0});
+    match method {
+        "list_panes"
+        | "list_sessions"
+        | "list_source_health"
+        | "list_source_registry"
+        | "label.list"
+        | "task.list"
+        | "macro.list"
+        | "restart.events"
+        | "actions.history"
+        | "schedule.list"
+        | "recording.list"
+        | "group.list" => Reply::Result(serde_json::json!([])),
+        "state_changed" | "watch" => Reply::Result(empty_changes),
+        "summary_changed" => Reply::Result(serde_json::json!({
+            "has_changes": false, "pane_changes": 0, "version": 0,
+            "summary": {"managed": 0, "unmanaged": 0, "total": 0},
+        })),
+        "responder.status" => Reply::Result(serde_json::json!({
+            "enabled": true, "rules": [], "audit": [],
+        })),
+        "daemon.info" => Reply::Result(serde_json::json!({
+            "nonce": "fake", "version": env!("CARGO_PKG_VERSION"), "pid": std::process::id(),
+        })),
+        "pane.search" => Reply::Result(serde_json::json!({
+            "q": "", "searched": 0, "panes": [], "failed": {},
+        })),
+        "daemon.capabilities" => Reply::Result(serde_json::json!({
+            "version": env!("CARGO_PKG_VERSION"), "methods": METHODS, "features": [],
+        })),
+        "label.set" | "label.clear" | "task.set" | "task.clear" | "pane.split" | "pane.kill"
+        | "window.kill" | "pane.respawn" | "pane.restart" | "pane.run" | "pane.send"
+        | "pane.transcript" | "pane.output" | "macro.run" | "group.add" => {
+            Reply::error(codes::PANE_NOT_FOUND, "unknown pane")
+        }
+        "group.remove" | "group.send" | "group.kill" => {
+            Reply::error(codes::INVALID_PARAMS, "unknown group")
+        }
+        "recording.replay" => Reply::error(codes::INVALID_PARAMS, "no recording"),
+        m if METHODS.contains(&m) => Reply::Result(serde_json::json!({})),
+        _ => Reply::error(codes::METHOD_NOT_FOUND, "method not found"),
+    }
+}
+
+async fn serve(stream: UnixStream, script: Arc<Mutex<Script>>) {
+    let (reader, mut writer) = stream.into_split();
+    let mut lines = BufReader::new(reader).lines();
+    while let Ok(Some(line)) = lines.next_line().await {
+        let Ok(request) = serde_json::from_str::<Value>(&line) else {
+            return;
+        };
+        let method = request["method"].as_str().unwrap_or("").to_string();
+        let id = request["id"].clone();
+        let mut replies = {
+            let mut script = script.lock().expect("fake daemon lock");
+            script.calls.push(RecordedCall {
+                method: method.clone(),
+                params: request["params"].clone(),
+                meta: request["meta"].as_object().cloned().unwrap_or_default(),
+            });
+            let mut replies = vec![script.reply_for(&method)];
+            if method == "watch" {
+                replies.extend(script.once.remove("watch").unwrap_or_default());
+            }
+            replies
+        };
+        if method == "watch" && matches!(replies[0], Reply::Result(_)) {
+            // Stream every frame, then hold the connection like the daemon.
+            for reply in replies.drain(..) {
+                let Reply::Result(frame) = reply else { break };
+                let note =
+                    serde_json::json!({"jsonrpc": "2.0", "method": "watch", "params": frame});
+                if writer
+                    .write_all(format!("{note}\n").as_bytes())
+                    .await
+                    .is_err()
+                {
+                    return;
+                }
+            }
+            let _ = lines.next_line().await;
+            return;
+        }
+        let response = match replies.swap_remove(0) {
+            Reply::Result(result) => {
+                serde_json::json!({"jsonrpc": "2.0", "result": result, "id": id})
+            }
+            Reply::Error { code, message } => serde_json::json!({
+                "jsonrpc": "2.0", "error": {"code": code, "message": message}, "id": id,
+            }),
+            Reply::Close => return,
+        };
+        if writer
+            .write_all(format!("{response}\n").as_bytes())
+            .await
+            .is_err()
+        {
+            return;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{ConnectionState, Error, PoolConfig, RpcErrorKind, WatchLoop};
+
+    #[tokio::test]
+    async fn scripted_replies_and_recorded_calls() {
+        let daemon = FakeDaemon::start().await.expect("start");
+        let client = daemon.client();
+
+        assert!(client.list_panes().await.expect("default").is_empty());
+        daemon.on(
+            "label.set",
+            Reply::result(serde_json::json!({"pane_id": "%1", "label": "api"})),
+        );
+        daemon.on_once("label.set", Reply::error(codes::INVALID_PARAMS, "empty"));
+
+        let err = client.set_label("%1", "").await.expect_err("queued first");
+        assert_eq!(err.rpc_kind(), Some(RpcErrorKind::InvalidParams));
+        let label = client.set_label("%1", "api").await.expect("sticky");
+        assert_eq!(label.label.as_deref(), Some("api"));
+
+        let calls = daemon.calls_to("label.set");
+        assert_eq!(calls.len(), 2);
+        assert_eq!(calls[1].params["label"], "api");
+        assert_eq!(daemon.calls().len(), 3);
+
+        // Without pooling: a Close on a reused connection is retried fresh.
+        daemon.on_once("daemon.info", Reply::Close);
+        let fresh = client.clone().with_pool(PoolConfig::disabled());
+        assert!(matches!(fresh.daemon_info().await, Err(Error::Io(_))));
+        assert!(
+            client
+                .capabilities()
+                .await
+                .expect("default")
+                .has_method("watch")
+        );
+    }
+
+    #[tokio::test]
+    async fn streams_scripted_watch_frames() {
+        let daemon = FakeDaemon::start().await.expect("start");
+        daemon.on_once(
+            "watch",
+            Reply::result(serde_json::json!({"version": 1, "changes": []})),
+        );
+        daemon.on_once(
+            "watch",
+            Reply::result(serde_json::json!({"version": 2, "changes": [{"pane_id": "%1"}]})),
+        );
+
+        let states = Arc::new(Mutex::new(Vec::new()));
+        let seen = Arc::clone(&states);
+        let mut watch = WatchLoop::new(daemon.client())
+            .on_connection_state(move |s| seen.lock().expect("lock").push(s.clone()));
+        assert_eq!(watch.next().await.expect("initial").version, 1);
+        let update = watch.next().await.expect("change");
+        assert_eq!((update.version, update.changes.len()), (2, 1));
+        assert_eq!(daemon.calls_to("watch")[0].params["since_version"], 0);
+        assert!(
+            states
+                .lock()
+                .expect("lock")
+                .contains(&ConnectionState::Connected)
+        );
+    }
+}
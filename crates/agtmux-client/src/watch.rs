@@ -0,0 +1,500 @@
+//! [`WatchLoop`]: follow daemon state changes over a long-lived `watch`
+//! connection, reconnecting and resuming from the last seen version.
+
+use std::time::Duration;
+
+use serde_json::Value;
+use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader, Lines};
+use tokio::net::UnixStream;
+use tokio::net::unix::{OwnedReadHalf, OwnedWriteHalf};
+use tokio::time::Instant;
+
+use crate::{Client, Error};
+
+/// The daemon sends a heartbeat every 5s on idle streams; a stream silent for
+/// this long is treated as dead.
+const STALE_AFTER: Duration = Duration::from_secs(15);
+const DEFAULT_RECONNECT_DELAY: Duration = Duration::from_secs(1);
+
+/// Connection lifecycle reported to [`WatchLoop::on_connection_state`].
+#[derive(Debug, Clone, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum ConnectionState {
+    Connecting,
+    Connected,
+    /// The stream failed or could not be opened; a reconnect follows after
+    /// the reconnect delay.
+    Disconnected {
+        reason: String,
+    },
+}
+
+/// One batch of changes from the daemon (`state_changed` result shape).
+#[derive(Debug, Clone, PartialEq)]
+#[non_exhaustive]
+pub struct WatchUpdate {
+    /// Daemon version after these changes; the resume cursor. With
+    /// [`WatchLoop::deltas`] the pane event cursor instead, with
+    /// [`WatchLoop::source_events`] the event sequence id.
+    pub version: u64,
+    /// Always empty with [`WatchLoop::summary_only`].
+    pub changes: Vec<Value>,
+    /// Pane counts (`summary_changed` `summary` shape); only set with
+    /// [`WatchLoop::summary_only`].
+    pub summary: Option<Value>,
+    /// `pane.added` / `pane.updated` / `pane.removed` events with
+    /// [`WatchLoop::deltas`]; ingested events (`seq`, `event_type`,
+    /// `source_kind`, `pane_id`, `payload`, ...) with
+    /// [`WatchLoop::source_events`].
+    pub events: Vec<Value>,
+    /// Full pane list to replace any local copy before applying `events`;
+    /// with [`WatchLoop::deltas`], on the first frame and whenever the
+    /// daemon could not resume from the cursor.
+    pub snapshot: Option<Value>,
+    /// First frame of a new connection. Changes may have been missed while
+    /// disconnected (or the daemon restarted), so callers should refresh any
+    /// derived view in full.
+    pub reconnected: bool,
+    /// With [`WatchLoop::source_events`]: events before these were lost
+    /// (the cursor fell out of the daemon's buffer, or the daemon
+    /// restarted).
+    pub gap: bool,
+}
+
+/// Which ingested events [`WatchLoop::source_events`] receives; unset
+/// criteria match everything.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct EventFilter {
+    pub pane_id: Option<String>,
+    /// `claude_hooks`, `codex_appserver`, `claude_jsonl`, `poller`.
+    pub source_kinds: Vec<String>,
+    /// Exact event types, or prefixes ending in `*` (`lifecycle.*`).
+    pub event_types: Vec<String>,
+    /// `claude`, `codex`, ...
+    pub provider: Option<String>,
+}
+
+type StateCallback = Box<dyn FnMut(&ConnectionState) + Send>;
+
+struct Stream {
+    lines: Lines<BufReader<OwnedReadHalf>>,
+    /// Held so the connection stays open; the daemon streams until EOF.
+    _writer: OwnedWriteHalf,
+    fresh: bool,
+}
+
+/// Streaming watch over the daemon's `watch` method.
+///
+/// ```no_run
+/// # async fn demo() -> Result<(), agtmux_client::Error> {
+/// use agtmux_client::{Client, WatchLoop};
+///
+/// let mut watch = WatchLoop::new(Client::new("/tmp/agtmux-me/agtmuxd.sock"))
+///     .on_connection_state(|state| eprintln!("watch: {state:?}"));
+/// loop {
+///     let update = watch.next().await?;
+///     println!("v{}: {} changes", update.version, update.changes.len());
+/// }
+/// # }
+/// ```
+pub struct WatchLoop {
+    client: Client,
+    cursor: u64,
+    reconnect_delay: Duration,
+    on_state: Option<StateCallback>,
+    stream: Option<Stream>,
+    retry_at: Option<Instant>,
+    summary_only: bool,
+    deltas: bool,
+    source_events: Option<EventFilter>,
+}
+
+impl WatchLoop {
+    pub fn new(client: Client) -> Self {
+        Self {
+            client,
+            cursor: 0,
+            reconnect_delay: DEFAULT_RECONNECT_DELAY,
+            on_state: None,
+            stream: None,
+            retry_at: None,
+            summary_only: false,
+            deltas: false,
+            source_events: None,
+        }
+    }
+
+    /// Start after `version` instead of replaying the daemon's change log.
+    pub fn since(mut self, version: u64) -> Self {
+        self.cursor = version;
+        self
+    }
+
+    /// Receive only pane counts (`summary`) whenever the version moves,
+    /// without the changes themselves; for status bars.
+    pub fn summary_only(mut self) -> Self {
+        self.summary_only = true;
+        self
+    }
+
+    /// Receive pane delta events (`events`, `snapshot`) computed by the
+    /// daemon from the `list_panes` view each poll tick, instead of
+    /// projection changes. A reconnect resumes from the last event cursor.
+    pub fn deltas(mut self) -> Self {
+        self.deltas = true;
+        self
+    }
+
+    /// Receive the events the daemon ingests from its sources (hooks, App
+    /// Server, JSONL, poller) that match `filter`, instead of state changes.
+    /// A fresh loop starts at the newest event ([`since`](Self::since)
+    /// resumes after a stored sequence id); a reconnect resumes from the
+    /// last one received, with [`WatchUpdate::gap`] set if events were lost.
+    pub fn source_events(mut self, filter: EventFilter) -> Self {
+        self.source_events = Some(filter);
+        self
+    }
+
+    /// Wait between reconnect attempts (default 1s).
+    pub fn reconnect_delay(mut self, delay: Duration) -> Self {
+        self.reconnect_delay = delay;
+        self
+    }
+
+    /// Called on every connection state transition.
+    pub fn on_connection_state(
+        mut self,
+        callback: impl FnMut(&ConnectionState) + Send + 'static,
+    ) -> Self {
+        self.on_state = Some(Box::new(callback));
+        self
+    }
+
+    /// Last version received; a new connection resumes from here.
+    pub fn cursor(&self) -> u64 {
+        self.cursor
+    }
+
+    /// Wait for the next update: a frame with changes, or the first frame of
+    /// each connection. Connection failures are retried forever; the only
+    /// errors returned are ones a retry cannot fix (e.g. the daemon predates
+    /// `watch`: [`RpcErrorKind::MethodNotFound`](crate::RpcErrorKind::MethodNotFound)).
+    ///
+    /// Cancel safe: dropping the future between frames loses nothing, so it
+    /// can be used in `tokio::select!`.
+    pub async fn next(&mut self) -> Result<WatchUpdate, Error> {
+        loop {
+            let Some(stream) = self.stream.as_mut() else {
+                self.connect().await;
+                continue;
+            };
+            let line = match tokio::time::timeout(STALE_AFTER, stream.lines.next_line()).await {
+                Ok(Ok(Some(line))) => line,
+                Ok(Ok(None)) => {
+                    self.disconnected("daemon closed the stream".to_string());
+                    continue;
+                }
+                Ok(Err(e)) => {
+                    self.disconnected(e.to_string());
+                    continue;
+                }
+                Err(_) => {
+                    self.disconnected(format!("no frame for {}s", STALE_AFTER.as_secs()));
+                    continue;
+                }
+            };
+            let reconnected = std::mem::replace(&mut stream.fresh, false);
+            let frame: Value = serde_json::from_str(&line)
+                .map_err(|e| Error::Protocol(format!("{e} (method watch)")))?;
+            if let Some(error) = frame.get("error") {
+                self.stream = None;
+                return Err(Error::Rpc {
+                    code: error["code"].as_i64().unwrap_or(0),
+                    message: error["message"]
+                        .as_str()
+                        .map_or_else(|| error.to_string(), String::from),
+                });
+            }
+            let update = parse_frame(&frame["params"], reconnected)?;
+            let advanced = update.version != self.cursor;
+            self.cursor = update.version;
+            let changed = if self.summary_only {
+                advanced
+            } else if self.source_events.is_some() {
+                !update.events.is_empty() || update.gap
+            } else if self.deltas {
+                !update.events.is_empty() || update.snapshot.is_some()
+            } else {
+                !update.changes.is_empty()
+            };
+            if reconnected || changed {
+                return Ok(update);
+            }
+        }
+    }
+
+    async fn connect(&mut self) {
+        if let Some(at) = self.retry_at {
+            tokio::time::sleep_until(at).await;
+        }
+        self.emit(ConnectionState::Connecting);
+        let stream = match UnixStream::connect(self.client.socket_path()).await {
+            Ok(stream) => stream,
+            Err(e) => {
+                self.disconnected(e.to_string());
+                return;
+            }
+        };
+        let (reader, mut writer) = stream.into_split();
+        let mut params = serde_json::json!({"since_version": self.cursor});
+        if let Some(filter) = &self.source_events {
+            params = serde_json::json!({
+                "source_events": true,
+                "pane_id": filter.pane_id,
+                "source_kind": filter.source_kinds,
+                "event_type": filter.event_types,
+                "provider": filter.provider,
+            });
+            if self.cursor > 0 {
+                params["since_seq"] = self.cursor.into();
+            }
+        } else if self.deltas {
+            params = serde_json::json!({"deltas": true});
+            if self.cursor > 0 {
+                params["since_cursor"] = self.cursor.into();
+            }
+        } else if self.summary_only {
+            params["summary_only"] = Value::Bool(true);
+        }
+        let request = self.client.prepare("watch", params);
+        let mut req = request.envelope().to_string();
+        req.push('\n');
+        if let Err(e) = writer.write_all(req.as_bytes()).await {
+            self.disconnected(e.to_string());
+            return;
+        }
+        self.retry_at = None;
+        self.stream = Some(Stream {
+            lines: BufReader::new(reader).lines(),
+            _writer: writer,
+            fresh: true,
+        });
+        self.emit(ConnectionState::Connected);
+    }
+
+    fn disconnected(&mut self, reason: String) {
+        self.stream = None;
+        self.retry_at = Some(Instant::now() + self.reconnect_delay);
+        self.emit(ConnectionState::Disconnected { reason });
+    }
+
+    fn emit(&mut self, state: ConnectionState) {
+        if let Some(callback) = self.on_state.as_mut() {
+            callback(&state);
+        }
+    }
+}
+
+fn parse_frame(params: &Value, reconnected: bool) -> Result<WatchUpdate, Error> {
+    let version = params["version"]
+        .as_u64()
+        .or_else(|| params["cursor"].as_u64())
+        .ok_or_else(|| Error::Protocol("watch frame without version".to_string()))?;
+    Ok(WatchUpdate {
+        version,
+        changes: params["changes"].as_array().cloned().unwrap_or_default(),
+        summary: params.get("summary").cloned(),
+        events: params["events"].as_array().cloned().unwrap_or_default(),
+        snapshot: params.get("snapshot").cloned(),
+        reconnected,
+        gap: params["gap"].as_bool().unwrap_or(false),
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::{Arc, Mutex};
+    use tokio::net::UnixListener;
+
+    fn frame(version: u64, changes: usize) -> String {
+        let changes: Vec<Value> = (0..changes)
+            .map(|i| serde_json::json!({"version": version, "pane_id": format!("%{i}")}))
+            .collect();
+        format!(
+            "{}\n",
+            serde_json::json!({"jsonrpc": "2.0", "method": "watch",
+                "params": {"version": version, "changes": changes}})
+        )
+    }
+
+    #[tokio::test]
+    async fn resumes_from_cursor_after_reconnect() {
+        let dir = std::env::temp_dir().join(format!("agtmux-watch-test-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("temp dir");
+        let path = dir.join("d.sock");
+        let _ = std::fs::remove_file(&path);
+        let listener = UnixListener::bind(&path).expect("bind");
+
+        let server = tokio::spawn(async move {
+            let mut requests = Vec::new();
+            // First connection: initial frame, heartbeat, a change, then drop.
+            // Second connection: initial frame after resume.
+            for frames in [
+                vec![frame(3, 1), frame(3, 0), frame(5, 2)],
+                vec![frame(5, 0)],
+            ] {
+                let (stream, _) = listener.accept().await.expect("accept");
+                let (reader, mut writer) = stream.into_split();
+                let mut lines = BufReader::new(reader).lines();
+                let request = lines.next_line().await.expect("read").expect("request");
+                requests.push(serde_json::from_str::<Value>(&request).expect("json"));
+                for f in frames {
+                    writer.write_all(f.as_bytes()).await.expect("write");
+                }
+            }
+            requests
+        });
+
+        let states = Arc::new(Mutex::new(Vec::new()));
+        let seen = Arc::clone(&states);
+        let mut watch = WatchLoop::new(Client::new(path.to_string_lossy()))
+            .reconnect_delay(Duration::from_millis(10))
+            .on_connection_state(move |s| seen.lock().expect("lock").push(s.clone()));
+
+        let first = watch.next().await.expect("initial");
+        assert!(first.reconnected);
+        assert_eq!((first.version, first.changes.len()), (3, 1));
+
+        // Heartbeat is swallowed; the next update carries changes.
+        let second = watch.next().await.expect("change");
+        assert!(!second.reconnected);
+        assert_eq!((second.version, second.changes.len()), (5, 2));
+
+        let third = watch.next().await.expect("after reconnect");
+        assert!(third.reconnected);
+        assert_eq!(watch.cursor(), 5);
+
+        let requests = server.await.expect("server");
+        assert_eq!(requests[0]["params"]["since_version"], 0);
+        assert_eq!(requests[1]["params"]["since_version"], 5, "resumed");
+
+        let states = states.lock().expect("lock");
+        assert_eq!(states[0], ConnectionState::Connecting);
+        assert_eq!(states[1], ConnectionState::Connected);
+        assert!(matches!(states[2], ConnectionState::Disconnected { .. }));
+        assert_eq!(states[3], ConnectionState::Connecting);
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[tokio::test]
+    async fn summary_only_yields_on_version_change() {
+        use crate::testing::{FakeDaemon, Reply};
+
+        let daemon = FakeDaemon::start().await.expect("start");
+        for version in [1, 1, 2] {
+            daemon.on_once(
+                "watch",
+                Reply::result(
+                    serde_json::json!({"version": version, "summary": {"managed": version}}),
+                ),
+            );
+        }
+        let mut watch = WatchLoop::new(daemon.client()).summary_only();
+        let first = watch.next().await.expect("initial");
+        assert_eq!(first.summary.expect("summary")["managed"], 1);
+        // The repeated version (heartbeat) is swallowed.
+        let second = watch.next().await.expect("change");
+        assert_eq!((second.version, second.changes.len()), (2, 0));
+        assert_eq!(daemon.calls_to("watch")[0].params["summary_only"], true);
+    }
+
+    #[tokio::test]
+    async fn deltas_yield_snapshot_then_events() {
+        use crate::testing::{FakeDaemon, Reply};
+
+        let daemon = FakeDaemon::start().await.expect("start");
+        for frame in [
+            serde_json::json!({"cursor": 4, "events": [], "snapshot": [{"pane_id": "%1"}]}),
+            serde_json::json!({"cursor": 4, "events": []}),
+            serde_json::json!({"cursor": 5, "events": [
+                {"cursor": 5, "type": "pane.removed", "pane_id": "%1"}]}),
+        ] {
+            daemon.on_once("watch", Reply::result(frame));
+        }
+        let mut watch = WatchLoop::new(daemon.client()).deltas();
+        let first = watch.next().await.expect("snapshot");
+        assert_eq!(first.version, 4);
+        assert_eq!(first.snapshot.expect("snapshot")[0]["pane_id"], "%1");
+        // The heartbeat is swallowed.
+        let second = watch.next().await.expect("events");
+        assert_eq!(second.version, 5);
+        assert_eq!(second.events[0]["type"], "pane.removed");
+        assert!(second.snapshot.is_none());
+        let params = &daemon.calls_to("watch")[0].params;
+        assert_eq!(params["deltas"], true);
+        assert!(
+            params.get("since_cursor").is_none(),
+            "fresh loop asks for a snapshot"
+        );
+    }
+
+    #[tokio::test]
+    async fn source_events_resume_from_sequence() {
+        use crate::testing::{FakeDaemon, Reply};
+
+        let daemon = FakeDaemon::start().await.expect("start");
+        for frame in [
+            serde_json::json!({"cursor": 10, "events": []}),
+            serde_json::json!({"cursor": 12, "events": [
+                {"seq": 12, "event_type": "task_completed", "pane_id": "%3"}]}),
+            serde_json::json!({"cursor": 40, "events": [], "gap": true}),
+        ] {
+            daemon.on_once("watch", Reply::result(frame));
+        }
+        let filter = EventFilter {
+            event_types: vec!["task_completed".to_string()],
+            ..Default::default()
+        };
+        let mut watch = WatchLoop::new(daemon.client())
+            .since(9)
+            .source_events(filter);
+        let first = watch.next().await.expect("initial");
+        assert_eq!((first.version, first.events.len()), (10, 0));
+        let second = watch.next().await.expect("event");
+        assert_eq!(second.events[0]["event_type"], "task_completed");
+        let third = watch.next().await.expect("gap");
+        assert!(third.gap && third.events.is_empty());
+        assert_eq!(watch.cursor(), 40);
+
+        let params = &daemon.calls_to("watch")[0].params;
+        assert_eq!(params["source_events"], true);
+        assert_eq!(params["since_seq"], 9);
+        assert_eq!(params["event_type"], serde_json::json!(["task_completed"]));
+    }
+
+    #[tokio::test]
+    async fn method_not_found_is_returned() {
+        let dir = std::env::temp_dir().join(format!("agtmux-watch-old-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("temp dir");
+        let path = dir.join("d.sock");
+        let _ = std::fs::remove_file(&path);
+        let listener = UnixListener::bind(&path).expect("bind");
+        tokio::spawn(async move {
+            let (mut stream, _) = listener.accept().await.expect("accept");
+            let reply = serde_json::json!({"jsonrpc": "2.0", "id": 1,
+                "error": {"code": -32601, "message": "method not found: watch"}});
+            stream
+                .write_all(format!("{reply}\n").as_bytes())
+                .await
+                .expect("write");
+        });
+
+        let err = WatchLoop::new(Client::new(path.to_string_lossy()))
+            .next()
+            .await
+            .expect_err("old daemon");
+        assert_eq!(err.code(), "ERR_METHOD_NOT_FOUND");
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
@@ -13,10 +13,21 @@ pub enum Provider {
     Codex,
     Gemini,
     Copilot,
+    Aider,
+    /// A user-defined adapter (`[[adapters]]`); the name travels in the
+    /// event payload.
+    Custom,
 }
 
 impl Provider {
-    pub const ALL: [Self; 4] = [Self::Claude, Self::Codex, Self::Gemini, Self::Copilot];
+    pub const ALL: [Self; 6] = [
+        Self::Claude,
+        Self::Codex,
+        Self::Gemini,
+        Self::Copilot,
+        Self::Aider,
+        Self::Custom,
+    ];
 
     pub fn as_str(self) -> &'static str {
         match self {
@@ -24,6 +35,8 @@ impl Provider {
             Self::Codex => "codex",
             Self::Gemini => "gemini",
             Self::Copilot => "copilot",
+            Self::Aider => "aider",
+            Self::Custom => "custom",
         }
     }
 }
@@ -43,6 +56,8 @@ impl FromStr for Provider {
             "codex" => Ok(Self::Codex),
             "gemini" => Ok(Self::Gemini),
             "copilot" => Ok(Self::Copilot),
+            "aider" => Ok(Self::Aider),
+            "custom" => Ok(Self::Custom),
             _ => Err(AgtmuxError::InvalidSourceEvent(format!(
                 "unknown provider: {s}"
             ))),
@@ -0,0 +1,386 @@
+//! Authorization scopes for UDS clients (`[access]`): every method needs one
+//! of three ordered scopes, and each admitted caller gets one from its
+//! bearer token (`meta.token`, `AGTMUX_TOKEN` in the CLI) or its peer uid.
+//!
+//! ```toml
+//! [access]
+//! default_scope = "admin"        # admitted uids without a rule (default admin)
+//! uids = { "1001" = "read" }
+//!
+//! [[access.tokens]]              # written by `agtmux token create`
+//! name = "dashboard"
+//! scope = "read"
+//! sha256 = "9f86d081..."
+//! ```
+//!
+//! - `read`: lists, `watch`, status and diagnostics
+//! - `act`: pane actions and input (scheduled or not), labels, tasks,
+//!   groups, macros, alert acks, source ingest and transcripts written to
+//!   an `archive_dir`
+//! - `admin`: everything, including the responder kill switch and the
+//!   action audit trail (`actions.history`)
+//!
+//! `allowed_uids` still decides who may connect at all. A token overrides
+//! the uid's scope; an unknown token is refused rather than falling back.
+//! Only the SHA-256 of a token is stored, so the config does not hold
+//! secrets. Rules reload on SIGHUP.
+
+use std::collections::BTreeMap;
+use std::io::Read;
+use std::path::Path;
+
+use serde_json::Value;
+use sha2::{Digest, Sha256};
+
+/// What a caller may do; each scope includes the ones before it.
+#[derive(
+    Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, serde::Deserialize, clap::ValueEnum,
+)]
+#[serde(rename_all = "lowercase")]
+pub enum Scope {
+    Read,
+    Act,
+    Admin,
+}
+
+impl Scope {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Read => "read",
+            Self::Act => "act",
+            Self::Admin => "admin",
+        }
+    }
+}
+
+impl std::fmt::Display for Scope {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// Methods that only read daemon state.
+const READ_METHODS: &[&str] = &[
+    "list_panes",
+    "list_sessions",
+    "list_source_health",
+    "state_changed",
+    "summary_changed",
+    "watch",
+    "latency_status",
+    "list_source_registry",
+    "label.list",
+    "task.list",
+    "alerts.list",
+    "pane.transcript",
+    "pane.output",
+    "pane.search",
+    "recording.list",
+    "recording.replay",
+    "macro.list",
+    "responder.status",
+    "restart.events",
+    "schedule.list",
+    "group.list",
+    "daemon.info",
+    "daemon.capabilities",
+    "debug.metrics",
+];
+
+/// Methods that change panes, metadata or ingested state.
+const ACT_METHODS: &[&str] = &[
+    "source.hello",
+    "source.heartbeat",
+    "source.ingest",
+    "label.set",
+    "label.clear",
+    "task.set",
+    "task.clear",
+    "alerts.ack",
+    "pane.new_window",
+    "pane.split",
+    "pane.kill",
+    "window.kill",
+    "pane.respawn",
+    "pane.restart",
+    "pane.run",
+    "pane.send",
+    "macro.run",
+    "schedule.cancel",
+    "group.add",
+    "group.remove",
+    "group.send",
+    "group.kill",
+];
+
+/// Scope needed to call `method` with `params`; anything not listed needs
+/// `admin`. A `pane.transcript` with `archive_dir` writes files, so it
+/// needs `act`.
+pub fn required_scope(method: &str, params: &Value) -> Scope {
+    if method == "pane.transcript" && !params["archive_dir"].is_null() {
+        Scope::Act
+    } else if READ_METHODS.contains(&method) {
+        Scope::Read
+    } else if ACT_METHODS.contains(&method) {
+        Scope::Act
+    } else {
+        Scope::Admin
+    }
+}
+
+/// One `[[access.tokens]]` entry.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct TokenEntry {
+    pub name: String,
+    pub scope: Scope,
+    /// Hex SHA-256 of the token.
+    pub sha256: String,
+}
+
+/// `[access]` section.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct AccessSettings {
+    /// Scope of admitted uids without a `uids` rule; unset = `admin`.
+    pub default_scope: Option<Scope>,
+    /// Peer uid (as a string key) → scope.
+    pub uids: BTreeMap<String, Scope>,
+    pub tokens: Vec<TokenEntry>,
+}
+
+impl AccessSettings {
+    pub fn validate(&self) -> anyhow::Result<()> {
+        for uid in self.uids.keys() {
+            if uid.parse::<u32>().is_err() {
+                anyhow::bail!("access.uids key {uid:?} is not a uid");
+            }
+        }
+        for (i, token) in self.tokens.iter().enumerate() {
+            if token.name.is_empty() {
+                anyhow::bail!("access.tokens[{i}] needs a name");
+            }
+            if self.tokens[..i].iter().any(|t| t.name == token.name) {
+                anyhow::bail!("duplicate access token name {:?}", token.name);
+            }
+            if token.sha256.len() != 64 || !token.sha256.bytes().all(|b| b.is_ascii_hexdigit()) {
+                anyhow::bail!(
+                    "access token {:?}: sha256 must be 64 hex digits",
+                    token.name
+                );
+            }
+        }
+        Ok(())
+    }
+}
+
+/// Compiled `[access]` rules held by the daemon.
+#[derive(Debug, Clone)]
+pub struct AccessPolicy {
+    default_scope: Scope,
+    uids: BTreeMap<u32, Scope>,
+    /// sha256 hex (lowercase) → (name, scope).
+    tokens: BTreeMap<String, (String, Scope)>,
+}
+
+impl Default for AccessPolicy {
+    fn default() -> Self {
+        Self::new(&AccessSettings::default())
+    }
+}
+
+impl AccessPolicy {
+    /// From validated settings; malformed uid keys are skipped.
+    pub fn new(settings: &AccessSettings) -> Self {
+        Self {
+            default_scope: settings.default_scope.unwrap_or(Scope::Admin),
+            uids: settings
+                .uids
+                .iter()
+                .filter_map(|(uid, scope)| Some((uid.parse().ok()?, *scope)))
+                .collect(),
+            tokens: settings
+                .tokens
+                .iter()
+                .map(|t| (t.sha256.to_lowercase(), (t.name.clone(), t.scope)))
+                .collect(),
+        }
+    }
+
+    /// Scope of a caller and the name of its token, or why the token was
+    /// refused.
+    pub fn scope_for(
+        &self,
+        uid: u32,
+        token: Option<&str>,
+    ) -> Result<(Scope, Option<String>), String> {
+        match token {
+            Some(token) => self
+                .tokens
+                .get(&token_digest(token))
+                .map(|(name, scope)| (*scope, Some(name.clone())))
+                .ok_or_else(|| "unknown access token".to_string()),
+            None => Ok((
+                self.uids.get(&uid).copied().unwrap_or(self.default_scope),
+                None,
+            )),
+        }
+    }
+}
+
+/// Hex SHA-256 of a token, as stored in `[[access.tokens]]`.
+pub fn token_digest(token: &str) -> String {
+    Sha256::digest(token.trim().as_bytes())
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect()
+}
+
+/// A fresh 256-bit token, hex encoded.
+pub fn generate_token() -> anyhow::Result<String> {
+    let mut bytes = [0u8; 32];
+    std::fs::File::open("/dev/urandom")
+        .and_then(|mut f| f.read_exact(&mut bytes))
+        .map_err(|e| anyhow::anyhow!("cannot read /dev/urandom: {e}"))?;
+    Ok(bytes.iter().map(|b| format!("{b:02x}")).collect())
+}
+
+/// Append an `[[access.tokens]]` entry to the config at `path` (created
+/// with mode 0600 if missing) and check the result still parses.
+pub fn append_token(path: &Path, entry: &TokenEntry) -> anyhow::Result<()> {
+    let existing = match std::fs::read_to_string(path) {
+        Ok(text) => text,
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => String::new(),
+        Err(e) => anyhow::bail!("cannot read config {}: {e}", path.display()),
+    };
+    let settings = crate::daemon_config::parse_file(&existing)
+        .map_err(|e| anyhow::anyhow!("{}: {e}", path.display()))?
+        .access;
+    if settings.tokens.iter().any(|t| t.name == entry.name) {
+        anyhow::bail!(
+            "{}: access token {:?} already exists",
+            path.display(),
+            entry.name
+        );
+    }
+    let string = |v: &str| toml::Value::String(v.to_string()).to_string();
+    let mut text = existing;
+    if !text.is_empty() && !text.ends_with('\n') {
+        text.push('\n');
+    }
+    text += &format!(
+        "\n[[access.tokens]]\nname = {}\nscope = {}\nsha256 = {}\n",
+        string(&entry.name),
+        string(entry.scope.as_str()),
+        string(&entry.sha256)
+    );
+    crate::daemon_config::parse_file(&text)
+        .map_err(|e| anyhow::anyhow!("{}: cannot add the token entry: {e}", path.display()))?;
+    if let Some(dir) = path.parent() {
+        std::fs::create_dir_all(dir)?;
+    }
+    let mut options = std::fs::OpenOptions::new();
+    options.write(true).create(true).truncate(true);
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::OpenOptionsExt;
+        options.mode(0o600);
+    }
+    std::io::Write::write_all(&mut options.open(path)?, text.as_bytes())
+        .map_err(|e| anyhow::anyhow!("cannot write config {}: {e}", path.display()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn every_method_has_a_scope() {
+        for method in agtmux_client::METHODS {
+            assert!(
+                READ_METHODS.contains(method)
+                    || ACT_METHODS.contains(method)
+                    || ["responder.set_enabled", "actions.history"].contains(method),
+                "{method} is not classified"
+            );
+        }
+        let none = Value::Null;
+        assert_eq!(required_scope("list_panes", &none), Scope::Read);
+        assert_eq!(required_scope("pane.kill", &none), Scope::Act);
+        assert_eq!(required_scope("pane.send", &none), Scope::Act);
+        assert_eq!(required_scope("pane.transcript", &none), Scope::Read);
+        let archive = serde_json::json!({"pane_id": "%1", "archive_dir": "/tmp/t"});
+        assert_eq!(required_scope("pane.transcript", &archive), Scope::Act);
+        assert_eq!(required_scope("responder.set_enabled", &none), Scope::Admin);
+        assert_eq!(required_scope("no.such_method", &none), Scope::Admin);
+        assert!(Scope::Read < Scope::Act && Scope::Act < Scope::Admin);
+    }
+
+    #[test]
+    fn scopes_come_from_tokens_then_uids() {
+        let token = generate_token().expect("token");
+        assert_eq!(token.len(), 64);
+        let settings = AccessSettings {
+            default_scope: Some(Scope::Act),
+            uids: BTreeMap::from([("1001".to_string(), Scope::Read)]),
+            tokens: vec![TokenEntry {
+                name: "ci".to_string(),
+                scope: Scope::Admin,
+                sha256: token_digest(&token).to_uppercase(),
+            }],
+        };
+        settings.validate().expect("valid");
+        let policy = AccessPolicy::new(&settings);
+        assert_eq!(policy.scope_for(1001, None), Ok((Scope::Read, None)));
+        assert_eq!(policy.scope_for(1000, None), Ok((Scope::Act, None)));
+        assert_eq!(
+            policy.scope_for(1001, Some(&token)),
+            Ok((Scope::Admin, Some("ci".to_string())))
+        );
+        assert!(policy.scope_for(1000, Some("guess")).is_err());
+        assert_eq!(
+            AccessPolicy::default().scope_for(7, None),
+            Ok((Scope::Admin, None))
+        );
+
+        let bad = AccessSettings {
+            uids: BTreeMap::from([("alice".to_string(), Scope::Read)]),
+            ..Default::default()
+        };
+        assert!(bad.validate().is_err());
+        let bad = AccessSettings {
+            tokens: vec![TokenEntry {
+                name: "x".to_string(),
+                scope: Scope::Read,
+                sha256: "abc".to_string(),
+            }],
+            ..Default::default()
+        };
+        assert!(bad.validate().is_err());
+    }
+
+    #[test]
+    fn appends_token_entries_to_the_config() {
+        let dir = std::env::temp_dir().join(format!("agtmux-access-{}", std::process::id()));
+        let path = dir.join("agtmuxd.toml");
+        let _ = std::fs::remove_dir_all(&dir);
+        std::fs::create_dir_all(&dir).expect("dir");
+        std::fs::write(&path, "[access]\ndefault_scope = \"read\"").expect("write");
+        let entry = |name: &str| TokenEntry {
+            name: name.to_string(),
+            scope: Scope::Act,
+            sha256: token_digest(name),
+        };
+        append_token(&path, &entry("ci")).expect("append");
+        append_token(&path, &entry("bot")).expect("append");
+        assert!(append_token(&path, &entry("ci")).is_err(), "duplicate name");
+
+        let text = std::fs::read_to_string(&path).expect("read");
+        let access = crate::daemon_config::parse_file(&text)
+            .expect("parses")
+            .access;
+        assert_eq!(access.default_scope, Some(Scope::Read));
+        assert_eq!(access.tokens, vec![entry("ci"), entry("bot")]);
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
@@ -0,0 +1,1286 @@
+//! Pane lifecycle actions: `pane.new_window`, `pane.split`, `pane.kill`,
+//! `window.kill` and `pane.respawn` run tmux through the daemon's executor,
+//! so clients can shape the topology they observe. `pane.run` launches an
+//! agent with an initial prompt in a new window or an idle shell pane.
+//! `pane.restart` kills a pane's agent and relaunches it (the detected
+//! provider's command unless one is given), optionally only while the agent
+//! is in one of `if_state` (e.g. `["error"]`). `pane.send` types the same
+//! text or key into a list of panes, or every agent pane matching a filter.
+//!
+//! Every action may carry a `request_ref`. The first result for a ref is
+//! remembered (last [`REQUEST_REF_CAPACITY`] refs), and a replay returns it
+//! with `"replayed": true` instead of running tmux again, so retries are
+//! safe; a repeat that arrives while the first call still runs waits for its
+//! result. Guards are checked against the last polled topology before anything
+//! runs: the target pane / session must exist, and killing a pane whose
+//! agent is busy (running or waiting) needs `force`.
+
+use std::sync::Arc;
+
+use agtmux_client::codes;
+use agtmux_core_v5::types::{ActivityState, PanePresence, PaneRuntimeState, Provider};
+use agtmux_tmux_v5::{TmuxCommandRunner, TmuxPaneInfo};
+use serde_json::Value;
+use tokio::sync::{Mutex, MutexGuard, watch};
+
+use crate::exec_pool::ExecPool;
+use crate::poll_loop::DaemonState;
+use crate::send_policy::SendPolicy;
+
+/// `request_ref`s remembered for replay.
+pub const REQUEST_REF_CAPACITY: usize = 256;
+
+/// Methods served by [`execute`].
+pub const METHODS: &[&str] = &[
+    "pane.new_window",
+    "pane.split",
+    "pane.kill",
+    "window.kill",
+    "pane.respawn",
+    "pane.restart",
+    "pane.run",
+    "pane.send",
+];
+
+/// Commands treated as an idle shell that `pane.run` may type into.
+const SHELLS: &[&str] = &["bash", "zsh", "fish", "sh", "dash", "ksh", "tcsh", "nu"];
+
+/// tmux format printed by actions that create or reuse a pane: pane id and
+/// `session:window.pane`.
+const PANE_FORMAT: &str = "#{pane_id} #{session_name}:#{window_index}.#{pane_index}";
+
+/// A parsed action request.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum PaneAction {
+    NewWindow {
+        session: String,
+        name: Option<String>,
+        cwd: Option<String>,
+        command: Option<String>,
+    },
+    Split {
+        pane_id: String,
+        /// Side by side (`-h`) instead of stacked (`-v`).
+        horizontal: bool,
+        cwd: Option<String>,
+        command: Option<String>,
+    },
+    KillPane {
+        pane_id: String,
+        force: bool,
+    },
+    /// Kill the window containing `pane_id`.
+    KillWindow {
+        pane_id: String,
+        force: bool,
+    },
+    Respawn {
+        pane_id: String,
+        command: Option<String>,
+        /// Kill a still-running process first (`respawn-pane -k`).
+        kill: bool,
+    },
+    /// Kill the pane's agent and relaunch it (`respawn-pane -k`).
+    Restart {
+        pane_id: String,
+        /// Relaunch command; derived from the pane's agent by `resolve`.
+        command: Option<String>,
+        /// Directory to relaunch in; the pane's current path.
+        cwd: Option<String>,
+        /// Only restart while the agent is in one of these states.
+        if_state: Vec<ActivityState>,
+    },
+    /// Launch `agent` as `command` (prompt already quoted in).
+    Run {
+        agent: String,
+        command: String,
+        target: RunTarget,
+    },
+}
+
+/// Where `pane.run` starts the agent.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum RunTarget {
+    /// New window in `session`; the window closes when the agent exits.
+    NewWindow {
+        session: String,
+        cwd: Option<String>,
+    },
+    /// Type the command into this shell pane.
+    Pane(String),
+    /// An idle shell pane in `session`, else a new window there.
+    ReuseIdle {
+        session: String,
+        cwd: Option<String>,
+    },
+}
+
+/// A launched agent not yet necessarily detected by the poller.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Serialize)]
+pub struct Launch {
+    pub agent: String,
+    pub launched_at: chrono::DateTime<chrono::Utc>,
+}
+
+/// Single-quote `s` for `sh`.
+fn shell_quote(s: &str) -> String {
+    format!("'{}'", s.replace('\'', "'\\''"))
+}
+
+/// Why an action did not run.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum ActionError {
+    InvalidParams(String),
+    PaneNotFound(String),
+    Refused(String),
+    Failed(String),
+    /// Input or target refused by `[send_policy]`.
+    PolicyViolation(String),
+}
+
+impl std::fmt::Display for ActionError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::InvalidParams(message)
+            | Self::Refused(message)
+            | Self::PolicyViolation(message) => f.write_str(message),
+            Self::PaneNotFound(pane_id) => write!(f, "unknown pane: {pane_id:?}"),
+            Self::Failed(message) => f.write_str(message),
+        }
+    }
+}
+
+impl ActionError {
+    pub fn code(&self) -> i64 {
+        match self {
+            Self::InvalidParams(_) => codes::INVALID_PARAMS,
+            Self::PaneNotFound(_) => codes::PANE_NOT_FOUND,
+            Self::Refused(_) => codes::ACTION_REFUSED,
+            Self::Failed(_) => codes::ACTION_FAILED,
+            Self::PolicyViolation(_) => codes::POLICY_VIOLATION,
+        }
+    }
+}
+
+fn opt_string(params: &Value, key: &str) -> Option<String> {
+    params[key]
+        .as_str()
+        .filter(|s| !s.is_empty())
+        .map(String::from)
+}
+
+/// A state name or a list of them, `snake_case` or as in `list_panes`
+/// (`error`, `waiting_input`, `WaitingApproval`).
+fn states_param(params: &Value, key: &str) -> Result<Vec<ActivityState>, ActionError> {
+    let names: Vec<&Value> = match &params[key] {
+        Value::Null => Vec::new(),
+        Value::Array(items) => items.iter().collect(),
+        other => vec![other],
+    };
+    names
+        .into_iter()
+        .map(|name| {
+            let name = name.as_str().unwrap_or("");
+            let normalized = name.replace('_', "");
+            ActivityState::PRECEDENCE_DESC
+                .into_iter()
+                .find(|s| format!("{s:?}").eq_ignore_ascii_case(&normalized))
+                .ok_or_else(|| {
+                    ActionError::InvalidParams(format!("unknown state in {key}: {name:?}"))
+                })
+        })
+        .collect()
+}
+
+fn required(params: &Value, key: &str) -> Result<String, ActionError> {
+    opt_string(params, key).ok_or_else(|| ActionError::InvalidParams(format!("{key} is required")))
+}
+
+impl PaneAction {
+    pub fn parse(method: &str, params: &Value) -> Result<Self, ActionError> {
+        let flag = |key: &str| params[key].as_bool().unwrap_or(false);
+        Ok(match method {
+            "pane.new_window" => Self::NewWindow {
+                session: required(params, "session")?,
+                name: opt_string(params, "name"),
+                cwd: opt_string(params, "cwd"),
+                command: opt_string(params, "command"),
+            },
+            "pane.split" => Self::Split {
+                pane_id: required(params, "pane_id")?,
+                horizontal: match params["direction"].as_str() {
+                    None | Some("vertical") => false,
+                    Some("horizontal") => true,
+                    Some(other) => {
+                        return Err(ActionError::InvalidParams(format!(
+                            "direction must be \"horizontal\" or \"vertical\", got {other:?}"
+                        )));
+                    }
+                },
+                cwd: opt_string(params, "cwd"),
+                command: opt_string(params, "command"),
+            },
+            "pane.kill" => Self::KillPane {
+                pane_id: required(params, "pane_id")?,
+                force: flag("force"),
+            },
+            "window.kill" => Self::KillWindow {
+                pane_id: required(params, "pane_id")?,
+                force: flag("force"),
+            },
+            "pane.respawn" => Self::Respawn {
+                pane_id: required(params, "pane_id")?,
+                command: opt_string(params, "command"),
+                kill: flag("kill"),
+            },
+            "pane.restart" => Self::Restart {
+                pane_id: required(params, "pane_id")?,
+                command: opt_string(params, "command"),
+                cwd: None,
+                if_state: states_param(params, "if_state")?,
+            },
+            "pane.run" => {
+                let prompt = params["prompt"].as_str().unwrap_or("");
+                let custom = opt_string(params, "command");
+                let agent = opt_string(params, "agent")
+                    .or_else(|| custom.as_ref().map(|_| "custom".to_string()))
+                    .ok_or_else(|| ActionError::InvalidParams("agent is required".to_string()))?;
+                let program = match (custom, agent.as_str()) {
+                    (Some(command), _) => command,
+                    (None, "claude" | "codex") => agent.clone(),
+                    (None, other) => {
+                        return Err(ActionError::InvalidParams(format!(
+                            "agent {other:?} needs command (built in: claude, codex)"
+                        )));
+                    }
+                };
+                let command = if prompt.is_empty() {
+                    program
+                } else {
+                    format!("{program} {}", shell_quote(prompt))
+                };
+                let target = match opt_string(params, "pane_id") {
+                    Some(pane_id) => RunTarget::Pane(pane_id),
+                    None => {
+                        let session = required(params, "session")?;
+                        let cwd = opt_string(params, "cwd");
+                        if flag("reuse_idle") {
+                            RunTarget::ReuseIdle { session, cwd }
+                        } else {
+                            RunTarget::NewWindow { session, cwd }
+                        }
+                    }
+                };
+                Self::Run {
+                    agent,
+                    command,
+                    target,
+                }
+            }
+            other => {
+                return Err(ActionError::InvalidParams(format!(
+                    "not an action: {other}"
+                )));
+            }
+        })
+    }
+
+    /// Pick the pane for `RunTarget::ReuseIdle`: an unmanaged shell pane in
+    /// the session without a pending launch, else a new window. Fill in the
+    /// relaunch command and directory of `pane.restart`.
+    fn resolve(
+        self,
+        tmux: &[TmuxPaneInfo],
+        states: &[&PaneRuntimeState],
+        launches: &std::collections::HashMap<String, Launch>,
+    ) -> Self {
+        match self {
+            Self::Run {
+                agent,
+                command,
+                target: RunTarget::ReuseIdle { session, cwd },
+            } => {
+                let idle = tmux.iter().find(|p| {
+                    (p.session_name == session || p.session_id == session)
+                        && is_shell(&p.current_cmd)
+                        && !launches.contains_key(&p.pane_id)
+                        && !is_managed(&p.pane_id, states)
+                });
+                let target = match idle {
+                    Some(pane) => RunTarget::Pane(pane.pane_id.clone()),
+                    None => RunTarget::NewWindow { session, cwd },
+                };
+                Self::Run {
+                    agent,
+                    command,
+                    target,
+                }
+            }
+            Self::Restart {
+                pane_id,
+                command,
+                if_state,
+                ..
+            } => {
+                // The detected provider's CLI, else the agent `pane.run`
+                // launched there (custom launches need an explicit command).
+                let command = command.or_else(|| {
+                    states
+                        .iter()
+                        .find(|s| s.pane_instance_id.pane_id == pane_id)
+                        .and_then(|s| s.provider)
+                        .filter(|p| *p != Provider::Custom)
+                        .map(|p| p.as_str().to_string())
+                        .or_else(|| {
+                            launches
+                                .get(&pane_id)
+                                .map(|l| l.agent.clone())
+                                .filter(|agent| agent != "custom")
+                        })
+                });
+                let cwd = tmux
+                    .iter()
+                    .find(|p| p.pane_id == pane_id)
+                    .map(|p| p.current_path.clone())
+                    .filter(|path| !path.is_empty());
+                Self::Restart {
+                    pane_id,
+                    command,
+                    cwd,
+                    if_state,
+                }
+            }
+            other => other,
+        }
+    }
+
+    fn method(&self) -> &'static str {
+        match self {
+            Self::NewWindow { .. } => "pane.new_window",
+            Self::Split { .. } => "pane.split",
+            Self::KillPane { .. } => "pane.kill",
+            Self::KillWindow { .. } => "window.kill",
+            Self::Respawn { .. } => "pane.respawn",
+            Self::Restart { .. } => "pane.restart",
+            Self::Run { .. } => "pane.run",
+        }
+    }
+
+    /// tmux arguments. Actions that create a pane print its id.
+    pub fn tmux_args(&self) -> Vec<String> {
+        let mut args: Vec<String> = Vec::new();
+        let mut push = |items: &[&str]| args.extend(items.iter().map(|s| s.to_string()));
+        match self {
+            Self::NewWindow {
+                session,
+                name,
+                cwd,
+                command,
+            } => {
+                push(&["new-window", "-d", "-P", "-F", PANE_FORMAT]);
+                push(&["-t", &format!("{session}:")]);
+                if let Some(name) = name {
+                    push(&["-n", name]);
+                }
+                if let Some(cwd) = cwd {
+                    push(&["-c", cwd]);
+                }
+                if let Some(command) = command {
+                    push(&[command]);
+                }
+            }
+            Self::Split {
+                pane_id,
+                horizontal,
+                cwd,
+                command,
+            } => {
+                push(&["split-window", "-d", "-P", "-F", PANE_FORMAT]);
+                push(&[if *horizontal { "-h" } else { "-v" }, "-t", pane_id]);
+                if let Some(cwd) = cwd {
+                    push(&["-c", cwd]);
+                }
+                if let Some(command) = command {
+                    push(&[command]);
+                }
+            }
+            Self::KillPane { pane_id, .. } => push(&["kill-pane", "-t", pane_id]),
+            Self::KillWindow { pane_id, .. } => push(&["kill-window", "-t", pane_id]),
+            Self::Respawn {
+                pane_id,
+                command,
+                kill,
+            } => {
+                push(&["respawn-pane"]);
+                if *kill {
+                    push(&["-k"]);
+                }
+                push(&["-t", pane_id]);
+                if let Some(command) = command {
+                    push(&[command]);
+                }
+            }
+            Self::Restart {
+                pane_id,
+                command,
+                cwd,
+                ..
+            } => {
+                push(&["respawn-pane", "-k", "-t", pane_id]);
+                if let Some(cwd) = cwd {
+                    push(&["-c", cwd]);
+                }
+                if let Some(command) = command {
+                    push(&[command]);
+                }
+            }
+            Self::Run {
+                command, target, ..
+            } => match target {
+                RunTarget::NewWindow { session, cwd } | RunTarget::ReuseIdle { session, cwd } => {
+                    push(&["new-window", "-d", "-P", "-F", PANE_FORMAT]);
+                    push(&["-t", &format!("{session}:")]);
+                    if let Some(cwd) = cwd {
+                        push(&["-c", cwd]);
+                    }
+                    push(&[command]);
+                }
+                RunTarget::Pane(pane_id) => {
+                    push(&["send-keys", "-t", pane_id, "-l", command, ";"]);
+                    push(&["send-keys", "-t", pane_id, "Enter", ";"]);
+                    push(&["display-message", "-p", "-t", pane_id, PANE_FORMAT]);
+                }
+            },
+        }
+        args
+    }
+
+    /// Check the action against the last polled topology and pane states.
+    pub fn guard(
+        &self,
+        tmux: &[TmuxPaneInfo],
+        states: &[&PaneRuntimeState],
+    ) -> Result<(), ActionError> {
+        let target = |pane_id: &str| {
+            tmux.iter()
+                .find(|p| p.pane_id == pane_id)
+                .ok_or_else(|| ActionError::PaneNotFound(pane_id.to_string()))
+        };
+        match self {
+            Self::NewWindow { session, .. } => {
+                if !tmux
+                    .iter()
+                    .any(|p| p.session_name == *session || p.session_id == *session)
+                {
+                    return Err(ActionError::InvalidParams(format!(
+                        "unknown session: {session:?}"
+                    )));
+                }
+            }
+            Self::Split { pane_id, .. } | Self::Respawn { pane_id, .. } => {
+                target(pane_id)?;
+            }
+            Self::Run {
+                target: RunTarget::NewWindow { session, .. } | RunTarget::ReuseIdle { session, .. },
+                ..
+            } => {
+                if !tmux
+                    .iter()
+                    .any(|p| p.session_name == *session || p.session_id == *session)
+                {
+                    return Err(ActionError::InvalidParams(format!(
+                        "unknown session: {session:?}"
+                    )));
+                }
+            }
+            Self::Run {
+                target: RunTarget::Pane(pane_id),
+                ..
+            } => {
+                let pane = target(pane_id)?;
+                if is_managed(pane_id, states) || !is_shell(&pane.current_cmd) {
+                    return Err(ActionError::Refused(format!(
+                        "pane {pane_id} is running {:?}, not an idle shell",
+                        pane.current_cmd
+                    )));
+                }
+            }
+            Self::Restart {
+                pane_id,
+                command,
+                if_state,
+                ..
+            } => {
+                target(pane_id)?;
+                let agent = states.iter().find(|s| {
+                    s.pane_instance_id.pane_id == *pane_id && s.presence == PanePresence::Managed
+                });
+                if !if_state.is_empty() {
+                    let current = agent.map(|s| s.activity_state);
+                    if !current.is_some_and(|s| if_state.contains(&s)) {
+                        return Err(ActionError::Refused(format!(
+                            "pane {pane_id} is {}, not {if_state:?}",
+                            current.map_or("not a managed agent".to_string(), |s| format!("{s:?}"))
+                        )));
+                    }
+                }
+                if command.is_none() {
+                    return Err(ActionError::Refused(format!(
+                        "no agent detected in pane {pane_id}; pass command"
+                    )));
+                }
+            }
+            Self::KillPane { pane_id, force } => {
+                target(pane_id)?;
+                if !force {
+                    refuse_busy(std::iter::once(pane_id.as_str()), states)?;
+                }
+            }
+            Self::KillWindow { pane_id, force } => {
+                let window = &target(pane_id)?.window_id;
+                if !force {
+                    let panes = tmux
+                        .iter()
+                        .filter(|p| p.window_id == *window)
+                        .map(|p| p.pane_id.as_str());
+                    refuse_busy(panes, states)?;
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Result for tmux `output`.
+    fn result(&self, output: &str) -> Value {
+        let mut fields = output.split_whitespace();
+        let pane_id = match self {
+            Self::NewWindow { .. } | Self::Split { .. } => {
+                return serde_json::json!({
+                    "action": self.method(),
+                    "pane_id": fields.next().unwrap_or(""),
+                    "address": fields.next(),
+                });
+            }
+            Self::KillPane { pane_id, .. }
+            | Self::KillWindow { pane_id, .. }
+            | Self::Respawn { pane_id, .. } => pane_id,
+            Self::Restart {
+                pane_id, command, ..
+            } => {
+                return serde_json::json!({
+                    "action": self.method(),
+                    "pane_id": pane_id,
+                    "command": command,
+                });
+            }
+            Self::Run { agent, target, .. } => {
+                return serde_json::json!({
+                    "action": self.method(),
+                    "pane_id": fields.next().unwrap_or(""),
+                    "address": fields.next(),
+                    "agent": agent,
+                    "reused": matches!(target, RunTarget::Pane(_)),
+                });
+            }
+        };
+        serde_json::json!({"action": self.method(), "pane_id": pane_id})
+    }
+}
+
+fn is_shell(current_cmd: &str) -> bool {
+    let name = current_cmd.rsplit('/').next().unwrap_or(current_cmd);
+    SHELLS.contains(&name.trim_start_matches('-'))
+}
+
+fn is_managed(pane_id: &str, states: &[&PaneRuntimeState]) -> bool {
+    states
+        .iter()
+        .any(|s| s.pane_instance_id.pane_id == pane_id && s.presence == PanePresence::Managed)
+}
+
+/// Busy = managed and running or waiting on the user; killing it would lose
+/// work in progress.
+pub(crate) fn refuse_busy<'a>(
+    pane_ids: impl Iterator<Item = &'a str>,
+    states: &[&PaneRuntimeState],
+) -> Result<(), ActionError> {
+    for pane_id in pane_ids {
+        let busy = states.iter().find(|s| {
+            s.pane_instance_id.pane_id == pane_id
+                && s.presence == PanePresence::Managed
+                && matches!(
+                    s.activity_state,
+                    ActivityState::Running
+                        | ActivityState::WaitingInput
+                        | ActivityState::WaitingApproval
+                )
+        });
+        if let Some(state) = busy {
+            return Err(ActionError::Refused(format!(
+                "pane {pane_id} has a busy {} agent ({:?}); pass force to kill it anyway",
+                state.provider.map_or("unknown", |p| p.as_str()),
+                state.activity_state
+            )));
+        }
+    }
+    Ok(())
+}
+
+/// Run an action request: replay by `request_ref`, guard, then tmux via the
+/// exec pool (the state lock is not held while tmux runs).
+pub async fn execute(
+    state: &Arc<Mutex<DaemonState>>,
+    method: &str,
+    params: &Value,
+) -> Result<Value, ActionError> {
+    if method == "pane.send" {
+        return send_batch(state, params).await;
+    }
+    let mut action = PaneAction::parse(method, params)?;
+    let request_ref = opt_string(params, "request_ref");
+    let fingerprint = format!("{action:?}");
+
+    let (runner, pool, claim) = {
+        let (st, claim) = match claim(state, request_ref.as_deref(), &fingerprint).await {
+            Claimed::Run(st, claim) => (st, claim),
+            Claimed::Replay(result) => return result,
+        };
+        let states = st.daemon.list_panes();
+        action = action.resolve(&st.last_panes, &states, &st.launches);
+        action.guard(&st.last_panes, &states)?;
+        (tmux_runner(&st)?, Arc::clone(&st.exec_pool), claim)
+    };
+
+    let output = run_tmux(&runner, &pool, action.tmux_args()).await?;
+    tracing::info!(method, request_ref = ?request_ref, "action ran");
+
+    let mut result = action.result(&output);
+    result["request_ref"] = request_ref.clone().map_or(Value::Null, Value::String);
+    result["replayed"] = Value::Bool(false);
+    let mut st = state.lock().await;
+    if let PaneAction::Run { agent, .. } = &action
+        && let Some(pane_id) = result["pane_id"].as_str()
+    {
+        // Register eagerly: `list_panes` shows the launch before the poller
+        // has detected the agent.
+        let launch = Launch {
+            agent: agent.clone(),
+            launched_at: chrono::Utc::now(),
+        };
+        st.launches.insert(pane_id.to_string(), launch);
+        st.invalidate_pane_list();
+    }
+    remember(&mut st, claim, &result);
+    Ok(result)
+}
+
+/// Outcome of the action behind a `request_ref`.
+#[derive(Debug, Clone)]
+pub enum RefOutcome {
+    /// Still running: the call that claimed the ref sends its result here,
+    /// or drops the sender if it failed.
+    Running(watch::Receiver<Option<Value>>),
+    Done(Value),
+}
+
+impl PartialEq for RefOutcome {
+    fn eq(&self, other: &Self) -> bool {
+        match (self, other) {
+            (Self::Running(a), Self::Running(b)) => a.same_channel(b),
+            (Self::Done(a), Self::Done(b)) => a == b,
+            _ => false,
+        }
+    }
+}
+
+/// A call's hold on its `request_ref` (ref, fingerprint, result sender;
+/// None without a ref). [`remember`] stores the result; dropped without it
+/// (the call failed), the ref is free again.
+pub(crate) struct Claim(Option<(String, String, watch::Sender<Option<Value>>)>);
+
+/// What [`claim`] decided.
+pub(crate) enum Claimed<'a> {
+    /// Run the action, with the state lock still held.
+    Run(MutexGuard<'a, DaemonState>, Claim),
+    /// The ref was seen before: its result (marked `replayed`), or an error
+    /// if it was used for a different action.
+    Replay(Result<Value, ActionError>),
+}
+
+/// Look up `request_ref` and, if it is new, claim it under the same lock, so
+/// concurrent calls with one ref run the action once: a repeat waits for the
+/// running call and returns its result, or runs the action itself if that
+/// call failed.
+pub(crate) async fn claim<'a>(
+    state: &'a Mutex<DaemonState>,
+    request_ref: Option<&str>,
+    fingerprint: &str,
+) -> Claimed<'a> {
+    loop {
+        let mut st = state.lock().await;
+        let Some(request_ref) = request_ref else {
+            return Claimed::Run(st, Claim(None));
+        };
+        let running = match st.action_refs.get(request_ref) {
+            Some((seen, _)) if seen != fingerprint => {
+                return Claimed::Replay(Err(ActionError::InvalidParams(format!(
+                    "request_ref {request_ref:?} was used for a different action"
+                ))));
+            }
+            Some((_, RefOutcome::Done(result))) => return Claimed::Replay(Ok(replayed(result))),
+            // A closed channel without a result: that call failed.
+            Some((_, RefOutcome::Running(rx))) if rx.has_changed().is_ok() => Some(rx.clone()),
+            _ => None,
+        };
+        if let Some(mut rx) = running {
+            drop(st);
+            if let Ok(result) = rx.wait_for(Option::is_some).await
+                && let Some(result) = result.as_ref()
+            {
+                return Claimed::Replay(Ok(replayed(result)));
+            }
+            continue;
+        }
+        let (tx, rx) = watch::channel(None);
+        st.action_refs.insert(
+            request_ref.to_string(),
+            (fingerprint.to_string(), RefOutcome::Running(rx)),
+        );
+        let claim = Claim(Some((request_ref.to_string(), fingerprint.to_string(), tx)));
+        return Claimed::Run(st, claim);
+    }
+}
+
+fn replayed(result: &Value) -> Value {
+    let mut result = result.clone();
+    result["replayed"] = Value::Bool(true);
+    result
+}
+
+/// Store `result` for later replays of the claimed `request_ref` and hand it
+/// to the calls waiting on it.
+pub(crate) fn remember(st: &mut DaemonState, claim: Claim, result: &Value) {
+    if let Some((request_ref, fingerprint, tx)) = claim.0 {
+        st.action_refs
+            .insert(request_ref, (fingerprint, RefOutcome::Done(result.clone())));
+        tx.send_replace(Some(result.clone()));
+    }
+}
+
+/// `pane.send` targets: explicit `pane_ids`, or the managed agent panes
+/// matching `session` / `state` / `agent`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum SendTargets {
+    Panes(Vec<String>),
+    Filter {
+        session: Option<String>,
+        states: Vec<ActivityState>,
+        agent: Option<String>,
+    },
+}
+
+impl SendTargets {
+    fn parse(params: &Value) -> Result<Self, ActionError> {
+        let filter = SendTargets::Filter {
+            session: opt_string(params, "session"),
+            states: states_param(params, "state")?,
+            agent: opt_string(params, "agent"),
+        };
+        let has_filter = filter
+            != SendTargets::Filter {
+                session: None,
+                states: Vec::new(),
+                agent: None,
+            };
+        match params["pane_ids"].as_array() {
+            Some(_) if has_filter => Err(ActionError::InvalidParams(
+                "pass pane_ids or a filter (session / state / agent), not both".to_string(),
+            )),
+            Some(ids) => Ok(SendTargets::Panes(
+                ids.iter()
+                    .filter_map(Value::as_str)
+                    .map(String::from)
+                    .collect(),
+            )),
+            None if has_filter => Ok(filter),
+            None => Err(ActionError::InvalidParams(
+                "pane_ids or a filter (session / state / agent) is required".to_string(),
+            )),
+        }
+    }
+
+    /// Pane ids to send to, in pane id order. Every listed pane must exist,
+    /// so nothing is sent when one of them is gone.
+    fn resolve(
+        &self,
+        tmux: &[TmuxPaneInfo],
+        states: &[&PaneRuntimeState],
+    ) -> Result<Vec<String>, ActionError> {
+        let mut pane_ids = match self {
+            Self::Panes(ids) => {
+                if let Some(unknown) = ids
+                    .iter()
+                    .find(|id| !tmux.iter().any(|p| p.pane_id == **id))
+                {
+                    return Err(ActionError::PaneNotFound(unknown.clone()));
+                }
+                ids.clone()
+            }
+            Self::Filter {
+                session,
+                states: wanted,
+                agent,
+            } => states
+                .iter()
+                .filter(|s| s.presence == PanePresence::Managed)
+                .filter(|s| wanted.is_empty() || wanted.contains(&s.activity_state))
+                .filter(|s| {
+                    agent
+                        .as_deref()
+                        .is_none_or(|a| s.provider.is_some_and(|p| p.as_str() == a))
+                })
+                .filter_map(|s| {
+                    tmux.iter()
+                        .find(|p| p.pane_id == s.pane_instance_id.pane_id)
+                })
+                .filter(|p| {
+                    session
+                        .as_deref()
+                        .is_none_or(|s| p.session_name == s || p.session_id == s)
+                })
+                .map(|p| p.pane_id.clone())
+                .collect(),
+        };
+        pane_ids.sort_by_key(|id| crate::server::pane_order_key(id));
+        pane_ids.dedup();
+        if pane_ids.is_empty() {
+            return Err(ActionError::InvalidParams("no panes match".to_string()));
+        }
+        Ok(pane_ids)
+    }
+}
+
+/// tmux arguments typing `text` (literally) or pressing `key` (a tmux key
+/// name such as `C-c`) in `pane_id`, then Enter if `enter`.
+pub(crate) fn send_keys_args(
+    pane_id: &str,
+    text: &str,
+    key: Option<&str>,
+    enter: bool,
+) -> Vec<String> {
+    let mut args: Vec<&str> = match key {
+        Some(key) => vec!["send-keys", "-t", pane_id, key],
+        None if !text.is_empty() => vec!["send-keys", "-t", pane_id, "-l", text],
+        None => Vec::new(),
+    };
+    if enter {
+        if !args.is_empty() {
+            args.push(";");
+        }
+        args.extend(["send-keys", "-t", pane_id, "Enter"]);
+    }
+    args.into_iter().map(String::from).collect()
+}
+
+/// Check `pane.send` params and their input against `policy` without
+/// resolving targets, so a scheduled send is refused up front rather than
+/// when it comes due.
+pub(crate) fn check_send(params: &Value, policy: &SendPolicy) -> Result<(), ActionError> {
+    parse_send(params)?;
+    policy.check_input(send_input(params))
+}
+
+/// The text of a `pane.send`, or its key name.
+fn send_input(params: &Value) -> &str {
+    params["key"]
+        .as_str()
+        .filter(|k| !k.is_empty())
+        .unwrap_or_else(|| params["text"].as_str().unwrap_or(""))
+}
+
+fn parse_send(params: &Value) -> Result<SendTargets, ActionError> {
+    let targets = SendTargets::parse(params)?;
+    let text = params["text"].as_str().unwrap_or("");
+    let key = opt_string(params, "key");
+    let enter = params["enter"].as_bool().unwrap_or(key.is_none());
+    if key.is_some() && !text.is_empty() {
+        return Err(ActionError::InvalidParams(
+            "pass text or key, not both".to_string(),
+        ));
+    }
+    if text.is_empty() && key.is_none() && !enter {
+        return Err(ActionError::InvalidParams(
+            "text must not be empty".to_string(),
+        ));
+    }
+    Ok(targets)
+}
+
+/// `pane.send`: the same text / key into every target, one tmux invocation
+/// per pane. Targets are resolved and checked before anything is sent; a
+/// pane failing afterwards does not stop the others and is reported in
+/// `failed`.
+async fn send_batch(state: &Arc<Mutex<DaemonState>>, params: &Value) -> Result<Value, ActionError> {
+    let targets = parse_send(params)?;
+    let request_ref = opt_string(params, "request_ref");
+    let text = params["text"].as_str().unwrap_or("");
+    let key = opt_string(params, "key");
+    let enter = params["enter"].as_bool().unwrap_or(key.is_none());
+    let fingerprint = format!("pane.send {targets:?} {text:?} {key:?} {enter}");
+
+    let (pane_ids, runner, pool, claim) = {
+        let (st, claim) = match claim(state, request_ref.as_deref(), &fingerprint).await {
+            Claimed::Run(st, claim) => (st, claim),
+            Claimed::Replay(result) => return result,
+        };
+        let states = st.daemon.list_panes();
+        let pane_ids = targets.resolve(&st.last_panes, &states)?;
+        st.send_policy.check_input(send_input(params))?;
+        st.send_policy
+            .check_panes(pane_ids.iter().map(String::as_str), &states)?;
+        (
+            pane_ids,
+            tmux_runner(&st)?,
+            Arc::clone(&st.exec_pool),
+            claim,
+        )
+    };
+
+    let mut done = Vec::new();
+    let mut failed = serde_json::Map::new();
+    for pane_id in &pane_ids {
+        let args = send_keys_args(pane_id, text, key.as_deref(), enter);
+        match run_tmux(&runner, &pool, args).await {
+            Ok(_) => done.push(pane_id.clone()),
+            Err(e) => {
+                failed.insert(pane_id.clone(), Value::String(e.to_string()));
+            }
+        }
+    }
+    tracing::info!(panes = done.len(), failed = failed.len(), request_ref = ?request_ref, "batch send ran");
+
+    let result = serde_json::json!({
+        "action": "pane.send",
+        "panes": done,
+        "failed": failed,
+        "request_ref": request_ref,
+        "replayed": false,
+    });
+    remember(&mut *state.lock().await, claim, &result);
+    Ok(result)
+}
+
+pub(crate) fn tmux_runner(st: &DaemonState) -> Result<Arc<dyn TmuxCommandRunner>, ActionError> {
+    st.tmux
+        .clone()
+        .ok_or_else(|| ActionError::Failed("no tmux executor".to_string()))
+}
+
+/// Run one tmux invocation on the exec pool.
+pub(crate) async fn run_tmux(
+    runner: &Arc<dyn TmuxCommandRunner>,
+    pool: &ExecPool,
+    args: Vec<String>,
+) -> Result<String, ActionError> {
+    let runner = Arc::clone(runner);
+    pool.run(move || {
+        let args: Vec<&str> = args.iter().map(String::as_str).collect();
+        runner.run(&args)
+    })
+    .await
+    .map_err(|e| ActionError::Failed(format!("tmux: {e}")))?
+    .map_err(|e| ActionError::Failed(format!("tmux: {e}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support;
+    use agtmux_core_v5::types::Provider;
+    use chrono::Utc;
+    use serde_json::json;
+
+    fn tmux_pane(pane_id: &str, window_id: &str) -> TmuxPaneInfo {
+        TmuxPaneInfo {
+            pane_id: pane_id.to_string(),
+            window_id: window_id.to_string(),
+            session_name: "work".to_string(),
+            session_id: "$1".to_string(),
+            ..Default::default()
+        }
+    }
+
+    fn agent(pane_id: &str, state: ActivityState) -> PaneRuntimeState {
+        PaneRuntimeState {
+            provider: Some(Provider::Codex),
+            ..test_support::pane(pane_id, state)
+        }
+    }
+
+    #[test]
+    fn parses_and_builds_tmux_args() {
+        let action = PaneAction::parse(
+            "pane.new_window",
+            &json!({"session": "work", "name": "agent", "cwd": "/src", "command": "codex"}),
+        )
+        .expect("parse");
+        assert_eq!(
+            action.tmux_args(),
+            [
+                "new-window",
+                "-d",
+                "-P",
+                "-F",
+                PANE_FORMAT,
+                "-t",
+                "work:",
+                "-n",
+                "agent",
+                "-c",
+                "/src",
+                "codex"
+            ]
+        );
+        let split = PaneAction::parse(
+            "pane.split",
+            &json!({"pane_id": "%1", "direction": "horizontal"}),
+        )
+        .expect("parse");
+        assert_eq!(
+            split.tmux_args()[5..],
+            ["-h".to_string(), "-t".to_string(), "%1".to_string()]
+        );
+        let respawn = PaneAction::parse("pane.respawn", &json!({"pane_id": "%1", "kill": true}))
+            .expect("parse");
+        assert_eq!(respawn.tmux_args(), ["respawn-pane", "-k", "-t", "%1"]);
+
+        assert_eq!(
+            PaneAction::parse("pane.kill", &json!({})),
+            Err(ActionError::InvalidParams(
+                "pane_id is required".to_string()
+            ))
+        );
+        assert!(
+            PaneAction::parse("pane.split", &json!({"pane_id": "%1", "direction": "up"})).is_err()
+        );
+    }
+
+    #[test]
+    fn run_quotes_prompt_and_reuses_idle_shell() {
+        let run = PaneAction::parse(
+            "pane.run",
+            &json!({"agent": "claude", "prompt": "fix the user's bug", "session": "work",
+                "reuse_idle": true}),
+        )
+        .expect("parse");
+        let mut shell = tmux_pane("%2", "@1");
+        shell.current_cmd = "-zsh".to_string();
+        let mut editor = tmux_pane("%1", "@1");
+        editor.current_cmd = "nvim".to_string();
+        let tmux = [editor, shell];
+
+        let reused = run.clone().resolve(&tmux, &[], &Default::default());
+        assert_eq!(reused.guard(&tmux, &[]), Ok(()));
+        assert_eq!(
+            reused.tmux_args(),
+            [
+                "send-keys",
+                "-t",
+                "%2",
+                "-l",
+                "claude 'fix the user'\\''s bug'",
+                ";",
+                "send-keys",
+                "-t",
+                "%2",
+                "Enter",
+                ";",
+                "display-message",
+                "-p",
+                "-t",
+                "%2",
+                PANE_FORMAT
+            ]
+        );
+        assert_eq!(reused.result("%2 work:1.0\n")["address"], json!("work:1.0"));
+
+        let launched = std::collections::HashMap::from([(
+            "%2".to_string(),
+            Launch {
+                agent: "codex".to_string(),
+                launched_at: Utc::now(),
+            },
+        )]);
+        let fresh = run.resolve(&tmux, &[], &launched);
+        assert_eq!(
+            fresh.tmux_args()[..7],
+            ["new-window", "-d", "-P", "-F", PANE_FORMAT, "-t", "work:"]
+        );
+
+        let into_editor = PaneAction::parse(
+            "pane.run",
+            &json!({"agent": "codex", "prompt": "", "pane_id": "%1"}),
+        )
+        .expect("parse");
+        let err = into_editor.guard(&tmux, &[]).expect_err("not a shell");
+        assert_eq!(err.code(), codes::ACTION_REFUSED);
+        assert!(
+            PaneAction::parse("pane.run", &json!({"agent": "aider", "session": "work"})).is_err(),
+            "unknown agent without command"
+        );
+        let custom = PaneAction::parse(
+            "pane.run",
+            &json!({"command": "aider --yes", "prompt": "go", "session": "work"}),
+        )
+        .expect("parse");
+        assert!(matches!(
+            custom,
+            PaneAction::Run { ref agent, ref command, .. }
+                if agent == "custom" && command == "aider --yes 'go'"
+        ));
+    }
+
+    #[test]
+    fn guards_unknown_targets_and_busy_agents() {
+        let tmux = [tmux_pane("%1", "@1"), tmux_pane("%2", "@1")];
+        let busy = agent("%2", ActivityState::WaitingApproval);
+        let idle = agent("%1", ActivityState::Idle);
+        let states = [&idle, &busy];
+
+        let kill = |pane_id: &str, force: bool| PaneAction::KillPane {
+            pane_id: pane_id.to_string(),
+            force,
+        };
+        assert_eq!(kill("%1", false).guard(&tmux, &states), Ok(()));
+        assert!(matches!(
+            kill("%2", false).guard(&tmux, &states),
+            Err(ActionError::Refused(_))
+        ));
+        assert_eq!(kill("%2", true).guard(&tmux, &states), Ok(()));
+        assert_eq!(
+            kill("%9", true).guard(&tmux, &states),
+            Err(ActionError::PaneNotFound("%9".to_string()))
+        );
+
+        let window = PaneAction::KillWindow {
+            pane_id: "%1".to_string(),
+            force: false,
+        };
+        let err = window.guard(&tmux, &states).expect_err("busy sibling");
+        assert_eq!(err.code(), codes::ACTION_REFUSED);
+        assert!(err.to_string().contains("pane %2 has a busy codex agent"));
+
+        let new_window = |session: &str| PaneAction::NewWindow {
+            session: session.to_string(),
+            name: None,
+            cwd: None,
+            command: None,
+        };
+        assert_eq!(new_window("$1").guard(&tmux, &states), Ok(()));
+        assert!(new_window("nope").guard(&tmux, &states).is_err());
+    }
+
+    #[test]
+    fn restart_relaunches_the_agent_when_in_state() {
+        let mut pane = tmux_pane("%1", "@1");
+        pane.current_path = "/src/app".to_string();
+        let tmux = [pane, tmux_pane("%2", "@1")];
+        let errored = agent("%1", ActivityState::Error);
+        let states = [&errored];
+
+        let restart = PaneAction::parse(
+            "pane.restart",
+            &json!({"pane_id": "%1", "if_state": ["error", "waiting_input"]}),
+        )
+        .expect("parse")
+        .resolve(&tmux, &states, &Default::default());
+        assert_eq!(restart.guard(&tmux, &states), Ok(()));
+        assert_eq!(
+            restart.tmux_args(),
+            ["respawn-pane", "-k", "-t", "%1", "-c", "/src/app", "codex"]
+        );
+        assert_eq!(restart.result("")["command"], "codex");
+
+        let running = agent("%1", ActivityState::Running);
+        let err = restart.guard(&tmux, &[&running]).expect_err("state guard");
+        assert_eq!(err.code(), codes::ACTION_REFUSED);
+
+        let plain = |pane_id: &str, launches: &std::collections::HashMap<String, Launch>| {
+            PaneAction::parse(
+                "pane.restart",
+                &json!({"pane_id": pane_id, "if_state": "Error"}),
+            )
+            .expect("parse")
+            .resolve(&tmux, &states, launches)
+        };
+        assert!(
+            plain("%2", &Default::default())
+                .guard(&tmux, &states)
+                .is_err(),
+            "no agent detected"
+        );
+        let launched = std::collections::HashMap::from([(
+            "%2".to_string(),
+            Launch {
+                agent: "claude".to_string(),
+                launched_at: Utc::now(),
+            },
+        )]);
+        assert!(matches!(
+            plain("%2", &launched),
+            PaneAction::Restart { command: Some(ref c), .. } if c == "claude"
+        ));
+        assert_eq!(
+            PaneAction::parse(
+                "pane.restart",
+                &json!({"pane_id": "%1", "if_state": "dead"})
+            ),
+            Err(ActionError::InvalidParams(
+                "unknown state in if_state: \"dead\"".to_string()
+            ))
+        );
+    }
+
+    #[tokio::test]
+    async fn concurrent_request_refs_run_once() {
+        let state = Arc::new(Mutex::new(DaemonState::new()));
+        let Claimed::Run(st, first) = claim(&state, Some("r-1"), "send").await else {
+            panic!("the first call runs");
+        };
+        drop(st);
+        let repeat = tokio::spawn({
+            let state = Arc::clone(&state);
+            async move {
+                match claim(&state, Some("r-1"), "send").await {
+                    Claimed::Replay(result) => result,
+                    Claimed::Run(..) => panic!("ran twice"),
+                }
+            }
+        });
+        tokio::time::sleep(std::time::Duration::from_millis(20)).await;
+        assert!(!repeat.is_finished(), "waits for the first call");
+        remember(
+            &mut *state.lock().await,
+            first,
+            &json!({"request_ref": "r-1", "replayed": false}),
+        );
+        assert_eq!(
+            repeat.await.expect("join"),
+            Ok(json!({"request_ref": "r-1", "replayed": true}))
+        );
+        assert!(matches!(
+            claim(&state, Some("r-1"), "kill").await,
+            Claimed::Replay(Err(ActionError::InvalidParams(_)))
+        ));
+
+        // A call that fails frees its ref.
+        let Claimed::Run(st, failed) = claim(&state, Some("r-2"), "send").await else {
+            panic!("the first call runs");
+        };
+        drop((st, failed));
+        assert!(matches!(
+            claim(&state, Some("r-2"), "send").await,
+            Claimed::Run(..)
+        ));
+    }
+}
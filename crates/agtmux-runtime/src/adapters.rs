@@ -0,0 +1,589 @@
+//! Custom adapters (`[[adapters]]`): in-house agent CLIs described by
+//! regexes instead of code, tracked by the poller like the built-in
+//! providers.
+//!
+//! ```toml
+//! [[adapters]]
+//! name = "devbot"
+//! process = "^devbot"                   # regex on the pane's current command
+//! running = ['^\[working\]']
+//! waiting_input = ['\? $']
+//! waiting_approval = ['approve\? \[y/N\]']
+//! error = ['^ERROR']
+//! idle = ['^devbot> ']
+//! label = '^task: (.+)'                 # capture group 1 → conversation title
+//! ```
+//!
+//! Panes claimed by an adapter have provider `custom` and `adapter` set to
+//! its name on `list_panes`. Adapters are tried before the built-in
+//! providers, in file order.
+//!
+//! A plugin adapter sets `command` instead of the output regexes:
+//!
+//! ```toml
+//! [[adapters]]
+//! name = "devbot"
+//! process = "^devbot"
+//! command = ["python3", "/opt/devbot/classify.py"]
+//! sha256 = ["9f86d081...", "60303ae2..."]  # `sha256sum` of each file, in order
+//! ```
+//!
+//! Before every run each file of the command is hashed: the executable (a
+//! path, or looked up on `PATH`) and every argument naming an existing file,
+//! so an interpreter's script is pinned along with the interpreter. The
+//! plugin only starts if there is one matching pin per file, in command
+//! order, and none of the files sits in, or is, a group- or world-writable
+//! location another user could swap it in. `allow_unverified = true`
+//! instead of `sha256` skips the check while developing a plugin.
+//!
+//! For each pane it claims the daemon runs the command with one JSON object
+//! on stdin (`adapter`, `pane_id`, `current_cmd`, `pane_title`, `lines`) and
+//! reads one from stdout: `{"state": "waiting_input", "label": "...",
+//! "confidence": 0.9}` (`label` and `confidence` optional). The plugin is
+//! only rerun when the pane's command, title or output changed; one that
+//! fails, times out or prints something else leaves the pane Unknown.
+
+use std::collections::HashMap;
+use std::hash::{Hash, Hasher};
+use std::io::{Read, Write};
+use std::os::unix::fs::PermissionsExt;
+use std::path::{Path, PathBuf};
+use std::time::{Duration, Instant};
+
+use agtmux_core_v5::signature::WEIGHT_CMD_MATCH;
+use agtmux_core_v5::types::{ActivityState, Provider};
+use agtmux_source_poller::custom::{CustomAdapter, Verdict, claiming_adapter};
+use agtmux_source_poller::source::PaneSnapshot;
+use serde_json::Value;
+use sha2::{Digest, Sha256};
+
+/// How long a plugin may take to classify one pane.
+const PLUGIN_TIMEOUT: Duration = Duration::from_secs(2);
+
+/// One `[[adapters]]` entry.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct AdapterDef {
+    pub name: String,
+    /// Regex matched against the pane's current command.
+    pub process: String,
+    #[serde(default)]
+    pub running: Vec<String>,
+    #[serde(default)]
+    pub idle: Vec<String>,
+    #[serde(default)]
+    pub waiting_input: Vec<String>,
+    #[serde(default)]
+    pub waiting_approval: Vec<String>,
+    #[serde(default)]
+    pub error: Vec<String>,
+    /// Regex over the output; its first capture group labels the pane.
+    pub label: Option<String>,
+    /// Plugin command (argv) classifying the pane instead of the regexes.
+    #[serde(default)]
+    pub command: Vec<String>,
+    /// Hex SHA-256 of each file of `command` (executable, then file
+    /// arguments); lowercased when parsed.
+    #[serde(default, deserialize_with = "lowercase_pins")]
+    pub sha256: Vec<String>,
+    /// Run the plugin without a `sha256` pin (plugin development).
+    #[serde(default)]
+    pub allow_unverified: bool,
+}
+
+fn lowercase_pins<'de, D: serde::Deserializer<'de>>(d: D) -> Result<Vec<String>, D::Error> {
+    let pins: Vec<String> = serde::Deserialize::deserialize(d)?;
+    Ok(pins.into_iter().map(|p| p.to_ascii_lowercase()).collect())
+}
+
+impl AdapterDef {
+    /// (key, state, patterns) for every state list.
+    pub fn state_patterns(&self) -> [(&'static str, ActivityState, &Vec<String>); 5] {
+        [
+            ("running", ActivityState::Running, &self.running),
+            ("idle", ActivityState::Idle, &self.idle),
+            (
+                "waiting_input",
+                ActivityState::WaitingInput,
+                &self.waiting_input,
+            ),
+            (
+                "waiting_approval",
+                ActivityState::WaitingApproval,
+                &self.waiting_approval,
+            ),
+            ("error", ActivityState::Error, &self.error),
+        ]
+    }
+
+    pub fn compile(&self) -> anyhow::Result<CustomAdapter> {
+        if !self.command.is_empty() {
+            return CustomAdapter::plugin(
+                &self.name,
+                &self.process,
+                self.command.clone(),
+                self.sha256.clone(),
+            )
+            .map_err(anyhow::Error::msg);
+        }
+        let states: Vec<(ActivityState, Vec<String>)> = self
+            .state_patterns()
+            .into_iter()
+            .map(|(_, state, patterns)| (state, patterns.clone()))
+            .collect();
+        CustomAdapter::new(&self.name, &self.process, &states, self.label.as_deref())
+            .map_err(anyhow::Error::msg)
+    }
+}
+
+/// Reject unnamed, duplicate or built-in names, adapters without state
+/// patterns (or with both patterns and a plugin command), plugins without a
+/// valid `sha256` or `allow_unverified`, and patterns that do not compile.
+pub fn validate_adapters(defs: &[AdapterDef]) -> anyhow::Result<()> {
+    for (i, def) in defs.iter().enumerate() {
+        if def.name.trim().is_empty() {
+            anyhow::bail!("adapters[{i}].name must not be empty");
+        }
+        if defs[..i].iter().any(|d| d.name == def.name) {
+            anyhow::bail!("duplicate adapter name {:?}", def.name);
+        }
+        if def.name.parse::<Provider>().is_ok() {
+            anyhow::bail!("adapter {:?}: name is a built-in provider", def.name);
+        }
+        let has_patterns =
+            def.label.is_some() || def.state_patterns().iter().any(|(_, _, p)| !p.is_empty());
+        if !def.command.is_empty() {
+            if has_patterns {
+                anyhow::bail!(
+                    "adapter {:?}: command replaces the output patterns and label; set one or the other",
+                    def.name
+                );
+            }
+            if !def.sha256.is_empty() && def.allow_unverified {
+                anyhow::bail!(
+                    "adapter {:?}: set sha256 or allow_unverified, not both",
+                    def.name
+                );
+            }
+            if def.sha256.is_empty() && !def.allow_unverified {
+                anyhow::bail!(
+                    "adapter {:?}: plugin commands need sha256 = [...] with the digest of each file they run (or allow_unverified = true while developing)",
+                    def.name
+                );
+            }
+            if let Some(pin) = def
+                .sha256
+                .iter()
+                .find(|p| p.len() != 64 || !p.chars().all(|c| c.is_ascii_hexdigit()))
+            {
+                anyhow::bail!(
+                    "adapter {:?}: sha256 {pin:?} is not 64 hex digits (`sha256sum <file>`)",
+                    def.name
+                );
+            }
+        } else if !def.sha256.is_empty() || def.allow_unverified {
+            anyhow::bail!(
+                "adapter {:?}: sha256 and allow_unverified only apply to a plugin command",
+                def.name
+            );
+        } else if def.state_patterns().iter().all(|(_, _, p)| p.is_empty()) {
+            anyhow::bail!(
+                "adapter {:?}: set at least one of running, idle, waiting_input, waiting_approval, error",
+                def.name
+            );
+        }
+        def.compile()?;
+    }
+    Ok(())
+}
+
+/// Compiled adapters of a validated config.
+pub fn compile_all(defs: &[AdapterDef]) -> Vec<CustomAdapter> {
+    defs.iter().filter_map(|d| d.compile().ok()).collect()
+}
+
+/// One plugin run needed this tick.
+#[derive(Debug, Clone)]
+pub struct PluginJob {
+    pub pane_id: String,
+    key: u64,
+    command: Vec<String>,
+    sha256: Vec<String>,
+    request: Value,
+}
+
+impl PluginJob {
+    /// Run the plugin (blocking); failures are logged and yield Unknown.
+    pub fn run(&self) -> Verdict {
+        run_plugin(&self.command, &self.sha256, &self.request).unwrap_or_else(|e| {
+            tracing::warn!("adapter plugin for {} failed: {e:#}", self.pane_id);
+            Verdict {
+                state: ActivityState::Unknown,
+                label: None,
+                confidence: WEIGHT_CMD_MATCH,
+            }
+        })
+    }
+}
+
+/// Last verdict per pane and the input it was computed from.
+#[derive(Debug, Default)]
+pub struct PluginVerdicts {
+    entries: HashMap<String, (u64, Verdict)>,
+}
+
+impl PluginVerdicts {
+    /// Split the panes plugin adapters claim into cached verdicts and jobs
+    /// to run; entries of other panes are dropped.
+    pub fn plan(
+        &mut self,
+        adapters: &[CustomAdapter],
+        snapshots: &[PaneSnapshot],
+    ) -> (HashMap<String, Verdict>, Vec<PluginJob>) {
+        let mut cached = HashMap::new();
+        let mut jobs = Vec::new();
+        let mut kept = HashMap::new();
+        for snapshot in snapshots {
+            let Some(adapter) = claiming_adapter(snapshot, adapters) else {
+                continue;
+            };
+            let Some(command) = adapter.command() else {
+                continue;
+            };
+            let request = serde_json::json!({
+                "adapter": adapter.name,
+                "pane_id": snapshot.pane_id,
+                "current_cmd": snapshot.current_cmd,
+                "pane_title": snapshot.pane_title,
+                "lines": snapshot.capture_lines,
+            });
+            let key = request_key(&request);
+            match self.entries.remove(&snapshot.pane_id) {
+                Some((prev, verdict)) if prev == key => {
+                    cached.insert(snapshot.pane_id.clone(), verdict.clone());
+                    kept.insert(snapshot.pane_id.clone(), (prev, verdict));
+                }
+                _ => jobs.push(PluginJob {
+                    pane_id: snapshot.pane_id.clone(),
+                    key,
+                    command: command.to_vec(),
+                    sha256: adapter.sha256().to_vec(),
+                    request,
+                }),
+            }
+        }
+        self.entries = kept;
+        (cached, jobs)
+    }
+
+    /// Remember the verdict of a job run this tick.
+    pub fn record(&mut self, job: &PluginJob, verdict: Verdict) {
+        self.entries.insert(job.pane_id.clone(), (job.key, verdict));
+    }
+}
+
+fn request_key(request: &Value) -> u64 {
+    let mut hasher = std::collections::hash_map::DefaultHasher::new();
+    request.to_string().hash(&mut hasher);
+    hasher.finish()
+}
+
+/// `program` as given if it is a path, else the first executable file of
+/// that name on `PATH`.
+fn resolve_program(program: &str) -> anyhow::Result<PathBuf> {
+    if program.contains('/') {
+        return Ok(PathBuf::from(program));
+    }
+    std::env::var_os("PATH")
+        .iter()
+        .flat_map(std::env::split_paths)
+        .map(|dir| dir.join(program))
+        .find(|path| {
+            path.metadata()
+                .is_ok_and(|m| m.is_file() && m.permissions().mode() & 0o111 != 0)
+        })
+        .ok_or_else(|| anyhow::anyhow!("{program} not found on PATH"))
+}
+
+/// Hex SHA-256 of a file's contents, refusing files another user could
+/// replace between the check and the run: group- or world-writable, or in
+/// such a directory without the sticky bit.
+fn file_digest(path: &Path) -> anyhow::Result<String> {
+    let cannot = |e: std::io::Error| anyhow::anyhow!("cannot read {}: {e}", path.display());
+    let dir = match path.parent() {
+        Some(dir) if !dir.as_os_str().is_empty() => dir,
+        _ => Path::new("."),
+    };
+    let dir_mode = dir.metadata().map_err(cannot)?.permissions().mode();
+    if dir_mode & 0o022 != 0 && dir_mode & 0o1000 == 0 {
+        anyhow::bail!("{} is in a directory other users can write", path.display());
+    }
+    let mut file = std::fs::File::open(path).map_err(cannot)?;
+    if file.metadata().map_err(cannot)?.permissions().mode() & 0o022 != 0 {
+        anyhow::bail!("{} is writable by other users", path.display());
+    }
+    let mut bytes = Vec::new();
+    file.read_to_end(&mut bytes).map_err(cannot)?;
+    Ok(Sha256::digest(&bytes)
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect())
+}
+
+/// Check the executable and each argument naming a file against `pins`, in
+/// command order.
+fn verify_pins(path: &Path, args: &[String], pins: &[String]) -> anyhow::Result<()> {
+    let files: Vec<&Path> = std::iter::once(path)
+        .chain(args.iter().map(Path::new).filter(|p| p.is_file()))
+        .collect();
+    if files.len() != pins.len() {
+        anyhow::bail!(
+            "command runs {} file(s) but has {} sha256 pin(s)",
+            files.len(),
+            pins.len()
+        );
+    }
+    for (file, pin) in files.into_iter().zip(pins) {
+        let actual = file_digest(file)?;
+        if !actual.eq_ignore_ascii_case(pin) {
+            anyhow::bail!(
+                "{} has sha256 {actual}, not the configured {pin}",
+                file.display()
+            );
+        }
+    }
+    Ok(())
+}
+
+fn run_plugin(command: &[String], pins: &[String], request: &Value) -> anyhow::Result<Verdict> {
+    let (program, args) = command
+        .split_first()
+        .ok_or_else(|| anyhow::anyhow!("empty command"))?;
+    let path = resolve_program(program)?;
+    if !pins.is_empty() {
+        verify_pins(&path, args, pins).map_err(|e| anyhow::anyhow!("{e:#}; not run"))?;
+    }
+    let mut child = std::process::Command::new(&path)
+        .args(args)
+        .stdin(std::process::Stdio::piped())
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::null())
+        .spawn()
+        .map_err(|e| anyhow::anyhow!("{program} failed to start: {e}"))?;
+    if let Some(mut stdin) = child.stdin.take() {
+        // A plugin that does not read its input may close stdin early.
+        let _ = writeln!(stdin, "{request}");
+    }
+    let started = Instant::now();
+    let status = loop {
+        if let Some(status) = child.try_wait()? {
+            break status;
+        }
+        if started.elapsed() > PLUGIN_TIMEOUT {
+            let _ = child.kill();
+            let _ = child.wait();
+            anyhow::bail!("{program} timed out after {}s", PLUGIN_TIMEOUT.as_secs());
+        }
+        std::thread::sleep(Duration::from_millis(10));
+    };
+    let mut output = String::new();
+    if let Some(mut stdout) = child.stdout.take() {
+        stdout.read_to_string(&mut output)?;
+    }
+    if !status.success() {
+        anyhow::bail!("{program} exited with {status}");
+    }
+    parse_verdict(&output)
+}
+
+/// `{"state": ..., "label": ..., "confidence": ...}`; the state may be
+/// spelled `waiting_input` or `WaitingInput`.
+fn parse_verdict(output: &str) -> anyhow::Result<Verdict> {
+    let value: Value = serde_json::from_str(output.trim())
+        .map_err(|e| anyhow::anyhow!("invalid plugin output: {e}"))?;
+    let state = value["state"]
+        .as_str()
+        .ok_or_else(|| anyhow::anyhow!("plugin output has no state"))?;
+    let key = |s: &str| s.replace('_', "").to_lowercase();
+    let state = ActivityState::PRECEDENCE_DESC
+        .into_iter()
+        .find(|s| key(&format!("{s:?}")) == key(state))
+        .ok_or_else(|| anyhow::anyhow!("unknown state {state:?}"))?;
+    Ok(Verdict {
+        state,
+        label: value["label"]
+            .as_str()
+            .map(str::trim)
+            .filter(|l| !l.is_empty())
+            .map(String::from),
+        confidence: value["confidence"]
+            .as_f64()
+            .unwrap_or(WEIGHT_CMD_MATCH)
+            .clamp(0.0, 1.0),
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn def() -> AdapterDef {
+        AdapterDef {
+            name: "devbot".to_string(),
+            process: "^devbot".to_string(),
+            running: vec![r"^\[working\]".to_string()],
+            idle: Vec::new(),
+            waiting_input: Vec::new(),
+            waiting_approval: Vec::new(),
+            error: Vec::new(),
+            label: None,
+            command: Vec::new(),
+            sha256: Vec::new(),
+            allow_unverified: false,
+        }
+    }
+
+    #[test]
+    fn validate_rejects_bad_definitions() {
+        assert!(validate_adapters(&[def()]).is_ok());
+        assert_eq!(compile_all(&[def()]).len(), 1);
+
+        let err = validate_adapters(&[def(), def()]).expect_err("duplicate");
+        assert!(err.to_string().contains("duplicate"), "{err}");
+        let builtin = AdapterDef {
+            name: "codex".to_string(),
+            ..def()
+        };
+        assert!(validate_adapters(&[builtin]).is_err());
+        let no_states = AdapterDef {
+            running: Vec::new(),
+            ..def()
+        };
+        assert!(validate_adapters(&[no_states]).is_err());
+        let bad_regex = AdapterDef {
+            label: Some("(".to_string()),
+            ..def()
+        };
+        let err = validate_adapters(&[bad_regex]).expect_err("unbalanced");
+        assert!(err.to_string().contains("adapter devbot"), "{err}");
+    }
+
+    fn plugin(script: &str) -> AdapterDef {
+        AdapterDef {
+            running: Vec::new(),
+            command: vec!["sh".to_string(), "-c".to_string(), script.to_string()],
+            allow_unverified: true,
+            ..def()
+        }
+    }
+
+    fn snapshot(lines: &[&str]) -> PaneSnapshot {
+        PaneSnapshot {
+            pane_id: "%4".to_string(),
+            current_cmd: "devbot".to_string(),
+            capture_lines: lines.iter().map(|l| l.to_string()).collect(),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn plugins_classify_changed_panes() {
+        let script = r#"grep -q '"lines":\["ready' && echo '{"state":"waiting_input","label":"ship it","confidence":0.8}' || echo '{"state":"Running"}'"#;
+        let def = plugin(script);
+        assert!(validate_adapters(std::slice::from_ref(&def)).is_ok());
+        let mixed = AdapterDef {
+            running: vec!["x".to_string()],
+            ..def.clone()
+        };
+        assert!(validate_adapters(&[mixed]).is_err());
+
+        let adapters = compile_all(&[def]);
+        let mut verdicts = PluginVerdicts::default();
+        let (cached, jobs) = verdicts.plan(&adapters, &[snapshot(&["ready?"])]);
+        assert!(cached.is_empty());
+        assert_eq!(jobs.len(), 1);
+        let verdict = jobs[0].run();
+        assert_eq!(
+            verdict,
+            Verdict {
+                state: ActivityState::WaitingInput,
+                label: Some("ship it".to_string()),
+                confidence: 0.8,
+            }
+        );
+        verdicts.record(&jobs[0], verdict.clone());
+
+        let (cached, jobs) = verdicts.plan(&adapters, &[snapshot(&["ready?"])]);
+        assert!(jobs.is_empty(), "unchanged pane reuses the verdict");
+        assert_eq!(cached.get("%4"), Some(&verdict));
+        let (_, jobs) = verdicts.plan(&adapters, &[snapshot(&["working"])]);
+        assert_eq!(jobs[0].run().state, ActivityState::Running);
+    }
+
+    #[test]
+    fn broken_plugins_leave_panes_unknown() {
+        assert!(parse_verdict("not json").is_err());
+        assert!(parse_verdict(r#"{"state":"busy"}"#).is_err());
+        let adapters = compile_all(&[plugin("exit 3")]);
+        let (_, jobs) = PluginVerdicts::default().plan(&adapters, &[snapshot(&[])]);
+        assert_eq!(jobs[0].run().state, ActivityState::Unknown);
+    }
+
+    #[test]
+    fn plugins_run_only_with_matching_sha256() {
+        let dir = std::env::temp_dir().join(format!("agtmux-adapters-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("dir");
+        std::fs::set_permissions(&dir, std::fs::Permissions::from_mode(0o700)).expect("chmod");
+        let script = dir.join("classify.sh");
+        std::fs::write(&script, "echo '{\"state\":\"idle\"}'\n").expect("script");
+        std::fs::set_permissions(&script, std::fs::Permissions::from_mode(0o644)).expect("chmod");
+
+        let unpinned = AdapterDef {
+            running: Vec::new(),
+            command: vec!["sh".to_string(), script.display().to_string()],
+            ..def()
+        };
+        let err = validate_adapters(std::slice::from_ref(&unpinned)).expect_err("no pin");
+        assert!(err.to_string().contains("sha256"), "{err}");
+        let short = AdapterDef {
+            sha256: vec!["abc".to_string()],
+            ..unpinned.clone()
+        };
+        assert!(validate_adapters(&[short]).is_err());
+        let regex_pin = AdapterDef {
+            allow_unverified: true,
+            ..def()
+        };
+        assert!(validate_adapters(&[regex_pin]).is_err());
+
+        let sh = file_digest(&resolve_program("sh").expect("sh on PATH")).expect("readable");
+        let pins = vec![sh.to_uppercase(), file_digest(&script).expect("readable")];
+        let pinned = AdapterDef {
+            sha256: pins.clone(),
+            ..unpinned.clone()
+        };
+        assert!(validate_adapters(std::slice::from_ref(&pinned)).is_ok());
+        let run = |def: &AdapterDef| {
+            let adapters = compile_all(std::slice::from_ref(def));
+            let (_, jobs) = PluginVerdicts::default().plan(&adapters, &[snapshot(&[])]);
+            jobs[0].run().state
+        };
+        assert_eq!(run(&pinned), ActivityState::Idle);
+        let interpreter_only = AdapterDef {
+            sha256: vec![sh],
+            ..unpinned
+        };
+        assert_eq!(
+            run(&interpreter_only),
+            ActivityState::Unknown,
+            "the script is a file of the command and needs its own pin"
+        );
+
+        std::fs::set_permissions(&script, std::fs::Permissions::from_mode(0o666)).expect("chmod");
+        assert_eq!(run(&pinned), ActivityState::Unknown, "world-writable");
+        std::fs::set_permissions(&script, std::fs::Permissions::from_mode(0o644)).expect("chmod");
+        std::fs::write(&script, "echo '{\"state\":\"running\"}'\n").expect("script");
+        assert_eq!(run(&pinned), ActivityState::Unknown, "script changed");
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
@@ -0,0 +1,143 @@
+//! Aider chat titles: aider appends every session to
+//! `.aider.chat.history.md` in the directory it was started from, which is
+//! the git root by default. The first user message (`#### ...`, skipping
+//! `/add`-style commands) of the latest `# aider chat started at` section
+//! becomes the pane's `conversation_title`, as Claude custom titles and
+//! Codex thread names do.
+//!
+//! The file is only re-read when its mtime changes, and only its last
+//! `MAX_TAIL_BYTES`.
+
+use std::collections::HashMap;
+use std::io::{Read, Seek, SeekFrom};
+use std::path::{Path, PathBuf};
+use std::time::SystemTime;
+
+const HISTORY_FILE: &str = ".aider.chat.history.md";
+const SESSION_MARKER: &str = "# aider chat started at";
+/// Enough for the latest session of any realistic history.
+const MAX_TAIL_BYTES: u64 = 256 * 1024;
+/// Titles longer than this are cut at a char boundary.
+const MAX_TITLE_CHARS: usize = 80;
+
+/// Title of the latest chat session in a history file.
+pub fn latest_title(history: &str) -> Option<String> {
+    let session = history
+        .rfind(SESSION_MARKER)
+        .map_or(history, |at| &history[at..]);
+    let message = session.lines().find_map(|line| {
+        line.strip_prefix("#### ")
+            .map(str::trim)
+            .filter(|m| !m.is_empty() && !m.starts_with('/'))
+    })?;
+    Some(match message.char_indices().nth(MAX_TITLE_CHARS) {
+        Some((cut, _)) => format!("{}…", &message[..cut]),
+        None => message.to_string(),
+    })
+}
+
+/// History files read so far: path → (mtime, title).
+#[derive(Debug, Default)]
+pub struct AiderTitles {
+    files: HashMap<PathBuf, (SystemTime, Option<String>)>,
+}
+
+impl AiderTitles {
+    /// Title from the history file of the first of `dirs` (pane cwd, then
+    /// its git root) that has one.
+    pub fn title_for(&mut self, dirs: &[&str]) -> Option<String> {
+        let path = dirs
+            .iter()
+            .filter(|d| !d.is_empty())
+            .map(|d| Path::new(d).join(HISTORY_FILE))
+            .find(|p| p.is_file())?;
+        let modified = std::fs::metadata(&path).and_then(|m| m.modified()).ok()?;
+        if let Some((seen, title)) = self.files.get(&path)
+            && *seen == modified
+        {
+            return title.clone();
+        }
+        let title = read_tail(&path).ok().and_then(|text| latest_title(&text));
+        self.files.insert(path, (modified, title.clone()));
+        title
+    }
+
+    /// Forget files not seen for any pane in the last call round.
+    pub fn retain(&mut self, dirs: &[&str]) {
+        self.files.retain(|path, _| {
+            path.parent()
+                .is_some_and(|dir| dirs.iter().any(|d| Path::new(d) == dir))
+        });
+    }
+}
+
+fn read_tail(path: &Path) -> std::io::Result<String> {
+    let mut file = std::fs::File::open(path)?;
+    let len = file.metadata()?.len();
+    file.seek(SeekFrom::Start(len.saturating_sub(MAX_TAIL_BYTES)))?;
+    let mut bytes = Vec::new();
+    file.read_to_end(&mut bytes)?;
+    Ok(String::from_utf8_lossy(&bytes).into_owned())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const HISTORY: &str = "\
+# aider chat started at 2026-10-01 09:00:00
+
+> /usr/local/bin/aider --model sonnet
+> Aider v0.82.1
+
+#### fix the flaky login test
+
+Sure, here is the fix.
+
+# aider chat started at 2026-10-14 17:30:12
+
+> /usr/local/bin/aider
+#### /add src/billing.rs
+> Added src/billing.rs to the chat
+
+#### add proration to monthly invoices
+
+Ok.
+";
+
+    #[test]
+    fn takes_first_message_of_latest_session() {
+        assert_eq!(
+            latest_title(HISTORY).as_deref(),
+            Some("add proration to monthly invoices")
+        );
+        assert_eq!(
+            latest_title("# aider chat started at x\n> Aider v1\n"),
+            None
+        );
+        let long = format!("#### {}\n", "x".repeat(100));
+        assert_eq!(
+            latest_title(&long).map(|t| t.chars().count()),
+            Some(MAX_TITLE_CHARS + 1)
+        );
+    }
+
+    #[test]
+    fn reads_history_from_cwd_or_git_root() {
+        let root = std::env::temp_dir().join(format!("agtmux-aider-{}", std::process::id()));
+        let sub = root.join("src");
+        std::fs::create_dir_all(&sub).expect("mkdir");
+        std::fs::write(root.join(HISTORY_FILE), HISTORY).expect("write");
+        let (root_s, sub_s) = (root.to_str().expect("utf-8"), sub.to_str().expect("utf-8"));
+
+        let mut titles = AiderTitles::default();
+        assert_eq!(
+            titles.title_for(&[sub_s, root_s]).as_deref(),
+            Some("add proration to monthly invoices")
+        );
+        assert_eq!(titles.title_for(&[sub_s]), None);
+        titles.retain(&[sub_s]);
+        assert!(titles.files.is_empty());
+        std::fs::remove_dir_all(&root).expect("cleanup");
+    }
+}
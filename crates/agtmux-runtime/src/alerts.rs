@@ -0,0 +1,591 @@
+//! Alert rules (`[[alerts]]`): a managed pane staying in `state` for at
+//! least `for_secs` raises an alert, evaluated every poll_tick. Alerts are
+//! served by `alerts.list`, acknowledged with `alerts.ack`, and resolve by
+//! themselves once the pane leaves the state.
+//!
+//! Actions per rule, all optional: desktop notification (`notify`, same
+//! backends as `[notify]`), webhook (`webhook`, alert JSON POSTed with
+//! `curl`), Slack (`slack`, an incoming-webhook URL sent a one-line `text`),
+//! script (`script`, run with `sh -c`, alert JSON on stdin) and email
+//! (`email`, via the `[email]` section, see `email`).
+//!
+//! `debounce_secs` keeps a pane flapping in and out of `state` from
+//! repeating the actions: the alert is still listed, but its actions run at
+//! most once per window for each pane.
+
+use std::collections::HashMap;
+use std::io::Write;
+
+use agtmux_core_v5::types::{ActivityState, PanePresence, PaneRuntimeState};
+use agtmux_tmux_v5::TmuxPaneInfo;
+use chrono::{DateTime, Utc};
+
+use crate::email::{EmailSettings, Mail};
+use crate::notify::{Backend, Notice};
+use crate::tasks::TaskMeta;
+
+/// One `[[alerts]]` entry.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct AlertRule {
+    /// Unique rule name, reported on every alert it raises.
+    pub name: String,
+    /// Activity state that arms the rule.
+    pub state: ActivityState,
+    /// Seconds the pane must stay in `state` before the alert fires.
+    #[serde(default)]
+    pub for_secs: u64,
+    /// Only panes in this tmux session.
+    pub session: Option<String>,
+    /// Only panes of this provider (`claude`, `codex`, ...).
+    pub provider: Option<String>,
+    /// Show a desktop notification on the daemon host.
+    #[serde(default)]
+    pub notify: bool,
+    /// URL the alert JSON is POSTed to.
+    pub webhook: Option<String>,
+    /// Slack incoming-webhook URL, POSTed `{"text": "..."}`.
+    pub slack: Option<String>,
+    /// Shell command run with the alert JSON on stdin.
+    pub script: Option<String>,
+    /// Send mail through `[email]`.
+    #[serde(default)]
+    pub email: bool,
+    /// Run the actions at most once per pane within this many seconds.
+    #[serde(default)]
+    pub debounce_secs: u64,
+}
+
+impl AlertRule {
+    fn matches(&self, pane: &PaneRuntimeState, tmux: Option<&TmuxPaneInfo>) -> bool {
+        pane.presence == PanePresence::Managed
+            && pane.activity_state == self.state
+            && self
+                .session
+                .as_deref()
+                .is_none_or(|s| tmux.is_some_and(|t| t.session_name == s))
+            && self
+                .provider
+                .as_deref()
+                .is_none_or(|p| pane.provider.is_some_and(|q| q.as_str() == p))
+    }
+}
+
+/// Reject unnamed or duplicate rules.
+pub fn validate_rules(rules: &[AlertRule]) -> anyhow::Result<()> {
+    for (i, rule) in rules.iter().enumerate() {
+        if rule.name.trim().is_empty() {
+            anyhow::bail!("alerts[{i}].name must not be empty");
+        }
+        if rules[..i].iter().any(|r| r.name == rule.name) {
+            anyhow::bail!("duplicate alert rule name {:?}", rule.name);
+        }
+    }
+    Ok(())
+}
+
+/// A fired, not yet resolved alert.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Serialize)]
+pub struct Alert {
+    pub id: u64,
+    pub rule: String,
+    pub pane_id: String,
+    pub session_name: Option<String>,
+    pub provider: Option<String>,
+    pub state: ActivityState,
+    /// When the pane entered `state` (as first observed by the daemon).
+    pub since: DateTime<Utc>,
+    pub fired_at: DateTime<Utc>,
+    pub acked: bool,
+    /// Task metadata of the pane when the alert fired.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub task: Option<TaskMeta>,
+}
+
+/// Side effect of a newly fired alert; run off the lock via the exec pool.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum AlertAction {
+    Notify(Notice),
+    Webhook { url: String, body: String },
+    Script { command: String, body: String },
+    Email(Mail),
+}
+
+impl AlertAction {
+    /// Run the action (blocking); failures are logged, never fatal.
+    pub fn run(&self) {
+        match self {
+            Self::Notify(notice) => notice.send(),
+            Self::Webhook { url, body } => run_with_stdin(
+                "curl",
+                &[
+                    "-fsS",
+                    "-m",
+                    "10",
+                    "-X",
+                    "POST",
+                    "-H",
+                    "Content-Type: application/json",
+                    "--data-binary",
+                    "@-",
+                    url,
+                ],
+                body,
+            ),
+            Self::Script { command, body } => run_with_stdin("sh", &["-c", command], body),
+            Self::Email(mail) => {
+                let args = mail.curl_args();
+                let args: Vec<&str> = args.iter().map(String::as_str).collect();
+                run_with_stdin("curl", &args, &mail.message());
+            }
+        }
+    }
+}
+
+fn run_with_stdin(program: &str, args: &[&str], input: &str) {
+    let child = std::process::Command::new(program)
+        .args(args)
+        .stdin(std::process::Stdio::piped())
+        .stdout(std::process::Stdio::null())
+        .stderr(std::process::Stdio::null())
+        .spawn();
+    let mut child = match child {
+        Ok(child) => child,
+        Err(e) => {
+            tracing::warn!("alert action {program} failed to start: {e}");
+            return;
+        }
+    };
+    if let Some(mut stdin) = child.stdin.take() {
+        // A script that ignores stdin may close it early; not an error.
+        let _ = stdin.write_all(input.as_bytes());
+    }
+    match child.wait() {
+        Ok(s) if s.success() => {}
+        Ok(s) => tracing::warn!("alert action {program} exited with {s}"),
+        Err(e) => tracing::warn!("alert action {program} failed: {e}"),
+    }
+}
+
+/// `pane %1 WaitingApproval for 120s — task: ...`
+fn describe(rule: &AlertRule, alert: &Alert) -> String {
+    format!(
+        "pane {} {:?} for {}s{}",
+        alert.pane_id,
+        alert.state,
+        rule.for_secs,
+        alert
+            .task
+            .as_ref()
+            .map(|t| format!(" — task: {}", t.summary()))
+            .unwrap_or_default()
+    )
+}
+
+/// Evaluates the rules against the pane states of each tick.
+#[derive(Debug, Default)]
+pub struct AlertEngine {
+    rules: Vec<AlertRule>,
+    backend: Option<Backend>,
+    next_id: u64,
+    alerts: Vec<Alert>,
+    /// Pane id → (current state, first tick seen in it).
+    entered: HashMap<String, (ActivityState, DateTime<Utc>)>,
+    email: EmailSettings,
+    /// Alerts waiting for the next digest mail, and when the first arrived.
+    digest: Vec<Alert>,
+    digest_started: Option<DateTime<Utc>>,
+    /// (rule, pane id) → when its actions last ran, for `debounce_secs`.
+    last_run: HashMap<(String, String), DateTime<Utc>>,
+}
+
+impl AlertEngine {
+    pub fn new(rules: Vec<AlertRule>, email: EmailSettings) -> Self {
+        let mut engine = Self {
+            next_id: 1,
+            ..Self::default()
+        };
+        engine.set_rules(rules, email);
+        engine
+    }
+
+    /// Replace the rules and mail settings (SIGHUP); alerts of removed rules
+    /// are dropped. A pending digest is kept.
+    pub fn set_rules(&mut self, rules: Vec<AlertRule>, email: EmailSettings) {
+        self.email = email;
+        self.backend = if rules.iter().any(|r| r.notify) {
+            let backend = Backend::detect();
+            if backend.is_none() {
+                tracing::warn!("alert rules use notify but no notification command was found");
+            }
+            backend
+        } else {
+            None
+        };
+        self.alerts
+            .retain(|a| rules.iter().any(|r| r.name == a.rule));
+        self.last_run
+            .retain(|(rule, _), _| rules.iter().any(|r| &r.name == rule));
+        self.rules = rules;
+    }
+
+    /// Update pane states, resolve alerts whose condition cleared and fire
+    /// new ones. Returns the actions of the alerts fired by this call.
+    pub fn evaluate(
+        &mut self,
+        panes: &[&PaneRuntimeState],
+        tmux: &[TmuxPaneInfo],
+        tasks: &HashMap<String, TaskMeta>,
+        now: DateTime<Utc>,
+    ) -> Vec<AlertAction> {
+        let mut entered = HashMap::with_capacity(panes.len());
+        for pane in panes {
+            let pane_id = &pane.pane_instance_id.pane_id;
+            let state = pane.activity_state;
+            let since = match self.entered.get(pane_id) {
+                Some((previous, since)) if *previous == state => *since,
+                _ => now,
+            };
+            entered.insert(pane_id.clone(), (state, since));
+        }
+        self.entered = entered;
+        self.alerts.retain(|a| {
+            self.entered
+                .get(&a.pane_id)
+                .is_some_and(|(state, since)| *state == a.state && *since == a.since)
+        });
+
+        let mut actions = Vec::new();
+        for rule in &self.rules {
+            for pane in panes {
+                let pane_id = &pane.pane_instance_id.pane_id;
+                let info = tmux.iter().find(|t| &t.pane_id == pane_id);
+                let Some(&(_, since)) = self.entered.get(pane_id) else {
+                    continue;
+                };
+                let held = (now - since).num_seconds().max(0) as u64;
+                if held < rule.for_secs
+                    || !rule.matches(pane, info)
+                    || self
+                        .alerts
+                        .iter()
+                        .any(|a| a.rule == rule.name && &a.pane_id == pane_id)
+                {
+                    continue;
+                }
+                let alert = Alert {
+                    id: self.next_id,
+                    rule: rule.name.clone(),
+                    pane_id: pane_id.clone(),
+                    session_name: info.map(|t| t.session_name.clone()),
+                    provider: pane.provider.map(|p| p.as_str().to_string()),
+                    state: pane.activity_state,
+                    since,
+                    fired_at: now,
+                    acked: false,
+                    task: tasks.get(pane_id).cloned(),
+                };
+                self.next_id += 1;
+                let key = (rule.name.clone(), pane_id.clone());
+                if self
+                    .last_run
+                    .get(&key)
+                    .is_some_and(|last| (now - *last).num_seconds() < rule.debounce_secs as i64)
+                {
+                    tracing::debug!(
+                        "alert {} on {pane_id} debounced; actions skipped",
+                        rule.name
+                    );
+                    self.alerts.push(alert);
+                    continue;
+                }
+                if rule.debounce_secs > 0 {
+                    self.last_run.insert(key, now);
+                }
+                actions.extend(self.actions_for(rule, &alert));
+                if rule.email {
+                    if self.email.digest_secs.is_some() {
+                        self.digest_started.get_or_insert(now);
+                        self.digest.push(alert.clone());
+                    } else {
+                        actions.extend(self.email.mail_for(&alert, now).map(AlertAction::Email));
+                    }
+                }
+                self.alerts.push(alert);
+            }
+        }
+        if let (Some(started), Some(window)) = (self.digest_started, self.email.digest_secs)
+            && (now - started).num_seconds() >= window as i64
+        {
+            let digest = std::mem::take(&mut self.digest);
+            self.digest_started = None;
+            actions.extend(self.email.digest_for(&digest, now).map(AlertAction::Email));
+        }
+        actions
+    }
+
+    fn actions_for(&self, rule: &AlertRule, alert: &Alert) -> Vec<AlertAction> {
+        let mut actions = Vec::new();
+        if rule.notify
+            && let Some(backend) = self.backend
+        {
+            actions.push(AlertAction::Notify(Notice {
+                backend,
+                title: format!("agtmux alert: {}", rule.name),
+                body: describe(rule, alert),
+            }));
+        }
+        let body = serde_json::to_string(alert).unwrap_or_default();
+        if let Some(url) = &rule.webhook {
+            actions.push(AlertAction::Webhook {
+                url: url.clone(),
+                body: body.clone(),
+            });
+        }
+        if let Some(url) = &rule.slack {
+            let pane = match &alert.session_name {
+                Some(session) => format!("{session} "),
+                None => String::new(),
+            };
+            let text = format!(
+                "agtmux alert {}: {pane}{}",
+                rule.name,
+                describe(rule, alert)
+            );
+            actions.push(AlertAction::Webhook {
+                url: url.clone(),
+                body: serde_json::json!({ "text": text }).to_string(),
+            });
+        }
+        if let Some(command) = &rule.script {
+            actions.push(AlertAction::Script {
+                command: command.clone(),
+                body,
+            });
+        }
+        actions
+    }
+
+    /// Unresolved alerts, oldest first.
+    pub fn alerts(&self) -> &[Alert] {
+        &self.alerts
+    }
+
+    /// Acknowledge alert `id`; None if it does not exist (or resolved).
+    pub fn ack(&mut self, id: u64) -> Option<&Alert> {
+        let alert = self.alerts.iter_mut().find(|a| a.id == id)?;
+        alert.acked = true;
+        Some(alert)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support::pane;
+    use chrono::Duration;
+
+    fn rule() -> AlertRule {
+        AlertRule {
+            name: "approval-stuck".to_string(),
+            state: ActivityState::WaitingApproval,
+            for_secs: 60,
+            session: Some("work".to_string()),
+            provider: Some("claude".to_string()),
+            notify: false,
+            webhook: Some("http://localhost/hook".to_string()),
+            slack: None,
+            script: None,
+            email: false,
+            debounce_secs: 0,
+        }
+    }
+
+    #[test]
+    fn fires_after_duration_acks_and_resolves() {
+        let mut engine = AlertEngine::new(vec![rule()], EmailSettings::default());
+        let tmux = vec![
+            TmuxPaneInfo {
+                pane_id: "%1".to_string(),
+                session_name: "work".to_string(),
+                ..Default::default()
+            },
+            TmuxPaneInfo {
+                pane_id: "%2".to_string(),
+                session_name: "other".to_string(),
+                ..Default::default()
+            },
+        ];
+        let waiting = pane("%1", ActivityState::WaitingApproval);
+        let elsewhere = pane("%2", ActivityState::WaitingApproval);
+        let t0 = Utc::now();
+
+        assert!(
+            engine
+                .evaluate(&[&waiting, &elsewhere], &tmux, &HashMap::new(), t0)
+                .is_empty()
+        );
+        let later = t0 + Duration::seconds(30);
+        assert!(
+            engine
+                .evaluate(&[&waiting, &elsewhere], &tmux, &HashMap::new(), later)
+                .is_empty()
+        );
+
+        let fired = t0 + Duration::seconds(60);
+        let actions = engine.evaluate(&[&waiting, &elsewhere], &tmux, &HashMap::new(), fired);
+        assert_eq!(actions.len(), 1, "session filter excludes %2");
+        let AlertAction::Webhook { url, body } = &actions[0] else {
+            panic!("webhook action expected: {actions:?}");
+        };
+        assert_eq!(url, "http://localhost/hook");
+        assert!(body.contains("\"rule\":\"approval-stuck\""), "{body}");
+
+        let alerts = engine.alerts();
+        assert_eq!(alerts.len(), 1);
+        assert_eq!(alerts[0].pane_id, "%1");
+        assert_eq!(alerts[0].since, t0);
+        let id = alerts[0].id;
+
+        let again = fired + Duration::seconds(5);
+        assert!(
+            engine
+                .evaluate(&[&waiting], &tmux, &HashMap::new(), again)
+                .is_empty(),
+            "once"
+        );
+        assert!(engine.ack(id).is_some_and(|a| a.acked));
+        assert!(engine.ack(id + 100).is_none());
+
+        let running = pane("%1", ActivityState::Running);
+        engine.evaluate(&[&running], &tmux, &HashMap::new(), again);
+        assert!(engine.alerts().is_empty(), "resolved on leaving the state");
+    }
+
+    #[test]
+    fn email_alerts_batched_into_digest() {
+        let email = EmailSettings {
+            smtp_url: Some("smtp://mail.local".to_string()),
+            from: Some("agtmux@host".to_string()),
+            to: vec!["me@host".to_string()],
+            digest_secs: Some(300),
+            ..EmailSettings::default()
+        };
+        let rule = AlertRule {
+            for_secs: 0,
+            session: None,
+            webhook: None,
+            email: true,
+            ..rule()
+        };
+        let mut engine = AlertEngine::new(vec![rule], email);
+        let t0 = Utc::now();
+        let first = pane("%1", ActivityState::WaitingApproval);
+        let second = pane("%2", ActivityState::WaitingApproval);
+
+        assert!(
+            engine
+                .evaluate(&[&first], &[], &HashMap::new(), t0)
+                .is_empty(),
+            "batched"
+        );
+        let t1 = t0 + Duration::seconds(100);
+        assert!(
+            engine
+                .evaluate(&[&first, &second], &[], &HashMap::new(), t1)
+                .is_empty()
+        );
+        assert_eq!(engine.alerts().len(), 2);
+
+        let actions = engine.evaluate(
+            &[&first, &second],
+            &[],
+            &HashMap::new(),
+            t0 + Duration::seconds(300),
+        );
+        let [AlertAction::Email(mail)] = actions.as_slice() else {
+            panic!("one digest mail expected: {actions:?}");
+        };
+        assert_eq!(mail.subject, "agtmux: 2 alert(s)");
+        assert!(
+            engine
+                .evaluate(
+                    &[&first, &second],
+                    &[],
+                    &HashMap::new(),
+                    t0 + Duration::seconds(900)
+                )
+                .is_empty(),
+            "digest flushed"
+        );
+    }
+
+    #[test]
+    fn debounce_skips_actions_of_flapping_panes() {
+        let rule = AlertRule {
+            for_secs: 0,
+            session: None,
+            webhook: None,
+            slack: Some("https://hooks.slack.com/services/T/B/x".to_string()),
+            debounce_secs: 60,
+            ..rule()
+        };
+        let mut engine = AlertEngine::new(vec![rule], EmailSettings::default());
+        let waiting = pane("%1", ActivityState::WaitingApproval);
+        let running = pane("%1", ActivityState::Running);
+        let tmux = vec![TmuxPaneInfo {
+            pane_id: "%1".to_string(),
+            session_name: "work".to_string(),
+            ..Default::default()
+        }];
+        let t0 = Utc::now();
+
+        let actions = engine.evaluate(&[&waiting], &tmux, &HashMap::new(), t0);
+        let [AlertAction::Webhook { url, body }] = actions.as_slice() else {
+            panic!("one slack post expected: {actions:?}");
+        };
+        assert!(url.starts_with("https://hooks.slack.com/"));
+        let body: serde_json::Value = serde_json::from_str(body).expect("json");
+        assert_eq!(
+            body["text"],
+            "agtmux alert approval-stuck: work pane %1 WaitingApproval for 0s"
+        );
+
+        let t1 = t0 + Duration::seconds(10);
+        engine.evaluate(&[&running], &tmux, &HashMap::new(), t1);
+        let t2 = t0 + Duration::seconds(20);
+        assert!(
+            engine
+                .evaluate(&[&waiting], &tmux, &HashMap::new(), t2)
+                .is_empty(),
+            "within the debounce window"
+        );
+        assert_eq!(engine.alerts().len(), 1, "still listed");
+
+        engine.evaluate(
+            &[&running],
+            &tmux,
+            &HashMap::new(),
+            t0 + Duration::seconds(30),
+        );
+        let t3 = t0 + Duration::seconds(70);
+        assert_eq!(
+            engine
+                .evaluate(&[&waiting], &tmux, &HashMap::new(), t3)
+                .len(),
+            1
+        );
+    }
+
+    #[test]
+    fn validate_rejects_duplicate_and_unnamed_rules() {
+        assert!(validate_rules(&[rule()]).is_ok());
+        let err = validate_rules(&[rule(), rule()]).expect_err("duplicate");
+        assert!(err.to_string().contains("duplicate"), "{err}");
+        let unnamed = AlertRule {
+            name: " ".to_string(),
+            ..rule()
+        };
+        assert!(validate_rules(&[unnamed]).is_err());
+    }
+}
@@ -0,0 +1,337 @@
+//! Action audit trail (`actions.history`, remote `GET /v1/audit`): every
+//! pane action, group write and macro run is recorded with who called it,
+//! which panes it touched, what it typed or ran and how it ended, for
+//! post-incident review across panes.
+//!
+//! The trail is in-memory (like the rest of the state) and keeps the last
+//! [`CAPACITY`] entries; a daemon restart starts it empty. `request_ref`
+//! replays are recorded too, marked `replayed`.
+
+use std::collections::VecDeque;
+
+use chrono::{DateTime, Duration, Utc};
+use serde_json::Value;
+
+/// Entries kept.
+pub const CAPACITY: usize = 1000;
+/// Entries returned when the query has no `limit`.
+pub const DEFAULT_LIMIT: usize = 100;
+
+/// Params copied into `detail`: what was typed, run or forced.
+const DETAIL_KEYS: &[&str] = &[
+    "text",
+    "key",
+    "enter",
+    "name",
+    "agent",
+    "prompt",
+    "command",
+    "force",
+    "session",
+    "state",
+    "if_state",
+    "window",
+    "scheduled",
+    "from_step",
+];
+
+/// Who made a call.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Serialize)]
+pub struct Actor {
+    pub uid: u32,
+    pub pid: Option<i32>,
+    /// `meta.client` of the request (`agtmux/0.9.0`).
+    pub client: Option<String>,
+    /// `[[access.tokens]]` name, if the caller sent a token.
+    pub token: Option<String>,
+}
+
+/// One recorded call.
+#[derive(Debug, Clone, PartialEq, serde::Serialize)]
+pub struct AuditEntry {
+    pub id: u64,
+    pub at: DateTime<Utc>,
+    pub method: String,
+    pub actor: Actor,
+    /// Pane ids named by the request or reached by the action.
+    pub targets: Vec<String>,
+    pub group: Option<String>,
+    pub detail: serde_json::Map<String, Value>,
+    pub ok: bool,
+    /// Error message of a failed call.
+    pub error: Option<String>,
+    pub request_ref: Option<String>,
+    pub replayed: bool,
+}
+
+impl AuditEntry {
+    /// Build an entry from a call's params and outcome.
+    pub fn new(
+        method: &str,
+        actor: Actor,
+        params: &Value,
+        outcome: Result<&Value, String>,
+    ) -> Self {
+        let mut targets: Vec<String> = Vec::new();
+        let mut add = |id: &Value| {
+            if let Some(id) = id.as_str().filter(|id| !id.is_empty())
+                && !targets.iter().any(|t| t == id)
+            {
+                targets.push(id.to_string());
+            }
+        };
+        add(&params["pane_id"]);
+        params["pane_ids"]
+            .as_array()
+            .into_iter()
+            .flatten()
+            .for_each(&mut add);
+        if let Ok(result) = &outcome {
+            add(&result["pane_id"]);
+            result["panes"]
+                .as_array()
+                .into_iter()
+                .flatten()
+                .for_each(&mut add);
+            for pane_id in result["failed"]
+                .as_object()
+                .into_iter()
+                .flat_map(|f| f.keys())
+            {
+                add(&Value::String(pane_id.clone()));
+            }
+        }
+        let detail = DETAIL_KEYS
+            .iter()
+            .filter(|key| !params[**key].is_null())
+            .map(|key| (key.to_string(), params[*key].clone()))
+            .collect();
+        let replayed = outcome
+            .as_ref()
+            .is_ok_and(|result| result["replayed"].as_bool() == Some(true));
+        Self {
+            id: 0,
+            at: Utc::now(),
+            method: method.to_string(),
+            actor,
+            targets,
+            group: params["group"].as_str().map(String::from),
+            detail,
+            ok: outcome.is_ok(),
+            error: outcome.err(),
+            request_ref: params["request_ref"].as_str().map(String::from),
+            replayed,
+        }
+    }
+}
+
+/// `actions.history` filter; unset criteria match everything.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct AuditQuery {
+    pub since: Option<DateTime<Utc>>,
+    /// Pane id among the entry's targets.
+    pub target: Option<String>,
+    /// Exact method (`pane.send`) or prefix ending in `*` (`group.*`).
+    pub action_type: Option<String>,
+    pub limit: usize,
+}
+
+impl AuditQuery {
+    /// From `since` (RFC 3339 or an age like `30m`, `2h`, `1d`), `target`,
+    /// `action_type` and `limit` params.
+    pub fn from_params(params: &Value, now: DateTime<Utc>) -> Result<Self, String> {
+        let since = params["since"]
+            .as_str()
+            .filter(|s| !s.is_empty())
+            .map(|s| parse_since(s, now))
+            .transpose()?;
+        let limit = match &params["limit"] {
+            Value::Null => DEFAULT_LIMIT,
+            limit => limit
+                .as_u64()
+                .filter(|n| *n > 0)
+                .ok_or_else(|| format!("limit must be a positive integer, got {limit}"))?
+                as usize,
+        };
+        let string = |key: &str| {
+            params[key]
+                .as_str()
+                .filter(|s| !s.is_empty())
+                .map(String::from)
+        };
+        Ok(Self {
+            since,
+            target: string("target"),
+            action_type: string("action_type"),
+            limit: limit.min(CAPACITY),
+        })
+    }
+
+    fn matches(&self, entry: &AuditEntry) -> bool {
+        self.since.is_none_or(|since| entry.at >= since)
+            && self
+                .target
+                .as_deref()
+                .is_none_or(|target| entry.targets.iter().any(|t| t == target))
+            && self
+                .action_type
+                .as_deref()
+                .is_none_or(|t| match t.strip_suffix('*') {
+                    Some(prefix) => entry.method.starts_with(prefix),
+                    None => entry.method == t,
+                })
+    }
+}
+
+/// RFC 3339 time, or an age before `now` (`90s`, `30m`, `2h`, `1d`).
+pub fn parse_since(s: &str, now: DateTime<Utc>) -> Result<DateTime<Utc>, String> {
+    if let Ok(at) = DateTime::parse_from_rfc3339(s) {
+        return Ok(at.with_timezone(&Utc));
+    }
+    parse_age(s)
+        .map(|age| now - age)
+        .ok_or_else(|| format!("since must be RFC 3339 or an age like 30m / 2h / 1d, got {s:?}"))
+}
+
+/// A non-negative duration written as `90s`, `30m`, `2h` or `1d`.
+pub fn parse_age(s: &str) -> Option<Duration> {
+    let (split, _) = s.char_indices().last()?;
+    let amount: i64 = s[..split].parse().ok()?;
+    let age = match &s[split..] {
+        "s" => Duration::try_seconds(amount),
+        "m" => Duration::try_minutes(amount),
+        "h" => Duration::try_hours(amount),
+        "d" => Duration::try_days(amount),
+        _ => None,
+    };
+    age.filter(|age| *age >= Duration::zero())
+}
+
+#[derive(Debug, Default)]
+pub struct AuditLog {
+    next_id: u64,
+    entries: VecDeque<AuditEntry>,
+}
+
+impl AuditLog {
+    pub fn record(&mut self, mut entry: AuditEntry) {
+        self.next_id += 1;
+        entry.id = self.next_id;
+        tracing::info!(
+            method = entry.method,
+            targets = ?entry.targets,
+            peer_uid = entry.actor.uid,
+            token = ?entry.actor.token,
+            ok = entry.ok,
+            "audit"
+        );
+        if self.entries.len() == CAPACITY {
+            self.entries.pop_front();
+        }
+        self.entries.push_back(entry);
+    }
+
+    /// The newest `query.limit` matching entries, oldest first.
+    pub fn query(&self, query: &AuditQuery) -> Vec<&AuditEntry> {
+        let mut matching: Vec<&AuditEntry> = self
+            .entries
+            .iter()
+            .rev()
+            .filter(|e| query.matches(e))
+            .take(query.limit)
+            .collect();
+        matching.reverse();
+        matching
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn actor() -> Actor {
+        Actor {
+            uid: 1000,
+            pid: Some(42),
+            client: Some("agtmux/test".to_string()),
+            token: None,
+        }
+    }
+
+    #[test]
+    fn entries_capture_targets_detail_and_outcome() {
+        let params = json!({"pane_ids": ["%1", "%2"], "text": "yes", "request_ref": "r1"});
+        let result = json!({"panes": ["%1"], "failed": {"%2": "gone"}, "replayed": false});
+        let entry = AuditEntry::new("pane.send", actor(), &params, Ok(&result));
+        assert_eq!(entry.targets, ["%1", "%2"]);
+        assert_eq!(entry.detail["text"], "yes");
+        assert!(!entry.detail.contains_key("pane_ids"));
+        assert_eq!(entry.request_ref.as_deref(), Some("r1"));
+        assert!(entry.ok && !entry.replayed);
+
+        let params = json!({"pane_id": "%3", "force": false});
+        let entry = AuditEntry::new("pane.kill", actor(), &params, Err("busy".to_string()));
+        assert_eq!(entry.targets, ["%3"]);
+        assert_eq!((entry.ok, entry.error.as_deref()), (false, Some("busy")));
+
+        let params = json!({"group": "api", "text": "go"});
+        let result = json!({"panes": ["%4"], "replayed": true});
+        let entry = AuditEntry::new("group.send", actor(), &params, Ok(&result));
+        assert_eq!(entry.group.as_deref(), Some("api"));
+        assert!(entry.replayed);
+    }
+
+    #[test]
+    fn queries_filter_and_limit() {
+        let mut log = AuditLog::default();
+        for (method, pane) in [
+            ("pane.send", "%1"),
+            ("pane.kill", "%2"),
+            ("group.send", "%1"),
+        ] {
+            let params = json!({"pane_id": pane});
+            log.record(AuditEntry::new(method, actor(), &params, Ok(&json!({}))));
+        }
+        let now = Utc::now();
+        let methods = |query: AuditQuery| -> Vec<String> {
+            log.query(&query).iter().map(|e| e.method.clone()).collect()
+        };
+        let all = AuditQuery::from_params(&json!({}), now).expect("query");
+        assert_eq!(methods(all), ["pane.send", "pane.kill", "group.send"]);
+        let query =
+            AuditQuery::from_params(&json!({"target": "%1", "since": "1h"}), now).expect("query");
+        assert_eq!(methods(query), ["pane.send", "group.send"]);
+        let query = AuditQuery::from_params(&json!({"action_type": "pane.*", "limit": 1}), now)
+            .expect("query");
+        assert_eq!(methods(query), ["pane.kill"]);
+        let future = (now + Duration::hours(1)).to_rfc3339();
+        let query = AuditQuery::from_params(&json!({"since": future}), now).expect("query");
+        assert!(methods(query).is_empty());
+        assert_eq!(
+            log.query(&AuditQuery {
+                limit: 10,
+                ..Default::default()
+            })[2]
+                .id,
+            3
+        );
+
+        assert!(AuditQuery::from_params(&json!({"since": "yesterday"}), now).is_err());
+        assert!(AuditQuery::from_params(&json!({"limit": 0}), now).is_err());
+    }
+
+    #[test]
+    fn parses_since_ages() {
+        let now = Utc::now();
+        assert_eq!(parse_since("30m", now), Ok(now - Duration::minutes(30)));
+        assert_eq!(parse_since("2d", now), Ok(now - Duration::days(2)));
+        assert_eq!(
+            parse_since("2026-01-02T03:04:05Z", now).map(|t| t.to_rfc3339()),
+            Ok("2026-01-02T03:04:05+00:00".to_string())
+        );
+        assert!(parse_since("-5m", now).is_err());
+        assert!(parse_since("5w", now).is_err());
+        assert!(parse_since("", now).is_err());
+    }
+}
@@ -10,10 +10,26 @@ use clap::{Parser, Subcommand};
     arg_required_else_help = false
 )]
 pub struct Cli {
-    /// UDS socket path (default: /tmp/agtmux-$USER/agtmuxd.sock)
+    /// UDS socket path (default: $XDG_RUNTIME_DIR/agtmux/agtmuxd.sock or /tmp/agtmux-$USER/agtmuxd.sock)
     #[arg(long, short = 's', global = true)]
     pub socket_path: Option<String>,
 
+    /// Log RPC calls (method, duration, status) to stderr; repeat for trace (-vv)
+    #[arg(long, short = 'v', global = true, action = clap::ArgAction::Count)]
+    pub verbose: u8,
+
+    /// Suppress progress and log output (errors are still reported)
+    #[arg(long, short = 'q', global = true, conflicts_with = "verbose")]
+    pub quiet: bool,
+
+    /// Log filter directive, e.g. "debug" or "agtmux=trace" (overrides -v/-q)
+    #[arg(long, global = true)]
+    pub log_level: Option<String>,
+
+    /// Report errors on stderr as JSON: {"error": {"code", "message", "rpc_code"}}
+    #[arg(long, global = true)]
+    pub json: bool,
+
     #[command(subcommand)]
     pub command: Option<Command>,
 }
@@ -30,45 +46,111 @@ pub enum Command {
     Pick(PickOpts),
     /// Watch agent state changes in real-time (T-139c)
     Watch(WatchOpts),
+    /// Full-screen dashboard: agent tree with attach / send / kill keys
+    Dash(DashOpts),
     /// Wait for agent state condition (T-139d)
     Wait(WaitOpts),
+    /// Stream ingested source events (hooks, App Server, poller) as NDJSON
+    Events(EventsOpts),
     /// Machine-readable JSON output (T-139d)
     Json(JsonOpts),
     /// Configure Claude Code hooks for agtmux integration
     SetupHooks(SetupHooksOpts),
+    /// Set, clear, or list user-assigned pane labels
+    Label(LabelOpts),
+    /// Attach task metadata (title, ticket URL, owner, tags) to panes
+    Task(TaskOpts),
+    /// Create, split, kill or respawn tmux panes through the daemon
+    Pane(PaneOpts),
+    /// List or run the daemon's `[[macros]]`
+    Macro(MacroOpts),
+    /// Auto-responder audit trail and kill switch
+    Responder(ResponderOpts),
+    /// Named pane groups: list, edit, broadcast text, kill
+    Group(GroupOpts),
+    /// Find the panes whose recent output contains a string
+    Grep(GrepOpts),
+    /// Pane output kept on disk by the daemon's `[recorder]`
+    Recording(RecordingOpts),
+    /// Serve agtmux as MCP tools on stdio (list, view output, send, attach, kill, wait)
+    Mcp,
+    /// Create and list `[access]` tokens for scoped daemon clients
+    Token(TokenOpts),
 }
 
-#[derive(clap::Args)]
+#[derive(clap::Args, Clone)]
 pub struct DaemonOpts {
-    /// Poll interval in milliseconds
-    #[arg(long, default_value = "1000")]
-    pub poll_interval_ms: u64,
+    /// Config file (default: ~/.config/agtmux/agtmuxd.toml)
+    #[arg(long)]
+    pub config: Option<std::path::PathBuf>,
+
+    /// Validate the config (file, env, flags) and exit: 0 if OK, 1 with every problem
+    #[arg(long)]
+    pub check_config: bool,
+
+    /// Print the effective config with the source of each value and exit
+    #[arg(long, conflicts_with = "check_config")]
+    pub print_config: bool,
+
+    /// Poll interval in milliseconds [default: 1000]
+    #[arg(long)]
+    pub poll_interval_ms: Option<u64>,
 
     /// tmux socket path
     #[arg(long)]
     pub tmux_socket: Option<String>,
+
+    /// Serve the REST API for remote dashboards, e.g. tcp://127.0.0.1:7300 (see `[remote]`)
+    #[arg(long)]
+    pub listen: Option<String>,
 }
 
-#[derive(clap::Args, Default)]
+#[derive(clap::Args)]
 pub struct LsOpts {
     /// Grouping: tree (default), session, pane
     #[arg(long, default_value = "tree")]
     pub group: String,
 
     /// Color output: always, never, auto
-    #[arg(long, default_value = "auto")]
+    #[arg(long, default_value = "auto", env = "AGTMUX_COLOR")]
     pub color: String,
 
     /// Show Nerd Font icons (requires Nerd Font)
     #[arg(long)]
     pub icons: bool,
+
+    /// Flat view with selected columns, e.g. pane,state,agent,title,age
+    /// (location, pane, marker, agent, state, title, task, branch, path, age)
+    #[arg(long)]
+    pub columns: Option<String>,
+
+    /// Timestamp format: relative, absolute, iso
+    #[arg(long, default_value = "relative")]
+    pub time: String,
+}
+
+/// Mirrors the clap defaults so bare `agtmux` behaves like `agtmux ls`.
+impl Default for LsOpts {
+    fn default() -> Self {
+        Self {
+            group: "tree".to_string(),
+            color: std::env::var("AGTMUX_COLOR").unwrap_or_else(|_| "auto".to_string()),
+            icons: false,
+            columns: None,
+            time: "relative".to_string(),
+        }
+    }
 }
 
 #[derive(clap::Args)]
 pub struct BarOpts {
-    /// Output tmux color codes (#[fg=...]) instead of ANSI
+    /// Output tmux color codes (#[fg=...]) instead of ANSI (same as --format tmux)
     #[arg(long)]
     pub tmux: bool,
+
+    /// Output format: ansi, tmux, waybar (JSON for waybar / xbar / SwiftBar)
+    #[arg(long, conflicts_with = "tmux", value_parser = ["ansi", "tmux", "waybar"])]
+    pub format: Option<String>,
 }
 
 #[derive(clap::Args)]
@@ -82,8 +164,50 @@ pub struct PickOpts {
     pub waiting: bool,
 
     /// Color output: always, never, auto
-    #[arg(long, default_value = "auto")]
+    #[arg(long, default_value = "auto", env = "AGTMUX_COLOR")]
     pub color: String,
+
+    /// Timestamp format: relative, absolute, iso
+    #[arg(long, default_value = "relative")]
+    pub time: String,
+}
+
+#[derive(clap::Args)]
+pub struct DashOpts {
+    /// Redraw interval in seconds (relative times; refetch without `watch`)
+    #[arg(long, default_value = "2")]
+    pub interval: u64,
+
+    /// Color output: always, never, auto
+    #[arg(long, default_value = "auto", env = "AGTMUX_COLOR")]
+    pub color: String,
+
+    /// Timestamp format: relative, absolute, iso
+    #[arg(long, default_value = "relative")]
+    pub time: String,
+}
+
+#[derive(clap::Args)]
+pub struct EventsOpts {
+    /// Only events for this pane (id or selector)
+    #[arg(long)]
+    pub pane: Option<String>,
+
+    /// Only from these sources: claude_hooks, codex_appserver, claude_jsonl, poller
+    #[arg(long, value_delimiter = ',')]
+    pub source: Vec<String>,
+
+    /// Only these event types; a trailing `*` matches a prefix (`lifecycle.*`)
+    #[arg(long = "type", value_delimiter = ',')]
+    pub event_type: Vec<String>,
+
+    /// Only events of this agent (claude, codex, ...)
+    #[arg(long)]
+    pub agent: Option<String>,
+
+    /// Resume after this event `seq` instead of starting with new events
+    #[arg(long)]
+    pub since: Option<u64>,
 }
 
 #[derive(clap::Args)]
@@ -97,8 +221,16 @@ pub struct WatchOpts {
     pub interval: u64,
 
     /// Color output: always, never, auto
-    #[arg(long, default_value = "auto")]
+    #[arg(long, default_value = "auto", env = "AGTMUX_COLOR")]
     pub color: String,
+
+    /// Flat view with selected columns (same names as `ls --columns`)
+    #[arg(long)]
+    pub columns: Option<String>,
+
+    /// Timestamp format: relative, absolute, iso
+    #[arg(long, default_value = "relative")]
+    pub time: String,
 }
 
 #[derive(clap::Args)]
@@ -112,16 +244,12 @@ pub struct WaitOpts {
     pub no_waiting: bool,
 
     /// Scope to specific session
-    #[arg(long, short = 's')]
+    #[arg(long)]
     pub session: Option<String>,
 
     /// Timeout in seconds
     #[arg(long)]
     pub timeout: Option<u64>,
-
-    /// Suppress progress output
-    #[arg(long)]
-    pub quiet: bool,
 }
 
 #[derive(clap::Args)]
@@ -142,11 +270,490 @@ pub struct SetupHooksOpts {
     pub hook_script: Option<String>,
 }
 
-/// Default socket path using $USER for per-user isolation.
+#[derive(clap::Args)]
+pub struct LabelOpts {
+    #[command(subcommand)]
+    pub command: LabelCommand,
+}
+
+#[derive(Subcommand)]
+pub enum LabelCommand {
+    /// Label a pane; overrides the derived title in every view
+    Set {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Label text
+        label: String,
+    },
+    /// Remove a pane's label
+    Clear {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+    },
+    /// List labelled panes
+    List,
+}
+
+#[derive(clap::Args)]
+pub struct TaskOpts {
+    #[command(subcommand)]
+    pub command: TaskCommand,
+}
+
+#[derive(Subcommand)]
+pub enum TaskCommand {
+    /// Attach a task to a pane, replacing its previous one
+    Set {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Task title; shown as the pane title unless the pane has a label
+        #[arg(long, short = 't')]
+        title: Option<String>,
+        /// Ticket / issue URL
+        #[arg(long, short = 'u')]
+        url: Option<String>,
+        #[arg(long, short = 'o')]
+        owner: Option<String>,
+        /// Tag (repeatable)
+        #[arg(long = "tag")]
+        tags: Vec<String>,
+    },
+    /// Remove a pane's task
+    Clear {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+    },
+    /// List panes with tasks
+    List,
+}
+
+#[derive(clap::Args)]
+pub struct PaneOpts {
+    /// Idempotency key: repeating a request with the same ref returns the
+    /// first result instead of acting twice
+    #[arg(long, global = true)]
+    pub request_ref: Option<String>,
+
+    #[command(subcommand)]
+    pub command: PaneCommand,
+}
+
+#[derive(Subcommand)]
+pub enum PaneCommand {
+    /// Open a window in a session; prints the new pane id and address
+    NewWindow {
+        /// tmux session name or id
+        session: String,
+        /// Window name
+        #[arg(long, short = 'n')]
+        name: Option<String>,
+        /// Working directory
+        #[arg(long, short = 'c')]
+        cwd: Option<String>,
+        /// Command to run instead of the shell
+        command: Option<String>,
+    },
+    /// Split a pane; prints the new pane id and address
+    Split {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Side by side instead of stacked
+        #[arg(long, short = 'H')]
+        horizontal: bool,
+        /// Working directory
+        #[arg(long, short = 'c')]
+        cwd: Option<String>,
+        /// Command to run instead of the shell
+        command: Option<String>,
+    },
+    /// Kill a pane (or its whole window)
+    Kill {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Kill the window containing the pane
+        #[arg(long)]
+        window: bool,
+        /// Kill even if an agent in it is running or waiting
+        #[arg(long)]
+        force: bool,
+    },
+    /// Launch an agent with an initial prompt; prints the pane id and address
+    Run {
+        /// `claude`, `codex`, or a name for `--command`
+        agent: String,
+        /// Initial prompt
+        prompt: String,
+        /// Session to open a new window in
+        #[arg(long, required_unless_present = "pane")]
+        session: Option<String>,
+        /// Type the command into this idle shell pane instead
+        #[arg(long, conflicts_with_all = ["session", "reuse_idle"])]
+        pane: Option<String>,
+        /// Prefer an idle shell pane in the session over a new window
+        #[arg(long)]
+        reuse_idle: bool,
+        /// Working directory of a new window
+        #[arg(long, short = 'c')]
+        cwd: Option<String>,
+        /// Command line to run instead of the agent binary (prompt is appended)
+        #[arg(long)]
+        command: Option<String>,
+    },
+    /// Print the pane agent's conversation as markdown (claude / codex)
+    Transcript {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Write `<provider>-<session>.md` into this directory instead
+        #[arg(long)]
+        archive: Option<std::path::PathBuf>,
+    },
+    /// Restart the process of a dead pane
+    Respawn {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Kill the running process first
+        #[arg(long, short = 'k')]
+        kill: bool,
+        /// Command to run instead of the pane's original one
+        command: Option<String>,
+    },
+    /// Type the same text (or key) into several panes; prints the panes reached
+    Send {
+        /// Text to type
+        #[arg(required_unless_present = "key")]
+        text: Option<String>,
+        /// Target pane (repeatable or comma-separated)
+        #[arg(long, value_delimiter = ',', conflicts_with_all = ["session", "state", "agent"])]
+        pane: Vec<String>,
+        /// Every agent pane in this session
+        #[arg(long)]
+        session: Option<String>,
+        /// Every agent pane in this state (repeatable: idle, waiting_input, ...)
+        #[arg(long, value_delimiter = ',')]
+        state: Vec<String>,
+        /// Every pane of this agent (claude, codex, ...)
+        #[arg(long)]
+        agent: Option<String>,
+        /// Press a tmux key (`C-c`, `Escape`, ...) instead of typing text
+        #[arg(long, conflicts_with = "text")]
+        key: Option<String>,
+        /// Do not press Enter after the text
+        #[arg(long)]
+        no_enter: bool,
+        /// Send later, at this RFC 3339 time (`2024-06-01T03:00Z`); prints the
+        /// pending send's id
+        #[arg(long, conflicts_with = "after")]
+        at: Option<String>,
+        /// Send later, after this long (`90s`, `10m`, `2h`)
+        #[arg(long)]
+        after: Option<String>,
+    },
+    /// Kill the pane's agent and relaunch it (same provider CLI)
+    Restart {
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Only if the agent is in this state (repeatable: error, waiting_input, ...)
+        #[arg(long, value_delimiter = ',')]
+        if_state: Vec<String>,
+        /// Command to relaunch instead of the detected agent's
+        command: Option<String>,
+    },
+    /// Recent actions across panes: when, who, what, on which panes, result
+    History {
+        /// Only actions since this RFC 3339 time or age (`30m`, `2h`, `1d`)
+        #[arg(long)]
+        since: Option<String>,
+        /// Only actions on this pane
+        #[arg(long)]
+        pane: Option<String>,
+        /// Only this method, or a prefix ending in `*` (`pane.send`, `group.*`)
+        #[arg(long)]
+        action: Option<String>,
+        /// Newest N actions [default: 100]
+        #[arg(long)]
+        limit: Option<u32>,
+    },
+    /// Sends scheduled with `send --at` / `--after` that have not run yet
+    Pending {
+        #[command(subcommand)]
+        command: Option<PendingCommand>,
+    },
+}
+
+#[derive(Subcommand)]
+pub enum PendingCommand {
+    /// List pending sends, soonest first (the default)
+    Ls,
+    /// Drop a pending send before it runs
+    Cancel {
+        /// Id printed by `send --at` / `--after`
+        id: u64,
+    },
+}
+
+#[derive(clap::Args)]
+pub struct MacroOpts {
+    #[command(subcommand)]
+    pub command: MacroCommand,
+}
+
+#[derive(Subcommand)]
+pub enum MacroCommand {
+    /// List configured macros and their parameters
+    List,
+    /// Run a macro against a pane; prints the lines its output steps captured
+    Run {
+        /// Macro name
+        name: String,
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Parameters as `key=value`
+        params: Vec<String>,
+        /// Start at this step, skipping earlier ones (to resume a failed run)
+        #[arg(long, default_value_t = 0)]
+        from_step: usize,
+        /// Idempotency key (see `agtmux pane --request-ref`)
+        #[arg(long)]
+        request_ref: Option<String>,
+    },
+    /// Run the steps of a TOML file (`steps = [...]`, the `[[macros]]` step
+    /// format) against a pane without adding them to the config
+    Exec {
+        /// File with a `steps` array
+        file: std::path::PathBuf,
+        /// tmux pane id (`%12` or `12`)
+        pane: String,
+        /// Parameters as `key=value`
+        params: Vec<String>,
+        /// Start at this step, skipping earlier ones (to resume a failed run)
+        #[arg(long, default_value_t = 0)]
+        from_step: usize,
+        /// Idempotency key (see `agtmux pane --request-ref`)
+        #[arg(long)]
+        request_ref: Option<String>,
+    },
+}
+
+#[derive(clap::Args)]
+pub struct ResponderOpts {
+    #[command(subcommand)]
+    pub command: ResponderCommand,
+}
+
+#[derive(Subcommand)]
+pub enum ResponderCommand {
+    /// Show whether the responder is on, its rules and recent responses
+    Status {
+        /// Only responses of this rule
+        #[arg(long)]
+        rule: Option<String>,
+    },
+    /// Stop answering prompts (kill switch)
+    Off,
+    /// Resume answering prompts
+    On,
+}
+
+#[derive(clap::Args)]
+pub struct GrepOpts {
+    /// Text to look for (a literal string unless --regex)
+    pub pattern: String,
+    /// Treat the pattern as a regular expression
+    #[arg(short = 'E', long)]
+    pub regex: bool,
+    /// Only these panes (repeatable or comma-separated)
+    #[arg(long, value_delimiter = ',')]
+    pub pane: Vec<String>,
+    /// Only panes in this session
+    #[arg(long)]
+    pub session: Option<String>,
+    /// Only panes of this agent (claude, codex, ...)
+    #[arg(long)]
+    pub agent: Option<String>,
+    /// Lines of each pane's output to search [default: 200]
+    #[arg(long)]
+    pub lines: Option<u64>,
+    /// Ignore case
+    #[arg(short, long)]
+    pub ignore_case: bool,
+    /// Only print the matching panes' ids
+    #[arg(short = 'l', long)]
+    pub files_with_matches: bool,
+}
+
+#[derive(clap::Args)]
+pub struct RecordingOpts {
+    #[command(subcommand)]
+    pub command: RecordingCommand,
+}
+
+#[derive(Subcommand)]
+pub enum RecordingCommand {
+    /// List recorded pane runtimes
+    Ls,
+    /// Print a runtime's recorded output, also after its pane was killed
+    Replay {
+        /// Runtime (`3-20261015T070000`), or a pane id for its latest runtime
+        runtime: String,
+        /// Only output recorded since this time (RFC 3339 or 30m / 2h / 1d)
+        #[arg(long)]
+        since: Option<String>,
+        /// Print output recorded by the pipe-pane backend as the pane
+        /// printed it, escape sequences included
+        #[arg(long)]
+        raw: bool,
+    },
+}
+
+#[derive(clap::Args)]
+pub struct GroupOpts {
+    #[command(subcommand)]
+    pub command: GroupCommand,
+}
+
+#[derive(Subcommand)]
+pub enum GroupCommand {
+    /// List groups with member counts by state
+    Ls,
+    /// Add panes to a group, creating it
+    Add {
+        /// Group name
+        group: String,
+        /// tmux pane ids (`%12` or `12`)
+        #[arg(required = true)]
+        panes: Vec<String>,
+    },
+    /// Remove panes from a group, or the whole group if none are given
+    Rm {
+        /// Group name
+        group: String,
+        /// tmux pane ids (`%12` or `12`)
+        panes: Vec<String>,
+    },
+    /// Type text into every pane of a group, followed by Enter
+    Send {
+        /// Group name
+        group: String,
+        /// Text to type
+        text: String,
+        /// Do not press Enter after the text
+        #[arg(long)]
+        no_enter: bool,
+    },
+    /// Kill every pane of a group
+    Kill {
+        /// Group name
+        group: String,
+        /// Kill even if an agent in the group is running or waiting
+        #[arg(long)]
+        force: bool,
+    },
+}
+
+#[derive(clap::Args)]
+pub struct TokenOpts {
+    /// Daemon config file to edit (default: ~/.config/agtmux/agtmuxd.toml)
+    #[arg(long, global = true)]
+    pub config: Option<std::path::PathBuf>,
+
+    #[command(subcommand)]
+    pub command: TokenCommand,
+}
+
+#[derive(Subcommand)]
+pub enum TokenCommand {
+    /// Generate a token, add its hash to the config and print it once
+    Create {
+        /// What the token may do: read, act or admin
+        #[arg(long)]
+        scope: crate::access::Scope,
+        /// Entry name (default: token-<n>)
+        #[arg(long)]
+        name: Option<String>,
+    },
+    /// List configured tokens (names and scopes)
+    Ls,
+}
+
+impl Cli {
+    /// Resolve the tracing filter directive for this invocation.
+    ///
+    /// Precedence: `--log-level` > `-v`/`-q` > `AGTMUX_LOG` > `RUST_LOG` > `default`.
+    pub fn log_filter(&self, default: &str) -> String {
+        self.log_filter_override()
+            .map_or_else(|| default.to_string(), |(filter, _)| filter)
+    }
+
+    /// The filter set by a flag or env var, with its origin (`--log-level`,
+    /// `-v`, `-q`, `AGTMUX_LOG`, `RUST_LOG`); `None` means the default applies.
+    pub fn log_filter_override(&self) -> Option<(String, &'static str)> {
+        if let Some(ref level) = self.log_level {
+            return Some((level.clone(), "--log-level"));
+        }
+        match (self.verbose, self.quiet) {
+            (0, true) => return Some(("error".to_string(), "-q")),
+            (1, _) => return Some(("debug".to_string(), "-v")),
+            (2.., _) => return Some(("trace".to_string(), "-v")),
+            _ => {}
+        }
+        ["AGTMUX_LOG", "RUST_LOG"]
+            .into_iter()
+            .find_map(|var| std::env::var(var).ok().map(|filter| (filter, var)))
+    }
+}
+
+/// Default socket path inside the per-user runtime dir (`paths::runtime_dir`).
 pub fn default_socket_path() -> String {
-    if let Ok(dir) = std::env::var("XDG_RUNTIME_DIR") {
-        return format!("{dir}/agtmux/agtmuxd.sock");
+    crate::paths::runtime_dir()
+        .join("agtmuxd.sock")
+        .display()
+        .to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use clap::CommandFactory;
+
+    #[test]
+    fn cli_definition_is_consistent() {
+        Cli::command().debug_assert();
+    }
+
+    #[test]
+    fn ls_opts_default_matches_clap_defaults() {
+        let parsed = match Cli::parse_from(["agtmux", "ls"]).command {
+            Some(Command::Ls(opts)) => opts,
+            _ => panic!("expected ls"),
+        };
+        let default = LsOpts::default();
+        assert_eq!(parsed.group, default.group);
+        assert_eq!(parsed.color, default.color);
+        assert_eq!(parsed.time, default.time);
+    }
+
+    #[test]
+    fn log_filter_explicit_level_wins() {
+        let cli = Cli::parse_from(["agtmux", "-vv", "--log-level", "agtmux=info", "ls"]);
+        assert_eq!(cli.log_filter("warn"), "agtmux=info");
+    }
+
+    #[test]
+    fn log_filter_verbose_levels() {
+        let cli = Cli::parse_from(["agtmux", "-v", "ls"]);
+        assert_eq!(cli.log_filter("warn"), "debug");
+        let cli = Cli::parse_from(["agtmux", "ls", "-vv"]);
+        assert_eq!(cli.log_filter("warn"), "trace");
+    }
+
+    #[test]
+    fn log_filter_quiet_is_error_only() {
+        let cli = Cli::parse_from(["agtmux", "--quiet", "bar"]);
+        assert_eq!(cli.log_filter("warn"), "error");
+    }
+
+    #[test]
+    fn verbose_and_quiet_conflict() {
+        assert!(Cli::try_parse_from(["agtmux", "-v", "-q", "ls"]).is_err());
     }
-    let user = std::env::var("USER").unwrap_or_else(|_| "unknown".to_string());
-    format!("/tmp/agtmux-{user}/agtmuxd.sock")
 }
@@ -0,0 +1,257 @@
+//! CLI config file (`~/.config/agtmux/config.toml`) and `[aliases]` expansion.
+//!
+//! ```toml
+//! [aliases]
+//! lw = "ls --group=pane --columns pane,state,title"
+//! tag = "label set {1} {2}"
+//! ```
+//!
+//! `agtmux tag 12 "fix flaky tests"` expands to `agtmux label set 12 "fix flaky tests"`
+//! before clap parses the command line.
+
+use std::collections::BTreeMap;
+use std::path::PathBuf;
+
+use clap::CommandFactory;
+
+use crate::cli::Cli;
+use crate::paths::config_dir;
+
+/// Parsed CLI config file. Every section is optional.
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct CliConfig {
+    /// Alias name → command line template (`{1}`, `{2}`, ... are positional placeholders).
+    pub aliases: BTreeMap<String, String>,
+}
+
+/// `<config_dir>/config.toml`.
+pub fn config_path() -> Option<PathBuf> {
+    config_dir().map(|d| d.join("config.toml"))
+}
+
+/// Load the CLI config. A missing file yields the default (empty) config.
+pub fn load_cli_config() -> anyhow::Result<CliConfig> {
+    let Some(path) = config_path() else {
+        return Ok(CliConfig::default());
+    };
+    match std::fs::read_to_string(&path) {
+        Ok(text) => toml::from_str(&text)
+            .map_err(|e| anyhow::anyhow!("invalid config {}: {e}", path.display())),
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(CliConfig::default()),
+        Err(e) => anyhow::bail!("cannot read config {}: {e}", path.display()),
+    }
+}
+
+/// Global flags that consume the following argument (must be skipped when
+/// locating the subcommand).
+const GLOBAL_FLAGS_WITH_VALUE: &[&str] = &["-s", "--socket-path", "--log-level"];
+
+/// Index of the first positional argument (the subcommand candidate).
+fn subcommand_index(argv: &[String]) -> Option<usize> {
+    let mut i = 1;
+    while i < argv.len() {
+        let arg = argv[i].as_str();
+        if GLOBAL_FLAGS_WITH_VALUE.contains(&arg) {
+            i += 2;
+        } else if arg == "--" {
+            return None;
+        } else if arg.starts_with('-') {
+            i += 1;
+        } else {
+            return Some(i);
+        }
+    }
+    None
+}
+
+/// Split an alias template into words, honouring single and double quotes.
+fn split_words(template: &str) -> anyhow::Result<Vec<String>> {
+    let mut words = Vec::new();
+    let mut current = String::new();
+    let mut in_word = false;
+    let mut quote: Option<char> = None;
+    for c in template.chars() {
+        match (quote, c) {
+            (Some(q), c) if c == q => quote = None,
+            (Some(_), c) => current.push(c),
+            (None, '\'' | '"') => {
+                quote = Some(c);
+                in_word = true;
+            }
+            (None, c) if c.is_whitespace() => {
+                if in_word {
+                    words.push(std::mem::take(&mut current));
+                    in_word = false;
+                }
+            }
+            (None, c) => {
+                current.push(c);
+                in_word = true;
+            }
+        }
+    }
+    if quote.is_some() {
+        anyhow::bail!("unterminated quote in alias: {template}");
+    }
+    if in_word {
+        words.push(current);
+    }
+    Ok(words)
+}
+
+/// Expand one alias template with positional `args`.
+///
+/// `{N}` is replaced by the N-th argument (1-based). Arguments not referenced
+/// by any placeholder are appended, so `lw = "ls --group=pane"` still accepts
+/// extra flags.
+fn expand_template(name: &str, template: &str, args: &[String]) -> anyhow::Result<Vec<String>> {
+    let mut used = vec![false; args.len()];
+    let mut out = Vec::new();
+    for word in split_words(template)? {
+        let mut expanded = String::new();
+        let mut rest = word.as_str();
+        while let Some(start) = rest.find('{') {
+            let Some(len) = rest[start..].find('}') else {
+                break;
+            };
+            let inner = &rest[start + 1..start + len];
+            let Ok(n) = inner.parse::<usize>() else {
+                expanded.push_str(&rest[..start + len + 1]);
+                rest = &rest[start + len + 1..];
+                continue;
+            };
+            let arg = n
+                .checked_sub(1)
+                .and_then(|i| args.get(i).map(|a| (i, a)))
+                .ok_or_else(|| anyhow::anyhow!("alias '{name}' expects argument {{{n}}}"))?;
+            used[arg.0] = true;
+            expanded.push_str(&rest[..start]);
+            expanded.push_str(arg.1);
+            rest = &rest[start + len + 1..];
+        }
+        expanded.push_str(rest);
+        out.push(expanded);
+    }
+    out.extend(
+        args.iter()
+            .zip(&used)
+            .filter(|(_, used)| !**used)
+            .map(|(a, _)| a.clone()),
+    );
+    Ok(out)
+}
+
+/// Expand a user alias in `argv` using `aliases`. Built-in subcommands always win.
+pub fn expand_with(
+    argv: Vec<String>,
+    aliases: &BTreeMap<String, String>,
+) -> anyhow::Result<Vec<String>> {
+    let Some(idx) = subcommand_index(&argv) else {
+        return Ok(argv);
+    };
+    let Some(template) = aliases.get(&argv[idx]) else {
+        return Ok(argv);
+    };
+    let mut out = argv[..idx].to_vec();
+    out.extend(expand_template(&argv[idx], template, &argv[idx + 1..])?);
+    Ok(out)
+}
+
+/// Expand a user alias in the process arguments.
+///
+/// The config file is only read when the first positional argument is not a
+/// built-in subcommand, so a broken config never affects built-in commands.
+pub fn expand_aliases(argv: Vec<String>) -> anyhow::Result<Vec<String>> {
+    let Some(idx) = subcommand_index(&argv) else {
+        return Ok(argv);
+    };
+    if Cli::command().find_subcommand(&argv[idx]).is_some() {
+        return Ok(argv);
+    }
+    let config = load_cli_config()?;
+    expand_with(argv, &config.aliases)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn argv(s: &[&str]) -> Vec<String> {
+        s.iter().map(|a| a.to_string()).collect()
+    }
+
+    fn aliases(pairs: &[(&str, &str)]) -> BTreeMap<String, String> {
+        pairs
+            .iter()
+            .map(|(k, v)| (k.to_string(), v.to_string()))
+            .collect()
+    }
+
+    #[test]
+    fn parse_aliases_section() {
+        let cfg: CliConfig =
+            toml::from_str("[aliases]\nlw = \"ls --group=pane\"\n").expect("valid");
+        assert_eq!(cfg.aliases["lw"], "ls --group=pane");
+        let empty: CliConfig = toml::from_str("").expect("empty config");
+        assert!(empty.aliases.is_empty());
+    }
+
+    #[test]
+    fn expand_placeholders_and_append_rest() {
+        let a = aliases(&[("tag", "label set {1} {2}")]);
+        let out =
+            expand_with(argv(&["agtmux", "tag", "12", "fix flaky tests"]), &a).expect("expand");
+        assert_eq!(
+            out,
+            argv(&["agtmux", "label", "set", "12", "fix flaky tests"])
+        );
+
+        let a = aliases(&[("lw", "ls --group=pane")]);
+        let out = expand_with(argv(&["agtmux", "lw", "--color=never"]), &a).expect("expand");
+        assert_eq!(
+            out,
+            argv(&["agtmux", "ls", "--group=pane", "--color=never"])
+        );
+    }
+
+    #[test]
+    fn expand_skips_global_flags_and_keeps_them() {
+        let a = aliases(&[("lw", "ls --group=pane")]);
+        let out =
+            expand_with(argv(&["agtmux", "-s", "/tmp/x.sock", "-v", "lw"]), &a).expect("expand");
+        assert_eq!(
+            out,
+            argv(&["agtmux", "-s", "/tmp/x.sock", "-v", "ls", "--group=pane"])
+        );
+    }
+
+    #[test]
+    fn expand_quoted_template_words() {
+        let a = aliases(&[("fix", "label set {1} 'fix flaky tests'")]);
+        let out = expand_with(argv(&["agtmux", "fix", "%3"]), &a).expect("expand");
+        assert_eq!(
+            out,
+            argv(&["agtmux", "label", "set", "%3", "fix flaky tests"])
+        );
+    }
+
+    #[test]
+    fn expand_missing_placeholder_is_error() {
+        let a = aliases(&[("tag", "label set {1} {2}")]);
+        let err = expand_with(argv(&["agtmux", "tag", "12"]), &a).expect_err("missing {2}");
+        assert!(err.to_string().contains("{2}"));
+    }
+
+    #[test]
+    fn builtin_subcommands_are_not_expanded() {
+        let out = expand_aliases(argv(&["agtmux", "ls", "--group=pane"])).expect("no-op");
+        assert_eq!(out, argv(&["agtmux", "ls", "--group=pane"]));
+    }
+
+    #[test]
+    fn unknown_word_without_alias_passes_through() {
+        let out = expand_with(argv(&["agtmux", "nope"]), &BTreeMap::new()).expect("no-op");
+        assert_eq!(out, argv(&["agtmux", "nope"]));
+    }
+}
@@ -1,81 +1,161 @@
-//! UDS JSON-RPC client for CLI subcommands.
+//! CLI glue over `agtmux-client`: logging, `--json` errors and `agtmux bar`.
 
-use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
-use tokio::net::UnixStream;
+/// Failure talking to the daemon. Carried inside `anyhow::Error` so callers can
+/// downcast and surface a stable code (`--json`).
+pub(crate) use agtmux_client::Error as ClientError;
 
+/// Structured form of a CLI error for `--json`:
+/// `{"error": {"code", "message", "rpc_code"}}`.
+///
+/// `rpc_code` is the daemon's JSON-RPC error code, or null when the failure
+/// happened before/outside an RPC (connection, usage, config).
+pub(crate) fn error_json(err: &anyhow::Error) -> serde_json::Value {
+    let client_err = err.downcast_ref::<ClientError>();
+    let code = client_err.map_or("ERR_CLI", ClientError::code);
+    let rpc_code = match client_err {
+        Some(ClientError::Rpc { code, .. }) => serde_json::json!(code),
+        _ => serde_json::Value::Null,
+    };
+    let message = match client_err {
+        Some(ClientError::Rpc { message, .. }) => message.clone(),
+        _ => err.to_string(),
+    };
+    serde_json::json!({
+        "error": {
+            "code": code,
+            "message": message,
+            "rpc_code": rpc_code,
+        }
+    })
+}
+
+/// Send a single JSON-RPC request to the daemon and return its `result`.
 pub(crate) async fn rpc_call(socket_path: &str, method: &str) -> anyhow::Result<serde_json::Value> {
-    let stream = UnixStream::connect(socket_path)
-        .await
-        .map_err(|e| anyhow::anyhow!("cannot connect to daemon at {socket_path}: {e}"))?;
+    rpc_call_with_params(socket_path, method, serde_json::json!({})).await
+}
 
-    let (reader, mut writer) = stream.into_split();
+/// Like [`rpc_call`], with explicit `params`.
+pub(crate) async fn rpc_call_with_params(
+    socket_path: &str,
+    method: &str,
+    params: serde_json::Value,
+) -> anyhow::Result<serde_json::Value> {
+    Ok(client_for(socket_path).call(method, params).await?)
+}
 
-    let request = serde_json::json!({
-        "jsonrpc": "2.0",
-        "method": method,
-        "params": {},
-        "id": 1,
-    });
-    let mut req = serde_json::to_string(&request)?;
-    req.push('\n');
-    writer.write_all(req.as_bytes()).await?;
-    writer.shutdown().await?;
+/// Process-wide client per socket, so repeated calls (`watch`, `wait`) reuse
+/// pooled keep-alive connections.
+pub(crate) fn client_for(socket_path: &str) -> agtmux_client::Client {
+    static CLIENTS: std::sync::OnceLock<
+        std::sync::Mutex<std::collections::HashMap<String, agtmux_client::Client>>,
+    > = std::sync::OnceLock::new();
+    CLIENTS
+        .get_or_init(Default::default)
+        .lock()
+        .expect("client cache lock")
+        .entry(socket_path.to_string())
+        .or_insert_with(|| {
+            agtmux_client::Client::new(socket_path).with_interceptor(RpcLog {
+                socket_path: socket_path.to_string(),
+                token: crate::daemon_config::process_env(crate::daemon_config::ENV_TOKEN),
+            })
+        })
+        .clone()
+}
 
-    let mut reader = BufReader::new(reader);
-    let mut line = String::new();
-    reader.read_line(&mut line).await?;
+/// Logs each call at debug level (method, duration, status) so that
+/// `agtmux -v <cmd>` shows what the CLI is asking the daemon for, and sends
+/// `AGTMUX_TOKEN` as the access token.
+struct RpcLog {
+    socket_path: String,
+    token: Option<String>,
+}
 
-    let response: serde_json::Value = serde_json::from_str(line.trim())?;
+impl agtmux_client::Interceptor for RpcLog {
+    fn on_request(&self, request: &mut agtmux_client::Request) {
+        request.meta.insert(
+            "client".to_string(),
+            serde_json::json!(concat!("agtmux/", env!("CARGO_PKG_VERSION"))),
+        );
+        if let Some(token) = &self.token {
+            request
+                .meta
+                .insert("token".to_string(), serde_json::json!(token));
+        }
+    }
 
-    if let Some(error) = response.get("error") {
-        anyhow::bail!("RPC error: {error}");
+    fn on_response(
+        &self,
+        request: &agtmux_client::Request,
+        result: &Result<serde_json::Value, ClientError>,
+        elapsed: std::time::Duration,
+    ) {
+        let method = request.method.as_str();
+        let socket_path = self.socket_path.as_str();
+        let elapsed_ms = elapsed.as_millis() as u64;
+        match result {
+            Ok(_) => tracing::debug!(method, socket_path, elapsed_ms, status = "ok", "rpc"),
+            Err(e) => {
+                tracing::debug!(method, socket_path, elapsed_ms, status = "error", error = %e, "rpc")
+            }
+        }
     }
+}
 
-    Ok(response["result"].clone())
+/// Output of `agtmux bar`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum BarFormat {
+    Ansi,
+    Tmux,
+    /// One JSON object (`text`, `tooltip`, `class`, `alt`) as read by waybar
+    /// `custom` modules, xbar and SwiftBar.
+    Waybar,
 }
 
 /// `agtmux bar` — single-line status for tmux status bar or terminal.
 ///
 /// ANSI mode (default): " 1W 2R 2I" with colored output.
 /// tmux mode (`--tmux`): `#[fg=yellow,bold] 1W#[default] #[fg=green] 2R#[default] 2I`
+/// waybar mode (`--format waybar`): `{"text":" 1W 2R","tooltip":…,"class":"waiting",…}`
 ///
-/// W/R/I are shown only when non-zero. Daemon unreachable: `--`.
-pub async fn cmd_bar(socket_path: &str, tmux_mode: bool) -> anyhow::Result<()> {
-    let panes = match rpc_call(socket_path, "list_panes").await {
-        Ok(p) => p,
-        Err(_) => {
-            print!("--");
-            return Ok(());
-        }
-    };
-
-    let output = format_bar(&panes, tmux_mode);
-    print!("{output}");
+/// W/R/I are shown only when non-zero. Daemon unreachable: `--`
+/// (waybar: class `offline`).
+pub async fn cmd_bar(socket_path: &str, format: BarFormat) -> anyhow::Result<()> {
+    let panes = rpc_call(socket_path, "list_panes")
+        .await
+        .unwrap_or(serde_json::Value::Null);
+    match format {
+        BarFormat::Waybar => println!("{}", format_waybar(&panes)),
+        _ => print!("{}", format_bar(&panes, format == BarFormat::Tmux)),
+    }
     Ok(())
 }
 
-/// Pure formatting logic for bar output, separated for testability.
-pub(crate) fn format_bar(panes: &serde_json::Value, tmux_mode: bool) -> String {
-    let arr = match panes.as_array() {
-        Some(a) => a,
-        None => return "--".to_string(),
-    };
-
-    let mut waiting = 0usize;
-    let mut running = 0usize;
-    let mut idle = 0usize;
-
-    for pane in arr {
+/// Managed panes per bar category: (waiting, running, idle).
+fn count_bar_states(panes: &[serde_json::Value]) -> (usize, usize, usize) {
+    let mut counts = (0, 0, 0);
+    for pane in panes {
         if pane["presence"].as_str() != Some("managed") {
             continue;
         }
         match pane["activity_state"].as_str() {
-            Some("WaitingInput") | Some("WaitingApproval") => waiting += 1,
-            Some("Running") => running += 1,
-            Some("Idle") => idle += 1,
+            Some("WaitingInput") | Some("WaitingApproval") => counts.0 += 1,
+            Some("Running") => counts.1 += 1,
+            Some("Idle") => counts.2 += 1,
             _ => {}
         }
     }
+    counts
+}
+
+/// Pure formatting logic for bar output, separated for testability.
+pub(crate) fn format_bar(panes: &serde_json::Value, tmux_mode: bool) -> String {
+    let arr = match panes.as_array() {
+        Some(a) => a,
+        None => return "--".to_string(),
+    };
+
+    let (waiting, running, idle) = count_bar_states(arr);
 
     if waiting == 0 && running == 0 && idle == 0 {
         return String::new();
@@ -108,6 +188,59 @@ pub(crate) fn format_bar(panes: &serde_json::Value, tmux_mode: bool) -> String {
     parts.join("")
 }
 
+/// waybar / xbar / SwiftBar JSON. `class` (and `alt`, for icon mapping) is
+/// the worst category present: waiting > running > idle > none. The tooltip
+/// lists every pane that is waiting or running, one per line.
+pub(crate) fn format_waybar(panes: &serde_json::Value) -> serde_json::Value {
+    let Some(arr) = panes.as_array() else {
+        return serde_json::json!({
+            "text": "--",
+            "tooltip": "agtmux daemon unreachable",
+            "class": "offline",
+            "alt": "offline",
+        });
+    };
+    let (waiting, running, idle) = count_bar_states(arr);
+    let class = if waiting > 0 {
+        "waiting"
+    } else if running > 0 {
+        "running"
+    } else if idle > 0 {
+        "idle"
+    } else {
+        "none"
+    };
+
+    let text: String = [(waiting, 'W'), (running, 'R'), (idle, 'I')]
+        .iter()
+        .filter(|(n, _)| *n > 0)
+        .map(|(n, c)| format!(" {n}{c}"))
+        .collect();
+    let mut tooltip = vec![format!("{waiting} waiting, {running} running, {idle} idle")];
+    for pane in arr {
+        let state = pane["activity_state"].as_str().unwrap_or("");
+        if pane["presence"].as_str() != Some("managed")
+            || !matches!(state, "WaitingInput" | "WaitingApproval" | "Running")
+        {
+            continue;
+        }
+        tooltip.push(format!(
+            "{}:{} {} {} {state}",
+            pane["session_name"].as_str().unwrap_or("?"),
+            pane["window_name"].as_str().unwrap_or("?"),
+            pane["pane_id"].as_str().unwrap_or("?"),
+            pane["provider"].as_str().unwrap_or("agent"),
+        ));
+    }
+
+    serde_json::json!({
+        "text": text,
+        "tooltip": tooltip.join("\n"),
+        "class": class,
+        "alt": class,
+    })
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -186,4 +319,73 @@ mod tests {
         let out = format_bar(&panes, false);
         assert_eq!(out, "", "no agents = empty output");
     }
+
+    #[test]
+    fn format_waybar_worst_category() {
+        let panes = serde_json::json!([
+            make_pane("managed", "Running"),
+            make_pane("managed", "WaitingApproval"),
+            make_pane("managed", "Idle"),
+            make_pane("unmanaged", ""),
+        ]);
+        let out = format_waybar(&panes);
+        assert_eq!(out["text"], " 1W 1R 1I");
+        assert_eq!(out["class"], "waiting");
+        assert_eq!(out["alt"], "waiting");
+        let tooltip = out["tooltip"].as_str().expect("tooltip");
+        assert!(tooltip.starts_with("1 waiting, 1 running, 1 idle"));
+        assert!(tooltip.contains("work:dev %0 agent WaitingApproval"));
+        assert!(!tooltip.contains("Idle"), "idle panes only counted");
+
+        let idle = format_waybar(&serde_json::json!([make_pane("managed", "Idle")]));
+        assert_eq!(idle["class"], "idle");
+        assert_eq!(format_waybar(&serde_json::json!([]))["class"], "none");
+        assert_eq!(format_waybar(&serde_json::Value::Null)["class"], "offline");
+    }
+
+    // ── error_json ──────────────────────────────────────────────────────
+
+    #[test]
+    fn error_json_rpc_error_keeps_daemon_code() {
+        let err: anyhow::Error = ClientError::Rpc {
+            code: agtmux_client::codes::PANE_NOT_FOUND,
+            message: "unknown pane: \"%9\"".to_string(),
+        }
+        .into();
+        let v = error_json(&err);
+        assert_eq!(v["error"]["code"], "ERR_PANE_NOT_FOUND");
+        assert_eq!(v["error"]["rpc_code"], -32002);
+        assert_eq!(v["error"]["message"], "unknown pane: \"%9\"");
+    }
+
+    #[test]
+    fn error_json_unreachable() {
+        let err: anyhow::Error = ClientError::Unreachable {
+            socket_path: "/tmp/none.sock".to_string(),
+            reason: std::io::Error::from(std::io::ErrorKind::NotFound),
+        }
+        .into();
+        let v = error_json(&err);
+        assert_eq!(v["error"]["code"], "ERR_DAEMON_UNREACHABLE");
+        assert!(v["error"]["rpc_code"].is_null());
+    }
+
+    #[test]
+    fn error_json_non_client_error_is_cli() {
+        let err = anyhow::anyhow!("invalid --time 'epoch'");
+        let v = error_json(&err);
+        assert_eq!(v["error"]["code"], "ERR_CLI");
+        assert_eq!(v["error"]["message"], "invalid --time 'epoch'");
+    }
+
+    #[tokio::test]
+    async fn rpc_call_missing_socket_is_unreachable() {
+        let err = rpc_call("/nonexistent/agtmux-test.sock", "list_panes")
+            .await
+            .expect_err("no daemon");
+        assert!(matches!(
+            err.downcast_ref::<ClientError>(),
+            Some(ClientError::Unreachable { .. })
+        ));
+    }
 }
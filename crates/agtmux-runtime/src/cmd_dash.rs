@@ -0,0 +1,672 @@
+//! `agtmux dash` — full-screen dashboard: agents as a session / window /
+//! pane tree with panes that need attention highlighted, and keys to attach
+//! to, send text to or kill the selected pane.
+//!
+//! Follows the daemon's `watch` stream with `deltas` and falls back to
+//! `list_panes` every `--interval` against daemons without it. The terminal
+//! is switched to raw mode with `stty` and drawn with ANSI escapes on the
+//! alternate screen.
+
+use std::collections::BTreeMap;
+use std::io::{Read, Write};
+use std::process::{Command, Stdio};
+use std::time::Duration;
+
+use agtmux_client::WatchLoop;
+use serde_json::Value;
+
+use crate::client::{client_for, rpc_call, rpc_call_with_params};
+use crate::cmd_watch::next_update;
+use crate::context::{TimeFormat, format_updated_at, pane_title, provider_short, state_color};
+
+const HELP: &str = "j/k move  enter attach  s send  x kill  q quit";
+
+/// One line of the tree; only pane rows are selectable.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct DashRow {
+    pub text: String,
+    pub pane_id: Option<String>,
+    /// Display state of a pane row (`Waiting`, `Running`, ...).
+    pub state: Option<String>,
+}
+
+/// Waiting for input / approval, or errored.
+pub(crate) fn needs_attention(pane: &Value) -> bool {
+    matches!(
+        pane["activity_state"].as_str(),
+        Some("WaitingInput" | "WaitingApproval" | "Error")
+    )
+}
+
+/// Managed panes grouped by session, then window, in name / pane id order.
+pub(crate) fn build_rows(panes: &[Value], time: TimeFormat) -> Vec<DashRow> {
+    let mut tree: BTreeMap<&str, BTreeMap<(&str, &str), Vec<&Value>>> = BTreeMap::new();
+    for pane in panes {
+        if pane["presence"].as_str() != Some("managed") {
+            continue;
+        }
+        let session = pane["session_name"].as_str().unwrap_or("?");
+        let window = (
+            pane["window_id"].as_str().unwrap_or(""),
+            pane["window_name"].as_str().unwrap_or(""),
+        );
+        tree.entry(session)
+            .or_default()
+            .entry(window)
+            .or_default()
+            .push(pane);
+    }
+
+    let mut rows = Vec::new();
+    for (session, windows) in tree {
+        let attention: usize = windows
+            .values()
+            .flatten()
+            .filter(|p| needs_attention(p))
+            .count();
+        let text = if attention > 0 {
+            format!("{session}  ({attention} need attention)")
+        } else {
+            session.to_string()
+        };
+        rows.push(DashRow {
+            text,
+            pane_id: None,
+            state: None,
+        });
+        for ((_, window), mut panes) in windows {
+            rows.push(DashRow {
+                text: format!("  {window}"),
+                pane_id: None,
+                state: None,
+            });
+            panes.sort_by_key(|p| pane_number(p["pane_id"].as_str().unwrap_or("")));
+            for pane in panes {
+                let pane_id = pane["pane_id"].as_str().unwrap_or("?");
+                let state = match pane["activity_state"].as_str().unwrap_or("?") {
+                    "WaitingInput" | "WaitingApproval" => "Waiting",
+                    other => other,
+                };
+                let marker = if needs_attention(pane) { "!" } else { " " };
+                let provider = provider_short(pane["provider"].as_str().unwrap_or("?"));
+                let text = format!(
+                    "    {marker} {pane_id:<5} {provider:<6}  {state:<8}  {}  {}",
+                    pane_title(pane),
+                    format_updated_at(pane, time)
+                );
+                rows.push(DashRow {
+                    text: text.trim_end().to_string(),
+                    pane_id: Some(pane_id.to_string()),
+                    state: Some(state.to_string()),
+                });
+            }
+        }
+    }
+    rows
+}
+
+fn pane_number(pane_id: &str) -> u64 {
+    pane_id
+        .strip_prefix('%')
+        .and_then(|n| n.parse().ok())
+        .unwrap_or(u64::MAX)
+}
+
+/// Apply a `watch` delta frame (or a `list_panes` result as `snapshot`) to
+/// the local pane list.
+pub(crate) fn apply_update(
+    panes: &mut BTreeMap<String, Value>,
+    snapshot: Option<&Value>,
+    events: &[Value],
+) {
+    if let Some(snapshot) = snapshot.and_then(Value::as_array) {
+        panes.clear();
+        for pane in snapshot {
+            if let Some(pane_id) = pane["pane_id"].as_str() {
+                panes.insert(pane_id.to_string(), pane.clone());
+            }
+        }
+    }
+    for event in events {
+        let Some(pane_id) = event["pane_id"].as_str() else {
+            continue;
+        };
+        match event["type"].as_str() {
+            Some("pane.removed") => {
+                panes.remove(pane_id);
+            }
+            Some(_) => {
+                panes.insert(pane_id.to_string(), event["pane"].clone());
+            }
+            None => {}
+        }
+    }
+}
+
+/// Decoded key press.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Key {
+    Up,
+    Down,
+    Enter,
+    Backspace,
+    Esc,
+    CtrlC,
+    Char(char),
+}
+
+/// Decode raw-mode terminal input. Unknown escape sequences are dropped.
+pub(crate) fn parse_keys(input: &str) -> Vec<Key> {
+    let mut keys = Vec::new();
+    let mut chars = input.chars().peekable();
+    while let Some(c) = chars.next() {
+        let key = match c {
+            '\x1b' if chars.peek() == Some(&'[') => {
+                chars.next();
+                match chars.next() {
+                    Some('A') => Key::Up,
+                    Some('B') => Key::Down,
+                    _ => continue,
+                }
+            }
+            '\x1b' => Key::Esc,
+            '\x03' => Key::CtrlC,
+            '\r' | '\n' => Key::Enter,
+            '\x7f' | '\x08' => Key::Backspace,
+            c if c.is_control() => continue,
+            c => Key::Char(c),
+        };
+        keys.push(key);
+    }
+    keys
+}
+
+/// What the prompt line is collecting.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Mode {
+    Normal,
+    Send { pane_id: String, text: String },
+    ConfirmKill { pane_id: String },
+}
+
+/// Requested by a key press; run by the main loop.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Effect {
+    None,
+    Quit,
+    Attach(String),
+    Send { pane_id: String, text: String },
+    Kill { pane_id: String, force: bool },
+}
+
+struct Dash {
+    rows: Vec<DashRow>,
+    /// Selected pane id; kept across refreshes.
+    selected: Option<String>,
+    mode: Mode,
+    status: String,
+}
+
+impl Dash {
+    fn set_rows(&mut self, rows: Vec<DashRow>) {
+        self.rows = rows;
+        let still_there = self
+            .selected
+            .as_ref()
+            .is_some_and(|id| self.rows.iter().any(|r| r.pane_id.as_ref() == Some(id)));
+        if !still_there {
+            self.selected = self.rows.iter().find_map(|r| r.pane_id.clone());
+        }
+    }
+
+    fn move_selection(&mut self, down: bool) {
+        let ids: Vec<&String> = self
+            .rows
+            .iter()
+            .filter_map(|r| r.pane_id.as_ref())
+            .collect();
+        let Some(pos) = ids
+            .iter()
+            .position(|id| Some(*id) == self.selected.as_ref())
+        else {
+            return;
+        };
+        let next = if down {
+            (pos + 1).min(ids.len() - 1)
+        } else {
+            pos.saturating_sub(1)
+        };
+        self.selected = Some(ids[next].clone());
+    }
+
+    fn handle(&mut self, key: Key) -> Effect {
+        match std::mem::replace(&mut self.mode, Mode::Normal) {
+            Mode::Normal => match key {
+                Key::Char('q') | Key::CtrlC => return Effect::Quit,
+                Key::Up | Key::Char('k') => self.move_selection(false),
+                Key::Down | Key::Char('j') => self.move_selection(true),
+                Key::Enter | Key::Char('a') => {
+                    if let Some(pane_id) = self.selected.clone() {
+                        return Effect::Attach(pane_id);
+                    }
+                }
+                Key::Char('s') => {
+                    if let Some(pane_id) = self.selected.clone() {
+                        self.mode = Mode::Send {
+                            pane_id,
+                            text: String::new(),
+                        };
+                    }
+                }
+                Key::Char('x') => {
+                    if let Some(pane_id) = self.selected.clone() {
+                        self.mode = Mode::ConfirmKill { pane_id };
+                    }
+                }
+                _ => {}
+            },
+            Mode::Send { pane_id, mut text } => match key {
+                Key::Enter => return Effect::Send { pane_id, text },
+                Key::Esc | Key::CtrlC => self.status.clear(),
+                Key::Backspace => {
+                    text.pop();
+                    self.mode = Mode::Send { pane_id, text };
+                }
+                Key::Char(c) => {
+                    text.push(c);
+                    self.mode = Mode::Send { pane_id, text };
+                }
+                _ => self.mode = Mode::Send { pane_id, text },
+            },
+            Mode::ConfirmKill { pane_id } => match key {
+                Key::Char('y') => {
+                    return Effect::Kill {
+                        pane_id,
+                        force: false,
+                    };
+                }
+                Key::Char('f') => {
+                    return Effect::Kill {
+                        pane_id,
+                        force: true,
+                    };
+                }
+                _ => self.status.clear(),
+            },
+        }
+        Effect::None
+    }
+
+    /// Full frame: header, the visible slice of the tree, prompt / status.
+    fn render(&self, height: usize, width: usize, use_color: bool) -> String {
+        let agents = self.rows.iter().filter(|r| r.pane_id.is_some()).count();
+        let attention = self
+            .rows
+            .iter()
+            .filter(|r| matches!(r.state.as_deref(), Some("Waiting" | "Error")))
+            .count();
+        let mut out = String::from("\x1b[H\x1b[2J");
+        let header = format!("agtmux dash \u{2014} {agents} agent(s), {attention} need attention");
+        out += &paint(&clip(&header, width), "1", use_color);
+        out += "\r\n";
+
+        let body = height.saturating_sub(3).max(1);
+        let selected_row = self
+            .rows
+            .iter()
+            .position(|r| r.pane_id.is_some() && r.pane_id == self.selected)
+            .unwrap_or(0);
+        let start = (selected_row + 1).saturating_sub(body);
+        for row in self.rows.iter().skip(start).take(body) {
+            let is_selected = row.pane_id.is_some() && row.pane_id == self.selected;
+            let line = if is_selected {
+                clip(&format!("> {}", &row.text[2..]), width)
+            } else {
+                clip(&row.text, width)
+            };
+            let code = match (&row.state, is_selected) {
+                (_, true) => "7",
+                (Some(state), false) => state_color(state),
+                (None, false) => "1",
+            };
+            out += &paint(&line, code, use_color);
+            out += "\r\n";
+        }
+        if self.rows.is_empty() {
+            out += "(no agents detected)\r\n";
+        }
+
+        let prompt = match &self.mode {
+            Mode::Normal if self.status.is_empty() => HELP.to_string(),
+            Mode::Normal => self.status.clone(),
+            Mode::Send { pane_id, text } => {
+                format!("send to {pane_id} (enter to send, esc to cancel): {text}")
+            }
+            Mode::ConfirmKill { pane_id } => {
+                format!("kill {pane_id}? y = yes, f = force, other = cancel")
+            }
+        };
+        out += &format!("\x1b[{height};1H{}", clip(&prompt, width));
+        out
+    }
+}
+
+fn clip(line: &str, width: usize) -> String {
+    line.chars().take(width).collect()
+}
+
+fn paint(text: &str, code: &str, use_color: bool) -> String {
+    if use_color {
+        format!("\x1b[{code}m{text}\x1b[0m")
+    } else {
+        text.to_string()
+    }
+}
+
+/// `stty` against the controlling terminal.
+fn stty(args: &[&str]) -> anyhow::Result<String> {
+    let tty = std::fs::File::open("/dev/tty")?;
+    let output = Command::new("stty")
+        .args(args)
+        .stdin(Stdio::from(tty))
+        .output()?;
+    if !output.status.success() {
+        anyhow::bail!(
+            "stty {}: {}",
+            args.join(" "),
+            String::from_utf8_lossy(&output.stderr).trim()
+        );
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).trim().to_string())
+}
+
+/// Raw mode + alternate screen until dropped.
+struct RawTerminal {
+    saved: String,
+}
+
+impl RawTerminal {
+    fn enter() -> anyhow::Result<Self> {
+        let saved = stty(&["-g"])?;
+        stty(&["raw", "-echo"])?;
+        print!("\x1b[?1049h\x1b[?25l");
+        let _ = std::io::stdout().flush();
+        Ok(Self { saved })
+    }
+}
+
+impl Drop for RawTerminal {
+    fn drop(&mut self) {
+        print!("\x1b[?25h\x1b[?1049l");
+        let _ = std::io::stdout().flush();
+        let _ = stty(&[&self.saved]);
+    }
+}
+
+/// `(rows, cols)` of the terminal, 24x80 if unknown.
+fn terminal_size() -> (usize, usize) {
+    stty(&["size"])
+        .ok()
+        .and_then(|s| {
+            let (rows, cols) = s.split_once(' ')?;
+            Some((rows.parse().ok()?, cols.parse().ok()?))
+        })
+        .unwrap_or((24, 80))
+}
+
+fn tmux(args: &[&str]) -> anyhow::Result<()> {
+    let output = Command::new("tmux").args(args).output()?;
+    if !output.status.success() {
+        anyhow::bail!("{}", String::from_utf8_lossy(&output.stderr).trim());
+    }
+    Ok(())
+}
+
+/// Entry point for `agtmux dash`.
+pub async fn cmd_dash(
+    socket_path: &str,
+    interval: u64,
+    color: &str,
+    time: TimeFormat,
+) -> anyhow::Result<()> {
+    use std::io::IsTerminal;
+    if !std::io::stdin().is_terminal() || !std::io::stdout().is_terminal() {
+        anyhow::bail!("agtmux dash needs a terminal");
+    }
+    let use_color = crate::context::resolve_color(color);
+    let inside_tmux = std::env::var_os("TMUX").is_some();
+
+    let mut panes: BTreeMap<String, Value> = BTreeMap::new();
+    let mut watch = Some(WatchLoop::new(client_for(socket_path)).deltas());
+    let mut dash = Dash {
+        rows: Vec::new(),
+        selected: None,
+        mode: Mode::Normal,
+        status: String::new(),
+    };
+
+    // Keys are read on a plain thread: stdin reads block.
+    let (key_tx, mut key_rx) = tokio::sync::mpsc::unbounded_channel::<String>();
+    std::thread::spawn(move || {
+        let mut stdin = std::io::stdin();
+        let mut buf = [0u8; 64];
+        while let Ok(n) = stdin.read(&mut buf) {
+            if n == 0
+                || key_tx
+                    .send(String::from_utf8_lossy(&buf[..n]).into_owned())
+                    .is_err()
+            {
+                break;
+            }
+        }
+    });
+
+    let mut terminal = Some(RawTerminal::enter()?);
+    let mut attach_to = None;
+    loop {
+        let list: Vec<Value> = panes.values().cloned().collect();
+        dash.set_rows(build_rows(&list, time));
+        let (height, width) = terminal_size();
+        print!("{}", dash.render(height, width, use_color));
+        let _ = std::io::stdout().flush();
+
+        tokio::select! {
+            update = next_update(&mut watch) => match update {
+                Ok(update) => apply_update(&mut panes, update.snapshot.as_ref(), &update.events),
+                Err(e) => {
+                    tracing::debug!(error = %e, "watch stream unavailable, polling");
+                    watch = None;
+                }
+            },
+            _ = tokio::time::sleep(Duration::from_secs(interval)) => {
+                // Redraw for relative times; refetch only without a stream.
+                if watch.is_none() {
+                    match rpc_call(socket_path, "list_panes").await {
+                        Ok(list) => apply_update(&mut panes, Some(&list), &[]),
+                        Err(e) => dash.status = format!("cannot reach daemon: {e}"),
+                    }
+                }
+            }
+            input = key_rx.recv() => {
+                let Some(input) = input else { break };
+                for key in parse_keys(&input) {
+                    match dash.handle(key) {
+                        Effect::None => {}
+                        Effect::Quit => return Ok(()),
+                        Effect::Attach(pane_id) if inside_tmux => {
+                            dash.status = match tmux(&["switch-client", "-t", &pane_id]) {
+                                Ok(()) => format!("switched to {pane_id}"),
+                                Err(e) => format!("attach {pane_id}: {e}"),
+                            };
+                        }
+                        Effect::Attach(pane_id) => {
+                            attach_to = Some(pane_id);
+                            break;
+                        }
+                        Effect::Send { pane_id, text } => {
+                            let sent = tmux(&["send-keys", "-t", &pane_id, "-l", &text])
+                                .and_then(|()| tmux(&["send-keys", "-t", &pane_id, "Enter"]));
+                            dash.status = match sent {
+                                Ok(()) => format!("sent to {pane_id}"),
+                                Err(e) => format!("send to {pane_id}: {e}"),
+                            };
+                        }
+                        Effect::Kill { pane_id, force } => {
+                            let params = serde_json::json!({"pane_id": pane_id, "force": force});
+                            dash.status = match rpc_call_with_params(socket_path, "pane.kill", params).await {
+                                Ok(_) => format!("killed {pane_id}"),
+                                Err(e) => format!("kill {pane_id}: {e}"),
+                            };
+                        }
+                    }
+                }
+                if attach_to.is_some() {
+                    break;
+                }
+            }
+        }
+    }
+
+    // Outside tmux, attaching replaces the dashboard.
+    drop(terminal.take());
+    if let Some(pane_id) = attach_to {
+        let status = Command::new("tmux")
+            .args(["attach-session", "-t", &pane_id])
+            .status()?;
+        if !status.success() {
+            anyhow::bail!("tmux attach-session -t {pane_id} failed");
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pane(pane_id: &str, session: &str, window: &str, state: &str) -> Value {
+        serde_json::json!({
+            "pane_id": pane_id, "presence": "managed", "provider": "claude",
+            "activity_state": state, "session_name": session,
+            "window_id": format!("@{window}"), "window_name": window, "label": "job",
+        })
+    }
+
+    #[test]
+    fn rows_form_a_session_window_pane_tree() {
+        let panes = vec![
+            pane("%10", "work", "api", "Running"),
+            pane("%2", "work", "api", "WaitingApproval"),
+            pane("%3", "ops", "logs", "Idle"),
+            serde_json::json!({"pane_id": "%4", "presence": "unmanaged", "session_name": "work"}),
+        ];
+        let rows = build_rows(&panes, TimeFormat::Relative);
+        let text: Vec<&str> = rows.iter().map(|r| r.text.as_str()).collect();
+        assert_eq!(
+            text,
+            [
+                "ops",
+                "  logs",
+                "      %3    claude  Idle      job",
+                "work  (1 need attention)",
+                "  api",
+                "    ! %2    claude  Waiting   job",
+                "      %10   claude  Running   job",
+            ]
+        );
+        assert_eq!(rows[5].pane_id.as_deref(), Some("%2"));
+        assert_eq!(rows[4].pane_id, None);
+    }
+
+    #[test]
+    fn deltas_update_the_local_pane_list() {
+        let mut panes = BTreeMap::new();
+        panes.insert("%9".to_string(), pane("%9", "old", "w", "Idle"));
+        let snapshot = serde_json::json!([
+            pane("%1", "work", "api", "Idle"),
+            pane("%2", "work", "api", "Idle")
+        ]);
+        apply_update(&mut panes, Some(&snapshot), &[]);
+        assert_eq!(panes.keys().collect::<Vec<_>>(), ["%1", "%2"]);
+
+        let events = [
+            serde_json::json!({"type": "pane.removed", "pane_id": "%1"}),
+            serde_json::json!({"type": "pane.updated", "pane_id": "%2",
+                "pane": pane("%2", "work", "api", "Running")}),
+            serde_json::json!({"type": "pane.added", "pane_id": "%3",
+                "pane": pane("%3", "work", "api", "Idle")}),
+        ];
+        apply_update(&mut panes, None, &events);
+        assert_eq!(panes.keys().collect::<Vec<_>>(), ["%2", "%3"]);
+        assert_eq!(panes["%2"]["activity_state"], "Running");
+    }
+
+    #[test]
+    fn parses_keys() {
+        assert_eq!(
+            parse_keys("j\x1b[Ak\r\x1b\x7fé\x03"),
+            [
+                Key::Char('j'),
+                Key::Up,
+                Key::Char('k'),
+                Key::Enter,
+                Key::Esc,
+                Key::Backspace,
+                Key::Char('é'),
+                Key::CtrlC,
+            ]
+        );
+    }
+
+    #[test]
+    fn keys_drive_selection_send_and_kill() {
+        let panes = vec![
+            pane("%1", "work", "api", "Running"),
+            pane("%2", "work", "api", "Idle"),
+        ];
+        let mut dash = Dash {
+            rows: Vec::new(),
+            selected: None,
+            mode: Mode::Normal,
+            status: String::new(),
+        };
+        dash.set_rows(build_rows(&panes, TimeFormat::Relative));
+        assert_eq!(dash.selected.as_deref(), Some("%1"));
+        dash.handle(Key::Down);
+        dash.handle(Key::Down);
+        assert_eq!(
+            dash.selected.as_deref(),
+            Some("%2"),
+            "stops at the last pane"
+        );
+        assert_eq!(dash.handle(Key::Enter), Effect::Attach("%2".to_string()));
+
+        for key in parse_keys("shi!\x7f") {
+            assert_eq!(dash.handle(key), Effect::None);
+        }
+        assert!(dash.render(10, 80, false).contains("send to %2"));
+        assert_eq!(
+            dash.handle(Key::Enter),
+            Effect::Send {
+                pane_id: "%2".to_string(),
+                text: "hi".to_string()
+            }
+        );
+
+        dash.handle(Key::Char('x'));
+        assert_eq!(dash.handle(Key::Char('n')), Effect::None, "cancelled");
+        dash.handle(Key::Char('x'));
+        assert_eq!(
+            dash.handle(Key::Char('f')),
+            Effect::Kill {
+                pane_id: "%2".to_string(),
+                force: true
+            }
+        );
+        assert_eq!(dash.handle(Key::Char('q')), Effect::Quit);
+
+        // Selection follows the pane when the list changes under it.
+        dash.set_rows(build_rows(&panes[1..], TimeFormat::Relative));
+        assert_eq!(dash.selected.as_deref(), Some("%2"));
+    }
+}
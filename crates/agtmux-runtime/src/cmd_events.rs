@@ -0,0 +1,63 @@
+//! `agtmux events` — follow the events the daemon ingests from its sources
+//! (hooks, App Server, JSONL, poller) as NDJSON, one event per line.
+//!
+//! Each event carries its `seq`; `--since <seq>` resumes after the last one
+//! a consumer processed, as long as the daemon still buffers it.
+
+use agtmux_client::{EventFilter, WatchLoop};
+
+use crate::cli::EventsOpts;
+use crate::client::client_for;
+use crate::cmd_label::normalize_pane_id;
+
+fn event_filter(opts: &EventsOpts) -> EventFilter {
+    EventFilter {
+        pane_id: opts.pane.as_deref().map(normalize_pane_id),
+        source_kinds: opts.source.clone(),
+        event_types: opts.event_type.clone(),
+        provider: opts.agent.clone(),
+    }
+}
+
+/// Entry point for `agtmux events`. Runs until interrupted.
+pub async fn cmd_events(socket_path: &str, opts: EventsOpts) -> anyhow::Result<()> {
+    let mut watch = WatchLoop::new(client_for(socket_path)).source_events(event_filter(&opts));
+    if let Some(seq) = opts.since {
+        watch = watch.since(seq);
+    }
+    loop {
+        let update = tokio::select! {
+            update = watch.next() => update?,
+            _ = tokio::signal::ctrl_c() => return Ok(()),
+        };
+        if update.gap {
+            eprintln!(
+                "agtmux events: events before seq {} were lost (daemon restarted or buffer overrun)",
+                update.version
+            );
+        }
+        for event in &update.events {
+            println!("{event}");
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn filter_from_options() {
+        let filter = event_filter(&EventsOpts {
+            pane: Some("3".to_string()),
+            source: vec!["claude_hooks".to_string()],
+            event_type: vec!["task_completed".to_string(), "lifecycle.*".to_string()],
+            agent: None,
+            since: Some(7),
+        });
+        assert_eq!(filter.pane_id.as_deref(), Some("%3"));
+        assert_eq!(filter.source_kinds, ["claude_hooks"]);
+        assert_eq!(filter.event_types.len(), 2);
+        assert!(filter.provider.is_none());
+    }
+}
@@ -0,0 +1,104 @@
+//! `agtmux grep` — search the recent output of panes (`pane.search`).
+
+use crate::cli::GrepOpts;
+use crate::client::rpc_call_with_params;
+use crate::cmd_label::normalize_pane_id;
+
+/// `pane.search` params for the options.
+pub(crate) fn search_params(opts: &GrepOpts) -> serde_json::Value {
+    let pane_ids: Vec<String> = opts.pane.iter().map(|p| normalize_pane_id(p)).collect();
+    serde_json::json!({
+        "q": opts.pattern,
+        "pane_ids": pane_ids,
+        "session": opts.session,
+        "agent": opts.agent,
+        "lines": opts.lines,
+        "ignore_case": opts.ignore_case,
+        "regex": opts.regex,
+    })
+}
+
+/// Render `pane.search` hits as `%3 work:build claude  42: text` lines, with
+/// a `(+N more)` line for panes that matched more than was returned.
+pub(crate) fn format_hits(result: &serde_json::Value, ids_only: bool) -> String {
+    let str_of = |v: &serde_json::Value| v.as_str().unwrap_or("").to_string();
+    let mut out = Vec::new();
+    for hit in result["panes"].as_array().into_iter().flatten() {
+        let pane_id = str_of(&hit["pane_id"]);
+        if ids_only {
+            out.push(pane_id);
+            continue;
+        }
+        let mut place = format!(
+            "{pane_id} {}:{}",
+            str_of(&hit["session_name"]),
+            str_of(&hit["window_name"])
+        );
+        if let Some(agent) = hit["provider"].as_str() {
+            place += &format!(" {agent}");
+        }
+        let matches = hit["matches"].as_array().map(Vec::as_slice).unwrap_or(&[]);
+        for m in matches {
+            out.push(format!("{place}  {}: {}", m["line"], str_of(&m["text"])));
+        }
+        let more = (hit["total"].as_u64().unwrap_or(0) as usize).saturating_sub(matches.len());
+        if more > 0 {
+            out.push(format!("{place}  (+{more} more)"));
+        }
+    }
+    out.join("\n")
+}
+
+/// Entry point for `agtmux grep`. Returns whether any pane matched, for a
+/// grep-like exit status; capture failures go to stderr.
+pub async fn cmd_grep(socket_path: &str, opts: GrepOpts) -> anyhow::Result<bool> {
+    let result = rpc_call_with_params(socket_path, "pane.search", search_params(&opts)).await?;
+    let text = format_hits(&result, opts.files_with_matches);
+    if !text.is_empty() {
+        println!("{text}");
+    }
+    for (pane_id, error) in result["failed"].as_object().into_iter().flatten() {
+        eprintln!("{pane_id}: {}", error.as_str().unwrap_or(""));
+    }
+    Ok(!text.is_empty())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn builds_params() {
+        let opts = GrepOpts {
+            pattern: "panicked".to_string(),
+            regex: false,
+            pane: vec!["3".to_string(), "%4".to_string()],
+            session: None,
+            agent: Some("codex".to_string()),
+            lines: Some(500),
+            ignore_case: true,
+            files_with_matches: false,
+        };
+        assert_eq!(
+            search_params(&opts),
+            serde_json::json!({"q": "panicked", "pane_ids": ["%3", "%4"], "session": null,
+                "agent": "codex", "lines": 500, "ignore_case": true, "regex": false})
+        );
+    }
+
+    #[test]
+    fn formats_hits() {
+        let result = serde_json::json!({"q": "error", "searched": 3, "failed": {}, "panes": [
+            {"pane_id": "%3", "session_name": "work", "window_name": "api", "provider": "codex",
+                "matches": [{"line": 12, "text": "error: boom"}], "total": 3},
+            {"pane_id": "%9", "session_name": "ops", "window_name": "sh", "provider": null,
+                "matches": [{"line": 1, "text": "no error"}], "total": 1},
+        ]});
+        assert_eq!(
+            format_hits(&result, false),
+            "%3 work:api codex  12: error: boom\n%3 work:api codex  (+2 more)\n%9 ops:sh  1: no error"
+        );
+        assert_eq!(format_hits(&result, true), "%3\n%9");
+        assert_eq!(format_hits(&serde_json::json!({"panes": []}), false), "");
+    }
+}
@@ -0,0 +1,118 @@
+//! `agtmux group` — named pane groups and group-wide send / kill.
+
+use crate::cli::GroupCommand;
+use crate::client::{rpc_call, rpc_call_with_params};
+use crate::cmd_label::normalize_pane_id;
+
+/// Render `group.list` results as `name  N panes  state counts  members`
+/// lines.
+pub(crate) fn format_group_list(groups: &serde_json::Value) -> String {
+    let entries = groups.as_array().map(Vec::as_slice).unwrap_or(&[]);
+    let width = entries
+        .iter()
+        .map(|e| e["name"].as_str().unwrap_or("").len())
+        .max()
+        .unwrap_or(0);
+    entries
+        .iter()
+        .map(|e| {
+            let name = e["name"].as_str().unwrap_or("?");
+            let summary = &e["summary"];
+            let mut counts: Vec<String> = summary["states"]
+                .as_object()
+                .into_iter()
+                .flatten()
+                .map(|(state, n)| format!("{}={n}", state.to_lowercase()))
+                .collect();
+            let unmanaged = summary["unmanaged"].as_u64().unwrap_or(0);
+            if unmanaged > 0 {
+                counts.push(format!("unmanaged={unmanaged}"));
+            }
+            let panes: Vec<&str> = e["panes"]
+                .as_array()
+                .map(Vec::as_slice)
+                .unwrap_or(&[])
+                .iter()
+                .filter_map(serde_json::Value::as_str)
+                .collect();
+            format!(
+                "{name:<width$}  {} pane(s)  {}  {}",
+                summary["total"].as_u64().unwrap_or(0),
+                counts.join(" "),
+                panes.join(" ")
+            )
+            .trim_end()
+            .to_string()
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Entry point for `agtmux group`.
+pub async fn cmd_group(socket_path: &str, command: GroupCommand) -> anyhow::Result<()> {
+    let result = match command {
+        GroupCommand::Ls => {
+            let groups = rpc_call(socket_path, "group.list").await?;
+            let output = format_group_list(&groups);
+            if !output.is_empty() {
+                println!("{output}");
+            }
+            return Ok(());
+        }
+        GroupCommand::Add { group, panes } => {
+            let pane_ids: Vec<String> = panes.iter().map(|p| normalize_pane_id(p)).collect();
+            let params = serde_json::json!({"group": group, "pane_ids": pane_ids});
+            rpc_call_with_params(socket_path, "group.add", params).await?;
+            return Ok(());
+        }
+        GroupCommand::Rm { group, panes } => {
+            let pane_ids: Option<Vec<String>> =
+                (!panes.is_empty()).then(|| panes.iter().map(|p| normalize_pane_id(p)).collect());
+            let params = serde_json::json!({"group": group, "pane_ids": pane_ids});
+            rpc_call_with_params(socket_path, "group.remove", params).await?;
+            return Ok(());
+        }
+        GroupCommand::Send {
+            group,
+            text,
+            no_enter,
+        } => {
+            let params = serde_json::json!({"group": group, "text": text, "enter": !no_enter});
+            rpc_call_with_params(socket_path, "group.send", params).await?
+        }
+        GroupCommand::Kill { group, force } => {
+            let params = serde_json::json!({"group": group, "force": force});
+            rpc_call_with_params(socket_path, "group.kill", params).await?
+        }
+    };
+    if let Some(failed) = result["failed"].as_object()
+        && !failed.is_empty()
+    {
+        for (pane_id, error) in failed {
+            eprintln!("{pane_id}: {}", error.as_str().unwrap_or(""));
+        }
+        anyhow::bail!("failed on {} pane(s)", failed.len());
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn format_group_list_shows_counts_and_members() {
+        let groups = serde_json::json!([
+            {"name": "api", "panes": ["%1", "%4"], "sessions": ["work"],
+                "summary": {"total": 2, "managed": 1, "unmanaged": 1,
+                    "states": {"Running": 1}, "providers": {"codex": 1}}},
+            {"name": "empty", "panes": [], "sessions": [],
+                "summary": {"total": 0, "managed": 0, "unmanaged": 0,
+                    "states": {}, "providers": {}}},
+        ]);
+        assert_eq!(
+            format_group_list(&groups),
+            "api    2 pane(s)  running=1 unmanaged=1  %1 %4\nempty  0 pane(s)"
+        );
+    }
+}
@@ -82,6 +82,7 @@ fn pane_to_json_v1(
         "activity_state": normalize_activity_state(pane["activity_state"].as_str()),
         "evidence_mode": pane.get("evidence_mode").and_then(|v| v.as_str()).unwrap_or("none"),
         "conversation_title": pane.get("conversation_title").cloned().unwrap_or(serde_json::Value::Null),
+        "label": pane.get("label").cloned().unwrap_or(serde_json::Value::Null),
         "current_path": pane["current_path"],
         "git_branch": git_branch,
         "current_cmd": pane["current_cmd"],
@@ -0,0 +1,84 @@
+//! `agtmux label` — user-assigned pane labels stored in the daemon.
+
+use crate::cli::LabelCommand;
+use crate::client::{rpc_call, rpc_call_with_params};
+
+/// Accept `%12` or bare `12` as a tmux pane id. Selectors (`agent=codex`,
+/// `latest:claude`) are passed through for the daemon to resolve.
+pub(crate) fn normalize_pane_id(pane: &str) -> String {
+    if pane.starts_with('%') || crate::selector::is_selector(pane) {
+        pane.to_string()
+    } else {
+        format!("%{pane}")
+    }
+}
+
+/// Render `label.list` results as `pane  label` lines.
+pub(crate) fn format_label_list(labels: &serde_json::Value) -> String {
+    let entries = labels.as_array().map(Vec::as_slice).unwrap_or(&[]);
+    let width = entries
+        .iter()
+        .map(|e| e["pane_id"].as_str().unwrap_or("").len())
+        .max()
+        .unwrap_or(0);
+    entries
+        .iter()
+        .map(|e| {
+            let pane = e["pane_id"].as_str().unwrap_or("?");
+            let label = e["label"].as_str().unwrap_or("");
+            format!("{pane:<width$}  {label}")
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Entry point for `agtmux label`.
+pub async fn cmd_label(socket_path: &str, command: LabelCommand) -> anyhow::Result<()> {
+    match command {
+        LabelCommand::Set { pane, label } => {
+            let params = serde_json::json!({"pane_id": normalize_pane_id(&pane), "label": label});
+            rpc_call_with_params(socket_path, "label.set", params).await?;
+        }
+        LabelCommand::Clear { pane } => {
+            let params = serde_json::json!({"pane_id": normalize_pane_id(&pane)});
+            rpc_call_with_params(socket_path, "label.clear", params).await?;
+        }
+        LabelCommand::List => {
+            let labels = rpc_call(socket_path, "label.list").await?;
+            let output = format_label_list(&labels);
+            if !output.is_empty() {
+                println!("{output}");
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn normalize_pane_id_adds_percent() {
+        assert_eq!(normalize_pane_id("12"), "%12");
+        assert_eq!(normalize_pane_id("%12"), "%12");
+        assert_eq!(normalize_pane_id("latest:codex"), "latest:codex");
+    }
+
+    #[test]
+    fn format_label_list_aligns_panes() {
+        let labels = serde_json::json!([
+            {"pane_id": "%4", "label": "fix flaky tests"},
+            {"pane_id": "%12", "label": "review"},
+        ]);
+        assert_eq!(
+            format_label_list(&labels),
+            "%4   fix flaky tests\n%12  review"
+        );
+    }
+
+    #[test]
+    fn format_label_list_empty() {
+        assert_eq!(format_label_list(&serde_json::json!([])), "");
+    }
+}
@@ -2,56 +2,32 @@
 
 use std::collections::HashMap;
 
+use crate::client::rpc_call;
 use crate::context::{
-    build_branch_map, consensus_str, provider_short, relative_time, short_path, truncate_branch,
+    TimeFormat, build_branch_map, consensus_str, format_updated_at, pane_title, provider_short,
+    short_path, state_color, truncate_branch,
 };
 
-/// RPC call (re-use from client).
-async fn rpc_call(socket_path: &str, method: &str) -> anyhow::Result<serde_json::Value> {
-    use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
-    use tokio::net::UnixStream;
-
-    let stream = UnixStream::connect(socket_path)
-        .await
-        .map_err(|e| anyhow::anyhow!("cannot connect to daemon at {socket_path}: {e}"))?;
-
-    let (reader, mut writer) = stream.into_split();
-
-    let request = serde_json::json!({
-        "jsonrpc": "2.0",
-        "method": method,
-        "params": {},
-        "id": 1,
-    });
-    let mut req = serde_json::to_string(&request)?;
-    req.push('\n');
-    writer.write_all(req.as_bytes()).await?;
-    writer.shutdown().await?;
-
-    let mut reader = BufReader::new(reader);
-    let mut line = String::new();
-    reader.read_line(&mut line).await?;
-
-    let response: serde_json::Value = serde_json::from_str(line.trim())?;
-
-    if let Some(error) = response.get("error") {
-        anyhow::bail!("RPC error: {error}");
-    }
-
-    Ok(response["result"].clone())
-}
-
 /// Entry point for `agtmux ls`.
-pub async fn cmd_ls(socket_path: &str, group: &str, use_color: bool) -> anyhow::Result<()> {
+///
+/// `columns` (from `--columns`) selects the flat column view regardless of `group`.
+pub async fn cmd_ls(
+    socket_path: &str,
+    group: &str,
+    columns: Option<&[LsColumn]>,
+    use_color: bool,
+    time: TimeFormat,
+) -> anyhow::Result<()> {
     let panes = rpc_call(socket_path, "list_panes").await?;
     let arr = panes.as_array().cloned().unwrap_or_default();
 
     let branch_map = build_branch_map(&arr);
 
-    let output = match group {
-        "session" => format_ls_session(&arr, &branch_map, use_color),
-        "pane" => format_ls_pane(&arr, &branch_map, use_color),
-        _ => format_ls_tree(&arr, &branch_map, use_color),
+    let output = match (columns, group) {
+        (Some(cols), _) => format_ls_columns(&arr, &branch_map, cols, use_color, time),
+        (None, "session") => format_ls_session(&arr, &branch_map, use_color),
+        (None, "pane") => format_ls_pane(&arr, &branch_map, use_color, time),
+        (None, _) => format_ls_tree(&arr, &branch_map, use_color, time),
     };
 
     if !output.is_empty() {
@@ -71,18 +47,6 @@ fn display_state(state: &str) -> &str {
     }
 }
 
-/// Age string from updated_at ISO timestamp.
-fn age_from_updated_at(pane: &serde_json::Value) -> String {
-    pane["updated_at"]
-        .as_str()
-        .and_then(|s| chrono::DateTime::parse_from_rfc3339(s).ok())
-        .map(|dt| {
-            let secs = (chrono::Utc::now() - dt.with_timezone(&chrono::Utc)).num_seconds();
-            relative_time(secs)
-        })
-        .unwrap_or_default()
-}
-
 /// Get git branch for a pane from the branch map.
 fn pane_branch<'a>(
     pane: &serde_json::Value,
@@ -137,6 +101,7 @@ pub fn format_ls_tree(
     panes: &[serde_json::Value],
     branch_map: &HashMap<String, String>,
     use_color: bool,
+    time: TimeFormat,
 ) -> String {
     if panes.is_empty() {
         return String::new();
@@ -242,7 +207,7 @@ pub fn format_ls_tree(
                 _ => String::new(),
             };
 
-            let summary = state_summary(&panes_in_win.iter().copied().collect::<Vec<_>>());
+            let summary = state_summary(panes_in_win);
             let summary_suffix = if summary.is_empty() {
                 String::new()
             } else {
@@ -278,11 +243,8 @@ pub fn format_ls_tree(
                     let evidence = pane["evidence_mode"].as_str().unwrap_or("");
                     let is_heur = evidence != "deterministic";
                     let state = display_state(pane["activity_state"].as_str().unwrap_or("?"));
-                    let title = pane["conversation_title"]
-                        .as_str()
-                        .filter(|s| !s.is_empty())
-                        .unwrap_or_else(|| provider_short(provider));
-                    let age = age_from_updated_at(pane);
+                    let title = pane_title(pane);
+                    let age = format_updated_at(pane, time);
 
                     let prov = format!("{:<6}", provider_short(provider));
                     let title_padded = format!("{title:<20}");
@@ -291,11 +253,8 @@ pub fn format_ls_tree(
                     if is_heur {
                         // Heuristic: ~Provider
                         if use_color {
-                            let state_colored = match state {
-                                "Waiting" => format!("\x1b[1;33m{state_padded}\x1b[0m"),
-                                "Running" => format!("\x1b[32m{state_padded}\x1b[0m"),
-                                _ => format!("\x1b[2m{state_padded}\x1b[0m"),
-                            };
+                            let state_colored =
+                                format!("\x1b[{}m{state_padded}\x1b[0m", state_color(state));
                             out.push_str(&format!(
                                 "    \x1b[33m~\x1b[0m{prov}  {title_padded}  {state_colored}  \x1b[2m{age}\x1b[0m\n"
                             ));
@@ -308,11 +267,8 @@ pub fn format_ls_tree(
                         // Deterministic
                         let marker = if state == "Waiting" { "!" } else { " " };
                         if use_color {
-                            let state_colored = match state {
-                                "Waiting" => format!("\x1b[1;33m{state_padded}\x1b[0m"),
-                                "Running" => format!("\x1b[32m{state_padded}\x1b[0m"),
-                                _ => format!("\x1b[2m{state_padded}\x1b[0m"),
-                            };
+                            let state_colored =
+                                format!("\x1b[{}m{state_padded}\x1b[0m", state_color(state));
                             let marker_colored = if state == "Waiting" {
                                 format!("\x1b[1;33m{marker}\x1b[0m")
                             } else {
@@ -330,10 +286,14 @@ pub fn format_ls_tree(
                 } else {
                     // Unmanaged pane
                     let cmd = pane["current_cmd"].as_str().unwrap_or("?");
+                    let label = match pane["label"].as_str() {
+                        Some(l) if !l.is_empty() => format!("  {l}"),
+                        _ => String::new(),
+                    };
                     if use_color {
-                        out.push_str(&format!("      \x1b[2m{cmd}\x1b[0m\n"));
+                        out.push_str(&format!("      \x1b[2m{cmd}\x1b[0m{label}\n"));
                     } else {
-                        out.push_str(&format!("      {cmd}\n"));
+                        out.push_str(&format!("      {cmd}{label}\n"));
                     }
                 }
             }
@@ -461,6 +421,7 @@ pub fn format_ls_pane(
     panes: &[serde_json::Value],
     branch_map: &HashMap<String, String>,
     use_color: bool,
+    time: TimeFormat,
 ) -> String {
     if panes.is_empty() {
         return String::new();
@@ -507,11 +468,8 @@ pub fn format_ls_pane(
         let evidence = pane["evidence_mode"].as_str().unwrap_or("");
         let is_heur = evidence != "deterministic";
         let state = display_state(pane["activity_state"].as_str().unwrap_or("?"));
-        let title = pane["conversation_title"]
-            .as_str()
-            .filter(|s| !s.is_empty())
-            .unwrap_or_else(|| provider_short(provider));
-        let age = age_from_updated_at(pane);
+        let title = pane_title(pane);
+        let age = format_updated_at(pane, time);
 
         let prov = format!("{:<6}", provider_short(provider));
         let state_padded = format!("{state:<7}");
@@ -537,11 +495,7 @@ pub fn format_ls_pane(
         };
 
         if use_color {
-            let state_colored = match state {
-                "Waiting" => format!("\x1b[1;33m{state_padded}\x1b[0m"),
-                "Running" => format!("\x1b[32m{state_padded}\x1b[0m"),
-                _ => format!("\x1b[2m{state_padded}\x1b[0m"),
-            };
+            let state_colored = format!("\x1b[{}m{state_padded}\x1b[0m", state_color(state));
             out.push_str(&format!(
                 "{loc_padded}  {marker} {prov}  {state_colored}  {title_padded}{branch_display}  \x1b[2m{age}\x1b[0m\n"
             ));
@@ -559,6 +513,174 @@ pub fn format_ls_pane(
     out
 }
 
+// ── Column format ───────────────────────────────────────────────────────────
+
+/// A selectable column for `--columns` (flat one-line-per-agent view).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum LsColumn {
+    /// `session:window`
+    Location,
+    /// tmux pane id (`%N`)
+    Pane,
+    /// `!` waiting / `~` heuristic marker
+    Marker,
+    /// Provider short name
+    Agent,
+    /// Display state (Waiting/Running/Idle/...)
+    State,
+    /// User label, task title or conversation title, falling back to the
+    /// provider name
+    Title,
+    /// Task metadata: `title (owner) #tag url`
+    Task,
+    /// `[git-branch]`
+    Branch,
+    /// Shortened working directory
+    Path,
+    /// Time since last state change
+    Age,
+}
+
+impl LsColumn {
+    const NAMES: &'static str =
+        "location, pane, marker, agent, state, title, task, branch, path, age";
+
+    fn from_name(name: &str) -> Option<Self> {
+        match name {
+            "location" | "loc" | "window" => Some(Self::Location),
+            "pane" => Some(Self::Pane),
+            "marker" => Some(Self::Marker),
+            "agent" | "provider" => Some(Self::Agent),
+            "state" => Some(Self::State),
+            "title" | "label" => Some(Self::Title),
+            "task" => Some(Self::Task),
+            "branch" => Some(Self::Branch),
+            "path" => Some(Self::Path),
+            "age" => Some(Self::Age),
+            _ => None,
+        }
+    }
+}
+
+/// Parse a `--columns` spec such as `pane,state,agent,label,age`.
+pub fn parse_columns(spec: &str) -> anyhow::Result<Vec<LsColumn>> {
+    let mut cols = Vec::new();
+    for name in spec.split(',').map(str::trim).filter(|s| !s.is_empty()) {
+        let col = LsColumn::from_name(&name.to_ascii_lowercase()).ok_or_else(|| {
+            anyhow::anyhow!("unknown column '{name}' (expected: {})", LsColumn::NAMES)
+        })?;
+        cols.push(col);
+    }
+    if cols.is_empty() {
+        anyhow::bail!("--columns is empty (expected: {})", LsColumn::NAMES);
+    }
+    Ok(cols)
+}
+
+/// Plain-text cell value for one column of a managed pane.
+fn column_cell(
+    pane: &serde_json::Value,
+    branch_map: &HashMap<String, String>,
+    col: LsColumn,
+    time: TimeFormat,
+) -> String {
+    match col {
+        LsColumn::Location => {
+            let sess = pane["session_name"].as_str().unwrap_or("?");
+            match pane["window_name"].as_str().unwrap_or("") {
+                "" => sess.to_string(),
+                win => format!("{sess}:{win}"),
+            }
+        }
+        LsColumn::Pane => pane["pane_id"].as_str().unwrap_or("?").to_string(),
+        LsColumn::Marker => {
+            let state = display_state(pane["activity_state"].as_str().unwrap_or("?"));
+            if state == "Waiting" {
+                "!".to_string()
+            } else if pane["evidence_mode"].as_str() != Some("deterministic") {
+                "~".to_string()
+            } else {
+                String::new()
+            }
+        }
+        LsColumn::Agent => provider_short(pane["provider"].as_str().unwrap_or("?")).to_string(),
+        LsColumn::State => {
+            display_state(pane["activity_state"].as_str().unwrap_or("?")).to_string()
+        }
+        LsColumn::Title => pane_title(pane).to_string(),
+        LsColumn::Task => crate::cmd_task::task_summary(&pane["task"]),
+        LsColumn::Branch => pane_branch(pane, branch_map)
+            .map(|b| format!("[{}]", truncate_branch(b, 20)))
+            .unwrap_or_default(),
+        LsColumn::Path => pane["current_path"]
+            .as_str()
+            .map(short_path)
+            .unwrap_or_default(),
+        LsColumn::Age => format_updated_at(pane, time),
+    }
+}
+
+/// `--columns`: flat one-line-per-agent view with user-selected columns.
+///
+/// Columns are padded to the widest value and separated by two spaces;
+/// the last column is never padded so lines carry no trailing whitespace.
+pub fn format_ls_columns(
+    panes: &[serde_json::Value],
+    branch_map: &HashMap<String, String>,
+    columns: &[LsColumn],
+    use_color: bool,
+    time: TimeFormat,
+) -> String {
+    let rows: Vec<Vec<String>> = panes
+        .iter()
+        .filter(|p| p["presence"].as_str() == Some("managed"))
+        .map(|p| {
+            columns
+                .iter()
+                .map(|&c| column_cell(p, branch_map, c, time))
+                .collect()
+        })
+        .collect();
+
+    let widths: Vec<usize> = (0..columns.len())
+        .map(|i| rows.iter().map(|r| r[i].chars().count()).max().unwrap_or(0))
+        .collect();
+
+    let mut lines = Vec::with_capacity(rows.len());
+    for row in &rows {
+        let mut line = String::new();
+        for (i, (cell, &col)) in row.iter().zip(columns).enumerate() {
+            if i > 0 {
+                line.push_str("  ");
+            }
+            let padded = if i + 1 < columns.len() {
+                format!("{cell:<width$}", width = widths[i])
+            } else {
+                cell.clone()
+            };
+            if !use_color || cell.is_empty() {
+                line.push_str(&padded);
+                continue;
+            }
+            let code = match col {
+                LsColumn::State => state_color(cell),
+                LsColumn::Marker if cell == "!" => state_color("Waiting"),
+                LsColumn::Marker => "33",
+                LsColumn::Branch => "36",
+                LsColumn::Age => "2",
+                _ => "",
+            };
+            if code.is_empty() {
+                line.push_str(&padded);
+            } else {
+                line.push_str(&format!("\x1b[{code}m{padded}\x1b[0m"));
+            }
+        }
+        lines.push(line.trim_end().to_string());
+    }
+    lines.join("\n")
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -607,7 +729,10 @@ mod tests {
     fn format_ls_tree_empty() {
         let panes: Vec<serde_json::Value> = vec![];
         let branch_map = HashMap::new();
-        assert_eq!(format_ls_tree(&panes, &branch_map, false), "");
+        assert_eq!(
+            format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative),
+            ""
+        );
     }
 
     #[test]
@@ -625,7 +750,7 @@ mod tests {
             "/repo/project",
         )];
         let branch_map = make_branch_map(&[("/repo/project", "main")]);
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("work"), "session name in header");
         assert!(out.contains("repo/project"), "short cwd in header");
         assert!(out.contains("[main]"), "branch in header");
@@ -660,7 +785,7 @@ mod tests {
             ),
         ];
         let branch_map = make_branch_map(&[("/repo", "main")]);
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(
             out.contains("Running(1)"),
             "Running count in window summary"
@@ -683,7 +808,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains('!'), "Waiting pane has ! marker");
         assert!(
             out.contains("Waiting"),
@@ -706,7 +831,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains('~'), "heuristic pane has ~ marker");
     }
 
@@ -739,7 +864,7 @@ mod tests {
             ),
         ];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("[cwd: mixed]"), "mixed cwd shown");
     }
 
@@ -772,7 +897,7 @@ mod tests {
             ),
         ];
         let branch_map = make_branch_map(&[("/repo/a", "main"), ("/repo/b", "dev")]);
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("[branch: mixed]"), "mixed branch shown");
     }
 
@@ -791,7 +916,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("vim"), "unmanaged pane shows command");
     }
 
@@ -810,7 +935,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(!out.contains('\x1b'), "no ANSI in no-color mode");
     }
 
@@ -829,7 +954,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, true);
+        let out = format_ls_tree(&panes, &branch_map, true, TimeFormat::Relative);
         assert!(out.contains('\x1b'), "ANSI codes present in color mode");
     }
 
@@ -850,13 +975,59 @@ mod tests {
         pane["conversation_title"] = serde_json::Value::String("fix: T-139 redesign".to_string());
         let panes = vec![pane];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(
             out.contains("fix: T-139 redesign"),
             "conversation_title shown"
         );
     }
 
+    #[test]
+    fn format_ls_tree_label_overrides_title() {
+        let mut managed = make_pane(
+            "%0",
+            "work",
+            "@0",
+            "dev",
+            "managed",
+            Some("ClaudeCode"),
+            "deterministic",
+            "Running",
+            "claude",
+            "/repo",
+        );
+        managed["conversation_title"] = serde_json::json!("derived title");
+        managed["label"] = serde_json::json!("fix flaky tests");
+        let mut shell = make_pane(
+            "%1",
+            "work",
+            "@0",
+            "dev",
+            "unmanaged",
+            None,
+            "",
+            "",
+            "zsh",
+            "/repo",
+        );
+        shell["label"] = serde_json::json!("scratch");
+        let out = format_ls_tree(
+            &[managed, shell],
+            &HashMap::new(),
+            false,
+            TimeFormat::Relative,
+        );
+        assert!(out.contains("fix flaky tests"), "label shown");
+        assert!(
+            !out.contains("derived title"),
+            "label replaces derived title"
+        );
+        assert!(
+            out.contains("zsh  scratch"),
+            "unmanaged label shown after cmd"
+        );
+    }
+
     #[test]
     fn format_ls_tree_conversation_title_null_falls_back() {
         let panes = vec![make_pane(
@@ -872,7 +1043,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_tree(&panes, &branch_map, false);
+        let out = format_ls_tree(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("Claude"), "falls back to provider short name");
     }
 
@@ -961,7 +1132,10 @@ mod tests {
     fn format_ls_pane_empty() {
         let panes: Vec<serde_json::Value> = vec![];
         let branch_map = HashMap::new();
-        assert_eq!(format_ls_pane(&panes, &branch_map, false), "");
+        assert_eq!(
+            format_ls_pane(&panes, &branch_map, false, TimeFormat::Relative),
+            ""
+        );
     }
 
     #[test]
@@ -993,7 +1167,7 @@ mod tests {
             ),
         ];
         let branch_map = make_branch_map(&[("/repo", "feat/oauth")]);
-        let out = format_ls_pane(&panes, &branch_map, false);
+        let out = format_ls_pane(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("work:api"), "session:window location");
         assert!(out.contains("work:dev"), "session:window location");
         assert!(out.contains("Claude"), "provider short name");
@@ -1030,7 +1204,7 @@ mod tests {
             ),
         ];
         let branch_map = HashMap::new();
-        let out = format_ls_pane(&panes, &branch_map, false);
+        let out = format_ls_pane(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains("Claude"), "managed pane shown");
         assert!(!out.contains("zsh"), "unmanaged pane not shown");
     }
@@ -1050,7 +1224,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_pane(&panes, &branch_map, false);
+        let out = format_ls_pane(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(!out.contains('\x1b'), "no ANSI in no-color mode");
     }
 
@@ -1069,7 +1243,7 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_pane(&panes, &branch_map, false);
+        let out = format_ls_pane(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains('!'), "Waiting pane has ! marker");
     }
 
@@ -1088,7 +1262,130 @@ mod tests {
             "/repo",
         )];
         let branch_map = HashMap::new();
-        let out = format_ls_pane(&panes, &branch_map, false);
+        let out = format_ls_pane(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(out.contains('~'), "heuristic pane has ~ marker");
     }
+
+    // ── format_ls_columns tests ─────────────────────────────────────────
+
+    #[test]
+    fn parse_columns_accepts_names_and_aliases() {
+        let cols = parse_columns("pane, state,agent,label,AGE").expect("valid spec");
+        assert_eq!(
+            cols,
+            vec![
+                LsColumn::Pane,
+                LsColumn::State,
+                LsColumn::Agent,
+                LsColumn::Title,
+                LsColumn::Age
+            ]
+        );
+    }
+
+    #[test]
+    fn parse_columns_rejects_unknown_and_empty() {
+        let err = parse_columns("pane,bogus").expect_err("unknown column");
+        assert!(err.to_string().contains("bogus"));
+        assert!(parse_columns(" , ").is_err());
+    }
+
+    #[test]
+    fn format_ls_columns_selected_order() {
+        let panes = vec![
+            make_pane(
+                "%0",
+                "work",
+                "@0",
+                "api",
+                "managed",
+                Some("ClaudeCode"),
+                "deterministic",
+                "WaitingApproval",
+                "claude",
+                "/repo",
+            ),
+            make_pane(
+                "%12",
+                "work",
+                "@1",
+                "dev",
+                "managed",
+                Some("Codex"),
+                "heuristic",
+                "Running",
+                "codex",
+                "/repo",
+            ),
+            make_pane(
+                "%2",
+                "work",
+                "@2",
+                "zsh",
+                "unmanaged",
+                None,
+                "",
+                "",
+                "zsh",
+                "/",
+            ),
+        ];
+        let branch_map = make_branch_map(&[("/repo", "main")]);
+        let cols = [
+            LsColumn::Pane,
+            LsColumn::State,
+            LsColumn::Agent,
+            LsColumn::Branch,
+        ];
+        let out = format_ls_columns(&panes, &branch_map, &cols, false, TimeFormat::Relative);
+        let lines: Vec<&str> = out.lines().collect();
+        assert_eq!(lines.len(), 2, "only managed panes");
+        assert_eq!(lines[0], "%0   Waiting  Claude  [main]");
+        assert_eq!(lines[1], "%12  Running  Codex   [main]");
+    }
+
+    #[test]
+    fn format_ls_columns_marker_and_no_trailing_space() {
+        let panes = vec![make_pane(
+            "%0",
+            "work",
+            "@0",
+            "dev",
+            "managed",
+            Some("Codex"),
+            "heuristic",
+            "Idle",
+            "codex",
+            "/repo",
+        )];
+        let out = format_ls_columns(
+            &panes,
+            &HashMap::new(),
+            &[LsColumn::Location, LsColumn::Marker, LsColumn::Branch],
+            false,
+            TimeFormat::Relative,
+        );
+        assert_eq!(out, "work:dev  ~");
+    }
+
+    #[test]
+    fn format_ls_columns_colors_state() {
+        let panes = vec![make_pane(
+            "%0",
+            "work",
+            "@0",
+            "dev",
+            "managed",
+            Some("Codex"),
+            "deterministic",
+            "Running",
+            "codex",
+            "/repo",
+        )];
+        let cols = [LsColumn::State];
+        let colored = format_ls_columns(&panes, &HashMap::new(), &cols, true, TimeFormat::Relative);
+        assert!(colored.contains("\x1b[32mRunning"), "running is green");
+        let plain = format_ls_columns(&panes, &HashMap::new(), &cols, false, TimeFormat::Relative);
+        assert!(!plain.contains('\x1b'), "no ANSI in no-color mode");
+    }
 }
@@ -0,0 +1,170 @@
+//! `agtmux macro` — list and run the daemon's `[[macros]]`, or run steps
+//! from a file.
+
+use crate::cli::MacroCommand;
+use crate::client::{rpc_call, rpc_call_with_params};
+use crate::cmd_label::normalize_pane_id;
+
+/// Parse `key=value` arguments into `macro.run` params.
+pub(crate) fn parse_params(
+    args: &[String],
+) -> anyhow::Result<serde_json::Map<String, serde_json::Value>> {
+    args.iter()
+        .map(|arg| {
+            let (key, value) = arg
+                .split_once('=')
+                .filter(|(key, _)| !key.is_empty())
+                .ok_or_else(|| anyhow::anyhow!("macro parameter {arg:?} is not key=value"))?;
+            Ok((
+                key.to_string(),
+                serde_json::Value::String(value.to_string()),
+            ))
+        })
+        .collect()
+}
+
+/// The `steps` array of a pipeline file, as `macro.run` params.
+pub(crate) fn parse_steps_file(text: &str) -> anyhow::Result<serde_json::Value> {
+    #[derive(serde::Deserialize)]
+    #[serde(deny_unknown_fields)]
+    struct File {
+        steps: Vec<toml::Table>,
+    }
+    let file: File = toml::from_str(text)?;
+    Ok(serde_json::to_value(file.steps)?)
+}
+
+/// Render `macro.list` results as `name  params  description` lines.
+pub(crate) fn format_macro_list(macros: &serde_json::Value) -> String {
+    let entries = macros.as_array().map(Vec::as_slice).unwrap_or(&[]);
+    let width = entries
+        .iter()
+        .map(|e| e["name"].as_str().unwrap_or("").len())
+        .max()
+        .unwrap_or(0);
+    entries
+        .iter()
+        .map(|e| {
+            let name = e["name"].as_str().unwrap_or("?");
+            let params: Vec<String> = e["params"]
+                .as_array()
+                .map(Vec::as_slice)
+                .unwrap_or(&[])
+                .iter()
+                .filter_map(|p| p.as_str().map(|p| format!("{p}=")))
+                .collect();
+            let description = e["description"].as_str().unwrap_or("");
+            format!("{name:<width$}  {}  {description}", params.join(" "))
+                .trim_end()
+                .to_string()
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Entry point for `agtmux macro`.
+pub async fn cmd_macro(socket_path: &str, command: MacroCommand) -> anyhow::Result<()> {
+    match command {
+        MacroCommand::List => {
+            let macros = rpc_call(socket_path, "macro.list").await?;
+            let output = format_macro_list(&macros);
+            if !output.is_empty() {
+                println!("{output}");
+            }
+        }
+        MacroCommand::Run {
+            name,
+            pane,
+            params,
+            from_step,
+            request_ref,
+        } => {
+            let params = serde_json::json!({
+                "name": name,
+                "pane_id": normalize_pane_id(&pane),
+                "params": parse_params(&params)?,
+                "from_step": from_step,
+                "request_ref": request_ref,
+            });
+            run(socket_path, params).await?;
+        }
+        MacroCommand::Exec {
+            file,
+            pane,
+            params,
+            from_step,
+            request_ref,
+        } => {
+            let text = std::fs::read_to_string(&file)
+                .map_err(|e| anyhow::anyhow!("cannot read {}: {e}", file.display()))?;
+            let steps =
+                parse_steps_file(&text).map_err(|e| anyhow::anyhow!("{}: {e}", file.display()))?;
+            let params = serde_json::json!({
+                "name": file.file_stem().map(|s| s.to_string_lossy()),
+                "steps": steps,
+                "pane_id": normalize_pane_id(&pane),
+                "params": parse_params(&params)?,
+                "from_step": from_step,
+                "request_ref": request_ref,
+            });
+            run(socket_path, params).await?;
+        }
+    }
+    Ok(())
+}
+
+/// Call `macro.run` and print the lines its output steps captured.
+async fn run(socket_path: &str, params: serde_json::Value) -> anyhow::Result<()> {
+    let result = rpc_call_with_params(socket_path, "macro.run", params).await?;
+    for line in result["output"]
+        .as_array()
+        .map(Vec::as_slice)
+        .unwrap_or(&[])
+    {
+        println!("{}", line.as_str().unwrap_or(""));
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parse_params_splits_on_first_equals() {
+        let params = parse_params(&["next=a=b".to_string(), "dir=".to_string()]).expect("valid");
+        assert_eq!(params["next"], "a=b");
+        assert_eq!(params["dir"], "");
+        assert!(parse_params(&["novalue".to_string()]).is_err());
+        assert!(parse_params(&["=x".to_string()]).is_err());
+    }
+
+    #[test]
+    fn parses_steps_files() {
+        let steps = parse_steps_file(
+            "steps = [\n  { send = \"go\" },\n  { wait = \"WaitingInput\", timeout_secs = 30 },\n  { key = \"y\" },\n]\n",
+        )
+        .expect("valid");
+        assert_eq!(
+            steps,
+            serde_json::json!([
+                {"send": "go"},
+                {"wait": "WaitingInput", "timeout_secs": 30},
+                {"key": "y"},
+            ])
+        );
+        assert!(parse_steps_file("[[macros]]\nname = \"m\"\n").is_err());
+    }
+
+    #[test]
+    fn format_macro_list_shows_params() {
+        let macros = serde_json::json!([
+            {"name": "approve", "description": "approve and continue", "params": [], "steps": 3},
+            {"name": "go", "description": null, "params": ["dir", "next"], "steps": 2},
+        ]);
+        assert_eq!(
+            format_macro_list(&macros),
+            "approve    approve and continue\ngo       dir= next="
+        );
+    }
+}
@@ -0,0 +1,461 @@
+//! `agtmux mcp` — a Model Context Protocol server on stdio, so an
+//! orchestrating agent (Claude Desktop, another CLI agent) can list, read,
+//! drive and stop the agents agtmux tracks.
+//!
+//! Messages are newline-delimited JSON-RPC 2.0. Tools:
+//!
+//! - `list_panes {agent?, state?, session?}` — managed agent panes
+//! - `view_output {pane, lines?, since?}` — the pane's recent terminal
+//!   output (`pane.output`), ending with a `[cursor ...]` line; with that
+//!   cursor as `since`, only the output printed after it
+//! - `send {pane, text, enter?}` — type text into a pane (`pane.send`)
+//! - `attach {pane}` — switch the user's tmux client to the pane
+//! - `kill {pane, force?}` — kill a pane (`pane.kill`)
+//! - `watch_state {pane, states?, timeout_secs?}` — block until the pane
+//!   reaches one of `states` (default: leaves its current state)
+//!
+//! `pane` is a pane id or a selector (`latest:codex`, `label=review`).
+//! `attach` runs tmux locally, like `agtmux dash`; the rest go through the
+//! daemon.
+
+use std::sync::Arc;
+use std::time::Duration;
+
+use agtmux_client::{Client, SendBatch, WatchLoop};
+use serde_json::{Value, json};
+use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
+
+use crate::client::client_for;
+use crate::cmd_label::normalize_pane_id;
+use crate::selector::{self, Selector};
+
+/// Protocol revision answered to `initialize`.
+const PROTOCOL_VERSION: &str = "2024-11-05";
+
+/// `watch_state` default timeout.
+const DEFAULT_WATCH_SECS: u64 = 300;
+
+/// Re-check interval when the daemon has no `watch` stream.
+const POLL_INTERVAL: Duration = Duration::from_secs(2);
+
+/// Tool definitions for `tools/list`.
+fn tools() -> Value {
+    let pane = json!({
+        "type": "string",
+        "description": "Pane id (%3) or selector (latest:codex, label=review, session=proj agent=claude)",
+    });
+    json!([
+        {
+            "name": "list_panes",
+            "description": "List the AI agent panes agtmux tracks, with provider, activity state and title.",
+            "inputSchema": {
+                "type": "object",
+                "properties": {
+                    "agent": {"type": "string", "description": "Only this provider (claude, codex, ...)"},
+                    "state": {"type": "string", "description": "Only this state (running, idle, waiting_input, waiting_approval, error)"},
+                    "session": {"type": "string", "description": "Only this tmux session"},
+                },
+            },
+        },
+        {
+            "name": "view_output",
+            "description": "Read the most recent terminal output of a pane. The reply ends with a [cursor ...] line; pass that cursor as since to read only the output printed after it.",
+            "inputSchema": {
+                "type": "object",
+                "properties": {
+                    "pane": pane,
+                    "lines": {"type": "integer", "description": "Lines to capture (default 50)"},
+                    "since": {"type": "string", "description": "Cursor from an earlier view_output of this pane"},
+                },
+                "required": ["pane"],
+            },
+        },
+        {
+            "name": "send",
+            "description": "Type text into a pane, followed by Enter unless enter is false.",
+            "inputSchema": {
+                "type": "object",
+                "properties": {
+                    "pane": pane,
+                    "text": {"type": "string"},
+                    "enter": {"type": "boolean", "description": "Press Enter after the text (default true)"},
+                },
+                "required": ["pane", "text"],
+            },
+        },
+        {
+            "name": "attach",
+            "description": "Switch the user's tmux client to a pane.",
+            "inputSchema": {
+                "type": "object",
+                "properties": {"pane": pane},
+                "required": ["pane"],
+            },
+        },
+        {
+            "name": "kill",
+            "description": "Kill a pane. A busy agent is refused unless force is true.",
+            "inputSchema": {
+                "type": "object",
+                "properties": {
+                    "pane": pane,
+                    "force": {"type": "boolean"},
+                },
+                "required": ["pane"],
+            },
+        },
+        {
+            "name": "watch_state",
+            "description": "Wait until a pane's agent reaches one of the given states (default: any state other than the current one) and return the pane.",
+            "inputSchema": {
+                "type": "object",
+                "properties": {
+                    "pane": pane,
+                    "states": {"type": "array", "items": {"type": "string"}},
+                    "timeout_secs": {"type": "integer", "description": "Give up after this long (default 300)"},
+                },
+                "required": ["pane"],
+            },
+        },
+    ])
+}
+
+/// Response to one incoming message; None for notifications.
+async fn handle(client: &Client, message: &Value) -> Option<Value> {
+    let id = message.get("id").cloned()?;
+    let method = message["method"].as_str().unwrap_or("");
+    let outcome = match method {
+        "initialize" => Ok(json!({
+            "protocolVersion": PROTOCOL_VERSION,
+            "capabilities": {"tools": {}},
+            "serverInfo": {"name": "agtmux", "version": env!("CARGO_PKG_VERSION")},
+        })),
+        "ping" => Ok(json!({})),
+        "tools/list" => Ok(json!({"tools": tools()})),
+        "tools/call" => {
+            let name = message["params"]["name"].as_str().unwrap_or("");
+            let args = &message["params"]["arguments"];
+            Ok(match call_tool(client, name, args).await {
+                Ok(text) => json!({"content": [{"type": "text", "text": text}]}),
+                Err(e) => json!({
+                    "content": [{"type": "text", "text": format!("{e:#}")}],
+                    "isError": true,
+                }),
+            })
+        }
+        _ => Err(json!({"code": -32601, "message": format!("method not found: {method}")})),
+    };
+    Some(match outcome {
+        Ok(result) => json!({"jsonrpc": "2.0", "id": id, "result": result}),
+        Err(error) => json!({"jsonrpc": "2.0", "id": id, "error": error}),
+    })
+}
+
+async fn call_tool(client: &Client, name: &str, args: &Value) -> anyhow::Result<String> {
+    let str_arg = |key: &str| args[key].as_str().filter(|s| !s.is_empty());
+    let pane = || str_arg("pane").ok_or_else(|| anyhow::anyhow!("pane is required"));
+    match name {
+        "list_panes" => {
+            let panes = client.list_panes().await?;
+            let listed: Vec<Value> = panes
+                .iter()
+                .filter(|p| p["presence"].as_str() == Some("managed"))
+                .filter(|p| pane_matches(p, str_arg("agent"), str_arg("state"), str_arg("session")))
+                .map(summarize)
+                .collect();
+            Ok(serde_json::to_string_pretty(&listed)?)
+        }
+        "view_output" => {
+            let pane_id = resolve_pane(client, pane()?).await?;
+            let output = client
+                .pane_output(&pane_id, args["lines"].as_u64(), str_arg("since"))
+                .await?;
+            let mut text = output.lines.join("\n");
+            if !output.full && text.is_empty() {
+                text = "(no new output)".to_string();
+            } else if output.full && str_arg("since").is_some() {
+                text.insert_str(0, "(earlier output no longer on screen; showing all)\n");
+            }
+            Ok(format!("{}\n[cursor {}]", text.trim_end(), output.cursor))
+        }
+        "send" => {
+            let text = args["text"]
+                .as_str()
+                .ok_or_else(|| anyhow::anyhow!("text is required"))?;
+            let result = client
+                .send_batch(&SendBatch {
+                    pane_ids: vec![normalize_pane_id(pane()?)],
+                    text: text.to_string(),
+                    no_enter: args["enter"].as_bool() == Some(false),
+                    ..Default::default()
+                })
+                .await?;
+            Ok(serde_json::to_string_pretty(&result)?)
+        }
+        "attach" => {
+            let pane_id = resolve_pane(client, pane()?).await?;
+            tmux(&["switch-client", "-t", &pane_id])?;
+            Ok(format!("switched to {pane_id}"))
+        }
+        "kill" => {
+            let force = args["force"].as_bool().unwrap_or(false);
+            let result = client
+                .kill_pane(&normalize_pane_id(pane()?), false, force, None)
+                .await?;
+            Ok(serde_json::to_string_pretty(&result)?)
+        }
+        "watch_state" => {
+            let pane_id = resolve_pane(client, pane()?).await?;
+            let states: Vec<String> = args["states"]
+                .as_array()
+                .map(Vec::as_slice)
+                .unwrap_or(&[])
+                .iter()
+                .filter_map(Value::as_str)
+                .map(String::from)
+                .collect();
+            let timeout =
+                Duration::from_secs(args["timeout_secs"].as_u64().unwrap_or(DEFAULT_WATCH_SECS));
+            watch_state(client, &pane_id, &states, timeout).await
+        }
+        _ => anyhow::bail!("unknown tool {name:?}"),
+    }
+}
+
+/// Whether a `list_panes` entry passes the `list_panes` tool filters.
+fn pane_matches(
+    pane: &Value,
+    agent: Option<&str>,
+    state: Option<&str>,
+    session: Option<&str>,
+) -> bool {
+    let field = |name: &str| pane[name].as_str();
+    let key = |s: &str| s.replace('_', "").to_lowercase();
+    agent.is_none_or(|a| field("provider") == Some(a) || field("adapter") == Some(a))
+        && state.is_none_or(|s| field("activity_state").is_some_and(|v| key(v) == key(s)))
+        && session.is_none_or(|s| field("session_name") == Some(s))
+}
+
+/// The fields of a pane an orchestrator needs, without the evidence detail.
+fn summarize(pane: &Value) -> Value {
+    let mut summary = serde_json::Map::new();
+    for key in [
+        "pane_id",
+        "session_name",
+        "window_name",
+        "provider",
+        "adapter",
+        "activity_state",
+        "title",
+        "label",
+        "current_path",
+        "git_branch",
+    ] {
+        if let Some(value) = pane.get(key).filter(|v| !v.is_null()) {
+            summary.insert(key.to_string(), value.clone());
+        }
+    }
+    Value::Object(summary)
+}
+
+/// Pane id for a pane id or selector argument.
+async fn resolve_pane(client: &Client, pane: &str) -> anyhow::Result<String> {
+    let pane = normalize_pane_id(pane);
+    if !selector::is_selector(&pane) {
+        return Ok(pane);
+    }
+    let panes = Value::Array(client.list_panes().await?);
+    Ok(Selector::parse(&pane)?.resolve(&pane, &panes)?)
+}
+
+/// Wait for `pane_id` to enter one of `states` (or leave its current state
+/// when empty), re-checking on every `watch` frame.
+async fn watch_state(
+    client: &Client,
+    pane_id: &str,
+    states: &[String],
+    timeout: Duration,
+) -> anyhow::Result<String> {
+    let key = |s: &str| s.replace('_', "").to_lowercase();
+    let find = |panes: Vec<Value>| {
+        panes
+            .into_iter()
+            .find(|p| p["pane_id"].as_str() == Some(pane_id))
+            .ok_or_else(|| anyhow::anyhow!("pane {pane_id} is gone"))
+    };
+    let state_of = |pane: &Value| pane["activity_state"].as_str().unwrap_or("").to_string();
+    let initial = state_of(&find(client.list_panes().await?)?);
+    let reached = |state: &str| {
+        if states.is_empty() {
+            state != initial
+        } else {
+            states.iter().any(|s| key(s) == key(state))
+        }
+    };
+
+    let mut watch = Some(WatchLoop::new(client.clone()).summary_only());
+    let deadline = tokio::time::Instant::now() + timeout;
+    loop {
+        let pane = find(client.list_panes().await?)?;
+        if reached(&state_of(&pane)) {
+            return Ok(serde_json::to_string_pretty(&summarize(&pane))?);
+        }
+        tokio::select! {
+            update = crate::cmd_watch::next_update(&mut watch) => {
+                if update.is_err() {
+                    watch = None;
+                }
+            }
+            _ = tokio::time::sleep(POLL_INTERVAL), if watch.is_none() => {}
+            _ = tokio::time::sleep_until(deadline) => {
+                anyhow::bail!(
+                    "timed out after {}s; pane {pane_id} is {}",
+                    timeout.as_secs(),
+                    state_of(&pane)
+                );
+            }
+        }
+    }
+}
+
+fn tmux(args: &[&str]) -> anyhow::Result<String> {
+    let output = std::process::Command::new("tmux").args(args).output()?;
+    if !output.status.success() {
+        anyhow::bail!("{}", String::from_utf8_lossy(&output.stderr).trim());
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).into_owned())
+}
+
+/// Entry point for `agtmux mcp`. Serves until stdin closes (answering the
+/// requests still running); requests run concurrently, so a `watch_state`
+/// call does not block the others.
+pub async fn cmd_mcp(socket_path: &str) -> anyhow::Result<()> {
+    let client = client_for(socket_path);
+    let stdout = Arc::new(tokio::sync::Mutex::new(tokio::io::stdout()));
+    let mut lines = BufReader::new(tokio::io::stdin()).lines();
+    let mut requests = tokio::task::JoinSet::new();
+    while let Some(line) = lines.next_line().await? {
+        if line.trim().is_empty() {
+            continue;
+        }
+        let message: Value = match serde_json::from_str(&line) {
+            Ok(message) => message,
+            Err(e) => {
+                let error = json!({
+                    "jsonrpc": "2.0",
+                    "id": null,
+                    "error": {"code": -32700, "message": format!("parse error: {e}")},
+                });
+                write_line(&stdout, &error).await?;
+                continue;
+            }
+        };
+        let client = client.clone();
+        let stdout = Arc::clone(&stdout);
+        while requests.try_join_next().is_some() {}
+        requests.spawn(async move {
+            if let Some(response) = handle(&client, &message).await
+                && let Err(e) = write_line(&stdout, &response).await
+            {
+                tracing::warn!("mcp: cannot write response: {e}");
+            }
+        });
+    }
+    while requests.join_next().await.is_some() {}
+    Ok(())
+}
+
+async fn write_line(
+    stdout: &tokio::sync::Mutex<tokio::io::Stdout>,
+    message: &Value,
+) -> std::io::Result<()> {
+    let mut stdout = stdout.lock().await;
+    stdout.write_all(format!("{message}\n").as_bytes()).await?;
+    stdout.flush().await
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn request(method: &str, params: Value) -> Value {
+        json!({"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+    }
+
+    #[tokio::test]
+    async fn answers_protocol_requests() {
+        let client = Client::new("/nonexistent/agtmux.sock");
+        let init = handle(&client, &request("initialize", json!({})))
+            .await
+            .expect("response");
+        assert_eq!(init["result"]["protocolVersion"], PROTOCOL_VERSION);
+        assert_eq!(init["result"]["serverInfo"]["name"], "agtmux");
+
+        let list = handle(&client, &request("tools/list", json!({})))
+            .await
+            .expect("response");
+        let names: Vec<&str> = list["result"]["tools"]
+            .as_array()
+            .expect("tools")
+            .iter()
+            .map(|t| t["name"].as_str().expect("name"))
+            .collect();
+        assert_eq!(
+            names,
+            [
+                "list_panes",
+                "view_output",
+                "send",
+                "attach",
+                "kill",
+                "watch_state"
+            ]
+        );
+
+        let notification = json!({"jsonrpc": "2.0", "method": "notifications/initialized"});
+        assert!(handle(&client, &notification).await.is_none());
+        let unknown = handle(&client, &request("resources/list", json!({})))
+            .await
+            .expect("response");
+        assert_eq!(unknown["error"]["code"], -32601);
+    }
+
+    #[tokio::test]
+    async fn tool_failures_are_tool_errors() {
+        let client = Client::new("/nonexistent/agtmux.sock");
+        let call = |name: &str, args: Value| {
+            request("tools/call", json!({"name": name, "arguments": args}))
+        };
+        let missing = handle(&client, &call("send", json!({"text": "hi"})))
+            .await
+            .expect("response");
+        assert_eq!(missing["result"]["isError"], true);
+        assert_eq!(missing["result"]["content"][0]["text"], "pane is required");
+        let unknown = handle(&client, &call("reboot", json!({})))
+            .await
+            .expect("response");
+        assert_eq!(unknown["result"]["isError"], true);
+    }
+
+    #[test]
+    fn filters_and_summarizes_panes() {
+        let pane = json!({
+            "pane_id": "%3", "session_name": "proj", "provider": "custom", "adapter": "devbot",
+            "activity_state": "WaitingInput", "label": null, "evidence_mode": "heuristic",
+        });
+        assert!(pane_matches(
+            &pane,
+            Some("devbot"),
+            Some("waiting_input"),
+            Some("proj")
+        ));
+        assert!(pane_matches(&pane, Some("custom"), None, None));
+        assert!(!pane_matches(&pane, Some("codex"), None, None));
+        assert!(!pane_matches(&pane, None, Some("idle"), None));
+        assert_eq!(
+            summarize(&pane),
+            json!({"pane_id": "%3", "session_name": "proj", "provider": "custom",
+                "adapter": "devbot", "activity_state": "WaitingInput"})
+        );
+    }
+}
@@ -0,0 +1,426 @@
+//! `agtmux pane` — pane lifecycle actions (`pane.*` / `window.kill` RPCs).
+
+use crate::cli::{PaneCommand, PaneOpts, PendingCommand};
+use crate::client::rpc_call_with_params;
+use crate::cmd_label::normalize_pane_id;
+
+/// RPC method and params for a `pane` subcommand.
+pub(crate) fn action_request(opts: PaneOpts) -> (&'static str, serde_json::Value) {
+    let (method, mut params) = match opts.command {
+        PaneCommand::NewWindow {
+            session,
+            name,
+            cwd,
+            command,
+        } => (
+            "pane.new_window",
+            serde_json::json!({"session": session, "name": name, "cwd": cwd, "command": command}),
+        ),
+        PaneCommand::Split {
+            pane,
+            horizontal,
+            cwd,
+            command,
+        } => (
+            "pane.split",
+            serde_json::json!({
+                "pane_id": normalize_pane_id(&pane),
+                "direction": if horizontal { "horizontal" } else { "vertical" },
+                "cwd": cwd,
+                "command": command,
+            }),
+        ),
+        PaneCommand::Kill {
+            pane,
+            window,
+            force,
+        } => (
+            if window { "window.kill" } else { "pane.kill" },
+            serde_json::json!({"pane_id": normalize_pane_id(&pane), "force": force}),
+        ),
+        PaneCommand::Transcript { pane, archive } => (
+            "pane.transcript",
+            serde_json::json!({
+                "pane_id": normalize_pane_id(&pane),
+                // The daemon resolves paths itself, so relative ones are made
+                // absolute against the caller's cwd.
+                "archive_dir": archive.map(|dir| std::path::absolute(&dir).unwrap_or(dir)),
+            }),
+        ),
+        PaneCommand::Respawn {
+            pane,
+            kill,
+            command,
+        } => (
+            "pane.respawn",
+            serde_json::json!({"pane_id": normalize_pane_id(&pane), "kill": kill, "command": command}),
+        ),
+        PaneCommand::Send {
+            text,
+            pane,
+            session,
+            state,
+            agent,
+            key,
+            no_enter,
+            at,
+            after,
+        } => {
+            let mut params = serde_json::json!({
+                "text": text,
+                "key": key,
+                "enter": !no_enter && key.is_none(),
+                "at": at,
+                "after": after,
+            });
+            if pane.is_empty() {
+                params["session"] = session.into();
+                params["state"] = state.into();
+                params["agent"] = agent.into();
+            } else {
+                let pane_ids: Vec<String> = pane.iter().map(|p| normalize_pane_id(p)).collect();
+                params["pane_ids"] = pane_ids.into();
+            }
+            ("pane.send", params)
+        }
+        PaneCommand::Restart {
+            pane,
+            if_state,
+            command,
+        } => (
+            "pane.restart",
+            serde_json::json!({
+                "pane_id": normalize_pane_id(&pane),
+                "if_state": if_state,
+                "command": command,
+            }),
+        ),
+        PaneCommand::Run {
+            agent,
+            prompt,
+            session,
+            pane,
+            reuse_idle,
+            cwd,
+            command,
+        } => (
+            "pane.run",
+            serde_json::json!({
+                "agent": agent,
+                "prompt": prompt,
+                "session": session,
+                "pane_id": pane.as_deref().map(normalize_pane_id),
+                "reuse_idle": reuse_idle,
+                "cwd": cwd,
+                "command": command,
+            }),
+        ),
+        PaneCommand::History {
+            since,
+            pane,
+            action,
+            limit,
+        } => {
+            let params = serde_json::json!({
+                "since": since,
+                "target": pane.as_deref().map(normalize_pane_id),
+                "action_type": action,
+                "limit": limit,
+            });
+            return ("actions.history", params);
+        }
+        PaneCommand::Pending { command } => {
+            return match command.unwrap_or(PendingCommand::Ls) {
+                PendingCommand::Ls => ("schedule.list", serde_json::json!({})),
+                PendingCommand::Cancel { id } => ("schedule.cancel", serde_json::json!({"id": id})),
+            };
+        }
+    };
+    params["request_ref"] = opts.request_ref.into();
+    (method, params)
+}
+
+/// Render `actions.history` as one line per entry: time, caller, method,
+/// panes, outcome and what was sent.
+pub(crate) fn format_history(entries: &serde_json::Value) -> String {
+    let str_of = |v: &serde_json::Value| v.as_str().unwrap_or("").to_string();
+    entries
+        .as_array()
+        .map(Vec::as_slice)
+        .unwrap_or(&[])
+        .iter()
+        .map(|entry| {
+            let actor = &entry["actor"];
+            let mut who = format!("uid {}", actor["uid"]);
+            if let Some(token) = actor["token"].as_str() {
+                who += &format!(" ({token})");
+            }
+            let mut targets: Vec<String> = entry["targets"]
+                .as_array()
+                .into_iter()
+                .flatten()
+                .map(str_of)
+                .collect();
+            if let Some(group) = entry["group"].as_str() {
+                targets.insert(0, format!("group {group}"));
+            }
+            let outcome = match (entry["ok"].as_bool(), entry["replayed"].as_bool()) {
+                (Some(true), Some(true)) => "ok (replayed)".to_string(),
+                (Some(true), _) => "ok".to_string(),
+                _ => format!("error: {}", str_of(&entry["error"])),
+            };
+            let detail: Vec<String> = entry["detail"]
+                .as_object()
+                .into_iter()
+                .flatten()
+                .map(|(key, value)| format!("{key}={value}"))
+                .collect();
+            format!(
+                "{}  {who}  {}  {}  {outcome}  {}",
+                str_of(&entry["at"]),
+                str_of(&entry["method"]),
+                if targets.is_empty() {
+                    "-".to_string()
+                } else {
+                    targets.join(",")
+                },
+                detail.join(" ")
+            )
+            .trim_end()
+            .to_string()
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Render `schedule.list` as `#id  due  targets  text / key` lines.
+pub(crate) fn format_pending(pending: &serde_json::Value) -> String {
+    pending
+        .as_array()
+        .map(Vec::as_slice)
+        .unwrap_or(&[])
+        .iter()
+        .map(|entry| {
+            let params = &entry["params"];
+            let targets = match params["pane_ids"].as_array() {
+                Some(ids) => ids
+                    .iter()
+                    .filter_map(|id| id.as_str())
+                    .collect::<Vec<_>>()
+                    .join(","),
+                None => ["session", "state", "agent"]
+                    .iter()
+                    .filter(|key| !params[**key].is_null())
+                    .filter(|key| params[**key].as_array().is_none_or(|a| !a.is_empty()))
+                    .map(|key| format!("{key}={}", params[*key]))
+                    .collect::<Vec<_>>()
+                    .join(" "),
+            };
+            let what = match params["key"].as_str() {
+                Some(key) => format!("key={key}"),
+                None => format!("text={}", params["text"]),
+            };
+            format!(
+                "#{}  {}  {}  {what}",
+                entry["id"],
+                entry["due"].as_str().unwrap_or(""),
+                if targets.is_empty() { "-" } else { &targets }
+            )
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Entry point for `agtmux pane`. Creating actions print the new pane id and
+/// its `session:window.pane` address, `restart` the relaunched command,
+/// `send` the panes reached (failing if any pane failed), `transcript` the
+/// markdown or the archived file, `history` one line per recorded action,
+/// a scheduled `send` its id and due time, `pending` one line per send.
+pub async fn cmd_pane(socket_path: &str, opts: PaneOpts) -> anyhow::Result<()> {
+    let (method, params) = action_request(opts);
+    let result = rpc_call_with_params(socket_path, method, params).await?;
+    if method == "actions.history" || method == "schedule.list" {
+        let text = if method == "schedule.list" {
+            format_pending(&result)
+        } else {
+            format_history(&result)
+        };
+        if !text.is_empty() {
+            println!("{text}");
+        }
+        return Ok(());
+    }
+    if method == "schedule.cancel" {
+        return Ok(());
+    }
+    if let Some(id) = result["id"].as_u64()
+        && let Some(due) = result["due"].as_str()
+    {
+        println!("scheduled #{id} at {due}");
+        return Ok(());
+    }
+    if method == "pane.transcript" {
+        match result["archive_path"].as_str() {
+            Some(path) => println!("{path}"),
+            None => print!("{}", result["markdown"].as_str().unwrap_or("")),
+        }
+        return Ok(());
+    }
+    if method == "pane.send" {
+        for pane_id in result["panes"].as_array().into_iter().flatten() {
+            println!("{}", pane_id.as_str().unwrap_or("?"));
+        }
+        if let Some(failed) = result["failed"].as_object()
+            && !failed.is_empty()
+        {
+            for (pane_id, error) in failed {
+                eprintln!("{pane_id}: {}", error.as_str().unwrap_or(""));
+            }
+            anyhow::bail!("failed on {} pane(s)", failed.len());
+        }
+        return Ok(());
+    }
+    if let Some(pane_id) = result["pane_id"].as_str() {
+        match (method, result["address"].as_str()) {
+            ("pane.run" | "pane.new_window" | "pane.split", Some(address)) => {
+                println!("{pane_id} {address}")
+            }
+            ("pane.run" | "pane.new_window" | "pane.split", None) => println!("{pane_id}"),
+            ("pane.restart", _) => {
+                println!("{pane_id} {}", result["command"].as_str().unwrap_or(""))
+            }
+            _ => {}
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn action_request_maps_subcommands() {
+        let (method, params) = action_request(PaneOpts {
+            request_ref: Some("r1".to_string()),
+            command: PaneCommand::Kill {
+                pane: "12".to_string(),
+                window: true,
+                force: false,
+            },
+        });
+        assert_eq!(method, "window.kill");
+        assert_eq!(
+            params,
+            serde_json::json!({"pane_id": "%12", "force": false, "request_ref": "r1"})
+        );
+
+        let (method, params) = action_request(PaneOpts {
+            request_ref: None,
+            command: PaneCommand::Split {
+                pane: "%3".to_string(),
+                horizontal: true,
+                cwd: None,
+                command: Some("codex".to_string()),
+            },
+        });
+        assert_eq!(method, "pane.split");
+        assert_eq!(params["direction"], "horizontal");
+        assert_eq!(params["command"], "codex");
+        assert!(params["request_ref"].is_null());
+
+        let send = |pane: Vec<String>, key: Option<String>| {
+            action_request(PaneOpts {
+                request_ref: None,
+                command: PaneCommand::Send {
+                    text: key.is_none().then(|| "run the tests".to_string()),
+                    pane,
+                    session: None,
+                    state: vec!["idle".to_string()],
+                    agent: Some("claude".to_string()),
+                    key,
+                    no_enter: false,
+                    at: None,
+                    after: Some("10m".to_string()),
+                },
+            })
+        };
+        let (method, params) = send(Vec::new(), None);
+        assert_eq!(method, "pane.send");
+        assert_eq!(params["state"], serde_json::json!(["idle"]));
+        assert_eq!(params["agent"], "claude");
+        assert_eq!(params["enter"], true);
+        assert_eq!(params["after"], "10m");
+        let (_, params) = send(
+            vec!["3".to_string(), "%4".to_string()],
+            Some("C-c".to_string()),
+        );
+        assert_eq!(params["pane_ids"], serde_json::json!(["%3", "%4"]));
+        assert_eq!(params["enter"], false);
+        assert!(
+            params["state"].is_null(),
+            "filter ignored with explicit panes"
+        );
+
+        let (method, params) = action_request(PaneOpts {
+            request_ref: None,
+            command: PaneCommand::History {
+                since: Some("2h".to_string()),
+                pane: Some("3".to_string()),
+                action: None,
+                limit: Some(20),
+            },
+        });
+        assert_eq!(method, "actions.history");
+        assert_eq!(
+            params,
+            serde_json::json!({"since": "2h", "target": "%3", "action_type": null, "limit": 20})
+        );
+
+        let pending = |command| {
+            action_request(PaneOpts {
+                request_ref: None,
+                command: PaneCommand::Pending { command },
+            })
+        };
+        assert_eq!(pending(None).0, "schedule.list");
+        assert_eq!(
+            pending(Some(PendingCommand::Cancel { id: 4 })),
+            ("schedule.cancel", serde_json::json!({"id": 4}))
+        );
+    }
+
+    #[test]
+    fn formats_history() {
+        let entries = serde_json::json!([
+            {"at": "2026-10-15T07:00:00Z", "method": "pane.send",
+                "actor": {"uid": 1000, "pid": 7, "client": "agtmux/0.1.0", "token": "ops"},
+                "targets": ["%1", "%2"], "group": null, "detail": {"text": "yes"},
+                "ok": true, "error": null, "replayed": false},
+            {"at": "2026-10-15T07:01:00Z", "method": "group.kill",
+                "actor": {"uid": 1001, "pid": null, "client": null, "token": null},
+                "targets": [], "group": "api", "detail": {},
+                "ok": false, "error": "busy agent", "replayed": false},
+        ]);
+        assert_eq!(
+            format_history(&entries),
+            "2026-10-15T07:00:00Z  uid 1000 (ops)  pane.send  %1,%2  ok  text=\"yes\"\n\
+             2026-10-15T07:01:00Z  uid 1001  group.kill  group api  error: busy agent"
+        );
+    }
+
+    #[test]
+    fn formats_pending_sends() {
+        let pending = serde_json::json!([
+            {"id": 2, "due": "2026-10-15T08:00:00Z",
+                "params": {"pane_ids": ["%1", "%2"], "text": "go", "enter": true}},
+            {"id": 5, "due": "2026-10-15T09:30:00Z",
+                "params": {"session": null, "state": ["idle"], "agent": "claude", "key": "C-c"}},
+        ]);
+        assert_eq!(
+            format_pending(&pending),
+            "#2  2026-10-15T08:00:00Z  %1,%2  text=\"go\"\n\
+             #5  2026-10-15T09:30:00Z  state=[\"idle\"] agent=\"claude\"  key=C-c"
+        );
+    }
+}
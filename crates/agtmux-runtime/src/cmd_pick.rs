@@ -6,7 +6,8 @@ use std::process::{Command, Stdio};
 
 use crate::client::rpc_call;
 use crate::context::{
-    build_branch_map, provider_short, relative_time, resolve_color, truncate_branch,
+    TimeFormat, build_branch_map, format_updated_at, pane_title, provider_short, resolve_color,
+    truncate_branch,
 };
 
 /// Normalize WaitingInput/WaitingApproval to "Waiting" for display.
@@ -17,18 +18,6 @@ fn display_state(state: &str) -> &str {
     }
 }
 
-/// Age string from updated_at ISO timestamp.
-fn age_from_updated_at(pane: &serde_json::Value) -> String {
-    pane["updated_at"]
-        .as_str()
-        .and_then(|s| chrono::DateTime::parse_from_rfc3339(s).ok())
-        .map(|dt| {
-            let secs = (chrono::Utc::now() - dt.with_timezone(&chrono::Utc)).num_seconds();
-            relative_time(secs)
-        })
-        .unwrap_or_default()
-}
-
 /// Build candidate lines for the pick command.
 ///
 /// Each line: `session:window  marker provider  state  title  [branch]  age`
@@ -36,6 +25,7 @@ pub(crate) fn format_pick_candidates(
     panes: &[serde_json::Value],
     branch_map: &HashMap<String, String>,
     waiting_only: bool,
+    time: TimeFormat,
 ) -> Vec<String> {
     // Only managed panes
     let managed: Vec<&serde_json::Value> = panes
@@ -97,11 +87,8 @@ pub(crate) fn format_pick_candidates(
         let evidence = pane["evidence_mode"].as_str().unwrap_or("");
         let is_heur = evidence != "deterministic";
         let state = display_state(pane["activity_state"].as_str().unwrap_or("?"));
-        let title = pane["conversation_title"]
-            .as_str()
-            .filter(|s| !s.is_empty())
-            .unwrap_or_else(|| provider_short(provider));
-        let age = age_from_updated_at(pane);
+        let title = pane_title(pane);
+        let age = format_updated_at(pane, time);
 
         let marker = if state == "Waiting" {
             "!"
@@ -141,6 +128,7 @@ pub async fn cmd_pick(
     dry_run: bool,
     waiting_only: bool,
     color: &str,
+    time: TimeFormat,
 ) -> anyhow::Result<()> {
     let _use_color = resolve_color(color);
 
@@ -148,7 +136,7 @@ pub async fn cmd_pick(
     let arr = panes.as_array().cloned().unwrap_or_default();
     let branch_map = build_branch_map(&arr);
 
-    let candidates = format_pick_candidates(&arr, &branch_map, waiting_only);
+    let candidates = format_pick_candidates(&arr, &branch_map, waiting_only, time);
 
     if candidates.is_empty() {
         if waiting_only {
@@ -270,7 +258,7 @@ mod tests {
     fn format_pick_candidates_empty() {
         let panes: Vec<serde_json::Value> = vec![];
         let branch_map = HashMap::new();
-        let result = format_pick_candidates(&panes, &branch_map, false);
+        let result = format_pick_candidates(&panes, &branch_map, false, TimeFormat::Relative);
         assert!(result.is_empty());
     }
 
@@ -297,7 +285,7 @@ mod tests {
         ];
         let branch_map: HashMap<String, String> =
             [("/repo".to_string(), "main".to_string())].into();
-        let result = format_pick_candidates(&panes, &branch_map, false);
+        let result = format_pick_candidates(&panes, &branch_map, false, TimeFormat::Relative);
 
         assert_eq!(result.len(), 2, "only managed panes");
         assert!(result[0].contains("work:api"), "session:window present");
@@ -338,7 +326,7 @@ mod tests {
             ),
         ];
         let branch_map = HashMap::new();
-        let result = format_pick_candidates(&panes, &branch_map, true);
+        let result = format_pick_candidates(&panes, &branch_map, true, TimeFormat::Relative);
 
         assert_eq!(result.len(), 1, "only waiting panes");
         assert!(result[0].contains("work:api"), "waiting pane included");
@@ -0,0 +1,196 @@
+//! `agtmux recording` — list and replay pane output recorded by the
+//! daemon's `[recorder]` (`recording.list`, `recording.replay`).
+
+use crate::cli::RecordingCommand;
+use crate::client::rpc_call_with_params;
+use crate::cmd_label::normalize_pane_id;
+
+/// One line per recording: runtime, pane, place, agent, size, last write.
+pub(crate) fn format_list(recordings: &serde_json::Value) -> String {
+    let str_of = |v: &serde_json::Value| v.as_str().unwrap_or("-").to_string();
+    recordings
+        .as_array()
+        .into_iter()
+        .flatten()
+        .map(|r| {
+            let bytes = r["bytes"].as_u64().unwrap_or(0);
+            let size = if bytes >= 1024 {
+                format!("{:.1} KiB", bytes as f64 / 1024.0)
+            } else {
+                format!("{bytes} B")
+            };
+            format!(
+                "{}  {}  {}:{}  {}  {size}  {}",
+                str_of(&r["runtime"]),
+                str_of(&r["pane_id"]),
+                str_of(&r["session_name"]),
+                str_of(&r["window_name"]),
+                str_of(&r["provider"]),
+                str_of(&r["updated_at"]),
+            )
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// The recorded rows in order, with a marker where output may be missing
+/// and the last screen at the end.
+pub(crate) fn format_replay(replay: &serde_json::Value) -> String {
+    let str_of = |v: &serde_json::Value| v.as_str().unwrap_or("").to_string();
+    let mut out = Vec::new();
+    if let Some(n) = replay["truncated"].as_u64().filter(|n| *n > 0) {
+        out.push(format!("--- {n} older lines left out ---"));
+    }
+    for record in replay["records"].as_array().into_iter().flatten() {
+        if record["gap"] == true {
+            out.push(format!(
+                "--- output before {} may be missing ---",
+                str_of(&record["at"])
+            ));
+        }
+        out.extend(record["lines"].as_array().into_iter().flatten().map(str_of));
+    }
+    let mut screen: Vec<String> = replay["screen"]
+        .as_array()
+        .into_iter()
+        .flatten()
+        .map(str_of)
+        .collect();
+    while screen.last().is_some_and(|line| line.trim().is_empty()) {
+        screen.pop();
+    }
+    if !screen.is_empty() {
+        out.push(match replay["ended_at"].as_str() {
+            Some(at) => format!("--- last screen, pane gone at {at} ---"),
+            None => "--- current screen ---".to_string(),
+        });
+        out.extend(screen);
+    }
+    out.join("\n")
+}
+
+/// A raw replay as the pane printed it: `raw` records verbatim, rows of
+/// captured records one per line.
+pub(crate) fn format_raw(replay: &serde_json::Value) -> String {
+    let mut out = String::new();
+    for record in replay["records"].as_array().into_iter().flatten() {
+        if let Some(raw) = record["raw"].as_str() {
+            out += raw;
+        }
+        for line in record["lines"].as_array().into_iter().flatten() {
+            out += line.as_str().unwrap_or("");
+            out += "\n";
+        }
+    }
+    out
+}
+
+/// The runtime to replay: `runtime` itself, or for a pane id the newest
+/// recording of that pane.
+fn resolve_runtime(recordings: &serde_json::Value, runtime: &str) -> anyhow::Result<String> {
+    if !runtime.starts_with('%') && runtime.contains('-') {
+        return Ok(runtime.to_string());
+    }
+    let pane_id = normalize_pane_id(runtime);
+    recordings
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter(|r| r["pane_id"] == pane_id.as_str())
+        .filter_map(|r| r["runtime"].as_str())
+        .next_back()
+        .map(String::from)
+        .ok_or_else(|| anyhow::anyhow!("no recording of pane {pane_id}"))
+}
+
+/// Entry point for `agtmux recording`.
+pub async fn cmd_recording(socket_path: &str, command: RecordingCommand) -> anyhow::Result<()> {
+    match command {
+        RecordingCommand::Ls => {
+            let recordings =
+                rpc_call_with_params(socket_path, "recording.list", serde_json::json!({})).await?;
+            let text = format_list(&recordings);
+            if !text.is_empty() {
+                println!("{text}");
+            }
+        }
+        RecordingCommand::Replay {
+            runtime,
+            since,
+            raw,
+        } => {
+            let recordings =
+                rpc_call_with_params(socket_path, "recording.list", serde_json::json!({})).await?;
+            let runtime = resolve_runtime(&recordings, &runtime)?;
+            let params = serde_json::json!({"runtime": runtime, "since": since, "raw": raw});
+            let replay = rpc_call_with_params(socket_path, "recording.replay", params).await?;
+            if raw {
+                print!("{}", format_raw(&replay));
+                return Ok(());
+            }
+            let text = format_replay(&replay);
+            if !text.is_empty() {
+                println!("{text}");
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    #[test]
+    fn formats_recordings() {
+        let recordings = json!([
+            {"runtime": "3-20261015T070000", "pane_id": "%3", "session_name": "work",
+                "window_name": "api", "provider": "codex", "bytes": 2048,
+                "updated_at": "2026-10-15T08:00:00Z"},
+            {"runtime": "4-20261015T071500", "pane_id": "%4", "session_name": "ops",
+                "window_name": "sh", "provider": null, "bytes": 12, "updated_at": null},
+        ]);
+        assert_eq!(
+            format_list(&recordings),
+            "3-20261015T070000  %3  work:api  codex  2.0 KiB  2026-10-15T08:00:00Z\n\
+             4-20261015T071500  %4  ops:sh  -  12 B  -"
+        );
+        assert_eq!(
+            resolve_runtime(&recordings, "3").expect("pane"),
+            "3-20261015T070000"
+        );
+        assert_eq!(
+            resolve_runtime(&recordings, "9-20261015T070000").expect("runtime"),
+            "9-20261015T070000"
+        );
+        assert!(resolve_runtime(&recordings, "%9").is_err());
+    }
+
+    #[test]
+    fn formats_replays() {
+        let replay = json!({
+            "runtime": "3-20261015T070000", "truncated": 0,
+            "records": [
+                {"at": "2026-10-15T07:00:10Z", "lines": ["one", "two"], "gap": false},
+                {"at": "2026-10-15T07:05:00Z", "lines": ["three"], "gap": true},
+            ],
+            "screen": ["$ exit", "", ""], "ended_at": "2026-10-15T07:06:00Z",
+        });
+        assert_eq!(
+            format_replay(&replay),
+            "one\ntwo\n--- output before 2026-10-15T07:05:00Z may be missing ---\nthree\n\
+             --- last screen, pane gone at 2026-10-15T07:06:00Z ---\n$ exit"
+        );
+        let live = json!({"truncated": 5, "records": [], "screen": ["$ "], "ended_at": null});
+        assert_eq!(
+            format_replay(&live),
+            "--- 5 older lines left out ---\n--- current screen ---\n$ "
+        );
+        let raw = json!({"records": [
+            {"at": "2026-10-15T07:00:00Z", "lines": ["one"], "gap": false},
+            {"at": "2026-10-15T07:00:10Z", "raw": "\u{1b}[1mtwo\u{1b}[0m\r\n$ "},
+        ]});
+        assert_eq!(format_raw(&raw), "one\n\u{1b}[1mtwo\u{1b}[0m\r\n$ ");
+    }
+}
@@ -0,0 +1,79 @@
+//! `agtmux responder` — auto-responder audit trail and kill switch.
+
+use crate::cli::ResponderCommand;
+use crate::client::rpc_call_with_params;
+
+/// Render `responder.status` as a header, per-rule counts and one line per
+/// audit entry.
+pub(crate) fn format_status(status: &serde_json::Value) -> String {
+    let str_of = |v: &serde_json::Value| v.as_str().unwrap_or("").to_string();
+    let mut lines = vec![format!(
+        "responder: {}",
+        if status["enabled"].as_bool() == Some(true) {
+            "on"
+        } else if status["switched_off"].as_bool() == Some(true) {
+            "off (switched off; `agtmux responder on` to resume)"
+        } else {
+            "off"
+        }
+    )];
+    let empty = Vec::new();
+    for rule in status["rules"].as_array().unwrap_or(&empty) {
+        lines.push(format!(
+            "  {}  {} response(s)",
+            str_of(&rule["name"]),
+            rule["responses"].as_u64().unwrap_or(0)
+        ));
+    }
+    for entry in status["audit"].as_array().unwrap_or(&empty) {
+        let matched = entry["matched"]
+            .as_str()
+            .map(|m| format!("  ({m})"))
+            .unwrap_or_default();
+        lines.push(format!(
+            "{}  {}  {}  sent {:?}{matched}",
+            str_of(&entry["at"]),
+            str_of(&entry["pane_id"]),
+            str_of(&entry["rule"]),
+            str_of(&entry["sent"]),
+        ));
+    }
+    lines.join("\n")
+}
+
+/// Entry point for `agtmux responder`.
+pub async fn cmd_responder(socket_path: &str, command: ResponderCommand) -> anyhow::Result<()> {
+    match command {
+        ResponderCommand::Status { rule } => {
+            let params = serde_json::json!({"rule": rule});
+            let status = rpc_call_with_params(socket_path, "responder.status", params).await?;
+            println!("{}", format_status(&status));
+        }
+        ResponderCommand::Off | ResponderCommand::On => {
+            let enabled = matches!(command, ResponderCommand::On);
+            let params = serde_json::json!({"enabled": enabled});
+            rpc_call_with_params(socket_path, "responder.set_enabled", params).await?;
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn format_status_lists_rules_and_audit() {
+        let status = serde_json::json!({
+            "enabled": false,
+            "rules": [{"name": "codex-yes", "responses": 1}],
+            "audit": [{"id": 1, "rule": "codex-yes", "pane_id": "%3", "sent": "y",
+                "matched": "Allow command? [y/n]", "at": "2026-10-15T02:00:00Z"}],
+        });
+        assert_eq!(
+            format_status(&status),
+            "responder: off\n  codex-yes  1 response(s)\n\
+             2026-10-15T02:00:00Z  %3  codex-yes  sent \"y\"  (Allow command? [y/n])"
+        );
+    }
+}
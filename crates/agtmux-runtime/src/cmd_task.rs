@@ -0,0 +1,84 @@
+//! `agtmux task` — task metadata (title, ticket URL, owner, tags) on panes.
+
+use crate::cli::TaskCommand;
+use crate::client::{rpc_call, rpc_call_with_params};
+use crate::cmd_label::normalize_pane_id;
+use crate::tasks::TaskMeta;
+
+/// One-line form of a pane's `task` object (see [`TaskMeta::summary`]);
+/// empty without a task.
+pub(crate) fn task_summary(task: &serde_json::Value) -> String {
+    serde_json::from_value::<TaskMeta>(task.clone())
+        .map(|t| t.summary())
+        .unwrap_or_default()
+}
+
+/// Render `task.list` results as `pane  task` lines.
+pub(crate) fn format_task_list(tasks: &serde_json::Value) -> String {
+    let entries = tasks.as_array().map(Vec::as_slice).unwrap_or(&[]);
+    let width = entries
+        .iter()
+        .map(|e| e["pane_id"].as_str().unwrap_or("").len())
+        .max()
+        .unwrap_or(0);
+    entries
+        .iter()
+        .map(|e| {
+            let pane = e["pane_id"].as_str().unwrap_or("?");
+            format!("{pane:<width$}  {}", task_summary(&e["task"]))
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Entry point for `agtmux task`.
+pub async fn cmd_task(socket_path: &str, command: TaskCommand) -> anyhow::Result<()> {
+    match command {
+        TaskCommand::Set {
+            pane,
+            title,
+            url,
+            owner,
+            tags,
+        } => {
+            let params = serde_json::json!({
+                "pane_id": normalize_pane_id(&pane),
+                "title": title,
+                "url": url,
+                "owner": owner,
+                "tags": tags,
+            });
+            rpc_call_with_params(socket_path, "task.set", params).await?;
+        }
+        TaskCommand::Clear { pane } => {
+            let params = serde_json::json!({"pane_id": normalize_pane_id(&pane)});
+            rpc_call_with_params(socket_path, "task.clear", params).await?;
+        }
+        TaskCommand::List => {
+            let tasks = rpc_call(socket_path, "task.list").await?;
+            let output = format_task_list(&tasks);
+            if !output.is_empty() {
+                println!("{output}");
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn format_task_list_summarises_tasks() {
+        let tasks = serde_json::json!([
+            {"pane_id": "%4", "task": {"title": "Fix login", "owner": "kim",
+                "tags": ["auth", "p1"], "url": "https://jira.local/T-1"}},
+            {"pane_id": "%12", "task": {"url": "https://jira.local/T-2"}},
+        ]);
+        assert_eq!(
+            format_task_list(&tasks),
+            "%4   Fix login (kim) #auth #p1 https://jira.local/T-1\n%12  https://jira.local/T-2"
+        );
+    }
+}
@@ -0,0 +1,89 @@
+//! `agtmux token` — manage `[[access.tokens]]` in the daemon config.
+//!
+//! Tokens are written to the config file rather than sent to the daemon, so
+//! creating one needs write access to the config, not an admin token.
+
+use std::path::PathBuf;
+
+use crate::access::{self, TokenEntry};
+use crate::cli::{TokenCommand, TokenOpts};
+use crate::daemon_config;
+
+/// First free `token-<n>` name.
+fn default_name(existing: &[TokenEntry]) -> String {
+    (1..)
+        .map(|n| format!("token-{n}"))
+        .find(|name| existing.iter().all(|t| &t.name != name))
+        .expect("unbounded range")
+}
+
+/// `name  scope` lines.
+pub(crate) fn format_tokens(tokens: &[TokenEntry]) -> String {
+    let width = tokens.iter().map(|t| t.name.len()).max().unwrap_or(0);
+    tokens
+        .iter()
+        .map(|t| format!("{:<width$}  {}", t.name, t.scope))
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Entry point for `agtmux token`.
+pub fn cmd_token(opts: TokenOpts) -> anyhow::Result<()> {
+    let path: PathBuf = daemon_config::config_file_path(opts.config.as_deref())
+        .map(|(path, _)| path)
+        .ok_or_else(|| anyhow::anyhow!("no config directory; pass --config"))?;
+    let tokens = daemon_config::load_file(opts.config.as_deref())?
+        .access
+        .tokens;
+    match opts.command {
+        TokenCommand::Create { scope, name } => {
+            let name = name.unwrap_or_else(|| default_name(&tokens));
+            let token = access::generate_token()?;
+            access::append_token(
+                &path,
+                &TokenEntry {
+                    name: name.clone(),
+                    scope,
+                    sha256: access::token_digest(&token),
+                },
+            )?;
+            eprintln!(
+                "added {scope} token {name:?} to {}; reload the daemon (SIGHUP) and \
+                 pass it as {} — it is not shown again",
+                path.display(),
+                daemon_config::ENV_TOKEN
+            );
+            println!("{token}");
+        }
+        TokenCommand::Ls => {
+            if tokens.is_empty() {
+                println!("(no tokens in {})", path.display());
+            } else {
+                println!("{}", format_tokens(&tokens));
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::access::Scope;
+
+    #[test]
+    fn names_and_lists_tokens() {
+        let entry = |name: &str, scope| TokenEntry {
+            name: name.to_string(),
+            scope,
+            sha256: String::new(),
+        };
+        let tokens = vec![
+            entry("token-1", Scope::Read),
+            entry("dashboard", Scope::Act),
+        ];
+        assert_eq!(default_name(&tokens), "token-2");
+        assert_eq!(default_name(&[]), "token-1");
+        assert_eq!(format_tokens(&tokens), "token-1    read\ndashboard  act");
+    }
+}
@@ -1,9 +1,19 @@
 //! `agtmux wait` — block until agent state condition is met.
+//!
+//! Re-checks whenever the daemon's `watch` stream reports a version change,
+//! so the condition is seen as soon as it holds. Falls back to polling every
+//! 2s against daemons without `watch`.
 
 use std::io::{IsTerminal, Write};
 use std::time::{Duration, Instant};
 
-use crate::client::rpc_call;
+use agtmux_client::WatchLoop;
+
+use crate::client::{client_for, rpc_call};
+use crate::cmd_watch::next_update;
+
+/// Re-check interval when the daemon has no `watch` stream.
+const POLL_INTERVAL: Duration = Duration::from_secs(2);
 
 /// Wait condition: what to wait for.
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
@@ -66,6 +76,24 @@ fn state_summary(panes: &[&serde_json::Value]) -> String {
     parts.join(", ")
 }
 
+/// How long to sleep before re-checking without a change: the poll interval
+/// without a stream, otherwise only until the timeout (None: never).
+fn wake_after(streaming: bool, timeout_secs: Option<u64>, elapsed: Duration) -> Option<Duration> {
+    let until_timeout = timeout_secs.map(|t| Duration::from_secs(t).saturating_sub(elapsed));
+    if streaming {
+        until_timeout
+    } else {
+        Some(until_timeout.map_or(POLL_INTERVAL, |d| d.min(POLL_INTERVAL)))
+    }
+}
+
+async fn sleep_or_pending(wake: Option<Duration>) {
+    match wake {
+        Some(d) => tokio::time::sleep(d).await,
+        None => std::future::pending().await,
+    }
+}
+
 /// Entry point for `agtmux wait`.
 ///
 /// Returns an exit code:
@@ -82,6 +110,7 @@ pub async fn cmd_wait(
 ) -> i32 {
     let is_tty = std::io::stderr().is_terminal();
     let start = Instant::now();
+    let mut watch = Some(WatchLoop::new(client_for(socket_path)).summary_only());
 
     loop {
         // Check for Ctrl-C before each poll
@@ -145,18 +174,25 @@ pub async fn cmd_wait(
         }
 
         // Timeout check
-        if let Some(timeout) = timeout_secs {
-            if start.elapsed().as_secs() >= timeout {
-                if is_tty && !quiet {
-                    eprintln!("\rTimeout after {timeout}s");
-                }
-                return 1;
+        if let Some(timeout) = timeout_secs
+            && start.elapsed().as_secs() >= timeout
+        {
+            if is_tty && !quiet {
+                eprintln!("\rTimeout after {timeout}s");
             }
+            return 1;
         }
 
-        // Sleep or interrupt
+        // Next change (or poll tick), timeout, or interrupt
+        let wake = wake_after(watch.is_some(), timeout_secs, start.elapsed());
         tokio::select! {
-            _ = tokio::time::sleep(Duration::from_secs(2)) => {}
+            update = next_update(&mut watch) => {
+                if let Err(e) = update {
+                    tracing::debug!(error = %e, "watch stream unavailable, polling");
+                    watch = None;
+                }
+            }
+            _ = sleep_or_pending(wake) => {}
             _ = tokio::signal::ctrl_c() => {
                 if is_tty && !quiet {
                     eprintln!();
@@ -240,6 +276,22 @@ mod tests {
         assert!(!condition_met(&panes, WaitCondition::NoWaiting));
     }
 
+    #[test]
+    fn wake_after_polls_only_without_stream() {
+        let elapsed = Duration::from_secs(9);
+        assert_eq!(wake_after(true, None, elapsed), None);
+        assert_eq!(
+            wake_after(true, Some(10), elapsed),
+            Some(Duration::from_secs(1))
+        );
+        assert_eq!(wake_after(false, None, elapsed), Some(POLL_INTERVAL));
+        assert_eq!(
+            wake_after(false, Some(10), elapsed),
+            Some(Duration::from_secs(1))
+        );
+        assert_eq!(wake_after(true, Some(5), elapsed), Some(Duration::ZERO));
+    }
+
     #[test]
     fn wait_condition_no_waiting_empty() {
         let panes: Vec<&serde_json::Value> = vec![];
@@ -1,24 +1,71 @@
 //! `agtmux watch` — live-refresh agent tree view.
+//!
+//! Redraws as soon as the daemon's `watch` stream reports a change, and every
+//! `--interval` seconds regardless (relative times, unmanaged panes). Falls
+//! back to interval polling against daemons without `watch`.
+//!
+//! The pane list is kept across redraws and refreshed with
+//! `list_panes {since_cursor}`, so each redraw only fetches the panes that
+//! changed. A failed call starts over from a full list, since the daemon may
+//! have restarted with new cursors.
 
+use std::sync::{Arc, Mutex};
 use std::time::Duration;
 
-use crate::client::rpc_call;
-use crate::cmd_ls::format_ls_tree;
-use crate::context::{build_branch_map, resolve_color};
+use agtmux_client::{ConnectionState, WatchLoop, WatchUpdate};
+
+use crate::client::{ClientError, client_for, rpc_call_with_params};
+use crate::cmd_ls::{LsColumn, format_ls_columns, format_ls_tree};
+use crate::context::{TimeFormat, build_branch_map, resolve_color};
+use crate::pane_events::apply_changes;
+
+/// State of the change stream, shown in the footer.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum StreamStatus {
+    Live,
+    Reconnecting,
+    /// Daemon without `watch`: redraw on the interval only.
+    Polling,
+}
 
 /// Entry point for `agtmux watch`.
-pub async fn cmd_watch(socket_path: &str, interval: u64, color: &str) -> anyhow::Result<()> {
+pub async fn cmd_watch(
+    socket_path: &str,
+    interval: u64,
+    columns: Option<&[LsColumn]>,
+    color: &str,
+    time: TimeFormat,
+) -> anyhow::Result<()> {
     let use_color = resolve_color(color);
 
+    let status = Arc::new(Mutex::new(StreamStatus::Reconnecting));
+    let status_cb = Arc::clone(&status);
+    let mut watch = Some(WatchLoop::new(client_for(socket_path)).on_connection_state(
+        move |state| {
+            let next = match state {
+                ConnectionState::Connected => StreamStatus::Live,
+                ConnectionState::Disconnected { .. } => StreamStatus::Reconnecting,
+                _ => return,
+            };
+            *status_cb.lock().expect("watch status lock") = next;
+        },
+    ));
+
+    let mut panes = Vec::new();
+    let mut cursor = 0;
     loop {
         // Clear screen + cursor home
         print!("\x1b[2J\x1b[H");
 
-        match rpc_call(socket_path, "list_panes").await {
-            Ok(panes) => {
-                let arr = panes.as_array().cloned().unwrap_or_default();
-                let branch_map = build_branch_map(&arr);
-                let output = format_ls_tree(&arr, &branch_map, use_color);
+        let params = serde_json::json!({"since_cursor": cursor});
+        match rpc_call_with_params(socket_path, "list_panes", params).await {
+            Ok(reply) => {
+                cursor = apply_changes(&mut panes, reply).unwrap_or(0);
+                let branch_map = build_branch_map(&panes);
+                let output = match columns {
+                    Some(cols) => format_ls_columns(&panes, &branch_map, cols, use_color, time),
+                    None => format_ls_tree(&panes, &branch_map, use_color, time),
+                };
                 if output.is_empty() {
                     println!("(no agents detected)");
                 } else {
@@ -26,17 +73,27 @@ pub async fn cmd_watch(socket_path: &str, interval: u64, color: &str) -> anyhow:
                 }
             }
             Err(e) => {
+                panes.clear();
+                cursor = 0;
                 println!("Cannot connect to daemon: {e}");
             }
         }
 
+        let footer = footer(&status.lock().expect("watch status lock"));
         if use_color {
-            println!("\n\x1b[2magtmux watch \u{2014} Ctrl-C to quit\x1b[0m");
+            println!("\n\x1b[2m{footer}\x1b[0m");
         } else {
-            println!("\nagtmux watch \u{2014} Ctrl-C to quit");
+            println!("\n{footer}");
         }
 
         tokio::select! {
+            update = next_update(&mut watch) => {
+                if let Err(e) = update {
+                    tracing::debug!(error = %e, "watch stream unavailable, polling");
+                    watch = None;
+                    *status.lock().expect("watch status lock") = StreamStatus::Polling;
+                }
+            }
             _ = tokio::time::sleep(Duration::from_secs(interval)) => {}
             _ = tokio::signal::ctrl_c() => { break; }
         }
@@ -45,16 +102,46 @@ pub async fn cmd_watch(socket_path: &str, interval: u64, color: &str) -> anyhow:
     Ok(())
 }
 
+/// Next stream update, or never once the stream has been given up.
+pub(crate) async fn next_update(watch: &mut Option<WatchLoop>) -> Result<WatchUpdate, ClientError> {
+    match watch {
+        Some(w) => w.next().await,
+        None => std::future::pending().await,
+    }
+}
+
+fn footer(status: &StreamStatus) -> String {
+    let suffix = match status {
+        StreamStatus::Live => "",
+        StreamStatus::Reconnecting => " (reconnecting)",
+        StreamStatus::Polling => " (polling)",
+    };
+    format!("agtmux watch \u{2014} Ctrl-C to quit{suffix}")
+}
+
 #[cfg(test)]
 mod tests {
+    use super::*;
     use crate::cli::WatchOpts;
 
+    #[test]
+    fn footer_shows_stream_status() {
+        assert_eq!(
+            footer(&StreamStatus::Live),
+            "agtmux watch \u{2014} Ctrl-C to quit"
+        );
+        assert!(footer(&StreamStatus::Reconnecting).ends_with("(reconnecting)"));
+        assert!(footer(&StreamStatus::Polling).ends_with("(polling)"));
+    }
+
     #[test]
     fn watch_interval_default() {
         let opts = WatchOpts {
             session: None,
             interval: 1,
             color: "auto".to_string(),
+            columns: None,
+            time: "relative".to_string(),
         };
         assert_eq!(opts.interval, 1);
     }
@@ -65,6 +152,8 @@ mod tests {
             session: None,
             interval: 5,
             color: "never".to_string(),
+            columns: None,
+            time: "relative".to_string(),
         };
         assert_eq!(opts.interval, 5);
         assert_eq!(opts.color, "never");
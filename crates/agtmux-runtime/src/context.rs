@@ -102,17 +102,29 @@ pub fn relative_time(seconds: i64) -> String {
     }
 }
 
-/// Build a map of cwd -> git branch by running `git rev-parse` for each unique cwd.
+/// Build a map of cwd -> git branch. Branches the daemon already resolved
+/// (`git_branch` on the pane) are used as-is; other cwds run `git rev-parse`.
 pub fn build_branch_map(panes: &[serde_json::Value]) -> HashMap<String, String> {
+    let mut map = HashMap::new();
     let mut cwds: std::collections::HashSet<String> = std::collections::HashSet::new();
     for pane in panes {
-        if let Some(p) = pane["current_path"].as_str() {
-            cwds.insert(p.to_string());
+        let Some(p) = pane["current_path"].as_str() else {
+            continue;
+        };
+        match pane["git_branch"].as_str() {
+            Some(branch) => {
+                map.insert(p.to_string(), branch.to_string());
+            }
+            None => {
+                cwds.insert(p.to_string());
+            }
         }
     }
 
-    let mut map = HashMap::new();
     for cwd in cwds {
+        if map.contains_key(&cwd) {
+            continue;
+        }
         if let Some(branch) = git_branch_for_path(&cwd) {
             map.insert(cwd, branch);
         }
@@ -121,13 +133,96 @@ pub fn build_branch_map(panes: &[serde_json::Value]) -> HashMap<String, String>
 }
 
 /// Resolve --color flag to bool.
+///
+/// `auto` honours `NO_COLOR` (https://no-color.org) and falls back to a TTY check;
+/// `always` wins over `NO_COLOR`.
 pub fn resolve_color(color: &str) -> bool {
     use std::io::IsTerminal;
+    let no_color = std::env::var_os("NO_COLOR").is_some_and(|v| !v.is_empty());
+    color_enabled(color, no_color, std::io::stdout().is_terminal())
+}
+
+fn color_enabled(color: &str, no_color: bool, is_tty: bool) -> bool {
     match color {
         "always" => true,
         "never" => false,
-        _ => std::io::stdout().is_terminal(),
+        _ => !no_color && is_tty,
+    }
+}
+
+/// ANSI SGR code for a display state: attention (Error) red, Waiting bold
+/// yellow, Running green, everything else dim.
+pub fn state_color(state: &str) -> &'static str {
+    match state {
+        "Error" => "31",
+        "Waiting" => "1;33",
+        "Running" => "32",
+        _ => "2",
+    }
+}
+
+/// Timestamp rendering for `--time`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum TimeFormat {
+    /// `3m`, `1h`, `just now`
+    #[default]
+    Relative,
+    /// Local wall-clock time, `2026-02-28 14:03:12`
+    Absolute,
+    /// RFC 3339 in UTC, `2026-02-28T05:03:12Z`
+    Iso,
+}
+
+impl TimeFormat {
+    /// Parse a `--time` value.
+    pub fn parse(s: &str) -> anyhow::Result<Self> {
+        match s {
+            "relative" => Ok(Self::Relative),
+            "absolute" => Ok(Self::Absolute),
+            "iso" => Ok(Self::Iso),
+            other => anyhow::bail!("invalid --time '{other}' (expected: relative, absolute, iso)"),
+        }
     }
+
+    /// Render an instant relative to `now`.
+    pub fn format(
+        self,
+        at: chrono::DateTime<chrono::Utc>,
+        now: chrono::DateTime<chrono::Utc>,
+    ) -> String {
+        match self {
+            Self::Relative => relative_time((now - at).num_seconds()),
+            Self::Absolute => at
+                .with_timezone(&chrono::Local)
+                .format("%Y-%m-%d %H:%M:%S")
+                .to_string(),
+            Self::Iso => at.to_rfc3339_opts(chrono::SecondsFormat::Secs, true),
+        }
+    }
+}
+
+/// Age/timestamp string from a pane's `updated_at` ISO timestamp.
+pub fn format_updated_at(pane: &serde_json::Value, time: TimeFormat) -> String {
+    pane["updated_at"]
+        .as_str()
+        .and_then(|s| chrono::DateTime::parse_from_rfc3339(s).ok())
+        .map(|dt| time.format(dt.with_timezone(&chrono::Utc), chrono::Utc::now()))
+        .unwrap_or_default()
+}
+
+/// Display title for a managed pane: user label > task title > conversation
+/// title > provider name.
+pub fn pane_title(pane: &serde_json::Value) -> &str {
+    pane["label"]
+        .as_str()
+        .filter(|s| !s.is_empty())
+        .or_else(|| pane["task"]["title"].as_str().filter(|s| !s.is_empty()))
+        .or_else(|| {
+            pane["conversation_title"]
+                .as_str()
+                .filter(|s| !s.is_empty())
+        })
+        .unwrap_or_else(|| provider_short(pane["provider"].as_str().unwrap_or("?")))
 }
 
 /// Provider short name for display.
@@ -231,4 +326,60 @@ mod tests {
     fn relative_time_hours() {
         assert_eq!(relative_time(7200), "2h");
     }
+
+    #[test]
+    fn color_enabled_respects_no_color() {
+        assert!(!color_enabled("auto", true, true), "NO_COLOR disables auto");
+        assert!(color_enabled("auto", false, true));
+        assert!(!color_enabled("auto", false, false), "not a tty");
+        assert!(color_enabled("always", true, false), "always wins");
+        assert!(!color_enabled("never", false, true));
+    }
+
+    #[test]
+    fn state_color_attention_red_running_green() {
+        assert_eq!(state_color("Error"), "31");
+        assert_eq!(state_color("Running"), "32");
+        assert_eq!(state_color("Waiting"), "1;33");
+        assert_eq!(state_color("Idle"), "2");
+    }
+
+    #[test]
+    fn time_format_parse() {
+        assert_eq!(
+            TimeFormat::parse("relative").expect("valid"),
+            TimeFormat::Relative
+        );
+        assert_eq!(TimeFormat::parse("iso").expect("valid"), TimeFormat::Iso);
+        assert!(TimeFormat::parse("epoch").is_err());
+    }
+
+    #[test]
+    fn time_format_renders_each_mode() {
+        let now = chrono::DateTime::parse_from_rfc3339("2026-02-28T05:10:00Z")
+            .expect("valid ts")
+            .with_timezone(&chrono::Utc);
+        let at = now - chrono::Duration::seconds(180);
+        assert_eq!(TimeFormat::Relative.format(at, now), "3m");
+        assert_eq!(TimeFormat::Iso.format(at, now), "2026-02-28T05:07:00Z");
+        let abs = TimeFormat::Absolute.format(at, now);
+        assert_eq!(abs.len(), "2026-02-28 05:07:00".len());
+    }
+
+    #[test]
+    fn pane_title_prefers_label() {
+        let mut pane = serde_json::json!({
+            "provider": "ClaudeCode",
+            "conversation_title": "derived",
+        });
+        assert_eq!(pane_title(&pane), "derived");
+        pane["task"] = serde_json::json!({"title": "T-12 login", "owner": "kim"});
+        assert_eq!(pane_title(&pane), "T-12 login");
+        pane["label"] = serde_json::json!("fix flaky tests");
+        assert_eq!(pane_title(&pane), "fix flaky tests");
+        pane["label"] = serde_json::Value::Null;
+        pane["task"] = serde_json::Value::Null;
+        pane["conversation_title"] = serde_json::json!("");
+        assert_eq!(pane_title(&pane), "Claude");
+    }
 }
@@ -0,0 +1,1952 @@
+//! Daemon configuration: `agtmuxd.toml` layered under env and flags.
+//!
+//! Precedence for every value: flags > env > file > defaults.
+//!
+//! ```toml
+//! socket_path = "/run/user/1000/agtmux/agtmuxd.sock"
+//! tmux_socket = "/tmp/tmux-1000/default"
+//! allowed_uids = [1000]   # UDS peers admitted (default: the daemon's user)
+//!
+//! [poll]
+//! interval_ms = 1000
+//! process_scan_ms = 2000
+//! jsonl_discovery_ms = 5000
+//! codex_appserver_ms = 2000
+//! git_scan_ms = 10000
+//!
+//! [limits]
+//! capture_lines = 50
+//! pull_limit = 500
+//! latency_slo_ms = 3000
+//! exec_concurrency = 4
+//!
+//! [log]
+//! level = "info"
+//! sinks = ["stderr", "file", "syslog"]   # default ["stderr"]; see `log_sink`
+//! file = "/var/log/agtmux/agtmuxd.log"
+//! max_file_bytes = 10485760
+//! keep_files = 5
+//!
+//! [notify]              # desktop notifications on entering these states
+//! states = ["WaitingApproval", "WaitingInput"]
+//!
+//! [[alerts]]            # see `alerts::AlertRule`
+//! name = "approval-stuck"
+//! state = "WaitingApproval"
+//! for_secs = 120
+//! webhook = "https://hooks.example.com/agtmux"
+//! slack = "https://hooks.slack.com/services/T000/B000/XXXX"
+//! debounce_secs = 300
+//!
+//! [email]               # for alert rules with `email = true`; see `email`
+//! smtp_url = "smtps://smtp.example.com:465"
+//! from = "agtmux@example.com"
+//! to = ["me@example.com"]
+//! digest_secs = 600
+//!
+//! [github]              # post to GitHub when an agent runtime exits; see `github`
+//! on_exit = "comment"   # or "status"
+//! excerpt_lines = 20    # output in comments; unset = none
+//!
+//! [[macros]]            # `macro.run` step sequences; see `macros`
+//! name = "approve-and-continue"
+//! steps = [{ key = "Enter" }, { wait = "Idle" }, { send = "continue" }]
+//!
+//! [responder]           # answer approval prompts; see `responder`
+//! enabled = true
+//! [[responder.rules]]
+//! name = "codex-yes"
+//! provider = "codex"
+//! pattern = "Allow command?"
+//! key = "y"
+//!
+//! [[auto_restart]]      # respawn crashed agent panes; see `restart`
+//! name = "flaky-codex"
+//! provider = "codex"
+//! max_retries = 3
+//!
+//! [[adapters]]          # regex-defined agent CLIs; see `adapters`
+//! name = "devbot"
+//! process = "^devbot"
+//! running = ['^\[working\]']      # or: command = [...] + sha256 (plugin)
+//!
+//! [[idle_timeout]]      # act on panes idle too long; see `idle`
+//! name = "reclaim"
+//! after_secs = 7200
+//! kill = true
+//!
+//! [recorder]            # pane output kept on disk; see `recorder`
+//! enabled = true
+//! backend = "capture"   # or "pipe-pane"
+//! interval_secs = 10
+//! retention_days = 7
+//!
+//! [metrics]             # Prometheus `GET /metrics`; see `metrics`
+//! listen = "127.0.0.1:9464"
+//!
+//! [remote]              # REST for remote dashboards; see `remote_api`
+//! listen = "tcp://127.0.0.1:7300"     # or `daemon --listen`
+//! token_file = "/etc/agtmux/remote-token"
+//!
+//! [access]              # per-client scopes (read / act / admin); see `access`
+//! default_scope = "admin"
+//! uids = { "1001" = "read" }
+//!
+//! [send_policy]         # what clients may type into panes; see `send_policy`
+//! deny = ['rm\s+-rf']
+//! agent_panes_only = true
+//!
+//! [redact]              # secrets masked in returned pane output; see `redact`
+//! patterns = ['(?i)password:\s*\S+']
+//!
+//! [features]            # see `features::REGISTRY`
+//! strict_admission = true
+//! ```
+//!
+//! State is in-memory only (SQLite is Post-MVP), so there is no DB path or
+//! retention section.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use agtmux_core_v5::types::ActivityState;
+
+use crate::access::{AccessSettings, Scope};
+use crate::adapters::{self, AdapterDef};
+use crate::alerts::{self, AlertRule};
+use crate::cli::{DaemonOpts, default_socket_path};
+use crate::email::EmailSettings;
+use crate::features::{self, Features};
+use crate::github::{self, GithubSettings, OnExit};
+use crate::idle::{self, IdlePolicy};
+use crate::log_sink::{self, SinkConfig, SinkKind};
+use crate::macros::{self, MacroDef};
+use crate::paths::config_dir;
+use crate::recorder::RecorderSettings;
+use crate::redact::RedactSettings;
+use crate::remote_api::RemoteSettings;
+use crate::responder::ResponderSettings;
+use crate::restart::{self, RestartPolicy};
+use crate::send_policy::SendPolicySettings;
+
+/// Environment overrides, shared by the daemon and the CLI.
+pub const ENV_SOCKET: &str = "AGTMUX_SOCKET";
+pub const ENV_CONFIG: &str = "AGTMUX_CONFIG";
+pub const ENV_POLL_INTERVAL: &str = "AGTMUX_POLL_INTERVAL";
+pub const ENV_TMUX_SOCKET_PATH: &str = "AGTMUX_TMUX_SOCKET_PATH";
+pub const ENV_TMUX_SOCKET_NAME: &str = "AGTMUX_TMUX_SOCKET_NAME";
+/// Access token the CLI sends as `meta.token` (see `access`).
+pub const ENV_TOKEN: &str = "AGTMUX_TOKEN";
+
+/// Default poll interval (ms).
+pub const DEFAULT_POLL_INTERVAL_MS: u64 = 1000;
+/// Default daemon log filter.
+pub const DEFAULT_LOG_LEVEL: &str = "info";
+/// Default `[limits]`.
+pub const DEFAULT_CAPTURE_LINES: u32 = 50;
+pub const DEFAULT_PULL_LIMIT: u32 = 500;
+pub const DEFAULT_LATENCY_SLO_MS: u64 = 3000;
+pub const DEFAULT_EXEC_CONCURRENCY: u32 = 4;
+/// Hard bounds for `[limits]`; outside them memory or tick latency blows up.
+const MAX_CAPTURE_LINES: u32 = 10_000;
+const MAX_PULL_LIMIT: u32 = 100_000;
+const MAX_EXEC_CONCURRENCY: u32 = 64;
+/// Upper bound accepted by `--check-config`; slower polling makes states stale.
+pub const MAX_POLL_INTERVAL_MS: u64 = 60_000;
+
+// ── File schema ─────────────────────────────────────────────────────────────
+
+/// On-disk `agtmuxd.toml`. Every key is optional; unknown keys are rejected
+/// so typos do not silently fall back to defaults.
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct DaemonFileConfig {
+    /// UDS socket path for CLI clients.
+    pub socket_path: Option<String>,
+    /// tmux server socket path (`tmux -S`).
+    pub tmux_socket: Option<String>,
+    /// tmux server socket name (`tmux -L`); ignored when `tmux_socket` is set.
+    pub tmux_socket_name: Option<String>,
+    /// UIDs allowed to connect to the UDS (peer credentials); unset = the
+    /// daemon's own user only.
+    pub allowed_uids: Option<Vec<u32>>,
+    pub poll: PollSection,
+    pub limits: LimitsSection,
+    pub log: LogSection,
+    pub notify: NotifySection,
+    /// `[[alerts]]` rules, evaluated every poll tick.
+    pub alerts: Vec<AlertRule>,
+    pub email: EmailSettings,
+    pub github: GithubSettings,
+    /// `[[macros]]` definitions for `macro.run`.
+    pub macros: Vec<MacroDef>,
+    pub responder: ResponderSettings,
+    /// `[[auto_restart]]` policies for crashed agent panes.
+    pub auto_restart: Vec<RestartPolicy>,
+    /// `[[idle_timeout]]` policies for panes idle too long.
+    pub idle_timeout: Vec<IdlePolicy>,
+    /// `[[adapters]]`: regex-defined agent CLIs.
+    pub adapters: Vec<AdapterDef>,
+    pub recorder: RecorderSettings,
+    pub metrics: MetricsSection,
+    pub remote: RemoteSection,
+    pub access: AccessSettings,
+    pub send_policy: SendPolicySettings,
+    pub redact: RedactSettings,
+    /// Feature name → enabled (`features::REGISTRY`).
+    pub features: BTreeMap<String, bool>,
+}
+
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct PollSection {
+    /// Poll tick interval (ms): tmux list-panes + capture + pipeline.
+    pub interval_ms: Option<u64>,
+    /// Process table scan (`ps`) for agent identification; unset = every tick.
+    pub process_scan_ms: Option<u64>,
+    /// Claude JSONL session discovery (`~/.claude/projects` scan); unset = every tick.
+    /// Already-discovered transcripts are still read every tick.
+    pub jsonl_discovery_ms: Option<u64>,
+    /// Codex App Server `thread/list` poll; unset = every tick.
+    pub codex_appserver_ms: Option<u64>,
+    /// Git repo / branch lookup of pane working directories; unset = every tick.
+    pub git_scan_ms: Option<u64>,
+}
+
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct LimitsSection {
+    /// Lines captured per pane per tick for heuristic detection.
+    pub capture_lines: Option<u32>,
+    /// Max events pulled per source (and from the gateway) per tick.
+    pub pull_limit: Option<u32>,
+    /// p95 tick latency SLO (ms) for the latency window / `health`.
+    pub latency_slo_ms: Option<u64>,
+    /// tmux / ps subprocesses running at once (`ExecPool`).
+    pub exec_concurrency: Option<u32>,
+}
+
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct LogSection {
+    /// tracing filter directive used when neither flags nor env set one.
+    pub level: Option<String>,
+    /// Where daemon logs go; unset = stderr only.
+    pub sinks: Option<Vec<SinkKind>>,
+    /// Log file for the `file` sink.
+    pub file: Option<PathBuf>,
+    /// Rotate the log file past this size.
+    pub max_file_bytes: Option<u64>,
+    /// Rotated log files kept.
+    pub keep_files: Option<u32>,
+}
+
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct NotifySection {
+    /// Activity states (`list_panes` `activity_state` names) whose entry
+    /// triggers a desktop notification on the daemon host; unset = off.
+    pub states: Option<Vec<ActivityState>>,
+}
+
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct MetricsSection {
+    /// `host:port` of the Prometheus listener; unset = off.
+    pub listen: Option<String>,
+}
+
+#[derive(Debug, Default, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct RemoteSection {
+    /// `tcp://host:port` of the REST listener; unset = off.
+    pub listen: Option<String>,
+    /// File whose first line is the bearer token.
+    pub token_file: Option<PathBuf>,
+    /// `[access]` scope of that token; unset = `read`.
+    pub scope: Option<Scope>,
+    /// PEM certificate chain and private key; required off loopback.
+    pub tls_cert: Option<PathBuf>,
+    pub tls_key: Option<PathBuf>,
+}
+
+/// `<config_dir>/agtmuxd.toml`.
+pub fn daemon_config_path() -> Option<PathBuf> {
+    config_dir().map(|d| d.join("agtmuxd.toml"))
+}
+
+/// Config file location: `path` (from `--config`) > `AGTMUX_CONFIG` > default.
+///
+/// The flag is `true` for an explicitly named file, which must exist.
+pub fn config_file_path(path: Option<&Path>) -> Option<(PathBuf, bool)> {
+    path.map(Path::to_path_buf)
+        .or_else(|| process_env(ENV_CONFIG).map(PathBuf::from))
+        .map(|p| (p, true))
+        .or_else(|| daemon_config_path().map(|p| (p, false)))
+}
+
+/// Load the daemon config file (see `config_file_path`); a missing default
+/// file yields the empty config.
+pub fn load_file(path: Option<&Path>) -> anyhow::Result<DaemonFileConfig> {
+    let Some((path, required)) = config_file_path(path) else {
+        return Ok(DaemonFileConfig::default());
+    };
+    match std::fs::read_to_string(&path) {
+        Ok(text) => parse_file(&text).map_err(|e| anyhow::anyhow!("{}: {e}", path.display())),
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound && !required => {
+            Ok(DaemonFileConfig::default())
+        }
+        Err(e) => anyhow::bail!("cannot read config {}: {e}", path.display()),
+    }
+}
+
+pub(crate) fn parse_file(text: &str) -> anyhow::Result<DaemonFileConfig> {
+    toml::from_str(text).map_err(|e| anyhow::anyhow!("invalid config: {e}"))
+}
+
+// ── Resolved config ─────────────────────────────────────────────────────────
+
+/// tmux server the daemon talks to.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum TmuxSocket {
+    /// `tmux -S <path>`
+    Path(String),
+    /// `tmux -L <name>`
+    Name(String),
+}
+
+/// Intervals of the sub-loops run inside the poll tick. `None` = every tick;
+/// a value below the tick interval therefore also means every tick.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct LoopIntervals {
+    pub process_scan_ms: Option<u64>,
+    pub jsonl_discovery_ms: Option<u64>,
+    pub codex_appserver_ms: Option<u64>,
+    pub git_scan_ms: Option<u64>,
+}
+
+/// Memory / latency trade-offs of the poll pipeline (`[limits]`).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Limits {
+    pub capture_lines: u32,
+    pub pull_limit: u32,
+    pub latency_slo_ms: u64,
+    pub exec_concurrency: u32,
+}
+
+impl Default for Limits {
+    fn default() -> Self {
+        Self {
+            capture_lines: DEFAULT_CAPTURE_LINES,
+            pull_limit: DEFAULT_PULL_LIMIT,
+            latency_slo_ms: DEFAULT_LATENCY_SLO_MS,
+            exec_concurrency: DEFAULT_EXEC_CONCURRENCY,
+        }
+    }
+}
+
+impl Limits {
+    fn from_file(section: &LimitsSection) -> anyhow::Result<Self> {
+        let defaults = Self::default();
+        let limits = Self {
+            capture_lines: section.capture_lines.unwrap_or(defaults.capture_lines),
+            pull_limit: section.pull_limit.unwrap_or(defaults.pull_limit),
+            latency_slo_ms: section.latency_slo_ms.unwrap_or(defaults.latency_slo_ms),
+            exec_concurrency: section
+                .exec_concurrency
+                .unwrap_or(defaults.exec_concurrency),
+        };
+        if !(1..=MAX_CAPTURE_LINES).contains(&limits.capture_lines) {
+            anyhow::bail!("limits.capture_lines must be 1..={MAX_CAPTURE_LINES}");
+        }
+        if !(1..=MAX_PULL_LIMIT).contains(&limits.pull_limit) {
+            anyhow::bail!("limits.pull_limit must be 1..={MAX_PULL_LIMIT}");
+        }
+        if limits.latency_slo_ms == 0 {
+            anyhow::bail!("limits.latency_slo_ms must be > 0");
+        }
+        if !(1..=MAX_EXEC_CONCURRENCY).contains(&limits.exec_concurrency) {
+            anyhow::bail!("limits.exec_concurrency must be 1..={MAX_EXEC_CONCURRENCY}");
+        }
+        Ok(limits)
+    }
+}
+
+/// Layer that supplied an effective value (`daemon --print-config`).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ValueSource {
+    Default,
+    File,
+    Env(&'static str),
+    Flag(&'static str),
+}
+
+impl std::fmt::Display for ValueSource {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Default => write!(f, "default"),
+            Self::File => write!(f, "file"),
+            Self::Env(var) => write!(f, "env {var}"),
+            Self::Flag(flag) => write!(f, "flag {flag}"),
+        }
+    }
+}
+
+/// First layer holding a value wins.
+fn layered<T>(layers: Vec<(Option<T>, ValueSource)>) -> Option<(T, ValueSource)> {
+    layers
+        .into_iter()
+        .find_map(|(value, source)| value.map(|v| (v, source)))
+}
+
+/// `File` if the file sets the key, else `Default` (keys without flag/env).
+fn file_or_default<T>(value: &Option<T>) -> ValueSource {
+    if value.is_some() {
+        ValueSource::File
+    } else {
+        ValueSource::Default
+    }
+}
+
+/// Effective daemon configuration after layering.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DaemonConfig {
+    pub socket_path: String,
+    /// `None` = tmux default server.
+    pub tmux_socket: Option<TmuxSocket>,
+    pub poll_interval_ms: u64,
+    pub loops: LoopIntervals,
+    pub limits: Limits,
+    /// UDS peer UID allowlist; `None` = the daemon's own user.
+    pub allowed_uids: Option<Vec<u32>>,
+    /// States that trigger desktop notifications; empty = off.
+    pub notify_states: Vec<ActivityState>,
+    /// `[[alerts]]` rules; empty = none.
+    pub alerts: Vec<AlertRule>,
+    /// `[email]` settings used by alert rules with `email = true`.
+    pub email: EmailSettings,
+    /// `[github]` reporting of exited runtimes; `on_exit` unset = off.
+    pub github: GithubSettings,
+    /// `[[macros]]` definitions; empty = none.
+    pub macros: Vec<MacroDef>,
+    /// `[responder]` rules answering approval prompts; no rules = off.
+    pub responder: ResponderSettings,
+    /// `[[auto_restart]]` policies; empty = crashed panes stay dead.
+    pub auto_restart: Vec<RestartPolicy>,
+    /// `[[idle_timeout]]` policies; empty = none.
+    pub idle_timeout: Vec<IdlePolicy>,
+    /// `[[adapters]]` definitions; empty = built-in providers only.
+    pub adapters: Vec<AdapterDef>,
+    /// `[recorder]` pane output recordings; off unless `enabled`.
+    pub recorder: RecorderSettings,
+    /// `[metrics] listen` address; `None` = no metrics listener.
+    pub metrics_listen: Option<std::net::SocketAddr>,
+    /// `[remote]` REST listener; `None` = UDS only.
+    pub remote: Option<RemoteSettings>,
+    /// `[access]` scopes of UDS callers; empty = every admitted peer is admin.
+    pub access: AccessSettings,
+    /// `[send_policy]` rules for client input; empty = every send passes.
+    pub send_policy: SendPolicySettings,
+    /// `[redact]` patterns masked in returned pane output; built-ins by default.
+    pub redact: RedactSettings,
+    /// Log filter used when neither `--log-level`/`-v`/`-q` nor `AGTMUX_LOG`/`RUST_LOG` are set.
+    pub log_level: String,
+    /// `[log]` sinks of the daemon.
+    pub log_sinks: SinkConfig,
+    pub features: Features,
+    /// Layer of each key as resolved (`socket_path`, `poll.interval_ms`, ...).
+    pub sources: BTreeMap<&'static str, ValueSource>,
+}
+
+/// Read a non-empty environment variable.
+pub fn process_env(key: &str) -> Option<String> {
+    std::env::var(key).ok().filter(|v| !v.is_empty())
+}
+
+impl DaemonConfig {
+    /// Layer `flags` > `env` > `file` > defaults.
+    ///
+    /// `socket_flag` is the global `--socket-path`. `env` is injected for tests.
+    pub fn resolve(
+        file: &DaemonFileConfig,
+        env: &dyn Fn(&str) -> Option<String>,
+        socket_flag: Option<&str>,
+        opts: &DaemonOpts,
+    ) -> anyhow::Result<Self> {
+        let mut sources = BTreeMap::new();
+        let (socket_path, source) = resolve_socket_path(socket_flag, env, file);
+        sources.insert("socket_path", source);
+
+        // --tmux-socket > AGTMUX_TMUX_SOCKET_PATH > AGTMUX_TMUX_SOCKET_NAME > file
+        let (tmux_socket, source) = match layered(vec![
+            (
+                opts.tmux_socket.clone().map(TmuxSocket::Path),
+                ValueSource::Flag("--tmux-socket"),
+            ),
+            (
+                env(ENV_TMUX_SOCKET_PATH).map(TmuxSocket::Path),
+                ValueSource::Env(ENV_TMUX_SOCKET_PATH),
+            ),
+            (
+                env(ENV_TMUX_SOCKET_NAME).map(TmuxSocket::Name),
+                ValueSource::Env(ENV_TMUX_SOCKET_NAME),
+            ),
+            (
+                file.tmux_socket.clone().map(TmuxSocket::Path),
+                ValueSource::File,
+            ),
+            (
+                file.tmux_socket_name.clone().map(TmuxSocket::Name),
+                ValueSource::File,
+            ),
+        ]) {
+            Some((socket, source)) => (Some(socket), source),
+            None => (None, ValueSource::Default),
+        };
+        sources.insert("tmux_socket", source);
+
+        let env_poll_interval = env(ENV_POLL_INTERVAL)
+            .map(|v| {
+                v.parse::<u64>().map_err(|_| {
+                    anyhow::anyhow!("{ENV_POLL_INTERVAL}: expected milliseconds, got {v:?}")
+                })
+            })
+            .transpose()?;
+        let (poll_interval_ms, source) = layered(vec![
+            (
+                opts.poll_interval_ms,
+                ValueSource::Flag("--poll-interval-ms"),
+            ),
+            (env_poll_interval, ValueSource::Env(ENV_POLL_INTERVAL)),
+            (file.poll.interval_ms, ValueSource::File),
+        ])
+        .unwrap_or((DEFAULT_POLL_INTERVAL_MS, ValueSource::Default));
+        sources.insert("poll.interval_ms", source);
+        if poll_interval_ms == 0 {
+            anyhow::bail!("poll interval must be > 0 ms");
+        }
+
+        let loops = LoopIntervals {
+            process_scan_ms: file.poll.process_scan_ms,
+            jsonl_discovery_ms: file.poll.jsonl_discovery_ms,
+            codex_appserver_ms: file.poll.codex_appserver_ms,
+            git_scan_ms: file.poll.git_scan_ms,
+        };
+        for (key, value) in [
+            ("poll.process_scan_ms", loops.process_scan_ms),
+            ("poll.jsonl_discovery_ms", loops.jsonl_discovery_ms),
+            ("poll.codex_appserver_ms", loops.codex_appserver_ms),
+            ("poll.git_scan_ms", loops.git_scan_ms),
+        ] {
+            if value == Some(0) {
+                anyhow::bail!("{key} must be > 0 ms (omit it to run every tick)");
+            }
+            sources.insert(key, file_or_default(&value));
+        }
+
+        let limits = Limits::from_file(&file.limits)?;
+        sources.insert(
+            "limits.capture_lines",
+            file_or_default(&file.limits.capture_lines),
+        );
+        sources.insert(
+            "limits.pull_limit",
+            file_or_default(&file.limits.pull_limit),
+        );
+        sources.insert(
+            "limits.latency_slo_ms",
+            file_or_default(&file.limits.latency_slo_ms),
+        );
+        sources.insert(
+            "limits.exec_concurrency",
+            file_or_default(&file.limits.exec_concurrency),
+        );
+
+        if file.allowed_uids.as_ref().is_some_and(Vec::is_empty) {
+            anyhow::bail!("allowed_uids must not be empty (omit it to allow only the daemon user)");
+        }
+        let allowed_uids = file.allowed_uids.clone();
+        sources.insert("allowed_uids", file_or_default(&allowed_uids));
+
+        let notify_states = file.notify.states.clone().unwrap_or_default();
+        sources.insert("notify.states", file_or_default(&file.notify.states));
+
+        alerts::validate_rules(&file.alerts)?;
+        let alerts = file.alerts.clone();
+        file.email.validate(alerts.iter().any(|rule| rule.email))?;
+        let email = file.email.clone();
+        file.github.validate()?;
+        let github = file.github.clone();
+        macros::validate_macros(&file.macros)?;
+        let macros = file.macros.clone();
+        file.responder.validate()?;
+        let responder = file.responder.clone();
+        restart::validate_policies(&file.auto_restart)?;
+        let auto_restart = file.auto_restart.clone();
+        idle::validate_policies(&file.idle_timeout)?;
+        let idle_timeout = file.idle_timeout.clone();
+        adapters::validate_adapters(&file.adapters)?;
+        let adapters = file.adapters.clone();
+        file.recorder.validate()?;
+        let recorder = file.recorder.clone();
+        let metrics_listen = file
+            .metrics
+            .listen
+            .as_deref()
+            .map(|addr| {
+                addr.parse().map_err(|_| {
+                    anyhow::anyhow!(
+                        "metrics.listen must be host:port, e.g. 127.0.0.1:9464: {addr:?}"
+                    )
+                })
+            })
+            .transpose()?;
+        sources.insert("metrics.listen", file_or_default(&file.metrics.listen));
+
+        let (remote_listen, source) = layered(vec![
+            (opts.listen.clone(), ValueSource::Flag("--listen")),
+            (file.remote.listen.clone(), ValueSource::File),
+        ])
+        .map_or((None, ValueSource::Default), |(listen, source)| {
+            (Some(listen), source)
+        });
+        sources.insert("remote.listen", source);
+        let remote = remote_listen
+            .map(|listen| {
+                RemoteSettings::resolve(
+                    &listen,
+                    file.remote.token_file.as_ref(),
+                    file.remote.scope,
+                    file.remote.tls_cert.as_ref(),
+                    file.remote.tls_key.as_ref(),
+                )
+            })
+            .transpose()?;
+
+        file.access.validate()?;
+        let access = file.access.clone();
+        file.send_policy.validate()?;
+        let send_policy = file.send_policy.clone();
+        file.redact.validate()?;
+        let redact = file.redact.clone();
+
+        let log_level = file
+            .log
+            .level
+            .clone()
+            .unwrap_or_else(|| DEFAULT_LOG_LEVEL.to_string());
+        sources.insert("log.level", file_or_default(&file.log.level));
+
+        let log_sinks = SinkConfig {
+            sinks: file
+                .log
+                .sinks
+                .clone()
+                .unwrap_or_else(|| SinkConfig::default().sinks),
+            file: file.log.file.clone(),
+            max_file_bytes: file
+                .log
+                .max_file_bytes
+                .unwrap_or(log_sink::DEFAULT_MAX_FILE_BYTES),
+            keep_files: file.log.keep_files.unwrap_or(log_sink::DEFAULT_KEEP_FILES),
+        };
+        if log_sinks.sinks.is_empty() {
+            anyhow::bail!("log.sinks must not be empty (omit it to log to stderr)");
+        }
+        if log_sinks.sinks.contains(&SinkKind::File) && log_sinks.file.is_none() {
+            anyhow::bail!("log sink \"file\" needs log.file");
+        }
+        if log_sinks.max_file_bytes == 0 {
+            anyhow::bail!("log.max_file_bytes must be > 0");
+        }
+        sources.insert("log.sinks", file_or_default(&file.log.sinks));
+
+        let features = Features::resolve(&file.features)?;
+
+        Ok(Self {
+            socket_path,
+            tmux_socket,
+            poll_interval_ms,
+            loops,
+            limits,
+            allowed_uids,
+            notify_states,
+            alerts,
+            email,
+            github,
+            macros,
+            responder,
+            auto_restart,
+            idle_timeout,
+            adapters,
+            recorder,
+            metrics_listen,
+            remote,
+            access,
+            send_policy,
+            redact,
+            log_level,
+            log_sinks,
+            features,
+            sources,
+        })
+    }
+
+    /// Record a log filter set by `--log-level`/`-v`/`-q` or `AGTMUX_LOG`/`RUST_LOG`
+    /// (resolved by the CLI, see `Cli::log_filter_override`).
+    pub fn override_log_level(&mut self, level: String, origin: &'static str) {
+        self.log_level = level;
+        let source = if origin.starts_with('-') {
+            ValueSource::Flag(origin)
+        } else {
+            ValueSource::Env(origin)
+        };
+        self.sources.insert("log.level", source);
+    }
+
+    /// Render the effective config as TOML, each value annotated with its layer
+    /// (`daemon --print-config`). `file` is the config file path and whether it exists.
+    pub fn format_effective(&self, file: Option<(&Path, bool)>) -> String {
+        let line = |text: String, key: &str| {
+            let source = self
+                .sources
+                .get(key)
+                .copied()
+                .unwrap_or(ValueSource::Default);
+            format!("{text:<44} # {source}\n")
+        };
+        let string = |v: &str| toml::Value::String(v.to_string()).to_string();
+
+        let mut out = match file {
+            Some((path, true)) => format!("# file: {}\n", path.display()),
+            Some((path, false)) => format!("# file: {} (not found)\n", path.display()),
+            None => "# file: none\n".to_string(),
+        };
+        out += &line(
+            format!("socket_path = {}", string(&self.socket_path)),
+            "socket_path",
+        );
+        let tmux = match &self.tmux_socket {
+            Some(TmuxSocket::Path(p)) => format!("tmux_socket = {}", string(p)),
+            Some(TmuxSocket::Name(n)) => format!("tmux_socket_name = {}", string(n)),
+            None => "# tmux_socket unset (default server)".to_string(),
+        };
+        out += &line(tmux, "tmux_socket");
+        let uids = match &self.allowed_uids {
+            Some(uids) => format!("allowed_uids = {uids:?}"),
+            None => "# allowed_uids unset (daemon user only)".to_string(),
+        };
+        out += &line(uids, "allowed_uids");
+
+        out += "\n[poll]\n";
+        out += &line(
+            format!("interval_ms = {}", self.poll_interval_ms),
+            "poll.interval_ms",
+        );
+        for (key, value) in [
+            ("process_scan_ms", self.loops.process_scan_ms),
+            ("jsonl_discovery_ms", self.loops.jsonl_discovery_ms),
+            ("codex_appserver_ms", self.loops.codex_appserver_ms),
+            ("git_scan_ms", self.loops.git_scan_ms),
+        ] {
+            let text = match value {
+                Some(ms) => format!("{key} = {ms}"),
+                None => format!("# {key} unset (every tick)"),
+            };
+            out += &line(text, &format!("poll.{key}"));
+        }
+
+        out += "\n[limits]\n";
+        for (key, value) in [
+            ("capture_lines", u64::from(self.limits.capture_lines)),
+            ("pull_limit", u64::from(self.limits.pull_limit)),
+            ("latency_slo_ms", self.limits.latency_slo_ms),
+            ("exec_concurrency", u64::from(self.limits.exec_concurrency)),
+        ] {
+            out += &line(format!("{key} = {value}"), &format!("limits.{key}"));
+        }
+
+        out += "\n[log]\n";
+        out += &line(format!("level = {}", string(&self.log_level)), "log.level");
+        let sinks: Vec<&str> = self
+            .log_sinks
+            .sinks
+            .iter()
+            .map(|s| match s {
+                SinkKind::Stderr => "stderr",
+                SinkKind::File => "file",
+                SinkKind::Syslog => "syslog",
+            })
+            .collect();
+        out += &line(format!("sinks = {sinks:?}"), "log.sinks");
+        if let Some(path) = &self.log_sinks.file {
+            out += &format!(
+                "file = {}\nmax_file_bytes = {}\nkeep_files = {}\n",
+                string(&path.display().to_string()),
+                self.log_sinks.max_file_bytes,
+                self.log_sinks.keep_files
+            );
+        }
+
+        out += "\n[notify]\n";
+        let states = if self.notify_states.is_empty() {
+            "# states unset (notifications off)".to_string()
+        } else {
+            format!("states = {:?}", self.notify_states)
+        };
+        out += &line(states, "notify.states");
+
+        for rule in &self.alerts {
+            out += &format!(
+                "\n[[alerts]]\nname = {}\nstate = {}\nfor_secs = {}\n",
+                string(&rule.name),
+                string(&format!("{:?}", rule.state)),
+                rule.for_secs
+            );
+            for (key, value) in [
+                ("session", &rule.session),
+                ("provider", &rule.provider),
+                ("webhook", &rule.webhook),
+                ("slack", &rule.slack),
+                ("script", &rule.script),
+            ] {
+                if let Some(value) = value {
+                    out += &format!("{key} = {}\n", string(value));
+                }
+            }
+            if rule.notify {
+                out += "notify = true\n";
+            }
+            if rule.email {
+                out += "email = true\n";
+            }
+            if rule.debounce_secs > 0 {
+                out += &format!("debounce_secs = {}\n", rule.debounce_secs);
+            }
+        }
+
+        if let (Some(url), Some(from)) = (&self.email.smtp_url, &self.email.from) {
+            out += &format!(
+                "\n[email]\nsmtp_url = {}\nfrom = {}\nto = {:?}\nstarttls = {}\n",
+                string(url),
+                string(from),
+                self.email.to,
+                self.email.starttls
+            );
+            for (key, value) in [("subject", &self.email.subject), ("body", &self.email.body)] {
+                if let Some(value) = value {
+                    out += &format!("{key} = {}\n", string(value));
+                }
+            }
+            if let Some(secs) = self.email.digest_secs {
+                out += &format!("digest_secs = {secs}\n");
+            }
+        }
+
+        if let Some(on_exit) = self.github.on_exit {
+            let on_exit = match on_exit {
+                OnExit::Comment => "comment",
+                OnExit::Status => "status",
+            };
+            out += &format!(
+                "\n[github]\non_exit = {}\nexcerpt_lines = {}\nstatus_context = {}\n",
+                string(on_exit),
+                self.github.excerpt_lines.unwrap_or(0),
+                string(
+                    self.github
+                        .status_context
+                        .as_deref()
+                        .unwrap_or(github::DEFAULT_STATUS_CONTEXT)
+                )
+            );
+        }
+
+        for def in &self.macros {
+            out += &format!(
+                "\n[[macros]]\nname = {}  # {} step(s)\n",
+                string(&def.name),
+                def.steps.len()
+            );
+            if let Some(description) = &def.description {
+                out += &format!("description = {}\n", string(description));
+            }
+        }
+
+        if !self.responder.rules.is_empty() {
+            out += &format!("\n[responder]\nenabled = {}\n", self.responder.is_enabled());
+            for rule in &self.responder.rules {
+                out += &format!("\n[[responder.rules]]\nname = {}\n", string(&rule.name));
+                for (key, value) in [
+                    ("provider", &rule.provider),
+                    ("session", &rule.session),
+                    ("label", &rule.label),
+                    ("pattern", &rule.pattern),
+                    ("send", &rule.send),
+                    ("key", &rule.key),
+                ] {
+                    if let Some(value) = value {
+                        out += &format!("{key} = {}\n", string(value));
+                    }
+                }
+                if rule.match_all {
+                    out += "match_all = true\n";
+                }
+            }
+        }
+
+        for policy in &self.auto_restart {
+            out += &format!("\n[[auto_restart]]\nname = {}\n", string(&policy.name));
+            for (key, value) in [
+                ("provider", &policy.provider),
+                ("session", &policy.session),
+                ("label", &policy.label),
+            ] {
+                if let Some(value) = value {
+                    out += &format!("{key} = {}\n", string(value));
+                }
+            }
+            out += &format!(
+                "max_retries = {}\nbackoff_secs = {}\n",
+                policy.max_retries.unwrap_or(restart::DEFAULT_MAX_RETRIES),
+                policy.backoff_secs.unwrap_or(restart::DEFAULT_BACKOFF_SECS)
+            );
+        }
+
+        for policy in &self.idle_timeout {
+            out += &format!(
+                "\n[[idle_timeout]]\nname = {}\nafter_secs = {}\n",
+                string(&policy.name),
+                policy.after_secs
+            );
+            for (key, value) in [
+                ("provider", &policy.provider),
+                ("session", &policy.session),
+                ("label", &policy.label),
+                ("key", &policy.key),
+            ] {
+                if let Some(value) = value {
+                    out += &format!("{key} = {}\n", string(value));
+                }
+            }
+            if policy.notify {
+                out += "notify = true\n";
+            }
+            if policy.kill {
+                out += "kill = true\n";
+            }
+        }
+
+        let strings = |values: &[String]| {
+            toml::Value::Array(values.iter().cloned().map(toml::Value::String).collect())
+                .to_string()
+        };
+        for adapter in &self.adapters {
+            out += &format!(
+                "\n[[adapters]]\nname = {}\nprocess = {}\n",
+                string(&adapter.name),
+                string(&adapter.process)
+            );
+            for (key, _, patterns) in adapter.state_patterns() {
+                if !patterns.is_empty() {
+                    out += &format!("{key} = {}\n", strings(patterns));
+                }
+            }
+            if let Some(label) = &adapter.label {
+                out += &format!("label = {}\n", string(label));
+            }
+            if !adapter.command.is_empty() {
+                out += &format!("command = {}\n", strings(&adapter.command));
+            }
+            if !adapter.sha256.is_empty() {
+                out += &format!("sha256 = {}\n", strings(&adapter.sha256));
+            }
+            if adapter.allow_unverified {
+                out += "allow_unverified = true\n";
+            }
+        }
+
+        if self.recorder.enabled {
+            let dir = self
+                .recorder
+                .dir()
+                .map(|dir| dir.display().to_string())
+                .unwrap_or_default();
+            out += &format!(
+                "\n[recorder]\nenabled = true\nbackend = {}\ndir = {}\ninterval_secs = {}\nlines = {}\nall_panes = {}\nretention_days = {}\n",
+                string(self.recorder.backend.as_str()),
+                string(&dir),
+                self.recorder.interval_secs(),
+                self.recorder.lines(),
+                self.recorder.all_panes,
+                self.recorder.retention_days()
+            );
+        }
+
+        out += "\n[metrics]\n";
+        let listen = match self.metrics_listen {
+            Some(addr) => format!("listen = {}", string(&addr.to_string())),
+            None => "# listen unset (no metrics listener)".to_string(),
+        };
+        out += &line(listen, "metrics.listen");
+
+        out += "\n[remote]\n";
+        match &self.remote {
+            Some(remote) => {
+                out += &line(
+                    format!("listen = {}", string(&remote.listen_url())),
+                    "remote.listen",
+                );
+                out += &format!(
+                    "token_file = {}\nscope = {}\n",
+                    string(&remote.token_file.display().to_string()),
+                    string(remote.scope.as_str())
+                );
+                if let Some((cert, key)) = &remote.tls {
+                    out += &format!(
+                        "tls_cert = {}\ntls_key = {}\n",
+                        string(&cert.display().to_string()),
+                        string(&key.display().to_string())
+                    );
+                }
+            }
+            None => out += &line("# listen unset (UDS only)".to_string(), "remote.listen"),
+        }
+
+        out += "\n[access]\n";
+        out += &format!(
+            "default_scope = {}\n",
+            string(self.access.default_scope.unwrap_or(Scope::Admin).as_str())
+        );
+        for (uid, scope) in &self.access.uids {
+            out += &format!("uids.{} = {}\n", string(uid), string(scope.as_str()));
+        }
+        for token in &self.access.tokens {
+            out += &format!(
+                "\n[[access.tokens]]\nname = {}\nscope = {}\nsha256 = {}\n",
+                string(&token.name),
+                string(token.scope.as_str()),
+                string(&token.sha256)
+            );
+        }
+
+        if !self.send_policy.is_empty() {
+            out += &format!(
+                "\n[send_policy]\ndeny = {}\nallow = {}\nagent_panes_only = {}\n",
+                strings(&self.send_policy.deny),
+                strings(&self.send_policy.allow),
+                self.send_policy.agent_panes_only
+            );
+        }
+
+        if self.redact != RedactSettings::default() {
+            out += &format!(
+                "\n[redact]\npatterns = {}\nbuiltin = {}\nreplacement = {}\n",
+                strings(&self.redact.patterns),
+                self.redact.builtin(),
+                string(self.redact.replacement())
+            );
+        }
+
+        out += "\n[features]\n";
+        for spec in features::REGISTRY {
+            let source = if self.features.is_configured(spec.name) {
+                ValueSource::File
+            } else {
+                ValueSource::Default
+            };
+            let text = format!("{} = {}", spec.name, self.features.is_enabled(spec.name));
+            out += &format!("{text:<44} # {source}\n");
+        }
+        out
+    }
+}
+
+/// Outcome of comparing a reloaded config against the running one (SIGHUP).
+#[derive(Debug, Default, PartialEq, Eq)]
+pub struct ReloadReport {
+    /// Keys applied to the running daemon.
+    pub applied: Vec<&'static str>,
+    /// Keys that changed but only take effect after a restart (ignored until then).
+    pub restart_required: Vec<&'static str>,
+}
+
+impl DaemonConfig {
+    /// Merge a freshly resolved config into the running one.
+    ///
+    /// Only values that are safe to change at runtime are taken from `new`
+    /// (poll and sub-loop intervals, capture/pull limits, notify states, alert rules,
+    /// email, github, macros, responder, auto-restart, idle timeouts, adapters, recorder, access,
+    /// send policy, redaction and features); the socket, tmux target, peer allowlist, latency SLO, exec
+    /// concurrency and log filter are kept and reported as restart-required.
+    pub fn apply_reload(&mut self, new: &DaemonConfig) -> ReloadReport {
+        let mut report = ReloadReport::default();
+        if new.poll_interval_ms != self.poll_interval_ms {
+            self.poll_interval_ms = new.poll_interval_ms;
+            report.applied.push("poll.interval_ms");
+        }
+        if new.loops != self.loops {
+            self.loops = new.loops;
+            report.applied.push("poll.loops");
+        }
+        if (new.limits.capture_lines, new.limits.pull_limit)
+            != (self.limits.capture_lines, self.limits.pull_limit)
+        {
+            self.limits.capture_lines = new.limits.capture_lines;
+            self.limits.pull_limit = new.limits.pull_limit;
+            report.applied.push("limits");
+        }
+        if new.notify_states != self.notify_states {
+            self.notify_states.clone_from(&new.notify_states);
+            report.applied.push("notify.states");
+        }
+        if new.alerts != self.alerts {
+            self.alerts.clone_from(&new.alerts);
+            report.applied.push("alerts");
+        }
+        if new.email != self.email {
+            self.email.clone_from(&new.email);
+            report.applied.push("email");
+        }
+        if new.github != self.github {
+            self.github.clone_from(&new.github);
+            report.applied.push("github");
+        }
+        if new.macros != self.macros {
+            self.macros.clone_from(&new.macros);
+            report.applied.push("macros");
+        }
+        if new.responder != self.responder {
+            self.responder.clone_from(&new.responder);
+            report.applied.push("responder");
+        }
+        if new.auto_restart != self.auto_restart {
+            self.auto_restart.clone_from(&new.auto_restart);
+            report.applied.push("auto_restart");
+        }
+        if new.idle_timeout != self.idle_timeout {
+            self.idle_timeout.clone_from(&new.idle_timeout);
+            report.applied.push("idle_timeout");
+        }
+        if new.adapters != self.adapters {
+            self.adapters.clone_from(&new.adapters);
+            report.applied.push("adapters");
+        }
+        if new.recorder != self.recorder {
+            self.recorder.clone_from(&new.recorder);
+            report.applied.push("recorder");
+        }
+        if new.access != self.access {
+            self.access.clone_from(&new.access);
+            report.applied.push("access");
+        }
+        if new.send_policy != self.send_policy {
+            self.send_policy.clone_from(&new.send_policy);
+            report.applied.push("send_policy");
+        }
+        if new.redact != self.redact {
+            self.redact.clone_from(&new.redact);
+            report.applied.push("redact");
+        }
+        if new.features != self.features {
+            self.features.clone_from(&new.features);
+            report.applied.push("features");
+        }
+        if new.limits.latency_slo_ms != self.limits.latency_slo_ms {
+            report.restart_required.push("limits.latency_slo_ms");
+        }
+        if new.limits.exec_concurrency != self.limits.exec_concurrency {
+            report.restart_required.push("limits.exec_concurrency");
+        }
+        if new.socket_path != self.socket_path {
+            report.restart_required.push("socket_path");
+        }
+        if new.tmux_socket != self.tmux_socket {
+            report.restart_required.push("tmux_socket");
+        }
+        if new.allowed_uids != self.allowed_uids {
+            report.restart_required.push("allowed_uids");
+        }
+        if new.log_level != self.log_level {
+            report.restart_required.push("log.level");
+        }
+        if new.log_sinks != self.log_sinks {
+            report.restart_required.push("log.sinks");
+        }
+        if new.metrics_listen != self.metrics_listen {
+            report.restart_required.push("metrics.listen");
+        }
+        if new.remote != self.remote {
+            report.restart_required.push("remote");
+        }
+        report
+    }
+}
+
+// ── Validation (`daemon --check-config`) ────────────────────────────────────
+
+/// Stricter checks than startup, for deploy pipelines: fails with every
+/// problem found instead of the first one.
+pub fn check(file: &DaemonFileConfig, config: &DaemonConfig) -> anyhow::Result<()> {
+    let problems = config_problems(file, config);
+    if problems.is_empty() {
+        return Ok(());
+    }
+    anyhow::bail!("invalid config:\n  - {}", problems.join("\n  - "))
+}
+
+fn config_problems(file: &DaemonFileConfig, config: &DaemonConfig) -> Vec<String> {
+    let mut problems = Vec::new();
+    if file.tmux_socket.is_some() && file.tmux_socket_name.is_some() {
+        problems.push("tmux_socket and tmux_socket_name are mutually exclusive".to_string());
+    }
+    if config.poll_interval_ms > MAX_POLL_INTERVAL_MS {
+        problems.push(format!(
+            "poll interval {} ms exceeds {MAX_POLL_INTERVAL_MS} ms",
+            config.poll_interval_ms
+        ));
+    }
+    if let Err(e) = tracing_subscriber::EnvFilter::try_new(&config.log_level) {
+        problems.push(format!("log.level {:?}: {e}", config.log_level));
+    }
+    if let Err(e) = log_sink::LogSinks::open(&config.log_sinks, "daemon") {
+        problems.push(e.to_string());
+    }
+    if let Err(e) = check_socket_dir(Path::new(&config.socket_path)) {
+        problems.push(format!("socket_path {}: {e}", config.socket_path));
+    }
+    problems
+}
+
+/// The daemon runs `create_dir_all` on the socket directory, so the nearest
+/// existing ancestor must be a writable directory. Probed with a scratch file
+/// because permission bits alone miss ACLs and read-only mounts.
+fn check_socket_dir(socket_path: &Path) -> Result<(), String> {
+    let Some(dir) = socket_path.parent().filter(|d| !d.as_os_str().is_empty()) else {
+        return Err("has no parent directory".to_string());
+    };
+    let Some(existing) = dir.ancestors().find(|a| a.exists()) else {
+        return Err("no existing ancestor directory".to_string());
+    };
+    if !existing.is_dir() {
+        return Err(format!("{} is not a directory", existing.display()));
+    }
+    let probe = existing.join(format!(".agtmux-check-{}", std::process::id()));
+    std::fs::File::create(&probe)
+        .map_err(|e| format!("{} is not writable: {e}", existing.display()))?;
+    let _ = std::fs::remove_file(&probe);
+    Ok(())
+}
+
+/// `--socket-path` > `AGTMUX_SOCKET` > `socket_path` in the file > default.
+fn resolve_socket_path(
+    socket_flag: Option<&str>,
+    env: &dyn Fn(&str) -> Option<String>,
+    file: &DaemonFileConfig,
+) -> (String, ValueSource) {
+    layered(vec![
+        (
+            socket_flag.map(String::from),
+            ValueSource::Flag("--socket-path"),
+        ),
+        (env(ENV_SOCKET), ValueSource::Env(ENV_SOCKET)),
+        (file.socket_path.clone(), ValueSource::File),
+    ])
+    .unwrap_or_else(|| (default_socket_path(), ValueSource::Default))
+}
+
+/// Socket path for CLI commands, resolved exactly like the daemon's so both
+/// agree whether the socket comes from a flag, `AGTMUX_SOCKET` or the file.
+pub fn cli_socket_path(socket_flag: Option<String>) -> anyhow::Result<String> {
+    if let Some(path) = socket_flag.or_else(|| process_env(ENV_SOCKET)) {
+        return Ok(path);
+    }
+    Ok(resolve_socket_path(None, &process_env, &load_file(None)?).0)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn opts() -> DaemonOpts {
+        DaemonOpts {
+            config: None,
+            check_config: false,
+            print_config: false,
+            poll_interval_ms: None,
+            tmux_socket: None,
+            listen: None,
+        }
+    }
+
+    fn no_env(_: &str) -> Option<String> {
+        None
+    }
+
+    #[test]
+    fn parse_full_file() {
+        let file = parse_file(
+            r#"
+socket_path = "/tmp/a.sock"
+tmux_socket_name = "work"
+
+[poll]
+interval_ms = 250
+
+[log]
+level = "debug"
+"#,
+        )
+        .expect("valid config");
+        assert_eq!(file.socket_path.as_deref(), Some("/tmp/a.sock"));
+        assert_eq!(file.tmux_socket_name.as_deref(), Some("work"));
+        assert_eq!(file.poll.interval_ms, Some(250));
+        assert_eq!(file.log.level.as_deref(), Some("debug"));
+    }
+
+    #[test]
+    fn parse_rejects_unknown_keys() {
+        let err = parse_file("[poll]\ninterval = 5\n").expect_err("typo rejected");
+        assert!(err.to_string().contains("interval"), "{err}");
+    }
+
+    #[test]
+    fn resolve_defaults() {
+        let cfg = DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+            .expect("defaults");
+        assert_eq!(cfg.poll_interval_ms, DEFAULT_POLL_INTERVAL_MS);
+        assert_eq!(cfg.log_level, DEFAULT_LOG_LEVEL);
+        assert_eq!(cfg.tmux_socket, None);
+        assert_eq!(cfg.socket_path, default_socket_path());
+    }
+
+    #[test]
+    fn resolve_file_over_defaults() {
+        let file = parse_file("socket_path = \"/tmp/f.sock\"\n[poll]\ninterval_ms = 250\n")
+            .expect("valid");
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(cfg.socket_path, "/tmp/f.sock");
+        assert_eq!(cfg.poll_interval_ms, 250);
+    }
+
+    #[test]
+    fn resolve_allowed_uids() {
+        let cfg = DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+            .expect("defaults");
+        assert_eq!(cfg.allowed_uids, None, "daemon user only");
+
+        let file = parse_file("allowed_uids = [1000, 1001]\n").expect("valid");
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(cfg.allowed_uids, Some(vec![1000, 1001]));
+        assert_eq!(cfg.sources["allowed_uids"], ValueSource::File);
+
+        let file = parse_file("allowed_uids = []\n").expect("valid");
+        let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err("empty");
+        assert!(err.to_string().contains("allowed_uids"), "{err}");
+    }
+
+    #[test]
+    fn resolve_flags_over_env_over_file() {
+        let file = parse_file("tmux_socket = \"/tmp/file-tmux\"\n[poll]\ninterval_ms = 250\n")
+            .expect("valid");
+        let env = |k: &str| (k == "AGTMUX_TMUX_SOCKET_NAME").then(|| "env-name".to_string());
+
+        let cfg = DaemonConfig::resolve(&file, &env, None, &opts()).expect("resolve");
+        assert_eq!(
+            cfg.tmux_socket,
+            Some(TmuxSocket::Name("env-name".to_string())),
+            "env beats file"
+        );
+
+        let flags = DaemonOpts {
+            poll_interval_ms: Some(100),
+            tmux_socket: Some("/tmp/flag-tmux".to_string()),
+            ..opts()
+        };
+        let cfg =
+            DaemonConfig::resolve(&file, &env, Some("/tmp/flag.sock"), &flags).expect("resolve");
+        assert_eq!(
+            cfg.tmux_socket,
+            Some(TmuxSocket::Path("/tmp/flag-tmux".to_string()))
+        );
+        assert_eq!(cfg.poll_interval_ms, 100, "flag beats file");
+        assert_eq!(cfg.socket_path, "/tmp/flag.sock");
+    }
+
+    #[test]
+    fn resolve_env_overrides_file() {
+        let file = parse_file("socket_path = \"/tmp/f.sock\"\n[poll]\ninterval_ms = 250\n")
+            .expect("valid");
+        let env = |k: &str| match k {
+            ENV_SOCKET => Some("/tmp/env.sock".to_string()),
+            ENV_POLL_INTERVAL => Some("750".to_string()),
+            _ => None,
+        };
+        let cfg = DaemonConfig::resolve(&file, &env, None, &opts()).expect("resolve");
+        assert_eq!(cfg.socket_path, "/tmp/env.sock");
+        assert_eq!(cfg.poll_interval_ms, 750);
+
+        let cfg =
+            DaemonConfig::resolve(&file, &env, Some("/tmp/flag.sock"), &opts()).expect("resolve");
+        assert_eq!(cfg.socket_path, "/tmp/flag.sock", "flag beats env");
+    }
+
+    #[test]
+    fn resolve_rejects_malformed_env_interval() {
+        let env = |k: &str| (k == ENV_POLL_INTERVAL).then(|| "2s".to_string());
+        let err = DaemonConfig::resolve(&DaemonFileConfig::default(), &env, None, &opts())
+            .expect_err("not an integer");
+        assert!(err.to_string().contains(ENV_POLL_INTERVAL), "{err}");
+    }
+
+    #[test]
+    fn resolve_loop_intervals() {
+        let cfg = DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+            .expect("defaults");
+        assert_eq!(cfg.loops, LoopIntervals::default(), "every tick by default");
+
+        let file = parse_file("[poll]\nprocess_scan_ms = 2000\njsonl_discovery_ms = 5000\n")
+            .expect("valid toml");
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(cfg.loops.process_scan_ms, Some(2000));
+        assert_eq!(cfg.loops.jsonl_discovery_ms, Some(5000));
+        assert_eq!(cfg.loops.codex_appserver_ms, None);
+
+        let file = parse_file("[poll]\ncodex_appserver_ms = 0\n").expect("valid toml");
+        let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err("zero");
+        assert!(err.to_string().contains("poll.codex_appserver_ms"), "{err}");
+    }
+
+    #[test]
+    fn resolve_limits() {
+        let cfg = DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+            .expect("defaults");
+        assert_eq!(cfg.limits, Limits::default());
+
+        let file = parse_file("[limits]\ncapture_lines = 200\nlatency_slo_ms = 5000\n")
+            .expect("valid toml");
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(cfg.limits.capture_lines, 200);
+        assert_eq!(cfg.limits.pull_limit, DEFAULT_PULL_LIMIT);
+        assert_eq!(cfg.limits.latency_slo_ms, 5000);
+
+        for bad in [
+            "[limits]\ncapture_lines = 0\n",
+            "[limits]\ncapture_lines = 20000\n",
+            "[limits]\npull_limit = 0\n",
+            "[limits]\nlatency_slo_ms = 0\n",
+            "[limits]\nexec_concurrency = 0\n",
+            "[limits]\nexec_concurrency = 100\n",
+        ] {
+            let file = parse_file(bad).expect("valid toml");
+            let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err(bad);
+            assert!(err.to_string().contains("limits."), "{err}");
+        }
+    }
+
+    #[test]
+    fn apply_reload_limits() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let file =
+            parse_file("[limits]\npull_limit = 100\nlatency_slo_ms = 1000\n").expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        let report = running.apply_reload(&new);
+        assert_eq!(report.applied, vec!["limits"]);
+        assert_eq!(report.restart_required, vec!["limits.latency_slo_ms"]);
+        assert_eq!(running.limits.pull_limit, 100);
+        assert_eq!(running.limits.latency_slo_ms, DEFAULT_LATENCY_SLO_MS);
+    }
+
+    #[test]
+    fn notify_states_parse_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert!(running.notify_states.is_empty(), "off by default");
+
+        let file =
+            parse_file("[notify]\nstates = [\"WaitingApproval\", \"Error\"]\n").expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(
+            new.notify_states,
+            vec![ActivityState::WaitingApproval, ActivityState::Error]
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["notify.states"]);
+        assert_eq!(running.notify_states, new.notify_states);
+
+        let err = parse_file("[notify]\nstates = [\"Waiting\"]\n").expect_err("unknown state");
+        assert!(err.to_string().contains("Waiting"), "{err}");
+    }
+
+    #[test]
+    fn alert_rules_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let file = parse_file(
+            "[[alerts]]\nname = \"stuck\"\nstate = \"WaitingApproval\"\nfor_secs = 120\nscript = \"logger stuck\"\nslack = \"https://hooks.slack.com/services/x\"\ndebounce_secs = 300\n",
+        )
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(new.alerts.len(), 1);
+        assert_eq!(new.alerts[0].state, ActivityState::WaitingApproval);
+        assert_eq!(new.alerts[0].for_secs, 120);
+        let printed = new.format_effective(None);
+        assert!(
+            printed.contains("[[alerts]]\nname = \"stuck\"\nstate = \"WaitingApproval\""),
+            "{printed}"
+        );
+        assert!(printed.contains("script = \"logger stuck\""), "{printed}");
+        assert!(printed.contains("debounce_secs = 300"), "{printed}");
+        assert_eq!(parse_file(&printed).expect("reparses").alerts, file.alerts);
+        assert_eq!(running.apply_reload(&new).applied, vec!["alerts"]);
+
+        let file = parse_file(
+            "[[alerts]]\nname = \"a\"\nstate = \"Error\"\n[[alerts]]\nname = \"a\"\nstate = \"Idle\"\n",
+        )
+        .expect("valid toml");
+        let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err("duplicate");
+        assert!(err.to_string().contains("duplicate alert rule"), "{err}");
+        assert!(parse_file("[[alerts]]\nname = \"a\"\nstate = \"Idle\"\nsms = \"x\"\n").is_err());
+    }
+
+    #[test]
+    fn log_sinks_parse_and_validate() {
+        let cfg = DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+            .expect("defaults");
+        assert!(cfg.log_sinks.is_stderr_only());
+
+        let file = parse_file(
+            "[log]\nsinks = [\"file\", \"syslog\"]\nfile = \"/tmp/agtmuxd.log\"\nkeep_files = 2\n",
+        )
+        .expect("valid");
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(cfg.log_sinks.sinks, vec![SinkKind::File, SinkKind::Syslog]);
+        assert_eq!(cfg.log_sinks.keep_files, 2);
+        assert_eq!(
+            cfg.log_sinks.max_file_bytes,
+            log_sink::DEFAULT_MAX_FILE_BYTES
+        );
+        assert!(
+            cfg.format_effective(None)
+                .contains("sinks = [\"file\", \"syslog\"]")
+        );
+
+        let file = parse_file("[log]\nsinks = [\"file\"]\n").expect("valid toml");
+        let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err("no path");
+        assert!(err.to_string().contains("log.file"), "{err}");
+        assert!(parse_file("[log]\nsinks = [\"kafka\"]\n").is_err());
+    }
+
+    #[test]
+    fn email_section_required_by_email_rules() {
+        let rule = "[[alerts]]\nname = \"a\"\nstate = \"Error\"\nemail = true\n";
+        let file = parse_file(rule).expect("valid toml");
+        let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err("no [email]");
+        assert!(err.to_string().contains("[email]"), "{err}");
+
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let file = parse_file(&format!(
+            "{rule}[email]\nsmtp_url = \"smtp://mail.local\"\nfrom = \"a@x\"\nto = [\"b@x\"]\ndigest_secs = 600\n"
+        ))
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(new.email.digest_secs, Some(600));
+        assert!(
+            new.format_effective(None)
+                .contains("[email]\nsmtp_url = \"smtp://mail.local\"")
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["alerts", "email"]);
+    }
+
+    #[test]
+    fn macros_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let file = parse_file(
+            "[[macros]]\nname = \"approve\"\nsteps = [{ key = \"y\" }, { wait = \"Idle\" }]\n",
+        )
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert!(
+            new.format_effective(None)
+                .contains("[[macros]]\nname = \"approve\"  # 2 step(s)\n")
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["macros"]);
+
+        let file = parse_file("[[macros]]\nname = \"m\"\nsteps = [{}]\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+        assert!(parse_file("[[macros]]\nname = \"m\"\nsteps = [{ type = \"x\" }]\n").is_err());
+    }
+
+    #[test]
+    fn responder_section_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert!(!running.format_effective(None).contains("[responder]"));
+        let file = parse_file(
+            "[responder]\nenabled = false\n[[responder.rules]]\nname = \"yes\"\nprovider = \"codex\"\nkey = \"y\"\n",
+        )
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert!(new.format_effective(None).contains(
+            "[responder]\nenabled = false\n\n[[responder.rules]]\nname = \"yes\"\nprovider = \"codex\"\nkey = \"y\"\n"
+        ));
+        assert_eq!(running.apply_reload(&new).applied, vec!["responder"]);
+
+        let file = parse_file("[[responder.rules]]\nname = \"x\"\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn access_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let digest = "ab".repeat(32);
+        let file = parse_file(&format!(
+            "[access]\ndefault_scope = \"read\"\nuids = {{ \"1001\" = \"act\" }}\n\
+             [[access.tokens]]\nname = \"ci\"\nscope = \"admin\"\nsha256 = \"{digest}\"\n"
+        ))
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        let printed = new.format_effective(None);
+        assert!(
+            printed.contains("[access]\ndefault_scope = \"read\"\nuids.\"1001\" = \"act\"\n"),
+            "{printed}"
+        );
+        assert_eq!(
+            parse_file(&printed).expect("printed parses").access,
+            new.access
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["access"]);
+
+        let file = parse_file("[access]\nuids = { alice = \"read\" }\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+        assert!(parse_file("[access]\ndefault_scope = \"root\"\n").is_err());
+    }
+
+    #[test]
+    fn send_policy_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert!(!running.format_effective(None).contains("[send_policy]"));
+        let file = parse_file("[send_policy]\ndeny = ['rm\\s+-rf']\nagent_panes_only = true\n")
+            .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        let printed = new.format_effective(None);
+        assert!(
+            printed.contains("[send_policy]\ndeny = ['rm\\s+-rf']\nallow = []\n"),
+            "{printed}"
+        );
+        assert_eq!(
+            parse_file(&printed).expect("printed parses").send_policy,
+            new.send_policy
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["send_policy"]);
+
+        let file = parse_file("[send_policy]\nallow = ['(']\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn redact_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert!(!running.format_effective(None).contains("[redact]"));
+        let file = parse_file("[redact]\npatterns = ['token=\\S+']\n").expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        let printed = new.format_effective(None);
+        assert!(
+            printed.contains(
+                "[redact]\npatterns = ['token=\\S+']\nbuiltin = true\nreplacement = \"[redacted]\"\n"
+            ),
+            "{printed}"
+        );
+        assert_eq!(
+            parse_file(&printed)
+                .expect("printed parses")
+                .redact
+                .patterns,
+            new.redact.patterns
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["redact"]);
+
+        let file = parse_file("[redact]\npatterns = ['(']\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn remote_listen_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert_eq!(running.remote, None, "UDS only by default");
+
+        let file = parse_file(
+            "[remote]\nlisten = \"tcp://127.0.0.1:7300\"\ntoken_file = \"/etc/agtmux/token\"\n",
+        )
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        let remote = new.remote.as_ref().expect("remote");
+        assert_eq!(remote.addr, "127.0.0.1:7300".parse().expect("addr"));
+        assert_eq!(new.sources["remote.listen"], ValueSource::File);
+        let printed = new.format_effective(None);
+        assert!(
+            printed.contains("[remote]\nlisten = \"tcp://127.0.0.1:7300\" "),
+            "{printed}"
+        );
+        assert!(printed.contains("scope = \"read\"\n"), "{printed}");
+        assert!(parse_file(&printed).is_ok());
+        let report = running.apply_reload(&new);
+        assert_eq!(report.restart_required, vec!["remote"]);
+
+        let flagged = DaemonOpts {
+            listen: Some("tcp://127.0.0.1:7400".to_string()),
+            ..opts()
+        };
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &flagged).expect("resolve");
+        assert_eq!(
+            cfg.remote.expect("remote").addr.port(),
+            7400,
+            "flag beats file"
+        );
+        assert_eq!(cfg.sources["remote.listen"], ValueSource::Flag("--listen"));
+
+        let public = DaemonOpts {
+            listen: Some("tcp://0.0.0.0:7300".to_string()),
+            ..opts()
+        };
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &public).is_err());
+    }
+
+    #[test]
+    fn metrics_listen_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert_eq!(running.metrics_listen, None, "off by default");
+
+        let file = parse_file("[metrics]\nlisten = \"127.0.0.1:9464\"\n").expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(
+            new.metrics_listen,
+            Some("127.0.0.1:9464".parse().expect("addr"))
+        );
+        assert_eq!(new.sources["metrics.listen"], ValueSource::File);
+        assert!(
+            new.format_effective(None)
+                .contains("[metrics]\nlisten = \"127.0.0.1:9464\" ")
+        );
+        let report = running.apply_reload(&new);
+        assert_eq!(report.restart_required, vec!["metrics.listen"]);
+        assert_eq!(running.metrics_listen, None, "needs a restart");
+
+        let file = parse_file("[metrics]\nlisten = \"localhost\"\n").expect("valid toml");
+        let err = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect_err("no port");
+        assert!(err.to_string().contains("metrics.listen"), "{err}");
+    }
+
+    #[test]
+    fn adapters_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let file = parse_file(concat!(
+            "[[adapters]]\nname = \"devbot\"\nprocess = \"^devbot\"\n",
+            "running = ['^\\[working\\]']\nwaiting_approval = ['approve\\?', 'y/N']\n",
+            "label = '^task: (.+)'\n",
+            "[[adapters]]\nname = \"ext\"\nprocess = \"^ext$\"\ncommand = [\"ext-classify\", \"-q\"]\n",
+            "sha256 = [\"9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08\"]\n",
+        ))
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(new.adapters.len(), 2);
+        assert_eq!(new.adapters[0].waiting_approval.len(), 2);
+        assert_eq!(
+            new.adapters[1].sha256,
+            ["9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"],
+            "pins are lowercased when parsed"
+        );
+        let printed = new.format_effective(None);
+        assert_eq!(
+            parse_file(&printed).expect("reparses").adapters,
+            file.adapters
+        );
+        assert_eq!(running.apply_reload(&new).applied, vec!["adapters"]);
+
+        let bad = parse_file("[[adapters]]\nname = \"x\"\nprocess = \"(\"\nidle = [\"> \"]\n")
+            .expect("valid toml");
+        assert!(DaemonConfig::resolve(&bad, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn github_section_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert!(!running.format_effective(None).contains("[github]"));
+
+        let file = parse_file("[github]\non_exit = \"status\"\n").expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert_eq!(new.github.on_exit, Some(OnExit::Status));
+        assert!(new.format_effective(None).contains(
+            "[github]\non_exit = \"status\"\nexcerpt_lines = 0\nstatus_context = \"agtmux\"\n"
+        ));
+        assert_eq!(running.apply_reload(&new).applied, vec!["github"]);
+
+        assert!(parse_file("[github]\non_exit = \"issue\"\n").is_err());
+        let file = parse_file("[github]\nstatus_context = \"\"\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn recorder_section_parse_print_and_reload() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        assert!(!running.recorder.enabled, "off by default");
+        assert!(!running.format_effective(None).contains("[recorder]"));
+
+        let file = parse_file("[recorder]\nenabled = true\ndir = \"/var/lib/agtmux/rec\"\n")
+            .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert!(new.format_effective(None).contains(
+            "[recorder]\nenabled = true\nbackend = \"capture\"\ndir = \"/var/lib/agtmux/rec\"\ninterval_secs = 10\nlines = 1000\nall_panes = false\nretention_days = 7\n"
+        ));
+        assert_eq!(running.apply_reload(&new).applied, vec!["recorder"]);
+
+        let file =
+            parse_file("[recorder]\nenabled = true\nbackend = \"pipe-pane\"\n").expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        assert!(
+            new.format_effective(None)
+                .contains("[recorder]\nenabled = true\nbackend = \"pipe-pane\"\n")
+        );
+        let file = parse_file("[recorder]\nbackend = \"stream\"\n");
+        assert!(file.is_err(), "unknown backend");
+
+        let file = parse_file("[recorder]\ninterval_secs = 0\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn resolve_records_value_sources() {
+        let file = parse_file(
+            "socket_path = \"/tmp/f.sock\"\n[poll]\ninterval_ms = 2000\nprocess_scan_ms = 5000\n",
+        )
+        .expect("valid toml");
+        let env = |k: &str| (k == ENV_TMUX_SOCKET_NAME).then(|| "work".to_string());
+        let flags = DaemonOpts {
+            poll_interval_ms: Some(100),
+            ..opts()
+        };
+        let mut cfg = DaemonConfig::resolve(&file, &env, None, &flags).expect("resolve");
+        assert_eq!(cfg.sources["socket_path"], ValueSource::File);
+        assert_eq!(
+            cfg.sources["tmux_socket"],
+            ValueSource::Env(ENV_TMUX_SOCKET_NAME)
+        );
+        assert_eq!(
+            cfg.sources["poll.interval_ms"],
+            ValueSource::Flag("--poll-interval-ms")
+        );
+        assert_eq!(cfg.sources["poll.process_scan_ms"], ValueSource::File);
+        assert_eq!(cfg.sources["limits.pull_limit"], ValueSource::Default);
+
+        cfg.override_log_level("debug".to_string(), "AGTMUX_LOG");
+        let text = cfg.format_effective(Some((Path::new("/etc/agtmuxd.toml"), true)));
+        assert!(text.starts_with("# file: /etc/agtmuxd.toml\n"), "{text}");
+        for (needle, source) in [
+            ("socket_path = \"/tmp/f.sock\"", "# file"),
+            (
+                "tmux_socket_name = \"work\"",
+                "# env AGTMUX_TMUX_SOCKET_NAME",
+            ),
+            ("interval_ms = 100", "# flag --poll-interval-ms"),
+            ("# codex_appserver_ms unset", "# default"),
+            ("level = \"debug\"", "# env AGTMUX_LOG"),
+        ] {
+            let line = text
+                .lines()
+                .find(|l| l.starts_with(needle))
+                .unwrap_or_else(|| panic!("{needle} missing in:\n{text}"));
+            assert!(line.ends_with(source), "{line}");
+        }
+    }
+
+    #[test]
+    fn resolve_rejects_zero_interval() {
+        let file = parse_file("[poll]\ninterval_ms = 0\n").expect("valid toml");
+        assert!(DaemonConfig::resolve(&file, &no_env, None, &opts()).is_err());
+    }
+
+    #[test]
+    fn check_reports_every_problem() {
+        let file = parse_file(
+            "socket_path = \"/proc/agtmux/d.sock\"\ntmux_socket = \"/tmp/t\"\ntmux_socket_name = \"w\"\n[poll]\ninterval_ms = 600000\n",
+        )
+        .expect("valid toml");
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        let problems = config_problems(&file, &cfg);
+        assert_eq!(problems.len(), 3, "{problems:?}");
+        assert!(problems[0].contains("mutually exclusive"));
+        assert!(problems[1].contains("600000 ms"));
+        assert!(problems[2].starts_with("socket_path /proc/agtmux/d.sock"));
+        assert!(check(&file, &cfg).is_err());
+    }
+
+    #[test]
+    fn check_accepts_writable_socket_dir() {
+        let dir = std::env::temp_dir().join(format!("agtmux-check-{}", std::process::id()));
+        let file = DaemonFileConfig {
+            socket_path: Some(dir.join("sub/d.sock").display().to_string()),
+            ..Default::default()
+        };
+        let cfg = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+        check(&file, &cfg).expect("temp dir is writable");
+        assert!(!dir.exists(), "check must not create the socket dir");
+    }
+
+    #[test]
+    fn apply_reload_takes_runtime_safe_values_only() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let file = parse_file(
+            "socket_path = \"/tmp/new.sock\"\n[poll]\ninterval_ms = 200\n[log]\nlevel = \"debug\"\n[features]\nclaude_jsonl = false\n",
+        )
+        .expect("valid");
+        let new = DaemonConfig::resolve(&file, &no_env, None, &opts()).expect("resolve");
+
+        let report = running.apply_reload(&new);
+        assert_eq!(report.applied, vec!["poll.interval_ms", "features"]);
+        assert!(!running.features.is_enabled(features::CLAUDE_JSONL));
+        assert_eq!(report.restart_required, vec!["socket_path", "log.level"]);
+        assert_eq!(running.poll_interval_ms, 200, "interval applied");
+        assert_eq!(running.socket_path, default_socket_path(), "socket kept");
+        assert_eq!(running.log_level, DEFAULT_LOG_LEVEL, "log level kept");
+    }
+
+    #[test]
+    fn apply_reload_unchanged_is_empty() {
+        let mut running =
+            DaemonConfig::resolve(&DaemonFileConfig::default(), &no_env, None, &opts())
+                .expect("defaults");
+        let same = running.clone();
+        assert_eq!(running.apply_reload(&same), ReloadReport::default());
+    }
+
+    #[test]
+    fn load_file_explicit_missing_is_error() {
+        let err = load_file(Some(Path::new("/nonexistent/agtmuxd.toml"))).expect_err("missing");
+        assert!(err.to_string().contains("/nonexistent/agtmuxd.toml"));
+    }
+}
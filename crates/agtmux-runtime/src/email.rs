@@ -0,0 +1,233 @@
+//! `[email]`: SMTP delivery for alert rules with `email = true`, for hosts
+//! without a chat webhook. Mail is submitted with `curl` (`smtp://` or
+//! `smtps://`); credentials come from `~/.netrc`, never from the config.
+//!
+//! `subject` / `body` are templates over `{rule}`, `{pane_id}`, `{session}`,
+//! `{provider}`, `{state}`, `{since}`, `{fired_at}`, `{id}` and `{task}`
+//! (` Task: <summary>` if the pane has task metadata, else empty). With
+//! `digest_secs` set, alerts are batched into one mail per window.
+
+use chrono::{DateTime, Utc};
+
+use crate::alerts::Alert;
+
+pub const DEFAULT_SUBJECT: &str = "agtmux alert: {rule} ({pane_id} {state})";
+pub const DEFAULT_BODY: &str = "Rule {rule} fired for pane {pane_id} (session {session}, {provider}): {state} since {since}.{task}";
+
+/// `[email]` section.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct EmailSettings {
+    /// SMTP server, e.g. `smtps://smtp.example.com:465`.
+    pub smtp_url: Option<String>,
+    pub from: Option<String>,
+    pub to: Vec<String>,
+    /// Require STARTTLS on `smtp://` URLs.
+    pub starttls: bool,
+    /// Subject template; default [`DEFAULT_SUBJECT`].
+    pub subject: Option<String>,
+    /// Body template (one alert); default [`DEFAULT_BODY`].
+    pub body: Option<String>,
+    /// Batch alerts into one mail every this many seconds; unset = one mail
+    /// per alert.
+    pub digest_secs: Option<u64>,
+}
+
+impl EmailSettings {
+    /// Whether mail can be sent at all.
+    pub fn is_configured(&self) -> bool {
+        self.smtp_url.is_some() && self.from.is_some() && !self.to.is_empty()
+    }
+
+    /// Errors for a section that rules depend on (`needed`) or that is
+    /// half filled in.
+    pub fn validate(&self, needed: bool) -> anyhow::Result<()> {
+        let any_set = self.smtp_url.is_some() || self.from.is_some() || !self.to.is_empty();
+        if (needed || any_set) && !self.is_configured() {
+            anyhow::bail!("[email] needs smtp_url, from and at least one to address");
+        }
+        if self.digest_secs == Some(0) {
+            anyhow::bail!("email.digest_secs must be > 0 (omit it to send one mail per alert)");
+        }
+        Ok(())
+    }
+
+    /// Mail for a single alert.
+    pub fn mail_for(&self, alert: &Alert, now: DateTime<Utc>) -> Option<Mail> {
+        let subject = render(self.subject.as_deref().unwrap_or(DEFAULT_SUBJECT), alert);
+        let body = render(self.body.as_deref().unwrap_or(DEFAULT_BODY), alert);
+        self.mail(subject, body, now)
+    }
+
+    /// One mail summarising `alerts` (digest mode), body lines in order.
+    pub fn digest_for(&self, alerts: &[Alert], now: DateTime<Utc>) -> Option<Mail> {
+        let template = self.body.as_deref().unwrap_or(DEFAULT_BODY);
+        let body: Vec<String> = alerts.iter().map(|a| render(template, a)).collect();
+        let subject = format!("agtmux: {} alert(s)", alerts.len());
+        self.mail(subject, body.join("\n"), now)
+    }
+
+    fn mail(&self, subject: String, body: String, now: DateTime<Utc>) -> Option<Mail> {
+        Some(Mail {
+            smtp_url: self.smtp_url.clone()?,
+            from: self.from.clone()?,
+            to: self.to.clone(),
+            starttls: self.starttls,
+            subject,
+            body,
+            date: now,
+        })
+    }
+}
+
+fn render(template: &str, alert: &Alert) -> String {
+    template
+        .replace("{rule}", &alert.rule)
+        .replace("{pane_id}", &alert.pane_id)
+        .replace("{session}", alert.session_name.as_deref().unwrap_or("?"))
+        .replace("{provider}", alert.provider.as_deref().unwrap_or("agent"))
+        .replace("{state}", &format!("{:?}", alert.state))
+        .replace("{since}", &alert.since.to_rfc3339())
+        .replace("{fired_at}", &alert.fired_at.to_rfc3339())
+        .replace("{id}", &alert.id.to_string())
+        .replace(
+            "{task}",
+            &alert
+                .task
+                .as_ref()
+                .map(|t| format!(" Task: {}", t.summary()))
+                .unwrap_or_default(),
+        )
+}
+
+/// One message ready for submission.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Mail {
+    pub smtp_url: String,
+    pub from: String,
+    pub to: Vec<String>,
+    pub starttls: bool,
+    pub subject: String,
+    pub body: String,
+    pub date: DateTime<Utc>,
+}
+
+impl Mail {
+    /// `curl` arguments; the message itself goes on stdin.
+    pub fn curl_args(&self) -> Vec<String> {
+        let mut args = vec![
+            "-fsS".to_string(),
+            "-m".to_string(),
+            "30".to_string(),
+            "--netrc-optional".to_string(),
+            "--url".to_string(),
+            self.smtp_url.clone(),
+            "--mail-from".to_string(),
+            self.from.clone(),
+        ];
+        for to in &self.to {
+            args.push("--mail-rcpt".to_string());
+            args.push(to.clone());
+        }
+        if self.starttls {
+            args.push("--ssl-reqd".to_string());
+        }
+        args.extend(["-T".to_string(), "-".to_string()]);
+        args
+    }
+
+    /// RFC 5322 message (CRLF line endings).
+    pub fn message(&self) -> String {
+        let headers = [
+            format!("From: {}", self.from),
+            format!("To: {}", self.to.join(", ")),
+            format!("Subject: {}", single_line(&self.subject)),
+            format!("Date: {}", self.date.to_rfc2822()),
+            "Content-Type: text/plain; charset=utf-8".to_string(),
+        ];
+        let body: Vec<&str> = self.body.lines().collect();
+        format!("{}\r\n\r\n{}\r\n", headers.join("\r\n"), body.join("\r\n"))
+    }
+}
+
+/// Header values must not contain line breaks (header injection).
+fn single_line(s: &str) -> String {
+    s.replace(['\r', '\n'], " ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use agtmux_core_v5::types::ActivityState;
+
+    fn alert(id: u64, pane_id: &str) -> Alert {
+        let at = DateTime::parse_from_rfc3339("2026-10-15T09:00:00Z")
+            .expect("time")
+            .with_timezone(&Utc);
+        Alert {
+            id,
+            rule: "stuck".to_string(),
+            pane_id: pane_id.to_string(),
+            session_name: Some("work".to_string()),
+            provider: Some("claude".to_string()),
+            state: ActivityState::WaitingApproval,
+            since: at,
+            fired_at: at,
+            acked: false,
+            task: None,
+        }
+    }
+
+    fn settings() -> EmailSettings {
+        EmailSettings {
+            smtp_url: Some("smtp://mail.local:587".to_string()),
+            from: Some("agtmux@host".to_string()),
+            to: vec!["a@x".to_string(), "b@x".to_string()],
+            starttls: true,
+            subject: Some("[{rule}] {pane_id}\nBcc: evil@x".to_string()),
+            ..EmailSettings::default()
+        }
+    }
+
+    #[test]
+    fn renders_single_and_digest_mail() {
+        let now = alert(1, "%1").fired_at;
+        let mail = settings().mail_for(&alert(1, "%1"), now).expect("mail");
+        let message = mail.message();
+        assert!(message.starts_with("From: agtmux@host\r\nTo: a@x, b@x\r\n"));
+        assert!(
+            message.contains("Subject: [stuck] %1 Bcc: evil@x\r\n"),
+            "{message}"
+        );
+        assert!(message.contains(
+            "\r\n\r\nRule stuck fired for pane %1 (session work, claude): WaitingApproval since 2026-10-15T09:00:00+00:00.\r\n"
+        ));
+        let args = mail.curl_args();
+        assert_eq!(args.iter().filter(|a| *a == "--mail-rcpt").count(), 2);
+        assert!(args.contains(&"--ssl-reqd".to_string()));
+        assert_eq!(args[args.len() - 2..], ["-T", "-"]);
+
+        let digest = settings()
+            .digest_for(&[alert(1, "%1"), alert(2, "%2")], now)
+            .expect("digest");
+        assert_eq!(digest.subject, "agtmux: 2 alert(s)");
+        assert_eq!(digest.body.lines().count(), 2);
+    }
+
+    #[test]
+    fn validate_requires_complete_section() {
+        assert!(EmailSettings::default().validate(false).is_ok());
+        assert!(EmailSettings::default().validate(true).is_err());
+        let partial = EmailSettings {
+            from: Some("a@x".to_string()),
+            ..EmailSettings::default()
+        };
+        assert!(partial.validate(false).is_err());
+        assert!(settings().validate(true).is_ok());
+        let zero = EmailSettings {
+            digest_secs: Some(0),
+            ..settings()
+        };
+        assert!(zero.validate(true).is_err());
+    }
+}
@@ -0,0 +1,156 @@
+//! Bounded pool for blocking executor work (tmux / ps subprocesses).
+//!
+//! Every subprocess poll_tick spawns goes through one `ExecPool`, so a large
+//! session never forks more than `limits.exec_concurrency` processes at once.
+//! A daemon serves a single tmux server, so the limit is per daemon; there is
+//! no per-target split (v5 has no target concept, see T-153).
+
+use std::sync::Arc;
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::time::Instant;
+
+use tokio::sync::Semaphore;
+
+#[derive(Debug)]
+pub struct ExecPool {
+    permits: Arc<Semaphore>,
+    limit: usize,
+    queued: AtomicUsize,
+    running: AtomicUsize,
+    peak_queued: AtomicUsize,
+    completed: AtomicU64,
+    wait_ms_total: AtomicU64,
+}
+
+/// Queue metrics (`latency_status.exec_pool`).
+#[derive(Debug, Clone, Copy, PartialEq, Eq, serde::Serialize)]
+pub struct ExecPoolStats {
+    pub limit: usize,
+    /// Jobs waiting for a slot right now.
+    pub queued: usize,
+    pub running: usize,
+    /// Longest queue seen since the daemon started.
+    pub peak_queued: usize,
+    pub completed: u64,
+    /// Total time jobs spent waiting for a slot.
+    pub wait_ms_total: u64,
+}
+
+/// Decrements a gauge on drop, so cancelled jobs do not leak counts.
+struct Gauge<'a>(&'a AtomicUsize);
+
+impl<'a> Gauge<'a> {
+    fn enter(counter: &'a AtomicUsize) -> Self {
+        counter.fetch_add(1, Ordering::Relaxed);
+        Self(counter)
+    }
+}
+
+impl Drop for Gauge<'_> {
+    fn drop(&mut self) {
+        self.0.fetch_sub(1, Ordering::Relaxed);
+    }
+}
+
+impl ExecPool {
+    /// Pool running at most `limit` jobs at once (minimum 1).
+    pub fn new(limit: usize) -> Arc<Self> {
+        let limit = limit.max(1);
+        Arc::new(Self {
+            permits: Arc::new(Semaphore::new(limit)),
+            limit,
+            queued: AtomicUsize::new(0),
+            running: AtomicUsize::new(0),
+            peak_queued: AtomicUsize::new(0),
+            completed: AtomicU64::new(0),
+            wait_ms_total: AtomicU64::new(0),
+        })
+    }
+
+    /// Run `job` on the blocking thread pool once a slot is free.
+    pub async fn run<T, F>(&self, job: F) -> Result<T, tokio::task::JoinError>
+    where
+        F: FnOnce() -> T + Send + 'static,
+        T: Send + 'static,
+    {
+        let enqueued = Instant::now();
+        let permit = match Arc::clone(&self.permits).try_acquire_owned() {
+            Ok(permit) => permit,
+            Err(_) => {
+                let _queued = Gauge::enter(&self.queued);
+                self.peak_queued
+                    .fetch_max(self.queued.load(Ordering::Relaxed), Ordering::Relaxed);
+                Arc::clone(&self.permits)
+                    .acquire_owned()
+                    .await
+                    .expect("exec pool semaphore is never closed")
+            }
+        };
+        self.wait_ms_total.fetch_add(
+            u64::try_from(enqueued.elapsed().as_millis()).unwrap_or(u64::MAX),
+            Ordering::Relaxed,
+        );
+
+        let _running = Gauge::enter(&self.running);
+        // The permit moves into the job: a cancelled caller cannot free the
+        // slot while the subprocess is still running.
+        let result = tokio::task::spawn_blocking(move || {
+            let _permit = permit;
+            job()
+        })
+        .await;
+        self.completed.fetch_add(1, Ordering::Relaxed);
+        result
+    }
+
+    pub fn stats(&self) -> ExecPoolStats {
+        ExecPoolStats {
+            limit: self.limit,
+            queued: self.queued.load(Ordering::Relaxed),
+            running: self.running.load(Ordering::Relaxed),
+            peak_queued: self.peak_queued.load(Ordering::Relaxed),
+            completed: self.completed.load(Ordering::Relaxed),
+            wait_ms_total: self.wait_ms_total.load(Ordering::Relaxed),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    async fn bounds_concurrency_and_counts_jobs() {
+        let pool = ExecPool::new(2);
+        let active = Arc::new(AtomicUsize::new(0));
+        let peak = Arc::new(AtomicUsize::new(0));
+
+        let mut jobs = tokio::task::JoinSet::new();
+        for _ in 0..8 {
+            let pool = Arc::clone(&pool);
+            let active = Arc::clone(&active);
+            let peak = Arc::clone(&peak);
+            jobs.spawn(async move {
+                pool.run(move || {
+                    let now = active.fetch_add(1, Ordering::SeqCst) + 1;
+                    peak.fetch_max(now, Ordering::SeqCst);
+                    std::thread::sleep(std::time::Duration::from_millis(20));
+                    active.fetch_sub(1, Ordering::SeqCst);
+                })
+                .await
+            });
+        }
+        while let Some(joined) = jobs.join_next().await {
+            joined.expect("task").expect("job");
+        }
+
+        assert!(
+            peak.load(Ordering::SeqCst) <= 2,
+            "never more than the limit"
+        );
+        let stats = pool.stats();
+        assert_eq!((stats.limit, stats.completed), (2, 8));
+        assert_eq!((stats.queued, stats.running), (0, 0));
+        assert!(stats.peak_queued >= 1);
+    }
+}
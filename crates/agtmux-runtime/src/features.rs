@@ -0,0 +1,196 @@
+//! Feature flag registry: every optional daemon behaviour with its maturity
+//! and default, toggled from `agtmuxd.toml`:
+//!
+//! ```toml
+//! [features]
+//! strict_admission = true
+//! claude_jsonl = false
+//! ```
+//!
+//! Exposed to clients via the `daemon.capabilities` RPC so they can adapt and
+//! operators can audit what is enabled.
+
+use std::collections::{BTreeMap, BTreeSet};
+
+/// Spawn and poll the Codex App Server (`codex app-server`).
+pub const CODEX_APPSERVER: &str = "codex_appserver";
+/// Parse Codex NDJSON from tmux capture while the App Server is unavailable.
+pub const CODEX_CAPTURE_FALLBACK: &str = "codex_capture_fallback";
+/// Discover and tail Claude JSONL transcripts.
+pub const CLAUDE_JSONL: &str = "claude_jsonl";
+/// Reject `source.ingest` calls that fail the trust guard instead of warning.
+pub const STRICT_ADMISSION: &str = "strict_admission";
+/// Serve process / runtime metrics via the `debug.metrics` RPC.
+pub const DEBUG_METRICS: &str = "debug_metrics";
+/// Wake the poll loop on tmux control-mode notifications.
+pub const TMUX_CONTROL: &str = "tmux_control";
+
+/// Maturity of a feature.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, serde::Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Stage {
+    Stable,
+    Experimental,
+}
+
+/// Registry entry.
+#[derive(Debug)]
+pub struct FeatureSpec {
+    pub name: &'static str,
+    pub stage: Stage,
+    pub default: bool,
+    pub description: &'static str,
+}
+
+/// All known features. Adding a flag = one entry here + a gate at the use site.
+pub const REGISTRY: &[FeatureSpec] = &[
+    FeatureSpec {
+        name: CODEX_APPSERVER,
+        stage: Stage::Stable,
+        default: true,
+        description: "Codex App Server thread polling (deterministic Codex state)",
+    },
+    FeatureSpec {
+        name: CODEX_CAPTURE_FALLBACK,
+        stage: Stage::Stable,
+        default: true,
+        description: "Codex NDJSON extraction from tmux capture when the App Server is down",
+    },
+    FeatureSpec {
+        name: CLAUDE_JSONL,
+        stage: Stage::Stable,
+        default: true,
+        description: "Claude JSONL transcript discovery and tailing",
+    },
+    FeatureSpec {
+        name: STRICT_ADMISSION,
+        stage: Stage::Experimental,
+        default: false,
+        description: "Reject source.ingest on trust guard failure (default: warn only)",
+    },
+    FeatureSpec {
+        name: DEBUG_METRICS,
+        stage: Stage::Experimental,
+        default: false,
+        description: "Process, tokio runtime and pipeline metrics via debug.metrics",
+    },
+    FeatureSpec {
+        name: TMUX_CONTROL,
+        stage: Stage::Experimental,
+        default: false,
+        description: "Poll right away on tmux control-mode notifications (tmux 3.2+)",
+    },
+];
+
+/// Effective flags: registry defaults overlaid with `[features]`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Features {
+    enabled: BTreeMap<&'static str, bool>,
+    /// Names set explicitly in the config file.
+    configured: BTreeSet<&'static str>,
+}
+
+impl Default for Features {
+    fn default() -> Self {
+        Self {
+            enabled: REGISTRY.iter().map(|f| (f.name, f.default)).collect(),
+            configured: BTreeSet::new(),
+        }
+    }
+}
+
+impl Features {
+    /// Overlay `[features]`; unknown names are rejected so typos are not ignored.
+    pub fn resolve(section: &BTreeMap<String, bool>) -> anyhow::Result<Self> {
+        let mut features = Self::default();
+        for (name, &on) in section {
+            let Some(spec) = REGISTRY.iter().find(|f| f.name == name) else {
+                let known: Vec<&str> = REGISTRY.iter().map(|f| f.name).collect();
+                anyhow::bail!(
+                    "features.{name}: unknown feature (known: {})",
+                    known.join(", ")
+                );
+            };
+            features.enabled.insert(spec.name, on);
+            features.configured.insert(spec.name);
+        }
+        Ok(features)
+    }
+
+    /// Whether `name` (one of the constants above) is enabled.
+    pub fn is_enabled(&self, name: &str) -> bool {
+        self.enabled.get(name).copied().unwrap_or(false)
+    }
+
+    /// True if the config file set `name` (else the registry default applies).
+    pub fn is_configured(&self, name: &str) -> bool {
+        self.configured.contains(name)
+    }
+
+    /// `daemon.capabilities` feature list, in registry order.
+    pub fn to_json(&self) -> serde_json::Value {
+        REGISTRY
+            .iter()
+            .map(|f| {
+                serde_json::json!({
+                    "name": f.name,
+                    "stage": f.stage,
+                    "enabled": self.is_enabled(f.name),
+                    "default": f.default,
+                    "description": f.description,
+                })
+            })
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn defaults_follow_registry() {
+        let features = Features::default();
+        for spec in REGISTRY {
+            assert_eq!(
+                features.is_enabled(spec.name),
+                spec.default,
+                "{}",
+                spec.name
+            );
+            assert!(!features.is_configured(spec.name));
+        }
+        assert!(!features.is_enabled("no_such_feature"));
+    }
+
+    #[test]
+    fn resolve_overlays_and_rejects_unknown() {
+        let section: BTreeMap<String, bool> = [
+            (STRICT_ADMISSION.to_string(), true),
+            (CLAUDE_JSONL.to_string(), false),
+        ]
+        .into();
+        let features = Features::resolve(&section).expect("known features");
+        assert!(features.is_enabled(STRICT_ADMISSION));
+        assert!(!features.is_enabled(CLAUDE_JSONL));
+        assert!(features.is_configured(CLAUDE_JSONL));
+        assert!(features.is_enabled(CODEX_APPSERVER));
+
+        let section: BTreeMap<String, bool> = [("strict_admision".to_string(), true)].into();
+        let err = Features::resolve(&section).expect_err("typo");
+        assert!(
+            err.to_string().contains("features.strict_admision"),
+            "{err}"
+        );
+    }
+
+    #[test]
+    fn to_json_lists_every_feature() {
+        let json = Features::default().to_json();
+        let list = json.as_array().expect("array");
+        assert_eq!(list.len(), REGISTRY.len());
+        assert_eq!(list[3]["name"], STRICT_ADMISSION);
+        assert_eq!(list[3]["stage"], "experimental");
+        assert_eq!(list[3]["enabled"], false);
+    }
+}
@@ -0,0 +1,80 @@
+//! Git repository / branch of each pane's `current_path`, resolved during
+//! poll_tick (at most once per `poll.git_scan_ms`) and served on
+//! `list_panes` as `git_repo` / `git_branch`.
+
+use std::collections::{BTreeSet, HashMap};
+
+/// Repository a directory belongs to.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct GitMeta {
+    /// Work tree root (`git rev-parse --show-toplevel`).
+    pub repo: String,
+    /// Current branch, `HEAD` when detached.
+    pub branch: String,
+}
+
+impl GitMeta {
+    /// Whether `repo` names this repository: its full root path or the
+    /// root's directory name.
+    pub fn matches_repo(&self, repo: &str) -> bool {
+        self.repo == repo || self.repo.rsplit('/').next() == Some(repo)
+    }
+}
+
+/// Git metadata for each distinct path; paths outside a repository (or
+/// without git installed) map to None. One `git` process per path.
+pub fn scan<'a>(paths: impl IntoIterator<Item = &'a str>) -> HashMap<String, Option<GitMeta>> {
+    let paths: BTreeSet<&str> = paths.into_iter().filter(|p| !p.is_empty()).collect();
+    paths
+        .into_iter()
+        .map(|path| (path.to_string(), detect(path)))
+        .collect()
+}
+
+fn detect(path: &str) -> Option<GitMeta> {
+    let output = std::process::Command::new("git")
+        .args([
+            "-C",
+            path,
+            "rev-parse",
+            "--show-toplevel",
+            "--abbrev-ref",
+            "HEAD",
+        ])
+        .stdin(std::process::Stdio::null())
+        .stderr(std::process::Stdio::null())
+        .output()
+        .ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    parse_rev_parse(&String::from_utf8_lossy(&output.stdout))
+}
+
+/// `--show-toplevel --abbrev-ref HEAD` output: root, then branch.
+fn parse_rev_parse(output: &str) -> Option<GitMeta> {
+    let mut lines = output.lines().map(str::trim);
+    let repo = lines.next().filter(|l| !l.is_empty())?;
+    let branch = lines.next().filter(|l| !l.is_empty())?;
+    Some(GitMeta {
+        repo: repo.to_string(),
+        branch: branch.to_string(),
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_rev_parse_and_matches_repo() {
+        let meta = parse_rev_parse("/home/u/src/agtmux\nfeat/git\n").expect("meta");
+        assert_eq!(meta.repo, "/home/u/src/agtmux");
+        assert_eq!(meta.branch, "feat/git");
+        assert!(meta.matches_repo("agtmux"));
+        assert!(meta.matches_repo("/home/u/src/agtmux"));
+        assert!(!meta.matches_repo("src"));
+        assert_eq!(parse_rev_parse("/home/u/src/agtmux\n"), None);
+        assert_eq!(parse_rev_parse(""), None);
+    }
+}
@@ -0,0 +1,321 @@
+//! Pane groups ("workspaces"): named sets of arbitrary panes, e.g. the
+//! agents of one project spread over several sessions. Groups are listed
+//! with an aggregated state summary and support group actions:
+//! `group.send` types the same text into every member, `group.kill` kills
+//! them all (busy agents only with `force`, as for `pane.kill`).
+//!
+//! Groups live in daemon memory like labels (SQLite is Post-MVP): members
+//! that disappear from tmux are dropped, and an emptied group stays listed
+//! until `group.remove`. Group actions share `request_ref` replay with
+//! `actions`.
+
+use std::collections::{BTreeMap, BTreeSet};
+use std::sync::Arc;
+
+use agtmux_core_v5::types::{PanePresence, PaneRuntimeState};
+use agtmux_tmux_v5::TmuxPaneInfo;
+use serde_json::Value;
+use tokio::sync::Mutex;
+
+use crate::actions::{self, ActionError};
+use crate::poll_loop::DaemonState;
+
+/// Methods served by [`execute`].
+pub const METHODS: &[&str] = &[
+    "group.add",
+    "group.remove",
+    "group.list",
+    "group.send",
+    "group.kill",
+];
+
+/// Group name → member pane ids.
+#[derive(Debug, Default, Clone, PartialEq, Eq)]
+pub struct PaneGroups {
+    groups: BTreeMap<String, BTreeSet<String>>,
+}
+
+impl PaneGroups {
+    /// Add panes to `name`, creating the group.
+    pub fn add(&mut self, name: &str, pane_ids: &[String]) {
+        self.groups
+            .entry(name.to_string())
+            .or_default()
+            .extend(pane_ids.iter().cloned());
+    }
+
+    /// Remove `pane_ids` from `name`, or the whole group when None. Returns
+    /// false if the group does not exist.
+    pub fn remove(&mut self, name: &str, pane_ids: Option<&[String]>) -> bool {
+        match pane_ids {
+            None => self.groups.remove(name).is_some(),
+            Some(pane_ids) => self.groups.get_mut(name).is_some_and(|members| {
+                for pane_id in pane_ids {
+                    members.remove(pane_id);
+                }
+                true
+            }),
+        }
+    }
+
+    /// Drop members that are no longer live panes. Returns whether any was
+    /// dropped.
+    pub fn retain_panes(&mut self, live: &[&str]) -> bool {
+        let mut changed = false;
+        for members in self.groups.values_mut() {
+            let before = members.len();
+            members.retain(|pane_id| live.contains(&pane_id.as_str()));
+            changed |= members.len() != before;
+        }
+        changed
+    }
+
+    pub fn members(&self, name: &str) -> Option<&BTreeSet<String>> {
+        self.groups.get(name)
+    }
+
+    /// Groups `pane_id` belongs to, by name.
+    pub fn groups_of(&self, pane_id: &str) -> Vec<&str> {
+        self.groups
+            .iter()
+            .filter(|(_, members)| members.contains(pane_id))
+            .map(|(name, _)| name.as_str())
+            .collect()
+    }
+
+    /// `group.list`: every group with its members and counts of managed
+    /// panes by activity state and provider.
+    pub fn summaries(&self, states: &[&PaneRuntimeState], tmux: &[TmuxPaneInfo]) -> Value {
+        let summaries: Vec<Value> = self
+            .groups
+            .iter()
+            .map(|(name, members)| {
+                let mut by_state: BTreeMap<String, u32> = BTreeMap::new();
+                let mut by_provider: BTreeMap<&str, u32> = BTreeMap::new();
+                let mut sessions = BTreeSet::new();
+                let mut managed = 0;
+                for pane_id in members {
+                    if let Some(info) = tmux.iter().find(|t| &t.pane_id == pane_id) {
+                        sessions.insert(info.session_name.as_str());
+                    }
+                    let Some(state) = states.iter().find(|s| {
+                        &s.pane_instance_id.pane_id == pane_id
+                            && s.presence == PanePresence::Managed
+                    }) else {
+                        continue;
+                    };
+                    managed += 1;
+                    *by_state
+                        .entry(format!("{:?}", state.activity_state))
+                        .or_default() += 1;
+                    if let Some(provider) = state.provider {
+                        *by_provider.entry(provider.as_str()).or_default() += 1;
+                    }
+                }
+                serde_json::json!({
+                    "name": name,
+                    "panes": members,
+                    "sessions": sessions,
+                    "summary": {
+                        "total": members.len(),
+                        "managed": managed,
+                        "unmanaged": members.len() - managed,
+                        "states": by_state,
+                        "providers": by_provider,
+                    },
+                })
+            })
+            .collect();
+        Value::Array(summaries)
+    }
+}
+
+fn group_name(params: &Value) -> Result<String, ActionError> {
+    params["group"]
+        .as_str()
+        .map(str::trim)
+        .filter(|s| !s.is_empty())
+        .map(String::from)
+        .ok_or_else(|| ActionError::InvalidParams("group is required".to_string()))
+}
+
+fn pane_ids(params: &Value) -> Option<Vec<String>> {
+    params["pane_ids"].as_array().map(|ids| {
+        ids.iter()
+            .filter_map(Value::as_str)
+            .map(String::from)
+            .collect()
+    })
+}
+
+/// Run a `group.*` request.
+pub async fn execute(
+    state: &Arc<Mutex<DaemonState>>,
+    method: &str,
+    params: &Value,
+) -> Result<Value, ActionError> {
+    match method {
+        "group.list" => {
+            let st = state.lock().await;
+            Ok(st.groups.summaries(&st.daemon.list_panes(), &st.last_panes))
+        }
+        "group.add" => {
+            let name = group_name(params)?;
+            let pane_ids = pane_ids(params).unwrap_or_default();
+            if pane_ids.is_empty() {
+                return Err(ActionError::InvalidParams(
+                    "pane_ids must not be empty".to_string(),
+                ));
+            }
+            let mut st = state.lock().await;
+            if let Some(unknown) = pane_ids
+                .iter()
+                .find(|id| !st.last_panes.iter().any(|p| &p.pane_id == *id))
+            {
+                return Err(ActionError::PaneNotFound(unknown.clone()));
+            }
+            st.groups.add(&name, &pane_ids);
+            st.invalidate_pane_list();
+            Ok(serde_json::json!({"group": name, "panes": st.groups.members(&name)}))
+        }
+        "group.remove" => {
+            let name = group_name(params)?;
+            let pane_ids = pane_ids(params);
+            let mut st = state.lock().await;
+            if !st.groups.remove(&name, pane_ids.as_deref()) {
+                return Err(ActionError::InvalidParams(format!(
+                    "unknown group: {name:?}"
+                )));
+            }
+            st.invalidate_pane_list();
+            Ok(serde_json::json!({"group": name, "panes": st.groups.members(&name)}))
+        }
+        "group.send" | "group.kill" => broadcast(state, method, params).await,
+        _ => Err(ActionError::InvalidParams(format!(
+            "unknown group method: {method}"
+        ))),
+    }
+}
+
+/// `group.send` / `group.kill`: one tmux invocation per member, in pane id
+/// order. A failing pane does not stop the others; failures are reported
+/// per pane.
+async fn broadcast(
+    state: &Arc<Mutex<DaemonState>>,
+    method: &str,
+    params: &Value,
+) -> Result<Value, ActionError> {
+    let name = group_name(params)?;
+    let request_ref = params["request_ref"].as_str().map(String::from);
+    let text = params["text"].as_str().unwrap_or("");
+    let enter = params["enter"].as_bool().unwrap_or(true);
+    let force = params["force"].as_bool().unwrap_or(false);
+    if method == "group.send" && text.is_empty() && !enter {
+        return Err(ActionError::InvalidParams(
+            "text must not be empty".to_string(),
+        ));
+    }
+    let fingerprint = format!("{method} {name} {text:?} {enter} {force}");
+
+    let (members, runner, pool, claim) = {
+        let (st, claim) = match actions::claim(state, request_ref.as_deref(), &fingerprint).await {
+            actions::Claimed::Run(st, claim) => (st, claim),
+            actions::Claimed::Replay(result) => return result,
+        };
+        let members: Vec<String> = st
+            .groups
+            .members(&name)
+            .ok_or_else(|| ActionError::InvalidParams(format!("unknown group: {name:?}")))?
+            .iter()
+            .cloned()
+            .collect();
+        if method == "group.kill" && !force {
+            actions::refuse_busy(members.iter().map(String::as_str), &st.daemon.list_panes())?;
+        }
+        if method == "group.send" {
+            st.send_policy.check_input(text)?;
+            st.send_policy
+                .check_panes(members.iter().map(String::as_str), &st.daemon.list_panes())?;
+        }
+        (
+            members,
+            actions::tmux_runner(&st)?,
+            Arc::clone(&st.exec_pool),
+            claim,
+        )
+    };
+
+    let mut done = Vec::new();
+    let mut failed = serde_json::Map::new();
+    for pane_id in &members {
+        let args = if method == "group.kill" {
+            vec!["kill-pane".to_string(), "-t".to_string(), pane_id.clone()]
+        } else {
+            actions::send_keys_args(pane_id, text, None, enter)
+        };
+        match actions::run_tmux(&runner, &pool, args).await {
+            Ok(_) => done.push(pane_id.clone()),
+            Err(e) => {
+                failed.insert(pane_id.clone(), Value::String(e.to_string()));
+            }
+        }
+    }
+    tracing::info!(method, group = %name, panes = done.len(), failed = failed.len(), "group action ran");
+
+    let result = serde_json::json!({
+        "action": method,
+        "group": name,
+        "panes": done,
+        "failed": failed,
+        "request_ref": request_ref,
+        "replayed": false,
+    });
+    actions::remember(&mut *state.lock().await, claim, &result);
+    Ok(result)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn ids(ids: &[&str]) -> Vec<String> {
+        ids.iter().map(|s| s.to_string()).collect()
+    }
+
+    #[test]
+    fn add_remove_and_prune_members() {
+        let mut groups = PaneGroups::default();
+        groups.add("api", &ids(&["%1", "%2"]));
+        groups.add("web", &ids(&["%2"]));
+        assert_eq!(groups.groups_of("%2"), ["api", "web"]);
+
+        assert!(groups.remove("api", Some(&ids(&["%1"]))));
+        assert_eq!(groups.groups_of("%1"), Vec::<&str>::new());
+        assert!(!groups.remove("nope", None));
+
+        assert!(groups.retain_panes(&["%3"]));
+        assert!(
+            groups.members("web").is_some_and(BTreeSet::is_empty),
+            "emptied group stays"
+        );
+        assert!(!groups.retain_panes(&["%3"]));
+        assert!(groups.remove("web", None));
+        assert!(groups.members("web").is_none());
+    }
+
+    #[test]
+    fn summaries_count_members() {
+        let mut groups = PaneGroups::default();
+        groups.add("api", &ids(&["%1", "%2"]));
+        let tmux = vec![TmuxPaneInfo {
+            pane_id: "%1".to_string(),
+            session_name: "work".to_string(),
+            ..Default::default()
+        }];
+        let summary = groups.summaries(&[], &tmux);
+        assert_eq!(summary[0]["name"], "api");
+        assert_eq!(summary[0]["sessions"], serde_json::json!(["work"]));
+        assert_eq!(summary[0]["summary"]["total"], 2);
+        assert_eq!(summary[0]["summary"]["unmanaged"], 2);
+    }
+}
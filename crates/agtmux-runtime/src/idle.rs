@@ -0,0 +1,392 @@
+//! Idle timeout policies (`[[idle_timeout]]`): act on managed panes that
+//! stayed `Idle` for `after_secs`, e.g. to reclaim a GPU box from an agent
+//! somebody forgot about.
+//!
+//! ```toml
+//! [[idle_timeout]]
+//! name = "nudge"
+//! after_secs = 1800
+//! notify = true
+//!
+//! [[idle_timeout]]
+//! name = "reclaim"
+//! provider = "claude"
+//! session = "gpu"
+//! after_secs = 7200
+//! kill = true           # or: key = "C-c"
+//! ```
+//!
+//! Every policy fires once per idle period of a pane, so several policies
+//! with growing `after_secs` escalate. Each firing is logged. Idle periods
+//! belong to a pane instance: a pane id tmux reuses for a new pane starts
+//! from zero and gets every policy again.
+
+use std::collections::{HashMap, HashSet};
+
+use agtmux_core_v5::types::{ActivityState, PaneInstanceId, PanePresence, PaneRuntimeState};
+use agtmux_tmux_v5::TmuxPaneInfo;
+use chrono::{DateTime, Utc};
+
+use crate::notify::{Backend, Notice};
+
+/// One `[[idle_timeout]]` entry; criteria left unset match any pane.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct IdlePolicy {
+    pub name: String,
+    /// Seconds a pane must stay `Idle`.
+    pub after_secs: u64,
+    /// Only panes of this provider (`claude`, `codex`, ...).
+    pub provider: Option<String>,
+    /// Only panes in this tmux session.
+    pub session: Option<String>,
+    /// Only panes with this label.
+    pub label: Option<String>,
+    /// Show a desktop notification on the daemon host.
+    #[serde(default)]
+    pub notify: bool,
+    /// tmux key sent to the pane (`C-c`, `C-d`, ...).
+    pub key: Option<String>,
+    /// Kill the pane.
+    #[serde(default)]
+    pub kill: bool,
+}
+
+impl IdlePolicy {
+    fn matches(
+        &self,
+        pane: &PaneRuntimeState,
+        tmux: Option<&TmuxPaneInfo>,
+        label: Option<&str>,
+    ) -> bool {
+        self.provider
+            .as_deref()
+            .is_none_or(|p| pane.provider.is_some_and(|q| q.as_str() == p))
+            && self
+                .session
+                .as_deref()
+                .is_none_or(|s| tmux.is_some_and(|t| t.session_name == s))
+            && self.label.as_deref().is_none_or(|l| label == Some(l))
+    }
+}
+
+/// Reject unnamed / duplicate policies, zero timeouts and policies without
+/// (or with conflicting) actions.
+pub fn validate_policies(policies: &[IdlePolicy]) -> anyhow::Result<()> {
+    for (i, policy) in policies.iter().enumerate() {
+        if policy.name.trim().is_empty() {
+            anyhow::bail!("idle_timeout[{i}].name must not be empty");
+        }
+        if policies[..i].iter().any(|p| p.name == policy.name) {
+            anyhow::bail!("duplicate idle_timeout name {:?}", policy.name);
+        }
+        if policy.after_secs == 0 {
+            anyhow::bail!("idle_timeout {:?}: after_secs must be > 0", policy.name);
+        }
+        if !policy.notify && policy.key.is_none() && !policy.kill {
+            anyhow::bail!(
+                "idle_timeout {:?}: set at least one of notify, key, kill",
+                policy.name
+            );
+        }
+        if policy.kill && policy.key.is_some() {
+            anyhow::bail!(
+                "idle_timeout {:?}: key and kill cannot be combined",
+                policy.name
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Side effect of a fired policy; run off the lock via the exec pool.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum IdleAction {
+    Notify(Notice),
+    /// tmux command (`send-keys` / `kill-pane`) for `pane_id`.
+    Tmux {
+        pane_id: String,
+        args: Vec<String>,
+    },
+}
+
+/// Tracks how long each managed pane has been idle.
+#[derive(Debug, Default)]
+pub struct IdleReaper {
+    policies: Vec<IdlePolicy>,
+    backend: Option<Backend>,
+    /// Pane instance → start of its current idle period.
+    idle_since: HashMap<PaneInstanceId, DateTime<Utc>>,
+    /// (policy, pane instance) pairs fired in the current idle period.
+    fired: HashSet<(String, PaneInstanceId)>,
+}
+
+impl IdleReaper {
+    pub fn new(policies: Vec<IdlePolicy>) -> Self {
+        let mut reaper = Self::default();
+        reaper.set_policies(policies);
+        reaper
+    }
+
+    /// Replace the policies (SIGHUP); idle periods are kept.
+    pub fn set_policies(&mut self, policies: Vec<IdlePolicy>) {
+        self.backend = if policies.iter().any(|p| p.notify) {
+            let backend = Backend::detect();
+            if backend.is_none() {
+                tracing::warn!(
+                    "idle_timeout policies use notify but no notification command was found"
+                );
+            }
+            backend
+        } else {
+            None
+        };
+        self.policies = policies;
+    }
+
+    /// Update idle periods and return the actions of policies whose
+    /// timeout passed.
+    pub fn observe(
+        &mut self,
+        panes: &[&PaneRuntimeState],
+        tmux: &[TmuxPaneInfo],
+        labels: &HashMap<String, String>,
+        now: DateTime<Utc>,
+    ) -> Vec<IdleAction> {
+        let idle: Vec<&PaneRuntimeState> = panes
+            .iter()
+            .copied()
+            .filter(|p| {
+                p.presence == PanePresence::Managed && p.activity_state == ActivityState::Idle
+            })
+            .collect();
+        let mut idle_since = HashMap::with_capacity(idle.len());
+        for pane in &idle {
+            let instance = &pane.pane_instance_id;
+            let since = self.idle_since.get(instance).copied().unwrap_or(now);
+            idle_since.insert(instance.clone(), since);
+        }
+        self.idle_since = idle_since;
+        self.fired
+            .retain(|(_, instance)| self.idle_since.contains_key(instance));
+
+        let mut actions = Vec::new();
+        for policy in &self.policies {
+            for pane in &idle {
+                let instance = &pane.pane_instance_id;
+                let pane_id = &instance.pane_id;
+                let since = self.idle_since[instance];
+                let idle_secs = (now - since).num_seconds().max(0) as u64;
+                let info = tmux.iter().find(|t| &t.pane_id == pane_id);
+                let label = labels.get(pane_id).map(String::as_str);
+                if idle_secs < policy.after_secs
+                    || !policy.matches(pane, info, label)
+                    || !self.fired.insert((policy.name.clone(), instance.clone()))
+                {
+                    continue;
+                }
+                tracing::info!(
+                    policy = %policy.name,
+                    pane_id = %pane_id,
+                    idle_secs,
+                    "idle timeout reached"
+                );
+                if policy.notify
+                    && let Some(backend) = self.backend
+                {
+                    actions.push(IdleAction::Notify(Notice {
+                        backend,
+                        title: format!("agtmux idle: {}", policy.name),
+                        body: format!(
+                            "pane {pane_id} ({}) idle for {}m",
+                            pane.provider.map_or("agent", |p| p.as_str()),
+                            idle_secs / 60
+                        ),
+                    }));
+                }
+                let target = ["-t".to_string(), pane_id.clone()];
+                if let Some(key) = &policy.key {
+                    let mut args = vec!["send-keys".to_string()];
+                    args.extend(target);
+                    args.push(key.clone());
+                    actions.push(IdleAction::Tmux {
+                        pane_id: pane_id.clone(),
+                        args,
+                    });
+                } else if policy.kill {
+                    let mut args = vec!["kill-pane".to_string()];
+                    args.extend(target);
+                    actions.push(IdleAction::Tmux {
+                        pane_id: pane_id.clone(),
+                        args,
+                    });
+                }
+            }
+        }
+        actions
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support::pane;
+    use chrono::Duration;
+
+    fn policy(name: &str, after_secs: u64) -> IdlePolicy {
+        IdlePolicy {
+            name: name.to_string(),
+            after_secs,
+            provider: Some("claude".to_string()),
+            session: None,
+            label: None,
+            notify: false,
+            key: None,
+            kill: false,
+        }
+    }
+
+    #[test]
+    fn escalates_once_per_idle_period() {
+        let mut reaper = IdleReaper::new(vec![
+            IdlePolicy {
+                key: Some("C-c".to_string()),
+                ..policy("interrupt", 60)
+            },
+            IdlePolicy {
+                kill: true,
+                ..policy("reclaim", 300)
+            },
+        ]);
+        let labels = HashMap::new();
+        let idle = pane("%1", ActivityState::Idle);
+        let t0 = Utc::now();
+
+        assert!(reaper.observe(&[&idle], &[], &labels, t0).is_empty());
+        let actions = reaper.observe(&[&idle], &[], &labels, t0 + Duration::seconds(60));
+        assert_eq!(
+            actions,
+            [IdleAction::Tmux {
+                pane_id: "%1".to_string(),
+                args: ["send-keys", "-t", "%1", "C-c"].map(String::from).to_vec(),
+            }]
+        );
+        assert!(
+            reaper
+                .observe(&[&idle], &[], &labels, t0 + Duration::seconds(120))
+                .is_empty(),
+            "fires once"
+        );
+        let actions = reaper.observe(&[&idle], &[], &labels, t0 + Duration::seconds(300));
+        assert_eq!(
+            actions,
+            [IdleAction::Tmux {
+                pane_id: "%1".to_string(),
+                args: ["kill-pane", "-t", "%1"].map(String::from).to_vec(),
+            }]
+        );
+
+        // Activity starts a new idle period.
+        let running = pane("%1", ActivityState::Running);
+        let t1 = t0 + Duration::seconds(400);
+        reaper.observe(&[&running], &[], &labels, t1);
+        reaper.observe(&[&idle], &[], &labels, t1);
+        assert!(
+            reaper
+                .observe(&[&idle], &[], &labels, t1 + Duration::seconds(59))
+                .is_empty()
+        );
+        assert_eq!(
+            reaper
+                .observe(&[&idle], &[], &labels, t1 + Duration::seconds(60))
+                .len(),
+            1
+        );
+    }
+
+    #[test]
+    fn reused_pane_ids_start_a_new_idle_period() {
+        let mut reaper = IdleReaper::new(vec![IdlePolicy {
+            kill: true,
+            ..policy("reclaim", 60)
+        }]);
+        let labels = HashMap::new();
+        let old = pane("%1", ActivityState::Idle);
+        let t0 = Utc::now();
+        reaper.observe(&[&old], &[], &labels, t0);
+        assert_eq!(
+            reaper
+                .observe(&[&old], &[], &labels, t0 + Duration::seconds(60))
+                .len(),
+            1
+        );
+
+        // tmux hands %1 to a new pane within one tick.
+        let mut new = pane("%1", ActivityState::Idle);
+        new.pane_instance_id.generation = 1;
+        assert!(
+            reaper
+                .observe(&[&new], &[], &labels, t0 + Duration::seconds(61))
+                .is_empty(),
+            "the new pane was not idle for 60s"
+        );
+        assert_eq!(
+            reaper
+                .observe(&[&new], &[], &labels, t0 + Duration::seconds(121))
+                .len(),
+            1,
+            "and is not covered by the old pane's firing"
+        );
+    }
+
+    #[test]
+    fn filters_by_label_and_provider() {
+        let mut reaper = IdleReaper::new(vec![IdlePolicy {
+            label: Some("gpu".to_string()),
+            kill: true,
+            ..policy("reclaim", 10)
+        }]);
+        let idle = pane("%1", ActivityState::Idle);
+        let t0 = Utc::now();
+        let mut labels = HashMap::new();
+        reaper.observe(&[&idle], &[], &labels, t0);
+        assert!(
+            reaper
+                .observe(&[&idle], &[], &labels, t0 + Duration::seconds(10))
+                .is_empty()
+        );
+        labels.insert("%1".to_string(), "gpu".to_string());
+        assert_eq!(
+            reaper
+                .observe(&[&idle], &[], &labels, t0 + Duration::seconds(11))
+                .len(),
+            1
+        );
+    }
+
+    #[test]
+    fn validates_policies() {
+        let notify = IdlePolicy {
+            notify: true,
+            ..policy("nudge", 60)
+        };
+        assert!(validate_policies(std::slice::from_ref(&notify)).is_ok());
+        assert!(validate_policies(&[policy("none", 60)]).is_err());
+        assert!(
+            validate_policies(&[IdlePolicy {
+                after_secs: 0,
+                ..notify.clone()
+            }])
+            .is_err()
+        );
+        assert!(
+            validate_policies(&[IdlePolicy {
+                key: Some("C-c".to_string()),
+                kill: true,
+                ..policy("both", 60)
+            }])
+            .is_err()
+        );
+        assert!(validate_policies(&[notify.clone(), notify]).is_err());
+    }
+}
@@ -0,0 +1,274 @@
+//! Daemon log sinks (`[log] sinks`): stderr, a size-rotated file and syslog
+//! (`/dev/log`, which journald also serves). Every formatted tracing event
+//! is buffered by one [`SinkWriter`] and fanned out whole on drop, so sinks
+//! never see partial lines.
+
+use std::fs::{File, OpenOptions};
+use std::io::Write;
+use std::os::unix::net::UnixDatagram;
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, Mutex};
+
+/// Default `[log] max_file_bytes`.
+pub const DEFAULT_MAX_FILE_BYTES: u64 = 10 * 1024 * 1024;
+/// Default `[log] keep_files`.
+pub const DEFAULT_KEEP_FILES: u32 = 5;
+const SYSLOG_SOCKET: &str = "/dev/log";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, serde::Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SinkKind {
+    Stderr,
+    File,
+    Syslog,
+}
+
+/// Resolved `[log]` sink settings.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SinkConfig {
+    pub sinks: Vec<SinkKind>,
+    /// Log file (required with the `file` sink).
+    pub file: Option<PathBuf>,
+    /// Rotate once the file would exceed this size.
+    pub max_file_bytes: u64,
+    /// Rotated files kept (`agtmuxd.log.1` .. `.N`).
+    pub keep_files: u32,
+}
+
+impl Default for SinkConfig {
+    fn default() -> Self {
+        Self {
+            sinks: vec![SinkKind::Stderr],
+            file: None,
+            max_file_bytes: DEFAULT_MAX_FILE_BYTES,
+            keep_files: DEFAULT_KEEP_FILES,
+        }
+    }
+}
+
+impl SinkConfig {
+    /// Only stderr: the formatter may use ANSI colors on a terminal.
+    pub fn is_stderr_only(&self) -> bool {
+        self.sinks == [SinkKind::Stderr]
+    }
+}
+
+/// Size-rotated log file.
+#[derive(Debug)]
+struct RotatingFile {
+    path: PathBuf,
+    file: File,
+    size: u64,
+    max_bytes: u64,
+    keep: u32,
+}
+
+impl RotatingFile {
+    fn open(path: &Path, max_bytes: u64, keep: u32) -> std::io::Result<Self> {
+        if let Some(dir) = path.parent() {
+            std::fs::create_dir_all(dir)?;
+        }
+        let file = OpenOptions::new().create(true).append(true).open(path)?;
+        let size = file.metadata()?.len();
+        Ok(Self {
+            path: path.to_path_buf(),
+            file,
+            size,
+            max_bytes,
+            keep,
+        })
+    }
+
+    fn write_line(&mut self, line: &[u8]) -> std::io::Result<()> {
+        if self.size > 0 && self.size + line.len() as u64 > self.max_bytes {
+            self.rotate()?;
+        }
+        self.file.write_all(line)?;
+        self.size += line.len() as u64;
+        Ok(())
+    }
+
+    /// `log` → `log.1` → … → `log.<keep>`; the oldest falls off.
+    fn rotate(&mut self) -> std::io::Result<()> {
+        let numbered = |n: u32| PathBuf::from(format!("{}.{n}", self.path.display()));
+        if self.keep == 0 {
+            std::fs::remove_file(&self.path)?;
+        } else {
+            for n in (1..self.keep).rev() {
+                let from = numbered(n);
+                if from.exists() {
+                    std::fs::rename(&from, numbered(n + 1))?;
+                }
+            }
+            std::fs::rename(&self.path, numbered(1))?;
+        }
+        self.file = OpenOptions::new()
+            .create(true)
+            .append(true)
+            .open(&self.path)?;
+        self.size = 0;
+        Ok(())
+    }
+}
+
+#[derive(Debug)]
+struct Sinks {
+    stderr: bool,
+    file: Option<Mutex<RotatingFile>>,
+    syslog: Option<UnixDatagram>,
+    /// Syslog tag, e.g. `agtmux-daemon`.
+    ident: String,
+}
+
+/// `MakeWriter` source for `tracing_subscriber::fmt().with_writer(...)`.
+#[derive(Debug, Clone)]
+pub struct LogSinks(Arc<Sinks>);
+
+impl LogSinks {
+    /// Open every configured sink. `component` tags syslog entries.
+    pub fn open(config: &SinkConfig, component: &str) -> anyhow::Result<Self> {
+        let file = if config.sinks.contains(&SinkKind::File) {
+            let path = config
+                .file
+                .as_deref()
+                .ok_or_else(|| anyhow::anyhow!("log sink \"file\" needs log.file"))?;
+            let file = RotatingFile::open(path, config.max_file_bytes, config.keep_files)
+                .map_err(|e| anyhow::anyhow!("log.file {}: {e}", path.display()))?;
+            Some(Mutex::new(file))
+        } else {
+            None
+        };
+        let syslog = if config.sinks.contains(&SinkKind::Syslog) {
+            let socket = UnixDatagram::unbound()?;
+            socket
+                .connect(SYSLOG_SOCKET)
+                .map_err(|e| anyhow::anyhow!("syslog {SYSLOG_SOCKET}: {e}"))?;
+            Some(socket)
+        } else {
+            None
+        };
+        Ok(Self(Arc::new(Sinks {
+            stderr: config.sinks.contains(&SinkKind::Stderr),
+            file,
+            syslog,
+            ident: format!("agtmux-{component}"),
+        })))
+    }
+
+    /// Writer for one event.
+    pub fn writer(&self) -> SinkWriter {
+        SinkWriter {
+            sinks: Arc::clone(&self.0),
+            buf: Vec::new(),
+        }
+    }
+}
+
+/// Buffers one formatted event; dispatched to every sink on drop.
+#[derive(Debug)]
+pub struct SinkWriter {
+    sinks: Arc<Sinks>,
+    buf: Vec<u8>,
+}
+
+impl Write for SinkWriter {
+    fn write(&mut self, data: &[u8]) -> std::io::Result<usize> {
+        self.buf.extend_from_slice(data);
+        Ok(data.len())
+    }
+
+    fn flush(&mut self) -> std::io::Result<()> {
+        Ok(())
+    }
+}
+
+impl Drop for SinkWriter {
+    fn drop(&mut self) {
+        if self.buf.is_empty() {
+            return;
+        }
+        let sinks = &self.sinks;
+        // Sink failures cannot be logged (that would recurse); drop the line.
+        if sinks.stderr {
+            let _ = std::io::stderr().write_all(&self.buf);
+        }
+        if let Some(file) = &sinks.file
+            && let Ok(mut file) = file.lock()
+        {
+            let _ = file.write_line(&self.buf);
+        }
+        if let Some(socket) = &sinks.syslog {
+            let line = String::from_utf8_lossy(&self.buf);
+            let _ = socket.send(syslog_message(&sinks.ident, &line).as_bytes());
+        }
+    }
+}
+
+/// RFC 3164 message for facility `daemon`; severity from the event level.
+fn syslog_message(ident: &str, line: &str) -> String {
+    const FACILITY_DAEMON: u8 = 3;
+    let severity = match line.split_whitespace().nth(1) {
+        Some("ERROR") => 3,
+        Some("WARN") => 4,
+        Some("INFO") => 6,
+        _ => 7,
+    };
+    let priority = FACILITY_DAEMON * 8 + severity;
+    format!(
+        "<{priority}>{ident}[{}]: {}",
+        std::process::id(),
+        line.trim_end()
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn file_sink_rotates_by_size() {
+        let dir = std::env::temp_dir().join(format!("agtmux-log-sink-{}", std::process::id()));
+        let _ = std::fs::remove_dir_all(&dir);
+        let path = dir.join("agtmuxd.log");
+        let config = SinkConfig {
+            sinks: vec![SinkKind::File],
+            file: Some(path.clone()),
+            max_file_bytes: 16,
+            keep_files: 2,
+        };
+        let sinks = LogSinks::open(&config, "daemon").expect("open");
+        for line in ["first line\n", "second line\n", "third line\n", "fourth\n"] {
+            let mut writer = sinks.writer();
+            writer.write_all(line.as_bytes()).expect("write");
+        }
+
+        let read = |p: &Path| std::fs::read_to_string(p).expect("read");
+        let rotated = |n: u32| PathBuf::from(format!("{}.{n}", path.display()));
+        assert_eq!(read(&path), "fourth\n");
+        assert_eq!(read(&rotated(1)), "third line\n");
+        assert_eq!(read(&rotated(2)), "second line\n");
+        assert!(!rotated(3).exists(), "only keep_files rotations kept");
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[test]
+    fn syslog_priority_from_level() {
+        let line = "2026-10-15T09:00:00.000Z  WARN agtmux::poll_loop: tick slow\n";
+        let message = syslog_message("agtmux-daemon", line);
+        assert!(message.starts_with("<28>agtmux-daemon["), "{message}");
+        assert!(
+            message.ends_with("]: 2026-10-15T09:00:00.000Z  WARN agtmux::poll_loop: tick slow")
+        );
+        assert!(syslog_message("x", "t ERROR m").starts_with("<27>"));
+        assert!(syslog_message("x", "t DEBUG m").starts_with("<31>"));
+    }
+
+    #[test]
+    fn file_sink_requires_path() {
+        let config = SinkConfig {
+            sinks: vec![SinkKind::File],
+            ..SinkConfig::default()
+        };
+        assert!(LogSinks::open(&config, "daemon").is_err());
+    }
+}
@@ -0,0 +1,82 @@
+//! Size-capped map with least-recently-written eviction, for daemon caches
+//! keyed by ids that are never explicitly removed (e.g. session keys).
+
+use std::collections::HashMap;
+
+#[derive(Debug)]
+pub struct LruMap<V> {
+    entries: HashMap<String, (V, u64)>,
+    capacity: usize,
+    /// Monotonic write counter; an entry's stamp is its last write.
+    clock: u64,
+}
+
+impl<V: PartialEq> LruMap<V> {
+    /// Map holding at most `capacity` entries (minimum 1).
+    pub fn new(capacity: usize) -> Self {
+        Self {
+            entries: HashMap::new(),
+            capacity: capacity.max(1),
+            clock: 0,
+        }
+    }
+
+    pub fn get(&self, key: &str) -> Option<&V> {
+        self.entries.get(key).map(|(value, _)| value)
+    }
+
+    /// Insert or refresh `key`, evicting the least recently written entry
+    /// when full. Returns true if the stored value changed.
+    pub fn insert(&mut self, key: String, value: V) -> bool {
+        self.clock += 1;
+        if let Some(entry) = self.entries.get_mut(&key) {
+            entry.1 = self.clock;
+            if entry.0 == value {
+                return false;
+            }
+            entry.0 = value;
+            return true;
+        }
+        if self.entries.len() >= self.capacity
+            && let Some(oldest) = self
+                .entries
+                .iter()
+                .min_by_key(|(_, (_, stamp))| *stamp)
+                .map(|(k, _)| k.clone())
+        {
+            self.entries.remove(&oldest);
+        }
+        self.entries.insert(key, (value, self.clock));
+        true
+    }
+
+    pub fn len(&self) -> usize {
+        self.entries.len()
+    }
+
+    pub fn capacity(&self) -> usize {
+        self.capacity
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn evicts_least_recently_written() {
+        let mut map = LruMap::new(2);
+        assert!(map.insert("a".to_string(), 1));
+        assert!(map.insert("b".to_string(), 2));
+        // Rewriting "a" (same value) refreshes it without reporting a change.
+        assert!(!map.insert("a".to_string(), 1));
+        assert!(map.insert("c".to_string(), 3));
+
+        assert_eq!(map.len(), 2);
+        assert_eq!(map.get("a"), Some(&1));
+        assert_eq!(map.get("b"), None, "oldest write evicted");
+        assert_eq!(map.get("c"), Some(&3));
+        assert!(map.insert("c".to_string(), 4));
+        assert_eq!(map.get("c"), Some(&4));
+    }
+}
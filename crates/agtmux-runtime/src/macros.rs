@@ -0,0 +1,469 @@
+//! Action macros (`[[macros]]`): named step sequences run against one pane
+//! with `macro.run`, so flows like "approve and continue" are one call.
+//!
+//! ```toml
+//! [[macros]]
+//! name = "approve-and-continue"
+//! steps = [
+//!   { key = "Enter" },
+//!   { wait = "Running", timeout_secs = 30 },
+//!   { wait = "Idle" },
+//!   { send = "now {next}" },
+//!   { output = 20 },
+//! ]
+//! ```
+//!
+//! Step kinds: `send` (literal text followed by Enter; `{param}`
+//! placeholders are filled from the call's `params`), `key` (tmux key name),
+//! `wait` (until the pane's activity state matches, default timeout
+//! [`DEFAULT_WAIT_SECS`]) and `output` (capture the last N lines into the
+//! result). Macros share the action `request_ref` replay of `actions`.
+//!
+//! `macro.run` can also take the `steps` inline instead of a `name`, so
+//! clients can run one-off pipelines without a config change. The result
+//! lists each step with its kind and duration; when a step fails, the error
+//! names it and `from_step` re-runs the macro from that step on, skipping
+//! the ones that already ran.
+
+use std::collections::BTreeMap;
+use std::sync::Arc;
+use std::time::Duration;
+
+use agtmux_core_v5::types::{ActivityState, PanePresence};
+use serde_json::Value;
+use tokio::sync::Mutex;
+
+use crate::actions::{self, ActionError};
+use crate::poll_loop::DaemonState;
+
+/// Default `timeout_secs` of a `wait` step.
+pub const DEFAULT_WAIT_SECS: u64 = 60;
+/// How often a `wait` step re-reads the pane state.
+const WAIT_CHECK_INTERVAL: Duration = Duration::from_millis(250);
+
+/// One `[[macros]]` entry.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct MacroDef {
+    pub name: String,
+    pub description: Option<String>,
+    pub steps: Vec<MacroStep>,
+}
+
+/// One step; exactly one of `send`, `key`, `wait`, `output` is set.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct MacroStep {
+    /// Text typed literally, then Enter.
+    pub send: Option<String>,
+    /// tmux key name (`Enter`, `Escape`, `C-c`, `y`, ...).
+    pub key: Option<String>,
+    /// Wait until the pane is in this state.
+    pub wait: Option<ActivityState>,
+    /// `wait` timeout; default [`DEFAULT_WAIT_SECS`].
+    pub timeout_secs: Option<u64>,
+    /// Capture this many lines of pane output into the result.
+    pub output: Option<u32>,
+}
+
+impl MacroStep {
+    fn kind(&self) -> &'static str {
+        if self.send.is_some() {
+            "send"
+        } else if self.key.is_some() {
+            "key"
+        } else if self.wait.is_some() {
+            "wait"
+        } else {
+            "output"
+        }
+    }
+
+    fn kinds(&self) -> usize {
+        [
+            self.send.is_some(),
+            self.key.is_some(),
+            self.wait.is_some(),
+            self.output.is_some(),
+        ]
+        .into_iter()
+        .filter(|set| *set)
+        .count()
+    }
+}
+
+impl MacroDef {
+    /// `{param}` placeholders used by `send` steps, sorted.
+    pub fn params(&self) -> Vec<String> {
+        let mut params: Vec<String> = self
+            .steps
+            .iter()
+            .filter_map(|s| s.send.as_deref())
+            .flat_map(placeholders)
+            .collect();
+        params.sort();
+        params.dedup();
+        params
+    }
+
+    /// `macro.list` entry.
+    pub fn summary(&self) -> Value {
+        serde_json::json!({
+            "name": self.name,
+            "description": self.description,
+            "params": self.params(),
+            "steps": self.steps.len(),
+        })
+    }
+}
+
+fn placeholders(text: &str) -> Vec<String> {
+    let mut names = Vec::new();
+    let mut rest = text;
+    while let Some(start) = rest.find('{') {
+        let Some(len) = rest[start + 1..].find('}') else {
+            break;
+        };
+        let name = &rest[start + 1..start + 1 + len];
+        if !name.is_empty() && name.chars().all(|c| c.is_ascii_alphanumeric() || c == '_') {
+            names.push(name.to_string());
+        }
+        rest = &rest[start + 1 + len..];
+    }
+    names
+}
+
+fn fill(text: &str, params: &BTreeMap<String, String>) -> String {
+    params.iter().fold(text.to_string(), |text, (name, value)| {
+        text.replace(&format!("{{{name}}}"), value)
+    })
+}
+
+/// Reject unnamed / duplicate macros and malformed steps.
+pub fn validate_macros(macros: &[MacroDef]) -> anyhow::Result<()> {
+    for (i, def) in macros.iter().enumerate() {
+        if def.name.trim().is_empty() {
+            anyhow::bail!("macros[{i}].name must not be empty");
+        }
+        if macros[..i].iter().any(|m| m.name == def.name) {
+            anyhow::bail!("duplicate macro name {:?}", def.name);
+        }
+        if def.steps.is_empty() {
+            anyhow::bail!("macro {:?} has no steps", def.name);
+        }
+        for (n, step) in def.steps.iter().enumerate() {
+            if step.kinds() != 1 {
+                anyhow::bail!(
+                    "macro {:?} step {n}: set exactly one of send, key, wait, output",
+                    def.name
+                );
+            }
+            if step.timeout_secs.is_some() && step.wait.is_none() {
+                anyhow::bail!(
+                    "macro {:?} step {n}: timeout_secs only applies to wait",
+                    def.name
+                );
+            }
+        }
+    }
+    Ok(())
+}
+
+/// The inline `steps` of a `macro.run` call as a macro named `name`.
+fn inline_macro(name: &str, steps: &Value) -> Result<MacroDef, ActionError> {
+    let steps: Vec<MacroStep> = serde_json::from_value(steps.clone())
+        .map_err(|e| ActionError::InvalidParams(format!("invalid steps: {e}")))?;
+    let def = MacroDef {
+        name: if name.is_empty() { "inline" } else { name }.to_string(),
+        description: None,
+        steps,
+    };
+    validate_macros(std::slice::from_ref(&def))
+        .map_err(|e| ActionError::InvalidParams(e.to_string()))?;
+    Ok(def)
+}
+
+/// `macro.run`: run macro `name`, or the inline `steps`, against `pane_id`
+/// from step `from_step` (default 0). Steps run in order and the first
+/// failing step aborts the rest.
+pub async fn run(state: &Arc<Mutex<DaemonState>>, params: &Value) -> Result<Value, ActionError> {
+    let name = params["name"].as_str().unwrap_or("");
+    let inline = match &params["steps"] {
+        Value::Null => None,
+        steps => Some(inline_macro(name, steps)?),
+    };
+    let from_step = match &params["from_step"] {
+        Value::Null => 0,
+        n => n.as_u64().ok_or_else(|| {
+            ActionError::InvalidParams(format!("from_step must be a step index, got {n}"))
+        })? as usize,
+    };
+    let pane_id = params["pane_id"].as_str().unwrap_or("");
+    let values: BTreeMap<String, String> = params["params"]
+        .as_object()
+        .map(|o| {
+            o.iter()
+                .map(|(k, v)| {
+                    (
+                        k.clone(),
+                        v.as_str().map_or_else(|| v.to_string(), String::from),
+                    )
+                })
+                .collect()
+        })
+        .unwrap_or_default();
+    let request_ref = params["request_ref"].as_str().map(String::from);
+    let fingerprint = format!(
+        "macro {name} {pane_id} {values:?} {from_step} {}",
+        params["steps"]
+    );
+
+    let (def, runner, pool, claim) = {
+        let (st, claim) = match actions::claim(state, request_ref.as_deref(), &fingerprint).await {
+            actions::Claimed::Run(st, claim) => (st, claim),
+            actions::Claimed::Replay(result) => return result,
+        };
+        let def = match inline.clone() {
+            Some(def) => def,
+            None => st
+                .macros
+                .iter()
+                .find(|m| m.name == name)
+                .cloned()
+                .ok_or_else(|| ActionError::InvalidParams(format!("unknown macro: {name:?}")))?,
+        };
+        if from_step >= def.steps.len() {
+            return Err(ActionError::InvalidParams(format!(
+                "from_step {from_step} is past the last step of {:?} ({} steps)",
+                def.name,
+                def.steps.len()
+            )));
+        }
+        if !st.last_panes.iter().any(|p| p.pane_id == pane_id) {
+            return Err(ActionError::PaneNotFound(pane_id.to_string()));
+        }
+        let missing: Vec<String> = def
+            .params()
+            .into_iter()
+            .filter(|p| !values.contains_key(p))
+            .collect();
+        if !missing.is_empty() {
+            return Err(ActionError::InvalidParams(format!(
+                "macro {name:?} needs params: {}",
+                missing.join(", ")
+            )));
+        }
+        // Checked up front, so a refused step does not leave a half-run macro.
+        let mut types = false;
+        for step in &def.steps[from_step..] {
+            let input = match (&step.send, &step.key) {
+                (Some(text), _) => fill(text, &values),
+                (None, Some(key)) => key.clone(),
+                (None, None) => continue,
+            };
+            st.send_policy.check_input(&input)?;
+            types = true;
+        }
+        if types {
+            st.send_policy
+                .check_panes([pane_id], &st.daemon.list_panes())?;
+        }
+        (
+            def,
+            actions::tmux_runner(&st)?,
+            Arc::clone(&st.exec_pool),
+            claim,
+        )
+    };
+
+    let name = def.name.as_str();
+    let mut output = Vec::new();
+    let mut results = Vec::new();
+    for (n, step) in def.steps.iter().enumerate().skip(from_step) {
+        let started = tokio::time::Instant::now();
+        let failed = |e: ActionError| {
+            ActionError::Failed(format!(
+                "macro {name:?} step {n} ({}): {e}; resume with from_step {n}",
+                step.kind()
+            ))
+        };
+        let lines_before = output.len();
+        let target = pane_id.to_string();
+        if let Some(text) = &step.send {
+            let args = vec![
+                "send-keys".to_string(),
+                "-t".to_string(),
+                target.clone(),
+                "-l".to_string(),
+                fill(text, &values),
+                ";".to_string(),
+                "send-keys".to_string(),
+                "-t".to_string(),
+                target,
+                "Enter".to_string(),
+            ];
+            actions::run_tmux(&runner, &pool, args)
+                .await
+                .map_err(failed)?;
+        } else if let Some(key) = &step.key {
+            let args = vec![
+                "send-keys".to_string(),
+                "-t".to_string(),
+                target,
+                key.clone(),
+            ];
+            actions::run_tmux(&runner, &pool, args)
+                .await
+                .map_err(failed)?;
+        } else if let Some(wanted) = step.wait {
+            let timeout = Duration::from_secs(step.timeout_secs.unwrap_or(DEFAULT_WAIT_SECS));
+            wait_for_state(state, pane_id, wanted, timeout)
+                .await
+                .map_err(failed)?;
+        } else if let Some(lines) = step.output {
+            let args = vec![
+                "capture-pane".to_string(),
+                "-p".to_string(),
+                "-S".to_string(),
+                format!("-{lines}"),
+                "-t".to_string(),
+                target,
+            ];
+            let captured = actions::run_tmux(&runner, &pool, args)
+                .await
+                .map_err(failed)?;
+            output.extend(captured.lines().map(String::from));
+        }
+        let mut result = serde_json::json!({
+            "step": n,
+            "kind": step.kind(),
+            "elapsed_ms": started.elapsed().as_millis() as u64,
+        });
+        if step.output.is_some() {
+            result["lines"] = (output.len() - lines_before).into();
+        }
+        results.push(result);
+    }
+    tracing::info!(name, pane_id, from_step, request_ref = ?request_ref, "macro ran");
+
+    let result = serde_json::json!({
+        "name": name,
+        "pane_id": pane_id,
+        "steps": def.steps.len(),
+        "from_step": from_step,
+        "results": results,
+        "output": output,
+        "request_ref": request_ref,
+        "replayed": false,
+    });
+    actions::remember(&mut *state.lock().await, claim, &result);
+    Ok(result)
+}
+
+async fn wait_for_state(
+    state: &Arc<Mutex<DaemonState>>,
+    pane_id: &str,
+    wanted: ActivityState,
+    timeout: Duration,
+) -> Result<(), ActionError> {
+    let deadline = tokio::time::Instant::now() + timeout;
+    loop {
+        let reached = state.lock().await.daemon.list_panes().iter().any(|p| {
+            p.pane_instance_id.pane_id == pane_id
+                && p.presence == PanePresence::Managed
+                && p.activity_state == wanted
+        });
+        if reached {
+            return Ok(());
+        }
+        if tokio::time::Instant::now() >= deadline {
+            return Err(ActionError::Failed(format!(
+                "timed out after {}s waiting for {wanted:?}",
+                timeout.as_secs()
+            )));
+        }
+        tokio::time::sleep(WAIT_CHECK_INTERVAL).await;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn parse(toml: &str) -> Vec<MacroDef> {
+        #[derive(serde::Deserialize)]
+        struct File {
+            macros: Vec<MacroDef>,
+        }
+        toml::from_str::<File>(toml).expect("valid").macros
+    }
+
+    #[test]
+    fn parses_steps_and_collects_params() {
+        let macros = parse(
+            r#"
+            [[macros]]
+            name = "approve"
+            steps = [
+              { key = "Enter" },
+              { wait = "Running", timeout_secs = 5 },
+              { send = "then {next} in {dir}, {next}" },
+              { output = 10 },
+            ]
+            "#,
+        );
+        assert!(validate_macros(&macros).is_ok());
+        assert_eq!(macros[0].params(), ["dir", "next"]);
+        assert_eq!(macros[0].steps[1].wait, Some(ActivityState::Running));
+        let values = BTreeMap::from([
+            ("next".to_string(), "lint".to_string()),
+            ("dir".to_string(), "src".to_string()),
+        ]);
+        assert_eq!(
+            fill(macros[0].steps[2].send.as_deref().expect("send"), &values),
+            "then lint in src, lint"
+        );
+        assert_eq!(macros[0].summary()["steps"], 4);
+    }
+
+    #[test]
+    fn rejects_malformed_macros() {
+        let two_kinds =
+            parse("[[macros]]\nname = \"m\"\nsteps = [{ key = \"y\", send = \"x\" }]\n");
+        assert!(validate_macros(&two_kinds).is_err());
+        let stray_timeout =
+            parse("[[macros]]\nname = \"m\"\nsteps = [{ key = \"y\", timeout_secs = 3 }]\n");
+        assert!(validate_macros(&stray_timeout).is_err());
+        let empty = parse("[[macros]]\nname = \"m\"\nsteps = []\n");
+        assert!(validate_macros(&empty).is_err());
+        let duplicate = parse(
+            "[[macros]]\nname = \"m\"\nsteps = [{ key = \"y\" }]\n[[macros]]\nname = \"m\"\nsteps = [{ key = \"n\" }]\n",
+        );
+        assert!(validate_macros(&duplicate).is_err());
+    }
+
+    #[test]
+    fn inline_steps_are_validated() {
+        let steps = serde_json::json!([
+            {"send": "go"},
+            {"wait": "WaitingInput", "timeout_secs": 30},
+            {"key": "y"},
+        ]);
+        let def = inline_macro("", &steps).expect("valid");
+        assert_eq!(def.name, "inline");
+        assert_eq!(
+            def.steps.iter().map(MacroStep::kind).collect::<Vec<_>>(),
+            ["send", "wait", "key"]
+        );
+        assert_eq!(def.steps[1].wait, Some(ActivityState::WaitingInput));
+        assert_eq!(
+            inline_macro("deploy", &steps).expect("valid").name,
+            "deploy"
+        );
+
+        assert!(inline_macro("", &serde_json::json!([])).is_err());
+        assert!(inline_macro("", &serde_json::json!([{"key": "y", "send": "x"}])).is_err());
+        assert!(inline_macro("", &serde_json::json!([{"typo": "y"}])).is_err());
+        assert!(inline_macro("", &serde_json::json!({"send": "x"})).is_err());
+    }
+}
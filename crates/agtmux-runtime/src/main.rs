@@ -5,61 +5,234 @@
 
 use clap::Parser;
 
+mod access;
+mod actions;
+mod adapters;
+mod aider;
+mod alerts;
+mod audit;
 mod cli;
+mod cli_config;
 mod client;
+mod cmd_dash;
+mod cmd_events;
+mod cmd_grep;
+mod cmd_group;
 mod cmd_json;
+mod cmd_label;
 mod cmd_ls;
+mod cmd_macro;
+mod cmd_mcp;
+mod cmd_pane;
 mod cmd_pick;
+mod cmd_recording;
+mod cmd_responder;
+mod cmd_task;
+mod cmd_token;
 mod cmd_wait;
 mod cmd_watch;
 #[allow(dead_code)] // Skeleton module — wired into poll_tick once Codex protocol is finalized
 mod codex_poller;
 mod context;
+mod daemon_config;
+mod email;
+mod exec_pool;
+mod features;
+mod git_meta;
+mod github;
+mod groups;
+mod idle;
+mod log_sink;
+mod lru;
+mod macros;
+mod metrics;
+mod notify;
+mod pane_events;
+mod pane_output;
+mod pane_pipe;
+mod pane_query;
+mod paths;
 mod poll_loop;
+mod recorder;
+mod redact;
+mod remote_api;
+mod responder;
+mod restart;
+mod runtime_metrics;
+mod schedule;
+mod sd_notify;
+mod search;
+mod selector;
+mod send_policy;
 mod server;
 mod setup_hooks;
+mod source_events;
+mod tasks;
+#[cfg(test)]
+mod test_support;
+mod tmux_control;
+mod transcript;
 
 #[tokio::main]
-async fn main() -> anyhow::Result<()> {
-    let args = cli::Cli::parse();
+async fn main() {
+    let argv: Vec<String> = std::env::args().collect();
+    // Checked on the raw argv so alias/config failures are reported as JSON too.
+    let json_errors = argv.iter().any(|a| a == "--json");
+
+    if let Err(e) = run(argv).await {
+        if json_errors {
+            eprintln!("{}", client::error_json(&e));
+        } else {
+            eprintln!("Error: {e:?}");
+        }
+        std::process::exit(1);
+    }
+}
+
+async fn run(argv: Vec<String>) -> anyhow::Result<()> {
+    let argv = cli_config::expand_aliases(argv)?;
+    let mut args = cli::Cli::parse_from(argv);
 
     let command = args
         .command
+        .take()
         .unwrap_or_else(|| cli::Command::Ls(cli::LsOpts::default()));
 
-    match command {
+    // Daemon config is resolved before logging so `[log] level` can apply.
+    let daemon_config = match &command {
         cli::Command::Daemon(opts) => {
-            let filter = std::env::var("AGTMUX_LOG")
-                .or_else(|_| std::env::var("RUST_LOG"))
-                .unwrap_or_else(|_| "info".to_string());
+            let file = daemon_config::load_file(opts.config.as_deref())?;
+            let config = daemon_config::DaemonConfig::resolve(
+                &file,
+                &daemon_config::process_env,
+                args.socket_path.as_deref(),
+                opts,
+            )?;
+            if opts.print_config {
+                let mut config = config;
+                if let Some((level, origin)) = args.log_filter_override() {
+                    config.override_log_level(level, origin);
+                }
+                let path = daemon_config::config_file_path(opts.config.as_deref());
+                let file = path.as_ref().map(|(p, _)| (p.as_path(), p.exists()));
+                print!("{}", config.format_effective(file));
+                return Ok(());
+            }
+            if opts.check_config {
+                daemon_config::check(&file, &config)?;
+                println!("config OK");
+                return Ok(());
+            }
+            Some(config)
+        }
+        _ => None,
+    };
+
+    // Daemon logs at info by default; CLI commands stay silent unless -v/--log-level.
+    // CLI logs always go to stderr so they never mix with command output; the
+    // daemon writes to its `[log] sinks`.
+    let default_filter = daemon_config
+        .as_ref()
+        .map_or("warn", |c| c.log_level.as_str());
+    let filter = tracing_subscriber::EnvFilter::new(args.log_filter(default_filter));
+    match &daemon_config {
+        Some(config) if !config.log_sinks.is_stderr_only() => {
+            let sinks = log_sink::LogSinks::open(&config.log_sinks, "daemon")?;
             tracing_subscriber::fmt()
-                .with_env_filter(tracing_subscriber::EnvFilter::new(filter))
+                .with_env_filter(filter)
+                .with_ansi(false)
+                .with_writer(move || sinks.writer())
                 .init();
+        }
+        _ => tracing_subscriber::fmt()
+            .with_env_filter(filter)
+            .with_writer(std::io::stderr)
+            .init(),
+    }
 
-            tracing::info!("agtmux daemon starting");
-
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
-            poll_loop::run_daemon(opts, &socket_path).await?;
+    match command {
+        cli::Command::Daemon(opts) => {
+            if let Some(config) = daemon_config {
+                tracing::info!("agtmux daemon starting");
+                let socket_flag = args.socket_path.clone();
+                let reload = move || {
+                    let file = daemon_config::load_file(opts.config.as_deref())?;
+                    daemon_config::DaemonConfig::resolve(
+                        &file,
+                        &daemon_config::process_env,
+                        socket_flag.as_deref(),
+                        &opts,
+                    )
+                };
+                poll_loop::run_daemon(config, reload).await?;
+            }
         }
         cli::Command::Ls(opts) => {
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            let columns = opts
+                .columns
+                .as_deref()
+                .map(cmd_ls::parse_columns)
+                .transpose()?;
             let use_color = context::resolve_color(&opts.color);
-            cmd_ls::cmd_ls(&socket_path, &opts.group, use_color).await?;
+            let time = context::TimeFormat::parse(&opts.time)?;
+            cmd_ls::cmd_ls(
+                &socket_path,
+                &opts.group,
+                columns.as_deref(),
+                use_color,
+                time,
+            )
+            .await?;
         }
         cli::Command::Bar(opts) => {
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
-            client::cmd_bar(&socket_path, opts.tmux).await?;
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            let format = match opts.format.as_deref() {
+                Some("waybar") => client::BarFormat::Waybar,
+                Some("tmux") => client::BarFormat::Tmux,
+                _ if opts.tmux => client::BarFormat::Tmux,
+                _ => client::BarFormat::Ansi,
+            };
+            client::cmd_bar(&socket_path, format).await?;
         }
         cli::Command::Pick(opts) => {
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
-            cmd_pick::cmd_pick(&socket_path, opts.dry_run, opts.waiting, &opts.color).await?;
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            let time = context::TimeFormat::parse(&opts.time)?;
+            cmd_pick::cmd_pick(&socket_path, opts.dry_run, opts.waiting, &opts.color, time).await?;
+        }
+        cli::Command::Dash(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            let time = context::TimeFormat::parse(&opts.time)?;
+            cmd_dash::cmd_dash(&socket_path, opts.interval.max(1), &opts.color, time).await?;
         }
         cli::Command::Watch(opts) => {
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
-            cmd_watch::cmd_watch(&socket_path, opts.interval, &opts.color).await?;
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            let columns = opts
+                .columns
+                .as_deref()
+                .map(cmd_ls::parse_columns)
+                .transpose()?;
+            let time = context::TimeFormat::parse(&opts.time)?;
+            cmd_watch::cmd_watch(
+                &socket_path,
+                opts.interval,
+                columns.as_deref(),
+                &opts.color,
+                time,
+            )
+            .await?;
+        }
+        cli::Command::Token(opts) => cmd_token::cmd_token(opts)?,
+        cli::Command::Mcp => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_mcp::cmd_mcp(&socket_path).await?;
+        }
+        cli::Command::Events(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_events::cmd_events(&socket_path, opts).await?;
         }
         cli::Command::Wait(opts) => {
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
             let condition = if opts.no_waiting {
                 cmd_wait::WaitCondition::NoWaiting
             } else {
@@ -70,7 +243,7 @@ async fn main() -> anyhow::Result<()> {
                 condition,
                 opts.session.as_deref(),
                 opts.timeout,
-                opts.quiet,
+                args.quiet,
             )
             .await;
             if exit_code != 0 {
@@ -78,9 +251,43 @@ async fn main() -> anyhow::Result<()> {
             }
         }
         cli::Command::Json(opts) => {
-            let socket_path = args.socket_path.unwrap_or_else(cli::default_socket_path);
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
             cmd_json::cmd_json(&socket_path, opts.health).await?;
         }
+        cli::Command::Label(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_label::cmd_label(&socket_path, opts.command).await?;
+        }
+        cli::Command::Task(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_task::cmd_task(&socket_path, opts.command).await?;
+        }
+        cli::Command::Pane(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_pane::cmd_pane(&socket_path, opts).await?;
+        }
+        cli::Command::Macro(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_macro::cmd_macro(&socket_path, opts.command).await?;
+        }
+        cli::Command::Responder(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_responder::cmd_responder(&socket_path, opts.command).await?;
+        }
+        cli::Command::Grep(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            if !cmd_grep::cmd_grep(&socket_path, opts).await? {
+                std::process::exit(1);
+            }
+        }
+        cli::Command::Recording(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_recording::cmd_recording(&socket_path, opts.command).await?;
+        }
+        cli::Command::Group(opts) => {
+            let socket_path = daemon_config::cli_socket_path(args.socket_path)?;
+            cmd_group::cmd_group(&socket_path, opts.command).await?;
+        }
         cli::Command::SetupHooks(opts) => {
             let path = setup_hooks::apply_hooks(&opts)?;
             println!("hooks written to {}", path.display());
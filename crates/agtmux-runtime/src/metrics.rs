@@ -0,0 +1,412 @@
+//! Prometheus metrics (`[metrics] listen`): a plain HTTP listener serving
+//! `GET /metrics` in the text exposition format, so operators running the
+//! daemon on build hosts can alert on stuck agents and a slow poll loop.
+//!
+//! ```toml
+//! [metrics]
+//! listen = "127.0.0.1:9464"
+//! ```
+//!
+//! Exposed: managed panes by state / provider, unmanaged panes, panes that
+//! need attention and how long the oldest has waited, registered sources by
+//! lifecycle, events pulled per source, poll tick and action (`pane.*`,
+//! `window.kill`, `group.*`) duration histograms. The listener answers
+//! nothing but `/metrics` and has no authentication: keep it on loopback or
+//! behind a firewall.
+
+use std::collections::BTreeMap;
+use std::fmt::Write as _;
+use std::sync::Arc;
+use std::time::Duration;
+
+use agtmux_core_v5::types::{ActivityState, PanePresence};
+use chrono::{DateTime, Utc};
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use tokio::net::{TcpListener, TcpStream};
+use tokio::sync::Mutex;
+
+use crate::poll_loop::DaemonState;
+
+/// Histogram bucket upper bounds, seconds.
+const BUCKETS: [f64; 11] = [
+    0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0,
+];
+
+/// Largest request head read before answering.
+const MAX_REQUEST_BYTES: usize = 8192;
+const REQUEST_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// Cumulative duration histogram over [`BUCKETS`].
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct Histogram {
+    /// Observations `<=` each bucket bound.
+    buckets: [u64; BUCKETS.len()],
+    sum: f64,
+    count: u64,
+}
+
+impl Histogram {
+    pub fn observe(&mut self, elapsed: Duration) {
+        let secs = elapsed.as_secs_f64();
+        for (bound, n) in BUCKETS.iter().zip(&mut self.buckets) {
+            if secs <= *bound {
+                *n += 1;
+            }
+        }
+        self.sum += secs;
+        self.count += 1;
+    }
+}
+
+/// Counters and histograms recorded by the poll loop and the server; gauges
+/// are read from `DaemonState` at scrape time.
+#[derive(Debug, Default)]
+pub struct DaemonMetrics {
+    /// Source kind → events pulled into the gateway.
+    events_ingested: BTreeMap<&'static str, u64>,
+    poll_tick: Histogram,
+    /// RPC method → duration.
+    actions: BTreeMap<String, Histogram>,
+}
+
+impl DaemonMetrics {
+    pub fn count_events(&mut self, source: &'static str, events: usize) {
+        *self.events_ingested.entry(source).or_default() += events as u64;
+    }
+
+    pub fn observe_tick(&mut self, elapsed: Duration) {
+        self.poll_tick.observe(elapsed);
+    }
+
+    pub fn observe_action(&mut self, method: &str, elapsed: Duration) {
+        self.actions
+            .entry(method.to_string())
+            .or_default()
+            .observe(elapsed);
+    }
+}
+
+/// Text exposition builder.
+#[derive(Default)]
+struct Exposition {
+    out: String,
+}
+
+impl Exposition {
+    fn family(&mut self, name: &str, kind: &str, help: &str) {
+        let _ = writeln!(self.out, "# HELP {name} {help}\n# TYPE {name} {kind}");
+    }
+
+    fn sample(&mut self, name: &str, labels: &[(&str, &str)], value: impl std::fmt::Display) {
+        self.out += name;
+        if !labels.is_empty() {
+            let labels: Vec<String> = labels
+                .iter()
+                .map(|(key, value)| format!("{key}=\"{}\"", escape(value)))
+                .collect();
+            let _ = write!(self.out, "{{{}}}", labels.join(","));
+        }
+        let _ = writeln!(self.out, " {value}");
+    }
+
+    fn histogram(&mut self, name: &str, labels: &[(&str, &str)], histogram: &Histogram) {
+        let bucket = format!("{name}_bucket");
+        for (bound, n) in BUCKETS.iter().zip(&histogram.buckets) {
+            let le = bound.to_string();
+            let mut with_le = labels.to_vec();
+            with_le.push(("le", &le));
+            self.sample(&bucket, &with_le, n);
+        }
+        let mut with_le = labels.to_vec();
+        with_le.push(("le", "+Inf"));
+        self.sample(&bucket, &with_le, histogram.count);
+        self.sample(&format!("{name}_sum"), labels, histogram.sum);
+        self.sample(&format!("{name}_count"), labels, histogram.count);
+    }
+}
+
+fn escape(value: &str) -> String {
+    value
+        .replace('\\', "\\\\")
+        .replace('"', "\\\"")
+        .replace('\n', "\\n")
+}
+
+fn needs_attention(state: ActivityState) -> bool {
+    matches!(
+        state,
+        ActivityState::WaitingInput | ActivityState::WaitingApproval | ActivityState::Error
+    )
+}
+
+/// Render every metric of `state` as of `now`.
+pub fn render(state: &DaemonState, now: DateTime<Utc>) -> String {
+    let mut out = Exposition::default();
+    let panes = state.daemon.list_panes();
+    let managed: Vec<_> = panes
+        .iter()
+        .filter(|p| p.presence == PanePresence::Managed)
+        .collect();
+
+    out.family(
+        "agtmux_uptime_seconds",
+        "gauge",
+        "Seconds since the daemon started.",
+    );
+    out.sample(
+        "agtmux_uptime_seconds",
+        &[],
+        state.started_at.elapsed().as_secs(),
+    );
+
+    let mut by_state: BTreeMap<(String, &str), u64> = BTreeMap::new();
+    for pane in &managed {
+        let provider = pane.provider.map_or("unknown", |p| p.as_str());
+        *by_state
+            .entry((format!("{:?}", pane.activity_state), provider))
+            .or_default() += 1;
+    }
+    out.family(
+        "agtmux_managed_panes",
+        "gauge",
+        "Panes running a detected agent, by activity state and provider.",
+    );
+    for ((activity, provider), n) in &by_state {
+        out.sample(
+            "agtmux_managed_panes",
+            &[("state", activity), ("provider", provider)],
+            n,
+        );
+    }
+
+    let unmanaged = state
+        .last_panes
+        .iter()
+        .filter(|t| {
+            !managed
+                .iter()
+                .any(|p| p.pane_instance_id.pane_id == t.pane_id)
+        })
+        .count();
+    out.family(
+        "agtmux_unmanaged_panes",
+        "gauge",
+        "tmux panes without a detected agent.",
+    );
+    out.sample("agtmux_unmanaged_panes", &[], unmanaged);
+
+    let attention: Vec<_> = managed
+        .iter()
+        .filter(|p| needs_attention(p.activity_state))
+        .collect();
+    let oldest = attention
+        .iter()
+        .map(|p| (now - p.updated_at).num_seconds().max(0))
+        .max()
+        .unwrap_or(0);
+    out.family(
+        "agtmux_attention_panes",
+        "gauge",
+        "Agents waiting for input or approval, or in error.",
+    );
+    out.sample("agtmux_attention_panes", &[], attention.len());
+    out.family(
+        "agtmux_attention_oldest_seconds",
+        "gauge",
+        "Seconds since the longest-waiting attention pane last changed state (0 if none).",
+    );
+    out.sample("agtmux_attention_oldest_seconds", &[], oldest);
+
+    let mut sources: BTreeMap<(&str, String), u64> = BTreeMap::new();
+    for entry in state.source_registry.list() {
+        let lifecycle = serde_json::to_value(entry.lifecycle)
+            .ok()
+            .and_then(|v| v.as_str().map(String::from))
+            .unwrap_or_default();
+        *sources
+            .entry((entry.source_kind.as_str(), lifecycle))
+            .or_default() += 1;
+    }
+    out.family(
+        "agtmux_sources",
+        "gauge",
+        "Registered event sources by kind and lifecycle (pending, active, stale, revoked).",
+    );
+    for ((kind, lifecycle), n) in &sources {
+        out.sample(
+            "agtmux_sources",
+            &[("kind", kind), ("lifecycle", lifecycle)],
+            n,
+        );
+    }
+
+    out.family(
+        "agtmux_events_ingested_total",
+        "counter",
+        "Events pulled from each source into the gateway.",
+    );
+    for (source, n) in &state.metrics.events_ingested {
+        out.sample("agtmux_events_ingested_total", &[("source", source)], n);
+    }
+
+    out.family(
+        "agtmux_poll_tick_duration_seconds",
+        "histogram",
+        "Duration of a poll tick (tmux scan, sources, resolver, side effects).",
+    );
+    out.histogram(
+        "agtmux_poll_tick_duration_seconds",
+        &[],
+        &state.metrics.poll_tick,
+    );
+
+    out.family(
+        "agtmux_action_duration_seconds",
+        "histogram",
+        "Duration of pane / window / group action requests, by method.",
+    );
+    for (method, histogram) in &state.metrics.actions {
+        out.histogram(
+            "agtmux_action_duration_seconds",
+            &[("method", method)],
+            histogram,
+        );
+    }
+
+    out.out
+}
+
+/// Serve `GET /metrics` until the daemon exits.
+pub async fn serve(listener: TcpListener, state: Arc<Mutex<DaemonState>>) {
+    loop {
+        let stream = match listener.accept().await {
+            Ok((stream, _)) => stream,
+            Err(e) => {
+                tracing::warn!("metrics accept failed: {e}");
+                tokio::time::sleep(Duration::from_millis(100)).await;
+                continue;
+            }
+        };
+        let state = Arc::clone(&state);
+        tokio::spawn(async move {
+            if let Err(e) = respond(stream, &state).await {
+                tracing::debug!("metrics request failed: {e}");
+            }
+        });
+    }
+}
+
+async fn respond(mut stream: TcpStream, state: &Mutex<DaemonState>) -> std::io::Result<()> {
+    let mut head = Vec::new();
+    let mut buf = [0u8; 1024];
+    while !head.windows(4).any(|w| w == b"\r\n\r\n") && head.len() < MAX_REQUEST_BYTES {
+        let n = tokio::time::timeout(REQUEST_TIMEOUT, stream.read(&mut buf))
+            .await
+            .map_err(|_| std::io::Error::new(std::io::ErrorKind::TimedOut, "request timeout"))??;
+        if n == 0 {
+            break;
+        }
+        head.extend_from_slice(&buf[..n]);
+    }
+    let (status, body) = match route(&String::from_utf8_lossy(&head)) {
+        Route::Metrics => {
+            let st = state.lock().await;
+            ("200 OK", render(&st, Utc::now()))
+        }
+        Route::NotFound => ("404 Not Found", "not found\n".to_string()),
+        Route::MethodNotAllowed => ("405 Method Not Allowed", "GET only\n".to_string()),
+    };
+    let response = format!(
+        "HTTP/1.1 {status}\r\nContent-Type: text/plain; version=0.0.4; charset=utf-8\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{body}",
+        body.len()
+    );
+    stream.write_all(response.as_bytes()).await?;
+    stream.shutdown().await
+}
+
+#[derive(Debug, PartialEq, Eq)]
+enum Route {
+    Metrics,
+    NotFound,
+    MethodNotAllowed,
+}
+
+/// Route a request by its request line (`GET /metrics?x HTTP/1.1`).
+fn route(head: &str) -> Route {
+    let mut parts = head.lines().next().unwrap_or("").split_whitespace();
+    let (method, target) = (parts.next(), parts.next().unwrap_or(""));
+    if method != Some("GET") {
+        return Route::MethodNotAllowed;
+    }
+    match target.split('?').next() {
+        Some("/metrics") => Route::Metrics,
+        _ => Route::NotFound,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn histogram_buckets_are_cumulative() {
+        let mut histogram = Histogram::default();
+        histogram.observe(Duration::from_millis(20));
+        histogram.observe(Duration::from_secs(30));
+        assert_eq!(histogram.buckets[0], 0);
+        assert_eq!(histogram.buckets[2], 1, "<= 0.025");
+        assert_eq!(histogram.buckets[BUCKETS.len() - 1], 1, "30s only in +Inf");
+        assert_eq!(histogram.count, 2);
+
+        let mut out = Exposition::default();
+        out.histogram("t_seconds", &[("method", "pane.kill")], &histogram);
+        assert!(
+            out.out
+                .contains("t_seconds_bucket{method=\"pane.kill\",le=\"0.025\"} 1\n")
+        );
+        assert!(
+            out.out
+                .contains("t_seconds_bucket{method=\"pane.kill\",le=\"+Inf\"} 2\n")
+        );
+        assert!(
+            out.out
+                .contains("t_seconds_count{method=\"pane.kill\"} 2\n")
+        );
+    }
+
+    #[test]
+    fn escapes_label_values() {
+        let mut out = Exposition::default();
+        out.sample("m", &[("k", "a\"b\\c\nd")], 1);
+        assert_eq!(out.out, "m{k=\"a\\\"b\\\\c\\nd\"} 1\n");
+    }
+
+    #[tokio::test]
+    async fn serves_metrics_over_http() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.expect("bind");
+        let addr = listener.local_addr().expect("addr");
+        tokio::spawn(serve(listener, Arc::new(Mutex::new(DaemonState::new()))));
+
+        let mut stream = TcpStream::connect(addr).await.expect("connect");
+        stream
+            .write_all(b"GET /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n")
+            .await
+            .expect("write");
+        let mut response = String::new();
+        stream.read_to_string(&mut response).await.expect("read");
+        assert!(response.starts_with("HTTP/1.1 200 OK\r\n"), "{response}");
+        assert!(response.contains("\r\n\r\n# HELP agtmux_uptime_seconds"));
+    }
+
+    #[test]
+    fn routes_only_get_metrics() {
+        assert_eq!(
+            route("GET /metrics HTTP/1.1\r\nHost: x\r\n\r\n"),
+            Route::Metrics
+        );
+        assert_eq!(route("GET /metrics?name=x HTTP/1.1\r\n"), Route::Metrics);
+        assert_eq!(route("GET / HTTP/1.1\r\n"), Route::NotFound);
+        assert_eq!(route("POST /metrics HTTP/1.1\r\n"), Route::MethodNotAllowed);
+        assert_eq!(route(""), Route::MethodNotAllowed);
+    }
+}
@@ -0,0 +1,241 @@
+//! Desktop notifications sent from the daemon host when a managed pane enters
+//! one of the `[notify] states`, so alerts arrive without a CLI `watch`
+//! process running.
+//!
+//! Backends, first found on PATH: `terminal-notifier` / `osascript` (macOS),
+//! `notify-send` (elsewhere). Sends go through the exec pool, off the lock.
+
+use std::collections::HashMap;
+use std::path::Path;
+
+use agtmux_core_v5::types::{ActivityState, PaneRuntimeState};
+use agtmux_tmux_v5::TmuxPaneInfo;
+
+use crate::tasks::{self, TaskMeta};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Backend {
+    TerminalNotifier,
+    Osascript,
+    NotifySend,
+}
+
+impl Backend {
+    /// First available backend for this OS, if any.
+    pub fn detect() -> Option<Self> {
+        let candidates: &[(Self, &str)] = if cfg!(target_os = "macos") {
+            &[
+                (Self::TerminalNotifier, "terminal-notifier"),
+                (Self::Osascript, "osascript"),
+            ]
+        } else {
+            &[(Self::NotifySend, "notify-send")]
+        };
+        candidates
+            .iter()
+            .find(|(_, program)| on_path(program))
+            .map(|(backend, _)| *backend)
+    }
+}
+
+pub(crate) fn on_path(program: &str) -> bool {
+    std::env::var_os("PATH").is_some_and(|paths| {
+        std::env::split_paths(&paths).any(|dir| Path::new(&dir).join(program).is_file())
+    })
+}
+
+/// One notification to show.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Notice {
+    pub backend: Backend,
+    pub title: String,
+    pub body: String,
+}
+
+impl Notice {
+    /// Program and arguments for this notice's backend.
+    fn command(&self) -> (&'static str, Vec<String>) {
+        match self.backend {
+            Backend::TerminalNotifier => (
+                "terminal-notifier",
+                vec![
+                    "-title".into(),
+                    self.title.clone(),
+                    "-message".into(),
+                    self.body.clone(),
+                ],
+            ),
+            Backend::Osascript => (
+                "osascript",
+                vec![
+                    "-e".into(),
+                    format!(
+                        "display notification {} with title {}",
+                        applescript_string(&self.body),
+                        applescript_string(&self.title)
+                    ),
+                ],
+            ),
+            Backend::NotifySend => ("notify-send", vec![self.title.clone(), self.body.clone()]),
+        }
+    }
+
+    /// Run the backend (blocking); failures are logged, never fatal.
+    pub fn send(&self) {
+        let (program, args) = self.command();
+        let status = std::process::Command::new(program)
+            .args(&args)
+            .stdin(std::process::Stdio::null())
+            .stdout(std::process::Stdio::null())
+            .stderr(std::process::Stdio::null())
+            .status();
+        match status {
+            Ok(s) if s.success() => {}
+            Ok(s) => tracing::debug!("{program} exited with {s}"),
+            Err(e) => tracing::debug!("{program} failed: {e}"),
+        }
+    }
+}
+
+fn applescript_string(s: &str) -> String {
+    format!("\"{}\"", s.replace('\\', "\\\\").replace('"', "\\\""))
+}
+
+/// Tracks each pane's last activity state and turns entries into the
+/// configured states into notices.
+#[derive(Debug, Default)]
+pub struct Notifier {
+    states: Vec<ActivityState>,
+    backend: Option<Backend>,
+    last: HashMap<String, ActivityState>,
+}
+
+impl Notifier {
+    /// Notifier for `states`; disabled when empty or no backend is installed.
+    pub fn new(states: Vec<ActivityState>) -> Self {
+        let backend = if states.is_empty() {
+            None
+        } else {
+            let backend = Backend::detect();
+            if backend.is_none() {
+                tracing::warn!("notify.states is set but no notification command was found");
+            }
+            backend
+        };
+        Self::with_backend(states, backend)
+    }
+
+    fn with_backend(states: Vec<ActivityState>, backend: Option<Backend>) -> Self {
+        Self {
+            states,
+            backend,
+            last: HashMap::new(),
+        }
+    }
+
+    /// Notices for panes that entered a configured state since the previous
+    /// call. A pane's first observation only records its state, so a daemon
+    /// restart does not replay alerts for every waiting pane.
+    pub fn observe(
+        &mut self,
+        panes: &[&PaneRuntimeState],
+        tmux: &[TmuxPaneInfo],
+        tasks: &HashMap<String, TaskMeta>,
+    ) -> Vec<Notice> {
+        let Some(backend) = self.backend else {
+            return Vec::new();
+        };
+        let mut notices = Vec::new();
+        let mut seen = HashMap::with_capacity(panes.len());
+        for pane in panes {
+            let pane_id = &pane.pane_instance_id.pane_id;
+            let state = pane.activity_state;
+            let previous = self.last.get(pane_id).copied();
+            if previous.is_some_and(|p| p != state) && self.states.contains(&state) {
+                let provider = pane.provider.map_or("agent", |p| p.as_str());
+                let location = tmux
+                    .iter()
+                    .find(|t| &t.pane_id == pane_id)
+                    .map_or_else(String::new, |t| {
+                        format!(" in {}:{}", t.session_name, t.window_name)
+                    });
+                notices.push(Notice {
+                    backend,
+                    title: format!("agtmux: {provider} {state:?}"),
+                    body: format!(
+                        "pane {pane_id}{location}{}",
+                        tasks::notice_suffix(tasks, pane_id)
+                    ),
+                });
+            }
+            seen.insert(pane_id.clone(), state);
+        }
+        // Vanished panes are forgotten.
+        self.last = seen;
+        notices
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support::pane;
+
+    #[test]
+    fn notifies_on_entering_configured_state() {
+        let mut notifier = Notifier::with_backend(
+            vec![ActivityState::WaitingApproval],
+            Some(Backend::NotifySend),
+        );
+        let tmux = vec![TmuxPaneInfo {
+            pane_id: "%1".to_string(),
+            session_name: "main".to_string(),
+            window_name: "dev".to_string(),
+            ..Default::default()
+        }];
+        let waiting = pane("%1", ActivityState::WaitingApproval);
+        let running = pane("%1", ActivityState::Running);
+
+        assert!(
+            notifier
+                .observe(&[&waiting], &tmux, &HashMap::new())
+                .is_empty(),
+            "first sight"
+        );
+        assert!(
+            notifier
+                .observe(&[&running], &tmux, &HashMap::new())
+                .is_empty(),
+            "not configured"
+        );
+        let notices = notifier.observe(&[&waiting], &tmux, &HashMap::new());
+        assert_eq!(notices.len(), 1);
+        assert_eq!(notices[0].title, "agtmux: claude WaitingApproval");
+        assert_eq!(notices[0].body, "pane %1 in main:dev");
+        assert!(
+            notifier
+                .observe(&[&waiting], &tmux, &HashMap::new())
+                .is_empty(),
+            "no repeat"
+        );
+
+        let (program, args) = notices[0].command();
+        assert_eq!(program, "notify-send");
+        assert_eq!(
+            args,
+            vec!["agtmux: claude WaitingApproval", "pane %1 in main:dev"]
+        );
+        assert_eq!(applescript_string(r#"a "b""#), r#""a \"b\"""#);
+    }
+
+    #[test]
+    fn disabled_without_backend() {
+        let mut notifier = Notifier::with_backend(vec![ActivityState::Idle], None);
+        notifier.observe(&[&pane("%1", ActivityState::Running)], &[], &HashMap::new());
+        assert!(
+            notifier
+                .observe(&[&pane("%1", ActivityState::Idle)], &[], &HashMap::new())
+                .is_empty()
+        );
+    }
+}
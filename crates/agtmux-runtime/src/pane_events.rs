@@ -0,0 +1,358 @@
+//! Pane delta events for `watch` with `deltas`: the pane list (as served by
+//! `list_panes`) is diffed once per poll tick into `pane.added`,
+//! `pane.updated` and `pane.removed` events numbered by a monotonic cursor,
+//! so dashboards apply changes instead of re-fetching the whole list.
+//!
+//! Unlike the projection change log this also covers unmanaged panes and
+//! everything else in a pane entry (window / session names, labels, tasks,
+//! groups, git branch). Only the last `MAX_EVENTS` events are kept; a client
+//! further behind gets a snapshot.
+//!
+//! The same cursors serve `list_panes {since_cursor}` and the `/v1/snapshot`
+//! ETag: polling clients get the panes changed since their cursor
+//! ([`PaneEventLog::changes_since`]) and keep their own copy
+//! ([`apply_changes`]), so an unchanged list costs two empty arrays.
+
+use std::collections::{BTreeMap, VecDeque};
+
+use serde_json::Value;
+
+/// Events retained for resuming clients.
+const MAX_EVENTS: usize = 4096;
+
+#[derive(Debug, Clone, PartialEq)]
+struct PaneEvent {
+    cursor: u64,
+    kind: &'static str,
+    pane_id: String,
+    /// Entry after the change; None for `pane.removed`.
+    pane: Option<Value>,
+    /// Top-level keys that changed (`pane.updated` only).
+    fields: Vec<String>,
+}
+
+impl PaneEvent {
+    fn to_json(&self) -> Value {
+        let mut event = serde_json::json!({
+            "cursor": self.cursor,
+            "type": self.kind,
+            "pane_id": self.pane_id,
+        });
+        if let Some(pane) = &self.pane {
+            event["pane"] = pane.clone();
+        }
+        if !self.fields.is_empty() {
+            event["fields"] = serde_json::json!(self.fields);
+        }
+        event
+    }
+}
+
+/// Last observed pane list and the events that led to it.
+#[derive(Debug, Default)]
+pub struct PaneEventLog {
+    cursor: u64,
+    panes: BTreeMap<String, Value>,
+    events: VecDeque<PaneEvent>,
+    /// (projection version, epoch) of the pane list build last observed.
+    observed: Option<(u64, u64)>,
+}
+
+impl PaneEventLog {
+    /// Cursor of the latest event (0 before any).
+    pub fn cursor(&self) -> u64 {
+        self.cursor
+    }
+
+    /// Diff `panes` (a `list_panes` array) against the previous list and
+    /// record the differences. Returns the number of new events.
+    pub fn observe(&mut self, panes: &Value) -> usize {
+        let current: BTreeMap<String, Value> = panes
+            .as_array()
+            .map(Vec::as_slice)
+            .unwrap_or(&[])
+            .iter()
+            .filter_map(|p| Some((p["pane_id"].as_str()?.to_string(), p.clone())))
+            .collect();
+        let before = self.cursor;
+
+        let removed: Vec<String> = self
+            .panes
+            .keys()
+            .filter(|id| !current.contains_key(*id))
+            .cloned()
+            .collect();
+        for pane_id in removed {
+            self.push("pane.removed", pane_id, None, Vec::new());
+        }
+        for (pane_id, pane) in &current {
+            match self.panes.get(pane_id) {
+                None => self.push(
+                    "pane.added",
+                    pane_id.clone(),
+                    Some(pane.clone()),
+                    Vec::new(),
+                ),
+                Some(old) if old != pane => {
+                    let fields = changed_fields(old, pane);
+                    self.push("pane.updated", pane_id.clone(), Some(pane.clone()), fields);
+                }
+                Some(_) => {}
+            }
+        }
+        self.panes = current;
+        (self.cursor - before) as usize
+    }
+
+    /// [`observe`](Self::observe) the pane list build `key` (projection
+    /// version, `pane_list_epoch`), unless it is the one last observed.
+    pub fn observe_build(&mut self, key: (u64, u64), panes: &Value) -> usize {
+        if self.observed == Some(key) {
+            return 0;
+        }
+        self.observed = Some(key);
+        self.observe(panes)
+    }
+
+    fn push(
+        &mut self,
+        kind: &'static str,
+        pane_id: String,
+        pane: Option<Value>,
+        fields: Vec<String>,
+    ) {
+        self.cursor += 1;
+        if self.events.len() == MAX_EVENTS {
+            self.events.pop_front();
+        }
+        self.events.push_back(PaneEvent {
+            cursor: self.cursor,
+            kind,
+            pane_id,
+            pane,
+            fields,
+        });
+    }
+
+    /// Events after `cursor`, or None when the client cannot resume from it
+    /// (events already dropped, or a cursor from a previous daemon).
+    pub fn since(&self, cursor: u64) -> Option<Vec<Value>> {
+        if cursor > self.cursor {
+            return None;
+        }
+        let oldest = self.events.front().map_or(self.cursor + 1, |e| e.cursor);
+        if cursor + 1 < oldest {
+            return None;
+        }
+        Some(
+            self.events
+                .iter()
+                .filter(|e| e.cursor > cursor)
+                .map(PaneEvent::to_json)
+                .collect(),
+        )
+    }
+
+    /// What changed after `cursor`, folded per pane: the current entries of
+    /// panes added or updated and the ids of panes removed, both by pane id.
+    /// None when the client cannot resume from `cursor`, as for
+    /// [`since`](Self::since).
+    pub fn changes_since(&self, cursor: u64) -> Option<(Vec<Value>, Vec<String>)> {
+        self.since(cursor)?;
+        let touched: std::collections::BTreeSet<&str> = self
+            .events
+            .iter()
+            .filter(|e| e.cursor > cursor)
+            .map(|e| e.pane_id.as_str())
+            .collect();
+        let mut changed = Vec::new();
+        let mut removed = Vec::new();
+        for pane_id in touched {
+            match self.panes.get(pane_id) {
+                Some(pane) => changed.push(pane.clone()),
+                None => removed.push(pane_id.to_string()),
+            }
+        }
+        Some((changed, removed))
+    }
+
+    /// The pane list as of [`cursor`](Self::cursor), ordered by pane id.
+    pub fn snapshot(&self) -> Value {
+        Value::Array(self.panes.values().cloned().collect())
+    }
+}
+
+/// Apply a `list_panes {since_cursor}` reply to a copy of the pane list:
+/// replace it when `full`, else drop `removed` and update `panes` by pane
+/// id (new ones at the end). A plain array (a daemon without cursors)
+/// replaces it too. Returns the cursor for the next call.
+pub fn apply_changes(panes: &mut Vec<Value>, reply: Value) -> Option<u64> {
+    let pane_id = |pane: &Value| pane["pane_id"].as_str().unwrap_or("").to_string();
+    let mut reply = match reply {
+        Value::Array(all) => {
+            *panes = all;
+            return None;
+        }
+        reply => reply,
+    };
+    let cursor = reply["cursor"].as_u64();
+    let Value::Array(changed) = reply["panes"].take() else {
+        return cursor;
+    };
+    if reply["full"] == true {
+        *panes = changed;
+        return cursor;
+    }
+    let removed: Vec<&str> = reply["removed"]
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter_map(Value::as_str)
+        .collect();
+    panes.retain(|pane| !removed.contains(&pane_id(pane).as_str()));
+    for pane in changed {
+        match panes.iter_mut().find(|p| pane_id(p) == pane_id(&pane)) {
+            Some(old) => *old = pane,
+            None => panes.push(pane),
+        }
+    }
+    cursor
+}
+
+fn changed_fields(old: &Value, new: &Value) -> Vec<String> {
+    let (Some(old), Some(new)) = (old.as_object(), new.as_object()) else {
+        return Vec::new();
+    };
+    let mut fields: Vec<String> = new
+        .iter()
+        .filter(|(key, value)| old.get(*key) != Some(*value))
+        .map(|(key, _)| key.clone())
+        .collect();
+    fields.extend(old.keys().filter(|key| !new.contains_key(*key)).cloned());
+    fields.sort();
+    fields
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pane(pane_id: &str, window_name: &str) -> Value {
+        serde_json::json!({"pane_id": pane_id, "window_name": window_name, "label": null})
+    }
+
+    #[test]
+    fn diffs_pane_lists_into_events() {
+        let mut log = PaneEventLog::default();
+        assert_eq!(
+            log.observe(&serde_json::json!([pane("%1", "a"), pane("%2", "a")])),
+            2
+        );
+        assert_eq!(
+            log.observe(&serde_json::json!([pane("%1", "a"), pane("%2", "a")])),
+            0
+        );
+
+        assert_eq!(
+            log.observe(&serde_json::json!([pane("%2", "b"), pane("%3", "a")])),
+            3
+        );
+        let events = log.since(2).expect("resumable");
+        let kinds: Vec<(&str, &str)> = events
+            .iter()
+            .map(|e| {
+                (
+                    e["type"].as_str().expect("type"),
+                    e["pane_id"].as_str().expect("id"),
+                )
+            })
+            .collect();
+        assert_eq!(
+            kinds,
+            [
+                ("pane.removed", "%1"),
+                ("pane.updated", "%2"),
+                ("pane.added", "%3")
+            ]
+        );
+        assert_eq!(events[0].get("pane"), None);
+        assert_eq!(events[1]["fields"], serde_json::json!(["window_name"]));
+        assert_eq!(events[1]["pane"]["window_name"], "b");
+        assert_eq!(events[2]["cursor"], 5);
+
+        assert_eq!(log.cursor(), 5);
+        assert_eq!(log.since(5), Some(Vec::new()));
+        assert_eq!(log.since(6), None, "cursor from another daemon");
+        assert_eq!(log.snapshot()[0]["pane_id"], "%2");
+    }
+
+    #[test]
+    fn old_cursors_need_a_snapshot() {
+        let mut log = PaneEventLog::default();
+        for i in 0..=MAX_EVENTS {
+            log.observe(&serde_json::json!([pane("%1", &i.to_string())]));
+        }
+        assert_eq!(log.cursor(), MAX_EVENTS as u64 + 1);
+        assert_eq!(log.since(0), None);
+        assert_eq!(log.since(1).map(|e| e.len()), Some(MAX_EVENTS));
+    }
+
+    #[test]
+    fn changes_fold_events_per_pane() {
+        let mut log = PaneEventLog::default();
+        assert_eq!(
+            log.observe_build(
+                (1, 0),
+                &serde_json::json!([pane("%1", "a"), pane("%2", "a")])
+            ),
+            2
+        );
+        assert_eq!(
+            log.observe_build((1, 0), &serde_json::json!([pane("%1", "x")])),
+            0,
+            "same build"
+        );
+        assert_eq!(
+            log.changes_since(0),
+            Some((vec![pane("%1", "a"), pane("%2", "a")], Vec::new()))
+        );
+        log.observe_build(
+            (2, 0),
+            &serde_json::json!([pane("%2", "b"), pane("%3", "a")]),
+        );
+        log.observe_build(
+            (2, 1),
+            &serde_json::json!([pane("%2", "c"), pane("%3", "a")]),
+        );
+        assert_eq!(
+            log.changes_since(2),
+            Some((
+                vec![pane("%2", "c"), pane("%3", "a")],
+                vec!["%1".to_string()]
+            ))
+        );
+        assert_eq!(
+            log.changes_since(log.cursor()),
+            Some((Vec::new(), Vec::new()))
+        );
+        assert_eq!(log.changes_since(99), None);
+    }
+
+    #[test]
+    fn applies_changes_to_a_copy() {
+        let mut panes = Vec::new();
+        let full = serde_json::json!({"cursor": 2, "full": true,
+            "panes": [pane("%1", "a"), pane("%2", "a")], "removed": []});
+        assert_eq!(apply_changes(&mut panes, full), Some(2));
+        assert_eq!(panes.len(), 2);
+
+        let delta = serde_json::json!({"cursor": 5, "full": false,
+            "panes": [pane("%2", "b"), pane("%4", "a")], "removed": ["%1"]});
+        assert_eq!(apply_changes(&mut panes, delta), Some(5));
+        assert_eq!(panes, [pane("%2", "b"), pane("%4", "a")]);
+
+        let plain = serde_json::json!([pane("%9", "a")]);
+        assert_eq!(apply_changes(&mut panes, plain), None);
+        assert_eq!(panes, [pane("%9", "a")]);
+    }
+}
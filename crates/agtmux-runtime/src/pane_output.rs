@@ -0,0 +1,182 @@
+//! Pane output (`pane.output`, remote `GET /v1/terminal`, the MCP
+//! `view_output` tool): the last `lines` lines of a pane, captured through
+//! tmux on the exec pool.
+//!
+//! Every reply carries a `cursor` naming its last few lines. Passed back as
+//! `since`, only the lines printed after them are returned (`full: false`),
+//! so a caller polling a pane does not receive the same block again. When
+//! those lines are no longer in the captured range (scrolled past `lines`,
+//! redrawn by a full-screen program, cleared) the whole capture comes back
+//! with `full: true`. If the same lines occur more than once, the earliest
+//! occurrence is used: a repeat may return lines again, but never skips any.
+//! Lines are masked by `[redact]` before the cursor is computed.
+
+use std::sync::Arc;
+
+use chrono::Utc;
+use serde_json::{Value, json};
+use sha2::{Digest, Sha256};
+use tokio::sync::Mutex;
+
+use crate::actions::{self, ActionError};
+use crate::poll_loop::DaemonState;
+
+/// Lines captured when the query has no `lines`.
+pub const DEFAULT_LINES: u64 = 50;
+pub const MAX_LINES: u64 = 2000;
+/// Trailing lines a cursor covers, so one repeated prompt line does not
+/// match everywhere.
+const CURSOR_LINES: usize = 3;
+
+/// `pane.output` params.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct OutputQuery {
+    pub pane_id: String,
+    pub lines: u64,
+    /// `cursor` of an earlier reply for the same pane.
+    pub since: Option<String>,
+}
+
+impl OutputQuery {
+    pub fn from_params(params: &Value) -> Result<Self, String> {
+        let pane_id = params["pane_id"]
+            .as_str()
+            .filter(|p| !p.is_empty())
+            .ok_or("pane_id is required")?;
+        let lines = match &params["lines"] {
+            Value::Null => DEFAULT_LINES,
+            lines => lines
+                .as_u64()
+                .ok_or("lines must be a positive integer")?
+                .clamp(1, MAX_LINES),
+        };
+        let since = match &params["since"] {
+            Value::Null => None,
+            since => Some(
+                since
+                    .as_str()
+                    .ok_or("since must be a cursor string")?
+                    .to_string(),
+            ),
+        };
+        Ok(Self {
+            pane_id: pane_id.to_string(),
+            lines,
+            since,
+        })
+    }
+}
+
+/// Capture the pane and build the reply.
+pub async fn capture(
+    state: &Arc<Mutex<DaemonState>>,
+    query: &OutputQuery,
+) -> Result<Value, ActionError> {
+    let (runner, pool, redactor) = {
+        let st = state.lock().await;
+        if !st.last_panes.iter().any(|p| p.pane_id == query.pane_id) {
+            return Err(ActionError::PaneNotFound(query.pane_id.clone()));
+        }
+        (
+            actions::tmux_runner(&st)?,
+            Arc::clone(&st.exec_pool),
+            st.redactor.clone(),
+        )
+    };
+    let args = vec![
+        "capture-pane".to_string(),
+        "-p".to_string(),
+        "-J".to_string(),
+        "-S".to_string(),
+        format!("-{}", query.lines),
+        "-t".to_string(),
+        query.pane_id.clone(),
+    ];
+    let output = actions::run_tmux(&runner, &pool, args).await?;
+    let output = redactor.redact(&output);
+    let lines: Vec<&str> = output.trim_end_matches('\n').lines().collect();
+    Ok(reply(&query.pane_id, &lines, query.since.as_deref()))
+}
+
+/// `{pane_id, lines, cursor, full, captured_at}` for a capture: the lines
+/// after `since` when it is found, else all of them.
+fn reply(pane_id: &str, lines: &[&str], since: Option<&str>) -> Value {
+    let start =
+        since.and_then(|since| (0..=lines.len()).find(|&end| cursor(&lines[..end]) == since));
+    json!({
+        "pane_id": pane_id,
+        "lines": &lines[start.unwrap_or(0)..],
+        "cursor": cursor(lines),
+        "full": start.is_none(),
+        "captured_at": Utc::now(),
+    })
+}
+
+/// Count and hash of the last [`CURSOR_LINES`] lines.
+fn cursor(lines: &[&str]) -> String {
+    let tail = &lines[lines.len().saturating_sub(CURSOR_LINES)..];
+    let digest = Sha256::digest(tail.join("\n").as_bytes());
+    let hex: String = digest[..8].iter().map(|b| format!("{b:02x}")).collect();
+    format!("{}-{hex}", tail.len())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn since_returns_only_new_lines() {
+        let first = reply("%1", &["$ make", "building", "ok"], None);
+        assert_eq!(first["full"], true);
+        assert_eq!(first["lines"], json!(["$ make", "building", "ok"]));
+        let cursor = first["cursor"].as_str().expect("cursor");
+
+        let next = reply(
+            "%1",
+            &["$ make", "building", "ok", "$ test", "passed"],
+            Some(cursor),
+        );
+        assert_eq!(next["full"], false);
+        assert_eq!(next["lines"], json!(["$ test", "passed"]));
+        let unchanged = reply("%1", &["$ make", "building", "ok"], Some(cursor));
+        assert_eq!(unchanged["lines"], json!([]));
+        assert_eq!(unchanged["cursor"], cursor);
+
+        let cleared = reply("%1", &["$ clear", "fresh"], Some(cursor));
+        assert_eq!(cleared["full"], true, "anchor gone");
+        assert_eq!(cleared["lines"], json!(["$ clear", "fresh"]));
+
+        let empty = reply("%1", &[], None);
+        let started = reply("%1", &["hello"], empty["cursor"].as_str());
+        assert_eq!(
+            (started["full"].clone(), started["lines"].clone()),
+            (json!(false), json!(["hello"]))
+        );
+    }
+
+    #[test]
+    fn repeated_tails_never_skip_lines() {
+        let first = reply("%1", &["a", "b", ">"], None);
+        let next = reply(
+            "%1",
+            &["a", "b", ">", "x", "a", "b", ">"],
+            first["cursor"].as_str(),
+        );
+        assert_eq!(next["lines"], json!(["x", "a", "b", ">"]));
+    }
+
+    #[test]
+    fn parses_params() {
+        let query =
+            OutputQuery::from_params(&json!({"pane_id": "%3", "lines": 9999})).expect("valid");
+        assert_eq!((query.lines, query.since), (MAX_LINES, None));
+        let query =
+            OutputQuery::from_params(&json!({"pane_id": "%3", "since": "3-ab"})).expect("valid");
+        assert_eq!(
+            (query.lines, query.since.as_deref()),
+            (DEFAULT_LINES, Some("3-ab"))
+        );
+        assert!(OutputQuery::from_params(&json!({})).is_err());
+        assert!(OutputQuery::from_params(&json!({"pane_id": "%3", "since": 1})).is_err());
+    }
+}
@@ -0,0 +1,411 @@
+//! `pipe-pane` backend of the recorder (`[recorder] backend = "pipe-pane"`).
+//!
+//! Each recorded pane runtime gets a FIFO under the runtime dir
+//! (`pipes/<runtime>`) and `tmux pipe-pane` writes everything the pane
+//! prints into it, so output is kept as it happens instead of being diffed
+//! out of periodic captures. A reader task buffers what arrives and appends
+//! it to the recording as `{at, raw}` records, at most every
+//! [`FLUSH_EVERY`] or [`FLUSH_BYTES`]. [`PlainText`] turns raw output back
+//! into rows for replay.
+//!
+//! The reader stops when the recorder drops its stop signal (the pane went
+//! away, or the recorder was turned off or switched backend); it then turns
+//! the pipe off and removes the FIFO.
+
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::Duration;
+
+use agtmux_tmux_v5::TmuxCommandRunner;
+use chrono::Utc;
+use serde_json::Value;
+use tokio::io::AsyncReadExt;
+use tokio::net::unix::pipe;
+use tokio::sync::oneshot;
+
+use crate::actions;
+use crate::exec_pool::ExecPool;
+use crate::paths::runtime_dir;
+use crate::recorder::{append, create_private_dir};
+
+/// Buffered output is written at least this often.
+pub const FLUSH_EVERY: Duration = Duration::from_secs(1);
+/// ... or as soon as this much is buffered.
+pub const FLUSH_BYTES: usize = 64 << 10;
+
+/// FIFO `pipe-pane` writes the output of `runtime` into.
+fn fifo_path(runtime: &str) -> PathBuf {
+    runtime_dir().join("pipes").join(runtime)
+}
+
+/// Replace whatever is at `path` with a FIFO only the daemon user can open.
+fn make_fifo(path: &Path) -> Result<(), String> {
+    if let Some(parent) = path.parent() {
+        create_private_dir(parent).map_err(|e| format!("{}: {e}", parent.display()))?;
+    }
+    match std::fs::remove_file(path) {
+        Ok(()) => {}
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => {}
+        Err(e) => return Err(format!("{}: {e}", path.display())),
+    }
+    let status = std::process::Command::new("mkfifo")
+        .args(["-m", "600"])
+        .arg(path)
+        .status()
+        .map_err(|e| format!("mkfifo: {e}"))?;
+    if !status.success() {
+        return Err(format!("mkfifo {} failed: {status}", path.display()));
+    }
+    Ok(())
+}
+
+/// `s` quoted for `sh`.
+fn sh_quote(s: &str) -> String {
+    format!("'{}'", s.replace('\'', r"'\''"))
+}
+
+/// Pipe the output of `pane_id` into its recording in `dir` until `stopped`
+/// fires or its sender is dropped. Returns once the pipe is set up; the
+/// reading happens on a spawned task.
+pub async fn attach(
+    runner: &Arc<dyn TmuxCommandRunner>,
+    pool: &Arc<ExecPool>,
+    dir: &Path,
+    runtime: &str,
+    pane_id: &str,
+    meta: Value,
+    stopped: oneshot::Receiver<()>,
+) -> Result<(), String> {
+    let fifo = fifo_path(runtime);
+    let path = fifo.clone();
+    pool.run(move || make_fifo(&path))
+        .await
+        .map_err(|e| e.to_string())??;
+    let mut options = pipe::OpenOptions::new();
+    // Holding a write end of our own keeps reads from hitting EOF between
+    // the pipe being turned off and the stop signal.
+    #[cfg(any(target_os = "linux", target_os = "android"))]
+    options.read_write(true);
+    let rx = options
+        .open_receiver(&fifo)
+        .map_err(|e| format!("{}: {e}", fifo.display()))?;
+    // `-o` would toggle an existing pipe off; a pipe left by an earlier
+    // daemon is replaced instead.
+    let command = format!("exec cat > {}", sh_quote(&fifo.to_string_lossy()));
+    let args = vec![
+        "pipe-pane".to_string(),
+        "-t".to_string(),
+        pane_id.to_string(),
+        command,
+    ];
+    if let Err(e) = actions::run_tmux(runner, pool, args).await {
+        let _ = std::fs::remove_file(&fifo);
+        return Err(e.to_string());
+    }
+    tokio::spawn(read(
+        Arc::clone(runner),
+        Arc::clone(pool),
+        rx,
+        Reader {
+            dir: dir.to_path_buf(),
+            runtime: runtime.to_string(),
+            pane_id: pane_id.to_string(),
+            fifo,
+            meta,
+        },
+        stopped,
+    ));
+    Ok(())
+}
+
+/// Where a reader task writes.
+struct Reader {
+    dir: PathBuf,
+    runtime: String,
+    pane_id: String,
+    fifo: PathBuf,
+    meta: Value,
+}
+
+impl Reader {
+    /// Append the complete UTF-8 text of `buf` as one record (on the exec
+    /// pool), keeping a sequence cut off at the end for the next flush.
+    async fn flush(&self, pool: &ExecPool, buf: &mut Vec<u8>) {
+        let cut = match std::str::from_utf8(buf) {
+            Ok(_) => buf.len(),
+            Err(e) if e.error_len().is_none() => e.valid_up_to(),
+            Err(_) => buf.len(),
+        };
+        if cut == 0 {
+            return;
+        }
+        let text = String::from_utf8_lossy(&buf[..cut]).into_owned();
+        buf.drain(..cut);
+        let now = Utc::now();
+        let record = serde_json::json!({"at": now, "raw": text});
+        let (dir, runtime, meta) = (self.dir.clone(), self.runtime.clone(), self.meta.clone());
+        match pool
+            .run(move || append(&dir, &runtime, &meta, &record, now))
+            .await
+        {
+            Ok(Ok(())) => {}
+            Ok(Err(e)) => tracing::warn!("recorder write for {} failed: {e}", self.runtime),
+            Err(e) => tracing::warn!("recorder write for {} failed: {e}", self.runtime),
+        }
+    }
+}
+
+async fn read(
+    runner: Arc<dyn TmuxCommandRunner>,
+    pool: Arc<ExecPool>,
+    mut rx: pipe::Receiver,
+    reader: Reader,
+    mut stopped: oneshot::Receiver<()>,
+) {
+    let mut buf = Vec::new();
+    let mut chunk = vec![0u8; 8 << 10];
+    let mut flush = tokio::time::interval(FLUSH_EVERY);
+    loop {
+        tokio::select! {
+            _ = &mut stopped => break,
+            _ = flush.tick() => reader.flush(&pool, &mut buf).await,
+            read = rx.read(&mut chunk) => match read {
+                Ok(0) => tokio::time::sleep(FLUSH_EVERY).await,
+                Ok(n) => {
+                    buf.extend_from_slice(&chunk[..n]);
+                    if buf.len() >= FLUSH_BYTES {
+                        reader.flush(&pool, &mut buf).await;
+                    }
+                }
+                Err(e) => {
+                    tracing::warn!("recorder pipe of {} failed: {e}", reader.pane_id);
+                    break;
+                }
+            },
+        }
+    }
+    reader.flush(&pool, &mut buf).await;
+    // Fails harmlessly when the pane is already gone.
+    let args = vec![
+        "pipe-pane".to_string(),
+        "-t".to_string(),
+        reader.pane_id.clone(),
+    ];
+    let _ = actions::run_tmux(&runner, &pool, args).await;
+    let _ = std::fs::remove_file(&reader.fifo);
+}
+
+/// Where [`PlainText`] is within an escape sequence.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+enum Escape {
+    #[default]
+    None,
+    /// After ESC.
+    Start,
+    /// In `ESC [ ...`, until a final byte.
+    Csi,
+    /// In `ESC ] ...`, until BEL or `ESC \`.
+    Osc,
+    /// ESC within an OSC.
+    OscEnd,
+    /// After `ESC (` / `ESC )`, one charset byte.
+    Charset,
+}
+
+/// Raw terminal output turned into plain rows: escape sequences dropped,
+/// `\r` returning to the start of the row, backspace erasing. Good enough for
+/// line-oriented output; full-screen redraws come out as their text.
+#[derive(Debug, Default)]
+pub struct PlainText {
+    line: String,
+    escape: Escape,
+    /// `\r` seen; the row is cleared unless `\n` follows.
+    cr: bool,
+}
+
+impl PlainText {
+    /// Feed raw output, pushing every completed row to `out`.
+    pub fn feed(&mut self, raw: &str, out: &mut Vec<String>) {
+        for c in raw.chars() {
+            match self.escape {
+                Escape::Start => {
+                    self.escape = match c {
+                        '[' => Escape::Csi,
+                        ']' => Escape::Osc,
+                        '(' | ')' => Escape::Charset,
+                        _ => Escape::None,
+                    };
+                    continue;
+                }
+                Escape::Csi => {
+                    if ('@'..='~').contains(&c) {
+                        self.escape = Escape::None;
+                    }
+                    continue;
+                }
+                Escape::Osc => {
+                    match c {
+                        '\x07' => self.escape = Escape::None,
+                        '\x1b' => self.escape = Escape::OscEnd,
+                        _ => {}
+                    }
+                    continue;
+                }
+                Escape::OscEnd => {
+                    self.escape = if c == '\\' { Escape::None } else { Escape::Osc };
+                    continue;
+                }
+                Escape::Charset => {
+                    self.escape = Escape::None;
+                    continue;
+                }
+                Escape::None => {}
+            }
+            if std::mem::take(&mut self.cr) && c != '\n' {
+                self.line.clear();
+            }
+            match c {
+                '\x1b' => self.escape = Escape::Start,
+                '\n' => out.push(std::mem::take(&mut self.line)),
+                '\r' => self.cr = true,
+                '\x08' => {
+                    self.line.pop();
+                }
+                '\t' => self.line.push(c),
+                c if c.is_control() => {}
+                c => self.line.push(c),
+            }
+        }
+    }
+
+    /// Replay records with every `{at, raw}` record turned into `{at, lines,
+    /// gap}` rows; a row still open at the end is kept as the last one.
+    pub fn rows(records: Vec<Value>) -> Vec<Value> {
+        let mut text = Self::default();
+        let mut last_at = Value::Null;
+        let mut rows = Vec::with_capacity(records.len());
+        for record in records {
+            let Some(raw) = record["raw"].as_str() else {
+                rows.push(record);
+                continue;
+            };
+            let mut lines = Vec::new();
+            text.feed(raw, &mut lines);
+            last_at = record["at"].clone();
+            rows.push(serde_json::json!({"at": record["at"], "lines": lines, "gap": false}));
+        }
+        if !text.line.is_empty() {
+            rows.push(serde_json::json!({"at": last_at, "lines": [text.line], "gap": false}));
+        }
+        rows
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use agtmux_tmux_v5::error::TmuxError;
+    use serde_json::json;
+    use tokio::io::AsyncWriteExt;
+
+    /// Every tmux call fails, as for a pane that is gone.
+    struct NoTmux;
+
+    impl TmuxCommandRunner for NoTmux {
+        fn run(&self, args: &[&str]) -> Result<String, TmuxError> {
+            Err(TmuxError::CommandFailed(format!("no tmux: {args:?}")))
+        }
+    }
+
+    fn plain(raw: &str) -> (Vec<String>, String) {
+        let mut text = PlainText::default();
+        let mut out = Vec::new();
+        text.feed(raw, &mut out);
+        (out, text.line)
+    }
+
+    #[test]
+    fn strips_escapes_and_applies_returns() {
+        assert_eq!(
+            plain("\x1b[1;31merror\x1b[0m: boom\r\n\x1b]0;title\x07$ ls\r\n"),
+            (
+                vec!["error: boom".to_string(), "$ ls".to_string()],
+                String::new()
+            )
+        );
+        assert_eq!(
+            plain("10%\r50%\r100%\ndone\x08\x08ne\x1b(B"),
+            (vec!["100%".to_string()], "done".to_string())
+        );
+        assert_eq!(
+            plain("\x1b]8;;http://x\x1b\\link\tok\x1b[K"),
+            (Vec::new(), "link\tok".to_string())
+        );
+    }
+
+    #[test]
+    fn rows_span_records_and_escapes_split_between_them() {
+        let records = vec![
+            json!({"at": "2026-10-15T07:00:01Z", "raw": "cargo te"}),
+            json!({"at": "2026-10-15T07:00:02Z", "raw": "st\r\nerror\x1b["}),
+            json!({"at": "2026-10-15T07:00:03Z", "raw": "31m: boom\r\n$ "}),
+        ];
+        assert_eq!(
+            PlainText::rows(records),
+            vec![
+                json!({"at": "2026-10-15T07:00:01Z", "lines": [], "gap": false}),
+                json!({"at": "2026-10-15T07:00:02Z", "lines": ["cargo test"], "gap": false}),
+                json!({"at": "2026-10-15T07:00:03Z", "lines": ["error: boom"], "gap": false}),
+                json!({"at": "2026-10-15T07:00:03Z", "lines": ["$ "], "gap": false}),
+            ]
+        );
+        let capture = json!({"at": "2026-10-15T07:00:00Z", "lines": ["x"], "gap": true});
+        assert_eq!(PlainText::rows(vec![capture.clone()]), vec![capture]);
+    }
+
+    #[tokio::test]
+    async fn fifo_output_is_appended_to_the_recording() {
+        let dir = std::env::temp_dir().join(format!("agtmux-pane-pipe-{}", std::process::id()));
+        let _ = std::fs::remove_dir_all(&dir);
+        let fifo = dir.join("pipes").join("3-20261015T070000");
+        make_fifo(&fifo).expect("mkfifo");
+        let rx = pipe::OpenOptions::new()
+            .open_receiver(&fifo)
+            .expect("receiver");
+        let reader = Reader {
+            dir: dir.join("recordings"),
+            runtime: "3-20261015T070000".to_string(),
+            pane_id: "%3".to_string(),
+            fifo: fifo.clone(),
+            meta: json!({"pane_id": "%3"}),
+        };
+        let pool = ExecPool::new(2);
+        let runner: Arc<dyn TmuxCommandRunner> = Arc::new(NoTmux);
+        let (stop, stopped) = oneshot::channel();
+        let task = tokio::spawn(read(runner, pool, rx, reader, stopped));
+
+        let mut tx = pipe::OpenOptions::new().open_sender(&fifo).expect("sender");
+        tx.write_all("cargo test\r\nerror: bo".as_bytes())
+            .await
+            .expect("write");
+        tx.write_all("om\r\n".as_bytes()).await.expect("write");
+        tokio::time::sleep(Duration::from_millis(100)).await;
+        drop(stop);
+        task.await.expect("reader");
+
+        assert!(!fifo.exists(), "FIFO removed");
+        let replayed =
+            crate::recorder::replay(&dir.join("recordings"), "3-20261015T070000", None, false)
+                .expect("read")
+                .expect("recorded");
+        let lines: Vec<&str> = replayed["records"]
+            .as_array()
+            .expect("records")
+            .iter()
+            .flat_map(|r| r["lines"].as_array().expect("lines"))
+            .filter_map(Value::as_str)
+            .collect();
+        assert_eq!(lines, ["cargo test", "error: boom"]);
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
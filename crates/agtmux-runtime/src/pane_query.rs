@@ -0,0 +1,359 @@
+//! `list_panes` params (also remote `GET /v1/snapshot`): `repo` / `branch`
+//! filters, `sort`, paging and a `fields` projection, for clients that list
+//! large fleets.
+//!
+//! - `sort`: top-level fields, comma-separated or as an array, each
+//!   descending with a leading `-` (`-updated_at,session_name`). Missing
+//!   and null values sort last either way; ties keep pane id order.
+//! - `limit` pages the list. Without `sort` pages follow pane id order and
+//!   `after` / `next_after` is the cursor (unchanged by panes coming and
+//!   going); with `sort`, or with `offset`, pages are `offset` /
+//!   `next_offset` into the sorted list.
+//! - `fields`: top-level fields to keep in each entry, e.g.
+//!   `pane_id,activity_state,provider` for an overview. `pane_id` is always
+//!   kept; unknown names are left out.
+//!
+//! Filtering and sorting see whole entries, so a list can be sorted by a
+//! field it does not return.
+
+use std::cmp::Ordering;
+
+use serde_json::{Map, Value};
+
+use crate::server::{pane_in_git, pane_order_key};
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct SortKey {
+    field: String,
+    descending: bool,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Page {
+    /// Pane id order, after pane id `after`.
+    After {
+        limit: usize,
+        after: Option<String>,
+    },
+    Offset {
+        limit: usize,
+        offset: usize,
+    },
+}
+
+/// `list_panes` params.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct PaneListQuery {
+    pub repo: Option<String>,
+    pub branch: Option<String>,
+    sort: Vec<SortKey>,
+    page: Option<Page>,
+    /// None keeps whole entries.
+    fields: Option<Vec<String>>,
+}
+
+impl PaneListQuery {
+    pub fn from_params(params: &Value) -> Result<Self, String> {
+        let string = |key: &str| {
+            params[key]
+                .as_str()
+                .filter(|s| !s.is_empty())
+                .map(String::from)
+        };
+        let sort = names(&params["sort"], "sort")?
+            .unwrap_or_default()
+            .into_iter()
+            .map(|name| match name.strip_prefix('-') {
+                Some(field) => SortKey {
+                    field: field.to_string(),
+                    descending: true,
+                },
+                None => SortKey {
+                    field: name,
+                    descending: false,
+                },
+            })
+            .collect::<Vec<_>>();
+        if sort.iter().any(|k| k.field.is_empty()) {
+            return Err("sort field must not be empty".to_string());
+        }
+        let count = |key: &str| match &params[key] {
+            Value::Null => Ok(None),
+            value => value
+                .as_u64()
+                .map(|n| Some(n as usize))
+                .ok_or_else(|| format!("{key} must be a non-negative integer, got {value}")),
+        };
+        let offset = count("offset")?;
+        let after = string("after");
+        let page = match count("limit")? {
+            None if offset.is_some() => return Err("offset requires limit".to_string()),
+            None => None,
+            Some(0) => return Err("limit must be >= 1".to_string()),
+            Some(_) if offset.is_some() && after.is_some() => {
+                return Err("after and offset cannot be combined".to_string());
+            }
+            Some(_) if !sort.is_empty() && after.is_some() => {
+                return Err("after pages in pane id order; use offset with sort".to_string());
+            }
+            Some(limit) if offset.is_none() && sort.is_empty() => {
+                Some(Page::After { limit, after })
+            }
+            Some(limit) => Some(Page::Offset {
+                limit,
+                offset: offset.unwrap_or(0),
+            }),
+        };
+        let fields = names(&params["fields"], "fields")?.map(|mut fields| {
+            if !fields.iter().any(|f| f == "pane_id") {
+                fields.insert(0, "pane_id".to_string());
+            }
+            fields
+        });
+        Ok(Self {
+            repo: string("repo"),
+            branch: string("branch"),
+            sort,
+            page,
+            fields,
+        })
+    }
+
+    /// The `list_panes` result for `panes` (the full list, shared with the
+    /// pane list cache): a plain array, or `{panes, next_after}` /
+    /// `{panes, next_offset}` when paged. Only the returned entries are
+    /// copied.
+    pub fn apply(&self, panes: &Value) -> Value {
+        let (repo, branch) = (self.repo.as_deref(), self.branch.as_deref());
+        let mut panes: Vec<&Value> = panes
+            .as_array()
+            .into_iter()
+            .flatten()
+            .filter(|pane| pane_in_git(pane, repo, branch))
+            .collect();
+        if !self.sort.is_empty() {
+            panes.sort_by(|a, b| self.compare(a, b));
+        }
+        let (page, next) = match &self.page {
+            None => (panes, None),
+            Some(Page::After { limit, after }) => {
+                let key = |pane: &Value| pane_order_key(pane["pane_id"].as_str().unwrap_or(""));
+                panes.sort_by_key(|pane| key(pane));
+                let start = after.as_deref().map_or(0, |a| {
+                    let after_key = pane_order_key(a);
+                    panes.partition_point(|p| key(p) <= after_key)
+                });
+                let more = panes.len() > start.saturating_add(*limit);
+                let page: Vec<&Value> = panes.into_iter().skip(start).take(*limit).collect();
+                let next_after = page.last().filter(|_| more).map(|p| p["pane_id"].clone());
+                (
+                    page,
+                    Some(("next_after", next_after.unwrap_or(Value::Null))),
+                )
+            }
+            Some(Page::Offset { limit, offset }) => {
+                let more = panes.len() > offset.saturating_add(*limit);
+                let page: Vec<&Value> = panes.into_iter().skip(*offset).take(*limit).collect();
+                let next_offset = more.then(|| offset + page.len());
+                (page, Some(("next_offset", serde_json::json!(next_offset))))
+            }
+        };
+        let page = Value::Array(page.into_iter().map(|p| self.projected(p)).collect());
+        match next {
+            None => page,
+            Some((key, next)) => serde_json::json!({"panes": page, key: next}),
+        }
+    }
+
+    /// A copy of `pane` with only `fields`.
+    fn projected(&self, pane: &Value) -> Value {
+        match (&self.fields, pane) {
+            (Some(fields), Value::Object(entry)) => Value::Object(
+                fields
+                    .iter()
+                    .filter_map(|f| entry.get(f).map(|v| (f.clone(), v.clone())))
+                    .collect(),
+            ),
+            _ => pane.clone(),
+        }
+    }
+
+    /// Keep only `fields` in each entry of `panes` (an array).
+    pub fn project(&self, panes: &mut Value) {
+        let (Some(fields), Some(panes)) = (&self.fields, panes.as_array_mut()) else {
+            return;
+        };
+        for pane in panes {
+            let Value::Object(entry) = pane else {
+                continue;
+            };
+            let mut kept = Map::new();
+            for field in fields {
+                if let Some(value) = entry.remove(field) {
+                    kept.insert(field.clone(), value);
+                }
+            }
+            *entry = kept;
+        }
+    }
+
+    fn compare(&self, a: &Value, b: &Value) -> Ordering {
+        self.sort
+            .iter()
+            .map(|key| {
+                let (x, y) = (&a[&key.field], &b[&key.field]);
+                match (x.is_null(), y.is_null()) {
+                    (true, true) => Ordering::Equal,
+                    (true, false) => Ordering::Greater,
+                    (false, true) => Ordering::Less,
+                    (false, false) if key.field == "pane_id" => {
+                        let order = pane_order_key(x.as_str().unwrap_or(""))
+                            .cmp(&pane_order_key(y.as_str().unwrap_or("")));
+                        if key.descending {
+                            order.reverse()
+                        } else {
+                            order
+                        }
+                    }
+                    (false, false) if key.descending => compare_values(y, x),
+                    (false, false) => compare_values(x, y),
+                }
+            })
+            .find(|o| o.is_ne())
+            .unwrap_or_else(|| {
+                pane_order_key(a["pane_id"].as_str().unwrap_or(""))
+                    .cmp(&pane_order_key(b["pane_id"].as_str().unwrap_or("")))
+            })
+    }
+}
+
+/// A list param given as an array of strings or a comma-separated string.
+fn names(value: &Value, key: &str) -> Result<Option<Vec<String>>, String> {
+    let names: Vec<String> = match value {
+        Value::Null => return Ok(None),
+        Value::String(s) => s.split(',').map(|n| n.trim().to_string()).collect(),
+        Value::Array(items) => items
+            .iter()
+            .map(|item| {
+                item.as_str()
+                    .map(|n| n.trim().to_string())
+                    .ok_or_else(|| format!("{key} entries must be strings, got {item}"))
+            })
+            .collect::<Result<_, _>>()?,
+        other => return Err(format!("{key} must be a string or an array, got {other}")),
+    };
+    if names.iter().any(String::is_empty) {
+        return Err(format!("{key} must not contain empty names"));
+    }
+    Ok(Some(names))
+}
+
+/// Numbers by value, strings and booleans as usual; across types, booleans
+/// then numbers then strings then anything else.
+fn compare_values(a: &Value, b: &Value) -> Ordering {
+    let rank = |v: &Value| match v {
+        Value::Null => 4,
+        Value::Bool(_) => 0,
+        Value::Number(_) => 1,
+        Value::String(_) => 2,
+        Value::Array(_) | Value::Object(_) => 3,
+    };
+    match (a, b) {
+        (Value::Bool(x), Value::Bool(y)) => x.cmp(y),
+        (Value::Number(x), Value::Number(y)) => {
+            let (x, y) = (x.as_f64().unwrap_or(0.0), y.as_f64().unwrap_or(0.0));
+            x.total_cmp(&y)
+        }
+        (Value::String(x), Value::String(y)) => x.cmp(y),
+        _ => rank(a).cmp(&rank(b)),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn panes() -> Value {
+        json!([
+            {"pane_id": "%10", "activity_state": "Running", "session_name": "api", "updated_at": 30},
+            {"pane_id": "%2", "activity_state": "Idle", "session_name": "web", "updated_at": 10},
+            {"pane_id": "%3", "session_name": "api"},
+            {"pane_id": "%1", "activity_state": "Idle", "session_name": "web", "updated_at": 20},
+        ])
+    }
+
+    fn ids(list: &Value) -> Vec<&str> {
+        list.as_array()
+            .expect("array")
+            .iter()
+            .filter_map(|p| p["pane_id"].as_str())
+            .collect()
+    }
+
+    fn query(params: Value) -> PaneListQuery {
+        PaneListQuery::from_params(&params).expect("valid params")
+    }
+
+    #[test]
+    fn sorts_by_fields_with_nulls_last() {
+        let sorted = query(json!({"sort": "-updated_at"})).apply(&panes());
+        assert_eq!(ids(&sorted), ["%10", "%1", "%2", "%3"]);
+
+        let sorted = query(json!({"sort": ["session_name", "-pane_id"]})).apply(&panes());
+        assert_eq!(ids(&sorted), ["%10", "%3", "%2", "%1"]);
+
+        // Ties fall back to pane id order.
+        let sorted = query(json!({"sort": "activity_state"})).apply(&panes());
+        assert_eq!(ids(&sorted), ["%1", "%2", "%10", "%3"]);
+    }
+
+    #[test]
+    fn sorted_pages_use_offsets() {
+        let q = query(json!({"sort": "-updated_at", "limit": 3}));
+        let first = q.apply(&panes());
+        assert_eq!(ids(&first["panes"]), ["%10", "%1", "%2"]);
+        assert_eq!(first["next_offset"], 3);
+
+        let last = query(json!({"sort": "-updated_at", "limit": 3, "offset": 3})).apply(&panes());
+        assert_eq!(ids(&last["panes"]), ["%3"]);
+        assert!(last["next_offset"].is_null());
+    }
+
+    #[test]
+    fn after_pages_walk_pane_id_order() {
+        let first = query(json!({"limit": 2})).apply(&panes());
+        assert_eq!(ids(&first["panes"]), ["%1", "%2"]);
+        assert_eq!(first["next_after"], "%2");
+
+        let last = query(json!({"limit": 2, "after": "%2"})).apply(&panes());
+        assert_eq!(ids(&last["panes"]), ["%3", "%10"]);
+        assert!(last["next_after"].is_null());
+    }
+
+    #[test]
+    fn projects_fields_and_keeps_pane_id() {
+        let list = query(json!({"fields": "activity_state,nope", "limit": 1})).apply(&panes());
+        assert_eq!(
+            list["panes"],
+            json!([{"pane_id": "%1", "activity_state": "Idle"}])
+        );
+
+        // Sorting sees fields the projection drops.
+        let list = query(json!({"fields": ["pane_id"], "sort": "-updated_at"})).apply(&panes());
+        assert_eq!(list[0], json!({"pane_id": "%10"}));
+    }
+
+    #[test]
+    fn rejects_invalid_params() {
+        let err = |params: Value| PaneListQuery::from_params(&params).expect_err("invalid");
+        assert_eq!(err(json!({"limit": 0})), "limit must be >= 1");
+        assert_eq!(err(json!({"offset": 2})), "offset requires limit");
+        assert!(err(json!({"limit": 2, "offset": 2, "after": "%1"})).contains("combined"));
+        assert!(err(json!({"limit": 2, "sort": "title", "after": "%1"})).contains("offset"));
+        assert!(err(json!({"limit": -1})).contains("non-negative"));
+        assert!(err(json!({"sort": "-"})).contains("empty"));
+        assert!(err(json!({"fields": "pane_id,,title"})).contains("empty"));
+        assert!(err(json!({"fields": [1]})).contains("strings"));
+    }
+}
@@ -0,0 +1,141 @@
+//! Default filesystem locations, following the XDG base directory spec.
+//!
+//! | Kind    | XDG                        | Fallback (Linux)        | Fallback (macOS)        |
+//! |---------|----------------------------|-------------------------|-------------------------|
+//! | config  | `$XDG_CONFIG_HOME/agtmux`  | `~/.config/agtmux`      | `~/.config/agtmux`      |
+//! | runtime | `$XDG_RUNTIME_DIR/agtmux`  | `/tmp/agtmux-$USER`     | `$TMPDIR/agtmux`        |
+//! | data    | `$XDG_DATA_HOME/agtmux`    | `~/.local/share/agtmux` | `~/.local/share/agtmux` |
+//!
+//! Runtime holds the UDS socket; data holds `[recorder]` recordings. There
+//! is no state dir: daemon state is in-memory (SQLite is Post-MVP), so there
+//! is no DB or lock file yet.
+//! Every location stays overridable (`--socket-path`, `--config`, `AGTMUX_*`).
+
+use std::path::PathBuf;
+
+/// `$XDG_CONFIG_HOME/agtmux`, falling back to `~/.config/agtmux`.
+pub fn config_dir() -> Option<PathBuf> {
+    config_dir_from(&env_var)
+}
+
+/// `$XDG_DATA_HOME/agtmux`, falling back to `~/.local/share/agtmux`.
+pub fn data_dir() -> Option<PathBuf> {
+    data_dir_from(&env_var)
+}
+
+/// Per-user directory for the daemon socket (see module docs).
+pub fn runtime_dir() -> PathBuf {
+    runtime_dir_from(&env_var, cfg!(target_os = "macos"))
+}
+
+fn env_var(key: &str) -> Option<String> {
+    std::env::var(key).ok()
+}
+
+/// An XDG variable is only honoured when set to an absolute path (per spec).
+fn xdg_dir(env: &dyn Fn(&str) -> Option<String>, key: &str) -> Option<PathBuf> {
+    env(key).map(PathBuf::from).filter(|p| p.is_absolute())
+}
+
+fn config_dir_from(env: &dyn Fn(&str) -> Option<String>) -> Option<PathBuf> {
+    let base = xdg_dir(env, "XDG_CONFIG_HOME").or_else(|| {
+        env("HOME")
+            .filter(|h| !h.is_empty())
+            .map(|h| PathBuf::from(h).join(".config"))
+    })?;
+    Some(base.join("agtmux"))
+}
+
+fn data_dir_from(env: &dyn Fn(&str) -> Option<String>) -> Option<PathBuf> {
+    let base = xdg_dir(env, "XDG_DATA_HOME").or_else(|| {
+        env("HOME")
+            .filter(|h| !h.is_empty())
+            .map(|h| PathBuf::from(h).join(".local/share"))
+    })?;
+    Some(base.join("agtmux"))
+}
+
+fn runtime_dir_from(env: &dyn Fn(&str) -> Option<String>, macos: bool) -> PathBuf {
+    if let Some(dir) = xdg_dir(env, "XDG_RUNTIME_DIR") {
+        return dir.join("agtmux");
+    }
+    // macOS has no XDG_RUNTIME_DIR; $TMPDIR is the per-user private temp dir.
+    if macos && let Some(dir) = xdg_dir(env, "TMPDIR") {
+        return dir.join("agtmux");
+    }
+    let user = env("USER")
+        .filter(|u| !u.is_empty())
+        .unwrap_or_else(|| "unknown".to_string());
+    PathBuf::from(format!("/tmp/agtmux-{user}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn env_of(pairs: &'static [(&'static str, &'static str)]) -> impl Fn(&str) -> Option<String> {
+        move |key| {
+            pairs
+                .iter()
+                .find(|(k, _)| *k == key)
+                .map(|(_, v)| v.to_string())
+        }
+    }
+
+    #[test]
+    fn config_dir_prefers_xdg() {
+        let env = env_of(&[("XDG_CONFIG_HOME", "/xdg/config"), ("HOME", "/home/u")]);
+        assert_eq!(
+            config_dir_from(&env),
+            Some(PathBuf::from("/xdg/config/agtmux"))
+        );
+
+        let env = env_of(&[("XDG_CONFIG_HOME", "rel/config"), ("HOME", "/home/u")]);
+        assert_eq!(
+            config_dir_from(&env),
+            Some(PathBuf::from("/home/u/.config/agtmux")),
+            "relative XDG path ignored"
+        );
+        assert_eq!(config_dir_from(&env_of(&[])), None);
+    }
+
+    #[test]
+    fn data_dir_prefers_xdg() {
+        let env = env_of(&[("XDG_DATA_HOME", "/xdg/data"), ("HOME", "/home/u")]);
+        assert_eq!(data_dir_from(&env), Some(PathBuf::from("/xdg/data/agtmux")));
+        let env = env_of(&[("HOME", "/home/u")]);
+        assert_eq!(
+            data_dir_from(&env),
+            Some(PathBuf::from("/home/u/.local/share/agtmux"))
+        );
+        assert_eq!(data_dir_from(&env_of(&[])), None);
+    }
+
+    #[test]
+    fn runtime_dir_xdg_macos_and_fallback() {
+        let env = env_of(&[("XDG_RUNTIME_DIR", "/run/user/1000"), ("USER", "u")]);
+        assert_eq!(
+            runtime_dir_from(&env, false),
+            PathBuf::from("/run/user/1000/agtmux")
+        );
+
+        let env = env_of(&[
+            ("XDG_RUNTIME_DIR", ""),
+            ("TMPDIR", "/var/folders/x/T/"),
+            ("USER", "u"),
+        ]);
+        assert_eq!(
+            runtime_dir_from(&env, true),
+            PathBuf::from("/var/folders/x/T/agtmux")
+        );
+        assert_eq!(
+            runtime_dir_from(&env, false),
+            PathBuf::from("/tmp/agtmux-u"),
+            "TMPDIR only used on macOS"
+        );
+        assert_eq!(
+            runtime_dir_from(&env_of(&[]), false),
+            PathBuf::from("/tmp/agtmux-unknown")
+        );
+    }
+}
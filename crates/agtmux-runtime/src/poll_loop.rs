@@ -1,11 +1,11 @@
 //! Poll loop: wires tmux → poller → gateway → daemon pipeline.
 //! Runs as a tokio task, polling tmux at configurable intervals.
 
-use std::collections::HashSet;
+use std::collections::{HashMap, HashSet};
 use std::sync::Arc;
 
 use chrono::Utc;
-use tokio::sync::Mutex;
+use tokio::sync::{Mutex, Notify};
 use tokio::time::{Duration, interval};
 
 use agtmux_core_v5::types::{GatewayPullRequest, Provider, PullEventsRequest, SourceKind};
@@ -21,20 +21,49 @@ use agtmux_gateway::latency_window::{LatencyEvaluation, LatencyWindow};
 use agtmux_gateway::source_registry::SourceRegistry;
 use agtmux_gateway::trust_guard::TrustGuard;
 use agtmux_source_claude_hooks::source::SourceState as ClaudeSourceState;
+use agtmux_source_claude_jsonl::discovery::SessionDiscovery;
 use agtmux_source_claude_jsonl::source::ClaudeJsonlSourceState;
 use agtmux_source_claude_jsonl::watcher::SessionFileWatcher;
 use agtmux_source_codex_appserver::source::SourceState as CodexSourceState;
 use agtmux_source_poller::source::{PollerSourceState, poll_pane};
 use agtmux_tmux_v5::{
-    PaneGenerationTracker, TmuxCommandRunner, TmuxExecutor, TmuxPaneInfo, capture_pane, list_panes,
-    scan_all_processes, to_pane_snapshot,
+    PaneGenerationTracker, ProcessMap, TmuxCommandRunner, TmuxExecutor, TmuxPaneInfo, capture_pane,
+    list_panes, rescan_processes, to_pane_snapshot,
 };
 
-use crate::cli::DaemonOpts;
+use crate::access::AccessPolicy;
+use crate::actions;
+use crate::adapters;
+use crate::aider::AiderTitles;
+use crate::alerts::AlertEngine;
+use crate::audit::AuditLog;
 use crate::codex_poller::{
     CodexAppServerClient, CodexCaptureTracker, PaneCwdInfo, parse_codex_capture_events,
 };
+use crate::daemon_config::{DaemonConfig, Limits, LoopIntervals, TmuxSocket};
+use crate::exec_pool::ExecPool;
+use crate::features::{self, Features};
+use crate::git_meta::{self, GitMeta};
+use crate::github::ExitReporter;
+use crate::groups::PaneGroups;
+use crate::idle::{IdleAction, IdleReaper};
+use crate::lru::LruMap;
+use crate::macros::MacroDef;
+use crate::metrics::{self, DaemonMetrics};
+use crate::notify::Notifier;
+use crate::pane_events::PaneEventLog;
+use crate::recorder::{self, Recorder};
+use crate::redact::Redactor;
+use crate::remote_api::{self, RemoteApi};
+use crate::responder::AutoResponder;
+use crate::restart::Restarter;
+use crate::schedule::{self, Scheduler};
+use crate::sd_notify::{self, Heartbeat};
+use crate::send_policy::SendPolicy;
 use crate::server;
+use crate::source_events::SourceEventLog;
+use crate::tasks::TaskMeta;
+use crate::tmux_control;
 
 /// Shared daemon state protected by a mutex.
 pub struct DaemonState {
@@ -51,13 +80,26 @@ pub struct DaemonState {
     pub last_panes: Vec<TmuxPaneInfo>,
     /// UDS trust admission guard (peer UID, source registry, nonce).
     pub trust_guard: TrustGuard,
+    /// Peer UIDs allowed to connect to the UDS (SO_PEERCRED); `allowed_uids`
+    /// in the config, else the daemon's own user.
+    pub allowed_uids: Vec<u32>,
+    /// `[access]` scope of each admitted caller.
+    pub access: AccessPolicy,
+    /// Recent action calls (`actions.history`).
+    pub audit: AuditLog,
+    /// `pane.send` calls waiting for their `at` / `after`.
+    pub scheduler: Scheduler,
+    /// `[send_policy]` checked before client input is typed.
+    pub send_policy: SendPolicy,
+    /// `[redact]` applied to pane output before it is returned.
+    pub redactor: Redactor,
     /// Source connection registry (hello/heartbeat/staleness lifecycle).
     pub source_registry: SourceRegistry,
     /// Two-watermark cursor tracking (fetched vs committed) for gateway cursor.
     pub cursor_watermarks: CursorWatermarks,
     /// Invalid cursor streak tracker — triggers recovery after consecutive failures.
     pub invalid_cursor_tracker: InvalidCursorTracker,
-    /// Rolling p95 latency window (SLO: 3000ms = freshness boundary).
+    /// Rolling p95 latency window (SLO: `limits.latency_slo_ms`, default 3000ms = freshness boundary).
     pub latency_window: LatencyWindow,
     /// Cached latency evaluation from the last poll_tick (for read-only API access).
     pub last_latency_eval: Option<LatencyEvaluation>,
@@ -73,7 +115,124 @@ pub struct DaemonState {
     /// Conversation titles keyed by session_key (T-135a/b).
     /// Codex: thread_id → name/preview from thread/list payload.
     /// Claude: session_key → title from custom-title JSONL events (T-135b).
-    pub conversation_titles: std::collections::HashMap<String, String>,
+    /// Session keys are never removed explicitly, so the map is capped at
+    /// `MAX_CONVERSATION_TITLES`; live sessions are rewritten every poll and
+    /// stay, titles of ended ones are evicted first.
+    pub conversation_titles: LruMap<String>,
+    /// Aider history files behind aider panes' conversation titles.
+    pub aider_titles: AiderTitles,
+    /// `[[adapters]]` name of panes claimed by a custom adapter.
+    pub pane_adapters: std::collections::HashMap<String, String>,
+    /// Verdicts of plugin adapters, rerun only when a pane changed.
+    pub plugin_verdicts: adapters::PluginVerdicts,
+    /// User-assigned pane labels keyed by pane_id (`agtmux label set`).
+    /// Override conversation titles in every view; dropped when the pane disappears.
+    pub pane_labels: std::collections::HashMap<String, String>,
+    /// Task metadata keyed by pane_id (`agtmux task set`).
+    pub pane_tasks: std::collections::HashMap<String, TaskMeta>,
+    /// Effective feature flags (`[features]`).
+    pub features: Features,
+    /// Capture / pull / SLO limits (`[limits]`).
+    pub limits: Limits,
+    /// Cadence of the sub-loops inside poll_tick (`[poll]` `*_ms` keys).
+    pub loop_timers: LoopTimers,
+    /// Last `ps` scan, reused on ticks where the process scan is not due
+    /// (shared, not copied, with the tick that reads it).
+    pub process_map: Arc<ProcessMap>,
+    /// Last Claude JSONL discovery, reused on ticks where discovery is not due.
+    pub claude_jsonl_discoveries: Vec<SessionDiscovery>,
+    /// Git repo / branch per pane `current_path` (`poll.git_scan_ms`);
+    /// None for paths outside a repository.
+    pub git_meta: std::collections::HashMap<String, Option<GitMeta>>,
+    /// Bounded pool every tmux / ps subprocess of poll_tick runs through
+    /// (`limits.exec_concurrency`).
+    pub exec_pool: Arc<ExecPool>,
+    /// Bumped whenever an input of `build_pane_list` other than the projection
+    /// version changes (tmux panes, labels, titles, applied events).
+    pub pane_list_epoch: u64,
+    /// Last `build_pane_list` output keyed by (projection version, epoch),
+    /// shared by every `list_panes` caller until the next change.
+    pub pane_list_cache: Option<((u64, u64), Arc<serde_json::Value>)>,
+    /// Daemon start, for uptime in `debug.metrics`.
+    pub started_at: std::time::Instant,
+    /// Desktop notifications on `[notify] states` transitions.
+    pub notifier: Notifier,
+    /// `[[alerts]]` rules and their unresolved alerts (`alerts.list`).
+    pub alerts: AlertEngine,
+    /// `[github]` reporting of runtimes that exited.
+    pub github: ExitReporter,
+    /// tmux executor for pane actions (`actions`); None until the daemon
+    /// starts (and in tests that do not exercise actions).
+    pub tmux: Option<Arc<dyn TmuxCommandRunner>>,
+    /// Action outcomes by `request_ref` (fingerprint, outcome), for replay.
+    pub action_refs: LruMap<(String, actions::RefOutcome)>,
+    /// Agents started by `pane.run`, by pane; dropped with the pane.
+    pub launches: std::collections::HashMap<String, actions::Launch>,
+    /// `[[macros]]` for `macro.run`.
+    pub macros: Vec<MacroDef>,
+    /// `[responder]` answers to approval prompts, with its audit trail.
+    pub responder: AutoResponder,
+    /// `[[auto_restart]]` retries of crashed agent panes (`restart.events`).
+    pub restarter: Restarter,
+    /// `[[idle_timeout]]` idle periods of managed panes.
+    pub idle: IdleReaper,
+    /// `[recorder]` capture rounds and the last capture of each runtime.
+    pub recorder: Recorder,
+    /// Named pane groups (`group.*`); members are dropped with their pane.
+    pub groups: PaneGroups,
+    /// Per-tick pane list diff served by `watch` with `deltas`.
+    pub pane_events: PaneEventLog,
+    /// Ingested events served by `watch` with `source_events`.
+    pub source_events: SourceEventLog,
+    /// Counters and histograms for `[metrics]`.
+    pub metrics: DaemonMetrics,
+}
+
+/// Cap on `DaemonState::conversation_titles`.
+const MAX_CONVERSATION_TITLES: usize = 1024;
+
+/// Gate for a sub-loop that runs at most once per `every` (checked each tick).
+#[derive(Debug, Default)]
+pub struct LoopTimer {
+    /// `None` = run every tick.
+    every: Option<Duration>,
+    last_run: Option<std::time::Instant>,
+}
+
+impl LoopTimer {
+    fn set_interval(&mut self, every_ms: Option<u64>) {
+        self.every = every_ms.map(Duration::from_millis);
+    }
+
+    /// True if the loop should run at `now`; records the run.
+    fn due(&mut self, now: std::time::Instant) -> bool {
+        if let (Some(every), Some(last)) = (self.every, self.last_run)
+            && now.duration_since(last) < every
+        {
+            return false;
+        }
+        self.last_run = Some(now);
+        true
+    }
+}
+
+/// Timers for the independently configurable sub-loops of poll_tick.
+#[derive(Debug, Default)]
+pub struct LoopTimers {
+    pub process_scan: LoopTimer,
+    pub jsonl_discovery: LoopTimer,
+    pub codex_appserver: LoopTimer,
+    pub git_scan: LoopTimer,
+}
+
+impl LoopTimers {
+    /// Apply new intervals, keeping each timer's last run (SIGHUP reload).
+    pub fn set_intervals(&mut self, loops: &LoopIntervals) {
+        self.process_scan.set_interval(loops.process_scan_ms);
+        self.jsonl_discovery.set_interval(loops.jsonl_discovery_ms);
+        self.codex_appserver.set_interval(loops.codex_appserver_ms);
+        self.git_scan.set_interval(loops.git_scan_ms);
+    }
 }
 
 impl DaemonState {
@@ -126,29 +285,111 @@ impl DaemonState {
             gateway_cursor: None,
             last_panes: Vec::new(),
             trust_guard,
+            allowed_uids: vec![uid],
+            access: AccessPolicy::default(),
+            audit: AuditLog::default(),
+            scheduler: Scheduler::default(),
+            send_policy: SendPolicy::default(),
+            redactor: Redactor::default(),
             source_registry: SourceRegistry::new(),
             cursor_watermarks: CursorWatermarks::new(),
             invalid_cursor_tracker: InvalidCursorTracker::new(),
-            latency_window: LatencyWindow::new(3000),
+            latency_window: LatencyWindow::new(Limits::default().latency_slo_ms),
             last_latency_eval: None,
             codex_capture_tracker: CodexCaptureTracker::new(),
             codex_appserver_client: None, // Spawned asynchronously in run_daemon
             codex_appserver_had_connection: false,
             codex_supervisor: SupervisorTracker::new(RestartPolicy::default()),
-            conversation_titles: std::collections::HashMap::new(),
+            conversation_titles: LruMap::new(MAX_CONVERSATION_TITLES),
+            aider_titles: AiderTitles::default(),
+            pane_adapters: std::collections::HashMap::new(),
+            plugin_verdicts: adapters::PluginVerdicts::default(),
+            pane_labels: std::collections::HashMap::new(),
+            pane_tasks: std::collections::HashMap::new(),
+            features: Features::default(),
+            limits: Limits::default(),
+            loop_timers: LoopTimers::default(),
+            process_map: Arc::default(),
+            git_meta: std::collections::HashMap::new(),
+            claude_jsonl_discoveries: Vec::new(),
+            exec_pool: ExecPool::new(Limits::default().exec_concurrency as usize),
+            pane_list_epoch: 0,
+            pane_list_cache: None,
+            started_at: std::time::Instant::now(),
+            notifier: Notifier::default(),
+            alerts: AlertEngine::default(),
+            github: ExitReporter::default(),
+            tmux: None,
+            action_refs: LruMap::new(actions::REQUEST_REF_CAPACITY),
+            launches: std::collections::HashMap::new(),
+            macros: Vec::new(),
+            responder: AutoResponder::default(),
+            restarter: Restarter::default(),
+            idle: IdleReaper::default(),
+            recorder: Recorder::default(),
+            groups: PaneGroups::default(),
+            pane_events: PaneEventLog::default(),
+            source_events: SourceEventLog::default(),
+            metrics: DaemonMetrics::default(),
+        }
+    }
+
+    /// Drop the cached pane list; call after changing any pane list input.
+    pub fn invalidate_pane_list(&mut self) {
+        self.pane_list_epoch += 1;
+    }
+
+    /// Record (or refresh) a conversation title, invalidating the pane list
+    /// if it changed.
+    fn set_conversation_title(&mut self, session_key: String, title: String) {
+        if self.conversation_titles.insert(session_key, title) {
+            self.invalidate_pane_list();
         }
     }
 }
 
 /// Run the daemon: starts poll loop and UDS server, waits for shutdown signal.
-pub async fn run_daemon(opts: DaemonOpts, socket_path: &str) -> anyhow::Result<()> {
-    let executor = Arc::new(build_executor(&opts));
+///
+/// On SIGHUP, `reload` re-resolves the config (file + env + original flags) and
+/// runtime-safe values are applied in place (see `DaemonConfig::apply_reload`).
+pub async fn run_daemon(
+    config: DaemonConfig,
+    reload: impl Fn() -> anyhow::Result<DaemonConfig>,
+) -> anyhow::Result<()> {
+    let mut config = config;
+    let socket_path = config.socket_path.clone();
+    let executor = Arc::new(build_executor(&config));
     let state = Arc::new(Mutex::new(DaemonState::new()));
+    {
+        let mut st = state.lock().await;
+        st.loop_timers.set_intervals(&config.loops);
+        st.limits = config.limits;
+        st.latency_window = LatencyWindow::new(config.limits.latency_slo_ms);
+        st.exec_pool = ExecPool::new(config.limits.exec_concurrency as usize);
+        st.features = config.features.clone();
+        if let Some(uids) = &config.allowed_uids {
+            st.allowed_uids = uids.clone();
+        }
+        st.access = AccessPolicy::new(&config.access);
+        st.send_policy = SendPolicy::new(&config.send_policy);
+        st.redactor = Redactor::new(&config.redact);
+        st.notifier = Notifier::new(config.notify_states.clone());
+        st.alerts = AlertEngine::new(config.alerts.clone(), config.email.clone());
+        st.github = ExitReporter::new(config.github.clone());
+        st.macros = config.macros.clone();
+        st.responder = AutoResponder::new(config.responder.clone());
+        st.restarter = Restarter::new(config.auto_restart.clone());
+        st.idle = IdleReaper::new(config.idle_timeout.clone());
+        st.recorder = Recorder::new(config.recorder.clone());
+        st.poller
+            .set_custom_adapters(adapters::compile_all(&config.adapters));
+        st.tmux = Some(Arc::clone(&executor) as Arc<dyn TmuxCommandRunner>);
+    }
 
     // Attempt initial Codex App Server connection.
     // If codex binary is not found or handshake fails, this is None — fallback path is used.
     // If connected, set had_connection so poll_tick will reconnect on death.
-    {
+    if config.features.is_enabled(features::CODEX_APPSERVER) {
         let client = CodexAppServerClient::spawn().await;
         let mut st = state.lock().await;
         if client.is_some() {
@@ -157,22 +398,90 @@ pub async fn run_daemon(opts: DaemonOpts, socket_path: &str) -> anyhow::Result<(
         st.codex_appserver_client = client;
     }
 
-    // Start UDS server
+    // Start UDS server; systemd is told we are ready once it listens.
     let server_state = Arc::clone(&state);
-    let server_socket = socket_path.to_string();
+    let server_socket = socket_path.clone();
+    let (listening_tx, listening_rx) = tokio::sync::oneshot::channel();
     let server_handle = tokio::spawn(async move {
-        if let Err(e) = server::run_server(&server_socket, server_state).await {
+        if let Err(e) = server::run_server(&server_socket, server_state, listening_tx).await {
             tracing::error!("UDS server error: {e}");
         }
     });
+    tokio::spawn(async move {
+        if listening_rx.await.is_ok() {
+            sd_notify::notify("READY=1");
+        }
+    });
+
+    // Prometheus listener; a configured address that cannot be bound is fatal.
+    if let Some(addr) = config.metrics_listen {
+        let listener = tokio::net::TcpListener::bind(addr)
+            .await
+            .map_err(|e| anyhow::anyhow!("metrics.listen {addr}: {e}"))?;
+        tracing::info!(%addr, "serving metrics");
+        tokio::spawn(metrics::serve(listener, Arc::clone(&state)));
+    }
+
+    // Remote REST listener; as for metrics, a configured one that cannot
+    // start is fatal.
+    if let Some(remote) = &config.remote {
+        let api = RemoteApi::load(remote)?;
+        let listener = tokio::net::TcpListener::bind(remote.addr)
+            .await
+            .map_err(|e| anyhow::anyhow!("remote.listen {}: {e}", remote.addr))?;
+        tracing::info!(addr = %remote.addr, tls = remote.tls.is_some(), "serving remote API");
+        tokio::spawn(remote_api::serve(listener, api, Arc::clone(&state)));
+    }
 
     // Start poll loop
     let poll_state = Arc::clone(&state);
     let poll_executor = Arc::clone(&executor);
-    let poll_ms = opts.poll_interval_ms;
-    let poll_handle = tokio::spawn(async move {
-        run_poll_loop(poll_executor, poll_state, poll_ms).await;
+    let (interval_tx, interval_rx) = tokio::sync::watch::channel(config.poll_interval_ms);
+    let heartbeat = Heartbeat::new();
+    let poll_heartbeat = heartbeat.clone();
+    let poll_interval_rx = interval_rx.clone();
+    let wake = Arc::new(Notify::new());
+    let poll_wake = Arc::clone(&wake);
+    let mut poll_handle = tokio::spawn(async move {
+        run_poll_loop(
+            poll_executor,
+            poll_state,
+            poll_interval_rx,
+            poll_wake,
+            poll_heartbeat,
+        )
+        .await;
     });
+    tokio::spawn(tmux_control::observe(
+        tmux_control::socket_args(config.tmux_socket.as_ref()),
+        Arc::clone(&state),
+        wake,
+    ));
+    let mut server_handle = server_handle;
+
+    // systemd watchdog: keepalive at half the timeout, withheld while the
+    // poll loop is wedged so systemd restarts the daemon.
+    if let Some(timeout) = sd_notify::watchdog_timeout() {
+        tracing::info!(
+            timeout_ms = timeout.as_millis() as u64,
+            "systemd watchdog enabled"
+        );
+        tokio::spawn(async move {
+            let mut ticker = interval(timeout / 2);
+            loop {
+                ticker.tick().await;
+                let poll_interval = Duration::from_millis(*interval_rx.borrow());
+                if sd_notify::loop_alive(heartbeat.age(), timeout, poll_interval) {
+                    sd_notify::notify("WATCHDOG=1");
+                } else {
+                    tracing::warn!(
+                        last_tick_ms = heartbeat.age().as_millis() as u64,
+                        "poll loop stalled; withholding watchdog keepalive"
+                    );
+                }
+            }
+        });
+    }
 
     // Wait for shutdown signal (ctrl-c or SIGTERM)
     let shutdown = async {
@@ -196,35 +505,163 @@ pub async fn run_daemon(opts: DaemonOpts, socket_path: &str) -> anyhow::Result<(
         }
     };
 
-    tokio::select! {
-        () = shutdown => {}
-        _ = poll_handle => {
-            tracing::warn!("poll loop exited unexpectedly");
-        }
-        _ = server_handle => {
-            tracing::warn!("server exited unexpectedly");
+    tokio::pin!(shutdown);
+
+    #[cfg(unix)]
+    let mut sighup = tokio::signal::unix::signal(tokio::signal::unix::SignalKind::hangup())
+        .expect("failed to register SIGHUP handler");
+
+    loop {
+        #[cfg(unix)]
+        let hup = sighup.recv();
+        #[cfg(not(unix))]
+        let hup = std::future::pending::<Option<()>>();
+
+        tokio::select! {
+            () = &mut shutdown => break,
+            _ = hup => {
+                tracing::info!("received SIGHUP, reloading config");
+                match reload() {
+                    Ok(new) => {
+                        let report = config.apply_reload(&new);
+                        if report.applied.contains(&"poll.interval_ms") {
+                            let _ = interval_tx.send(config.poll_interval_ms);
+                        }
+                        if report.applied.contains(&"poll.loops") {
+                            state.lock().await.loop_timers.set_intervals(&config.loops);
+                        }
+                        if report.applied.contains(&"limits") {
+                            state.lock().await.limits = config.limits;
+                        }
+                        if report.applied.contains(&"notify.states") {
+                            state.lock().await.notifier =
+                                Notifier::new(config.notify_states.clone());
+                        }
+                        if report.applied.contains(&"alerts") || report.applied.contains(&"email") {
+                            state
+                                .lock()
+                                .await
+                                .alerts
+                                .set_rules(config.alerts.clone(), config.email.clone());
+                        }
+                        if report.applied.contains(&"github") {
+                            state
+                                .lock()
+                                .await
+                                .github
+                                .set_settings(config.github.clone());
+                        }
+                        if report.applied.contains(&"macros") {
+                            state.lock().await.macros = config.macros.clone();
+                        }
+                        if report.applied.contains(&"responder") {
+                            state
+                                .lock()
+                                .await
+                                .responder
+                                .set_settings(config.responder.clone());
+                        }
+                        if report.applied.contains(&"auto_restart") {
+                            state
+                                .lock()
+                                .await
+                                .restarter
+                                .set_policies(config.auto_restart.clone());
+                        }
+                        if report.applied.contains(&"idle_timeout") {
+                            state
+                                .lock()
+                                .await
+                                .idle
+                                .set_policies(config.idle_timeout.clone());
+                        }
+                        if report.applied.contains(&"recorder") {
+                            state
+                                .lock()
+                                .await
+                                .recorder
+                                .set_settings(config.recorder.clone());
+                        }
+                        if report.applied.contains(&"adapters") {
+                            state
+                                .lock()
+                                .await
+                                .poller
+                                .set_custom_adapters(adapters::compile_all(&config.adapters));
+                        }
+                        if report.applied.contains(&"access") {
+                            state.lock().await.access = AccessPolicy::new(&config.access);
+                        }
+                        if report.applied.contains(&"send_policy") {
+                            state.lock().await.send_policy = SendPolicy::new(&config.send_policy);
+                        }
+                        if report.applied.contains(&"redact") {
+                            state.lock().await.redactor = Redactor::new(&config.redact);
+                        }
+                        if report.applied.contains(&"features") {
+                            reload_features(&state, config.features.clone()).await;
+                        }
+                        tracing::info!(applied = ?report.applied, "config reloaded");
+                        if !report.restart_required.is_empty() {
+                            tracing::warn!(
+                                keys = ?report.restart_required,
+                                "config changes require a daemon restart; keeping current values"
+                            );
+                        }
+                    }
+                    Err(e) => tracing::warn!("config reload failed, keeping current config: {e}"),
+                }
+            }
+            _ = &mut poll_handle => {
+                tracing::warn!("poll loop exited unexpectedly");
+                break;
+            }
+            _ = &mut server_handle => {
+                tracing::warn!("server exited unexpectedly");
+                break;
+            }
         }
     }
 
+    sd_notify::notify("STOPPING=1");
+
     // Cleanup socket
-    let _ = std::fs::remove_file(socket_path);
+    let _ = std::fs::remove_file(&socket_path);
     tracing::info!("daemon stopped");
     Ok(())
 }
 
-fn build_executor(opts: &DaemonOpts) -> TmuxExecutor {
-    let mut executor = TmuxExecutor::default();
-
-    // Socket targeting: --tmux-socket > AGTMUX_TMUX_SOCKET_PATH > AGTMUX_TMUX_SOCKET_NAME
-    if let Some(ref socket) = opts.tmux_socket {
-        executor = executor.with_socket_path(socket.clone());
-    } else if let Ok(path) = std::env::var("AGTMUX_TMUX_SOCKET_PATH") {
-        executor = executor.with_socket_path(path);
-    } else if let Ok(name) = std::env::var("AGTMUX_TMUX_SOCKET_NAME") {
-        executor = executor.with_socket_name(name);
+/// Apply `[features]` from a SIGHUP reload. Flags checked per tick (JSONL
+/// tailing, capture fallback, admission, debug metrics) follow on their own;
+/// the Codex App Server is started or dropped (closing its stdin) here, since
+/// poll_tick only reconnects a server that was already running.
+async fn reload_features(state: &Arc<Mutex<DaemonState>>, flags: Features) {
+    let appserver = flags.is_enabled(features::CODEX_APPSERVER);
+    let spawn = {
+        let mut st = state.lock().await;
+        st.features = flags;
+        if !appserver {
+            st.codex_appserver_client = None;
+            st.codex_appserver_had_connection = false;
+        }
+        appserver && st.codex_appserver_client.is_none() && !st.codex_appserver_had_connection
+    };
+    if spawn {
+        let client = CodexAppServerClient::spawn().await;
+        let mut st = state.lock().await;
+        st.codex_appserver_had_connection = client.is_some();
+        st.codex_appserver_client = client;
     }
+}
 
-    executor
+fn build_executor(config: &DaemonConfig) -> TmuxExecutor {
+    // Socket targeting precedence is resolved in DaemonConfig::resolve:
+    // --tmux-socket > AGTMUX_TMUX_SOCKET_PATH > AGTMUX_TMUX_SOCKET_NAME > config file
+    match &config.tmux_socket {
+        Some(TmuxSocket::Path(path)) => TmuxExecutor::default().with_socket_path(path.clone()),
+        Some(TmuxSocket::Name(name)) => TmuxExecutor::default().with_socket_name(name.clone()),
+        None => TmuxExecutor::default(),
+    }
 }
 
 /// Parse a gateway cursor string `"gw:{position}"` into a numeric position.
@@ -234,19 +671,33 @@ fn parse_gw_cursor(cursor: &str) -> Option<u64> {
         .and_then(|s| s.parse::<u64>().ok())
 }
 
+/// Tick `poll_tick` forever; the interval follows `interval_rx` (SIGHUP
+/// reload), and `wake` (`tmux_control`) runs a tick early, restarting the
+/// interval.
 async fn run_poll_loop<R: TmuxCommandRunner + 'static>(
     executor: Arc<R>,
     state: Arc<Mutex<DaemonState>>,
-    poll_ms: u64,
+    mut interval_rx: tokio::sync::watch::Receiver<u64>,
+    wake: Arc<Notify>,
+    heartbeat: Heartbeat,
 ) {
-    let mut ticker = interval(Duration::from_millis(poll_ms));
+    let mut ticker = interval(Duration::from_millis(*interval_rx.borrow()));
 
     loop {
-        ticker.tick().await;
-
+        tokio::select! {
+            _ = ticker.tick() => {}
+            () = wake.notified() => ticker.reset(),
+            Ok(()) = interval_rx.changed() => {
+                let poll_ms = *interval_rx.borrow();
+                tracing::info!(poll_ms, "poll interval changed");
+                ticker = interval(Duration::from_millis(poll_ms));
+                continue;
+            }
+        }
         if let Err(e) = poll_tick(&executor, &state).await {
             tracing::warn!("poll tick failed: {e}");
         }
+        heartbeat.beat();
     }
 }
 
@@ -257,10 +708,12 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     let tick_start = std::time::Instant::now();
     let now = Utc::now();
 
+    // Every subprocess below runs through the bounded exec pool.
+    let pool = Arc::clone(&state.lock().await.exec_pool);
+
     // 1. List panes (blocking subprocess)
     let exec = Arc::clone(executor);
-    let panes: Vec<TmuxPaneInfo> =
-        tokio::task::spawn_blocking(move || list_panes(&*exec)).await??;
+    let panes: Vec<TmuxPaneInfo> = pool.run(move || list_panes(&*exec)).await??;
 
     tracing::debug!("listed {} panes", panes.len());
 
@@ -269,52 +722,155 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
         let mut st = state.lock().await;
         let pane_ids: Vec<&str> = panes.iter().map(|p| p.pane_id.as_str()).collect();
         st.generation_tracker.update(&pane_ids, now);
-        st.last_panes = panes.clone();
+        let annotated = st.pane_labels.len() + st.pane_tasks.len() + st.launches.len();
+        st.pane_labels
+            .retain(|pane_id, _| pane_ids.contains(&pane_id.as_str()));
+        st.pane_tasks
+            .retain(|pane_id, _| pane_ids.contains(&pane_id.as_str()));
+        st.launches
+            .retain(|pane_id, _| pane_ids.contains(&pane_id.as_str()));
+        st.pane_adapters
+            .retain(|pane_id, _| pane_ids.contains(&pane_id.as_str()));
+        let regrouped = st.groups.retain_panes(&pane_ids);
+        if st.last_panes != panes
+            || st.pane_labels.len() + st.pane_tasks.len() + st.launches.len() != annotated
+            || regrouped
+        {
+            st.last_panes = panes.clone();
+            st.invalidate_pane_list();
+        }
     }
 
-    // 2.5. Scan all processes once per tick for deep agent identification (T-128).
+    // 2.5. Scan all processes for deep agent identification (T-128), at most once per
+    // `poll.process_scan_ms` (default: every tick); otherwise reuse the last scan.
     // Executed in a blocking thread to avoid starving the async runtime.
-    let process_map = tokio::task::spawn_blocking(scan_all_processes)
+    let scan_due = state
+        .lock()
         .await
-        .unwrap_or_default();
+        .loop_timers
+        .process_scan
+        .due(std::time::Instant::now());
+    let process_map = if scan_due {
+        // Recycle the previous scan's entries; no tick holds it any more.
+        let previous = std::mem::take(&mut state.lock().await.process_map);
+        let previous = Arc::try_unwrap(previous).unwrap_or_default();
+        let map = Arc::new(
+            pool.run(move || rescan_processes(previous))
+                .await
+                .unwrap_or_default(),
+        );
+        state.lock().await.process_map = Arc::clone(&map);
+        map
+    } else {
+        Arc::clone(&state.lock().await.process_map)
+    };
 
-    // 3. Capture each pane and build snapshots
-    let mut snapshots = Vec::with_capacity(panes.len());
+    // 2.6. Resolve git repo / branch of pane directories (`poll.git_scan_ms`).
+    let git_due = state
+        .lock()
+        .await
+        .loop_timers
+        .git_scan
+        .due(std::time::Instant::now());
+    if git_due {
+        let paths: Vec<String> = panes.iter().map(|p| p.current_path.clone()).collect();
+        let meta = pool
+            .run(move || git_meta::scan(paths.iter().map(String::as_str)))
+            .await
+            .unwrap_or_default();
+        let mut st = state.lock().await;
+        if st.git_meta != meta {
+            st.git_meta = meta;
+            st.invalidate_pane_list();
+        }
+    }
 
-    for pane in &panes {
+    // 3. Capture each pane (concurrently, bounded by the exec pool) and build snapshots
+    let Limits {
+        capture_lines,
+        pull_limit,
+        ..
+    } = state.lock().await.limits;
+
+    let mut captures = tokio::task::JoinSet::new();
+    for (index, pane) in panes.iter().enumerate() {
         let exec = Arc::clone(executor);
+        let pool = Arc::clone(&pool);
         let pane_id = pane.pane_id.clone();
+        captures.spawn(async move {
+            let result = pool
+                .run(move || capture_pane(&*exec, &pane_id, capture_lines))
+                .await;
+            (index, result)
+        });
+    }
+    let mut captured = vec![Vec::new(); panes.len()];
+    while let Some(joined) = captures.join_next().await {
+        let Ok((index, result)) = joined else {
+            continue;
+        };
+        match result {
+            Ok(Ok(lines)) => captured[index] = lines,
+            Ok(Err(e)) => tracing::debug!("capture failed for {}: {e}", panes[index].pane_id),
+            Err(e) => {
+                tracing::debug!("capture task failed for {}: {e}", panes[index].pane_id);
+            }
+        }
+    }
 
-        let capture_lines =
-            match tokio::task::spawn_blocking(move || capture_pane(&*exec, &pane_id, 50)).await {
-                Ok(Ok(lines)) => lines,
-                Ok(Err(e)) => {
-                    tracing::debug!("capture failed for {}: {e}", pane.pane_id);
-                    Vec::new()
-                }
-                Err(e) => {
-                    tracing::debug!("capture task failed for {}: {e}", pane.pane_id);
-                    Vec::new()
-                }
-            };
-
+    let snapshots: Vec<_> = {
         let st = state.lock().await;
-        let snapshot = to_pane_snapshot(
-            pane,
-            capture_lines,
-            &st.generation_tracker,
-            now,
-            Some(&process_map),
-        );
-        drop(st);
-        snapshots.push(snapshot);
+        panes
+            .iter()
+            .zip(captured)
+            .map(|(pane, lines)| {
+                to_pane_snapshot(pane, lines, &st.generation_tracker, now, Some(&process_map))
+            })
+            .collect()
+    };
+
+    // 3a. Plugin adapters: run the command of each claimed pane whose
+    // observation changed (through the exec pool), reuse earlier verdicts
+    // for the rest.
+    let (mut verdicts, jobs) = {
+        let mut st = state.lock().await;
+        let DaemonState {
+            poller,
+            plugin_verdicts,
+            ..
+        } = &mut *st;
+        plugin_verdicts.plan(poller.custom_adapters(), &snapshots)
+    };
+    let mut plugin_runs = tokio::task::JoinSet::new();
+    for job in jobs {
+        let pool = Arc::clone(&pool);
+        plugin_runs.spawn(async move {
+            let verdict = pool.run({
+                let job = job.clone();
+                move || job.run()
+            });
+            (job, verdict.await)
+        });
+    }
+    let mut ran = Vec::new();
+    while let Some(joined) = plugin_runs.join_next().await {
+        if let Ok((job, Ok(verdict))) = joined {
+            ran.push((job, verdict));
+        }
     }
 
     // 4. Process through pipeline
     let mut st = state.lock().await;
+    for (job, verdict) in ran {
+        verdicts.insert(job.pane_id.clone(), verdict.clone());
+        st.plugin_verdicts.record(&job, verdict);
+    }
+    st.poller.set_plugin_verdicts(verdicts);
 
-    // 5. Poll batch for agent detection
-    st.poller.poll_batch(&snapshots);
+    // 5. Poll batch for agent detection (only panes whose observation changed
+    // are emitted; unchanged ones resync every RESYNC_INTERVAL_SECS)
+    let emitted = st.poller.poll_batch(&snapshots);
+    tracing::debug!("poller emitted {emitted}/{} panes", snapshots.len());
 
     // 6. Identify agent vs unmanaged panes (for logging)
     let agent_pane_ids: HashSet<String> = snapshots
@@ -339,8 +895,22 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     let appserver_poll_result = {
         let mut client_taken = st.codex_appserver_client.take();
         let alive = client_taken.as_mut().is_some_and(|c| c.is_alive());
-        if alive {
+        if alive
+            && !st
+                .loop_timers
+                .codex_appserver
+                .due(std::time::Instant::now())
+        {
+            // Not due (`poll.codex_appserver_ms`): still counts as App Server mode,
+            // so the capture fallback stays off.
+            st.codex_appserver_client = client_taken;
+            Some(Vec::new())
+        } else if alive {
             // T-119: Build pane cwd info for thread ↔ pane correlation
+            let hints: std::collections::HashMap<&str, &Option<String>> = snapshots
+                .iter()
+                .map(|s| (s.pane_id.as_str(), &s.process_hint))
+                .collect();
             let pane_cwds: Vec<PaneCwdInfo> = st
                 .last_panes
                 .iter()
@@ -351,10 +921,9 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
                         cwd: pane.current_path.clone(),
                         generation: gen_info.map(|(g, _)| g),
                         birth_ts: gen_info.map(|(_, ts)| ts),
-                        process_hint: snapshots
-                            .iter()
-                            .find(|s| s.pane_id == pane.pane_id)
-                            .and_then(|s| s.process_hint.clone()),
+                        process_hint: hints
+                            .get(pane.pane_id.as_str())
+                            .and_then(|hint| (*hint).clone()),
                     }
                 })
                 .collect();
@@ -445,15 +1014,14 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
                 .filter(|s| !s.is_empty())
                 .or_else(|| event.payload["preview"].as_str().filter(|s| !s.is_empty()));
             if let Some(t) = title {
-                st.conversation_titles
-                    .insert(event.session_id.clone(), t.to_string());
+                st.set_conversation_title(event.session_id.clone(), t.to_string());
             }
             st.codex_source.ingest(event);
         }
     }
 
     // Fallback: parse Codex NDJSON from tmux capture text (only when App Server unavailable)
-    if !used_appserver {
+    if !used_appserver && st.features.is_enabled(features::CODEX_CAPTURE_FALLBACK) {
         let active_pane_ids: Vec<&str> = panes.iter().map(|p| p.pane_id.as_str()).collect();
         st.codex_capture_tracker.retain_panes(&active_pane_ids);
 
@@ -499,7 +1067,7 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     //   - process_hint="codex":  handled by Step 6a
     //   - process_hint=None + current_cmd NOT in allowlist (yazi, htop, vim, …)
     //   - any other unknown hint: fail-closed
-    {
+    if st.features.is_enabled(features::CLAUDE_JSONL) {
         /// Neutral-runtime commands that can host a Claude JSONL session.
         /// Panes with process_hint=None are only included if current_cmd matches.
         /// This prevents false-positive Claude attribution for terminal tools
@@ -516,12 +1084,8 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
             .map(|s| (s.pane_id.as_str(), s.current_cmd.as_str()))
             .collect();
 
-        let candidate_pane_cwds: Vec<(
-            String,
-            String,
-            Option<u64>,
-            Option<chrono::DateTime<chrono::Utc>>,
-        )> = panes
+        // (pane_id, cwd, generation, birth_ts), as `discover_sessions` takes them.
+        let candidate_pane_cwds: Vec<_> = panes
             .iter()
             .filter(|p| {
                 let hint = snapshot_hint.get(p.pane_id.as_str()).copied().flatten();
@@ -555,7 +1119,22 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
             .collect();
 
         if !candidate_pane_cwds.is_empty() {
-            let discoveries = ClaudeJsonlSourceState::discover_sessions(&candidate_pane_cwds);
+            // Discovery scans ~/.claude/projects; between runs (`poll.jsonl_discovery_ms`)
+            // keep polling the known transcripts of panes that are still candidates.
+            let discoveries = if st
+                .loop_timers
+                .jsonl_discovery
+                .due(std::time::Instant::now())
+            {
+                ClaudeJsonlSourceState::discover_sessions(&candidate_pane_cwds)
+            } else {
+                st.claude_jsonl_discoveries
+                    .iter()
+                    .filter(|d| candidate_pane_cwds.iter().any(|c| c.0 == d.pane_id))
+                    .cloned()
+                    .collect()
+            };
+            st.claude_jsonl_discoveries.clone_from(&discoveries);
             // Use Utc::now() (not poll_tick's `now`) so the bootstrap event's observed_at
             // is guaranteed to be AFTER the Codex App Server events (which also use Utc::now()
             // during their async network call in Step 6a).  This ensures
@@ -577,7 +1156,7 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
                 })
                 .collect();
             for (session_id, title) in title_updates {
-                st.conversation_titles.insert(session_id, title);
+                st.set_conversation_title(session_id, title);
             }
             for event in jsonl_events {
                 st.claude_jsonl_source.ingest(event);
@@ -592,11 +1171,13 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
         .map(String::from);
     let pull_request = PullEventsRequest {
         cursor: poller_cursor,
-        limit: 500,
+        limit: pull_limit,
     };
     let poller_response = st.poller.pull_events(&pull_request, now);
 
     // 8. Ingest into gateway
+    st.metrics
+        .count_events(SourceKind::Poller.as_str(), poller_response.events.len());
     st.gateway
         .ingest_source_response(SourceKind::Poller, poller_response);
 
@@ -608,10 +1189,14 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     let codex_response = st.codex_source.pull_events(
         &PullEventsRequest {
             cursor: codex_cursor,
-            limit: 500,
+            limit: pull_limit,
         },
         now,
     );
+    st.metrics.count_events(
+        SourceKind::CodexAppserver.as_str(),
+        codex_response.events.len(),
+    );
     st.gateway
         .ingest_source_response(SourceKind::CodexAppserver, codex_response);
 
@@ -623,10 +1208,14 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     let claude_response = st.claude_source.pull_events(
         &PullEventsRequest {
             cursor: claude_cursor,
-            limit: 500,
+            limit: pull_limit,
         },
         now,
     );
+    st.metrics.count_events(
+        SourceKind::ClaudeHooks.as_str(),
+        claude_response.events.len(),
+    );
     st.gateway
         .ingest_source_response(SourceKind::ClaudeHooks, claude_response);
 
@@ -638,17 +1227,21 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     let jsonl_response = st.claude_jsonl_source.pull_events(
         &PullEventsRequest {
             cursor: jsonl_cursor,
-            limit: 500,
+            limit: pull_limit,
         },
         now,
     );
+    st.metrics.count_events(
+        SourceKind::ClaudeJsonl.as_str(),
+        jsonl_response.events.len(),
+    );
     st.gateway
         .ingest_source_response(SourceKind::ClaudeJsonl, jsonl_response);
 
     // 9. Pull from gateway
     let gw_request = GatewayPullRequest {
         cursor: st.gateway_cursor.clone(),
-        limit: 500,
+        limit: pull_limit,
     };
     let gw_response = st.gateway.pull_events(&gw_request);
 
@@ -692,13 +1285,228 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
     // 10. Apply to daemon
     if !gw_response.events.is_empty() {
         tracing::debug!("applying {} events to daemon", gw_response.events.len());
+        st.source_events.record(&gw_response.events);
+        // Custom adapters report their name and label in the payload.
+        for event in &gw_response.events {
+            let Some(pane_id) = &event.pane_id else {
+                continue;
+            };
+            if event.provider != Provider::Custom {
+                st.pane_adapters.remove(pane_id);
+                continue;
+            }
+            if let Some(adapter) = event.payload["adapter"].as_str()
+                && st.pane_adapters.get(pane_id).map(String::as_str) != Some(adapter)
+            {
+                st.pane_adapters
+                    .insert(pane_id.clone(), adapter.to_string());
+            }
+            if let Some(label) = event.payload["label"].as_str() {
+                st.set_conversation_title(event.session_key.clone(), label.to_string());
+            }
+        }
         st.daemon.apply_events(gw_response.events, now);
+        st.invalidate_pane_list();
+    }
+
+    // 10a. Aider conversation titles from `.aider.chat.history.md` in the
+    // pane's directory or its git root.
+    {
+        let st = &mut *st;
+        let mut titles = Vec::new();
+        let mut dirs_seen = Vec::new();
+        for pane in st.daemon.list_panes() {
+            if pane.provider != Some(Provider::Aider) {
+                continue;
+            }
+            let pane_id = &pane.pane_instance_id.pane_id;
+            let Some(info) = st.last_panes.iter().find(|t| &t.pane_id == pane_id) else {
+                continue;
+            };
+            let root = st
+                .git_meta
+                .get(&info.current_path)
+                .and_then(Option::as_ref)
+                .map_or("", |g| g.repo.as_str());
+            let dirs = [info.current_path.as_str(), root];
+            dirs_seen.extend(dirs);
+            if let Some(title) = st.aider_titles.title_for(&dirs) {
+                titles.push((pane.session_key.clone(), title));
+            }
+        }
+        st.aider_titles.retain(&dirs_seen);
+        for (session_key, title) in titles {
+            st.set_conversation_title(session_key, title);
+        }
     }
 
     // 10b. Tick freshness: downgrade stale deterministic panes to heuristic.
     // This ensures panes whose deterministic source stopped emitting events
     // (e.g. Codex exited, Claude idle) correctly fall back to heuristic.
-    st.daemon.tick_freshness(now);
+    // The poller only emits changes, so have it re-emit every pane next tick
+    // to hand the downgraded panes their current heuristic state.
+    if st.daemon.tick_freshness(now) > 0 {
+        st.poller.resync();
+    }
+
+    // 10c. Desktop notifications for panes that entered a `[notify]` state,
+    // sent through the exec pool without holding the lock.
+    let notices = {
+        let st = &mut *st;
+        st.notifier
+            .observe(&st.daemon.list_panes(), &st.last_panes, &st.pane_tasks)
+    };
+    if !notices.is_empty() {
+        let pool = Arc::clone(&st.exec_pool);
+        tokio::spawn(async move {
+            for notice in notices {
+                let _ = pool.run(move || notice.send()).await;
+            }
+        });
+    }
+
+    // 10d. `[[alerts]]` rules: fire alerts whose state / duration condition
+    // is met and run their actions the same way.
+    let actions = {
+        let st = &mut *st;
+        st.alerts
+            .evaluate(&st.daemon.list_panes(), &st.last_panes, &st.pane_tasks, now)
+    };
+    if !actions.is_empty() {
+        let pool = Arc::clone(&st.exec_pool);
+        tokio::spawn(async move {
+            for action in actions {
+                let _ = pool.run(move || action.run()).await;
+            }
+        });
+    }
+
+    // 10e. `[github]`: post for runtimes that exited, with the last output
+    // captured while they were running.
+    let posts = {
+        let st = &mut *st;
+        for snapshot in &snapshots {
+            st.github
+                .record_output(&snapshot.pane_id, &snapshot.capture_lines, &st.redactor);
+        }
+        st.github
+            .observe(&st.daemon.list_panes(), &st.last_panes, &st.git_meta, now)
+    };
+    if !posts.is_empty() {
+        let pool = Arc::clone(&st.exec_pool);
+        tokio::spawn(async move {
+            for post in posts {
+                let _ = pool.run(move || post.run()).await;
+            }
+        });
+    }
+
+    // 10f. `[responder]`: answer approval prompts matching a rule by typing
+    // into the pane, off the lock.
+    let keystrokes = {
+        let st = &mut *st;
+        let captures: HashMap<&str, &[String]> = snapshots
+            .iter()
+            .map(|s| (s.pane_id.as_str(), s.capture_lines.as_slice()))
+            .collect();
+        st.responder.observe(
+            &st.daemon.list_panes(),
+            &st.last_panes,
+            &st.pane_labels,
+            &captures,
+            now,
+        )
+    };
+    for keystroke in keystrokes {
+        let exec = Arc::clone(executor);
+        let pool = Arc::clone(&st.exec_pool);
+        tokio::spawn(async move {
+            let pane_id = keystroke.pane_id;
+            let args = keystroke.args;
+            let sent = pool
+                .run(move || {
+                    let args: Vec<&str> = args.iter().map(String::as_str).collect();
+                    exec.run(&args)
+                })
+                .await;
+            if let Ok(Err(e)) = sent {
+                tracing::warn!("auto-responder send to {pane_id} failed: {e}");
+            }
+        });
+    }
+
+    // 10g. `[[auto_restart]]`: respawn dead agent panes whose backoff is up.
+    let respawns = {
+        let st = &mut *st;
+        st.restarter.observe(
+            &st.daemon.list_panes(),
+            &st.last_panes,
+            &st.pane_labels,
+            now,
+        )
+    };
+    for respawn in respawns {
+        let exec = Arc::clone(executor);
+        let pool = Arc::clone(&st.exec_pool);
+        tokio::spawn(async move {
+            let pane_id = respawn.pane_id;
+            let args = respawn.args;
+            let ran = pool
+                .run(move || {
+                    let args: Vec<&str> = args.iter().map(String::as_str).collect();
+                    exec.run(&args)
+                })
+                .await;
+            if let Ok(Err(e)) = ran {
+                tracing::warn!("auto-restart of {pane_id} failed: {e}");
+            }
+        });
+    }
+
+    // 10h. `[[idle_timeout]]`: notify, send a key to or kill panes idle for
+    // too long.
+    let idle_actions = {
+        let st = &mut *st;
+        st.idle.observe(
+            &st.daemon.list_panes(),
+            &st.last_panes,
+            &st.pane_labels,
+            now,
+        )
+    };
+    for action in idle_actions {
+        let exec = Arc::clone(executor);
+        let pool = Arc::clone(&st.exec_pool);
+        tokio::spawn(async move {
+            match action {
+                IdleAction::Notify(notice) => {
+                    let _ = pool.run(move || notice.send()).await;
+                }
+                IdleAction::Tmux { pane_id, args } => {
+                    let ran = pool
+                        .run(move || {
+                            let args: Vec<&str> = args.iter().map(String::as_str).collect();
+                            exec.run(&args)
+                        })
+                        .await;
+                    if let Ok(Err(e)) = ran {
+                        tracing::warn!("idle timeout action on {pane_id} failed: {e}");
+                    }
+                }
+            }
+        });
+    }
+
+    // 10i. Diff the pane list into `pane.*` delta events for `watch`.
+    let panes = crate::server::observed_pane_list(&mut st);
+
+    // 10j. Scheduled sends that are due; each runs as a fresh `pane.send`.
+    for scheduled in st.scheduler.take_due(now) {
+        tokio::spawn(schedule::run(Arc::clone(state), scheduled));
+    }
+
+    // 10k. `[recorder]`: append new pane output to the recordings on disk.
+    recorder::tick(state, &mut st, &panes, tick_start);
 
     // 11. Compact consumed events to prevent unbounded memory growth.
     // Poller: trim events up to the gateway's source cursor.
@@ -749,6 +1557,7 @@ async fn poll_tick<R: TmuxCommandRunner + 'static>(
 
     // 12. Record tick latency and evaluate SLO
     let tick_ms = tick_start.elapsed().as_millis() as u64;
+    st.metrics.observe_tick(tick_start.elapsed());
     let now_ms = now.timestamp_millis() as u64;
     st.latency_window.record(tick_ms, now_ms);
     let eval = st.latency_window.evaluate(now_ms);
@@ -913,6 +1722,78 @@ mod tests {
         assert_eq!(managed.len(), 1, "codex pane should be managed");
     }
 
+    #[tokio::test]
+    async fn poll_tick_tracks_custom_adapter_panes() {
+        let backend = Arc::new(FakeTmuxBackend::new().with_pane(
+            "%0",
+            "work",
+            "devbot",
+            "task: migrate billing\n[working] step 2",
+        ));
+        let state = new_state();
+        let def = adapters::AdapterDef {
+            name: "devbot".to_string(),
+            process: "^devbot$".to_string(),
+            running: vec![r"^\[working\]".to_string()],
+            idle: Vec::new(),
+            waiting_input: Vec::new(),
+            waiting_approval: Vec::new(),
+            error: Vec::new(),
+            label: Some("^task: (.+)".to_string()),
+            command: Vec::new(),
+            sha256: Vec::new(),
+            allow_unverified: false,
+        };
+        state
+            .lock()
+            .await
+            .poller
+            .set_custom_adapters(adapters::compile_all(&[def]));
+
+        poll_tick(&backend, &state)
+            .await
+            .expect("tick should succeed");
+
+        let st = state.lock().await;
+        let managed = st.daemon.list_panes();
+        assert_eq!(managed.len(), 1, "devbot pane should be managed");
+        assert_eq!(managed[0].provider, Some(Provider::Custom));
+        assert_eq!(
+            managed[0].activity_state,
+            agtmux_core_v5::types::ActivityState::Running
+        );
+        assert_eq!(
+            st.pane_adapters.get("%0").map(String::as_str),
+            Some("devbot")
+        );
+        assert_eq!(
+            st.conversation_titles
+                .get(&managed[0].session_key)
+                .map(String::as_str),
+            Some("migrate billing")
+        );
+    }
+
+    #[tokio::test]
+    async fn poll_tick_skips_unchanged_panes() {
+        let backend = Arc::new(FakeTmuxBackend::new().with_pane(
+            "%0",
+            "main",
+            "claude",
+            "╭ Claude Code\n│ Working...",
+        ));
+        let state = new_state();
+
+        poll_tick(&backend, &state).await.expect("first tick");
+        let cursor = state.lock().await.gateway_cursor.clone();
+        assert!(cursor.is_some());
+        poll_tick(&backend, &state).await.expect("second tick");
+
+        let st = state.lock().await;
+        assert_eq!(st.gateway_cursor, cursor, "no events for an unchanged pane");
+        assert_eq!(st.daemon.list_panes().len(), 1);
+    }
+
     #[tokio::test]
     async fn poll_tick_unmanaged_pane_tracked() {
         let backend =
@@ -932,6 +1813,29 @@ mod tests {
         assert_eq!(st.last_panes[0].pane_id, "%0");
     }
 
+    #[tokio::test]
+    async fn poll_tick_drops_labels_for_vanished_panes() {
+        let backend =
+            Arc::new(FakeTmuxBackend::new().with_pane("%0", "main", "zsh", "$ ls\nfile.txt"));
+        let state = new_state();
+        {
+            let mut st = state.lock().await;
+            st.pane_labels.insert("%0".to_string(), "keep".to_string());
+            st.pane_labels.insert("%9".to_string(), "gone".to_string());
+        }
+
+        poll_tick(&backend, &state)
+            .await
+            .expect("tick should succeed");
+
+        let st = state.lock().await;
+        assert_eq!(st.pane_labels.get("%0").map(String::as_str), Some("keep"));
+        assert!(
+            !st.pane_labels.contains_key("%9"),
+            "label of closed pane dropped"
+        );
+    }
+
     #[tokio::test]
     async fn poll_tick_mixed_agents_and_unmanaged() {
         let backend = Arc::new(
@@ -1266,6 +2170,102 @@ mod tests {
         );
     }
 
+    // ── Sub-loop timers ──────────────────────────────────────────────
+
+    #[test]
+    fn loop_timer_runs_every_tick_by_default() {
+        let mut timer = LoopTimer::default();
+        let t0 = std::time::Instant::now();
+        assert!(timer.due(t0));
+        assert!(timer.due(t0), "no interval = every call");
+    }
+
+    #[test]
+    fn loop_timer_respects_interval_across_reload() {
+        let mut timers = LoopTimers::default();
+        timers.set_intervals(&LoopIntervals {
+            process_scan_ms: Some(2000),
+            ..Default::default()
+        });
+        let t0 = std::time::Instant::now();
+        assert!(timers.process_scan.due(t0), "first run is immediate");
+        assert!(!timers.process_scan.due(t0 + Duration::from_millis(1000)));
+        assert!(timers.process_scan.due(t0 + Duration::from_millis(2000)));
+        assert!(timers.jsonl_discovery.due(t0), "unset loops run every tick");
+
+        // Reload keeps the last run: a longer interval delays the next run.
+        timers.set_intervals(&LoopIntervals {
+            process_scan_ms: Some(5000),
+            ..Default::default()
+        });
+        assert!(!timers.process_scan.due(t0 + Duration::from_millis(4000)));
+        assert!(timers.process_scan.due(t0 + Duration::from_millis(7000)));
+    }
+
+    #[tokio::test]
+    async fn poll_tick_reuses_process_map_when_scan_not_due() {
+        let backend =
+            Arc::new(FakeTmuxBackend::new().with_pane("%1", "main", "claude", "Claude Code v1.0"));
+        let state = new_state();
+        state
+            .lock()
+            .await
+            .loop_timers
+            .set_intervals(&LoopIntervals {
+                process_scan_ms: Some(3_600_000),
+                ..Default::default()
+            });
+        poll_tick(&backend, &state).await.expect("tick 1");
+        // Replace the cached scan; a non-due tick must keep the cached value.
+        state.lock().await.process_map = Arc::default();
+        poll_tick(&backend, &state).await.expect("tick 2");
+        assert!(state.lock().await.process_map.is_empty(), "scan not re-run");
+    }
+
+    // ── Feature flags ────────────────────────────────────────────────
+
+    #[tokio::test]
+    async fn reload_features_stops_the_codex_appserver() {
+        let state = new_state();
+        state.lock().await.codex_appserver_had_connection = true;
+        let section = [
+            (features::CODEX_APPSERVER.to_string(), false),
+            (features::DEBUG_METRICS.to_string(), true),
+        ]
+        .into();
+        reload_features(&state, Features::resolve(&section).expect("known feature")).await;
+
+        let st = state.lock().await;
+        assert!(st.features.is_enabled(features::DEBUG_METRICS));
+        assert!(st.codex_appserver_client.is_none());
+        assert!(
+            !st.codex_appserver_had_connection,
+            "poll_tick must not reconnect a disabled server"
+        );
+    }
+
+    #[tokio::test]
+    async fn poll_tick_codex_capture_fallback_follows_feature_flag() {
+        let line = r#"{"type":"turn.started","thread_id":"t-1"}"#;
+        for enabled in [true, false] {
+            let backend = Arc::new(FakeTmuxBackend::new().with_pane("%0", "main", "codex", line));
+            let state = new_state();
+            let section = [(features::CODEX_CAPTURE_FALLBACK.to_string(), enabled)].into();
+            state.lock().await.features = Features::resolve(&section).expect("known feature");
+
+            poll_tick(&backend, &state).await.expect("tick");
+
+            // The tracker dedups lines already ingested by the tick.
+            let mut st = state.lock().await;
+            let replay = parse_codex_capture_events(
+                &[line.to_string()],
+                "%0",
+                &mut st.codex_capture_tracker,
+            );
+            assert_eq!(replay.is_empty(), enabled, "fallback enabled={enabled}");
+        }
+    }
+
     // ── T-118: Latency window integration tests ──────────────────────
 
     #[tokio::test]
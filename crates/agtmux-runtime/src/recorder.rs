@@ -0,0 +1,959 @@
+//! `[recorder]`: opt-in recording of pane output to disk, for scrollback
+//! beyond tmux's `history-limit` and for reading what a pane printed after
+//! it was killed (`recording.list`, `recording.replay`, `agtmux recording`).
+//!
+//! Every `interval_secs` the daemon captures the last `lines` rows of each
+//! recorded pane (managed agent panes, or every pane with `all_panes`). Rows
+//! that scrolled into tmux history since the previous capture are appended
+//! to the recording; history only grows at the bottom, so the overlap with
+//! the previous capture tells where new output starts. A capture sharing no
+//! rows with the previous one (more than `lines` rows printed in one
+//! interval, `clear-history`, a daemon restart) is written whole and
+//! flagged as a gap. The visible screen is held in memory and written when
+//! the pane goes away, so a recording ends with the last screen; full-screen
+//! programs on the alternate screen leave no history and only that is kept.
+//!
+//! With `backend = "pipe-pane"` the output comes from `tmux pipe-pane`
+//! instead (see `pane_pipe`): every byte the pane prints, as it is printed,
+//! without the polling. The periodic capture then only keeps the screen.
+//!
+//! Recordings are per runtime (pane id plus birth time, so a reused pane id
+//! starts a new one): `<dir>/<runtime>/meta.json` and JSON-lines segments
+//! `<unix_ms>.jsonl.gz`, one gzip member per write, rotated past
+//! [`SEGMENT_BYTES`]. Runtimes not written to for `retention_days` are
+//! deleted.
+
+use std::collections::HashMap;
+use std::io::{BufRead, BufReader, Write};
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+use agtmux_tmux_v5::TmuxCommandRunner;
+use chrono::{DateTime, Utc};
+use flate2::Compression;
+use flate2::read::MultiGzDecoder;
+use flate2::write::GzEncoder;
+use serde_json::Value;
+use tokio::sync::{Mutex, oneshot};
+
+use crate::actions::{self, ActionError};
+use crate::audit;
+use crate::exec_pool::ExecPool;
+use crate::pane_pipe;
+use crate::paths::data_dir;
+use crate::poll_loop::DaemonState;
+
+/// Default `recorder.interval_secs`.
+pub const DEFAULT_INTERVAL_SECS: u64 = 10;
+/// Default `recorder.lines`.
+pub const DEFAULT_LINES: u32 = 1000;
+/// Default `recorder.retention_days`.
+pub const DEFAULT_RETENTION_DAYS: u64 = 7;
+const MAX_LINES: u32 = 10_000;
+/// A segment is closed once it grows past this many (compressed) bytes.
+pub const SEGMENT_BYTES: u64 = 1 << 20;
+/// Rows one `recording.replay` returns at most; older rows are dropped.
+pub const MAX_REPLAY_LINES: usize = 50_000;
+/// Bytes of `pipe-pane` output one raw `recording.replay` returns at most.
+pub const MAX_REPLAY_RAW: usize = 8 << 20;
+/// Expired recordings are looked for at most this often.
+const PRUNE_EVERY: Duration = Duration::from_secs(3600);
+
+/// Where recorded output comes from.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum Backend {
+    /// Diff periodic `capture-pane` snapshots: rows, no escape sequences.
+    #[default]
+    Capture,
+    /// Raw output streamed by `tmux pipe-pane` through a FIFO.
+    PipePane,
+}
+
+impl Backend {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Capture => "capture",
+            Self::PipePane => "pipe-pane",
+        }
+    }
+}
+
+/// `[recorder]` section.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct RecorderSettings {
+    /// Off unless set.
+    pub enabled: bool,
+    /// `capture` (default) or `pipe-pane`.
+    pub backend: Backend,
+    /// Recordings directory; default `<data_dir>/recordings`.
+    pub dir: Option<PathBuf>,
+    /// Seconds between captures; default [`DEFAULT_INTERVAL_SECS`].
+    pub interval_secs: Option<u64>,
+    /// Rows captured per pane; more output than this between two captures
+    /// leaves a gap. Default [`DEFAULT_LINES`].
+    pub lines: Option<u32>,
+    /// Record every tmux pane, not only managed agent panes.
+    pub all_panes: bool,
+    /// Days a recording is kept after its last write; default
+    /// [`DEFAULT_RETENTION_DAYS`].
+    pub retention_days: Option<u64>,
+}
+
+impl RecorderSettings {
+    pub fn validate(&self) -> anyhow::Result<()> {
+        if self.interval_secs == Some(0) {
+            anyhow::bail!("recorder.interval_secs must be > 0");
+        }
+        if let Some(lines) = self.lines
+            && !(1..=MAX_LINES).contains(&lines)
+        {
+            anyhow::bail!("recorder.lines must be 1..={MAX_LINES}");
+        }
+        if self.retention_days == Some(0) {
+            anyhow::bail!("recorder.retention_days must be > 0");
+        }
+        if self.dir.as_ref().is_some_and(|dir| !dir.is_absolute()) {
+            anyhow::bail!("recorder.dir must be an absolute path");
+        }
+        if self.enabled && self.dir().is_none() {
+            anyhow::bail!("recorder.dir must be set when neither XDG_DATA_HOME nor HOME is");
+        }
+        Ok(())
+    }
+
+    /// Recordings directory; `None` only without a data dir.
+    pub fn dir(&self) -> Option<PathBuf> {
+        self.dir
+            .clone()
+            .or_else(|| data_dir().map(|dir| dir.join("recordings")))
+    }
+
+    pub fn interval_secs(&self) -> u64 {
+        self.interval_secs.unwrap_or(DEFAULT_INTERVAL_SECS)
+    }
+
+    pub fn lines(&self) -> u32 {
+        self.lines.unwrap_or(DEFAULT_LINES)
+    }
+
+    pub fn retention_days(&self) -> u64 {
+        self.retention_days.unwrap_or(DEFAULT_RETENTION_DAYS)
+    }
+}
+
+/// Recording name of a pane runtime: `3-20261015T070000` for `%3` born at
+/// 07:00:00 UTC.
+pub fn runtime_id(pane_id: &str, birth_ts: DateTime<Utc>) -> String {
+    format!(
+        "{}-{}",
+        pane_id.trim_start_matches('%'),
+        birth_ts.format("%Y%m%dT%H%M%S")
+    )
+}
+
+/// Runtime names are generated by [`runtime_id`]; anything else (`..`,
+/// `/`) is rejected before it reaches the filesystem.
+fn valid_runtime(runtime: &str) -> bool {
+    !runtime.is_empty()
+        && runtime
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '-')
+}
+
+/// Rows of `history` that follow the previous capture's history `prev`, and
+/// whether rows may be missing in between (no overlap at all).
+pub fn new_rows<'a>(prev: &[String], history: &'a [String]) -> (&'a [String], bool) {
+    let max = prev.len().min(history.len());
+    match (1..=max)
+        .rev()
+        .find(|&k| prev[prev.len() - k..] == history[..k])
+    {
+        Some(k) => (&history[k..], false),
+        None => (history, !prev.is_empty()),
+    }
+}
+
+/// Last capture of a recorded runtime.
+#[derive(Debug, Clone, Default)]
+struct Tail {
+    history: Vec<String>,
+    screen: Vec<String>,
+}
+
+/// A pane captured in a round.
+#[derive(Debug, Clone)]
+struct Target {
+    runtime: String,
+    pane_id: String,
+    height: usize,
+    /// `meta.json` of a new recording.
+    meta: Value,
+}
+
+/// Schedules capture rounds and keeps the tails between them.
+#[derive(Debug, Default)]
+pub struct Recorder {
+    settings: RecorderSettings,
+    last_run: Option<Instant>,
+    last_prune: Option<Instant>,
+    /// A round is in flight and holds the tails.
+    busy: bool,
+    tails: HashMap<String, Tail>,
+    /// `pipe-pane` readers by runtime; dropping the sender stops one.
+    pipes: HashMap<String, oneshot::Sender<()>>,
+}
+
+impl Recorder {
+    pub fn new(settings: RecorderSettings) -> Self {
+        Self {
+            settings,
+            ..Self::default()
+        }
+    }
+
+    /// Apply reloaded settings; turning the recorder off drops the tails,
+    /// and leaving `pipe-pane` stops the readers, which turn their pipes off.
+    pub fn set_settings(&mut self, settings: RecorderSettings) {
+        if !settings.enabled || settings.dir() != self.settings.dir() {
+            self.tails.clear();
+        }
+        if !settings.enabled || settings.backend != Backend::PipePane {
+            self.pipes.clear();
+        }
+        self.settings = settings;
+    }
+
+    pub fn settings(&self) -> &RecorderSettings {
+        &self.settings
+    }
+
+    /// Last screen of a runtime still being recorded.
+    pub fn screen(&self, runtime: &str) -> Option<&[String]> {
+        self.tails.get(runtime).map(|tail| tail.screen.as_slice())
+    }
+
+    /// Start a capture round if one is due: `panes` is the `list_panes`
+    /// output, `height` and `birth` look up tmux pane heights and birth times.
+    fn start(
+        &mut self,
+        panes: &Value,
+        height: impl Fn(&str) -> Option<u16>,
+        birth: impl Fn(&str) -> Option<DateTime<Utc>>,
+        now: Instant,
+    ) -> Option<Round> {
+        if !self.settings.enabled || self.busy {
+            return None;
+        }
+        let every = Duration::from_secs(self.settings.interval_secs());
+        if self
+            .last_run
+            .is_some_and(|last| now.duration_since(last) < every)
+        {
+            return None;
+        }
+        let dir = self.settings.dir()?;
+        self.last_run = Some(now);
+        let mut targets = Vec::new();
+        for pane in panes.as_array().into_iter().flatten() {
+            if !self.settings.all_panes && pane["presence"] != "managed" {
+                continue;
+            }
+            let pane_id = pane["pane_id"].as_str().unwrap_or("");
+            let (Some(height), Some(birth)) = (height(pane_id), birth(pane_id)) else {
+                continue;
+            };
+            targets.push(Target {
+                runtime: runtime_id(pane_id, birth),
+                pane_id: pane_id.to_string(),
+                height: height as usize,
+                meta: serde_json::json!({
+                    "pane_id": pane_id,
+                    "session_name": pane["session_name"],
+                    "window_name": pane["window_name"],
+                    "provider": pane["provider"],
+                    "started_at": birth,
+                }),
+            });
+        }
+        let mut attach = Vec::new();
+        if self.settings.backend == Backend::PipePane {
+            self.pipes
+                .retain(|runtime, _| targets.iter().any(|t| &t.runtime == runtime));
+            for target in &targets {
+                if !self.pipes.contains_key(&target.runtime) {
+                    let (stop, stopped) = oneshot::channel();
+                    self.pipes.insert(target.runtime.clone(), stop);
+                    attach.push((target.clone(), stopped));
+                }
+            }
+        }
+        let prune = (self
+            .last_prune
+            .is_none_or(|last| now.duration_since(last) >= PRUNE_EVERY))
+        .then(|| {
+            self.last_prune = Some(now);
+            chrono::Duration::days(self.settings.retention_days() as i64)
+        });
+        self.busy = true;
+        Some(Round {
+            dir,
+            backend: self.settings.backend,
+            lines: self.settings.lines(),
+            targets,
+            attach,
+            tails: std::mem::take(&mut self.tails),
+            prune,
+        })
+    }
+
+    /// End a round; `unpiped` runtimes failed to attach and are retried.
+    fn finish(&mut self, tails: HashMap<String, Tail>, unpiped: &[String]) {
+        self.busy = false;
+        if self.settings.enabled {
+            self.tails = tails;
+        }
+        for runtime in unpiped {
+            self.pipes.remove(runtime);
+        }
+    }
+}
+
+/// One capture of every recorded pane.
+#[derive(Debug)]
+struct Round {
+    dir: PathBuf,
+    backend: Backend,
+    lines: u32,
+    targets: Vec<Target>,
+    /// Runtimes to start piping (`pipe-pane`), with their stop signal.
+    attach: Vec<(Target, oneshot::Receiver<()>)>,
+    /// Tails of the previous round; those left over at the end belong to
+    /// runtimes that went away.
+    tails: HashMap<String, Tail>,
+    /// Retention, when expired recordings are due to be deleted.
+    prune: Option<chrono::Duration>,
+}
+
+impl Round {
+    /// Write what the captures added (blocking IO) and return the new tails.
+    fn write(
+        mut self,
+        captures: Vec<Result<String, ActionError>>,
+        now: DateTime<Utc>,
+    ) -> HashMap<String, Tail> {
+        let mut tails = HashMap::new();
+        for (target, captured) in self.targets.iter().zip(captures) {
+            let prev = self.tails.remove(&target.runtime);
+            let output = match captured {
+                Ok(output) => output,
+                Err(e) => {
+                    tracing::debug!("recorder capture of {} failed: {e}", target.pane_id);
+                    if let Some(prev) = prev {
+                        tails.insert(target.runtime.clone(), prev);
+                    }
+                    continue;
+                }
+            };
+            let rows: Vec<String> = output.lines().map(String::from).collect();
+            let (history, screen) = rows.split_at(rows.len().saturating_sub(target.height));
+            // A recording that exists without a tail was left by an earlier
+            // daemon; what happened in between is unknown.
+            let resumed = prev.is_none() && self.dir.join(&target.runtime).exists();
+            let prev = prev.unwrap_or_default();
+            let (added, gap) = new_rows(&prev.history, history);
+            if !added.is_empty() && self.backend == Backend::Capture {
+                let record = serde_json::json!({"at": now, "lines": added, "gap": gap || resumed});
+                if let Err(e) = append(&self.dir, &target.runtime, &target.meta, &record, now) {
+                    tracing::warn!("recorder write for {} failed: {e}", target.runtime);
+                }
+            }
+            tails.insert(
+                target.runtime.clone(),
+                Tail {
+                    history: history.to_vec(),
+                    screen: screen.to_vec(),
+                },
+            );
+        }
+        for (runtime, tail) in self.tails {
+            let record = serde_json::json!({"at": now, "screen": tail.screen, "end": true});
+            if let Err(e) = append(&self.dir, &runtime, &Value::Null, &record, now) {
+                tracing::warn!("recorder write for {runtime} failed: {e}");
+            }
+        }
+        if let Some(retention) = self.prune {
+            match prune(&self.dir, now - retention) {
+                Ok(0) => {}
+                Ok(n) => tracing::info!(removed = n, "expired recordings deleted"),
+                Err(e) => tracing::warn!("recorder prune failed: {e}"),
+            }
+        }
+        tails
+    }
+}
+
+/// Run a capture round if one is due (poll loop). Captures go through the
+/// exec pool like every other tmux call, and so does the file IO.
+pub fn tick(state: &Arc<Mutex<DaemonState>>, st: &mut DaemonState, panes: &Value, now: Instant) {
+    let Ok(runner) = actions::tmux_runner(st) else {
+        return;
+    };
+    let heights: HashMap<&str, u16> = st
+        .last_panes
+        .iter()
+        .map(|p| (p.pane_id.as_str(), p.height))
+        .collect();
+    let Some(round) = st.recorder.start(
+        panes,
+        |pane_id| heights.get(pane_id).copied(),
+        |pane_id| st.generation_tracker.get(pane_id).map(|(_, birth)| birth),
+        now,
+    ) else {
+        return;
+    };
+    tokio::spawn(run(
+        Arc::clone(state),
+        runner,
+        Arc::clone(&st.exec_pool),
+        round,
+    ));
+}
+
+async fn run(
+    state: Arc<Mutex<DaemonState>>,
+    runner: Arc<dyn TmuxCommandRunner>,
+    pool: Arc<ExecPool>,
+    mut round: Round,
+) {
+    let mut unpiped = Vec::new();
+    for (target, stopped) in std::mem::take(&mut round.attach) {
+        let meta = target.meta.clone();
+        if let Err(e) = pane_pipe::attach(
+            &runner,
+            &pool,
+            &round.dir,
+            &target.runtime,
+            &target.pane_id,
+            meta,
+            stopped,
+        )
+        .await
+        {
+            tracing::warn!("recorder pipe-pane for {} failed: {e}", target.pane_id);
+            unpiped.push(target.runtime);
+        }
+    }
+    let mut captures = Vec::with_capacity(round.targets.len());
+    for target in &round.targets {
+        let mut args = vec!["capture-pane".to_string(), "-p".to_string()];
+        // Piped output already holds the history; only the screen is needed.
+        if round.backend == Backend::Capture {
+            args.extend(["-S".to_string(), format!("-{}", round.lines)]);
+        }
+        args.extend(["-t".to_string(), target.pane_id.clone()]);
+        captures.push(actions::run_tmux(&runner, &pool, args).await);
+    }
+    let tails = pool
+        .run(move || round.write(captures, Utc::now()))
+        .await
+        .unwrap_or_default();
+    state.lock().await.recorder.finish(tails, &unpiped);
+}
+
+/// `recording.list`, read on the exec pool; `[]` without a recordings dir.
+pub async fn list_recordings(state: &Arc<Mutex<DaemonState>>) -> Result<Value, ActionError> {
+    let (dir, pool) = {
+        let st = state.lock().await;
+        (st.recorder.settings().dir(), Arc::clone(&st.exec_pool))
+    };
+    let Some(dir) = dir else {
+        return Ok(Value::Array(Vec::new()));
+    };
+    match pool.run(move || list(&dir)).await {
+        Ok(Ok(recordings)) => Ok(Value::Array(recordings)),
+        Ok(Err(e)) => Err(ActionError::Failed(format!("cannot read recordings: {e}"))),
+        Err(e) => Err(ActionError::Failed(e.to_string())),
+    }
+}
+
+/// `recording.replay {runtime, since, raw}`. A runtime still being recorded
+/// gets its current screen as `screen`. Records and screen are masked by
+/// `[redact]`; the files keep what was captured.
+pub async fn replay_recording(
+    state: &Arc<Mutex<DaemonState>>,
+    params: &Value,
+) -> Result<Value, ActionError> {
+    let runtime = params["runtime"].as_str().unwrap_or("").to_string();
+    let since = params["since"]
+        .as_str()
+        .map(|since| audit::parse_since(since, Utc::now()))
+        .transpose()
+        .map_err(ActionError::InvalidParams)?;
+    let (dir, pool, redactor) = {
+        let st = state.lock().await;
+        (
+            st.recorder.settings().dir(),
+            Arc::clone(&st.exec_pool),
+            st.redactor.clone(),
+        )
+    };
+    let missing = || ActionError::InvalidParams(format!("no recording {runtime:?}"));
+    let dir = dir.ok_or_else(missing)?;
+    let read = {
+        let runtime = runtime.clone();
+        let raw = params["raw"].as_bool().unwrap_or(false);
+        pool.run(move || replay(&dir, &runtime, since, raw)).await
+    };
+    let mut replayed = match read {
+        Ok(Ok(Some(replayed))) => replayed,
+        Ok(Ok(None)) => return Err(missing()),
+        Ok(Err(e)) => return Err(ActionError::Failed(format!("cannot read {runtime}: {e}"))),
+        Err(e) => return Err(ActionError::Failed(e.to_string())),
+    };
+    if replayed["ended_at"].is_null()
+        && let Some(screen) = state.lock().await.recorder.screen(&runtime)
+    {
+        replayed["screen"] = serde_json::json!(screen);
+    }
+    redactor.redact_value(&mut replayed["records"]);
+    redactor.redact_value(&mut replayed["screen"]);
+    Ok(replayed)
+}
+
+// ── Store ───────────────────────────────────────────────────────────────────
+
+pub(crate) fn create_private_dir(dir: &Path) -> std::io::Result<()> {
+    let mut builder = std::fs::DirBuilder::new();
+    builder.recursive(true);
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::DirBuilderExt;
+        builder.mode(0o700);
+    }
+    builder.create(dir)
+}
+
+/// Segment files of a runtime, oldest first.
+fn segments(runtime_dir: &Path) -> std::io::Result<Vec<PathBuf>> {
+    let mut segments: Vec<PathBuf> = std::fs::read_dir(runtime_dir)?
+        .filter_map(|entry| entry.ok().map(|e| e.path()))
+        .filter(|path| path.to_string_lossy().ends_with(".jsonl.gz"))
+        .collect();
+    segments.sort();
+    Ok(segments)
+}
+
+/// Append one record to a runtime's recording, creating it with `meta`.
+pub(crate) fn append(
+    dir: &Path,
+    runtime: &str,
+    meta: &Value,
+    record: &Value,
+    now: DateTime<Utc>,
+) -> std::io::Result<()> {
+    let runtime_dir = dir.join(runtime);
+    create_private_dir(&runtime_dir)?;
+    let meta_path = runtime_dir.join("meta.json");
+    if !meta.is_null() && !meta_path.exists() {
+        let mut meta = meta.clone();
+        meta["runtime"] = runtime.into();
+        std::fs::write(&meta_path, serde_json::to_vec_pretty(&meta)?)?;
+    }
+    let path = match segments(&runtime_dir)?.pop() {
+        Some(last) if std::fs::metadata(&last)?.len() < SEGMENT_BYTES => last,
+        _ => runtime_dir.join(format!("{:013}.jsonl.gz", now.timestamp_millis())),
+    };
+    let file = std::fs::OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(path)?;
+    let mut gz = GzEncoder::new(file, Compression::default());
+    serde_json::to_writer(&mut gz, record)?;
+    gz.write_all(b"\n")?;
+    gz.finish()?.sync_data()
+}
+
+/// Start time encoded in a segment's name.
+fn segment_start(path: &Path) -> Option<i64> {
+    path.file_name()?
+        .to_str()?
+        .strip_suffix(".jsonl.gz")?
+        .parse()
+        .ok()
+}
+
+/// `recording.list`: `meta.json` of every recording with its compressed
+/// size and last write, oldest first.
+pub fn list(dir: &Path) -> std::io::Result<Vec<Value>> {
+    let entries = match std::fs::read_dir(dir) {
+        Ok(entries) => entries,
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => return Ok(Vec::new()),
+        Err(e) => return Err(e),
+    };
+    let mut recordings = Vec::new();
+    for entry in entries.flatten() {
+        let path = entry.path();
+        let Ok(meta) = std::fs::read(path.join("meta.json")) else {
+            continue;
+        };
+        let Ok(mut meta) = serde_json::from_slice::<Value>(&meta) else {
+            continue;
+        };
+        let mut bytes = 0;
+        let mut updated: Option<DateTime<Utc>> = None;
+        for segment in segments(&path)? {
+            let metadata = std::fs::metadata(&segment)?;
+            bytes += metadata.len();
+            let modified = metadata.modified().map(DateTime::<Utc>::from).ok();
+            updated = updated.max(modified);
+        }
+        meta["bytes"] = bytes.into();
+        meta["updated_at"] = serde_json::json!(updated);
+        recordings.push(meta);
+    }
+    recordings.sort_by(|a, b| {
+        (a["started_at"].as_str(), a["runtime"].as_str())
+            .cmp(&(b["started_at"].as_str(), b["runtime"].as_str()))
+    });
+    Ok(recordings)
+}
+
+/// `recording.replay`: records written at or after `since`, `{runtime,
+/// meta, records: [{at, lines, gap}], screen, ended_at, truncated}`, with at
+/// most [`MAX_REPLAY_LINES`] rows (the newest). `screen` is the last screen
+/// of an ended runtime. `None` if there is no such recording.
+///
+/// `pipe-pane` output is turned into rows (`pane_pipe::PlainText`) unless
+/// `raw`, which returns it as `{at, raw}` records, escape sequences and
+/// all, at most [`MAX_REPLAY_RAW`] bytes; `truncated` then counts records.
+pub fn replay(
+    dir: &Path,
+    runtime: &str,
+    since: Option<DateTime<Utc>>,
+    raw: bool,
+) -> std::io::Result<Option<Value>> {
+    if !valid_runtime(runtime) {
+        return Ok(None);
+    }
+    let runtime_dir = dir.join(runtime);
+    let meta = match std::fs::read(runtime_dir.join("meta.json")) {
+        Ok(meta) => serde_json::from_slice::<Value>(&meta).unwrap_or(Value::Null),
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => return Ok(None),
+        Err(e) => return Err(e),
+    };
+    let segments = segments(&runtime_dir)?;
+    let mut records = Vec::new();
+    let mut screen = Value::Null;
+    let mut ended_at = Value::Null;
+    for (i, segment) in segments.iter().enumerate() {
+        // A segment ends where the next one starts.
+        if let (Some(since), Some(next)) =
+            (since, segments.get(i + 1).and_then(|s| segment_start(s)))
+            && next <= since.timestamp_millis()
+        {
+            continue;
+        }
+        let reader = BufReader::new(MultiGzDecoder::new(std::fs::File::open(segment)?));
+        // A daemon killed mid-write leaves a truncated member; keep what
+        // was complete.
+        for line in reader.lines().map_while(Result::ok) {
+            let Ok(record) = serde_json::from_str::<Value>(&line) else {
+                continue;
+            };
+            let at = record["at"]
+                .as_str()
+                .and_then(|at| DateTime::parse_from_rfc3339(at).ok());
+            if since.is_some_and(|since| at.is_none_or(|at| at < since)) {
+                continue;
+            }
+            if record["end"] == true {
+                screen = record["screen"].clone();
+                ended_at = record["at"].clone();
+            } else {
+                records.push(record);
+            }
+        }
+    }
+
+    let mut truncated = 0;
+    if raw {
+        let mut budget = MAX_REPLAY_RAW;
+        let mut keep = records.len();
+        for (i, record) in records.iter().enumerate().rev() {
+            let len = record["raw"].as_str().map_or(0, str::len);
+            if len > budget {
+                break;
+            }
+            budget -= len;
+            keep = i;
+        }
+        truncated = keep;
+        records.drain(..keep);
+    } else {
+        records = pane_pipe::PlainText::rows(records);
+        let mut budget = MAX_REPLAY_LINES;
+        for record in records.iter_mut().rev() {
+            let Some(lines) = record["lines"].as_array_mut() else {
+                continue;
+            };
+            let keep = lines.len().min(budget);
+            truncated += lines.len() - keep;
+            lines.drain(..lines.len() - keep);
+            budget -= keep;
+        }
+        records.retain(|r| r["lines"].as_array().is_some_and(|l| !l.is_empty()));
+    }
+    Ok(Some(serde_json::json!({
+        "runtime": runtime,
+        "meta": meta,
+        "records": records,
+        "screen": screen,
+        "ended_at": ended_at,
+        "truncated": truncated,
+    })))
+}
+
+/// Delete the recordings last written before `cutoff`; returns how many.
+fn prune(dir: &Path, cutoff: DateTime<Utc>) -> std::io::Result<usize> {
+    let entries = match std::fs::read_dir(dir) {
+        Ok(entries) => entries,
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => return Ok(0),
+        Err(e) => return Err(e),
+    };
+    let mut removed = 0;
+    for entry in entries.flatten() {
+        let path = entry.path();
+        if !path.join("meta.json").exists() {
+            continue;
+        }
+        let newest = segments(&path)?
+            .iter()
+            .chain([&path.join("meta.json")])
+            .filter_map(|file| std::fs::metadata(file).and_then(|m| m.modified()).ok())
+            .max()
+            .map(DateTime::<Utc>::from);
+        if newest.is_some_and(|newest| newest < cutoff) {
+            std::fs::remove_dir_all(&path)?;
+            removed += 1;
+        }
+    }
+    Ok(removed)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn rows(text: &str) -> Vec<String> {
+        text.split_whitespace().map(String::from).collect()
+    }
+
+    fn temp_dir(name: &str) -> PathBuf {
+        let dir =
+            std::env::temp_dir().join(format!("agtmux-recorder-{name}-{}", std::process::id()));
+        let _ = std::fs::remove_dir_all(&dir);
+        dir
+    }
+
+    #[test]
+    fn validates_settings() {
+        assert!(RecorderSettings::default().validate().is_ok());
+        let bad = [
+            RecorderSettings {
+                interval_secs: Some(0),
+                ..Default::default()
+            },
+            RecorderSettings {
+                lines: Some(0),
+                ..Default::default()
+            },
+            RecorderSettings {
+                dir: Some(PathBuf::from("rel/dir")),
+                ..Default::default()
+            },
+        ];
+        for settings in bad {
+            assert!(settings.validate().is_err(), "{settings:?}");
+        }
+    }
+
+    #[test]
+    fn finds_rows_after_the_overlap() {
+        let prev = rows("a b c d");
+        assert_eq!(new_rows(&prev, &rows("c d e f")), (&rows("e f")[..], false));
+        assert_eq!(new_rows(&prev, &rows("a b c d e")), (&rows("e")[..], false));
+        assert_eq!(new_rows(&prev, &prev), (&[][..], false), "nothing new");
+        assert_eq!(new_rows(&[], &rows("x y")), (&rows("x y")[..], false));
+        assert_eq!(
+            new_rows(&prev, &rows("x y")),
+            (&rows("x y")[..], true),
+            "no overlap is a gap"
+        );
+        assert_eq!(
+            runtime_id(
+                "%3",
+                DateTime::parse_from_rfc3339("2026-10-15T07:00:00Z")
+                    .expect("time")
+                    .with_timezone(&Utc)
+            ),
+            "3-20261015T070000"
+        );
+        assert!(!valid_runtime("../etc"));
+    }
+
+    #[test]
+    fn rounds_write_new_rows_and_the_last_screen() {
+        let dir = temp_dir("round");
+        let target = Target {
+            runtime: "3-20261015T070000".to_string(),
+            pane_id: "%3".to_string(),
+            height: 2,
+            meta: json!({"pane_id": "%3", "provider": "codex"}),
+        };
+        let round = |tails| Round {
+            dir: dir.clone(),
+            lines: 100,
+            backend: Backend::Capture,
+            targets: vec![target.clone()],
+            attach: Vec::new(),
+            tails,
+            prune: None,
+        };
+        let t0 = Utc::now();
+        let tails = round(HashMap::new()).write(vec![Ok("one\ntwo\n$ \n\n".into())], t0);
+        let tails = round(tails).write(vec![Ok("one\ntwo\nthree\n$ x\n\n".into())], t0);
+        assert_eq!(tails["3-20261015T070000"].screen, ["$ x", ""]);
+        let ended = Round {
+            targets: Vec::new(),
+            ..round(tails)
+        };
+        assert!(ended.write(Vec::new(), t0).is_empty());
+
+        let listed = list(&dir).expect("list");
+        assert_eq!(listed.len(), 1);
+        assert_eq!(listed[0]["runtime"], "3-20261015T070000");
+        assert_eq!(listed[0]["provider"], "codex");
+
+        let replayed = replay(&dir, "3-20261015T070000", None, false)
+            .expect("read")
+            .expect("exists");
+        let lines: Vec<&Value> = replayed["records"]
+            .as_array()
+            .expect("records")
+            .iter()
+            .flat_map(|r| r["lines"].as_array().expect("lines"))
+            .collect();
+        assert_eq!(lines, ["one", "two", "three"]);
+        assert_eq!(replayed["records"][0]["gap"], false);
+        assert_eq!(replayed["screen"], json!(["$ x", ""]));
+        assert!(replayed["ended_at"].is_string());
+
+        let later = replay(
+            &dir,
+            "3-20261015T070000",
+            Some(t0 + chrono::Duration::hours(1)),
+            false,
+        )
+        .expect("read")
+        .expect("exists");
+        assert_eq!(later["records"], json!([]));
+        assert!(
+            replay(&dir, "9-20261015T070000", None, false)
+                .expect("read")
+                .is_none()
+        );
+
+        assert_eq!(
+            prune(&dir, t0 - chrono::Duration::days(1)).expect("prune"),
+            0
+        );
+        assert_eq!(
+            prune(&dir, Utc::now() + chrono::Duration::days(1)).expect("prune"),
+            1
+        );
+        assert!(list(&dir).expect("list").is_empty());
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[test]
+    fn start_selects_managed_panes_once_per_interval() {
+        let mut recorder = Recorder::new(RecorderSettings {
+            enabled: true,
+            dir: Some(PathBuf::from("/tmp/agtmux-recordings")),
+            ..Default::default()
+        });
+        let panes = json!([
+            {"pane_id": "%1", "presence": "managed", "provider": "claude"},
+            {"pane_id": "%2", "presence": "unmanaged"},
+        ]);
+        let birth = |_: &str| Some(Utc::now());
+        let now = Instant::now();
+        let round = recorder
+            .start(&panes, |_| Some(40), birth, now)
+            .expect("due");
+        assert_eq!(round.targets.len(), 1);
+        assert_eq!(round.targets[0].pane_id, "%1");
+        assert!(
+            recorder.start(&panes, |_| Some(40), birth, now).is_none(),
+            "one round at a time"
+        );
+        recorder.finish(HashMap::new(), &[]);
+        assert!(recorder.start(&panes, |_| Some(40), birth, now).is_none());
+        let later = now + Duration::from_secs(DEFAULT_INTERVAL_SECS);
+        assert!(recorder.start(&panes, |_| Some(40), birth, later).is_some());
+    }
+
+    #[test]
+    fn pipe_pane_rounds_attach_each_runtime_once() {
+        let mut recorder = Recorder::new(RecorderSettings {
+            enabled: true,
+            backend: Backend::PipePane,
+            dir: Some(PathBuf::from("/tmp/agtmux-recordings")),
+            ..Default::default()
+        });
+        let panes = json!([{"pane_id": "%1", "presence": "managed", "provider": "claude"}]);
+        let born = Utc::now();
+        let mut now = Instant::now();
+        let mut round = |recorder: &mut Recorder, unpiped: &[String]| {
+            let round = recorder
+                .start(&panes, |_| Some(40), |_| Some(born), now)
+                .expect("due");
+            recorder.finish(HashMap::new(), unpiped);
+            now += Duration::from_secs(DEFAULT_INTERVAL_SECS);
+            round.attach
+        };
+        let mut first = round(&mut recorder, &[]);
+        assert_eq!(first.len(), 1);
+        let (target, mut stopped) = first.pop().expect("attach");
+        assert_eq!(target.pane_id, "%1");
+        assert!(round(&mut recorder, &[]).is_empty(), "already piped");
+        assert!(
+            stopped
+                .try_recv()
+                .is_err_and(|e| e == oneshot::error::TryRecvError::Empty)
+        );
+
+        // A pipe that could not be set up is tried again next round.
+        assert!(round(&mut recorder, &[target.runtime]).is_empty());
+        let mut retried = round(&mut recorder, &[]);
+        assert_eq!(retried.len(), 1);
+        assert!(
+            stopped
+                .try_recv()
+                .is_err_and(|e| e == oneshot::error::TryRecvError::Closed),
+            "the failed pipe's reader is stopped"
+        );
+        let (_, mut stopped) = retried.pop().expect("attach");
+        recorder.set_settings(RecorderSettings::default());
+        assert!(
+            stopped
+                .try_recv()
+                .is_err_and(|e| e == oneshot::error::TryRecvError::Closed),
+            "disabling stops every pipe"
+        );
+    }
+}
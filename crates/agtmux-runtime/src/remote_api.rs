@@ -0,0 +1,1009 @@
+//! Remote REST API (`[remote]` / `daemon --listen`): a read-only HTTP
+//! listener for web dashboards on other machines, next to the UDS server.
+//!
+//! ```toml
+//! [remote]
+//! listen = "tcp://0.0.0.0:7300"
+//! token_file = "/etc/agtmux/remote-token"   # bearer token, first line
+//! scope = "read"                             # its `[access]` scope
+//! tls_cert = "/etc/agtmux/cert.pem"          # PEM chain; with tls_key
+//! tls_key = "/etc/agtmux/key.pem"
+//! ```
+//!
+//! Every request needs `Authorization: Bearer <token>`: the `token_file`
+//! token, with `scope` (default `read`), or an `[[access.tokens]]` token
+//! with its own scope. Each endpoint needs the scope of the RPC method it
+//! mirrors (see `access`), else `403 Forbidden`. After 5 wrong tokens in a
+//! row (requests without one do not count) a peer address gets `429 Too Many Requests` (with `Retry-After`) for
+//! 1s, doubling with each further bad token up to 5 minutes. Endpoints:
+//!
+//! - `GET /v1/snapshot` — `{version, cursor, panes}`, the `list_panes`
+//!   array; its `ETag` changes with the panes, and `If-None-Match` with the
+//!   current one gets an empty `304 Not Modified`. `cursor` resumes from
+//!   this snapshot with `list_panes {since_cursor}` over the UDS. Also
+//!   `repo`, `branch`, `sort=-updated_at`, `fields=pane_id,activity_state`
+//!   and paging with `limit` plus `after` or `offset` (see `pane_query`),
+//!   which add `next_after` / `next_offset`
+//! - `GET /v1/terminal?pane_id=%253&lines=100&since=<cursor>` — `{pane_id,
+//!   lines, cursor, full, captured_at}`, the pane's last lines of output,
+//!   or with `since` those after an earlier reply's `cursor` (`pane.output`,
+//!   see `pane_output`)
+//! - `GET /v1/audit?since=1h&target=%253&action_type=pane.*` — the
+//!   `actions.history` entries (see `audit`); like that method it needs an
+//!   `admin` token
+//! - `GET /v1/search?q=panicked&target=%253&lines=500` — panes whose output
+//!   contains `q`, with the matching lines (`pane.search`, see `search`);
+//!   also `session`, `agent`, `ignore_case=1` and `regex=1`
+//!
+//! A connection gets [`REQUEST_DEADLINE`] for its whole request, TLS
+//! handshake to response, and at most [`MAX_CONNECTIONS`] are served at
+//! once; further clients wait in the listen backlog.
+//!
+//! TLS is optional on loopback and required on any other address. The
+//! listener, token and certificates are loaded at startup; a listener that
+//! cannot be bound or a missing token / certificate is fatal, and changes
+//! need a restart.
+
+use std::collections::HashMap;
+use std::net::{IpAddr, SocketAddr};
+use std::path::PathBuf;
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+use chrono::Utc;
+use serde_json::{Value, json};
+use tokio::io::{AsyncRead, AsyncReadExt, AsyncWrite, AsyncWriteExt};
+use tokio::net::TcpListener;
+use tokio::sync::{Mutex, Semaphore};
+use tokio_rustls::TlsAcceptor;
+use tokio_rustls::rustls;
+use tokio_rustls::rustls::pki_types::pem::PemObject;
+use tokio_rustls::rustls::pki_types::{CertificateDer, PrivateKeyDer};
+
+use crate::access::{self, AccessPolicy, Scope};
+use crate::actions::ActionError;
+use crate::audit::AuditQuery;
+use crate::pane_output::{self, OutputQuery};
+use crate::pane_query::PaneListQuery;
+use crate::poll_loop::DaemonState;
+use crate::search::{self, SearchQuery};
+use crate::server::observed_pane_list;
+
+/// Largest request head read before answering.
+const MAX_REQUEST_BYTES: usize = 8192;
+/// Longest wait for the next bytes of a request.
+const REQUEST_TIMEOUT: Duration = Duration::from_secs(5);
+/// Longest a connection is served, however slowly its bytes trickle in.
+pub const REQUEST_DEADLINE: Duration = Duration::from_secs(30);
+/// Connections served at once.
+pub const MAX_CONNECTIONS: usize = 64;
+
+/// Failed tokens in a row before a peer is locked out; each further failure
+/// doubles the lockout, from 1s up to `MAX_LOCKOUT`.
+const FAILURES_BEFORE_LOCKOUT: u32 = 5;
+const MAX_LOCKOUT: Duration = Duration::from_secs(300);
+/// Peers tracked before those with no recent failure are dropped.
+const MAX_TRACKED_PEERS: usize = 4096;
+
+/// Resolved `[remote]` section.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RemoteSettings {
+    pub addr: SocketAddr,
+    pub token_file: PathBuf,
+    /// `[access]` scope of the `token_file` token.
+    pub scope: Scope,
+    /// (certificate chain, private key) PEM files.
+    pub tls: Option<(PathBuf, PathBuf)>,
+}
+
+impl RemoteSettings {
+    /// Validate a `listen` address (`tcp://host:port` or `host:port`) and
+    /// the files that go with it.
+    pub fn resolve(
+        listen: &str,
+        token_file: Option<&PathBuf>,
+        scope: Option<Scope>,
+        tls_cert: Option<&PathBuf>,
+        tls_key: Option<&PathBuf>,
+    ) -> anyhow::Result<Self> {
+        let addr: SocketAddr = listen
+            .strip_prefix("tcp://")
+            .unwrap_or(listen)
+            .parse()
+            .map_err(|_| {
+                anyhow::anyhow!(
+                    "remote.listen must be tcp://host:port, e.g. tcp://127.0.0.1:7300: {listen:?}"
+                )
+            })?;
+        let token_file = token_file
+            .cloned()
+            .ok_or_else(|| anyhow::anyhow!("remote.listen needs remote.token_file"))?;
+        let tls = match (tls_cert, tls_key) {
+            (Some(cert), Some(key)) => Some((cert.clone(), key.clone())),
+            (None, None) => None,
+            _ => anyhow::bail!("remote.tls_cert and remote.tls_key must be set together"),
+        };
+        if tls.is_none() && !addr.ip().is_loopback() {
+            anyhow::bail!(
+                "remote.listen {addr} is not loopback: set remote.tls_cert and remote.tls_key"
+            );
+        }
+        Ok(Self {
+            addr,
+            token_file,
+            scope: scope.unwrap_or(Scope::Read),
+            tls,
+        })
+    }
+
+    /// `tcp://host:port`.
+    pub fn listen_url(&self) -> String {
+        format!("tcp://{}", self.addr)
+    }
+}
+
+/// Loaded token and TLS acceptor.
+#[derive(Clone)]
+pub struct RemoteApi {
+    token: String,
+    scope: Scope,
+    tls: Option<TlsAcceptor>,
+    throttle: Arc<std::sync::Mutex<AuthThrottle>>,
+    /// [`REQUEST_DEADLINE`] and [`MAX_CONNECTIONS`]; smaller in tests.
+    deadline: Duration,
+    max_connections: usize,
+}
+
+/// Failed bearer tokens by peer address, against brute force: after
+/// `FAILURES_BEFORE_LOCKOUT` in a row the peer gets `429 Too Many Requests`
+/// until its lockout ends, whatever token it sends. A valid token resets it.
+#[derive(Debug, Default)]
+struct AuthThrottle {
+    /// Failures in a row and the time of the last one.
+    peers: HashMap<IpAddr, (u32, Instant)>,
+}
+
+impl AuthThrottle {
+    /// Lockout left for `ip` at `now`, if any.
+    fn locked(&self, ip: IpAddr, now: Instant) -> Option<Duration> {
+        let (failures, last) = self.peers.get(&ip)?;
+        let until = *last + lockout(*failures)?;
+        (now < until).then(|| until - now)
+    }
+
+    /// Record a failed token; returns the lockout it starts.
+    fn fail(&mut self, ip: IpAddr, now: Instant) -> Option<Duration> {
+        if self.peers.len() >= MAX_TRACKED_PEERS {
+            self.peers
+                .retain(|_, (_, last)| now.duration_since(*last) < MAX_LOCKOUT);
+        }
+        let entry = self.peers.entry(ip).or_insert((0, now));
+        *entry = (entry.0.saturating_add(1), now);
+        lockout(entry.0)
+    }
+
+    fn succeed(&mut self, ip: IpAddr) {
+        self.peers.remove(&ip);
+    }
+
+    /// Check `ip` and record its token in one step, so concurrent guesses
+    /// cannot all pass the check before their failures are recorded.
+    /// `valid` is None when no token was presented, which neither counts as
+    /// a guess nor resets the count. `Err` is the lockout left; `Ok(Some)`
+    /// a lockout this failure started.
+    fn admit(
+        &mut self,
+        ip: IpAddr,
+        now: Instant,
+        valid: Option<bool>,
+    ) -> Result<Option<Duration>, Duration> {
+        if let Some(left) = self.locked(ip, now) {
+            return Err(left);
+        }
+        Ok(match valid {
+            Some(true) => {
+                self.succeed(ip);
+                None
+            }
+            Some(false) => self.fail(ip, now),
+            None => None,
+        })
+    }
+}
+
+/// Lockout after `failures` failed tokens in a row.
+fn lockout(failures: u32) -> Option<Duration> {
+    let extra = failures.checked_sub(FAILURES_BEFORE_LOCKOUT)?;
+    Some(Duration::from_secs(1 << extra.min(16)).min(MAX_LOCKOUT))
+}
+
+impl RemoteApi {
+    /// Read the token file and certificates.
+    pub fn load(settings: &RemoteSettings) -> anyhow::Result<Self> {
+        let token = std::fs::read_to_string(&settings.token_file)
+            .map_err(|e| {
+                anyhow::anyhow!("remote.token_file {}: {e}", settings.token_file.display())
+            })?
+            .lines()
+            .next()
+            .unwrap_or("")
+            .trim()
+            .to_string();
+        if token.is_empty() {
+            anyhow::bail!(
+                "remote.token_file {} is empty",
+                settings.token_file.display()
+            );
+        }
+        let tls = settings
+            .tls
+            .as_ref()
+            .map(|(cert, key)| tls_acceptor(cert, key))
+            .transpose()?;
+        Ok(Self {
+            token,
+            scope: settings.scope,
+            tls,
+            throttle: Arc::default(),
+            deadline: REQUEST_DEADLINE,
+            max_connections: MAX_CONNECTIONS,
+        })
+    }
+
+    /// Scope of the request's bearer token: `remote.scope` for the
+    /// `token_file` token, else that of a matching `[[access.tokens]]`
+    /// entry. None when there is no valid token.
+    fn scope(&self, head: &str, access: &AccessPolicy) -> Option<Scope> {
+        let token = header(head, "authorization")?
+            .strip_prefix("Bearer ")?
+            .trim();
+        if constant_time_eq(token.as_bytes(), self.token.as_bytes()) {
+            return Some(self.scope);
+        }
+        // Any uid: with a token, `scope_for` only looks at the token.
+        access
+            .scope_for(0, Some(token))
+            .ok()
+            .map(|(scope, _)| scope)
+    }
+}
+
+fn tls_acceptor(cert: &PathBuf, key: &PathBuf) -> anyhow::Result<TlsAcceptor> {
+    let certs = CertificateDer::pem_file_iter(cert)
+        .and_then(|certs| certs.collect::<Result<Vec<_>, _>>())
+        .map_err(|e| anyhow::anyhow!("remote.tls_cert {}: {e}", cert.display()))?;
+    let key = PrivateKeyDer::from_pem_file(key)
+        .map_err(|e| anyhow::anyhow!("remote.tls_key {}: {e}", key.display()))?;
+    let config = rustls::ServerConfig::builder_with_provider(Arc::new(
+        rustls::crypto::ring::default_provider(),
+    ))
+    .with_safe_default_protocol_versions()?
+    .with_no_client_auth()
+    .with_single_cert(certs, key)
+    .map_err(|e| anyhow::anyhow!("remote TLS config: {e}"))?;
+    Ok(TlsAcceptor::from(Arc::new(config)))
+}
+
+/// Compare without an early exit on the first differing byte.
+fn constant_time_eq(a: &[u8], b: &[u8]) -> bool {
+    a.len() == b.len() && a.iter().zip(b).fold(0u8, |acc, (x, y)| acc | (x ^ y)) == 0
+}
+
+/// Serve the API until the daemon exits.
+pub async fn serve(listener: TcpListener, api: RemoteApi, state: Arc<Mutex<DaemonState>>) {
+    let slots = Arc::new(Semaphore::new(api.max_connections));
+    loop {
+        let Ok(slot) = Arc::clone(&slots).acquire_owned().await else {
+            return;
+        };
+        let (stream, peer) = match listener.accept().await {
+            Ok(accepted) => accepted,
+            Err(e) => {
+                tracing::warn!("remote accept failed: {e}");
+                tokio::time::sleep(Duration::from_millis(100)).await;
+                continue;
+            }
+        };
+        let api = api.clone();
+        let state = Arc::clone(&state);
+        tokio::spawn(async move {
+            let _slot = slot;
+            let handled = async {
+                match &api.tls {
+                    Some(acceptor) => {
+                        match tokio::time::timeout(REQUEST_TIMEOUT, acceptor.accept(stream)).await {
+                            Ok(Ok(stream)) => respond(stream, peer, &api, &state).await,
+                            Ok(Err(e)) => Err(e),
+                            Err(_) => Err(std::io::Error::new(
+                                std::io::ErrorKind::TimedOut,
+                                "TLS handshake timeout",
+                            )),
+                        }
+                    }
+                    None => respond(stream, peer, &api, &state).await,
+                }
+            };
+            let result = tokio::time::timeout(api.deadline, handled)
+                .await
+                .unwrap_or_else(|_| {
+                    Err(std::io::Error::new(
+                        std::io::ErrorKind::TimedOut,
+                        "request deadline",
+                    ))
+                });
+            if let Err(e) = result {
+                tracing::debug!(%peer, "remote request failed: {e}");
+            }
+        });
+    }
+}
+
+async fn respond<S: AsyncRead + AsyncWrite + Unpin>(
+    mut stream: S,
+    peer: SocketAddr,
+    api: &RemoteApi,
+    state: &Arc<Mutex<DaemonState>>,
+) -> std::io::Result<()> {
+    let mut head = Vec::new();
+    let mut buf = [0u8; 1024];
+    while !head.windows(4).any(|w| w == b"\r\n\r\n") && head.len() < MAX_REQUEST_BYTES {
+        let n = tokio::time::timeout(REQUEST_TIMEOUT, stream.read(&mut buf))
+            .await
+            .map_err(|_| std::io::Error::new(std::io::ErrorKind::TimedOut, "request timeout"))??;
+        if n == 0 {
+            break;
+        }
+        head.extend_from_slice(&buf[..n]);
+    }
+    let head = String::from_utf8_lossy(&head);
+    let mut etag = None;
+    let mut retry_after = None;
+    let scope = api.scope(&head, &state.lock().await.access);
+    let presented = header(&head, "authorization").is_some();
+    let admitted = api.throttle.lock().expect("throttle lock").admit(
+        peer.ip(),
+        Instant::now(),
+        presented.then_some(scope.is_some()),
+    );
+    let locked = admitted.err();
+    if let Ok(Some(lockout)) = admitted {
+        tracing::warn!(%peer, "remote peer locked out for {lockout:?} after failed tokens");
+    }
+    let route = route(&head);
+    let required = route
+        .method()
+        .map(|method| access::required_scope(method, &Value::Null));
+    let (status, body) = if let Some(left) = locked {
+        retry_after = Some(left.as_secs() + u64::from(left.subsec_nanos() > 0));
+        (
+            "429 Too Many Requests",
+            json!({"error": "too many failed tokens"}),
+        )
+    } else if let (Some(scope), Some(required)) = (scope, required)
+        && scope < required
+    {
+        tracing::warn!(%peer, "remote request needs scope {required}; token has {scope}");
+        (
+            "403 Forbidden",
+            json!({"error": format!("needs scope {required}; token has {scope}")}),
+        )
+    } else if scope.is_none() {
+        tracing::warn!(%peer, "remote request without a valid token");
+        ("401 Unauthorized", json!({"error": "unauthorized"}))
+    } else {
+        match route {
+            Route::Snapshot(params) => match PaneListQuery::from_params(&params) {
+                Ok(query) => {
+                    let (version, panes, cursor) = {
+                        let mut st = state.lock().await;
+                        let panes = observed_pane_list(&mut st);
+                        (st.daemon.version(), panes, st.pane_events.cursor())
+                    };
+                    // Cursors restart with the daemon; the pid tells them apart.
+                    let tag = format!("\"{}-{cursor}\"", std::process::id());
+                    let fresh = header(&head, "if-none-match")
+                        .is_some_and(|tags| tags.split(',').any(|t| t.trim() == tag));
+                    etag = Some(tag);
+                    if fresh {
+                        ("304 Not Modified", Value::Null)
+                    } else {
+                        let mut body = json!({"version": version, "cursor": cursor});
+                        match query.apply(&panes) {
+                            Value::Object(page) => {
+                                body.as_object_mut().expect("object").extend(page)
+                            }
+                            panes => body["panes"] = panes,
+                        }
+                        ("200 OK", body)
+                    }
+                }
+                Err(e) => ("400 Bad Request", json!({"error": e})),
+            },
+            Route::Terminal(params) => match OutputQuery::from_params(&params) {
+                Ok(query) => match pane_output::capture(state, &query).await {
+                    Ok(result) => ("200 OK", result),
+                    Err(ActionError::PaneNotFound(pane_id)) => (
+                        "404 Not Found",
+                        json!({"error": format!("pane {pane_id} not found")}),
+                    ),
+                    Err(e) => ("502 Bad Gateway", json!({"error": e.to_string()})),
+                },
+                Err(e) => ("400 Bad Request", json!({"error": e})),
+            },
+            Route::Audit(params) => match AuditQuery::from_params(&params, Utc::now()) {
+                Ok(query) => ("200 OK", json!(state.lock().await.audit.query(&query))),
+                Err(e) => ("400 Bad Request", json!({"error": e})),
+            },
+            Route::Search(params) => match SearchQuery::from_params(&params) {
+                Ok(query) => match search::search(state, &query).await {
+                    Ok(result) => ("200 OK", result),
+                    Err(ActionError::PaneNotFound(pane_id)) => (
+                        "404 Not Found",
+                        json!({"error": format!("pane {pane_id} not found")}),
+                    ),
+                    Err(e) => ("502 Bad Gateway", json!({"error": e.to_string()})),
+                },
+                Err(e) => ("400 Bad Request", json!({"error": e})),
+            },
+            Route::BadRequest(message) => ("400 Bad Request", json!({"error": message})),
+            Route::NotFound => ("404 Not Found", json!({"error": "not found"})),
+            Route::MethodNotAllowed => ("405 Method Not Allowed", json!({"error": "GET only"})),
+        }
+    };
+    let body = if body.is_null() {
+        String::new()
+    } else {
+        format!("{body}\n")
+    };
+    let mut response = format!(
+        "HTTP/1.1 {status}\r\nContent-Type: application/json\r\nContent-Length: {}\r\nConnection: close\r\n",
+        body.len()
+    );
+    if status.starts_with("401") {
+        response += "WWW-Authenticate: Bearer\r\n";
+    }
+    if let Some(tag) = etag {
+        response += &format!("ETag: {tag}\r\nCache-Control: no-cache\r\n");
+    }
+    if let Some(secs) = retry_after {
+        response += &format!("Retry-After: {secs}\r\n");
+    }
+    response += "\r\n";
+    response += &body;
+    stream.write_all(response.as_bytes()).await?;
+    stream.shutdown().await
+}
+
+#[derive(Debug, PartialEq, Eq)]
+enum Route {
+    /// `list_panes` params.
+    Snapshot(Value),
+    /// `pane.output` params.
+    Terminal(Value),
+    /// `actions.history` params.
+    Audit(Value),
+    /// `pane.search` params.
+    Search(Value),
+    BadRequest(String),
+    NotFound,
+    MethodNotAllowed,
+}
+
+impl Route {
+    /// The RPC method an endpoint mirrors, whose `[access]` scope it needs.
+    fn method(&self) -> Option<&'static str> {
+        match self {
+            Self::Snapshot(_) => Some("list_panes"),
+            // Pane output, as `pane.search` captures it.
+            Self::Terminal(_) => Some("pane.output"),
+            Self::Search(_) => Some("pane.search"),
+            Self::Audit(_) => Some("actions.history"),
+            Self::BadRequest(_) | Self::NotFound | Self::MethodNotAllowed => None,
+        }
+    }
+}
+
+/// Route a request by its request line (`GET /v1/terminal?pane_id=%253 HTTP/1.1`).
+fn route(head: &str) -> Route {
+    let mut parts = head.lines().next().unwrap_or("").split_whitespace();
+    let (method, target) = (parts.next(), parts.next().unwrap_or(""));
+    if method != Some("GET") {
+        return Route::MethodNotAllowed;
+    }
+    let (path, query) = target.split_once('?').unwrap_or((target, ""));
+    let param = |name: &str| {
+        query
+            .split('&')
+            .filter_map(|pair| pair.split_once('='))
+            .find(|(key, _)| *key == name)
+            .map(|(_, value)| percent_decode(value))
+    };
+    match path {
+        "/v1/snapshot" => {
+            let mut params = serde_json::Map::new();
+            for key in ["limit", "offset"] {
+                match param(key).map(|n| n.parse::<u64>()) {
+                    None => {}
+                    Some(Ok(n)) => {
+                        params.insert(key.to_string(), json!(n));
+                    }
+                    Some(Err(_)) => return Route::BadRequest(format!("{key} must be a number")),
+                }
+            }
+            for key in ["repo", "branch", "after", "sort", "fields"] {
+                if let Some(value) = param(key) {
+                    params.insert(key.to_string(), json!(value));
+                }
+            }
+            if let Some(after) = params.get_mut("after") {
+                *after = json!(pane_id(after.as_str().unwrap_or("")));
+            }
+            Route::Snapshot(Value::Object(params))
+        }
+        "/v1/audit" => {
+            let limit = match param("limit").map(|l| l.parse::<u64>()) {
+                None => Value::Null,
+                Some(Ok(limit)) => json!(limit),
+                Some(Err(_)) => return Route::BadRequest("limit must be a number".to_string()),
+            };
+            Route::Audit(json!({
+                "since": param("since"),
+                "target": param("target").filter(|t| !t.is_empty()).map(|t| pane_id(&t)),
+                "action_type": param("action_type"),
+                "limit": limit,
+            }))
+        }
+        "/v1/search" => {
+            let lines = match param("lines").map(|l| l.parse::<u64>()) {
+                None => Value::Null,
+                Some(Ok(lines)) => json!(lines),
+                Some(Err(_)) => return Route::BadRequest("lines must be a number".to_string()),
+            };
+            let pane_ids: Vec<String> = param("target")
+                .iter()
+                .flat_map(|t| t.split(','))
+                .filter(|t| !t.is_empty())
+                .map(pane_id)
+                .collect();
+            Route::Search(json!({
+                "q": param("q"),
+                "pane_ids": pane_ids,
+                "session": param("session"),
+                "agent": param("agent"),
+                "ignore_case": param("ignore_case").is_some_and(|v| v == "1" || v == "true"),
+                "regex": param("regex").is_some_and(|v| v == "1" || v == "true"),
+                "lines": lines,
+            }))
+        }
+        "/v1/terminal" => {
+            let Some(pane) = param("pane_id").filter(|p| !p.is_empty()) else {
+                return Route::BadRequest("pane_id is required".to_string());
+            };
+            let lines = match param("lines").map(|l| l.parse::<u64>()) {
+                None => Value::Null,
+                Some(Ok(lines)) => json!(lines),
+                Some(Err(_)) => return Route::BadRequest("lines must be a number".to_string()),
+            };
+            Route::Terminal(json!({
+                "pane_id": pane_id(&pane),
+                "lines": lines,
+                "since": param("since"),
+            }))
+        }
+        _ => Route::NotFound,
+    }
+}
+
+/// `7` → `%7`.
+fn pane_id(pane: &str) -> String {
+    if pane.starts_with('%') {
+        pane.to_string()
+    } else {
+        format!("%{pane}")
+    }
+}
+
+/// Value of header `name` (case-insensitive).
+fn header<'a>(head: &'a str, name: &str) -> Option<&'a str> {
+    head.lines().skip(1).find_map(|line| {
+        let (key, value) = line.split_once(':')?;
+        key.trim()
+            .eq_ignore_ascii_case(name)
+            .then_some(value.trim())
+    })
+}
+
+/// `%25` → `%`, `+` → space; invalid escapes are kept as-is.
+fn percent_decode(value: &str) -> String {
+    let bytes = value.as_bytes();
+    let mut out = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        match bytes[i] {
+            b'%' if i + 2 < bytes.len() => {
+                let hex = std::str::from_utf8(&bytes[i + 1..i + 3]).ok();
+                match hex.and_then(|h| u8::from_str_radix(h, 16).ok()) {
+                    Some(byte) => {
+                        out.push(byte);
+                        i += 3;
+                        continue;
+                    }
+                    None => out.push(b'%'),
+                }
+            }
+            b'+' => out.push(b' '),
+            byte => out.push(byte),
+        }
+        i += 1;
+    }
+    String::from_utf8_lossy(&out).into_owned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::access::{AccessSettings, TokenEntry, token_digest};
+    use tokio::net::TcpStream;
+
+    fn api() -> RemoteApi {
+        RemoteApi {
+            token: "s3cret".to_string(),
+            scope: Scope::Read,
+            tls: None,
+            throttle: Arc::default(),
+            deadline: REQUEST_DEADLINE,
+            max_connections: MAX_CONNECTIONS,
+        }
+    }
+
+    #[test]
+    fn resolves_settings() {
+        let token = PathBuf::from("/etc/agtmux/token");
+        let local = RemoteSettings::resolve("tcp://127.0.0.1:7300", Some(&token), None, None, None)
+            .expect("loopback without TLS");
+        assert_eq!(local.listen_url(), "tcp://127.0.0.1:7300");
+        assert!(RemoteSettings::resolve("127.0.0.1:7300", Some(&token), None, None, None).is_ok());
+
+        let err = RemoteSettings::resolve("tcp://0.0.0.0:7300", Some(&token), None, None, None)
+            .expect_err("remote needs TLS");
+        assert!(err.to_string().contains("tls_cert"), "{err}");
+        let cert = PathBuf::from("/etc/agtmux/cert.pem");
+        assert!(
+            RemoteSettings::resolve("tcp://0.0.0.0:7300", Some(&token), None, Some(&cert), None)
+                .is_err()
+        );
+        assert!(RemoteSettings::resolve("tcp://127.0.0.1:7300", None, None, None, None).is_err());
+        assert!(
+            RemoteSettings::resolve("http://127.0.0.1", Some(&token), None, None, None).is_err()
+        );
+    }
+
+    #[test]
+    fn routes_and_decodes_requests() {
+        assert_eq!(
+            route("GET /v1/snapshot HTTP/1.1\r\n"),
+            Route::Snapshot(json!({}))
+        );
+        assert_eq!(
+            route(
+                "GET /v1/snapshot?limit=50&after=3&sort=-updated_at&fields=pane_id,title HTTP/1.1\r\n"
+            ),
+            Route::Snapshot(json!({
+                "limit": 50,
+                "after": "%3",
+                "sort": "-updated_at",
+                "fields": "pane_id,title",
+            }))
+        );
+        assert_eq!(
+            route("GET /v1/snapshot?offset=x HTTP/1.1\r\n"),
+            Route::BadRequest("offset must be a number".to_string())
+        );
+        assert_eq!(
+            route("GET /v1/terminal?pane_id=%253&lines=9999 HTTP/1.1\r\n"),
+            Route::Terminal(json!({"pane_id": "%3", "lines": 9999, "since": null}))
+        );
+        assert_eq!(
+            route("GET /v1/terminal?pane_id=7&since=3-ab12 HTTP/1.1\r\n"),
+            Route::Terminal(json!({"pane_id": "%7", "lines": null, "since": "3-ab12"}))
+        );
+        assert!(matches!(
+            route("GET /v1/terminal HTTP/1.1\r\n"),
+            Route::BadRequest(_)
+        ));
+        assert_eq!(
+            route("POST /v1/snapshot HTTP/1.1\r\n"),
+            Route::MethodNotAllowed
+        );
+        assert_eq!(
+            route("GET /v1/audit?since=2h&target=3&action_type=pane.%2A HTTP/1.1\r\n"),
+            Route::Audit(json!({
+                "since": "2h", "target": "%3", "action_type": "pane.*", "limit": null,
+            }))
+        );
+        assert!(matches!(
+            route("GET /v1/audit?limit=x HTTP/1.1\r\n"),
+            Route::BadRequest(_)
+        ));
+        assert_eq!(
+            route("GET /v1/search?q=panicked+at&target=3,%254&ignore_case=1 HTTP/1.1\r\n"),
+            Route::Search(json!({
+                "q": "panicked at", "pane_ids": ["%3", "%4"], "session": null, "agent": null,
+                "ignore_case": true, "regex": false, "lines": null,
+            }))
+        );
+        assert!(matches!(
+            route("GET /v1/search?q=x&lines=all HTTP/1.1\r\n"),
+            Route::BadRequest(_)
+        ));
+        assert_eq!(route("GET /metrics HTTP/1.1\r\n"), Route::NotFound);
+        assert_eq!(percent_decode("a%2Fb+c%zz%"), "a/b c%zz%");
+    }
+
+    #[test]
+    fn checks_bearer_tokens() {
+        let head = |auth: &str| format!("GET /v1/snapshot HTTP/1.1\r\n{auth}\r\n\r\n");
+        let access = AccessPolicy::new(&AccessSettings {
+            tokens: vec![TokenEntry {
+                name: "auditor".to_string(),
+                scope: Scope::Admin,
+                sha256: token_digest("0ther"),
+            }],
+            ..Default::default()
+        });
+        let scope = |auth: &str| api().scope(&head(auth), &access);
+        assert_eq!(scope("Authorization: Bearer s3cret"), Some(Scope::Read));
+        assert_eq!(scope("authorization:  Bearer s3cret "), Some(Scope::Read));
+        assert_eq!(scope("Authorization: Bearer 0ther"), Some(Scope::Admin));
+        assert_eq!(scope("Authorization: Bearer s3cre"), None);
+        assert_eq!(scope("Authorization: Basic s3cret"), None);
+        assert_eq!(scope("X-Token: s3cret"), None);
+    }
+
+    #[test]
+    fn throttles_failed_tokens_per_peer() {
+        let mut throttle = AuthThrottle::default();
+        let (peer, other) = (
+            "10.0.0.1".parse().expect("ip"),
+            "10.0.0.2".parse().expect("ip"),
+        );
+        let now = Instant::now();
+        for _ in 1..FAILURES_BEFORE_LOCKOUT {
+            assert_eq!(throttle.fail(peer, now), None);
+        }
+        assert_eq!(throttle.locked(peer, now), None);
+        assert_eq!(throttle.fail(peer, now), Some(Duration::from_secs(1)));
+        assert_eq!(throttle.locked(peer, now), Some(Duration::from_secs(1)));
+        assert_eq!(throttle.locked(other, now), None);
+        let later = now + Duration::from_secs(1);
+        assert_eq!(throttle.locked(peer, later), None);
+        assert_eq!(throttle.fail(peer, later), Some(Duration::from_secs(2)));
+        throttle.succeed(peer);
+        assert_eq!(throttle.locked(peer, later), None);
+        assert_eq!(lockout(40), Some(MAX_LOCKOUT));
+
+        for _ in 0..FAILURES_BEFORE_LOCKOUT * 2 {
+            assert_eq!(throttle.admit(other, now, None), Ok(None), "no token sent");
+        }
+        for _ in 1..FAILURES_BEFORE_LOCKOUT {
+            assert_eq!(throttle.admit(other, now, Some(false)), Ok(None));
+        }
+        assert_eq!(
+            throttle.admit(other, now, Some(false)),
+            Ok(Some(Duration::from_secs(1)))
+        );
+        assert_eq!(
+            throttle.admit(other, now, Some(true)),
+            Err(Duration::from_secs(1)),
+            "checked before the valid token resets it"
+        );
+    }
+
+    async fn get(addr: SocketAddr, path: &str, token: Option<&str>) -> String {
+        let auth = token
+            .map(|t| format!("Authorization: Bearer {t}\r\n"))
+            .unwrap_or_default();
+        request(addr, path, &auth).await
+    }
+
+    async fn request(addr: SocketAddr, path: &str, headers: &str) -> String {
+        let mut stream = TcpStream::connect(addr).await.expect("connect");
+        stream
+            .write_all(format!("GET {path} HTTP/1.1\r\nHost: x\r\n{headers}\r\n").as_bytes())
+            .await
+            .expect("write");
+        let mut response = String::new();
+        stream.read_to_string(&mut response).await.expect("read");
+        response
+    }
+
+    #[tokio::test]
+    async fn serves_snapshots_to_token_holders() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.expect("bind");
+        let addr = listener.local_addr().expect("addr");
+        tokio::spawn(serve(
+            listener,
+            api(),
+            Arc::new(Mutex::new(DaemonState::new())),
+        ));
+
+        let denied = get(addr, "/v1/snapshot", None).await;
+        assert!(
+            denied.starts_with("HTTP/1.1 401 Unauthorized\r\n"),
+            "{denied}"
+        );
+        assert!(denied.contains("WWW-Authenticate: Bearer"));
+
+        let snapshot = get(addr, "/v1/snapshot", Some("s3cret")).await;
+        assert!(snapshot.starts_with("HTTP/1.1 200 OK\r\n"), "{snapshot}");
+        let body: Value =
+            serde_json::from_str(snapshot.split_once("\r\n\r\n").expect("body").1).expect("json");
+        assert_eq!(body["panes"], json!([]));
+        let etag = header(&snapshot, "etag").expect("etag").to_string();
+        assert_eq!(etag, format!("\"{}-0\"", std::process::id()));
+        let unchanged = request(
+            addr,
+            "/v1/snapshot",
+            &format!("Authorization: Bearer s3cret\r\nIf-None-Match: \"x\", {etag}\r\n"),
+        )
+        .await;
+        assert!(
+            unchanged.starts_with("HTTP/1.1 304 Not Modified\r\n"),
+            "{unchanged}"
+        );
+        assert!(unchanged.ends_with("\r\n\r\n"), "no body: {unchanged}");
+        let stale = request(
+            addr,
+            "/v1/snapshot",
+            "Authorization: Bearer s3cret\r\nIf-None-Match: \"0-0\"\r\n",
+        )
+        .await;
+        assert!(stale.starts_with("HTTP/1.1 200 OK\r\n"), "{stale}");
+        let page = get(addr, "/v1/snapshot?limit=10&sort=title", Some("s3cret")).await;
+        let body: Value =
+            serde_json::from_str(page.split_once("\r\n\r\n").expect("body").1).expect("json");
+        assert_eq!(body["panes"], json!([]));
+        assert!(
+            body.get("next_offset").is_some_and(Value::is_null),
+            "{body}"
+        );
+        let bad = get(addr, "/v1/snapshot?offset=5", Some("s3cret")).await;
+        assert!(bad.starts_with("HTTP/1.1 400 Bad Request\r\n"), "{bad}");
+
+        let missing = get(addr, "/v1/terminal?pane_id=%251", Some("s3cret")).await;
+        assert!(
+            missing.starts_with("HTTP/1.1 404 Not Found\r\n"),
+            "{missing}"
+        );
+
+        let audit = get(addr, "/v1/audit?since=1h", Some("s3cret")).await;
+        assert!(
+            audit.starts_with("HTTP/1.1 403 Forbidden\r\n"),
+            "the audit trail needs admin: {audit}"
+        );
+    }
+
+    #[tokio::test]
+    async fn slow_clients_are_cut_off_and_connections_bounded() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.expect("bind");
+        let addr = listener.local_addr().expect("addr");
+        let deadline = Duration::from_millis(300);
+        tokio::spawn(serve(
+            listener,
+            RemoteApi {
+                deadline,
+                max_connections: 1,
+                ..api()
+            },
+            Arc::new(Mutex::new(DaemonState::new())),
+        ));
+
+        // One byte at a time, each within REQUEST_TIMEOUT of the last.
+        let started = Instant::now();
+        let mut slow = TcpStream::connect(addr).await.expect("connect");
+        let drip = async {
+            for byte in b"GET /v1/snapshot HTTP/1.1\r\n".iter().cycle() {
+                if slow.write_all(&[*byte]).await.is_err() {
+                    break;
+                }
+                tokio::time::sleep(Duration::from_millis(20)).await;
+            }
+        };
+        // The second client waits for the only slot until the first is cut off.
+        let queued = get(addr, "/v1/snapshot", Some("s3cret"));
+        let (_, queued) = tokio::join!(tokio::time::timeout(Duration::from_secs(5), drip), queued);
+        assert!(queued.starts_with("HTTP/1.1 200 OK\r\n"), "{queued}");
+        assert!(
+            started.elapsed() >= deadline,
+            "served only after the slow one"
+        );
+        assert!(
+            started.elapsed() < Duration::from_secs(5),
+            "slow one cut off"
+        );
+    }
+
+    #[tokio::test]
+    async fn locks_out_peers_guessing_tokens() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.expect("bind");
+        let addr = listener.local_addr().expect("addr");
+        tokio::spawn(serve(
+            listener,
+            api(),
+            Arc::new(Mutex::new(DaemonState::new())),
+        ));
+
+        for _ in 0..=FAILURES_BEFORE_LOCKOUT {
+            let anonymous = get(addr, "/v1/snapshot", None).await;
+            assert!(
+                anonymous.starts_with("HTTP/1.1 401 Unauthorized\r\n"),
+                "{anonymous}"
+            );
+        }
+        for guess in 0..FAILURES_BEFORE_LOCKOUT {
+            let denied = get(addr, "/v1/snapshot", Some(&format!("guess{guess}"))).await;
+            assert!(
+                denied.starts_with("HTTP/1.1 401 Unauthorized\r\n"),
+                "{denied}"
+            );
+        }
+        let locked = get(addr, "/v1/snapshot", Some("s3cret")).await;
+        assert!(
+            locked.starts_with("HTTP/1.1 429 Too Many Requests\r\n"),
+            "even the right token waits: {locked}"
+        );
+        assert_eq!(header(&locked, "retry-after"), Some("1"));
+    }
+
+    #[tokio::test]
+    async fn serves_the_audit_trail_to_admin_tokens() {
+        let listener = TcpListener::bind("127.0.0.1:0").await.expect("bind");
+        let addr = listener.local_addr().expect("addr");
+        let mut state = DaemonState::new();
+        state.access = AccessPolicy::new(&AccessSettings {
+            tokens: vec![TokenEntry {
+                name: "auditor".to_string(),
+                scope: Scope::Admin,
+                sha256: token_digest("0ther"),
+            }],
+            ..Default::default()
+        });
+        tokio::spawn(serve(listener, api(), Arc::new(Mutex::new(state))));
+
+        let audit = get(addr, "/v1/audit?since=1h", Some("0ther")).await;
+        assert!(audit.starts_with("HTTP/1.1 200 OK\r\n"), "{audit}");
+        let body: Value =
+            serde_json::from_str(audit.split_once("\r\n\r\n").expect("body").1).expect("json");
+        assert_eq!(body, json!([]));
+        let bad = get(addr, "/v1/audit?since=soon", Some("0ther")).await;
+        assert!(bad.starts_with("HTTP/1.1 400 Bad Request\r\n"), "{bad}");
+        let snapshot = get(addr, "/v1/snapshot", Some("0ther")).await;
+        assert!(snapshot.starts_with("HTTP/1.1 200 OK\r\n"), "{snapshot}");
+    }
+
+    #[test]
+    fn load_reports_missing_files() {
+        let dir = std::env::temp_dir().join(format!("agtmux-remote-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).expect("dir");
+        let token_file = dir.join("token");
+        std::fs::write(&token_file, "s3cret\n").expect("write");
+        let settings = RemoteSettings {
+            addr: "127.0.0.1:7300".parse().expect("addr"),
+            token_file: token_file.clone(),
+            scope: Scope::Read,
+            tls: None,
+        };
+        assert_eq!(RemoteApi::load(&settings).expect("loads").token, "s3cret");
+
+        let tls = RemoteSettings {
+            tls: Some((dir.join("cert.pem"), dir.join("key.pem"))),
+            ..settings.clone()
+        };
+        let err = RemoteApi::load(&tls).err().expect("no certificate");
+        assert!(err.to_string().contains("remote.tls_cert"), "{err}");
+
+        std::fs::write(&token_file, "\n").expect("write");
+        assert!(RemoteApi::load(&settings).is_err(), "empty token");
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
@@ -0,0 +1,504 @@
+//! Auto-responder (`[responder]`): answer approval prompts of unattended
+//! agents. When a managed pane enters `WaitingApproval` and a rule matches
+//! it, the rule's `send` text (plus Enter) or `key` is typed into the pane,
+//! once per approval episode.
+//!
+//! ```toml
+//! [responder]
+//! enabled = true            # global kill switch; also `responder.set_enabled`
+//!
+//! [[responder.rules]]
+//! name = "codex-yes"
+//! provider = "codex"
+//! pattern = "Allow command?"  # substring of the pane's last capture
+//! label = "overnight"         # only panes labelled so (`agtmux label`)
+//! key = "y"
+//! ```
+//!
+//! The first matching rule wins. A rule needs at least one of `provider`,
+//! `session`, `label` and `pattern`; one that should answer every prompt
+//! says so with `match_all = true`. Every response is kept in an in-memory
+//! audit trail (`responder.status`, last [`AUDIT_CAPACITY`]) and logged.
+//!
+//! Switching the responder off with `responder.set_enabled` holds across
+//! reloads: only `responder.set_enabled true` turns it back on.
+
+use std::collections::{BTreeMap, HashMap, VecDeque};
+
+use agtmux_core_v5::types::{ActivityState, PanePresence, PaneRuntimeState};
+use agtmux_tmux_v5::TmuxPaneInfo;
+use chrono::{DateTime, Utc};
+
+/// Audit entries kept for `responder.status`.
+pub const AUDIT_CAPACITY: usize = 200;
+
+/// `[responder]` section.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct ResponderSettings {
+    /// Kill switch; unset = enabled when rules exist.
+    pub enabled: Option<bool>,
+    pub rules: Vec<ResponderRule>,
+}
+
+/// One `[[responder.rules]]` entry; exactly one of `send` / `key`.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct ResponderRule {
+    pub name: String,
+    /// Only panes of this provider (`claude`, `codex`, ...).
+    pub provider: Option<String>,
+    /// Only panes in this tmux session.
+    pub session: Option<String>,
+    /// Only panes with this label.
+    pub label: Option<String>,
+    /// Only when a line of the pane's latest capture contains this text.
+    pub pattern: Option<String>,
+    /// Text typed literally, then Enter.
+    pub send: Option<String>,
+    /// tmux key name (`y`, `Enter`, `Down`, ...).
+    pub key: Option<String>,
+    /// Answer every approval prompt; required when no criterion is set.
+    #[serde(default)]
+    pub match_all: bool,
+}
+
+impl ResponderSettings {
+    pub fn validate(&self) -> anyhow::Result<()> {
+        for (i, rule) in self.rules.iter().enumerate() {
+            if rule.name.trim().is_empty() {
+                anyhow::bail!("responder.rules[{i}].name must not be empty");
+            }
+            if self.rules[..i].iter().any(|r| r.name == rule.name) {
+                anyhow::bail!("duplicate responder rule name {:?}", rule.name);
+            }
+            if rule.send.is_some() == rule.key.is_some() {
+                anyhow::bail!(
+                    "responder rule {:?}: set exactly one of send, key",
+                    rule.name
+                );
+            }
+            if rule.pattern.as_deref() == Some("") {
+                anyhow::bail!("responder rule {:?}: pattern must not be empty", rule.name);
+            }
+            let scoped = [&rule.provider, &rule.session, &rule.label, &rule.pattern]
+                .iter()
+                .any(|c| c.is_some());
+            if scoped == rule.match_all {
+                anyhow::bail!(
+                    "responder rule {:?}: set one of provider, session, label, pattern, or match_all = true alone",
+                    rule.name
+                );
+            }
+        }
+        Ok(())
+    }
+
+    /// Effective kill switch state.
+    pub fn is_enabled(&self) -> bool {
+        self.enabled.unwrap_or(true)
+    }
+}
+
+impl ResponderRule {
+    /// The matching capture line when a pattern is set (`Some("")` when
+    /// there is none), or None if the rule does not match.
+    fn matches(
+        &self,
+        pane: &PaneRuntimeState,
+        tmux: Option<&TmuxPaneInfo>,
+        label: Option<&str>,
+        capture: &[String],
+    ) -> Option<String> {
+        let scoped = self
+            .provider
+            .as_deref()
+            .is_none_or(|p| pane.provider.is_some_and(|q| q.as_str() == p))
+            && self
+                .session
+                .as_deref()
+                .is_none_or(|s| tmux.is_some_and(|t| t.session_name == s))
+            && self.label.as_deref().is_none_or(|l| label == Some(l));
+        if !scoped {
+            return None;
+        }
+        match &self.pattern {
+            None => Some(String::new()),
+            Some(pattern) => capture
+                .iter()
+                .rev()
+                .find(|line| line.contains(pattern.as_str()))
+                .map(|line| line.trim().to_string()),
+        }
+    }
+
+    fn tmux_args(&self, pane_id: &str) -> Vec<String> {
+        let target = ["send-keys", "-t", pane_id].map(String::from);
+        match (&self.send, &self.key) {
+            (Some(text), _) => {
+                let mut args = target.to_vec();
+                args.extend(["-l".to_string(), text.clone(), ";".to_string()]);
+                args.extend(target);
+                args.push("Enter".to_string());
+                args
+            }
+            (None, key) => {
+                let mut args = target.to_vec();
+                args.push(key.clone().unwrap_or_default());
+                args
+            }
+        }
+    }
+}
+
+/// Audit trail entry: one response typed into a pane.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Serialize)]
+pub struct Response {
+    pub id: u64,
+    pub rule: String,
+    pub pane_id: String,
+    pub session_name: Option<String>,
+    pub provider: Option<String>,
+    /// `send` text or `key` name.
+    pub sent: String,
+    /// Capture line that matched the rule's `pattern`.
+    pub matched: Option<String>,
+    pub at: DateTime<Utc>,
+}
+
+/// Keystrokes to type into a pane; run off the lock via the exec pool.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Keystrokes {
+    pub pane_id: String,
+    pub args: Vec<String>,
+}
+
+/// Evaluates the rules against the approval prompts of each tick.
+#[derive(Debug, Default)]
+pub struct AutoResponder {
+    rules: Vec<ResponderRule>,
+    enabled: bool,
+    /// Switched off by `responder.set_enabled false`; reloads keep it off.
+    switched_off: bool,
+    next_id: u64,
+    /// Panes answered in their current `WaitingApproval` episode.
+    answered: HashMap<String, String>,
+    audit: VecDeque<Response>,
+    /// Responses per rule since the daemon started.
+    counts: BTreeMap<String, u64>,
+}
+
+impl AutoResponder {
+    pub fn new(settings: ResponderSettings) -> Self {
+        let mut responder = Self {
+            next_id: 1,
+            ..Self::default()
+        };
+        responder.set_settings(settings);
+        responder
+    }
+
+    /// Replace the rules and the kill switch (SIGHUP). The audit trail is
+    /// kept, and so is a runtime switch-off.
+    pub fn set_settings(&mut self, settings: ResponderSettings) {
+        if self.switched_off && settings.is_enabled() {
+            tracing::warn!(
+                "[responder] enables the auto-responder, but it was switched off at runtime; \
+                 it stays off until `agtmux responder on`"
+            );
+        }
+        self.enabled = settings.is_enabled() && !self.switched_off;
+        self.rules = settings.rules;
+        self.counts
+            .retain(|name, _| self.rules.iter().any(|r| &r.name == name));
+    }
+
+    /// Kill switch (`responder.set_enabled`).
+    pub fn set_enabled(&mut self, enabled: bool) {
+        if enabled != self.enabled {
+            tracing::info!(enabled, "auto-responder switched");
+        }
+        self.enabled = enabled;
+        self.switched_off = !enabled;
+    }
+
+    pub fn is_enabled(&self) -> bool {
+        self.enabled
+    }
+
+    /// Keystrokes for panes that entered `WaitingApproval` and match a rule.
+    /// `captures` holds this tick's capture lines by pane id.
+    pub fn observe(
+        &mut self,
+        panes: &[&PaneRuntimeState],
+        tmux: &[TmuxPaneInfo],
+        labels: &HashMap<String, String>,
+        captures: &HashMap<&str, &[String]>,
+        now: DateTime<Utc>,
+    ) -> Vec<Keystrokes> {
+        let waiting: Vec<&PaneRuntimeState> = panes
+            .iter()
+            .copied()
+            .filter(|p| {
+                p.presence == PanePresence::Managed
+                    && p.activity_state == ActivityState::WaitingApproval
+            })
+            .collect();
+        self.answered.retain(|pane_id, _| {
+            waiting
+                .iter()
+                .any(|p| &p.pane_instance_id.pane_id == pane_id)
+        });
+        if !self.enabled {
+            return Vec::new();
+        }
+
+        let mut keystrokes = Vec::new();
+        for pane in waiting {
+            let pane_id = &pane.pane_instance_id.pane_id;
+            if self.answered.contains_key(pane_id) {
+                continue;
+            }
+            let info = tmux.iter().find(|t| &t.pane_id == pane_id);
+            let capture = captures.get(pane_id.as_str()).copied().unwrap_or(&[]);
+            let label = labels.get(pane_id).map(String::as_str);
+            let Some((rule, matched)) = self
+                .rules
+                .iter()
+                .find_map(|r| r.matches(pane, info, label, capture).map(|m| (r, m)))
+            else {
+                continue;
+            };
+            let response = Response {
+                id: self.next_id,
+                rule: rule.name.clone(),
+                pane_id: pane_id.clone(),
+                session_name: info.map(|t| t.session_name.clone()),
+                provider: pane.provider.map(|p| p.as_str().to_string()),
+                sent: rule
+                    .send
+                    .clone()
+                    .or_else(|| rule.key.clone())
+                    .unwrap_or_default(),
+                matched: rule.pattern.is_some().then_some(matched),
+                at: now,
+            };
+            tracing::info!(
+                rule = %response.rule,
+                pane_id = %response.pane_id,
+                sent = %response.sent,
+                "auto-responder answered approval prompt"
+            );
+            keystrokes.push(Keystrokes {
+                pane_id: pane_id.clone(),
+                args: rule.tmux_args(pane_id),
+            });
+            self.next_id += 1;
+            *self.counts.entry(rule.name.clone()).or_default() += 1;
+            self.answered.insert(pane_id.clone(), rule.name.clone());
+            if self.audit.len() == AUDIT_CAPACITY {
+                self.audit.pop_front();
+            }
+            self.audit.push_back(response);
+        }
+        keystrokes
+    }
+
+    /// `responder.status`: switch state, rules with their response counts
+    /// and the audit trail (oldest first), optionally of one rule only.
+    pub fn status(&self, rule: Option<&str>) -> serde_json::Value {
+        let rules: Vec<serde_json::Value> = self
+            .rules
+            .iter()
+            .map(|r| {
+                serde_json::json!({
+                    "name": r.name,
+                    "responses": self.counts.get(&r.name).copied().unwrap_or(0),
+                })
+            })
+            .collect();
+        let audit: Vec<&Response> = self
+            .audit
+            .iter()
+            .filter(|r| rule.is_none_or(|name| r.rule == name))
+            .collect();
+        serde_json::json!({
+            "enabled": self.enabled,
+            "switched_off": self.switched_off,
+            "rules": rules,
+            "audit": audit,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support;
+    use agtmux_core_v5::types::Provider;
+
+    fn pane(pane_id: &str, provider: Provider, state: ActivityState) -> PaneRuntimeState {
+        PaneRuntimeState {
+            provider: Some(provider),
+            ..test_support::pane(pane_id, state)
+        }
+    }
+
+    fn settings(toml: &str) -> ResponderSettings {
+        #[derive(serde::Deserialize)]
+        struct File {
+            responder: ResponderSettings,
+        }
+        let settings = toml::from_str::<File>(toml).expect("valid").responder;
+        settings.validate().expect("valid rules");
+        settings
+    }
+
+    #[test]
+    fn answers_matching_prompt_once_per_episode() {
+        let mut responder = AutoResponder::new(settings(
+            r#"
+            [[responder.rules]]
+            name = "codex-yes"
+            provider = "codex"
+            pattern = "Allow command?"
+            key = "y"
+            [[responder.rules]]
+            name = "claude-continue"
+            provider = "claude"
+            label = "overnight"
+            send = "yes, continue"
+            "#,
+        ));
+        let codex = pane("%1", Provider::Codex, ActivityState::WaitingApproval);
+        let claude = pane("%2", Provider::Claude, ActivityState::WaitingApproval);
+        let prompt = vec![
+            "$ rm -rf build".to_string(),
+            "  Allow command? [y/n]".to_string(),
+        ];
+        let captures: HashMap<&str, &[String]> = HashMap::from([("%1", prompt.as_slice())]);
+        let mut labels = HashMap::new();
+        let now = Utc::now();
+
+        let sent = responder.observe(&[&codex, &claude], &[], &labels, &captures, now);
+        assert_eq!(
+            sent,
+            [Keystrokes {
+                pane_id: "%1".to_string(),
+                args: ["send-keys", "-t", "%1", "y"].map(String::from).to_vec(),
+            }],
+            "claude pane is not labelled"
+        );
+        assert!(
+            responder
+                .observe(&[&codex], &[], &labels, &captures, now)
+                .is_empty(),
+            "still the same prompt"
+        );
+
+        labels.insert("%2".to_string(), "overnight".to_string());
+        let sent = responder.observe(&[&codex, &claude], &[], &labels, &captures, now);
+        assert_eq!(
+            sent[0].args,
+            [
+                "send-keys",
+                "-t",
+                "%2",
+                "-l",
+                "yes, continue",
+                ";",
+                "send-keys",
+                "-t",
+                "%2",
+                "Enter"
+            ]
+        );
+
+        // Leaving the state re-arms the pane.
+        let running = pane("%1", Provider::Codex, ActivityState::Running);
+        responder.observe(&[&running], &[], &labels, &captures, now);
+        assert_eq!(
+            responder
+                .observe(&[&codex], &[], &labels, &captures, now)
+                .len(),
+            1
+        );
+
+        let status = responder.status(Some("codex-yes"));
+        assert_eq!(status["rules"][0]["responses"], 2);
+        assert_eq!(status["audit"].as_array().map(Vec::len), Some(2));
+        assert_eq!(status["audit"][0]["matched"], "Allow command? [y/n]");
+    }
+
+    #[test]
+    fn kill_switch_stops_responses() {
+        let mut responder = AutoResponder::new(settings(
+            "[responder]\nenabled = false\n[[responder.rules]]\nname = \"any\"\nmatch_all = true\nkey = \"Enter\"\n",
+        ));
+        let waiting = pane("%1", Provider::Claude, ActivityState::WaitingApproval);
+        let none = HashMap::new();
+        let now = Utc::now();
+        assert!(
+            responder
+                .observe(&[&waiting], &[], &none, &HashMap::new(), now)
+                .is_empty()
+        );
+        responder.set_enabled(true);
+        assert_eq!(
+            responder
+                .observe(&[&waiting], &[], &none, &HashMap::new(), now)
+                .len(),
+            1
+        );
+    }
+
+    #[test]
+    fn runtime_switch_off_survives_reload() {
+        let rules = "[[responder.rules]]\nname = \"any\"\nmatch_all = true\nkey = \"Enter\"\n";
+        let mut responder = AutoResponder::new(settings(rules));
+        assert!(responder.is_enabled());
+        responder.set_enabled(false);
+        responder.set_settings(settings(rules));
+        assert!(!responder.is_enabled(), "SIGHUP does not re-arm it");
+        assert_eq!(responder.status(None)["switched_off"], true);
+        responder.set_enabled(true);
+        responder.set_settings(settings(rules));
+        assert!(responder.is_enabled());
+    }
+
+    #[test]
+    fn rejects_invalid_rules() {
+        let parse = |toml: &str| {
+            #[derive(serde::Deserialize)]
+            struct File {
+                responder: ResponderSettings,
+            }
+            toml::from_str::<File>(toml).expect("valid toml").responder
+        };
+        assert!(
+            parse("[[responder.rules]]\nname = \"a\"\n")
+                .validate()
+                .is_err()
+        );
+        assert!(
+            parse("[[responder.rules]]\nname = \"a\"\nkey = \"y\"\nsend = \"y\"\n")
+                .validate()
+                .is_err()
+        );
+        assert!(
+            parse("[[responder.rules]]\nname = \"a\"\nlabel = \"x\"\nkey = \"y\"\n[[responder.rules]]\nname = \"a\"\nlabel = \"x\"\nkey = \"n\"\n")
+                .validate()
+                .is_err()
+        );
+        let unscoped = parse("[[responder.rules]]\nname = \"a\"\nkey = \"y\"\n").validate();
+        assert!(
+            unscoped.is_err_and(|e| e.to_string().contains("match_all")),
+            "answers every prompt without saying so"
+        );
+        assert!(
+            parse("[[responder.rules]]\nname = \"a\"\nprovider = \"codex\"\nmatch_all = true\nkey = \"y\"\n")
+                .validate()
+                .is_err()
+        );
+    }
+}
@@ -0,0 +1,405 @@
+//! Auto-restart (`[[auto_restart]]`): respawn agent panes whose process
+//! exited with an error, with bounded retries and exponential backoff.
+//!
+//! ```toml
+//! [[auto_restart]]
+//! name = "flaky-codex"
+//! provider = "codex"
+//! label = "overnight"
+//! max_retries = 3       # then give up until the pane is healthy again
+//! backoff_secs = 10     # 10s, 20s, 40s, ... (capped at MAX_BACKOFF_SECS)
+//! ```
+//!
+//! Only panes kept after their process exits can be respawned, so the
+//! tmux option `remain-on-exit` must be on for them. A dead pane (tmux
+//! `#{pane_dead}`) with a non-zero (or signal) exit status that last ran
+//! an agent is restarted with `respawn-pane`, which re-runs its original
+//! command. A pane that stays up for [`STABLE_SECS`] after a restart gets
+//! its retries back. Each restart or give-up is logged and recorded for
+//! `restart.events`.
+
+use std::collections::{HashMap, VecDeque};
+
+use agtmux_core_v5::types::{PanePresence, PaneRuntimeState};
+use agtmux_tmux_v5::TmuxPaneInfo;
+use chrono::{DateTime, Duration, Utc};
+
+/// Default `max_retries`.
+pub const DEFAULT_MAX_RETRIES: u32 = 3;
+/// Default `backoff_secs`: delay before the first restart.
+pub const DEFAULT_BACKOFF_SECS: u64 = 10;
+/// Upper bound of the doubled backoff.
+pub const MAX_BACKOFF_SECS: u64 = 600;
+/// Uptime after a restart that resets the retry count.
+pub const STABLE_SECS: i64 = 600;
+/// Events kept for `restart.events`.
+pub const EVENT_CAPACITY: usize = 200;
+
+/// One `[[auto_restart]]` entry; criteria left unset match any pane.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct RestartPolicy {
+    pub name: String,
+    /// Only panes that ran this provider (`claude`, `codex`, ...).
+    pub provider: Option<String>,
+    /// Only panes in this tmux session.
+    pub session: Option<String>,
+    /// Only panes with this label.
+    pub label: Option<String>,
+    pub max_retries: Option<u32>,
+    pub backoff_secs: Option<u64>,
+}
+
+impl RestartPolicy {
+    fn matches(&self, provider: &str, tmux: &TmuxPaneInfo, label: Option<&str>) -> bool {
+        self.provider.as_deref().is_none_or(|p| p == provider)
+            && self
+                .session
+                .as_deref()
+                .is_none_or(|s| tmux.session_name == s)
+            && self.label.as_deref().is_none_or(|l| label == Some(l))
+    }
+
+    /// Delay before restart number `attempt` (0-based).
+    fn backoff(&self, attempt: u32) -> Duration {
+        let base = self.backoff_secs.unwrap_or(DEFAULT_BACKOFF_SECS);
+        let secs = base
+            .saturating_mul(1u64 << attempt.min(20))
+            .min(MAX_BACKOFF_SECS);
+        Duration::seconds(secs as i64)
+    }
+}
+
+/// Reject unnamed / duplicate policies and zero retries.
+pub fn validate_policies(policies: &[RestartPolicy]) -> anyhow::Result<()> {
+    for (i, policy) in policies.iter().enumerate() {
+        if policy.name.trim().is_empty() {
+            anyhow::bail!("auto_restart[{i}].name must not be empty");
+        }
+        if policies[..i].iter().any(|p| p.name == policy.name) {
+            anyhow::bail!("duplicate auto_restart name {:?}", policy.name);
+        }
+        if policy.max_retries == Some(0) {
+            anyhow::bail!(
+                "auto_restart {:?}: max_retries must be >= 1 (remove the entry to disable)",
+                policy.name
+            );
+        }
+    }
+    Ok(())
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, serde::Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum RestartOutcome {
+    Restarted,
+    /// `max_retries` used up; the pane stays dead.
+    GaveUp,
+}
+
+/// `restart.events` entry.
+#[derive(Debug, Clone, PartialEq, Eq, serde::Serialize)]
+pub struct RestartEvent {
+    pub id: u64,
+    pub policy: String,
+    pub pane_id: String,
+    pub session_name: String,
+    pub provider: String,
+    /// Exit status of the dead process; None if it was killed by a signal.
+    pub exit_status: Option<i32>,
+    /// 1-based restart number (for `gave_up`, the retries used).
+    pub attempt: u32,
+    pub outcome: RestartOutcome,
+    pub at: DateTime<Utc>,
+}
+
+/// tmux command respawning a dead pane; run off the lock via the exec pool.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Respawn {
+    pub pane_id: String,
+    pub args: Vec<String>,
+}
+
+#[derive(Debug, Default)]
+struct Retries {
+    attempts: u32,
+    /// When the pending restart of a dead pane is due.
+    due: Option<DateTime<Utc>>,
+    last_restart: Option<DateTime<Utc>>,
+    gave_up: bool,
+}
+
+/// Tracks agent panes and their retries across ticks.
+#[derive(Debug, Default)]
+pub struct Restarter {
+    policies: Vec<RestartPolicy>,
+    /// Provider last seen running in each live pane.
+    agents: HashMap<String, String>,
+    retries: HashMap<String, Retries>,
+    events: VecDeque<RestartEvent>,
+    next_id: u64,
+}
+
+impl Restarter {
+    pub fn new(policies: Vec<RestartPolicy>) -> Self {
+        Self {
+            policies,
+            next_id: 1,
+            ..Self::default()
+        }
+    }
+
+    /// Replace the policies (SIGHUP); retry counts and events are kept.
+    pub fn set_policies(&mut self, policies: Vec<RestartPolicy>) {
+        self.policies = policies;
+    }
+
+    /// Respawns due this tick.
+    pub fn observe(
+        &mut self,
+        panes: &[&PaneRuntimeState],
+        tmux: &[TmuxPaneInfo],
+        labels: &HashMap<String, String>,
+        now: DateTime<Utc>,
+    ) -> Vec<Respawn> {
+        self.agents
+            .retain(|pane_id, _| tmux.iter().any(|t| &t.pane_id == pane_id));
+        self.retries
+            .retain(|pane_id, _| tmux.iter().any(|t| &t.pane_id == pane_id));
+        if self.policies.is_empty() {
+            return Vec::new();
+        }
+
+        let mut respawns = Vec::new();
+        for info in tmux {
+            let pane_id = &info.pane_id;
+            if !info.pane_dead {
+                let managed = panes.iter().find(|p| {
+                    &p.pane_instance_id.pane_id == pane_id && p.presence == PanePresence::Managed
+                });
+                match managed.and_then(|p| p.provider) {
+                    Some(provider) => {
+                        self.agents
+                            .insert(pane_id.clone(), provider.as_str().to_string());
+                    }
+                    None => {
+                        self.agents.remove(pane_id);
+                    }
+                }
+                let stable = self.retries.get(pane_id).is_some_and(|r| {
+                    r.gave_up
+                        || r.last_restart
+                            .is_none_or(|t| (now - t).num_seconds() >= STABLE_SECS)
+                });
+                if stable {
+                    self.retries.remove(pane_id);
+                }
+                continue;
+            }
+            if info.pane_dead_status == Some(0) {
+                continue;
+            }
+            let Some(provider) = self.agents.get(pane_id).cloned() else {
+                continue;
+            };
+            let label = labels.get(pane_id).map(String::as_str);
+            let Some(policy) = self
+                .policies
+                .iter()
+                .find(|p| p.matches(&provider, info, label))
+            else {
+                continue;
+            };
+            let retries = self.retries.entry(pane_id.clone()).or_default();
+            if retries.gave_up {
+                continue;
+            }
+            let max = policy.max_retries.unwrap_or(DEFAULT_MAX_RETRIES);
+            let outcome = if retries.attempts >= max {
+                retries.gave_up = true;
+                tracing::warn!(
+                    policy = %policy.name,
+                    pane_id = %pane_id,
+                    "auto-restart gave up after {max} restart(s)"
+                );
+                RestartOutcome::GaveUp
+            } else {
+                let due = *retries
+                    .due
+                    .get_or_insert_with(|| now + policy.backoff(retries.attempts));
+                if due > now {
+                    continue;
+                }
+                retries.attempts += 1;
+                retries.due = None;
+                retries.last_restart = Some(now);
+                tracing::info!(
+                    policy = %policy.name,
+                    pane_id = %pane_id,
+                    exit_status = ?info.pane_dead_status,
+                    attempt = retries.attempts,
+                    "auto-restart respawning pane"
+                );
+                respawns.push(Respawn {
+                    pane_id: pane_id.clone(),
+                    args: ["respawn-pane", "-t", pane_id].map(String::from).to_vec(),
+                });
+                RestartOutcome::Restarted
+            };
+            let event = RestartEvent {
+                id: self.next_id,
+                policy: policy.name.clone(),
+                pane_id: pane_id.clone(),
+                session_name: info.session_name.clone(),
+                provider,
+                exit_status: info.pane_dead_status,
+                attempt: retries.attempts,
+                outcome,
+                at: now,
+            };
+            self.next_id += 1;
+            if self.events.len() == EVENT_CAPACITY {
+                self.events.pop_front();
+            }
+            self.events.push_back(event);
+        }
+        respawns
+    }
+
+    /// Restart events, oldest first.
+    pub fn events(&self) -> impl Iterator<Item = &RestartEvent> {
+        self.events.iter()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support;
+    use agtmux_core_v5::types::{ActivityState, Provider};
+
+    fn agent(pane_id: &str) -> PaneRuntimeState {
+        PaneRuntimeState {
+            provider: Some(Provider::Codex),
+            ..test_support::pane(pane_id, ActivityState::Running)
+        }
+    }
+
+    fn tmux_pane(dead_status: Option<Option<i32>>) -> TmuxPaneInfo {
+        TmuxPaneInfo {
+            pane_id: "%1".to_string(),
+            session_name: "work".to_string(),
+            pane_dead: dead_status.is_some(),
+            pane_dead_status: dead_status.flatten(),
+            ..Default::default()
+        }
+    }
+
+    fn policy() -> RestartPolicy {
+        RestartPolicy {
+            name: "codex".to_string(),
+            provider: Some("codex".to_string()),
+            session: None,
+            label: None,
+            max_retries: Some(2),
+            backoff_secs: Some(10),
+        }
+    }
+
+    #[test]
+    fn restarts_with_backoff_then_gives_up() {
+        let mut restarter = Restarter::new(vec![policy()]);
+        let labels = HashMap::new();
+        let t0 = Utc::now();
+        let live = agent("%1");
+        assert!(
+            restarter
+                .observe(&[&live], &[tmux_pane(None)], &labels, t0)
+                .is_empty()
+        );
+
+        let dead = [tmux_pane(Some(Some(1)))];
+        assert!(
+            restarter.observe(&[], &dead, &labels, t0).is_empty(),
+            "waits for the first backoff"
+        );
+        let respawns = restarter.observe(&[], &dead, &labels, t0 + Duration::seconds(10));
+        assert_eq!(respawns[0].args, ["respawn-pane", "-t", "%1"]);
+
+        // Crashes again right away: the second restart waits twice as long.
+        let t1 = t0 + Duration::seconds(11);
+        assert!(restarter.observe(&[], &dead, &labels, t1).is_empty());
+        assert!(
+            restarter
+                .observe(&[], &dead, &labels, t1 + Duration::seconds(19))
+                .is_empty()
+        );
+        assert_eq!(
+            restarter
+                .observe(&[], &dead, &labels, t1 + Duration::seconds(20))
+                .len(),
+            1
+        );
+        let t2 = t1 + Duration::seconds(21);
+        assert!(restarter.observe(&[], &dead, &labels, t2).is_empty());
+        assert!(
+            restarter
+                .observe(&[], &dead, &labels, t2 + Duration::seconds(3600))
+                .is_empty()
+        );
+
+        let outcomes: Vec<(RestartOutcome, u32)> =
+            restarter.events().map(|e| (e.outcome, e.attempt)).collect();
+        assert_eq!(
+            outcomes,
+            [
+                (RestartOutcome::Restarted, 1),
+                (RestartOutcome::Restarted, 2),
+                (RestartOutcome::GaveUp, 2),
+            ]
+        );
+    }
+
+    #[test]
+    fn ignores_clean_exits_and_non_agents() {
+        let mut restarter = Restarter::new(vec![RestartPolicy {
+            backoff_secs: Some(0),
+            ..policy()
+        }]);
+        let labels = HashMap::new();
+        let now = Utc::now();
+        assert!(
+            restarter
+                .observe(&[], &[tmux_pane(Some(Some(1)))], &labels, now)
+                .is_empty(),
+            "never seen running an agent"
+        );
+
+        let live = agent("%1");
+        restarter.observe(&[&live], &[tmux_pane(None)], &labels, now);
+        assert!(
+            restarter
+                .observe(&[], &[tmux_pane(Some(Some(0)))], &labels, now)
+                .is_empty(),
+            "exit status 0"
+        );
+        assert_eq!(
+            restarter
+                .observe(&[], &[tmux_pane(Some(None))], &labels, now)
+                .len(),
+            1,
+            "killed by a signal"
+        );
+    }
+
+    #[test]
+    fn validates_policies() {
+        assert!(validate_policies(&[policy()]).is_ok());
+        assert!(validate_policies(&[policy(), policy()]).is_err());
+        let zero = RestartPolicy {
+            max_retries: Some(0),
+            ..policy()
+        };
+        assert!(validate_policies(&[zero]).is_err());
+    }
+}
@@ -0,0 +1,65 @@
+//! Process and tokio runtime metrics for the `debug.metrics` RPC (gated by
+//! the `debug_metrics` feature). Enough to tell a CPU or memory spike in the
+//! poll pipeline from a stuck runtime; for real profiles attach `perf`.
+
+/// Process metrics from `/proc/self` (Linux); empty elsewhere.
+pub fn process_metrics() -> serde_json::Value {
+    let status = std::fs::read_to_string("/proc/self/status").unwrap_or_default();
+    let stat = std::fs::read_to_string("/proc/self/stat").unwrap_or_default();
+    let (user_ticks, system_ticks) = parse_cpu_ticks(&stat).unzip();
+    serde_json::json!({
+        "pid": std::process::id(),
+        "rss_kb": status_field(&status, "VmRSS"),
+        "peak_rss_kb": status_field(&status, "VmHWM"),
+        "threads": status_field(&status, "Threads"),
+        // Clock ticks (USER_HZ, 100/s on Linux).
+        "cpu_user_ticks": user_ticks,
+        "cpu_system_ticks": system_ticks,
+    })
+}
+
+/// Metrics of the tokio runtime the caller runs on.
+pub fn tokio_metrics() -> serde_json::Value {
+    let metrics = tokio::runtime::Handle::current().metrics();
+    serde_json::json!({
+        "workers": metrics.num_workers(),
+        "alive_tasks": metrics.num_alive_tasks(),
+        "global_queue_depth": metrics.global_queue_depth(),
+    })
+}
+
+/// Numeric value of a `/proc/self/status` line such as `VmRSS:  1234 kB`.
+fn status_field(status: &str, key: &str) -> Option<u64> {
+    status.lines().find_map(|line| {
+        let value = line.strip_prefix(key)?.strip_prefix(':')?;
+        value.split_whitespace().next()?.parse().ok()
+    })
+}
+
+/// `(utime, stime)` from `/proc/self/stat`. Fields are counted after the
+/// closing paren of the command name, which may itself contain spaces.
+fn parse_cpu_ticks(stat: &str) -> Option<(u64, u64)> {
+    let rest = &stat[stat.rfind(')')? + 1..];
+    let mut fields = rest.split_whitespace().skip(11);
+    let user = fields.next()?.parse().ok()?;
+    let system = fields.next()?.parse().ok()?;
+    Some((user, system))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_proc_status_and_stat() {
+        let status = "Name:\tagtmux\nVmHWM:\t  20480 kB\nVmRSS:\t  10240 kB\nThreads:\t7\n";
+        assert_eq!(status_field(status, "VmRSS"), Some(10240));
+        assert_eq!(status_field(status, "VmHWM"), Some(20480));
+        assert_eq!(status_field(status, "Threads"), Some(7));
+        assert_eq!(status_field(status, "VmSwap"), None);
+
+        let stat = "42 (agt mux) S 1 42 42 0 -1 4194560 500 0 0 0 37 11 0 0 20 0 7 0";
+        assert_eq!(parse_cpu_ticks(stat), Some((37, 11)));
+        assert_eq!(parse_cpu_ticks(""), None);
+    }
+}
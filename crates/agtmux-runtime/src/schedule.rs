@@ -0,0 +1,230 @@
+//! Scheduled sends: `pane.send` with `at` (RFC 3339, or `2024-06-01T03:00Z`)
+//! or `after` (`90s`, `10m`, `2h`, `1d`) is parked here instead of run, and
+//! the poll loop runs it once it is due. Targets, guards and state filters
+//! are evaluated when it runs, not when it was scheduled, so
+//! `--state waiting_input` still only reaches panes that are waiting then.
+//!
+//! A `request_ref` belongs to the scheduling call: a retry with the same ref
+//! returns the entry parked by the first call instead of parking the send
+//! again.
+//!
+//! `schedule.list` shows what is pending and `schedule.cancel` drops one
+//! (audited).
+//! Pending sends are in-memory like the rest of the state; a daemon restart
+//! drops them.
+
+use std::sync::Arc;
+
+use chrono::{DateTime, NaiveDateTime, Utc};
+use serde_json::Value;
+use tokio::sync::Mutex;
+
+use crate::actions::{self, ActionError, Claimed};
+use crate::audit::{self, Actor, AuditEntry};
+use crate::poll_loop::DaemonState;
+
+/// Pending sends kept at most.
+pub const CAPACITY: usize = 256;
+
+/// One pending send.
+#[derive(Debug, Clone, PartialEq, serde::Serialize)]
+pub struct Scheduled {
+    pub id: u64,
+    pub due: DateTime<Utc>,
+    pub created_at: DateTime<Utc>,
+    /// `pane.send` params, without `at` / `after`.
+    pub params: Value,
+    /// Who scheduled it; the send is audited under this caller.
+    pub actor: Actor,
+}
+
+/// Due time of a `pane.send` call: `None` if it has neither `at` nor
+/// `after` and should run now.
+pub fn due_time(params: &Value, now: DateTime<Utc>) -> Result<Option<DateTime<Utc>>, String> {
+    match (params["at"].as_str(), params["after"].as_str()) {
+        (None, None) => Ok(None),
+        (Some(_), Some(_)) => Err("pass at or after, not both".to_string()),
+        (Some(at), None) => parse_at(at)
+            .map(Some)
+            .ok_or_else(|| format!("at must be an RFC 3339 time, got {at:?}")),
+        (None, Some(after)) => audit::parse_age(after)
+            .map(|age| Some(now + age))
+            .ok_or_else(|| format!("after must be an age like 90s / 10m / 2h, got {after:?}")),
+    }
+}
+
+/// RFC 3339, or the same without seconds (`2024-06-01T03:00Z`).
+fn parse_at(s: &str) -> Option<DateTime<Utc>> {
+    if let Ok(at) = DateTime::parse_from_rfc3339(s) {
+        return Some(at.with_timezone(&Utc));
+    }
+    NaiveDateTime::parse_from_str(s, "%Y-%m-%dT%H:%MZ")
+        .ok()
+        .map(|at| at.and_utc())
+}
+
+#[derive(Debug, Default)]
+pub struct Scheduler {
+    next_id: u64,
+    pending: Vec<Scheduled>,
+}
+
+impl Scheduler {
+    /// Park a send; `params` loses its `at` / `after`.
+    pub fn add(
+        &mut self,
+        mut params: Value,
+        due: DateTime<Utc>,
+        actor: Actor,
+        now: DateTime<Utc>,
+    ) -> Result<&Scheduled, String> {
+        if self.pending.len() >= CAPACITY {
+            return Err(format!("{CAPACITY} sends already pending"));
+        }
+        if let Some(params) = params.as_object_mut() {
+            params.remove("at");
+            params.remove("after");
+        }
+        self.next_id += 1;
+        self.pending.push(Scheduled {
+            id: self.next_id,
+            due,
+            created_at: now,
+            params,
+            actor,
+        });
+        tracing::info!(id = self.next_id, %due, "send scheduled");
+        Ok(self.pending.last().expect("just pushed"))
+    }
+
+    /// Drop a pending send; false if there is none with this id.
+    pub fn cancel(&mut self, id: u64) -> bool {
+        let before = self.pending.len();
+        self.pending.retain(|s| s.id != id);
+        self.pending.len() != before
+    }
+
+    /// Pending sends, soonest first.
+    pub fn list(&self) -> Vec<&Scheduled> {
+        let mut pending: Vec<&Scheduled> = self.pending.iter().collect();
+        pending.sort_by_key(|s| (s.due, s.id));
+        pending
+    }
+
+    /// Remove and return the sends due at `now`, soonest first.
+    pub fn take_due(&mut self, now: DateTime<Utc>) -> Vec<Scheduled> {
+        let (mut due, pending) = std::mem::take(&mut self.pending)
+            .into_iter()
+            .partition::<Vec<_>, _>(|s| s.due <= now);
+        self.pending = pending;
+        due.sort_by_key(|s| (s.due, s.id));
+        due
+    }
+}
+
+/// Park a `pane.send` with `at` / `after` due at `due`: `{id, due,
+/// created_at, params, actor, request_ref, replayed}`. The input is checked
+/// now; the parked params drop `request_ref`, which is claimed here.
+pub async fn add_send(
+    state: &Arc<Mutex<DaemonState>>,
+    params: &Value,
+    actor: Actor,
+    due: DateTime<Utc>,
+    now: DateTime<Utc>,
+) -> Result<Value, ActionError> {
+    let request_ref = params["request_ref"].as_str().filter(|r| !r.is_empty());
+    let mut parked = params.clone();
+    if let Some(parked) = parked.as_object_mut() {
+        parked.remove("request_ref");
+    }
+    let fingerprint = format!("pane.send scheduled {parked}");
+    let (mut st, claim) = match actions::claim(state, request_ref, &fingerprint).await {
+        Claimed::Run(st, claim) => (st, claim),
+        Claimed::Replay(result) => return result,
+    };
+    actions::check_send(&parked, &st.send_policy)?;
+    let scheduled = st
+        .scheduler
+        .add(parked, due, actor, now)
+        .map_err(ActionError::Refused)?;
+    let mut result = serde_json::json!(scheduled);
+    result["request_ref"] = request_ref.map_or(Value::Null, Value::from);
+    result["replayed"] = Value::Bool(false);
+    actions::remember(&mut st, claim, &result);
+    Ok(result)
+}
+
+/// Run a due send and audit it under the caller that scheduled it, with
+/// `scheduled` (its id) in the entry's detail.
+pub async fn run(state: Arc<Mutex<DaemonState>>, scheduled: Scheduled) {
+    let result = actions::execute(&state, "pane.send", &scheduled.params).await;
+    if let Err(e) = &result {
+        tracing::warn!(id = scheduled.id, "scheduled send failed: {e}");
+    }
+    let mut params = scheduled.params;
+    params["scheduled"] = scheduled.id.into();
+    let outcome = result.as_ref().map_err(ToString::to_string);
+    state.lock().await.audit.record(AuditEntry::new(
+        "pane.send",
+        scheduled.actor,
+        &params,
+        outcome,
+    ));
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chrono::Duration;
+    use serde_json::json;
+
+    #[test]
+    fn parses_due_times() {
+        let now = Utc::now();
+        assert_eq!(due_time(&json!({"text": "go"}), now), Ok(None));
+        assert_eq!(
+            due_time(&json!({"after": "10m"}), now),
+            Ok(Some(now + Duration::minutes(10)))
+        );
+        assert_eq!(
+            due_time(&json!({"at": "2024-06-01T03:00Z"}), now).map(|t| t.map(|t| t.to_rfc3339())),
+            Ok(Some("2024-06-01T03:00:00+00:00".to_string()))
+        );
+        assert_eq!(
+            due_time(&json!({"at": "2024-06-01T12:00:00+09:00"}), now)
+                .map(|t| t.map(|t| t.to_rfc3339())),
+            Ok(Some("2024-06-01T03:00:00+00:00".to_string()))
+        );
+        assert!(due_time(&json!({"at": "tomorrow"}), now).is_err());
+        assert!(due_time(&json!({"after": "-1m"}), now).is_err());
+        assert!(due_time(&json!({"at": "2024-06-01T03:00Z", "after": "1m"}), now).is_err());
+    }
+
+    #[test]
+    fn holds_sends_until_due() {
+        let now = Utc::now();
+        let mut scheduler = Scheduler::default();
+        let params = json!({"pane_ids": ["%1"], "text": "go", "after": "10m"});
+        let later = scheduler
+            .add(params, now + Duration::minutes(10), Actor::default(), now)
+            .expect("add")
+            .id;
+        let params = json!({"state": ["idle"], "text": "yes"});
+        let sooner = scheduler
+            .add(params, now + Duration::minutes(1), Actor::default(), now)
+            .expect("add")
+            .id;
+        let ids = |list: Vec<&Scheduled>| list.iter().map(|s| s.id).collect::<Vec<_>>();
+        assert_eq!(ids(scheduler.list()), [sooner, later]);
+        assert!(scheduler.list()[1].params.get("after").is_none());
+
+        assert!(scheduler.take_due(now).is_empty());
+        let due = scheduler.take_due(now + Duration::minutes(5));
+        assert_eq!(due.iter().map(|s| s.id).collect::<Vec<_>>(), [sooner]);
+        assert_eq!(due[0].params["text"], "yes");
+
+        assert!(scheduler.cancel(later));
+        assert!(!scheduler.cancel(later));
+        assert!(scheduler.take_due(now + Duration::hours(1)).is_empty());
+    }
+}
@@ -0,0 +1,153 @@
+//! systemd service notifications (`Type=notify`, `WatchdogSec=`): `READY=1`
+//! once the UDS listener is up, `WATCHDOG=1` keepalives while the poll loop
+//! keeps ticking, `STOPPING=1` on shutdown. Everything is a no-op when the
+//! daemon was not started by systemd (`NOTIFY_SOCKET` unset).
+
+use std::os::unix::net::UnixDatagram;
+use std::sync::Arc;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::time::{Duration, Instant};
+
+/// Send `state` (e.g. `"READY=1"`) to `$NOTIFY_SOCKET`. Returns whether a
+/// notification was sent.
+pub fn notify(state: &str) -> bool {
+    let Some(path) = std::env::var_os("NOTIFY_SOCKET") else {
+        return false;
+    };
+    let path = path.to_string_lossy();
+    let result = UnixDatagram::unbound().and_then(|socket| {
+        match path.strip_prefix('@') {
+            Some(name) => send_abstract(&socket, name, state),
+            None => socket.send_to(state.as_bytes(), path.as_ref()),
+        }
+        .map(|_| ())
+    });
+    match result {
+        Ok(()) => true,
+        Err(e) => {
+            tracing::warn!("sd_notify {state} to {path} failed: {e}");
+            false
+        }
+    }
+}
+
+#[cfg(target_os = "linux")]
+fn send_abstract(socket: &UnixDatagram, name: &str, state: &str) -> std::io::Result<usize> {
+    use std::os::linux::net::SocketAddrExt;
+    let addr = std::os::unix::net::SocketAddr::from_abstract_name(name)?;
+    socket.send_to_addr(state.as_bytes(), &addr)
+}
+
+#[cfg(not(target_os = "linux"))]
+fn send_abstract(_socket: &UnixDatagram, _name: &str, _state: &str) -> std::io::Result<usize> {
+    Err(std::io::Error::from(std::io::ErrorKind::Unsupported))
+}
+
+/// Watchdog timeout requested by systemd (`WATCHDOG_USEC`), if it is meant
+/// for this process (`WATCHDOG_PID` unset or equal to our pid).
+pub fn watchdog_timeout() -> Option<Duration> {
+    let usec = std::env::var("WATCHDOG_USEC").ok();
+    let pid = std::env::var("WATCHDOG_PID").ok();
+    parse_watchdog(usec.as_deref(), pid.as_deref(), std::process::id())
+}
+
+fn parse_watchdog(usec: Option<&str>, pid: Option<&str>, own_pid: u32) -> Option<Duration> {
+    if let Some(pid) = pid
+        && pid.parse::<u32>().ok() != Some(own_pid)
+    {
+        return None;
+    }
+    let usec: u64 = usec?.parse().ok()?;
+    (usec > 0).then(|| Duration::from_micros(usec))
+}
+
+/// Completion time of the last poll tick, shared between the poll loop and
+/// the watchdog task without taking the state lock.
+#[derive(Debug, Clone)]
+pub struct Heartbeat {
+    origin: Instant,
+    last_ms: Arc<AtomicU64>,
+}
+
+impl Heartbeat {
+    pub fn new() -> Self {
+        Self {
+            origin: Instant::now(),
+            last_ms: Arc::new(AtomicU64::new(0)),
+        }
+    }
+
+    /// Record a finished tick.
+    pub fn beat(&self) {
+        let ms = self.origin.elapsed().as_millis() as u64;
+        self.last_ms.store(ms, Ordering::Relaxed);
+    }
+
+    /// Time since the last tick (since creation if none yet).
+    pub fn age(&self) -> Duration {
+        let last = Duration::from_millis(self.last_ms.load(Ordering::Relaxed));
+        self.origin.elapsed().saturating_sub(last)
+    }
+}
+
+/// Whether the poll loop counts as alive: it ticked within the watchdog
+/// timeout, or within three poll intervals when polling is slower than that.
+pub fn loop_alive(age: Duration, watchdog: Duration, poll_interval: Duration) -> bool {
+    age < watchdog.max(poll_interval * 3)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_watchdog_env() {
+        assert_eq!(
+            parse_watchdog(Some("30000000"), None, 7),
+            Some(Duration::from_secs(30))
+        );
+        assert_eq!(
+            parse_watchdog(Some("30000000"), Some("7"), 7),
+            Some(Duration::from_secs(30))
+        );
+        assert_eq!(
+            parse_watchdog(Some("30000000"), Some("8"), 7),
+            None,
+            "other pid"
+        );
+        assert_eq!(parse_watchdog(Some("0"), None, 7), None);
+        assert_eq!(parse_watchdog(Some("x"), None, 7), None);
+        assert_eq!(parse_watchdog(None, None, 7), None);
+    }
+
+    #[test]
+    fn liveness_allows_slow_poll_intervals() {
+        let watchdog = Duration::from_secs(30);
+        assert!(loop_alive(
+            Duration::from_secs(5),
+            watchdog,
+            Duration::from_secs(1)
+        ));
+        assert!(!loop_alive(
+            Duration::from_secs(31),
+            watchdog,
+            Duration::from_secs(1)
+        ));
+        assert!(loop_alive(
+            Duration::from_secs(100),
+            watchdog,
+            Duration::from_secs(60)
+        ));
+
+        let heartbeat = Heartbeat::new();
+        heartbeat.beat();
+        assert!(heartbeat.age() < Duration::from_secs(1));
+    }
+
+    #[test]
+    fn notify_without_socket_is_noop() {
+        if std::env::var_os("NOTIFY_SOCKET").is_none() {
+            assert!(!notify("READY=1"));
+        }
+    }
+}
@@ -0,0 +1,281 @@
+//! Output search across panes (`pane.search`, remote `GET /v1/search`,
+//! `agtmux grep`): capture the last `lines` of every selected pane and
+//! return the panes whose output contains `q` (a literal string, or a regex
+//! with `regex`), with the matching lines.
+//!
+//! Panes are the `pane_ids` given, else every pane the daemon knows,
+//! narrowed by `session` and `agent`. Captures run on the exec pool, at most
+//! [`CONCURRENCY`] at a time so a wide search does not starve the poll loop.
+//! A pane whose capture fails is reported under `failed` and the rest are
+//! still searched. Output is masked by `[redact]` before it is matched.
+
+use std::sync::Arc;
+
+use regex::{Regex, RegexBuilder};
+use serde_json::Value;
+use tokio::sync::Mutex;
+use tokio::task::JoinSet;
+
+use crate::actions::{self, ActionError};
+use crate::poll_loop::DaemonState;
+use crate::server::cached_pane_list;
+
+/// Lines captured per pane when the query has no `lines`.
+pub const DEFAULT_LINES: u64 = 200;
+pub const MAX_LINES: u64 = 2000;
+/// Matching lines returned per pane; the rest are only counted.
+pub const MAX_MATCHES: usize = 20;
+/// Captures in flight at once.
+pub const CONCURRENCY: usize = 4;
+/// Longest excerpt returned for a matching line, in characters.
+const MAX_EXCERPT: usize = 400;
+
+/// `pane.search` params.
+#[derive(Debug, Clone)]
+pub struct SearchQuery {
+    pub q: String,
+    /// `q` compiled: escaped unless `regex`, case-insensitive with
+    /// `ignore_case`.
+    matcher: Regex,
+    pub pane_ids: Vec<String>,
+    pub session: Option<String>,
+    /// Provider of managed panes (`claude`, `codex`, ...).
+    pub agent: Option<String>,
+    pub lines: u64,
+}
+
+impl SearchQuery {
+    pub fn from_params(params: &Value) -> Result<Self, String> {
+        let q = params["q"].as_str().unwrap_or("");
+        if q.is_empty() {
+            return Err("q must not be empty".to_string());
+        }
+        let lines = match &params["lines"] {
+            Value::Null => DEFAULT_LINES,
+            lines => lines
+                .as_u64()
+                .filter(|n| *n > 0)
+                .ok_or_else(|| format!("lines must be a positive integer, got {lines}"))?
+                .min(MAX_LINES),
+        };
+        let pattern = if params["regex"].as_bool().unwrap_or(false) {
+            q.to_string()
+        } else {
+            regex::escape(q)
+        };
+        let matcher = RegexBuilder::new(&pattern)
+            .case_insensitive(params["ignore_case"].as_bool().unwrap_or(false))
+            .build()
+            .map_err(|e| format!("invalid regex: {e}"))?;
+        let string = |key: &str| {
+            params[key]
+                .as_str()
+                .filter(|s| !s.is_empty())
+                .map(String::from)
+        };
+        Ok(Self {
+            q: q.to_string(),
+            matcher,
+            pane_ids: params["pane_ids"]
+                .as_array()
+                .into_iter()
+                .flatten()
+                .filter_map(|id| id.as_str().map(String::from))
+                .collect(),
+            session: string("session"),
+            agent: string("agent"),
+            lines,
+        })
+    }
+
+    /// Whether `pane` (a `list_panes` entry) is searched.
+    fn selects(&self, pane: &Value) -> bool {
+        let pane_id = pane["pane_id"].as_str().unwrap_or("");
+        (self.pane_ids.is_empty() || self.pane_ids.iter().any(|id| id == pane_id))
+            && self
+                .session
+                .as_deref()
+                .is_none_or(|s| pane["session_name"].as_str() == Some(s))
+            && self
+                .agent
+                .as_deref()
+                .is_none_or(|a| pane["provider"].as_str() == Some(a))
+    }
+
+    /// 1-based numbers and text of the captured lines containing `q`, the
+    /// first [`MAX_MATCHES`] of them, and the total count.
+    pub fn grep(&self, output: &str) -> (Vec<(usize, String)>, usize) {
+        let mut total = 0;
+        let mut matches = Vec::new();
+        for (n, line) in output.lines().enumerate() {
+            if !self.matcher.is_match(line) {
+                continue;
+            }
+            total += 1;
+            if matches.len() < MAX_MATCHES {
+                matches.push((n + 1, line.chars().take(MAX_EXCERPT).collect()));
+            }
+        }
+        (matches, total)
+    }
+}
+
+/// Run a search: `{q, searched, panes: [{pane_id, session_name, window_name,
+/// provider, label, title, matches: [{line, text}], total}], failed}`,
+/// panes in `list_panes` order.
+pub async fn search(
+    state: &Arc<Mutex<DaemonState>>,
+    query: &SearchQuery,
+) -> Result<Value, ActionError> {
+    let (panes, runner, pool, redactor) = {
+        let mut st = state.lock().await;
+        let panes: Vec<Value> = cached_pane_list(&mut st)
+            .as_array()
+            .into_iter()
+            .flatten()
+            .filter(|p| query.selects(p))
+            .cloned()
+            .collect();
+        if let Some(missing) = query
+            .pane_ids
+            .iter()
+            .find(|id| !panes.iter().any(|p| p["pane_id"] == id.as_str()))
+        {
+            return Err(ActionError::PaneNotFound(missing.clone()));
+        }
+        (
+            panes,
+            actions::tmux_runner(&st)?,
+            Arc::clone(&st.exec_pool),
+            st.redactor.clone(),
+        )
+    };
+
+    let mut captures: Vec<Option<Result<String, ActionError>>> =
+        panes.iter().map(|_| None).collect();
+    let mut running = JoinSet::new();
+    for (i, pane) in panes.iter().enumerate() {
+        if running.len() >= CONCURRENCY
+            && let Some(Ok((i, captured))) = running.join_next().await
+        {
+            captures[i] = Some(captured);
+        }
+        let args = vec![
+            "capture-pane".to_string(),
+            "-p".to_string(),
+            "-J".to_string(),
+            "-S".to_string(),
+            format!("-{}", query.lines),
+            "-t".to_string(),
+            pane["pane_id"].as_str().unwrap_or("").to_string(),
+        ];
+        let (runner, pool) = (Arc::clone(&runner), Arc::clone(&pool));
+        running.spawn(async move { (i, actions::run_tmux(&runner, &pool, args).await) });
+    }
+    while let Some(joined) = running.join_next().await {
+        if let Ok((i, captured)) = joined {
+            captures[i] = Some(captured);
+        }
+    }
+
+    let mut hits = Vec::new();
+    let mut failed = serde_json::Map::new();
+    for (pane, captured) in panes.iter().zip(captures) {
+        let pane_id = pane["pane_id"].as_str().unwrap_or("").to_string();
+        let output = match captured {
+            Some(Ok(output)) => output,
+            Some(Err(e)) => {
+                failed.insert(pane_id, Value::String(e.to_string()));
+                continue;
+            }
+            None => {
+                failed.insert(pane_id, Value::String("capture task failed".to_string()));
+                continue;
+            }
+        };
+        let (matches, total) = query.grep(&redactor.redact(&output));
+        if total == 0 {
+            continue;
+        }
+        hits.push(serde_json::json!({
+            "pane_id": pane_id,
+            "session_name": pane["session_name"],
+            "window_name": pane["window_name"],
+            "provider": pane["provider"],
+            "label": pane["label"],
+            "title": pane["title"],
+            "matches": matches
+                .into_iter()
+                .map(|(line, text)| serde_json::json!({"line": line, "text": text}))
+                .collect::<Vec<_>>(),
+            "total": total,
+        }));
+    }
+    Ok(serde_json::json!({
+        "q": query.q,
+        "searched": panes.len(),
+        "panes": hits,
+        "failed": failed,
+    }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    #[test]
+    fn parses_queries() {
+        let query =
+            SearchQuery::from_params(&json!({"q": "panic", "pane_ids": ["%1"]})).expect("valid");
+        assert_eq!(query.lines, DEFAULT_LINES);
+        assert_eq!(query.pane_ids, ["%1"]);
+        let query = SearchQuery::from_params(&json!({"q": "x", "lines": 99999})).expect("valid");
+        assert_eq!(query.lines, MAX_LINES);
+        assert!(SearchQuery::from_params(&json!({"q": ""})).is_err());
+        assert!(SearchQuery::from_params(&json!({"q": "x", "lines": 0})).is_err());
+        assert!(SearchQuery::from_params(&json!({"q": "(", "regex": true})).is_err());
+    }
+
+    #[test]
+    fn selects_panes_by_session_and_agent() {
+        let query =
+            SearchQuery::from_params(&json!({"q": "x", "session": "work", "agent": "codex"}))
+                .expect("valid");
+        assert!(
+            query.selects(&json!({"pane_id": "%1", "session_name": "work", "provider": "codex"}))
+        );
+        assert!(
+            !query.selects(&json!({"pane_id": "%2", "session_name": "work", "provider": "claude"}))
+        );
+        assert!(
+            !query.selects(&json!({"pane_id": "%3", "session_name": "ops", "provider": "codex"}))
+        );
+        assert!(!query.selects(&json!({"pane_id": "%4", "session_name": "work"})));
+    }
+
+    #[test]
+    fn greps_lines_with_numbers_and_a_cap() {
+        let query = SearchQuery::from_params(&json!({"q": "Error"})).expect("valid");
+        let output = "ok\nError: boom\nerror: quiet\n";
+        assert_eq!(
+            query.grep(output),
+            (vec![(2, "Error: boom".to_string())], 1)
+        );
+        let query =
+            SearchQuery::from_params(&json!({"q": "error", "ignore_case": true})).expect("valid");
+        assert_eq!(query.grep(output).1, 2);
+
+        let query = SearchQuery::from_params(&json!({"q": "a.b"})).expect("valid");
+        assert_eq!(query.grep("a.b\naxb\n").1, 1, "literal by default");
+        let query = SearchQuery::from_params(&json!({"q": "^(Error|panicked)", "regex": true}))
+            .expect("valid");
+        assert_eq!(query.grep(output).1, 1);
+
+        let query =
+            SearchQuery::from_params(&json!({"q": "error", "ignore_case": true})).expect("valid");
+        let many = "error\n".repeat(MAX_MATCHES + 5);
+        let (matches, total) = query.grep(&many);
+        assert_eq!((matches.len(), total), (MAX_MATCHES, MAX_MATCHES + 5));
+    }
+}
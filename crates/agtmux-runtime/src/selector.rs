@@ -0,0 +1,289 @@
+//! Pane selectors: anywhere a request takes a `pane_id` (or `pane_ids`), a
+//! selector expression may be given instead and the daemon resolves it
+//! against the current pane list, so scripts survive panes being recreated
+//! under new ids.
+//!
+//! - `session=proj window=build agent=codex state=waiting_input` — every
+//!   term must match (keys: `session`, `window`, `agent`, `state`, `label`,
+//!   `group`, `branch`, `pane`)
+//! - `latest:claude` — the most recently created pane of that agent
+//!
+//! A selector must match exactly one pane; an ambiguous one fails and lists
+//! the candidates.
+
+use agtmux_client::codes;
+use serde_json::Value;
+
+use crate::server::pane_order_key;
+
+const KEYS: &[&str] = &[
+    "session", "window", "agent", "state", "label", "group", "branch", "pane",
+];
+
+/// Candidates listed in an ambiguity error.
+const MAX_CANDIDATES: usize = 10;
+
+/// A parsed selector expression.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Selector {
+    /// `key=value` terms, all of which must match.
+    Terms(Vec<(String, String)>),
+    /// `latest:<agent>`: the agent's pane with the highest tmux pane id.
+    Latest(String),
+}
+
+/// Why a selector did not resolve to one pane.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum SelectorError {
+    Invalid(String),
+    NoMatch(String),
+    Ambiguous {
+        selector: String,
+        candidates: Vec<String>,
+    },
+}
+
+impl SelectorError {
+    /// JSON-RPC error code.
+    pub fn code(&self) -> i64 {
+        match self {
+            Self::Invalid(_) | Self::Ambiguous { .. } => codes::INVALID_PARAMS,
+            Self::NoMatch(_) => codes::PANE_NOT_FOUND,
+        }
+    }
+}
+
+impl std::fmt::Display for SelectorError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Invalid(message) => f.write_str(message),
+            Self::NoMatch(selector) => write!(f, "no pane matches {selector:?}"),
+            Self::Ambiguous {
+                selector,
+                candidates,
+            } => write!(
+                f,
+                "{selector:?} matches {} panes: {}",
+                candidates.len(),
+                candidates
+                    .iter()
+                    .take(MAX_CANDIDATES)
+                    .cloned()
+                    .collect::<Vec<_>>()
+                    .join(", ")
+            ),
+        }
+    }
+}
+
+impl std::error::Error for SelectorError {}
+
+/// Whether `s` is a selector rather than a pane id.
+pub fn is_selector(s: &str) -> bool {
+    s.contains('=') || s.starts_with("latest:")
+}
+
+impl Selector {
+    pub fn parse(s: &str) -> Result<Self, SelectorError> {
+        if let Some(agent) = s.trim().strip_prefix("latest:") {
+            if agent.is_empty() || agent.contains(char::is_whitespace) {
+                return Err(SelectorError::Invalid(format!(
+                    "latest: needs one agent name, got {s:?}"
+                )));
+            }
+            return Ok(Self::Latest(agent.to_string()));
+        }
+        let terms = s
+            .split_whitespace()
+            .map(|term| {
+                let (key, value) = term
+                    .split_once('=')
+                    .filter(|(_, value)| !value.is_empty())
+                    .ok_or_else(|| {
+                        SelectorError::Invalid(format!("selector term {term:?} is not key=value"))
+                    })?;
+                if !KEYS.contains(&key) {
+                    return Err(SelectorError::Invalid(format!(
+                        "unknown selector key {key:?} (one of {})",
+                        KEYS.join(", ")
+                    )));
+                }
+                Ok((key.to_string(), value.to_string()))
+            })
+            .collect::<Result<Vec<_>, _>>()?;
+        if terms.is_empty() {
+            return Err(SelectorError::Invalid("empty selector".to_string()));
+        }
+        Ok(Self::Terms(terms))
+    }
+
+    fn matches(&self, pane: &Value) -> bool {
+        match self {
+            Self::Latest(agent) => term_matches(pane, "agent", agent),
+            Self::Terms(terms) => terms
+                .iter()
+                .all(|(key, value)| term_matches(pane, key, value)),
+        }
+    }
+
+    /// The one pane of `panes` (a `list_panes` array) the selector names.
+    pub fn resolve(&self, source: &str, panes: &Value) -> Result<String, SelectorError> {
+        let mut matching: Vec<&Value> = panes
+            .as_array()
+            .map(Vec::as_slice)
+            .unwrap_or(&[])
+            .iter()
+            .filter(|p| self.matches(p))
+            .collect();
+        matching.sort_by_key(|p| pane_order_key(p["pane_id"].as_str().unwrap_or("")));
+        if let Self::Latest(_) = self {
+            matching.drain(..matching.len().saturating_sub(1));
+        }
+        match matching.as_slice() {
+            [] => Err(SelectorError::NoMatch(source.to_string())),
+            [pane] => Ok(pane["pane_id"].as_str().unwrap_or("").to_string()),
+            many => Err(SelectorError::Ambiguous {
+                selector: source.to_string(),
+                candidates: many.iter().map(|p| describe(p)).collect(),
+            }),
+        }
+    }
+}
+
+fn term_matches(pane: &Value, key: &str, value: &str) -> bool {
+    let field = |name: &str| pane[name].as_str();
+    match key {
+        "session" => field("session_name") == Some(value) || field("session_id") == Some(value),
+        "window" => field("window_name") == Some(value) || field("window_id") == Some(value),
+        "agent" => field("provider") == Some(value) || field("adapter") == Some(value),
+        "state" => field("activity_state").is_some_and(|s| state_key(s) == state_key(value)),
+        "label" => field("label") == Some(value),
+        "group" => pane["groups"]
+            .as_array()
+            .is_some_and(|groups| groups.iter().any(|g| g.as_str() == Some(value))),
+        "branch" => field("git_branch") == Some(value),
+        "pane" => field("pane_id") == Some(value),
+        _ => false,
+    }
+}
+
+/// `waiting_input` and `WaitingInput` compare equal.
+fn state_key(state: &str) -> String {
+    state.replace('_', "").to_lowercase()
+}
+
+/// `%4 (proj:build codex WaitingInput)` for ambiguity errors.
+fn describe(pane: &Value) -> String {
+    let field = |name: &str| pane[name].as_str().unwrap_or("?");
+    let mut out = format!(
+        "{} ({}:{}",
+        field("pane_id"),
+        field("session_name"),
+        field("window_name")
+    );
+    for name in ["provider", "activity_state"] {
+        if let Some(value) = pane[name].as_str() {
+            out += " ";
+            out += value;
+        }
+    }
+    out + ")"
+}
+
+/// Whether `params.pane_id` or an entry of `params.pane_ids` is a selector.
+pub fn has_selectors(params: &Value) -> bool {
+    params["pane_id"].as_str().is_some_and(is_selector)
+        || params["pane_ids"]
+            .as_array()
+            .is_some_and(|ids| ids.iter().any(|id| id.as_str().is_some_and(is_selector)))
+}
+
+/// Replace selectors in `params.pane_id` / `params.pane_ids` with the pane
+/// ids they resolve to in `panes` (a `list_panes` array).
+pub fn resolve_params(params: &mut Value, panes: &Value) -> Result<(), SelectorError> {
+    let resolve = |id: &mut Value| -> Result<(), SelectorError> {
+        if let Some(source) = id.as_str().filter(|s| is_selector(s)) {
+            let pane_id = Selector::parse(source)?.resolve(source, panes)?;
+            *id = Value::String(pane_id);
+        }
+        Ok(())
+    };
+    if let Some(id) = params.get_mut("pane_id") {
+        resolve(id)?;
+    }
+    if let Some(ids) = params.get_mut("pane_ids").and_then(Value::as_array_mut) {
+        ids.iter_mut().try_for_each(resolve)?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn panes() -> Value {
+        json!([
+            {"pane_id": "%3", "session_name": "proj", "window_name": "build",
+                "provider": "codex", "activity_state": "WaitingInput", "groups": ["api"]},
+            {"pane_id": "%12", "session_name": "proj", "window_name": "edit",
+                "provider": "claude", "activity_state": "Running", "groups": []},
+            {"pane_id": "%7", "session_name": "proj", "window_name": "edit",
+                "provider": "claude", "activity_state": "Idle", "label": "review"},
+            {"pane_id": "%9", "session_name": "scratch", "window_name": "zsh"},
+        ])
+    }
+
+    fn resolve(selector: &str) -> Result<String, SelectorError> {
+        Selector::parse(selector)?.resolve(selector, &panes())
+    }
+
+    #[test]
+    fn resolves_terms_and_latest() {
+        assert_eq!(
+            resolve("session=proj window=build agent=codex state=waiting_input"),
+            Ok("%3".to_string())
+        );
+        assert_eq!(resolve("label=review"), Ok("%7".to_string()));
+        assert_eq!(resolve("group=api"), Ok("%3".to_string()));
+        assert_eq!(resolve("latest:claude"), Ok("%12".to_string()));
+        assert_eq!(resolve("agent=claude state=Idle"), Ok("%7".to_string()));
+    }
+
+    #[test]
+    fn reports_ambiguous_and_unmatched_selectors() {
+        let err = resolve("window=edit").expect_err("two panes");
+        assert_eq!(err.code(), codes::INVALID_PARAMS);
+        assert_eq!(
+            err.to_string(),
+            "\"window=edit\" matches 2 panes: %7 (proj:edit claude Idle), \
+             %12 (proj:edit claude Running)"
+        );
+        let err = resolve("latest:gemini").expect_err("no gemini");
+        assert_eq!(err.code(), codes::PANE_NOT_FOUND);
+        assert!(matches!(
+            Selector::parse("host=a"),
+            Err(SelectorError::Invalid(_))
+        ));
+        assert!(Selector::parse("agent=").is_err());
+        assert!(Selector::parse("latest:").is_err());
+    }
+
+    #[test]
+    fn rewrites_pane_params() {
+        let mut params = json!({"pane_id": "latest:codex", "force": true});
+        assert!(has_selectors(&params));
+        resolve_params(&mut params, &panes()).expect("resolves");
+        assert_eq!(params, json!({"pane_id": "%3", "force": true}));
+
+        let mut params = json!({"pane_ids": ["%9", "label=review"]});
+        assert!(has_selectors(&params));
+        resolve_params(&mut params, &panes()).expect("resolves");
+        assert_eq!(params["pane_ids"], json!(["%9", "%7"]));
+
+        assert!(!has_selectors(
+            &json!({"pane_id": "%4", "pane_ids": ["%5"]})
+        ));
+        assert!(!has_selectors(&json!({"session": "a=b"})));
+    }
+}
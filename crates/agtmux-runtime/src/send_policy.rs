@@ -0,0 +1,175 @@
+//! `[send_policy]`: what clients may type into panes. Checked for
+//! `pane.send` (also when scheduled), `group.send` and the `send` / `key`
+//! steps of `macro.run`.
+//!
+//! ```toml
+//! [send_policy]
+//! deny = ['rm\s+-rf', '(?i)drop\s+table']   # refused if any matches
+//! allow = ['^[yn]$', '^/\w+']              # if set, one must match
+//! agent_panes_only = true                  # refuse panes without an agent
+//! ```
+//!
+//! Patterns are regexes matched against the text, or the key name for a key
+//! press; a bare Enter always passes. `agent_panes_only` refuses panes where
+//! no agent was detected, i.e. plain shells, where the text would run as a
+//! command. A refused send fails with `POLICY_VIOLATION` before anything is
+//! typed into any target. Input the operator configured (responder rules,
+//! idle timeouts, `pane.run` commands) is not checked. Reloads on SIGHUP.
+
+use agtmux_core_v5::types::{PanePresence, PaneRuntimeState};
+use regex::Regex;
+
+use crate::actions::ActionError;
+
+/// `[send_policy]` section.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Deserialize)]
+#[serde(default, deny_unknown_fields)]
+pub struct SendPolicySettings {
+    /// Regexes; input matching any of them is refused.
+    pub deny: Vec<String>,
+    /// Regexes; when set, input must match one of them.
+    pub allow: Vec<String>,
+    /// Refuse panes without a detected agent.
+    pub agent_panes_only: bool,
+}
+
+impl SendPolicySettings {
+    pub fn validate(&self) -> anyhow::Result<()> {
+        for (key, patterns) in [("deny", &self.deny), ("allow", &self.allow)] {
+            for pattern in patterns {
+                Regex::new(pattern)
+                    .map_err(|e| anyhow::anyhow!("send_policy.{key} {pattern:?}: {e}"))?;
+            }
+        }
+        Ok(())
+    }
+
+    /// No rule set: every send passes.
+    pub fn is_empty(&self) -> bool {
+        *self == Self::default()
+    }
+}
+
+/// Compiled [`SendPolicySettings`].
+#[derive(Debug, Clone, Default)]
+pub struct SendPolicy {
+    deny: Vec<Regex>,
+    allow: Vec<Regex>,
+    agent_panes_only: bool,
+}
+
+impl SendPolicy {
+    /// Compile validated settings; a pattern that does not compile is
+    /// skipped (`validate` rejects it at load).
+    pub fn new(settings: &SendPolicySettings) -> Self {
+        let compile =
+            |patterns: &[String]| patterns.iter().filter_map(|p| Regex::new(p).ok()).collect();
+        Self {
+            deny: compile(&settings.deny),
+            allow: compile(&settings.allow),
+            agent_panes_only: settings.agent_panes_only,
+        }
+    }
+
+    /// Refuse `input`: the text typed, or the name of the key pressed.
+    pub fn check_input(&self, input: &str) -> Result<(), ActionError> {
+        if input.is_empty() {
+            return Ok(());
+        }
+        if let Some(rule) = self.deny.iter().find(|r| r.is_match(input)) {
+            return Err(ActionError::PolicyViolation(format!(
+                "input {input:?} matches send_policy.deny {:?}",
+                rule.as_str()
+            )));
+        }
+        if !self.allow.is_empty() && !self.allow.iter().any(|r| r.is_match(input)) {
+            return Err(ActionError::PolicyViolation(format!(
+                "input {input:?} matches no send_policy.allow pattern"
+            )));
+        }
+        Ok(())
+    }
+
+    /// Refuse targets without a detected agent under `agent_panes_only`.
+    pub fn check_panes<'a>(
+        &self,
+        pane_ids: impl IntoIterator<Item = &'a str>,
+        states: &[&PaneRuntimeState],
+    ) -> Result<(), ActionError> {
+        if !self.agent_panes_only {
+            return Ok(());
+        }
+        for pane_id in pane_ids {
+            let agent = states.iter().any(|s| {
+                s.pane_instance_id.pane_id == pane_id && s.presence == PanePresence::Managed
+            });
+            if !agent {
+                return Err(ActionError::PolicyViolation(format!(
+                    "pane {pane_id} runs no agent (send_policy.agent_panes_only)"
+                )));
+            }
+        }
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::test_support;
+    use agtmux_core_v5::types::ActivityState;
+
+    fn pane(pane_id: &str, presence: PanePresence) -> PaneRuntimeState {
+        PaneRuntimeState {
+            presence,
+            provider: None,
+            ..test_support::pane(pane_id, ActivityState::Idle)
+        }
+    }
+
+    #[test]
+    fn checks_input_and_targets() {
+        let settings: SendPolicySettings = toml::from_str(
+            r#"
+            deny = ['rm\s+-rf']
+            allow = ['^[yn]$', '^/\w+', '^rm ']
+            agent_panes_only = true
+            "#,
+        )
+        .expect("valid");
+        settings.validate().expect("patterns compile");
+        let policy = SendPolicy::new(&settings);
+        assert_eq!(policy.check_input("y"), Ok(()));
+        assert_eq!(policy.check_input("/compact"), Ok(()));
+        assert_eq!(policy.check_input(""), Ok(()), "bare Enter");
+        assert!(matches!(
+            policy.check_input("rm -rf /"),
+            Err(ActionError::PolicyViolation(m)) if m.contains("deny")
+        ));
+        assert!(matches!(
+            policy.check_input("C-c"),
+            Err(ActionError::PolicyViolation(m)) if m.contains("allow")
+        ));
+
+        let (agent, shell) = (
+            pane("%1", PanePresence::Managed),
+            pane("%2", PanePresence::Unmanaged),
+        );
+        let states = [&agent, &shell];
+        assert_eq!(policy.check_panes(["%1"], &states), Ok(()));
+        assert!(policy.check_panes(["%1", "%2"], &states).is_err());
+        assert!(policy.check_panes(["%9"], &states).is_err(), "unknown");
+        assert_eq!(
+            SendPolicy::default().check_panes(["%2"], &states),
+            Ok(()),
+            "off by default"
+        );
+
+        let bad = SendPolicySettings {
+            deny: vec!["(".to_string()],
+            ..Default::default()
+        };
+        assert!(bad.validate().is_err());
+        assert!(SendPolicySettings::default().is_empty());
+    }
+}
@@ -1,5 +1,8 @@
 //! UDS JSON-RPC server: minimal hand-rolled implementation.
-//! Connection-per-request, newline-delimited JSON.
+//! Newline-delimited JSON, one request/response at a time per connection.
+//! Connections may be kept open for further requests (client pooling) and are
+//! closed after `CONNECTION_IDLE_TIMEOUT`. `watch` takes over its connection
+//! and streams `state_changed` frames until the client disconnects.
 
 use std::sync::Arc;
 
@@ -7,13 +10,46 @@ use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
 use tokio::net::UnixListener;
 use tokio::sync::Mutex;
 
+use agtmux_client::{METHODS, codes};
 use agtmux_core_v5::title::{TitleInput, resolve_title};
 use agtmux_core_v5::types::{EvidenceMode, PanePresence};
 
+use crate::access;
+use crate::actions::{self, ActionError};
+use crate::audit::{Actor, AuditEntry, AuditQuery};
+use crate::features;
+use crate::git_meta::GitMeta;
+use crate::groups;
+use crate::macros::{self, MacroDef};
+use crate::pane_output::{self, OutputQuery};
+use crate::pane_query::PaneListQuery;
 use crate::poll_loop::DaemonState;
-
-/// Run the UDS JSON-RPC server.
-pub async fn run_server(socket_path: &str, state: Arc<Mutex<DaemonState>>) -> anyhow::Result<()> {
+use crate::recorder;
+use crate::schedule;
+use crate::search::{self, SearchQuery};
+use crate::selector;
+use crate::source_events::EventFilter;
+use crate::tasks::TaskMeta;
+use crate::transcript;
+
+/// Idle keep-alive connections are closed after this long. Clients must keep
+/// their own pool idle timeout well below it.
+const CONNECTION_IDLE_TIMEOUT: std::time::Duration = std::time::Duration::from_secs(30);
+/// How often a `watch` stream checks the projection version.
+const WATCH_CHECK_INTERVAL: std::time::Duration = std::time::Duration::from_millis(250);
+/// Idle `watch` streams get an empty frame this often, so clients can detect a
+/// dead daemon and the server notices clients that went away.
+const WATCH_HEARTBEAT: std::time::Duration = std::time::Duration::from_secs(5);
+/// Encoded responses are flushed to the socket in chunks of about this size.
+const WRITE_CHUNK: usize = 64 * 1024;
+
+/// Run the UDS JSON-RPC server. `listening` fires once the socket accepts
+/// connections.
+pub async fn run_server(
+    socket_path: &str,
+    state: Arc<Mutex<DaemonState>>,
+    listening: tokio::sync::oneshot::Sender<()>,
+) -> anyhow::Result<()> {
     // Create socket directory with mode 0700
     let socket_dir = std::path::Path::new(socket_path)
         .parent()
@@ -46,6 +82,7 @@ pub async fn run_server(socket_path: &str, state: Arc<Mutex<DaemonState>>) -> an
     }
 
     tracing::info!("UDS server listening on {socket_path}");
+    let _ = listening.send(());
 
     loop {
         let (stream, _) = listener.accept().await?;
@@ -58,24 +95,115 @@ pub async fn run_server(socket_path: &str, state: Arc<Mutex<DaemonState>>) -> an
     }
 }
 
+/// Credentials of the connected client (SO_PEERCRED / LOCAL_PEERCRED).
+#[derive(Debug, Clone, Copy)]
+struct Peer {
+    uid: u32,
+    pid: Option<i32>,
+}
+
 async fn handle_connection(
     stream: tokio::net::UnixStream,
     state: Arc<Mutex<DaemonState>>,
 ) -> anyhow::Result<()> {
+    let cred = stream.peer_cred()?;
+    let peer = Peer {
+        uid: cred.uid(),
+        pid: cred.pid(),
+    };
+    let allowed = state.lock().await.allowed_uids.contains(&peer.uid);
+
     let (reader, mut writer) = stream.into_split();
     let mut reader = BufReader::new(reader);
     let mut line = String::new();
-    reader.read_line(&mut line).await?;
+    if !allowed {
+        // Answer the first request so the client sees why, then hang up.
+        tracing::warn!(peer_uid = peer.uid, peer_pid = ?peer.pid, "rejected UDS peer");
+        if let Ok(Ok(n)) =
+            tokio::time::timeout(CONNECTION_IDLE_TIMEOUT, reader.read_line(&mut line)).await
+            && n > 0
+        {
+            let id = serde_json::from_str::<serde_json::Value>(line.trim())
+                .map(|r| r["id"].clone())
+                .unwrap_or_default();
+            let message = format!("peer uid {} is not in allowed_uids", peer.uid);
+            write_error(&mut writer, id, codes::ADMISSION_REJECTED, &message).await?;
+        }
+        return Ok(());
+    }
+    loop {
+        line.clear();
+        match tokio::time::timeout(CONNECTION_IDLE_TIMEOUT, reader.read_line(&mut line)).await {
+            Ok(Ok(0)) | Err(_) => return Ok(()),
+            Ok(read) => read?,
+        };
+        handle_request(&line, &mut writer, &state, peer).await?;
+    }
+}
 
-    let request: serde_json::Value = serde_json::from_str(line.trim())?;
-    let method = request["method"].as_str().unwrap_or("");
+/// Dispatch one request line and write its response.
+async fn handle_request(
+    line: &str,
+    writer: &mut tokio::net::unix::OwnedWriteHalf,
+    state: &Arc<Mutex<DaemonState>>,
+    peer: Peer,
+) -> anyhow::Result<()> {
+    let mut request: serde_json::Value = serde_json::from_str(line.trim())?;
     let id = request["id"].clone();
+    let method = request["method"].as_str().unwrap_or("").to_string();
+    let method = method.as_str();
+    tracing::debug!(method, peer_uid = peer.uid, peer_pid = ?peer.pid, "request");
+    let scope = state
+        .lock()
+        .await
+        .access
+        .scope_for(peer.uid, request["meta"]["token"].as_str());
+    let required = access::required_scope(method, &request["params"]);
+    let actor = match scope {
+        Ok((scope, token)) if scope >= required => Actor {
+            uid: peer.uid,
+            pid: peer.pid,
+            client: request["meta"]["client"].as_str().map(String::from),
+            token,
+        },
+        denied => {
+            let message = match denied {
+                Ok((scope, _)) => format!("{method} needs scope {required}; caller has {scope}"),
+                Err(reason) => reason,
+            };
+            tracing::warn!(method, peer_uid = peer.uid, peer_pid = ?peer.pid, "{message}");
+            return write_error(writer, id, codes::FORBIDDEN, &message).await;
+        }
+    };
+    // Only after the scope check: resolution errors reveal which panes exist.
+    if selector::has_selectors(&request["params"]) {
+        let panes = cached_pane_list(&mut *state.lock().await);
+        if let Err(e) = selector::resolve_params(&mut request["params"], &panes) {
+            return write_error(writer, id, e.code(), &e.to_string()).await;
+        }
+    }
 
     let result = match method {
-        "list_panes" => {
-            let st = state.lock().await;
-            build_pane_list(&st)
+        "list_panes" if request["params"]["since_cursor"].is_u64() => {
+            let params = &request["params"];
+            let query = match PaneListQuery::from_params(params) {
+                Ok(query) if params["limit"].is_null() && params["sort"].is_null() => query,
+                Ok(_) => {
+                    let msg = "since_cursor cannot be combined with limit or sort";
+                    return write_error(writer, id, codes::INVALID_PARAMS, msg).await;
+                }
+                Err(e) => return write_error(writer, id, codes::INVALID_PARAMS, &e).await,
+            };
+            let since = params["since_cursor"].as_u64().unwrap_or(0);
+            pane_list_changes(&mut *state.lock().await, since, &query)
         }
+        "list_panes" => match PaneListQuery::from_params(&request["params"]) {
+            Ok(query) => {
+                let panes = cached_pane_list(&mut *state.lock().await);
+                query.apply(&panes)
+            }
+            Err(e) => return write_error(writer, id, codes::INVALID_PARAMS, &e).await,
+        },
         "list_sessions" => {
             let st = state.lock().await;
             let sessions = st.daemon.list_sessions();
@@ -98,6 +226,23 @@ async fn handle_connection(
             let st = state.lock().await;
             build_summary_changed(&st, since_version)
         }
+        "watch" => {
+            let since_version = request["params"]["since_version"].as_u64().unwrap_or(0);
+            let summary_only = request["params"]["summary_only"].as_bool().unwrap_or(false);
+            if request["params"]["source_events"]
+                .as_bool()
+                .unwrap_or(false)
+            {
+                let since_seq = request["params"]["since_seq"].as_u64();
+                let filter = EventFilter::from_params(&request["params"]);
+                return stream_source_events(writer, state, since_seq, filter).await;
+            }
+            if request["params"]["deltas"].as_bool().unwrap_or(false) {
+                let since_cursor = request["params"]["since_cursor"].as_u64();
+                return stream_pane_events(writer, state, since_cursor).await;
+            }
+            return stream_watch(writer, state, since_version, summary_only).await;
+        }
         "latency_status" => {
             let st = state.lock().await;
             build_latency_status(&st)
@@ -117,7 +262,7 @@ async fn handle_connection(
                 _ => {
                     let error_response = serde_json::json!({
                         "jsonrpc": "2.0",
-                        "error": {"code": -32602, "message": format!("unknown source_kind: {source_kind_str:?}")},
+                        "error": {"code": codes::INVALID_PARAMS, "message": format!("unknown source_kind: {source_kind_str:?}")},
                         "id": id,
                     });
                     let mut resp = serde_json::to_string(&error_response)?;
@@ -163,6 +308,258 @@ async fn handle_connection(
                 .collect();
             serde_json::Value::Array(entries)
         }
+        "label.set" | "label.clear" => {
+            let params = &request["params"];
+            let pane_id = params["pane_id"].as_str().unwrap_or("");
+            let mut st = state.lock().await;
+            if !st.last_panes.iter().any(|p| p.pane_id == pane_id) {
+                drop(st);
+                return write_error(
+                    writer,
+                    id,
+                    codes::PANE_NOT_FOUND,
+                    &format!("unknown pane: {pane_id:?}"),
+                )
+                .await;
+            }
+            if method == "label.clear" {
+                let removed = st.pane_labels.remove(pane_id);
+                st.invalidate_pane_list();
+                serde_json::json!({"pane_id": pane_id, "label": null, "cleared": removed.is_some()})
+            } else {
+                let label = params["label"].as_str().unwrap_or("").trim();
+                if label.is_empty() {
+                    drop(st);
+                    return write_error(
+                        writer,
+                        id,
+                        codes::INVALID_PARAMS,
+                        "label must not be empty",
+                    )
+                    .await;
+                }
+                st.pane_labels
+                    .insert(pane_id.to_string(), label.to_string());
+                st.invalidate_pane_list();
+                serde_json::json!({"pane_id": pane_id, "label": label})
+            }
+        }
+        "label.list" => {
+            let st = state.lock().await;
+            let mut labels: Vec<(&String, &String)> = st.pane_labels.iter().collect();
+            labels.sort();
+            let entries: Vec<serde_json::Value> = labels
+                .into_iter()
+                .map(|(pane_id, label)| serde_json::json!({"pane_id": pane_id, "label": label}))
+                .collect();
+            serde_json::Value::Array(entries)
+        }
+        "task.set" | "task.clear" => {
+            let params = &request["params"];
+            let pane_id = params["pane_id"].as_str().unwrap_or("");
+            let mut st = state.lock().await;
+            if !st.last_panes.iter().any(|p| p.pane_id == pane_id) {
+                drop(st);
+                return write_error(
+                    writer,
+                    id,
+                    codes::PANE_NOT_FOUND,
+                    &format!("unknown pane: {pane_id:?}"),
+                )
+                .await;
+            }
+            if method == "task.clear" {
+                let removed = st.pane_tasks.remove(pane_id);
+                st.invalidate_pane_list();
+                serde_json::json!({"pane_id": pane_id, "task": null, "cleared": removed.is_some()})
+            } else {
+                let task = match TaskMeta::from_params(params) {
+                    Ok(task) => task,
+                    Err(message) => {
+                        drop(st);
+                        return write_error(writer, id, codes::INVALID_PARAMS, &message).await;
+                    }
+                };
+                let result = serde_json::json!({"pane_id": pane_id, "task": task});
+                st.pane_tasks.insert(pane_id.to_string(), task);
+                st.invalidate_pane_list();
+                result
+            }
+        }
+        "task.list" => {
+            let st = state.lock().await;
+            let mut tasks: Vec<(&String, &TaskMeta)> = st.pane_tasks.iter().collect();
+            tasks.sort_by_key(|(pane_id, _)| *pane_id);
+            let entries: Vec<serde_json::Value> = tasks
+                .into_iter()
+                .map(|(pane_id, task)| serde_json::json!({"pane_id": pane_id, "task": task}))
+                .collect();
+            serde_json::Value::Array(entries)
+        }
+        "alerts.list" => {
+            let st = state.lock().await;
+            serde_json::to_value(st.alerts.alerts())?
+        }
+        "alerts.ack" => {
+            let alert_id = request["params"]["id"].as_u64();
+            let mut st = state.lock().await;
+            match alert_id.and_then(|alert_id| st.alerts.ack(alert_id)) {
+                Some(alert) => serde_json::to_value(alert)?,
+                None => {
+                    drop(st);
+                    return write_error(
+                        writer,
+                        id,
+                        codes::ALERT_NOT_FOUND,
+                        &format!("unknown alert: {}", request["params"]["id"]),
+                    )
+                    .await;
+                }
+            }
+        }
+        "pane.send"
+            if !request["params"]["at"].is_null() || !request["params"]["after"].is_null() =>
+        {
+            let params = &request["params"];
+            let now = chrono::Utc::now();
+            let due = match schedule::due_time(params, now) {
+                Ok(Some(due)) => due,
+                Ok(None) => {
+                    let message = "at / after must be strings";
+                    return write_error(writer, id, codes::INVALID_PARAMS, message).await;
+                }
+                Err(e) => return write_error(writer, id, codes::INVALID_PARAMS, &e).await,
+            };
+            match schedule::add_send(state, params, actor, due, now).await {
+                Ok(scheduled) => scheduled,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        m if actions::METHODS.contains(&m) => {
+            let started = std::time::Instant::now();
+            let result = actions::execute(state, method, &request["params"]).await;
+            let mut st = state.lock().await;
+            st.metrics.observe_action(method, started.elapsed());
+            audit(&mut st, method, actor, &request["params"], &result);
+            drop(st);
+            match result {
+                Ok(result) => result,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        m if groups::METHODS.contains(&m) => {
+            let started = std::time::Instant::now();
+            let result = groups::execute(state, method, &request["params"]).await;
+            let mut st = state.lock().await;
+            st.metrics.observe_action(method, started.elapsed());
+            if method != "group.list" {
+                audit(&mut st, method, actor, &request["params"], &result);
+            }
+            drop(st);
+            match result {
+                Ok(result) => result,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        "pane.search" => {
+            let query = match SearchQuery::from_params(&request["params"]) {
+                Ok(query) => query,
+                Err(e) => return write_error(writer, id, codes::INVALID_PARAMS, &e).await,
+            };
+            match search::search(state, &query).await {
+                Ok(result) => result,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        "pane.output" => {
+            let query = match OutputQuery::from_params(&request["params"]) {
+                Ok(query) => query,
+                Err(e) => return write_error(writer, id, codes::INVALID_PARAMS, &e).await,
+            };
+            match pane_output::capture(state, &query).await {
+                Ok(result) => result,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        "pane.transcript" => match transcript::export(state, &request["params"]).await {
+            Ok(result) => result,
+            Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+        },
+        "macro.list" => {
+            let st = state.lock().await;
+            serde_json::Value::Array(st.macros.iter().map(MacroDef::summary).collect())
+        }
+        "macro.run" => {
+            let result = macros::run(state, &request["params"]).await;
+            audit(
+                &mut *state.lock().await,
+                method,
+                actor,
+                &request["params"],
+                &result,
+            );
+            match result {
+                Ok(result) => result,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        "actions.history" => {
+            let query = match AuditQuery::from_params(&request["params"], chrono::Utc::now()) {
+                Ok(query) => query,
+                Err(e) => return write_error(writer, id, codes::INVALID_PARAMS, &e).await,
+            };
+            let st = state.lock().await;
+            serde_json::json!(st.audit.query(&query))
+        }
+        "schedule.list" => {
+            let st = state.lock().await;
+            serde_json::json!(st.scheduler.list())
+        }
+        "schedule.cancel" => {
+            let mut st = state.lock().await;
+            let result = match request["params"]["id"].as_u64() {
+                None => Err(ActionError::InvalidParams(
+                    "id must be an integer".to_string(),
+                )),
+                Some(scheduled) if st.scheduler.cancel(scheduled) => {
+                    Ok(serde_json::json!({"cancelled": scheduled}))
+                }
+                Some(scheduled) => Err(ActionError::InvalidParams(format!(
+                    "no pending send #{scheduled}"
+                ))),
+            };
+            audit(&mut st, method, actor, &request["params"], &result);
+            drop(st);
+            match result {
+                Ok(result) => result,
+                Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+            }
+        }
+        "recording.list" => match recorder::list_recordings(state).await {
+            Ok(result) => result,
+            Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+        },
+        "recording.replay" => match recorder::replay_recording(state, &request["params"]).await {
+            Ok(result) => result,
+            Err(e) => return write_error(writer, id, e.code(), &e.to_string()).await,
+        },
+        "responder.status" => {
+            let st = state.lock().await;
+            st.responder.status(request["params"]["rule"].as_str())
+        }
+        "responder.set_enabled" => {
+            let Some(enabled) = request["params"]["enabled"].as_bool() else {
+                return write_error(writer, id, codes::INVALID_PARAMS, "enabled must be a bool")
+                    .await;
+            };
+            let mut st = state.lock().await;
+            st.responder.set_enabled(enabled);
+            serde_json::json!({"enabled": st.responder.is_enabled()})
+        }
+        "restart.events" => {
+            let st = state.lock().await;
+            serde_json::json!(st.restarter.events().collect::<Vec<_>>())
+        }
         "daemon.info" => {
             let st = state.lock().await;
             serde_json::json!({
@@ -171,27 +568,57 @@ async fn handle_connection(
                 "pid": std::process::id(),
             })
         }
+        "daemon.capabilities" => {
+            let st = state.lock().await;
+            serde_json::json!({
+                "version": env!("CARGO_PKG_VERSION"),
+                "methods": METHODS,
+                "features": st.features.to_json(),
+            })
+        }
+        "debug.metrics" => {
+            let st = state.lock().await;
+            if !st.features.is_enabled(features::DEBUG_METRICS) {
+                drop(st);
+                return write_error(
+                    writer,
+                    id,
+                    codes::METHOD_NOT_FOUND,
+                    "debug.metrics is disabled (enable features.debug_metrics)",
+                )
+                .await;
+            }
+            build_debug_metrics(&st)
+        }
         "source.ingest" => {
             let params = &request["params"];
             let source_kind = params["source_kind"].as_str().unwrap_or("");
 
-            // T-115: Warn-only admission gate (Phase 1)
+            // T-115: Warn-only admission gate (Phase 1); rejects when the
+            // `strict_admission` feature is enabled.
             // Check trust guard if source_id/nonce are provided
             {
                 let source_id = params["source_id"].as_str().unwrap_or(source_kind);
                 let nonce = params["nonce"].as_str().unwrap_or("");
                 let st = state.lock().await;
-                // Use daemon's own UID as peer_uid (same-process, warn-only)
-                let peer_uid = st.trust_guard.expected_uid();
-                if !nonce.is_empty() {
-                    let result = st.trust_guard.check_admission(peer_uid, source_id, nonce);
-                    if let agtmux_gateway::trust_guard::AdmissionResult::Rejected(reason) = result {
-                        tracing::warn!(
-                            "source.ingest admission warning: {reason} (warn-only, processing continues)"
-                        );
+                let rejection = if !nonce.is_empty() {
+                    match st.trust_guard.check_admission(peer.uid, source_id, nonce) {
+                        agtmux_gateway::trust_guard::AdmissionResult::Rejected(reason) => {
+                            Some(format!("admission rejected: {reason}"))
+                        }
+                        _ => None,
                     }
                 } else if !st.trust_guard.is_registered(source_id) {
-                    tracing::warn!("source.ingest: unregistered source_id={source_id} (warn-only)");
+                    Some(format!("unregistered source_id={source_id}"))
+                } else {
+                    None
+                };
+                if let Some(reason) = rejection {
+                    if st.features.is_enabled(features::STRICT_ADMISSION) {
+                        drop(st);
+                        return write_error(writer, id, codes::ADMISSION_REJECTED, &reason).await;
+                    }
+                    tracing::warn!("source.ingest: {reason} (warn-only, processing continues)");
                 }
             }
             match source_kind {
@@ -208,7 +635,7 @@ async fn handle_connection(
                         Err(e) => {
                             let error_response = serde_json::json!({
                                 "jsonrpc": "2.0",
-                                "error": {"code": -32602, "message": format!("invalid event: {e}")},
+                                "error": {"code": codes::INVALID_PARAMS, "message": format!("invalid event: {e}")},
                                 "id": id,
                             });
                             let mut resp = serde_json::to_string(&error_response)?;
@@ -231,7 +658,7 @@ async fn handle_connection(
                         Err(e) => {
                             let error_response = serde_json::json!({
                                 "jsonrpc": "2.0",
-                                "error": {"code": -32602, "message": format!("invalid event: {e}")},
+                                "error": {"code": codes::INVALID_PARAMS, "message": format!("invalid event: {e}")},
                                 "id": id,
                             });
                             let mut resp = serde_json::to_string(&error_response)?;
@@ -244,7 +671,7 @@ async fn handle_connection(
                 _ => {
                     let error_response = serde_json::json!({
                         "jsonrpc": "2.0",
-                        "error": {"code": -32602, "message": format!("unknown source_kind: {source_kind:?}")},
+                        "error": {"code": codes::INVALID_PARAMS, "message": format!("unknown source_kind: {source_kind:?}")},
                         "id": id,
                     });
                     let mut resp = serde_json::to_string(&error_response)?;
@@ -255,30 +682,332 @@ async fn handle_connection(
             }
         }
         _ => {
-            let error_response = serde_json::json!({
-                "jsonrpc": "2.0",
-                "error": {"code": -32601, "message": "method not found"},
-                "id": id,
-            });
-            let mut resp = serde_json::to_string(&error_response)?;
-            resp.push('\n');
-            writer.write_all(resp.as_bytes()).await?;
-            return Ok(());
+            return write_error(writer, id, codes::METHOD_NOT_FOUND, "method not found").await;
         }
     };
 
-    let response = serde_json::json!({
+    write_result(writer, &id, &result).await
+}
+
+/// Write a JSON-RPC success response. An array result (`list_panes`,
+/// `list_sessions`, ...) is encoded item by item and flushed every
+/// `WRITE_CHUNK` bytes, so a list of thousands of panes is never held as one
+/// serialized string.
+async fn write_result(
+    writer: &mut tokio::net::unix::OwnedWriteHalf,
+    id: &serde_json::Value,
+    result: &serde_json::Value,
+) -> anyhow::Result<()> {
+    let mut buf = Vec::with_capacity(WRITE_CHUNK);
+    buf.extend_from_slice(br#"{"jsonrpc":"2.0","id":"#);
+    serde_json::to_writer(&mut buf, id)?;
+    buf.extend_from_slice(br#","result":"#);
+    match result {
+        serde_json::Value::Array(items) => {
+            buf.push(b'[');
+            for (i, item) in items.iter().enumerate() {
+                if i > 0 {
+                    buf.push(b',');
+                }
+                serde_json::to_writer(&mut buf, item)?;
+                if buf.len() >= WRITE_CHUNK {
+                    writer.write_all(&buf).await?;
+                    buf.clear();
+                }
+            }
+            buf.push(b']');
+        }
+        other => serde_json::to_writer(&mut buf, other)?,
+    }
+    buf.extend_from_slice(b"}\n");
+    writer.write_all(&buf).await?;
+    Ok(())
+}
+
+/// Record an action call in the audit trail.
+fn audit(
+    st: &mut DaemonState,
+    method: &str,
+    actor: Actor,
+    params: &serde_json::Value,
+    result: &Result<serde_json::Value, ActionError>,
+) {
+    let outcome = result.as_ref().map_err(ActionError::to_string);
+    st.audit
+        .record(AuditEntry::new(method, actor, params, outcome));
+}
+
+/// Write a JSON-RPC error response.
+async fn write_error(
+    writer: &mut tokio::net::unix::OwnedWriteHalf,
+    id: serde_json::Value,
+    code: i64,
+    message: &str,
+) -> anyhow::Result<()> {
+    let error_response = serde_json::json!({
         "jsonrpc": "2.0",
-        "result": result,
+        "error": {"code": code, "message": message},
         "id": id,
     });
-    let mut resp = serde_json::to_string(&response)?;
-    resp.push('\n');
-    writer.write_all(resp.as_bytes()).await?;
-
+    let mut buf = serde_json::to_vec(&error_response)?;
+    buf.push(b'\n');
+    writer.write_all(&buf).await?;
     Ok(())
 }
 
+/// Serve a `watch` stream until the client disconnects.
+///
+/// Every frame is a JSON-RPC notification `{"method": "watch", "params":
+/// <state_changed result>}`. The first frame is sent immediately; later ones
+/// when the version advances, or as an empty heartbeat after `WATCH_HEARTBEAT`.
+/// With `summary_only` the params are `{version, summary}` instead: counts
+/// for status bars, without building or sending the changes.
+async fn stream_watch(
+    writer: &mut tokio::net::unix::OwnedWriteHalf,
+    state: &Arc<Mutex<DaemonState>>,
+    since_version: u64,
+    summary_only: bool,
+) -> anyhow::Result<()> {
+    let mut cursor = since_version;
+    let mut last_sent: Option<std::time::Instant> = None;
+    // Reused across frames; grows to the largest frame sent.
+    let mut buf = Vec::new();
+    loop {
+        let heartbeat_due = last_sent.is_none_or(|t| t.elapsed() >= WATCH_HEARTBEAT);
+        let frame = {
+            let st = state.lock().await;
+            build_watch_frame(&st, cursor, heartbeat_due, summary_only)
+        };
+        if let Some(frame) = frame {
+            cursor = frame["version"].as_u64().unwrap_or(cursor);
+            let notification = serde_json::json!({
+                "jsonrpc": "2.0",
+                "method": "watch",
+                "params": frame,
+            });
+            buf.clear();
+            serde_json::to_writer(&mut buf, &notification)?;
+            buf.push(b'\n');
+            if writer.write_all(&buf).await.is_err() {
+                // Client went away; not an error.
+                return Ok(());
+            }
+            last_sent = Some(std::time::Instant::now());
+        }
+        tokio::time::sleep(WATCH_CHECK_INTERVAL).await;
+    }
+}
+
+/// Serve a `watch` stream of pane delta events (`deltas: true`).
+///
+/// Frames are `{"method": "watch", "params": {cursor, events}}` with the
+/// `pane.*` events after the client's cursor. The first frame carries
+/// `snapshot` (the full pane list) instead, unless `since_cursor` can be
+/// resumed from; so does any frame after the client fell too far behind.
+/// Empty heartbeats as for `watch`.
+async fn stream_pane_events(
+    writer: &mut tokio::net::unix::OwnedWriteHalf,
+    state: &Arc<Mutex<DaemonState>>,
+    since_cursor: Option<u64>,
+) -> anyhow::Result<()> {
+    let mut cursor = since_cursor;
+    let mut last_sent: Option<std::time::Instant> = None;
+    let mut buf = Vec::new();
+    loop {
+        let heartbeat_due = last_sent.is_none_or(|t| t.elapsed() >= WATCH_HEARTBEAT);
+        let frame = {
+            let st = state.lock().await;
+            build_pane_events_frame(&st, cursor, heartbeat_due)
+        };
+        if let Some(frame) = frame {
+            cursor = frame["cursor"].as_u64().or(cursor);
+            let notification = serde_json::json!({
+                "jsonrpc": "2.0",
+                "method": "watch",
+                "params": frame,
+            });
+            buf.clear();
+            serde_json::to_writer(&mut buf, &notification)?;
+            buf.push(b'\n');
+            if writer.write_all(&buf).await.is_err() {
+                return Ok(());
+            }
+            last_sent = Some(std::time::Instant::now());
+        }
+        tokio::time::sleep(WATCH_CHECK_INTERVAL).await;
+    }
+}
+
+/// Serve a `watch` stream of ingested source events (`source_events: true`).
+///
+/// Frames are `{"method": "watch", "params": {cursor, events}}` with the
+/// events after `since_seq` that pass `filter`; without `since_seq` the
+/// stream starts at the newest event. `gap: true` marks a frame after events
+/// were lost (cursor too old or from a previous daemon). Empty heartbeats as
+/// for `watch`; the first frame is sent immediately.
+async fn stream_source_events(
+    writer: &mut tokio::net::unix::OwnedWriteHalf,
+    state: &Arc<Mutex<DaemonState>>,
+    since_seq: Option<u64>,
+    filter: EventFilter,
+) -> anyhow::Result<()> {
+    let mut cursor = match since_seq {
+        Some(seq) => seq,
+        None => state.lock().await.source_events.cursor(),
+    };
+    let mut last_sent: Option<std::time::Instant> = None;
+    let mut buf = Vec::new();
+    loop {
+        let heartbeat_due = last_sent.is_none_or(|t| t.elapsed() >= WATCH_HEARTBEAT);
+        let frame = {
+            let st = state.lock().await;
+            build_source_events_frame(&st, cursor, &filter, heartbeat_due)
+        };
+        if let Some(frame) = frame {
+            cursor = frame["cursor"].as_u64().unwrap_or(cursor);
+            let notification = serde_json::json!({
+                "jsonrpc": "2.0",
+                "method": "watch",
+                "params": frame,
+            });
+            buf.clear();
+            serde_json::to_writer(&mut buf, &notification)?;
+            buf.push(b'\n');
+            if writer.write_all(&buf).await.is_err() {
+                return Ok(());
+            }
+            last_sent = Some(std::time::Instant::now());
+        }
+        tokio::time::sleep(WATCH_CHECK_INTERVAL).await;
+    }
+}
+
+/// Next source event frame for a client at `cursor`, or None when there is
+/// nothing to send.
+pub(crate) fn build_source_events_frame(
+    state: &DaemonState,
+    cursor: u64,
+    filter: &EventFilter,
+    heartbeat_due: bool,
+) -> Option<serde_json::Value> {
+    let batch = state.source_events.since(cursor, filter);
+    if batch.events.is_empty() && !batch.gap && !heartbeat_due {
+        return None;
+    }
+    let mut frame = serde_json::json!({"cursor": batch.cursor, "events": batch.events});
+    if batch.gap {
+        frame["gap"] = serde_json::Value::Bool(true);
+    }
+    Some(frame)
+}
+
+/// Next delta frame for a client at `cursor` (None: needs a snapshot), or
+/// None when there is nothing to send.
+pub(crate) fn build_pane_events_frame(
+    state: &DaemonState,
+    cursor: Option<u64>,
+    heartbeat_due: bool,
+) -> Option<serde_json::Value> {
+    let log = &state.pane_events;
+    match cursor.and_then(|c| log.since(c)) {
+        Some(events) if events.is_empty() && !heartbeat_due => None,
+        Some(events) => Some(serde_json::json!({"cursor": log.cursor(), "events": events})),
+        None => Some(serde_json::json!({
+            "cursor": log.cursor(),
+            "events": [],
+            "snapshot": log.snapshot(),
+        })),
+    }
+}
+
+/// Next `watch` frame for a client at `cursor`, or None when there is nothing
+/// to send. A cursor ahead of the daemon (daemon restarted) restarts from 0.
+pub(crate) fn build_watch_frame(
+    state: &DaemonState,
+    cursor: u64,
+    heartbeat_due: bool,
+    summary_only: bool,
+) -> Option<serde_json::Value> {
+    let version = state.daemon.version();
+    let cursor = if cursor > version { 0 } else { cursor };
+    if !(version > cursor || heartbeat_due) {
+        return None;
+    }
+    Some(if summary_only {
+        serde_json::json!({"version": version, "summary": build_summary(state)})
+    } else {
+        build_state_changed(state, cursor)
+    })
+}
+
+/// `build_pane_list`, reused until the projection version or
+/// `DaemonState::pane_list_epoch` moves. Shared rather than copied, so
+/// callers can drop the state lock before copying out what they return.
+pub(crate) fn cached_pane_list(state: &mut DaemonState) -> Arc<serde_json::Value> {
+    let key = (state.daemon.version(), state.pane_list_epoch);
+    if let Some((cached_key, panes)) = &state.pane_list_cache
+        && *cached_key == key
+    {
+        return Arc::clone(panes);
+    }
+    let panes = Arc::new(build_pane_list(state));
+    state.pane_list_cache = Some((key, Arc::clone(&panes)));
+    panes
+}
+
+/// `cached_pane_list`, with any change since the last call recorded in
+/// `DaemonState::pane_events` so its cursor covers this very list.
+pub(crate) fn observed_pane_list(state: &mut DaemonState) -> Arc<serde_json::Value> {
+    let key = (state.daemon.version(), state.pane_list_epoch);
+    let panes = cached_pane_list(state);
+    state.pane_events.observe_build(key, &panes);
+    panes
+}
+
+/// `list_panes {since_cursor}`: `{cursor, full, panes, removed}`, where
+/// `panes` are the entries added or changed after `since` (a `pane_events`
+/// cursor, as for `watch {deltas}`) and `removed` the ids of panes gone or no
+/// longer matching `repo` / `branch`. A cursor that cannot be resumed from
+/// gets every pane with `full: true`. `fields` applies to `panes`.
+pub(crate) fn pane_list_changes(
+    state: &mut DaemonState,
+    since: u64,
+    query: &PaneListQuery,
+) -> serde_json::Value {
+    let (repo, branch) = (query.repo.as_deref(), query.branch.as_deref());
+    let panes = observed_pane_list(state);
+    let cursor = state.pane_events.cursor();
+    let Some((changed, mut removed)) = state.pane_events.changes_since(since) else {
+        // Without `limit` / `sort` this is the filtered, projected list.
+        let panes = query.apply(&panes);
+        return serde_json::json!({
+            "cursor": cursor,
+            "full": true,
+            "panes": panes,
+            "removed": [],
+        });
+    };
+    let changed_ids: Vec<String> = changed
+        .iter()
+        .filter_map(|p| p["pane_id"].as_str().map(String::from))
+        .collect();
+    let mut changed = filter_pane_list(serde_json::Value::Array(changed), repo, branch);
+    let kept: std::collections::HashSet<&str> = changed
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter_map(|p| p["pane_id"].as_str())
+        .collect();
+    removed.extend(
+        changed_ids
+            .into_iter()
+            .filter(|id| !kept.contains(id.as_str())),
+    );
+    removed.sort_by_key(|id| pane_order_key(id));
+    query.project(&mut changed);
+    serde_json::json!({"cursor": cursor, "full": false, "panes": changed, "removed": removed})
+}
+
 /// Build a combined pane list: managed panes from daemon + unmanaged panes from tmux.
 pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
     let managed_panes = state.daemon.list_panes();
@@ -287,14 +1016,20 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
         .map(|p| p.pane_instance_id.pane_id.as_str())
         .collect();
 
+    // Index tmux panes once instead of scanning them for every managed pane.
+    let tmux_by_id: std::collections::HashMap<&str, &agtmux_tmux_v5::TmuxPaneInfo> = state
+        .last_panes
+        .iter()
+        .map(|p| (p.pane_id.as_str(), p))
+        .collect();
+
     let mut result: Vec<serde_json::Value> = Vec::new();
 
     // Add managed panes
     for pane in &managed_panes {
-        let tmux_info = state
-            .last_panes
-            .iter()
-            .find(|p| p.pane_id == pane.pane_instance_id.pane_id);
+        let tmux_info = tmux_by_id
+            .get(pane.pane_instance_id.pane_id.as_str())
+            .copied();
 
         // Resolve display title (FR-015/FR-016)
         let pane_title = tmux_info.map_or(String::new(), |t| t.pane_title.clone());
@@ -311,6 +1046,7 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
             is_managed: true,
         };
         let title_decision = resolve_title(&title_input);
+        let git = tmux_info.and_then(|t| git_meta_for(state, &t.current_path));
 
         result.push(serde_json::json!({
             "pane_id": pane.pane_instance_id.pane_id,
@@ -327,7 +1063,12 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
             },
             "activity_state": format!("{:?}", pane.activity_state),
             "provider": pane.provider.map(|p| p.as_str()),
+            "adapter": state.pane_adapters.get(&pane.pane_instance_id.pane_id),
             "conversation_title": state.conversation_titles.get(&pane.session_key),
+            "label": state.pane_labels.get(&pane.pane_instance_id.pane_id),
+            "task": state.pane_tasks.get(&pane.pane_instance_id.pane_id),
+            "launch": state.launches.get(&pane.pane_instance_id.pane_id),
+            "groups": state.groups.groups_of(&pane.pane_instance_id.pane_id),
             "title": title_decision.title,
             "title_quality": format!("{:?}", title_decision.quality),
             "session_id": tmux_info.map(|t| &t.session_id),
@@ -336,7 +1077,8 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
             "window_name": tmux_info.map(|t| &t.window_name),
             "current_cmd": tmux_info.map(|t| &t.current_cmd),
             "current_path": tmux_info.map(|t| &t.current_path),
-            "git_branch": serde_json::Value::Null,
+            "git_repo": git.map(|g| &g.repo),
+            "git_branch": git.map(|g| &g.branch),
             "updated_at": pane.updated_at,
         }));
     }
@@ -353,10 +1095,15 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
                 is_managed: false,
             };
             let title_decision = resolve_title(&title_input);
+            let git = git_meta_for(state, &tmux_pane.current_path);
 
             result.push(serde_json::json!({
                 "pane_id": tmux_pane.pane_id,
                 "presence": PanePresence::Unmanaged,
+                "label": state.pane_labels.get(&tmux_pane.pane_id),
+                "task": state.pane_tasks.get(&tmux_pane.pane_id),
+                "launch": state.launches.get(&tmux_pane.pane_id),
+                "groups": state.groups.groups_of(&tmux_pane.pane_id),
                 "title": title_decision.title,
                 "title_quality": format!("{:?}", title_decision.quality),
                 "session_id": tmux_pane.session_id,
@@ -365,7 +1112,8 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
                 "window_name": tmux_pane.window_name,
                 "current_cmd": tmux_pane.current_cmd,
                 "current_path": tmux_pane.current_path,
-                "git_branch": serde_json::Value::Null,
+                "git_repo": git.map(|g| &g.repo),
+                "git_branch": git.map(|g| &g.branch),
             }));
         }
     }
@@ -373,11 +1121,66 @@ pub(crate) fn build_pane_list(state: &DaemonState) -> serde_json::Value {
     serde_json::Value::Array(result)
 }
 
+fn git_meta_for<'a>(state: &'a DaemonState, path: &str) -> Option<&'a GitMeta> {
+    state.git_meta.get(path).and_then(Option::as_ref)
+}
+
+/// `list_panes` `repo` / `branch` filters. `repo` matches the work tree root
+/// or its directory name; panes outside a repository never match.
+pub(crate) fn filter_pane_list(
+    panes: serde_json::Value,
+    repo: Option<&str>,
+    branch: Option<&str>,
+) -> serde_json::Value {
+    if repo.is_none() && branch.is_none() {
+        return panes;
+    }
+    let serde_json::Value::Array(panes) = panes else {
+        return panes;
+    };
+    serde_json::Value::Array(
+        panes
+            .into_iter()
+            .filter(|pane| pane_in_git(pane, repo, branch))
+            .collect(),
+    )
+}
+
+/// Whether a `list_panes` entry passes the `repo` / `branch` filters.
+pub(crate) fn pane_in_git(
+    pane: &serde_json::Value,
+    repo: Option<&str>,
+    branch: Option<&str>,
+) -> bool {
+    if repo.is_none() && branch.is_none() {
+        return true;
+    }
+    let (Some(pane_repo), Some(pane_branch)) =
+        (pane["git_repo"].as_str(), pane["git_branch"].as_str())
+    else {
+        return false;
+    };
+    let meta = GitMeta {
+        repo: pane_repo.to_string(),
+        branch: pane_branch.to_string(),
+    };
+    repo.is_none_or(|r| meta.matches_repo(r)) && branch.is_none_or(|b| meta.branch == b)
+}
+
+/// `%12` sorts numerically; anything else after all numeric ids.
+pub(crate) fn pane_order_key(pane_id: &str) -> (u64, String) {
+    let n = pane_id
+        .strip_prefix('%')
+        .and_then(|n| n.parse().ok())
+        .unwrap_or(u64::MAX);
+    (n, pane_id.to_string())
+}
+
 /// Build a `latency_status` response from cached evaluation (Codex F4: read-only, no evaluate()).
 pub(crate) fn build_latency_status(state: &DaemonState) -> serde_json::Value {
     use agtmux_gateway::latency_window::LatencyEvaluation;
 
-    match &state.last_latency_eval {
+    let mut status = match &state.last_latency_eval {
         Some(LatencyEvaluation::InsufficientData {
             sample_count,
             min_required,
@@ -420,7 +1223,33 @@ pub(crate) fn build_latency_status(state: &DaemonState) -> serde_json::Value {
             "p95_ms": null,
             "consecutive_breaches": 0,
         }),
-    }
+    };
+    status["exec_pool"] = serde_json::json!(state.exec_pool.stats());
+    status
+}
+
+/// `debug.metrics`: process and runtime metrics plus the size of every
+/// in-memory structure the poll pipeline grows.
+pub(crate) fn build_debug_metrics(state: &DaemonState) -> serde_json::Value {
+    serde_json::json!({
+        "uptime_secs": state.started_at.elapsed().as_secs(),
+        "process": crate::runtime_metrics::process_metrics(),
+        "tokio": crate::runtime_metrics::tokio_metrics(),
+        "exec_pool": state.exec_pool.stats(),
+        "state": {
+            "version": state.daemon.version(),
+            "managed_panes": state.daemon.pane_count(),
+            "sessions": state.daemon.session_count(),
+            "tmux_panes": state.last_panes.len(),
+            "poller_buffered": state.poller.buffered_len(),
+            "conversation_titles": {
+                "len": state.conversation_titles.len(),
+                "capacity": state.conversation_titles.capacity(),
+            },
+            "pane_labels": state.pane_labels.len(),
+            "jsonl_watchers": state.claude_jsonl_watchers.len(),
+        },
+    })
 }
 
 /// Build a `state_changed` response: changes since a given version with full state.
@@ -480,29 +1309,46 @@ pub(crate) fn build_summary_changed(state: &DaemonState, since_version: u64) ->
     let pane_changes = changes.iter().filter(|c| c.pane_id.is_some()).count();
     let session_changes = changes.iter().filter(|c| c.pane_id.is_none()).count();
 
+    serde_json::json!({
+        "has_changes": !changes.is_empty(),
+        "pane_changes": pane_changes,
+        "session_changes": session_changes,
+        "version": current_version,
+        "summary": build_summary(state),
+    })
+}
+
+/// Pane counts shared by `summary_changed` and summary-only `watch` frames.
+/// `by_state` / `by_provider` count managed panes only.
+fn build_summary(state: &DaemonState) -> serde_json::Value {
     let managed_panes = state.daemon.list_panes();
     let managed_count = managed_panes.len();
     let total_panes = state.last_panes.len();
     let unmanaged_count = total_panes - managed_count.min(total_panes);
 
-    let deterministic_count = managed_panes
-        .iter()
-        .filter(|p| p.evidence_mode == EvidenceMode::Deterministic)
-        .count();
-    let heuristic_count = managed_count - deterministic_count;
+    let mut deterministic_count = 0;
+    let mut by_state = std::collections::BTreeMap::<String, usize>::new();
+    let mut by_provider = std::collections::BTreeMap::<&str, usize>::new();
+    for pane in &managed_panes {
+        if pane.evidence_mode == EvidenceMode::Deterministic {
+            deterministic_count += 1;
+        }
+        *by_state
+            .entry(format!("{:?}", pane.activity_state))
+            .or_default() += 1;
+        *by_provider
+            .entry(pane.provider.map_or("unknown", |p| p.as_str()))
+            .or_default() += 1;
+    }
 
     serde_json::json!({
-        "has_changes": !changes.is_empty(),
-        "pane_changes": pane_changes,
-        "session_changes": session_changes,
-        "version": current_version,
-        "summary": {
-            "managed": managed_count,
-            "unmanaged": unmanaged_count,
-            "total": total_panes,
-            "deterministic": deterministic_count,
-            "heuristic": heuristic_count,
-        },
+        "managed": managed_count,
+        "unmanaged": unmanaged_count,
+        "total": total_panes,
+        "deterministic": deterministic_count,
+        "heuristic": managed_count - deterministic_count,
+        "by_state": by_state,
+        "by_provider": by_provider,
     })
 }
 
@@ -878,6 +1724,167 @@ mod tests {
         assert_eq!(result["version"], current_version);
     }
 
+    #[test]
+    fn metrics_render_panes_and_histograms() {
+        let mut state = make_managed_state();
+        state.metrics.count_events("poller", 3);
+        state
+            .metrics
+            .observe_action("pane.kill", std::time::Duration::from_millis(30));
+        let text = crate::metrics::render(&state, chrono::Utc::now());
+        assert!(
+            text.contains("agtmux_managed_panes{state=\"Unknown\",provider=\"claude\"} 1\n"),
+            "{text}"
+        );
+        assert!(text.contains("agtmux_unmanaged_panes 0\n"));
+        assert!(text.contains("agtmux_attention_panes 0\n"));
+        assert!(text.contains("agtmux_events_ingested_total{source=\"poller\"} 3\n"));
+        assert!(text.contains("agtmux_poll_tick_duration_seconds_count 0\n"));
+        assert!(text.contains(
+            "agtmux_action_duration_seconds_bucket{method=\"pane.kill\",le=\"0.05\"} 1\n"
+        ));
+        assert!(text.contains("# TYPE agtmux_action_duration_seconds histogram\n"));
+    }
+
+    #[test]
+    fn watch_frame_on_change_heartbeat_and_restart() {
+        let state = make_managed_state();
+        let current = state.daemon.version();
+
+        let frame = build_watch_frame(&state, 0, false, false).expect("changes pending");
+        assert!(!frame["changes"].as_array().expect("changes").is_empty());
+        assert_eq!(frame["version"], current);
+
+        assert!(build_watch_frame(&state, current, false, false).is_none());
+        let heartbeat = build_watch_frame(&state, current, true, false).expect("heartbeat");
+        assert!(heartbeat["changes"].as_array().expect("changes").is_empty());
+
+        // Cursor from a previous daemon instance: replay from scratch.
+        let frame = build_watch_frame(&state, current + 100, false, false).expect("reset");
+        assert!(!frame["changes"].as_array().expect("changes").is_empty());
+    }
+
+    #[test]
+    fn summary_only_watch_frame_omits_changes() {
+        let state = make_managed_state();
+        let current = state.daemon.version();
+
+        let frame = build_watch_frame(&state, 0, false, true).expect("changes pending");
+        assert_eq!(frame["version"], current);
+        assert!(frame.get("changes").is_none(), "no items for summary-only");
+        assert_eq!(frame["summary"]["managed"], 1);
+        assert_eq!(frame["summary"]["by_provider"]["claude"], 1);
+        let by_state = frame["summary"]["by_state"].as_object().expect("by_state");
+        assert_eq!(by_state.values().filter_map(|n| n.as_u64()).sum::<u64>(), 1);
+
+        assert!(build_watch_frame(&state, current, false, true).is_none());
+        assert!(build_watch_frame(&state, current, true, true).is_some());
+    }
+
+    #[test]
+    fn pane_events_frame_snapshot_then_deltas() {
+        let mut state = make_managed_state();
+        let panes = cached_pane_list(&mut state);
+        state.pane_events.observe(&panes);
+        let cursor = state.pane_events.cursor();
+
+        let frame = build_pane_events_frame(&state, None, false).expect("snapshot");
+        assert_eq!(frame["cursor"], cursor);
+        assert_eq!(frame["snapshot"], *panes);
+
+        assert!(build_pane_events_frame(&state, Some(cursor), false).is_none());
+        let heartbeat = build_pane_events_frame(&state, Some(cursor), true).expect("heartbeat");
+        assert!(heartbeat.get("snapshot").is_none());
+
+        state
+            .pane_labels
+            .insert("%0".to_string(), "api".to_string());
+        state.invalidate_pane_list();
+        let panes = cached_pane_list(&mut state);
+        assert_eq!(state.pane_events.observe(&panes), 1);
+        let frame = build_pane_events_frame(&state, Some(cursor), false).expect("delta");
+        assert_eq!(frame["events"][0]["type"], "pane.updated");
+        assert_eq!(frame["events"][0]["fields"], serde_json::json!(["label"]));
+
+        // Cursor from a previous daemon instance: snapshot again.
+        let frame = build_pane_events_frame(&state, Some(cursor + 100), false).expect("reset");
+        assert!(frame.get("snapshot").is_some());
+    }
+
+    #[tokio::test]
+    async fn connection_serves_multiple_requests() {
+        let state = Arc::new(Mutex::new(make_state()));
+        let (client, server) = tokio::net::UnixStream::pair().expect("unix pair");
+        let handler = tokio::spawn(handle_connection(server, state));
+
+        let (reader, mut writer) = client.into_split();
+        let mut lines = BufReader::new(reader).lines();
+        for id in 1..=2 {
+            let req = serde_json::json!({"jsonrpc": "2.0", "method": "daemon.info", "id": id});
+            writer
+                .write_all(format!("{req}\n").as_bytes())
+                .await
+                .expect("write");
+            let line = lines.next_line().await.expect("read").expect("response");
+            let resp: serde_json::Value = serde_json::from_str(&line).expect("json");
+            assert_eq!(resp["id"], id);
+        }
+        writer.shutdown().await.expect("shutdown");
+        handler.await.expect("join").expect("clean close on EOF");
+    }
+
+    #[tokio::test]
+    async fn write_result_encodes_large_arrays_in_chunks() {
+        let (client, server) = tokio::net::UnixStream::pair().expect("unix pair");
+        let (_, mut writer) = server.into_split();
+        let items: Vec<serde_json::Value> = (0..5000)
+            .map(|i| serde_json::json!({"pane_id": format!("%{i}"), "title": "x".repeat(40)}))
+            .collect();
+        let result = serde_json::Value::Array(items);
+
+        let expected = result.clone();
+        let reader = tokio::spawn(async move {
+            let mut line = String::new();
+            BufReader::new(client)
+                .read_line(&mut line)
+                .await
+                .expect("read");
+            line
+        });
+        write_result(&mut writer, &serde_json::json!(7), &result)
+            .await
+            .expect("write");
+        drop(writer);
+
+        let line = reader.await.expect("join");
+        assert!(line.len() > WRITE_CHUNK, "spans several chunks");
+        let resp: serde_json::Value = serde_json::from_str(&line).expect("one JSON line");
+        assert_eq!(resp["jsonrpc"], "2.0");
+        assert_eq!(resp["id"], 7);
+        assert_eq!(resp["result"], expected);
+    }
+
+    #[tokio::test]
+    async fn watch_streams_initial_frame() {
+        let state = Arc::new(Mutex::new(make_managed_state()));
+        let (client, server) = tokio::net::UnixStream::pair().expect("unix pair");
+        tokio::spawn(handle_connection(server, state));
+
+        let (reader, mut writer) = client.into_split();
+        writer
+            .write_all(b"{\"jsonrpc\":\"2.0\",\"method\":\"watch\",\"id\":1}\n")
+            .await
+            .expect("write");
+        let mut line = String::new();
+        BufReader::new(reader)
+            .read_line(&mut line)
+            .await
+            .expect("read");
+        let frame: serde_json::Value = serde_json::from_str(line.trim()).expect("json");
+        assert_eq!(frame["method"], "watch");
+        assert!(frame["params"]["version"].as_u64().expect("version") > 0);
+    }
+
     #[test]
     fn summary_changed_returns_counts() {
         let state = make_managed_state();
@@ -1049,6 +2056,8 @@ mod tests {
         let resp = call_handler(Arc::clone(&state), request.clone()).await;
         assert_eq!(resp["result"]["status"], "not_started");
         assert_eq!(resp["result"]["sample_count"], 0);
+        assert_eq!(resp["result"]["exec_pool"]["limit"], 4);
+        assert_eq!(resp["result"]["exec_pool"]["queued"], 0);
 
         // Simulate a poll tick with latency recording
         {
@@ -1198,6 +2207,198 @@ mod tests {
 
     // ── T-115: TrustGuard admission + daemon.info tests ───────────────
 
+    #[tokio::test]
+    async fn peer_outside_allowed_uids_rejected() {
+        let request = serde_json::json!({"jsonrpc": "2.0", "method": "daemon.info", "id": 5});
+        let state = Arc::new(Mutex::new(make_state()));
+        let resp = call_handler(Arc::clone(&state), request.clone()).await;
+        assert!(
+            resp["result"]["pid"].is_u64(),
+            "own user admitted by default"
+        );
+
+        let own_uid = state.lock().await.trust_guard.expected_uid();
+        state.lock().await.allowed_uids = vec![own_uid.wrapping_add(1)];
+        let resp = call_handler(state, request).await;
+        assert_eq!(resp["id"], 5);
+        assert_eq!(resp["error"]["code"], codes::ADMISSION_REJECTED);
+    }
+
+    #[tokio::test]
+    async fn access_scopes_gate_methods() {
+        use crate::access::{AccessPolicy, AccessSettings, Scope, TokenEntry, token_digest};
+
+        let state = Arc::new(Mutex::new(make_state()));
+        state.lock().await.access = AccessPolicy::new(&AccessSettings {
+            default_scope: Some(Scope::Read),
+            tokens: vec![TokenEntry {
+                name: "ops".to_string(),
+                scope: Scope::Act,
+                sha256: token_digest("s3cret"),
+            }],
+            ..Default::default()
+        });
+        let kill = |meta: serde_json::Value| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "pane.kill", "id": 9,
+                "params": {"pane_id": "%404"}, "meta": meta})
+        };
+
+        let resp = call_handler(Arc::clone(&state), kill(serde_json::json!({}))).await;
+        assert_eq!(resp["error"]["code"], codes::FORBIDDEN);
+        assert_eq!(
+            resp["error"]["message"],
+            "pane.kill needs scope act; caller has read"
+        );
+        let by_selector = serde_json::json!({"jsonrpc": "2.0", "method": "pane.kill", "id": 9,
+            "params": {"pane_id": "session=secret"}});
+        let resp = call_handler(Arc::clone(&state), by_selector).await;
+        assert_eq!(
+            resp["error"]["code"],
+            codes::FORBIDDEN,
+            "refused before the selector is resolved: {resp}"
+        );
+        let info = serde_json::json!({"jsonrpc": "2.0", "method": "daemon.info", "id": 1});
+        let resp = call_handler(Arc::clone(&state), info).await;
+        assert!(resp["result"]["pid"].is_u64(), "read is enough for info");
+        let archive = serde_json::json!({"jsonrpc": "2.0", "method": "pane.transcript", "id": 4,
+            "params": {"pane_id": "%404", "archive_dir": "/etc/cron.d"}});
+        let resp = call_handler(Arc::clone(&state), archive).await;
+        assert_eq!(
+            resp["error"]["message"], "pane.transcript needs scope act; caller has read",
+            "archive_dir writes files: {resp}"
+        );
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            kill(serde_json::json!({"token": "s3cret"})),
+        )
+        .await;
+        assert_eq!(
+            resp["error"]["code"],
+            codes::PANE_NOT_FOUND,
+            "token grants act; the kill reaches the action guard"
+        );
+        let resp = call_handler(state, kill(serde_json::json!({"token": "guess"}))).await;
+        assert_eq!(resp["error"]["code"], codes::FORBIDDEN);
+    }
+
+    #[tokio::test]
+    async fn actions_are_audited_with_their_caller() {
+        let state = Arc::new(Mutex::new(make_state()));
+        let kill = serde_json::json!({"jsonrpc": "2.0", "method": "pane.kill", "id": 1,
+            "params": {"pane_id": "%404", "force": true}, "meta": {"client": "test/1"}});
+        let resp = call_handler(Arc::clone(&state), kill).await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        let list = serde_json::json!({"jsonrpc": "2.0", "method": "group.list", "id": 2});
+        call_handler(Arc::clone(&state), list).await;
+
+        let history = |params: serde_json::Value| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "actions.history", "id": 3,
+                "params": params})
+        };
+        let resp = call_handler(Arc::clone(&state), history(serde_json::json!({}))).await;
+        let entries = resp["result"].as_array().expect("entries");
+        assert_eq!(entries.len(), 1, "reads are not audited: {entries:?}");
+        let entry = &entries[0];
+        assert_eq!(entry["method"], "pane.kill");
+        assert_eq!(entry["targets"], serde_json::json!(["%404"]));
+        assert_eq!(entry["detail"]["force"], true);
+        assert_eq!(entry["ok"], false);
+        assert_eq!(entry["actor"]["client"], "test/1");
+        assert!(entry["actor"]["uid"].is_u64());
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            history(serde_json::json!({"target": "%1"})),
+        )
+        .await;
+        assert_eq!(resp["result"], serde_json::json!([]));
+        let resp = call_handler(state, history(serde_json::json!({"since": "soon"}))).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    #[tokio::test]
+    async fn sends_can_be_scheduled_and_cancelled() {
+        let state = Arc::new(Mutex::new(make_state()));
+        let send = |params: serde_json::Value| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "pane.send", "id": 1,
+                "params": params, "meta": {"client": "test/1"}})
+        };
+        // Targets are checked when the send runs, not when it is scheduled.
+        for after in ["10m", "1h"] {
+            let resp = call_handler(
+                Arc::clone(&state),
+                send(serde_json::json!({"pane_ids": ["%404"], "text": "go", "after": after})),
+            )
+            .await;
+            assert!(resp["result"]["due"].is_string(), "{resp}");
+        }
+        // A retried call with the same request_ref parks nothing new.
+        let later = serde_json::json!({"pane_ids": ["%404"], "text": "go", "after": "2h",
+            "request_ref": "later-1"});
+        let first = call_handler(Arc::clone(&state), send(later.clone())).await;
+        assert_eq!(first["result"]["replayed"], false, "{first}");
+        let retried = call_handler(Arc::clone(&state), send(later)).await;
+        assert_eq!(retried["result"]["id"], first["result"]["id"]);
+        assert_eq!(retried["result"]["replayed"], true);
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(serde_json::json!({"pane_ids": ["%404"], "after": "10m", "enter": false})),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(serde_json::json!({"pane_ids": ["%404"], "text": "go", "at": "noon"})),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+
+        let list = serde_json::json!({"jsonrpc": "2.0", "method": "schedule.list", "id": 2});
+        let resp = call_handler(Arc::clone(&state), list.clone()).await;
+        let pending = resp["result"].as_array().expect("pending");
+        assert_eq!(pending.len(), 3);
+        assert!(pending[0]["params"].get("after").is_none());
+        assert!(pending[2]["params"].get("request_ref").is_none());
+        let cancel = |id: u64| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "schedule.cancel", "id": 3,
+                "params": {"id": id}})
+        };
+        let second = pending[1]["id"].as_u64().expect("id");
+        let resp = call_handler(Arc::clone(&state), cancel(second)).await;
+        assert_eq!(resp["result"]["cancelled"], second);
+        let resp = call_handler(Arc::clone(&state), cancel(second)).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+
+        let due = state
+            .lock()
+            .await
+            .scheduler
+            .take_due(chrono::Utc::now() + chrono::Duration::hours(1));
+        for scheduled in due {
+            schedule::run(Arc::clone(&state), scheduled).await;
+        }
+        let st = state.lock().await;
+        assert_eq!(st.scheduler.list().len(), 1, "the 2h send is still pending");
+        let entries = st.audit.query(&AuditQuery {
+            limit: 10,
+            ..Default::default()
+        });
+        let methods: Vec<(&str, bool)> =
+            entries.iter().map(|e| (e.method.as_str(), e.ok)).collect();
+        assert_eq!(
+            methods,
+            [
+                ("schedule.cancel", true),
+                ("schedule.cancel", false),
+                ("pane.send", false)
+            ],
+            "the pane is gone when the send runs"
+        );
+        assert_eq!(entries[2].detail["scheduled"], 1);
+        assert_eq!(entries[2].actor.client.as_deref(), Some("test/1"));
+    }
+
     #[tokio::test]
     async fn trust_guard_admits_matching_uid() {
         // source.ingest with a registered source_id should succeed (warn-only)
@@ -1338,6 +2539,70 @@ mod tests {
         assert_eq!(pane["current_path"], "/home/user/project");
     }
 
+    #[test]
+    fn build_pane_list_git_fields_and_filters() {
+        let mut state = make_state();
+        let pane = |pane_id: &str, path: &str| TmuxPaneInfo {
+            pane_id: pane_id.to_string(),
+            current_path: path.to_string(),
+            ..Default::default()
+        };
+        state.last_panes = vec![
+            pane("%1", "/src/agtmux"),
+            pane("%2", "/src/agtmux/crates"),
+            pane("%3", "/src/other"),
+            pane("%4", "/tmp"),
+        ];
+        let meta = |repo: &str, branch: &str| {
+            Some(GitMeta {
+                repo: repo.to_string(),
+                branch: branch.to_string(),
+            })
+        };
+        state.git_meta = [
+            ("/src/agtmux".to_string(), meta("/src/agtmux", "main")),
+            (
+                "/src/agtmux/crates".to_string(),
+                meta("/src/agtmux", "feat"),
+            ),
+            ("/src/other".to_string(), meta("/src/other", "main")),
+            ("/tmp".to_string(), None),
+        ]
+        .into_iter()
+        .collect();
+
+        let panes = build_pane_list(&state);
+        assert_eq!(panes[1]["git_repo"], "/src/agtmux");
+        assert_eq!(panes[1]["git_branch"], "feat");
+        assert!(panes[3]["git_repo"].is_null());
+        assert!(panes[3]["git_branch"].is_null());
+
+        let ids = |v: serde_json::Value| -> Vec<String> {
+            v.as_array()
+                .expect("array")
+                .iter()
+                .map(|p| p["pane_id"].as_str().expect("id").to_string())
+                .collect()
+        };
+        assert_eq!(
+            ids(filter_pane_list(panes.clone(), Some("agtmux"), None)),
+            ["%1", "%2"]
+        );
+        assert_eq!(
+            ids(filter_pane_list(panes.clone(), None, Some("main"))),
+            ["%1", "%3"]
+        );
+        assert_eq!(
+            ids(filter_pane_list(
+                panes.clone(),
+                Some("/src/agtmux"),
+                Some("feat")
+            )),
+            ["%2"]
+        );
+        assert_eq!(ids(filter_pane_list(panes, None, None)).len(), 4);
+    }
+
     #[test]
     fn build_pane_list_includes_window_session_path_for_managed() {
         use agtmux_core_v5::types::SourceKind;
@@ -1485,4 +2750,886 @@ mod tests {
             "conversation_title should be null when absent"
         );
     }
+
+    // ── label.* ─────────────────────────────────────────────────────────
+
+    #[tokio::test]
+    async fn label_set_list_clear_roundtrip() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        let state = Arc::new(Mutex::new(st));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.set", "id": 1,
+                "params": {"pane_id": "%4", "label": "  fix flaky tests "}}),
+        )
+        .await;
+        assert_eq!(resp["result"]["label"], "fix flaky tests");
+
+        let panes = build_pane_list(&*state.lock().await);
+        assert_eq!(
+            panes[0]["label"], "fix flaky tests",
+            "label surfaced in list_panes"
+        );
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.list", "id": 2}),
+        )
+        .await;
+        assert_eq!(
+            resp["result"],
+            serde_json::json!([{"pane_id": "%4", "label": "fix flaky tests"}])
+        );
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.clear", "id": 3,
+                "params": {"pane_id": "%4"}}),
+        )
+        .await;
+        assert_eq!(resp["result"]["cleared"], true);
+        assert!(state.lock().await.pane_labels.is_empty());
+    }
+
+    #[tokio::test]
+    async fn label_set_rejects_unknown_pane_and_empty_label() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        let state = Arc::new(Mutex::new(st));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.set", "id": 1,
+                "params": {"pane_id": "%99", "label": "x"}}),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.set", "id": 2,
+                "params": {"pane_id": "%4", "label": "   "}}),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], -32602);
+        assert!(state.lock().await.pane_labels.is_empty());
+    }
+
+    #[tokio::test]
+    async fn task_set_list_clear_roundtrip() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        let state = Arc::new(Mutex::new(st));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "task.set", "id": 1,
+                "params": {"pane_id": "%4", "url": "jira.local/T-1"}}),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "task.set", "id": 2,
+                "params": {"pane_id": "%4", "title": "Fix login", "owner": "kim",
+                    "tags": ["auth"]}}),
+        )
+        .await;
+        let task = serde_json::json!({"title": "Fix login", "owner": "kim", "tags": ["auth"]});
+        assert_eq!(resp["result"]["task"], task);
+        assert_eq!(build_pane_list(&*state.lock().await)[0]["task"], task);
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "task.list", "id": 3}),
+        )
+        .await;
+        assert_eq!(
+            resp["result"],
+            serde_json::json!([{"pane_id": "%4", "task": task}])
+        );
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "task.clear", "id": 4,
+                "params": {"pane_id": "%4"}}),
+        )
+        .await;
+        assert_eq!(resp["result"]["cleared"], true);
+        assert!(state.lock().await.pane_tasks.is_empty());
+    }
+
+    #[tokio::test]
+    async fn alerts_list_empty_and_ack_unknown() {
+        let state = Arc::new(Mutex::new(make_state()));
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "alerts.list", "id": 1}),
+        )
+        .await;
+        assert_eq!(resp["result"], serde_json::json!([]));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "alerts.ack", "id": 2,
+                "params": {"id": 7}}),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::ALERT_NOT_FOUND);
+        assert_eq!(resp["error"]["message"], "unknown alert: 7");
+    }
+
+    // ── pane actions ────────────────────────────────────────────────────
+
+    /// Records tmux invocations and answers `-P` commands with a new pane id.
+    struct RecordingTmux(std::sync::Mutex<Vec<String>>);
+
+    impl agtmux_tmux_v5::TmuxCommandRunner for RecordingTmux {
+        fn run(&self, args: &[&str]) -> Result<String, agtmux_tmux_v5::error::TmuxError> {
+            self.0.lock().expect("lock").push(args.join(" "));
+            Ok(if args.contains(&"-P") {
+                "%9 work:1.1\n"
+            } else {
+                ""
+            }
+            .to_string())
+        }
+    }
+
+    /// Canned `capture-pane` output per pane; `%6` fails.
+    struct OutputTmux;
+
+    impl agtmux_tmux_v5::TmuxCommandRunner for OutputTmux {
+        fn run(&self, args: &[&str]) -> Result<String, agtmux_tmux_v5::error::TmuxError> {
+            match args.last() {
+                Some(&"%5") => Ok("cargo test\nerror: boom\nERROR again\n".to_string()),
+                Some(&"%6") => Err(agtmux_tmux_v5::error::TmuxError::CommandFailed(
+                    "can't find pane".to_string(),
+                )),
+                _ => Ok("all good\n".to_string()),
+            }
+        }
+    }
+
+    #[tokio::test]
+    async fn search_greps_pane_output() {
+        let mut st = make_state();
+        st.last_panes = ["%4", "%5", "%6"]
+            .iter()
+            .map(|id| tmux_pane(id, "work", "zsh"))
+            .collect();
+        st.tmux = Some(Arc::new(OutputTmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        let state = Arc::new(Mutex::new(st));
+        let search = |params: serde_json::Value| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "pane.search", "id": 1,
+                "params": params})
+        };
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            search(serde_json::json!({"q": "error"})),
+        )
+        .await;
+        let result = &resp["result"];
+        assert_eq!(result["searched"], 3);
+        assert_eq!(result["panes"].as_array().map(Vec::len), Some(1));
+        assert_eq!(result["panes"][0]["pane_id"], "%5");
+        assert_eq!(
+            result["panes"][0]["matches"],
+            serde_json::json!([{"line": 2, "text": "error: boom"}])
+        );
+        assert!(result["failed"]["%6"].is_string());
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            search(serde_json::json!({"q": "error", "ignore_case": true, "pane_ids": ["%5"]})),
+        )
+        .await;
+        assert_eq!(resp["result"]["searched"], 1);
+        assert_eq!(resp["result"]["panes"][0]["total"], 2);
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            search(serde_json::json!({"q": "x", "pane_ids": ["%404"]})),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        let resp = call_handler(state, search(serde_json::json!({"q": ""}))).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    #[tokio::test]
+    async fn output_returns_lines_since_a_cursor() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%5", "work", "zsh")];
+        st.tmux = Some(Arc::new(OutputTmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        let state = Arc::new(Mutex::new(st));
+        let output = |params: serde_json::Value| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "pane.output", "id": 1,
+                "params": params})
+        };
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            output(serde_json::json!({"pane_id": "%5", "lines": 10})),
+        )
+        .await;
+        let result = &resp["result"];
+        assert_eq!(
+            result["lines"],
+            serde_json::json!(["cargo test", "error: boom", "ERROR again"])
+        );
+        assert_eq!(result["full"], true);
+        let since = result["cursor"].clone();
+        let resp = call_handler(
+            Arc::clone(&state),
+            output(serde_json::json!({"pane_id": "%5", "since": since})),
+        )
+        .await;
+        assert_eq!(resp["result"]["lines"], serde_json::json!([]));
+        assert_eq!(resp["result"]["full"], false);
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            output(serde_json::json!({"pane_id": "%404"})),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        let resp = call_handler(state, output(serde_json::json!({}))).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    #[tokio::test]
+    async fn output_and_search_mask_redacted_text() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%5", "work", "zsh")];
+        st.tmux = Some(Arc::new(OutputTmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        st.redactor = crate::redact::Redactor::new(&crate::redact::RedactSettings {
+            patterns: vec!["boom".to_string()],
+            ..Default::default()
+        });
+        let state = Arc::new(Mutex::new(st));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "pane.output", "id": 1,
+                "params": {"pane_id": "%5"}}),
+        )
+        .await;
+        assert_eq!(resp["result"]["lines"][1], "error: [redacted]");
+        let resp = call_handler(
+            state,
+            serde_json::json!({"jsonrpc": "2.0", "method": "pane.search", "id": 2,
+                "params": {"q": "boom"}}),
+        )
+        .await;
+        assert_eq!(
+            resp["result"]["panes"],
+            serde_json::json!([]),
+            "masked text is not searchable"
+        );
+    }
+
+    #[tokio::test]
+    async fn recorder_rounds_are_listed_and_replayed() {
+        let dir = std::env::temp_dir().join(format!("agtmux-recordings-{}", std::process::id()));
+        let _ = std::fs::remove_dir_all(&dir);
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%5", "work", "zsh")];
+        st.generation_tracker.update(&["%5"], Utc::now());
+        st.tmux = Some(Arc::new(OutputTmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        st.recorder = recorder::Recorder::new(recorder::RecorderSettings {
+            enabled: true,
+            dir: Some(dir.clone()),
+            all_panes: true,
+            ..Default::default()
+        });
+        let state = Arc::new(Mutex::new(st));
+        let call = |method: &str, params: serde_json::Value| serde_json::json!({"jsonrpc": "2.0", "method": method, "id": 1, "params": params});
+
+        {
+            let mut st = state.lock().await;
+            let panes = cached_pane_list(&mut st);
+            recorder::tick(&state, &mut st, &panes, std::time::Instant::now());
+        }
+        let mut listed = serde_json::Value::Null;
+        for _ in 0..100 {
+            let resp = call_handler(
+                Arc::clone(&state),
+                call("recording.list", serde_json::json!({})),
+            )
+            .await;
+            listed = resp["result"].clone();
+            if listed.as_array().is_some_and(|l| !l.is_empty()) {
+                break;
+            }
+            tokio::time::sleep(std::time::Duration::from_millis(10)).await;
+        }
+        assert_eq!(listed[0]["pane_id"], "%5");
+        assert_eq!(listed[0]["session_name"], "work");
+
+        // meta.json is written before the first record: wait for that too.
+        let runtime = listed[0]["runtime"].clone();
+        let mut replayed = serde_json::Value::Null;
+        for _ in 0..100 {
+            let resp = call_handler(
+                Arc::clone(&state),
+                call("recording.replay", serde_json::json!({"runtime": runtime})),
+            )
+            .await;
+            replayed = resp["result"].clone();
+            if replayed["records"]
+                .as_array()
+                .is_some_and(|r| !r.is_empty())
+            {
+                break;
+            }
+            tokio::time::sleep(std::time::Duration::from_millis(10)).await;
+        }
+        assert_eq!(
+            replayed["records"][0]["lines"],
+            serde_json::json!(["cargo test", "error: boom", "ERROR again"])
+        );
+        state.lock().await.redactor =
+            crate::redact::Redactor::new(&crate::redact::RedactSettings {
+                patterns: vec!["(?i)error".to_string()],
+                ..Default::default()
+            });
+        let resp = call_handler(
+            Arc::clone(&state),
+            call("recording.replay", serde_json::json!({"runtime": runtime})),
+        )
+        .await;
+        assert_eq!(
+            resp["result"]["records"][0]["lines"],
+            serde_json::json!(["cargo test", "[redacted]: boom", "[redacted] again"]),
+            "masked on replay"
+        );
+        let resp = call_handler(
+            Arc::clone(&state),
+            call(
+                "recording.replay",
+                serde_json::json!({"runtime": runtime, "since": "soon"}),
+            ),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+        let resp = call_handler(
+            state,
+            call("recording.replay", serde_json::json!({"runtime": "../etc"})),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+
+    #[tokio::test]
+    async fn pane_actions_run_tmux_and_replay_request_ref() {
+        let tmux = Arc::new(RecordingTmux(std::sync::Mutex::new(Vec::new())));
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        st.tmux = Some(Arc::clone(&tmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        let state = Arc::new(Mutex::new(st));
+
+        let split = serde_json::json!({"jsonrpc": "2.0", "method": "pane.split", "id": 1,
+            "params": {"pane_id": "%4", "command": "codex", "request_ref": "r-1"}});
+        let resp = call_handler(Arc::clone(&state), split.clone()).await;
+        assert_eq!(
+            resp["result"],
+            serde_json::json!({"action": "pane.split", "pane_id": "%9",
+                "address": "work:1.1", "request_ref": "r-1", "replayed": false})
+        );
+        let resp = call_handler(Arc::clone(&state), split).await;
+        assert_eq!(resp["result"]["replayed"], true);
+        assert_eq!(resp["result"]["pane_id"], "%9");
+        assert_eq!(
+            *tmux.0.lock().expect("lock"),
+            [
+                "split-window -d -P -F #{pane_id} #{session_name}:#{window_index}.#{pane_index} -v -t %4 codex"
+            ],
+            "replay does not run tmux again"
+        );
+
+        let reused = serde_json::json!({"jsonrpc": "2.0", "method": "pane.kill", "id": 2,
+            "params": {"pane_id": "%4", "request_ref": "r-1"}});
+        let resp = call_handler(Arc::clone(&state), reused).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+
+        let unknown = serde_json::json!({"jsonrpc": "2.0", "method": "pane.respawn", "id": 3,
+            "params": {"pane_id": "%77"}});
+        let resp = call_handler(Arc::clone(&state), unknown).await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        assert_eq!(tmux.0.lock().expect("lock").len(), 1);
+
+        let run = serde_json::json!({"jsonrpc": "2.0", "method": "pane.run", "id": 4,
+            "params": {"agent": "codex", "prompt": "add tests", "session": "work"}});
+        let resp = call_handler(Arc::clone(&state), run).await;
+        assert_eq!(resp["result"]["pane_id"], "%9");
+        assert_eq!(resp["result"]["agent"], "codex");
+        let st = state.lock().await;
+        assert_eq!(
+            st.launches.get("%9").map(|l| l.agent.as_str()),
+            Some("codex"),
+            "registered before the poller sees the pane"
+        );
+    }
+
+    #[tokio::test]
+    async fn macro_run_sends_steps_in_order() {
+        let tmux = Arc::new(RecordingTmux(std::sync::Mutex::new(Vec::new())));
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        st.tmux = Some(Arc::clone(&tmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        st.macros = toml::from_str::<crate::daemon_config::DaemonFileConfig>(
+            r#"
+            [[macros]]
+            name = "go"
+            steps = [{ key = "y" }, { send = "run {target}" }, { output = 5 }]
+            [[macros]]
+            name = "stuck"
+            steps = [{ wait = "Idle", timeout_secs = 0 }, { key = "y" }]
+            "#,
+        )
+        .expect("valid")
+        .macros;
+        let state = Arc::new(Mutex::new(st));
+
+        let list = serde_json::json!({"jsonrpc": "2.0", "method": "macro.list", "id": 1});
+        let resp = call_handler(Arc::clone(&state), list).await;
+        assert_eq!(resp["result"][0]["params"], serde_json::json!(["target"]));
+
+        let missing = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 2,
+            "params": {"name": "go", "pane_id": "%4"}});
+        let resp = call_handler(Arc::clone(&state), missing).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+        assert!(tmux.0.lock().expect("lock").is_empty(), "nothing sent");
+
+        let run = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 3,
+            "params": {"name": "go", "pane_id": "%4", "params": {"target": "lint"},
+                "request_ref": "m-1"}});
+        let resp = call_handler(Arc::clone(&state), run.clone()).await;
+        assert_eq!(resp["result"]["steps"], 3);
+        assert_eq!(resp["result"]["replayed"], false);
+        let kinds: Vec<&str> = resp["result"]["results"]
+            .as_array()
+            .expect("results")
+            .iter()
+            .filter_map(|r| r["kind"].as_str())
+            .collect();
+        assert_eq!(kinds, ["key", "send", "output"]);
+        assert_eq!(
+            *tmux.0.lock().expect("lock"),
+            [
+                "send-keys -t %4 y",
+                "send-keys -t %4 -l run lint ; send-keys -t %4 Enter",
+                "capture-pane -p -S -5 -t %4",
+            ]
+        );
+        let resp = call_handler(Arc::clone(&state), run).await;
+        assert_eq!(resp["result"]["replayed"], true);
+        assert_eq!(tmux.0.lock().expect("lock").len(), 3);
+
+        let stuck = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 4,
+            "params": {"name": "stuck", "pane_id": "%4"}});
+        let resp = call_handler(Arc::clone(&state), stuck).await;
+        assert_eq!(resp["error"]["code"], codes::ACTION_FAILED);
+        assert!(
+            resp["error"]["message"]
+                .as_str()
+                .is_some_and(|m| m.contains("step 0") && m.contains("from_step 0")),
+            "{resp}"
+        );
+        assert_eq!(tmux.0.lock().expect("lock").len(), 3, "later steps skipped");
+
+        let resume = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 5,
+            "params": {"name": "stuck", "pane_id": "%4", "from_step": 1}});
+        let resp = call_handler(Arc::clone(&state), resume).await;
+        assert_eq!(resp["result"]["from_step"], 1);
+        assert_eq!(resp["result"]["results"][0]["step"], 1);
+        assert_eq!(tmux.0.lock().expect("lock")[3], "send-keys -t %4 y");
+        let past_end = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 6,
+            "params": {"name": "stuck", "pane_id": "%4", "from_step": 2}});
+        let resp = call_handler(Arc::clone(&state), past_end).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+
+        let inline = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 7,
+            "params": {"pane_id": "%4", "steps": [{"key": "Escape"}, {"send": "hi {who}"}],
+                "params": {"who": "there"}}});
+        let resp = call_handler(Arc::clone(&state), inline).await;
+        assert_eq!(resp["result"]["name"], "inline");
+        assert_eq!(
+            tmux.0.lock().expect("lock")[4..],
+            [
+                "send-keys -t %4 Escape",
+                "send-keys -t %4 -l hi there ; send-keys -t %4 Enter",
+            ]
+        );
+        let bad = serde_json::json!({"jsonrpc": "2.0", "method": "macro.run", "id": 8,
+            "params": {"pane_id": "%4", "steps": [{"wait": "Idle", "key": "y"}]}});
+        let resp = call_handler(Arc::clone(&state), bad).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    #[tokio::test]
+    async fn transcript_needs_a_detected_agent() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        let state = Arc::new(Mutex::new(st));
+
+        let unknown = serde_json::json!({"jsonrpc": "2.0", "method": "pane.transcript", "id": 1,
+            "params": {"pane_id": "%77"}});
+        let resp = call_handler(Arc::clone(&state), unknown).await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        let shell = serde_json::json!({"jsonrpc": "2.0", "method": "pane.transcript", "id": 2,
+            "params": {"pane_id": "%4"}});
+        let resp = call_handler(Arc::clone(&state), shell).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+        let relative = serde_json::json!({"jsonrpc": "2.0", "method": "pane.transcript", "id": 3,
+            "params": {"pane_id": "%4", "archive_dir": "out"}});
+        let resp = call_handler(Arc::clone(&state), relative).await;
+        assert_eq!(
+            resp["error"]["message"],
+            "archive_dir must be an absolute path"
+        );
+    }
+
+    #[tokio::test]
+    async fn group_actions_reach_every_member() {
+        let tmux = Arc::new(RecordingTmux(std::sync::Mutex::new(Vec::new())));
+        let mut st = make_state();
+        st.last_panes = vec![
+            tmux_pane("%4", "work", "zsh"),
+            tmux_pane("%5", "play", "zsh"),
+        ];
+        st.tmux = Some(Arc::clone(&tmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        let state = Arc::new(Mutex::new(st));
+
+        let unknown = serde_json::json!({"jsonrpc": "2.0", "method": "group.add", "id": 1,
+            "params": {"group": "api", "pane_ids": ["%4", "%77"]}});
+        let resp = call_handler(Arc::clone(&state), unknown).await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+
+        let add = serde_json::json!({"jsonrpc": "2.0", "method": "group.add", "id": 2,
+            "params": {"group": "api", "pane_ids": ["%5", "%4"]}});
+        let resp = call_handler(Arc::clone(&state), add).await;
+        assert_eq!(resp["result"]["panes"], serde_json::json!(["%4", "%5"]));
+
+        let list = serde_json::json!({"jsonrpc": "2.0", "method": "group.list", "id": 3});
+        let resp = call_handler(Arc::clone(&state), list).await;
+        assert_eq!(
+            resp["result"][0]["sessions"],
+            serde_json::json!(["play", "work"])
+        );
+        assert_eq!(resp["result"][0]["summary"]["total"], 2);
+        let panes = serde_json::json!({"jsonrpc": "2.0", "method": "list_panes", "id": 4});
+        let resp = call_handler(Arc::clone(&state), panes).await;
+        assert_eq!(resp["result"][0]["groups"], serde_json::json!(["api"]));
+
+        let send = serde_json::json!({"jsonrpc": "2.0", "method": "group.send", "id": 5,
+            "params": {"group": "api", "text": "git pull", "request_ref": "g-1"}});
+        let resp = call_handler(Arc::clone(&state), send.clone()).await;
+        assert_eq!(resp["result"]["panes"], serde_json::json!(["%4", "%5"]));
+        let resp = call_handler(Arc::clone(&state), send).await;
+        assert_eq!(resp["result"]["replayed"], true);
+        let kill = serde_json::json!({"jsonrpc": "2.0", "method": "group.kill", "id": 6,
+            "params": {"group": "api"}});
+        call_handler(Arc::clone(&state), kill).await;
+        assert_eq!(
+            *tmux.0.lock().expect("lock"),
+            [
+                "send-keys -t %4 -l git pull ; send-keys -t %4 Enter",
+                "send-keys -t %5 -l git pull ; send-keys -t %5 Enter",
+                "kill-pane -t %4",
+                "kill-pane -t %5",
+            ]
+        );
+
+        let remove = serde_json::json!({"jsonrpc": "2.0", "method": "group.remove", "id": 7,
+            "params": {"group": "api"}});
+        let resp = call_handler(Arc::clone(&state), remove.clone()).await;
+        assert_eq!(resp["result"]["panes"], serde_json::Value::Null);
+        let resp = call_handler(Arc::clone(&state), remove).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    #[tokio::test]
+    async fn batch_send_reaches_listed_or_matching_panes() {
+        let tmux = Arc::new(RecordingTmux(std::sync::Mutex::new(Vec::new())));
+        let mut st = make_managed_state();
+        st.last_panes.push(tmux_pane("%1", "main", "zsh"));
+        st.tmux = Some(Arc::clone(&tmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        let state = Arc::new(Mutex::new(st));
+        let send = |id: u64, params: serde_json::Value| serde_json::json!({"jsonrpc": "2.0", "method": "pane.send", "id": id, "params": params});
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(
+                1,
+                serde_json::json!({"pane_ids": ["%1", "%77"], "text": "go"}),
+            ),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(2, serde_json::json!({"agent": "codex", "text": "go"})),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+        assert!(tmux.0.lock().expect("lock").is_empty(), "nothing sent");
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(
+                3,
+                serde_json::json!({"session": "main", "agent": "claude",
+                "text": "run the tests", "request_ref": "b-1"}),
+            ),
+        )
+        .await;
+        assert_eq!(
+            resp["result"],
+            serde_json::json!({"action": "pane.send", "panes": ["%0"], "failed": {},
+                "request_ref": "b-1", "replayed": false})
+        );
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(
+                4,
+                serde_json::json!({"pane_ids": ["%1", "%0"], "key": "C-c"}),
+            ),
+        )
+        .await;
+        assert_eq!(resp["result"]["panes"], serde_json::json!(["%0", "%1"]));
+        assert_eq!(
+            *tmux.0.lock().expect("lock"),
+            [
+                "send-keys -t %0 -l run the tests ; send-keys -t %0 Enter",
+                "send-keys -t %0 C-c",
+                "send-keys -t %1 C-c",
+            ]
+        );
+    }
+
+    #[tokio::test]
+    async fn send_policy_refuses_input_and_shell_panes() {
+        let tmux = Arc::new(RecordingTmux(std::sync::Mutex::new(Vec::new())));
+        let mut st = make_managed_state();
+        st.last_panes.push(tmux_pane("%1", "main", "zsh"));
+        st.tmux = Some(Arc::clone(&tmux) as Arc<dyn agtmux_tmux_v5::TmuxCommandRunner>);
+        st.send_policy = crate::send_policy::SendPolicy::new(
+            &toml::from_str("deny = ['rm\\s+-rf']\nagent_panes_only = true").expect("valid"),
+        );
+        let state = Arc::new(Mutex::new(st));
+        let send = |id: u64, params: serde_json::Value| serde_json::json!({"jsonrpc": "2.0", "method": "pane.send", "id": id, "params": params});
+
+        for (id, params) in [
+            (
+                1,
+                serde_json::json!({"pane_ids": ["%0"], "text": "rm -rf /"}),
+            ),
+            (
+                2,
+                serde_json::json!({"pane_ids": ["%0", "%1"], "text": "go"}),
+            ),
+            (
+                3,
+                serde_json::json!({"pane_ids": ["%0"], "text": "rm -rf /", "after": "10m"}),
+            ),
+        ] {
+            let resp = call_handler(Arc::clone(&state), send(id, params)).await;
+            assert_eq!(resp["error"]["code"], codes::POLICY_VIOLATION, "{resp}");
+        }
+        assert!(tmux.0.lock().expect("lock").is_empty(), "nothing sent");
+        assert!(state.lock().await.scheduler.list().is_empty(), "not parked");
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            send(4, serde_json::json!({"pane_ids": ["%0"], "text": "go"})),
+        )
+        .await;
+        assert_eq!(resp["result"]["panes"], serde_json::json!(["%0"]));
+    }
+
+    #[tokio::test]
+    async fn pane_selectors_resolve_before_dispatch() {
+        let state = Arc::new(Mutex::new(make_managed_state()));
+        let label = |id: u64, pane: &str| {
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.set", "id": id,
+                "params": {"pane_id": pane, "label": "api"}})
+        };
+
+        let resp = call_handler(Arc::clone(&state), label(1, "session=main agent=claude")).await;
+        assert_eq!(resp["result"]["pane_id"], "%0");
+        let resp = call_handler(Arc::clone(&state), label(2, "latest:codex")).await;
+        assert_eq!(resp["error"]["code"], codes::PANE_NOT_FOUND);
+        let resp = call_handler(Arc::clone(&state), label(3, "host=a")).await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    #[tokio::test]
+    async fn list_panes_cached_until_invalidated() {
+        let mut st = make_state();
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        let state = Arc::new(Mutex::new(st));
+        let list = serde_json::json!({"jsonrpc": "2.0", "method": "list_panes", "id": 1});
+
+        let resp = call_handler(Arc::clone(&state), list.clone()).await;
+        assert_eq!(resp["result"].as_array().map(Vec::len), Some(1));
+
+        // Without invalidation the cached list is served.
+        state
+            .lock()
+            .await
+            .last_panes
+            .push(tmux_pane("%5", "work", "zsh"));
+        let resp = call_handler(Arc::clone(&state), list.clone()).await;
+        assert_eq!(resp["result"].as_array().map(Vec::len), Some(1));
+        {
+            // Shared, not rebuilt or copied.
+            let mut st = state.lock().await;
+            let first = cached_pane_list(&mut st);
+            assert!(Arc::ptr_eq(&first, &cached_pane_list(&mut st)));
+        }
+
+        // A write (label.set) invalidates it.
+        call_handler(
+            Arc::clone(&state),
+            serde_json::json!({"jsonrpc": "2.0", "method": "label.set", "id": 2,
+                "params": {"pane_id": "%4", "label": "api"}}),
+        )
+        .await;
+        let resp = call_handler(Arc::clone(&state), list).await;
+        let panes = resp["result"].as_array().expect("array");
+        assert_eq!(panes.len(), 2);
+        assert_eq!(panes[0]["label"], "api");
+    }
+
+    #[tokio::test]
+    async fn list_panes_since_cursor_returns_changes() {
+        let mut st = make_state();
+        st.last_panes = vec![
+            tmux_pane("%4", "work", "zsh"),
+            tmux_pane("%5", "work", "zsh"),
+        ];
+        let state = Arc::new(Mutex::new(st));
+        let list = |id: u64, params: serde_json::Value| serde_json::json!({"jsonrpc": "2.0", "method": "list_panes", "id": id, "params": params});
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            list(1, serde_json::json!({"since_cursor": 0})),
+        )
+        .await;
+        let first = &resp["result"];
+        assert_eq!(first["full"], false, "cursor 0 resumes from the empty list");
+        assert_eq!(first["panes"].as_array().map(Vec::len), Some(2));
+        let cursor = first["cursor"].as_u64().expect("cursor");
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            list(2, serde_json::json!({"since_cursor": cursor})),
+        )
+        .await;
+        assert_eq!(
+            resp["result"],
+            serde_json::json!({"cursor": cursor, "full": false, "panes": [], "removed": []}),
+            "nothing changed"
+        );
+
+        {
+            let mut st = state.lock().await;
+            st.last_panes.remove(1);
+            st.last_panes.push(tmux_pane("%6", "ops", "zsh"));
+            st.pane_labels.insert("%4".to_string(), "api".to_string());
+            st.invalidate_pane_list();
+        }
+        let resp = call_handler(
+            Arc::clone(&state),
+            list(3, serde_json::json!({"since_cursor": cursor})),
+        )
+        .await;
+        let delta = &resp["result"];
+        assert_eq!(delta["full"], false);
+        let changed: Vec<&str> = delta["panes"]
+            .as_array()
+            .expect("panes")
+            .iter()
+            .filter_map(|p| p["pane_id"].as_str())
+            .collect();
+        assert_eq!(changed, ["%4", "%6"]);
+        assert_eq!(delta["panes"][0]["label"], "api");
+        assert_eq!(delta["removed"], serde_json::json!(["%5"]));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            list(4, serde_json::json!({"since_cursor": 999})),
+        )
+        .await;
+        assert_eq!(resp["result"]["full"], true, "cursor from another daemon");
+        assert_eq!(resp["result"]["panes"].as_array().map(Vec::len), Some(2));
+
+        let resp = call_handler(
+            Arc::clone(&state),
+            list(
+                5,
+                serde_json::json!({"since_cursor": cursor, "sort": "title"}),
+            ),
+        )
+        .await;
+        assert_eq!(resp["error"]["code"], codes::INVALID_PARAMS);
+    }
+
+    // ── daemon.capabilities / feature flags ─────────────────────────────
+
+    #[tokio::test]
+    async fn capabilities_lists_methods_and_features() {
+        let state = Arc::new(Mutex::new(make_state()));
+        let resp = call_handler(
+            state,
+            serde_json::json!({"jsonrpc": "2.0", "method": "daemon.capabilities", "id": 1}),
+        )
+        .await;
+        let result = &resp["result"];
+        let methods = result["methods"].as_array().expect("methods");
+        assert!(methods.iter().any(|m| m == "daemon.capabilities"));
+        let features = result["features"].as_array().expect("features");
+        assert_eq!(features.len(), features::REGISTRY.len());
+    }
+
+    #[tokio::test]
+    async fn strict_admission_rejects_unregistered_source() {
+        let request = serde_json::json!({"jsonrpc": "2.0", "method": "source.ingest", "id": 1,
+            "params": {"source_kind": "claude_hooks", "source_id": "rogue", "event": {}}});
+
+        let mut st = make_state();
+        let section = [(features::STRICT_ADMISSION.to_string(), true)].into();
+        st.features = features::Features::resolve(&section).expect("known feature");
+        let resp = call_handler(Arc::new(Mutex::new(st)), request.clone()).await;
+        assert_eq!(resp["error"]["code"], codes::ADMISSION_REJECTED);
+
+        // Default (warn-only): passes the gate and fails later on the empty event.
+        let resp = call_handler(Arc::new(Mutex::new(make_state())), request).await;
+        assert_eq!(resp["error"]["code"], -32602);
+    }
+
+    #[tokio::test]
+    async fn debug_metrics_gated_by_feature() {
+        let request = serde_json::json!({"jsonrpc": "2.0", "method": "debug.metrics", "id": 1});
+        let resp = call_handler(Arc::new(Mutex::new(make_state())), request.clone()).await;
+        assert_eq!(resp["error"]["code"], codes::METHOD_NOT_FOUND);
+
+        let mut st = make_state();
+        let section = [(features::DEBUG_METRICS.to_string(), true)].into();
+        st.features = features::Features::resolve(&section).expect("known feature");
+        st.last_panes = vec![tmux_pane("%4", "work", "zsh")];
+        let resp = call_handler(Arc::new(Mutex::new(st)), request).await;
+        let metrics = &resp["result"];
+        assert_eq!(metrics["process"]["pid"], std::process::id());
+        assert!(metrics["tokio"]["workers"].as_u64().expect("workers") >= 1);
+        assert_eq!(metrics["state"]["tmux_panes"], 1);
+        assert_eq!(metrics["exec_pool"]["queued"], 0);
+    }
 }
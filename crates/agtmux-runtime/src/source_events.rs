@@ -0,0 +1,219 @@
+//! Ingested source events for `watch` with `source_events`: every event the
+//! poll tick pulls from the gateway (hooks, App Server, JSONL, poller) is
+//! numbered by a monotonic sequence id and kept for resuming clients, so
+//! automation can react to e.g. `task_completed` without polling panes.
+//!
+//! Heartbeat re-emissions are not recorded. Only the last `MAX_EVENTS`
+//! events are kept; a client further behind (or holding a sequence id from
+//! a previous daemon) resumes from the oldest kept event with `gap` set.
+
+use std::collections::VecDeque;
+
+use agtmux_core_v5::types::SourceEventV2;
+use serde_json::Value;
+
+/// Events retained for resuming clients.
+const MAX_EVENTS: usize = 4096;
+
+/// Which events a subscriber wants; unset criteria match everything.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct EventFilter {
+    pub pane_id: Option<String>,
+    /// `claude_hooks`, `codex_appserver`, `claude_jsonl`, `poller`.
+    pub source_kinds: Vec<String>,
+    /// Exact types, or prefixes ending in `*` (`lifecycle.*`).
+    pub event_types: Vec<String>,
+    pub provider: Option<String>,
+}
+
+impl EventFilter {
+    /// From `watch` params `pane_id`, `source_kind`, `event_type` (string or
+    /// list each) and `provider`.
+    pub fn from_params(params: &Value) -> Self {
+        let list = |key: &str| -> Vec<String> {
+            match &params[key] {
+                Value::String(s) => vec![s.clone()],
+                Value::Array(items) => items
+                    .iter()
+                    .filter_map(Value::as_str)
+                    .map(String::from)
+                    .collect(),
+                _ => Vec::new(),
+            }
+        };
+        Self {
+            pane_id: params["pane_id"].as_str().map(String::from),
+            source_kinds: list("source_kind"),
+            event_types: list("event_type"),
+            provider: params["provider"].as_str().map(String::from),
+        }
+    }
+
+    fn matches(&self, event: &Value) -> bool {
+        let field = |key: &str| event[key].as_str().unwrap_or("");
+        self.pane_id
+            .as_deref()
+            .is_none_or(|p| field("pane_id") == p)
+            && self
+                .provider
+                .as_deref()
+                .is_none_or(|p| field("provider") == p)
+            && (self.source_kinds.is_empty()
+                || self.source_kinds.iter().any(|k| field("source_kind") == k))
+            && (self.event_types.is_empty()
+                || self.event_types.iter().any(|t| match t.strip_suffix('*') {
+                    Some(prefix) => field("event_type").starts_with(prefix),
+                    None => field("event_type") == t,
+                }))
+    }
+}
+
+/// Events after a cursor, as served in one frame.
+#[derive(Debug, Clone, PartialEq)]
+pub struct EventBatch {
+    /// Sequence id of the newest event seen (matching or not); the next
+    /// cursor.
+    pub cursor: u64,
+    pub events: Vec<Value>,
+    /// Events between the requested cursor and the first one served were
+    /// dropped (or the cursor came from a previous daemon).
+    pub gap: bool,
+}
+
+#[derive(Debug, Default)]
+pub struct SourceEventLog {
+    seq: u64,
+    events: VecDeque<Value>,
+}
+
+impl SourceEventLog {
+    /// Sequence id of the latest event (0 before any).
+    pub fn cursor(&self) -> u64 {
+        self.seq
+    }
+
+    /// Record the non-heartbeat events of one gateway pull.
+    pub fn record(&mut self, events: &[SourceEventV2]) {
+        for event in events.iter().filter(|e| !e.is_heartbeat) {
+            self.seq += 1;
+            if self.events.len() == MAX_EVENTS {
+                self.events.pop_front();
+            }
+            self.events.push_back(serde_json::json!({
+                "seq": self.seq,
+                "event_id": event.event_id,
+                "event_type": event.event_type,
+                "source_kind": event.source_kind.as_str(),
+                "provider": event.provider.as_str(),
+                "pane_id": event.pane_id,
+                "session_key": event.session_key,
+                "observed_at": event.observed_at,
+                "payload": event.payload,
+            }));
+        }
+    }
+
+    /// Matching events after `cursor`.
+    pub fn since(&self, cursor: u64, filter: &EventFilter) -> EventBatch {
+        let oldest = self.events.front().map_or(self.seq + 1, seq_of);
+        let restarted = cursor > self.seq;
+        let cursor = if restarted { 0 } else { cursor };
+        let gap = restarted || cursor + 1 < oldest;
+        EventBatch {
+            cursor: self.seq,
+            events: self
+                .events
+                .iter()
+                .filter(|e| seq_of(e) > cursor && filter.matches(e))
+                .cloned()
+                .collect(),
+            gap,
+        }
+    }
+}
+
+fn seq_of(event: &Value) -> u64 {
+    event["seq"].as_u64().unwrap_or(0)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use agtmux_core_v5::types::{EvidenceTier, Provider, SourceKind};
+
+    fn event(event_type: &str, pane_id: &str, heartbeat: bool) -> SourceEventV2 {
+        SourceEventV2 {
+            event_id: format!("e-{event_type}-{pane_id}"),
+            provider: Provider::Claude,
+            source_kind: SourceKind::ClaudeHooks,
+            tier: EvidenceTier::Deterministic,
+            observed_at: chrono::Utc::now(),
+            session_key: "s".to_string(),
+            pane_id: Some(pane_id.to_string()),
+            pane_generation: None,
+            pane_birth_ts: None,
+            source_event_id: None,
+            event_type: event_type.to_string(),
+            payload: serde_json::json!({}),
+            confidence: 1.0,
+            is_heartbeat: heartbeat,
+        }
+    }
+
+    fn types(batch: &EventBatch) -> Vec<&str> {
+        batch
+            .events
+            .iter()
+            .map(|e| e["event_type"].as_str().expect("type"))
+            .collect()
+    }
+
+    #[test]
+    fn records_and_filters_events() {
+        let mut log = SourceEventLog::default();
+        log.record(&[
+            event("lifecycle.running", "%1", false),
+            event("lifecycle.running", "%1", true),
+            event("task_completed", "%2", false),
+            event("lifecycle.idle", "%2", false),
+        ]);
+        assert_eq!(log.cursor(), 3, "heartbeats are not recorded");
+
+        let all = log.since(0, &EventFilter::default());
+        assert_eq!(
+            types(&all),
+            ["lifecycle.running", "task_completed", "lifecycle.idle"]
+        );
+        assert!(!all.gap);
+        assert_eq!(all.events[1]["source_kind"], "claude_hooks");
+        assert_eq!(all.events[1]["seq"], 2);
+
+        let filter = EventFilter::from_params(&serde_json::json!({
+            "pane_id": "%2", "event_type": ["lifecycle.*"], "provider": "claude",
+        }));
+        assert_eq!(types(&log.since(0, &filter)), ["lifecycle.idle"]);
+        let batch = log.since(3, &filter);
+        assert_eq!((batch.cursor, batch.events.len()), (3, 0));
+        let codex = EventFilter {
+            source_kinds: vec!["codex_appserver".to_string()],
+            ..Default::default()
+        };
+        assert!(log.since(0, &codex).events.is_empty());
+    }
+
+    #[test]
+    fn flags_gaps_for_lost_or_foreign_cursors() {
+        let mut log = SourceEventLog::default();
+        for i in 0..=MAX_EVENTS {
+            log.record(&[event("lifecycle.running", &format!("%{i}"), false)]);
+        }
+        let behind = log.since(0, &EventFilter::default());
+        assert!(behind.gap);
+        assert_eq!(behind.events.len(), MAX_EVENTS);
+        assert!(!log.since(1, &EventFilter::default()).gap);
+
+        let restarted = log.since(log.cursor() + 7, &EventFilter::default());
+        assert!(restarted.gap, "cursor from another daemon");
+        assert_eq!(restarted.events.len(), MAX_EVENTS);
+    }
+}
@@ -0,0 +1,121 @@
+//! Task metadata on panes (`task.set` / `task.clear` / `task.list`): which
+//! task an agent is working on (title, ticket URL, owner, tags), so lists
+//! and notifications say so instead of leaving it to input previews.
+//!
+//! Kept in daemon memory next to labels and dropped with the pane.
+
+use std::collections::HashMap;
+
+use serde_json::Value;
+
+/// Task attached to a pane; at least one field is set.
+#[derive(Debug, Clone, Default, PartialEq, Eq, serde::Serialize, serde::Deserialize)]
+pub struct TaskMeta {
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub title: Option<String>,
+    /// Ticket / issue URL (`http(s)://`).
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub url: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub owner: Option<String>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub tags: Vec<String>,
+}
+
+impl TaskMeta {
+    /// Parse `task.set` params. Blank strings count as unset; tags are
+    /// deduplicated in order.
+    pub fn from_params(params: &Value) -> Result<Self, String> {
+        let text = |key: &str| {
+            params[key]
+                .as_str()
+                .map(str::trim)
+                .filter(|s| !s.is_empty())
+                .map(String::from)
+        };
+        let mut tags: Vec<String> = Vec::new();
+        for tag in params["tags"].as_array().map(Vec::as_slice).unwrap_or(&[]) {
+            let tag = tag
+                .as_str()
+                .map(str::trim)
+                .filter(|t| !t.is_empty() && !t.contains(char::is_whitespace))
+                .ok_or_else(|| format!("invalid tag: {tag}"))?;
+            if !tags.iter().any(|t| t == tag) {
+                tags.push(tag.to_string());
+            }
+        }
+        let task = Self {
+            title: text("title"),
+            url: text("url"),
+            owner: text("owner"),
+            tags,
+        };
+        if let Some(url) = &task.url
+            && !url.starts_with("https://")
+            && !url.starts_with("http://")
+        {
+            return Err(format!("url must be http(s): {url}"));
+        }
+        if task == Self::default() {
+            return Err("set at least one of title, url, owner, tags".to_string());
+        }
+        Ok(task)
+    }
+
+    /// One-line form for notifications: `title (owner) #tag url`.
+    pub fn summary(&self) -> String {
+        let mut parts: Vec<String> = Vec::new();
+        parts.extend(self.title.clone());
+        parts.extend(self.owner.as_ref().map(|o| format!("({o})")));
+        parts.extend(self.tags.iter().map(|t| format!("#{t}")));
+        parts.extend(self.url.clone());
+        parts.join(" ")
+    }
+}
+
+/// " — task: <summary>" suffix for notification bodies of `pane_id`, or "".
+pub fn notice_suffix(tasks: &HashMap<String, TaskMeta>, pane_id: &str) -> String {
+    tasks
+        .get(pane_id)
+        .map(|t| format!(" — task: {}", t.summary()))
+        .unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_and_summarises() {
+        let task = TaskMeta::from_params(&serde_json::json!({
+            "title": " Fix login ", "url": "https://example.com/T-12", "owner": "",
+            "tags": ["auth", "p1", "auth"],
+        }))
+        .expect("valid");
+        assert_eq!(task.title.as_deref(), Some("Fix login"));
+        assert_eq!(task.owner, None);
+        assert_eq!(task.tags, ["auth", "p1"]);
+        assert_eq!(
+            task.summary(),
+            "Fix login #auth #p1 https://example.com/T-12"
+        );
+        assert_eq!(
+            serde_json::to_value(&task).expect("json"),
+            serde_json::json!({"title": "Fix login", "url": "https://example.com/T-12",
+                "tags": ["auth", "p1"]})
+        );
+
+        let tasks = HashMap::from([("%1".to_string(), task)]);
+        assert!(notice_suffix(&tasks, "%1").starts_with(" — task: Fix login"));
+        assert_eq!(notice_suffix(&tasks, "%2"), "");
+    }
+
+    #[test]
+    fn rejects_bad_params() {
+        assert!(TaskMeta::from_params(&serde_json::json!({"title": " "})).is_err());
+        assert!(TaskMeta::from_params(&serde_json::json!({"url": "ftp://x"})).is_err());
+        assert!(TaskMeta::from_params(&serde_json::json!({"tags": ["two words"]})).is_err());
+        assert!(TaskMeta::from_params(&serde_json::json!({"tags": [1]})).is_err());
+        assert!(TaskMeta::from_params(&serde_json::json!({"owner": "kim"})).is_ok());
+    }
+}
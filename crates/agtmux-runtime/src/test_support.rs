@@ -0,0 +1,30 @@
+//! Fixtures shared by unit tests.
+
+use agtmux_core_v5::types::{
+    ActivityState, EvidenceMode, PaneInstanceId, PanePresence, PaneRuntimeState,
+    PaneSignatureClass, Provider, SignatureInputsCompact,
+};
+use chrono::Utc;
+
+/// A managed Claude pane in `state`, born now. Tests needing another
+/// presence or provider override fields with struct update syntax.
+pub(crate) fn pane(pane_id: &str, state: ActivityState) -> PaneRuntimeState {
+    PaneRuntimeState {
+        pane_instance_id: PaneInstanceId {
+            pane_id: pane_id.to_string(),
+            generation: 0,
+            birth_ts: Utc::now(),
+        },
+        presence: PanePresence::Managed,
+        evidence_mode: EvidenceMode::Heuristic,
+        signature_class: PaneSignatureClass::Heuristic,
+        signature_reason: String::new(),
+        signature_confidence: 0.5,
+        no_agent_streak: 0,
+        signature_inputs: SignatureInputsCompact::default(),
+        activity_state: state,
+        provider: Some(Provider::Claude),
+        session_key: "s".to_string(),
+        updated_at: Utc::now(),
+    }
+}
@@ -0,0 +1,204 @@
+//! tmux control-mode observer (`[features] tmux_control`).
+//!
+//! Keeps one `tmux -C attach-session` client connected to the local tmux
+//! server and wakes the poll loop as soon as tmux reports a change: windows
+//! and sessions added, closed or renamed, layout changes (pane splits and
+//! exits) and pane output. The poll tick then runs right away instead of at
+//! its next `poll.interval_ms`, at most once per [`MIN_WAKE_GAP`]; the
+//! interval keeps running as the fallback for anything tmux does not notify.
+//!
+//! The client attaches read-only with `ignore-size`, so it neither types
+//! into panes nor shrinks windows (tmux 3.2 or later). tmux only reports
+//! output and layout of the windows of the attached session, and window
+//! changes of the others. With no session to attach to, or an older tmux,
+//! it retries every [`RETRY`] and polling alone applies meanwhile.
+
+use std::process::Stdio;
+use std::sync::Arc;
+
+use tokio::io::{AsyncBufReadExt, BufReader};
+use tokio::sync::{Mutex, Notify};
+use tokio::time::{Duration, Instant};
+
+use crate::daemon_config::TmuxSocket;
+use crate::features;
+use crate::poll_loop::DaemonState;
+
+/// Woken ticks are at least this far apart; notifications in between are
+/// folded into the next one.
+pub const MIN_WAKE_GAP: Duration = Duration::from_millis(500);
+/// Reconnect delay, and how often the feature flag is checked.
+pub const RETRY: Duration = Duration::from_secs(5);
+
+/// Whether a control-mode line is a notification worth a poll tick.
+/// Command replies (`%begin` ... `%end`) and client notices are not.
+pub fn wakes(line: &str) -> bool {
+    let name = line.split(' ').next().unwrap_or("");
+    matches!(
+        name,
+        "%output"
+            | "%extended-output"
+            | "%layout-change"
+            | "%window-add"
+            | "%window-close"
+            | "%window-renamed"
+            | "%window-pane-changed"
+            | "%unlinked-window-add"
+            | "%unlinked-window-close"
+            | "%unlinked-window-renamed"
+            | "%session-changed"
+            | "%session-renamed"
+            | "%session-window-changed"
+            | "%sessions-changed"
+            | "%pane-mode-changed"
+    )
+}
+
+/// `-S` / `-L` arguments for the daemon's tmux server, as `build_executor`.
+pub fn socket_args(socket: Option<&TmuxSocket>) -> Vec<String> {
+    match socket {
+        Some(TmuxSocket::Path(path)) => vec!["-S".to_string(), path.clone()],
+        Some(TmuxSocket::Name(name)) => vec!["-L".to_string(), name.clone()],
+        None => Vec::new(),
+    }
+}
+
+async fn enabled(state: &Arc<Mutex<DaemonState>>) -> bool {
+    state
+        .lock()
+        .await
+        .features
+        .is_enabled(features::TMUX_CONTROL)
+}
+
+/// Run the observer for the life of the daemon, connected while the
+/// feature is on (it follows SIGHUP reloads).
+pub async fn observe(socket: Vec<String>, state: Arc<Mutex<DaemonState>>, wake: Arc<Notify>) {
+    let mut failures = 0u32;
+    loop {
+        if !enabled(&state).await {
+            failures = 0;
+            tokio::time::sleep(RETRY).await;
+            continue;
+        }
+        match connect(&socket, &state, &wake).await {
+            Ok(()) => {
+                failures = 0;
+                tracing::debug!("tmux control client closed");
+                // Whatever ended it (a killed session, a server restart) is
+                // a change worth a tick.
+                wake.notify_one();
+            }
+            // Logged once; without a session this repeats until one exists.
+            Err(e) if failures == 0 => {
+                failures += 1;
+                tracing::warn!("tmux control mode unavailable, polling only: {e}");
+            }
+            Err(e) => tracing::debug!("tmux control mode unavailable: {e}"),
+        }
+        tokio::time::sleep(RETRY).await;
+    }
+}
+
+/// One control client, until it exits or the feature is turned off. An
+/// error means it never got going.
+async fn connect(
+    socket: &[String],
+    state: &Arc<Mutex<DaemonState>>,
+    wake: &Notify,
+) -> Result<(), String> {
+    let mut child = tokio::process::Command::new("tmux")
+        .args(socket)
+        .args(["-C", "attach-session", "-f", "read-only,ignore-size"])
+        // Control mode detaches when stdin closes; it is held until the
+        // child is dropped.
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::null())
+        .kill_on_drop(true)
+        .spawn()
+        .map_err(|e| format!("tmux: {e}"))?;
+    let stdout = child.stdout.take().ok_or("tmux: no stdout")?;
+    let mut lines = BufReader::new(stdout).lines();
+    let mut check = tokio::time::interval(RETRY);
+    check.tick().await;
+    let mut woken = Instant::now() - MIN_WAKE_GAP;
+    let mut pending = false;
+    // tmux names the session once attached; until then, plain lines are
+    // the error of the attach (`no sessions`).
+    let mut attached = false;
+    let mut error = String::new();
+    loop {
+        tokio::select! {
+            line = lines.next_line() => match line {
+                Ok(Some(line)) if line.starts_with("%exit") => break,
+                Ok(Some(line)) => {
+                    if !attached && line.starts_with("%session-changed") {
+                        attached = true;
+                        tracing::info!("tmux control mode attached");
+                    } else if !attached && !line.starts_with('%') {
+                        error = line.clone();
+                    }
+                    if wakes(&line) {
+                        pending = true;
+                    }
+                }
+                Ok(None) => break,
+                Err(e) => return Err(e.to_string()),
+            },
+            () = tokio::time::sleep_until(woken + MIN_WAKE_GAP), if pending => {}
+            _ = check.tick() => {
+                if !enabled(state).await {
+                    return Ok(());
+                }
+            }
+        }
+        if pending && woken.elapsed() >= MIN_WAKE_GAP {
+            pending = false;
+            woken = Instant::now();
+            wake.notify_one();
+        }
+    }
+    if attached {
+        return Ok(());
+    }
+    if error.is_empty() {
+        let status = child.wait().await.map_err(|e| e.to_string())?;
+        error = format!("tmux -C attach-session exited: {status}");
+    }
+    Err(error)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn wakes_on_topology_and_output_notifications() {
+        assert!(wakes("%output %3 hello\\015\\012"));
+        assert!(wakes("%window-add @4"));
+        assert!(wakes(
+            "%layout-change @1 b25d,80x24,0,0,1 b25d,80x24,0,0,1 *"
+        ));
+        assert!(wakes("%unlinked-window-close @7"));
+        assert!(wakes("%sessions-changed"));
+        assert!(!wakes("%begin 1700000000 12 0"));
+        assert!(!wakes("%end 1700000000 12 0"));
+        assert!(!wakes("%client-detached /dev/pts/3"));
+        assert!(!wakes("%outputs"));
+        assert!(!wakes(""));
+    }
+
+    #[test]
+    fn socket_args_follow_the_daemon_socket() {
+        assert!(socket_args(None).is_empty());
+        assert_eq!(
+            socket_args(Some(&TmuxSocket::Name("work".to_string()))),
+            ["-L", "work"]
+        );
+        assert_eq!(
+            socket_args(Some(&TmuxSocket::Path("/tmp/t.sock".to_string()))),
+            ["-S", "/tmp/t.sock"]
+        );
+    }
+}
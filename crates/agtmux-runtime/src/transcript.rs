@@ -0,0 +1,457 @@
+//! Transcript export (`pane.transcript`): the conversation of a pane's
+//! agent as markdown, for reviewing finished runs or attaching them to a
+//! ticket.
+//!
+//! The session file is found the way detection already finds it: for Claude
+//! the JSONL transcript the poller discovered for the pane (falling back to
+//! `~/.claude/projects/*/<session>.jsonl`), for Codex the rollout file of
+//! the pane's App Server thread under `$CODEX_HOME/sessions` (default
+//! `~/.codex/sessions`). The markdown, masked by `[redact]`, is returned, or
+//! written to `<archive_dir>/<provider>-<session>.md` when `archive_dir` is
+//! given.
+
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+
+use agtmux_core_v5::types::{PanePresence, Provider};
+use serde_json::Value;
+use tokio::sync::Mutex;
+
+use crate::actions::ActionError;
+use crate::poll_loop::DaemonState;
+
+/// Tool inputs and outputs longer than this are cut in the markdown.
+const MAX_TOOL_CHARS: usize = 4000;
+
+/// `pane.transcript {pane_id, archive_dir?}`.
+pub async fn export(state: &Arc<Mutex<DaemonState>>, params: &Value) -> Result<Value, ActionError> {
+    let pane_id = params["pane_id"].as_str().unwrap_or("").to_string();
+    let archive_dir = params["archive_dir"].as_str().map(PathBuf::from);
+    if archive_dir.as_ref().is_some_and(|d| !d.is_absolute()) {
+        return Err(ActionError::InvalidParams(
+            "archive_dir must be an absolute path".to_string(),
+        ));
+    }
+
+    let (provider, session_id, discovered, pool, redactor) = {
+        let st = state.lock().await;
+        if !st.last_panes.iter().any(|p| p.pane_id == pane_id) {
+            return Err(ActionError::PaneNotFound(pane_id));
+        }
+        let panes = st.daemon.list_panes();
+        let Some(pane) = panes
+            .iter()
+            .find(|p| p.pane_instance_id.pane_id == pane_id && p.presence == PanePresence::Managed)
+        else {
+            return Err(ActionError::InvalidParams(format!(
+                "pane {pane_id} runs no detected agent"
+            )));
+        };
+        let discovered = st
+            .claude_jsonl_discoveries
+            .iter()
+            .find(|d| d.pane_id == pane_id)
+            .map(|d| (d.session_id.clone(), d.jsonl_path.clone()));
+        let (session_id, discovered) = match (pane.provider, discovered) {
+            (Some(Provider::Claude), Some((session_id, path))) => (session_id, Some(path)),
+            _ => (pane.session_key.clone(), None),
+        };
+        (
+            pane.provider,
+            session_id,
+            discovered,
+            Arc::clone(&st.exec_pool),
+            st.redactor.clone(),
+        )
+    };
+    let Some(provider) = provider.filter(|p| matches!(p, Provider::Claude | Provider::Codex))
+    else {
+        return Err(ActionError::InvalidParams(format!(
+            "transcripts are only available for claude and codex panes ({pane_id} is {})",
+            provider.map_or("unknown", Provider::as_str)
+        )));
+    };
+
+    let job_session = session_id.clone();
+    let exported = pool
+        .run(
+            move || -> Result<(PathBuf, String, usize, Option<PathBuf>), String> {
+                let path = discovered
+                    .or_else(|| locate(provider, &job_session, &session_roots()))
+                    .ok_or_else(|| format!("no {provider} session file found for {job_session}"))?;
+                let jsonl = std::fs::read_to_string(&path)
+                    .map_err(|e| format!("read {}: {e}", path.display()))?;
+                let (markdown, messages) = to_markdown(provider, &job_session, &path, &jsonl);
+                let markdown = redactor.redact(&markdown).into_owned();
+                let archived = match archive_dir {
+                    Some(dir) => {
+                        let file = dir.join(format!("{provider}-{}.md", file_stem(&job_session)));
+                        std::fs::create_dir_all(&dir)
+                            .and_then(|()| std::fs::write(&file, &markdown))
+                            .map_err(|e| format!("write {}: {e}", file.display()))?;
+                        Some(file)
+                    }
+                    None => None,
+                };
+                Ok((path, markdown, messages, archived))
+            },
+        )
+        .await
+        .map_err(|e| ActionError::Failed(e.to_string()))?;
+    let (path, markdown, messages, archived) = exported.map_err(ActionError::Failed)?;
+    tracing::info!(pane_id, %provider, session_id, messages, archived = ?archived, "transcript exported");
+
+    Ok(serde_json::json!({
+        "pane_id": pane_id,
+        "provider": provider.as_str(),
+        "session_id": session_id,
+        "source": path,
+        "messages": messages,
+        "markdown": archived.is_none().then_some(markdown),
+        "archive_path": archived,
+    }))
+}
+
+/// Where session files live: `~/.claude/projects` and the Codex sessions
+/// directory.
+struct SessionRoots {
+    claude_projects: Option<PathBuf>,
+    codex_sessions: Option<PathBuf>,
+}
+
+fn session_roots() -> SessionRoots {
+    let home = std::env::var("HOME")
+        .ok()
+        .filter(|h| !h.is_empty())
+        .map(PathBuf::from);
+    let codex_home = std::env::var("CODEX_HOME")
+        .ok()
+        .filter(|h| !h.is_empty())
+        .map(PathBuf::from)
+        .or_else(|| home.as_ref().map(|h| h.join(".codex")));
+    SessionRoots {
+        claude_projects: home.map(|h| h.join(".claude").join("projects")),
+        codex_sessions: codex_home.map(|h| h.join("sessions")),
+    }
+}
+
+/// Session file of `session_id`: `<project>/<id>.jsonl` for Claude,
+/// `YYYY/MM/DD/rollout-<time>-<id>.jsonl` for Codex.
+fn locate(provider: Provider, session_id: &str, roots: &SessionRoots) -> Option<PathBuf> {
+    if session_id.is_empty() || session_id.contains('/') {
+        return None;
+    }
+    match provider {
+        Provider::Claude => {
+            let file = format!("{session_id}.jsonl");
+            std::fs::read_dir(roots.claude_projects.as_ref()?)
+                .ok()?
+                .flatten()
+                .map(|project| project.path().join(&file))
+                .find(|path| path.is_file())
+        }
+        Provider::Codex => {
+            let suffix = format!("-{session_id}.jsonl");
+            find_file(roots.codex_sessions.as_ref()?, 3, &|name| {
+                name.starts_with("rollout-") && name.ends_with(&suffix)
+            })
+        }
+        _ => None,
+    }
+}
+
+/// Depth-limited search for a file whose name satisfies `matches`; newest
+/// directories (by name) first.
+fn find_file(dir: &Path, depth: usize, matches: &dyn Fn(&str) -> bool) -> Option<PathBuf> {
+    let mut entries: Vec<PathBuf> = std::fs::read_dir(dir)
+        .ok()?
+        .flatten()
+        .map(|e| e.path())
+        .collect();
+    entries.sort_unstable_by(|a, b| b.cmp(a));
+    entries.iter().find_map(|path| {
+        if path.is_dir() {
+            (depth > 0)
+                .then(|| find_file(path, depth - 1, matches))
+                .flatten()
+        } else {
+            path.file_name()
+                .and_then(|n| n.to_str())
+                .is_some_and(matches)
+                .then(|| path.clone())
+        }
+    })
+}
+
+fn file_stem(session_id: &str) -> String {
+    session_id
+        .chars()
+        .map(|c| {
+            if c.is_ascii_alphanumeric() || c == '-' || c == '_' {
+                c
+            } else {
+                '_'
+            }
+        })
+        .collect()
+}
+
+/// One rendered piece of the conversation.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Block {
+    Text(String),
+    ToolCall { name: String, input: String },
+    ToolResult(String),
+}
+
+/// Convert a Claude or Codex JSONL session into markdown. Returns the
+/// markdown and the number of messages (role changes) in it.
+fn to_markdown(provider: Provider, session_id: &str, path: &Path, jsonl: &str) -> (String, usize) {
+    let title = match provider {
+        Provider::Codex => "Codex",
+        _ => "Claude",
+    };
+    let mut out = format!(
+        "# {title} transcript `{session_id}`\n\n_Exported from `{}`_\n",
+        path.display()
+    );
+    let mut messages = 0;
+    let mut last_role = "";
+    for line in jsonl.lines() {
+        let Ok(entry) = serde_json::from_str::<Value>(line) else {
+            continue;
+        };
+        let parsed = match provider {
+            Provider::Codex => codex_entry(&entry),
+            _ => claude_entry(&entry),
+        };
+        let Some((role, blocks)) = parsed.filter(|(_, blocks)| !blocks.is_empty()) else {
+            continue;
+        };
+        if role != last_role {
+            messages += 1;
+            last_role = role;
+            let heading = if role == "user" { "User" } else { "Assistant" };
+            match entry["timestamp"].as_str() {
+                Some(at) => out += &format!("\n## {heading} · {at}\n"),
+                None => out += &format!("\n## {heading}\n"),
+            }
+        }
+        for block in blocks {
+            out.push('\n');
+            match block {
+                Block::Text(text) => {
+                    out += text.trim();
+                    out.push('\n');
+                }
+                Block::ToolCall { name, input } => {
+                    out += &format!("**Tool call `{name}`**\n\n");
+                    out += &fence(&input, "json");
+                }
+                Block::ToolResult(output) => {
+                    out += "**Tool result**\n\n";
+                    out += &fence(&output, "");
+                }
+            }
+        }
+    }
+    (out, messages)
+}
+
+/// Claude Code line: `{"type": "user"|"assistant", "message": {"content":
+/// str | [{"type": "text"|"tool_use"|"tool_result"|"thinking", ...}]}}`.
+fn claude_entry(entry: &Value) -> Option<(&'static str, Vec<Block>)> {
+    let role = match entry["type"].as_str()? {
+        "user" => "user",
+        "assistant" => "assistant",
+        _ => return None,
+    };
+    if entry["isMeta"].as_bool() == Some(true) {
+        return None;
+    }
+    let content = &entry["message"]["content"];
+    if let Some(text) = content.as_str() {
+        return Some((role, vec![Block::Text(text.to_string())]));
+    }
+    let blocks = content
+        .as_array()?
+        .iter()
+        .filter_map(|part| match part["type"].as_str()? {
+            "text" => Some(Block::Text(part["text"].as_str()?.to_string())),
+            "tool_use" => Some(Block::ToolCall {
+                name: part["name"].as_str().unwrap_or("?").to_string(),
+                input: serde_json::to_string_pretty(&part["input"]).unwrap_or_default(),
+            }),
+            "tool_result" => Some(Block::ToolResult(match &part["content"] {
+                Value::String(s) => s.clone(),
+                Value::Array(parts) => parts
+                    .iter()
+                    .filter_map(|p| p["text"].as_str())
+                    .collect::<Vec<_>>()
+                    .join("\n"),
+                _ => String::new(),
+            })),
+            _ => None,
+        })
+        .collect();
+    Some((role, blocks))
+}
+
+/// Codex rollout line: `{"type": "response_item", "payload": {"type":
+/// "message"|"function_call"|"function_call_output"|"reasoning", ...}}`
+/// (older rollouts have the item unwrapped).
+fn codex_entry(entry: &Value) -> Option<(&'static str, Vec<Block>)> {
+    let item = match entry["type"].as_str() {
+        Some("response_item") => &entry["payload"],
+        _ => entry,
+    };
+    match item["type"].as_str()? {
+        "message" => {
+            let role = match item["role"].as_str()? {
+                "user" => "user",
+                "assistant" => "assistant",
+                _ => return None,
+            };
+            let blocks = item["content"]
+                .as_array()?
+                .iter()
+                .filter_map(|part| part["text"].as_str())
+                // Context Codex injects as user messages, not typed by anyone.
+                .filter(|text| {
+                    !text.starts_with("<environment_context>")
+                        && !text.starts_with("<user_instructions>")
+                })
+                .map(|text| Block::Text(text.to_string()))
+                .collect();
+            Some((role, blocks))
+        }
+        "function_call" => {
+            let arguments = item["arguments"].as_str().unwrap_or("");
+            let input = serde_json::from_str::<Value>(arguments)
+                .and_then(|v| serde_json::to_string_pretty(&v))
+                .unwrap_or_else(|_| arguments.to_string());
+            Some((
+                "assistant",
+                vec![Block::ToolCall {
+                    name: item["name"].as_str().unwrap_or("?").to_string(),
+                    input,
+                }],
+            ))
+        }
+        "function_call_output" => {
+            let output = match &item["output"] {
+                Value::String(s) => s.clone(),
+                other => other["content"].as_str().unwrap_or("").to_string(),
+            };
+            Some(("assistant", vec![Block::ToolResult(output)]))
+        }
+        _ => None,
+    }
+}
+
+/// Fenced code block, cut at [`MAX_TOOL_CHARS`]; the fence grows past any
+/// backtick run in `body`.
+fn fence(body: &str, info: &str) -> String {
+    let mut body = body.trim_end().to_string();
+    if let Some((cut, _)) = body.char_indices().nth(MAX_TOOL_CHARS) {
+        let more = body[cut..].chars().count();
+        body.truncate(cut);
+        body += &format!("\n… ({more} more chars)");
+    }
+    let mut ticks = 3;
+    while body.contains(&"`".repeat(ticks)) {
+        ticks += 1;
+    }
+    let fence = "`".repeat(ticks);
+    format!("{fence}{info}\n{body}\n{fence}\n")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn claude_jsonl_to_markdown() {
+        let jsonl = [
+            r#"{"type":"user","message":{"role":"user","content":"fix the test"},"timestamp":"2026-10-15T02:00:00Z"}"#,
+            r#"{"type":"user","isMeta":true,"message":{"role":"user","content":"caveat"}}"#,
+            r#"{"type":"assistant","message":{"content":[{"type":"thinking","thinking":"hm"},{"type":"text","text":"Running it."},{"type":"tool_use","name":"Bash","input":{"command":"cargo test"}}]},"timestamp":"2026-10-15T02:00:05Z"}"#,
+            r#"{"type":"user","message":{"content":[{"type":"tool_result","content":[{"type":"text","text":"ok"}]}]},"timestamp":"2026-10-15T02:00:09Z"}"#,
+            r#"{"type":"custom-title","title":"x"}"#,
+            "not json",
+        ]
+        .join("\n");
+        let (markdown, messages) =
+            to_markdown(Provider::Claude, "abc", Path::new("/t/abc.jsonl"), &jsonl);
+        assert_eq!(messages, 3);
+        assert_eq!(
+            markdown,
+            "# Claude transcript `abc`\n\n_Exported from `/t/abc.jsonl`_\n\
+             \n## User · 2026-10-15T02:00:00Z\n\nfix the test\n\
+             \n## Assistant · 2026-10-15T02:00:05Z\n\nRunning it.\n\
+             \n**Tool call `Bash`**\n\n```json\n{\n  \"command\": \"cargo test\"\n}\n```\n\
+             \n## User · 2026-10-15T02:00:09Z\n\n**Tool result**\n\n```\nok\n```\n"
+        );
+    }
+
+    #[test]
+    fn codex_rollout_to_markdown() {
+        let jsonl = [
+            r#"{"type":"session_meta","payload":{"id":"t1"}}"#,
+            r#"{"type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"<environment_context>cwd</environment_context>"}]}}"#,
+            r#"{"type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"list files"}]}}"#,
+            r#"{"type":"response_item","payload":{"type":"reasoning","summary":[]}}"#,
+            r#"{"type":"response_item","payload":{"type":"function_call","name":"shell","arguments":"{\"command\":[\"ls\"]}"}}"#,
+            r#"{"type":"response_item","payload":{"type":"function_call_output","output":"a.rs"}}"#,
+            r#"{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Done."}]}"#,
+        ]
+        .join("\n");
+        let (markdown, messages) =
+            to_markdown(Provider::Codex, "t1", Path::new("/r.jsonl"), &jsonl);
+        assert_eq!(messages, 2);
+        assert!(markdown.contains("## User\n\nlist files\n"), "{markdown}");
+        assert!(!markdown.contains("environment_context"), "{markdown}");
+        assert!(
+            markdown.contains("**Tool call `shell`**\n\n```json\n{\n  \"command\": [\n    \"ls\"\n  ]\n}\n```\n\n**Tool result**\n\n```\na.rs\n```\n\nDone.\n"),
+            "{markdown}"
+        );
+    }
+
+    #[test]
+    fn fence_escapes_backticks_and_truncates() {
+        assert_eq!(fence("a ``` b", ""), "````\na ``` b\n````\n");
+        let long = "x".repeat(MAX_TOOL_CHARS + 5);
+        assert!(fence(&long, "").ends_with("x\n… (5 more chars)\n```\n"));
+    }
+
+    #[test]
+    fn locates_session_files() {
+        let dir = std::env::temp_dir().join(format!("agtmux-transcript-{}", std::process::id()));
+        let claude = dir.join("claude");
+        let codex = dir.join("codex");
+        std::fs::create_dir_all(claude.join("-work-api")).expect("mkdir");
+        std::fs::create_dir_all(codex.join("2026/10/15")).expect("mkdir");
+        std::fs::write(claude.join("-work-api/abc.jsonl"), "").expect("write");
+        std::fs::write(
+            codex.join("2026/10/15/rollout-2026-10-15T02-00-00-t1.jsonl"),
+            "",
+        )
+        .expect("write");
+        let roots = SessionRoots {
+            claude_projects: Some(claude.clone()),
+            codex_sessions: Some(codex.clone()),
+        };
+
+        assert_eq!(
+            locate(Provider::Claude, "abc", &roots),
+            Some(claude.join("-work-api/abc.jsonl"))
+        );
+        assert_eq!(
+            locate(Provider::Codex, "t1", &roots),
+            Some(codex.join("2026/10/15/rollout-2026-10-15T02-00-00-t1.jsonl"))
+        );
+        assert_eq!(locate(Provider::Codex, "t2", &roots), None);
+        assert_eq!(locate(Provider::Claude, "../abc", &roots), None);
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
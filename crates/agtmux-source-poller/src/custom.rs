@@ -0,0 +1,295 @@
+//! User-defined adapters: agent CLIs described in the daemon config by a
+//! process regex and per-state output regexes, classified here next to the
+//! built-in providers. Events carry `Provider::Custom` with the adapter name
+//! (and an optional label) in the payload.
+//!
+//! A plugin adapter names an external command instead of output regexes. The
+//! poller does not run it: the caller classifies the panes such adapters
+//! claim (see [`claiming_adapter`]) and hands the [`Verdict`]s over before
+//! each batch.
+
+use std::collections::HashMap;
+
+use agtmux_core_v5::signature::WEIGHT_CMD_MATCH;
+use agtmux_core_v5::types::{ActivityState, EvidenceTier, Provider, SourceEventV2, SourceKind};
+use regex::Regex;
+
+use crate::source::{PaneSnapshot, PollResult, activity_event_type};
+
+/// A compiled custom adapter.
+#[derive(Debug, Clone)]
+pub struct CustomAdapter {
+    pub name: String,
+    /// Matched against the pane's current command.
+    process: Regex,
+    /// Output patterns per state, in `ActivityState::PRECEDENCE_DESC` order.
+    states: Vec<(ActivityState, Vec<Regex>)>,
+    /// First capture group (else the whole match) of the most recent
+    /// matching line becomes the label.
+    label: Option<Regex>,
+    /// Plugin command (argv); empty for regex adapters.
+    command: Vec<String>,
+    /// Hex SHA-256 of each file the plugin command runs.
+    sha256: Vec<String>,
+}
+
+/// A plugin's classification of one pane.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Verdict {
+    pub state: ActivityState,
+    pub label: Option<String>,
+    /// Detection confidence in `0.0..=1.0`.
+    pub confidence: f64,
+}
+
+impl CustomAdapter {
+    /// Compile an adapter; the error names the offending pattern.
+    pub fn new(
+        name: &str,
+        process: &str,
+        states: &[(ActivityState, Vec<String>)],
+        label: Option<&str>,
+    ) -> Result<Self, String> {
+        let compile = |pattern: &str| {
+            Regex::new(pattern).map_err(|e| format!("adapter {name}: pattern {pattern:?}: {e}"))
+        };
+        let mut compiled = Vec::new();
+        for state in ActivityState::PRECEDENCE_DESC {
+            let patterns: Vec<Regex> = states
+                .iter()
+                .filter(|(s, _)| *s == state)
+                .flat_map(|(_, patterns)| patterns)
+                .map(|p| compile(p))
+                .collect::<Result<_, _>>()?;
+            if !patterns.is_empty() {
+                compiled.push((state, patterns));
+            }
+        }
+        Ok(Self {
+            name: name.to_string(),
+            process: compile(process)?,
+            states: compiled,
+            label: label.map(compile).transpose()?,
+            command: Vec::new(),
+            sha256: Vec::new(),
+        })
+    }
+
+    /// A plugin adapter: panes matching `process` are classified by running
+    /// `command`, whose files must hash to `sha256` when pins are given.
+    pub fn plugin(
+        name: &str,
+        process: &str,
+        command: Vec<String>,
+        sha256: Vec<String>,
+    ) -> Result<Self, String> {
+        Ok(Self {
+            command,
+            sha256,
+            ..Self::new(name, process, &[], None)?
+        })
+    }
+
+    /// The plugin command, for plugin adapters.
+    pub fn command(&self) -> Option<&[String]> {
+        (!self.command.is_empty()).then_some(self.command.as_slice())
+    }
+
+    /// The digests the plugin's files are pinned to; empty if unpinned.
+    pub fn sha256(&self) -> &[String] {
+        &self.sha256
+    }
+
+    /// Whether the adapter claims a pane running `current_cmd`.
+    pub fn matches(&self, current_cmd: &str) -> bool {
+        self.process.is_match(current_cmd)
+    }
+
+    /// Highest-precedence state with a matching line (Unknown if none);
+    /// within a state the most recent line wins, as for built-in signals.
+    pub fn classify(&self, lines: &[String]) -> (ActivityState, Option<String>) {
+        let state = self
+            .states
+            .iter()
+            .find(|(_, patterns)| {
+                lines
+                    .iter()
+                    .rev()
+                    .any(|line| patterns.iter().any(|p| p.is_match(line)))
+            })
+            .map_or(ActivityState::Unknown, |(state, _)| *state);
+        let label = self.label.as_ref().and_then(|re| {
+            lines.iter().rev().find_map(|line| {
+                let caps = re.captures(line)?;
+                let text = caps.get(1).or_else(|| caps.get(0))?.as_str().trim();
+                (!text.is_empty()).then(|| text.to_string())
+            })
+        });
+        (state, label)
+    }
+}
+
+/// The first adapter whose process regex matches `snapshot`.
+pub fn claiming_adapter<'a>(
+    snapshot: &PaneSnapshot,
+    adapters: &'a [CustomAdapter],
+) -> Option<&'a CustomAdapter> {
+    // Plain shells are never agents, as for the built-in providers.
+    if snapshot.process_hint.as_deref() == Some("shell") {
+        return None;
+    }
+    adapters.iter().find(|a| a.matches(&snapshot.current_cmd))
+}
+
+/// Classify `snapshot` with the first adapter whose process regex matches;
+/// plugin adapters use the pane's entry in `verdicts` (Unknown if missing).
+pub fn poll_custom(
+    snapshot: &PaneSnapshot,
+    adapters: &[CustomAdapter],
+    verdicts: &HashMap<String, Verdict>,
+) -> Option<PollResult> {
+    let adapter = claiming_adapter(snapshot, adapters)?;
+    let (activity_state, label, confidence) = if adapter.command().is_some() {
+        verdicts
+            .get(&snapshot.pane_id)
+            .map_or((ActivityState::Unknown, None, WEIGHT_CMD_MATCH), |v| {
+                (v.state, v.label.clone(), v.confidence.clamp(0.0, 1.0))
+            })
+    } else {
+        let (state, label) = adapter.classify(&snapshot.capture_lines);
+        (state, label, WEIGHT_CMD_MATCH)
+    };
+    let event = SourceEventV2 {
+        event_id: format!(
+            "poller-{}-{}",
+            snapshot.pane_id,
+            snapshot.captured_at.timestamp_millis()
+        ),
+        provider: Provider::Custom,
+        source_kind: SourceKind::Poller,
+        tier: EvidenceTier::Heuristic,
+        observed_at: snapshot.captured_at,
+        session_key: format!("poller-{}", snapshot.pane_id),
+        pane_id: Some(snapshot.pane_id.clone()),
+        pane_generation: None,
+        pane_birth_ts: None,
+        source_event_id: None,
+        event_type: activity_event_type(activity_state).to_string(),
+        payload: serde_json::json!({
+            "provider": Provider::Custom.as_str(),
+            "adapter": adapter.name,
+            "label": label,
+            "cmd_match": true,
+            "detection_confidence": confidence,
+            "activity_state": format!("{activity_state:?}"),
+        }),
+        confidence,
+        is_heartbeat: false,
+    };
+    Some(PollResult {
+        pane_id: snapshot.pane_id.clone(),
+        provider: Provider::Custom,
+        activity_state,
+        confidence,
+        event,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn devbot() -> CustomAdapter {
+        CustomAdapter::new(
+            "devbot",
+            r"^devbot\b",
+            &[
+                (ActivityState::Running, vec![r"^\[working\]".to_string()]),
+                (ActivityState::Idle, vec![r"^devbot> ".to_string()]),
+                (
+                    ActivityState::WaitingApproval,
+                    vec![r"approve\? \[y/N\]".to_string()],
+                ),
+            ],
+            Some(r"^task: (.+)"),
+        )
+        .expect("valid patterns")
+    }
+
+    fn snapshot(cmd: &str, lines: &[&str]) -> PaneSnapshot {
+        PaneSnapshot {
+            pane_id: "%5".to_string(),
+            current_cmd: cmd.to_string(),
+            capture_lines: lines.iter().map(|l| l.to_string()).collect(),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn classifies_matching_panes_by_precedence() {
+        let adapters = [devbot()];
+        let result = poll_custom(
+            &snapshot(
+                "devbot --fast",
+                &["task: migrate the db", "[working] step 2", "approve? [y/N]"],
+            ),
+            &adapters,
+            &HashMap::new(),
+        )
+        .expect("devbot pane");
+        assert_eq!(result.provider, Provider::Custom);
+        assert_eq!(result.activity_state, ActivityState::WaitingApproval);
+        assert_eq!(result.event.event_type, "activity.waiting_approval");
+        assert_eq!(result.event.payload["adapter"], "devbot");
+        assert_eq!(result.event.payload["label"], "migrate the db");
+
+        let idle = poll_custom(
+            &snapshot("devbot", &["devbot> "]),
+            &adapters,
+            &HashMap::new(),
+        )
+        .expect("idle");
+        assert_eq!(idle.activity_state, ActivityState::Idle);
+        assert!(idle.event.payload["label"].is_null());
+        assert!(
+            poll_custom(&snapshot("zsh", &["[working]"]), &adapters, &HashMap::new()).is_none()
+        );
+    }
+
+    #[test]
+    fn plugin_adapters_use_verdicts() {
+        let adapters =
+            [
+                CustomAdapter::plugin("ext", "^ext$", vec!["classify".to_string()], Vec::new())
+                    .expect("valid process"),
+            ];
+        let pane = snapshot("ext", &["[working]"]);
+        assert_eq!(
+            claiming_adapter(&pane, &adapters).and_then(CustomAdapter::command),
+            Some(&["classify".to_string()][..])
+        );
+
+        let pending = poll_custom(&pane, &adapters, &HashMap::new()).expect("claimed");
+        assert_eq!(pending.activity_state, ActivityState::Unknown);
+
+        let verdicts = HashMap::from([(
+            "%5".to_string(),
+            Verdict {
+                state: ActivityState::WaitingInput,
+                label: Some("deploy".to_string()),
+                confidence: 1.5,
+            },
+        )]);
+        let result = poll_custom(&pane, &adapters, &verdicts).expect("claimed");
+        assert_eq!(result.activity_state, ActivityState::WaitingInput);
+        assert_eq!(result.confidence, 1.0);
+        assert_eq!(result.event.payload["label"], "deploy");
+        assert_eq!(result.event.payload["adapter"], "ext");
+    }
+
+    #[test]
+    fn invalid_pattern_is_reported() {
+        let err = CustomAdapter::new("bad", "(", &[], None).expect_err("unbalanced");
+        assert!(err.starts_with("adapter bad: pattern \"(\""), "{err}");
+    }
+}
@@ -70,6 +70,15 @@ pub fn mvp_provider_defs() -> Vec<ProviderDetectDef> {
             capture_tokens: &["codex>"],
             wrapper_cmd: true,
         },
+        ProviderDetectDef {
+            provider: Provider::Aider,
+            process_hint: "aider",
+            cmd_tokens: &["aider"],
+            title_tokens: &["aider"],
+            capture_tokens: &["aider v"],
+            // Python entry point: tmux may report `python3` / `Python`.
+            wrapper_cmd: true,
+        },
     ]
 }
 
@@ -573,6 +582,29 @@ mod tests {
         );
     }
 
+    #[test]
+    fn detect_aider_cmd_and_startup_banner() {
+        let meta = PaneMeta {
+            current_cmd: "aider".to_string(),
+            ..Default::default()
+        };
+        let r = detect_best(&meta).expect("aider via cmd");
+        assert_eq!(r.provider, Provider::Aider);
+        assert!(r.cmd_match);
+
+        let meta = PaneMeta {
+            current_cmd: "python3".to_string(),
+            capture_lines: vec![
+                "Aider v0.82.1".to_string(),
+                "Main model: sonnet with diff edit format".to_string(),
+            ],
+            ..Default::default()
+        };
+        let r = detect_best(&meta).expect("aider via banner");
+        assert_eq!(r.provider, Provider::Aider);
+        assert!(r.capture_match);
+    }
+
     #[test]
     fn detect_shell_pane_never_assigned_codex() {
         let codex_def = &mvp_provider_defs()[1];
@@ -89,6 +89,39 @@ pub fn codex_activity_signals() -> Vec<ActivitySignalDef> {
     ]
 }
 
+/// MVP activity signal definitions for aider. A `(Y)es/(N)o` question
+/// blocks on an answer; the ones about running commands or touching files
+/// ask for permission and win by precedence.
+pub fn aider_activity_signals() -> Vec<ActivitySignalDef> {
+    vec![
+        ActivitySignalDef {
+            state: ActivityState::Running,
+            patterns: vec!["Waiting for".to_string(), "Updating repo map".to_string()],
+        },
+        ActivitySignalDef {
+            state: ActivityState::Idle,
+            // `> `, `ask> `, `architect> `
+            patterns: vec!["> ".to_string()],
+        },
+        ActivitySignalDef {
+            state: ActivityState::WaitingInput,
+            patterns: vec!["(Y)es/(N)o".to_string()],
+        },
+        ActivitySignalDef {
+            state: ActivityState::WaitingApproval,
+            patterns: vec![
+                "Run shell command".to_string(),
+                "Allow edits to".to_string(),
+                "Create new file".to_string(),
+            ],
+        },
+        ActivitySignalDef {
+            state: ActivityState::Error,
+            patterns: vec!["Error:".to_string()],
+        },
+    ]
+}
+
 // ─── Matching ───────────────────────────────────────────────────
 
 /// Match activity signals against capture lines.
@@ -276,6 +309,29 @@ mod tests {
         assert_eq!(m.state, ActivityState::WaitingApproval);
     }
 
+    #[test]
+    fn aider_questions_running_and_prompt() {
+        let signals = aider_activity_signals();
+        let state = |lines: &[&str]| match_activity(lines, &signals).map(|m| m.state);
+
+        assert_eq!(
+            state(&["> add a login form", "Waiting for sonnet"]),
+            Some(ActivityState::Running)
+        );
+        assert_eq!(
+            state(&["Add src/app.py to the chat? (Y)es/(N)o [Yes]:"]),
+            Some(ActivityState::WaitingInput)
+        );
+        assert_eq!(
+            state(&["Run shell command? (Y)es/(N)o/(D)on't ask again [Yes]:"]),
+            Some(ActivityState::WaitingApproval)
+        );
+        assert_eq!(
+            state(&["Applied edit to src/app.py", "ask> "]),
+            Some(ActivityState::Idle)
+        );
+    }
+
     // ── Spinner character detection ─────────────────────────────
 
     #[test]
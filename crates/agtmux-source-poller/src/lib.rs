@@ -5,6 +5,7 @@
 //! Architecture ref: docs/30_architecture.md C-006
 
 pub mod accuracy;
+pub mod custom;
 pub mod detect;
 pub mod evidence;
 pub mod source;
@@ -9,11 +9,16 @@ use agtmux_core_v5::types::{
     ActivityState, EvidenceTier, Provider, PullEventsRequest, PullEventsResponse, SourceEventV2,
     SourceHealthReport, SourceHealthStatus, SourceKind,
 };
-use chrono::{DateTime, Utc};
+use std::collections::HashMap;
+
+use chrono::{DateTime, TimeDelta, Utc};
 use serde::{Deserialize, Serialize};
 
+use crate::custom::{CustomAdapter, Verdict, poll_custom};
 use crate::detect::{PaneMeta, detect_best};
-use crate::evidence::{claude_activity_signals, codex_activity_signals, match_activity};
+use crate::evidence::{
+    aider_activity_signals, claude_activity_signals, codex_activity_signals, match_activity,
+};
 
 // ─── Snapshot ───────────────────────────────────────────────────────
 
@@ -45,7 +50,7 @@ pub struct PollResult {
 // ─── Event type mapping ─────────────────────────────────────────────
 
 /// Map an `ActivityState` to the corresponding event_type string.
-fn activity_event_type(state: ActivityState) -> &'static str {
+pub(crate) fn activity_event_type(state: ActivityState) -> &'static str {
     match state {
         ActivityState::Running => "activity.running",
         ActivityState::Idle => "activity.idle",
@@ -77,6 +82,7 @@ pub fn poll_pane(snapshot: &PaneSnapshot) -> Option<PollResult> {
     let signals = match detect_result.provider {
         Provider::Claude => claude_activity_signals(),
         Provider::Codex => codex_activity_signals(),
+        Provider::Aider => aider_activity_signals(),
         // For unsupported providers, use Claude signals as default fallback
         _ => claude_activity_signals(),
     };
@@ -136,11 +142,25 @@ pub fn poll_pane(snapshot: &PaneSnapshot) -> Option<PollResult> {
     })
 }
 
+/// What downstream consumers see of an event, minus id and timestamp.
+fn fingerprint(event: &SourceEventV2) -> String {
+    format!(
+        "{}|{}|{}",
+        event.provider.as_str(),
+        event.event_type,
+        event.payload
+    )
+}
+
 // ─── Poller Source State ────────────────────────────────────────────
 
 /// Cursor prefix for poller source server.
 const CURSOR_PREFIX: &str = "poller:";
 
+/// An unchanged pane is re-emitted at most this often, so downstream state
+/// that ages out (resolver freshness, restarted consumers) is refreshed.
+pub const RESYNC_INTERVAL_SECS: i64 = 10;
+
 /// In-memory state for the poller source server.
 #[derive(Debug, Clone, Default)]
 pub struct PollerSourceState {
@@ -149,6 +169,14 @@ pub struct PollerSourceState {
     /// Offset from compaction: number of events drained from the front.
     /// Cursors are always absolute; `compact_offset` adjusts the index.
     compact_offset: u64,
+    /// Last emitted observation per pane: (fingerprint, observed_at).
+    /// Panes whose fingerprint is unchanged are not re-emitted until
+    /// `RESYNC_INTERVAL_SECS` has passed.
+    last_emitted: HashMap<String, (String, DateTime<Utc>)>,
+    /// User-defined adapters, tried before the built-in providers.
+    custom: Vec<CustomAdapter>,
+    /// Latest plugin verdicts by pane id.
+    verdicts: HashMap<String, Verdict>,
 }
 
 impl PollerSourceState {
@@ -157,14 +185,62 @@ impl PollerSourceState {
         Self::default()
     }
 
-    /// Process a batch of pane snapshots, producing events for detected agents.
-    pub fn poll_batch(&mut self, snapshots: &[PaneSnapshot]) {
+    /// Process a batch of pane snapshots (the full pane set of one tick),
+    /// producing events only for detected agents whose observation changed
+    /// since the last emitted one (or is due for resync).
+    ///
+    /// Returns the number of events emitted.
+    pub fn poll_batch(&mut self, snapshots: &[PaneSnapshot]) -> usize {
+        let mut emitted = 0;
+        let mut seen = HashMap::with_capacity(self.last_emitted.len());
         for snapshot in snapshots {
-            if let Some(result) = poll_pane(snapshot) {
-                self.events.push(result.event);
-                self.seq = self.seq.saturating_add(1);
+            let Some(result) =
+                poll_custom(snapshot, &self.custom, &self.verdicts).or_else(|| poll_pane(snapshot))
+            else {
+                continue;
+            };
+            let fingerprint = fingerprint(&result.event);
+            if let Some((prev, at)) = self.last_emitted.remove(&snapshot.pane_id)
+                && prev == fingerprint
+                && snapshot.captured_at.signed_duration_since(at)
+                    < TimeDelta::seconds(RESYNC_INTERVAL_SECS)
+            {
+                seen.insert(snapshot.pane_id.clone(), (prev, at));
+                continue;
             }
+            seen.insert(
+                snapshot.pane_id.clone(),
+                (fingerprint, snapshot.captured_at),
+            );
+            self.events.push(result.event);
+            self.seq = self.seq.saturating_add(1);
+            emitted += 1;
         }
+        // Panes that vanished or lost their agent are emitted afresh on return.
+        self.last_emitted = seen;
+        emitted
+    }
+
+    /// Replace the custom adapters; panes are re-emitted under the new set.
+    pub fn set_custom_adapters(&mut self, adapters: Vec<CustomAdapter>) {
+        self.custom = adapters;
+        self.resync();
+    }
+
+    /// Adapters tried before the built-in providers.
+    pub fn custom_adapters(&self) -> &[CustomAdapter] {
+        &self.custom
+    }
+
+    /// Plugin verdicts by pane id, used by the next [`poll_batch`](Self::poll_batch).
+    pub fn set_plugin_verdicts(&mut self, verdicts: HashMap<String, Verdict>) {
+        self.verdicts = verdicts;
+    }
+
+    /// Forget emitted observations so the next batch re-emits every pane
+    /// (e.g. after deterministic evidence went stale and heuristic takes over).
+    pub fn resync(&mut self) {
+        self.last_emitted.clear();
     }
 
     /// Parse a cursor string into its sequence number.
@@ -818,4 +894,41 @@ mod tests {
         );
         assert_eq!(resp.next_cursor, Some("poller:6".to_string()));
     }
+
+    // ── Change-only emission ────────────────────────────────────────
+
+    #[test]
+    fn poll_batch_emits_only_changed_panes() {
+        let mut state = PollerSourceState::new();
+        assert_eq!(state.poll_batch(&[claude_snapshot(), codex_snapshot()]), 2);
+
+        // Same observations a tick later: nothing new.
+        let mut claude = claude_snapshot();
+        claude.captured_at = now() + TimeDelta::seconds(1);
+        let mut codex = codex_snapshot();
+        codex.captured_at = now() + TimeDelta::seconds(1);
+        assert_eq!(state.poll_batch(&[claude.clone(), codex.clone()]), 0);
+
+        // Activity change on one pane emits just that pane.
+        claude.capture_lines = vec!["❯ ".to_string()];
+        claude.captured_at = now() + TimeDelta::seconds(2);
+        assert_eq!(state.poll_batch(&[claude.clone(), codex.clone()]), 1);
+        assert_eq!(
+            state.events.last().map(|e| e.pane_id.clone()),
+            Some(Some("%1".to_string()))
+        );
+
+        // Unchanged panes resync after RESYNC_INTERVAL_SECS.
+        claude.captured_at = now() + TimeDelta::seconds(2 + RESYNC_INTERVAL_SECS);
+        codex.captured_at = claude.captured_at;
+        assert_eq!(state.poll_batch(&[claude.clone(), codex.clone()]), 2);
+
+        // A pane that vanished is emitted again when it returns; resync()
+        // forces every pane out.
+        assert_eq!(state.poll_batch(&[claude.clone()]), 0);
+        assert_eq!(state.poll_batch(&[claude.clone(), codex.clone()]), 1);
+        state.resync();
+        assert_eq!(state.poll_batch(&[claude, codex]), 2);
+        assert_eq!(state.seq, 8);
+    }
 }
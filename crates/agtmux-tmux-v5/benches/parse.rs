@@ -0,0 +1,100 @@
+//! Per-tick parsing cost of tmux / ps output: time and heap allocations per
+//! iteration, measured with a counting allocator (no external bench crate).
+//!
+//! ```sh
+//! cargo bench -p agtmux-tmux-v5 --bench parse
+//! ```
+
+use std::alloc::{GlobalAlloc, Layout, System};
+use std::hint::black_box;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::time::Instant;
+
+use agtmux_tmux_v5::capture::parse_ps_output;
+use agtmux_tmux_v5::{ProcessMap, inspect_pane_processes_deep, parse_list_panes_output};
+
+struct CountingAlloc;
+
+static ALLOCS: AtomicU64 = AtomicU64::new(0);
+
+unsafe impl GlobalAlloc for CountingAlloc {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        ALLOCS.fetch_add(1, Ordering::Relaxed);
+        // SAFETY: forwarded unchanged to the system allocator.
+        unsafe { System.alloc(layout) }
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        // SAFETY: `ptr` was allocated by `System` with `layout`.
+        unsafe { System.dealloc(ptr, layout) }
+    }
+
+    unsafe fn realloc(&self, ptr: *mut u8, layout: Layout, new_size: usize) -> *mut u8 {
+        ALLOCS.fetch_add(1, Ordering::Relaxed);
+        // SAFETY: forwarded unchanged to the system allocator.
+        unsafe { System.realloc(ptr, layout, new_size) }
+    }
+}
+
+#[global_allocator]
+static GLOBAL: CountingAlloc = CountingAlloc;
+
+const PANES: usize = 200;
+const PROCESSES: usize = 2000;
+const ITERS: u32 = 200;
+
+fn bench(name: &str, mut f: impl FnMut()) {
+    f(); // warm up
+    let allocs = ALLOCS.load(Ordering::Relaxed);
+    let start = Instant::now();
+    for _ in 0..ITERS {
+        f();
+    }
+    let elapsed = start.elapsed() / ITERS;
+    let allocs = (ALLOCS.load(Ordering::Relaxed) - allocs) / u64::from(ITERS);
+    println!(
+        "{name:<28} {:>10.1} us/iter {allocs:>8} allocs/iter",
+        elapsed.as_secs_f64() * 1e6
+    );
+}
+
+fn main() {
+    let list_panes: String = (0..PANES)
+        .map(|i| {
+            format!(
+                "$0\tmain\t@{w}\twin{w}\t%{i}\tnode\t/home/user/project{i}\tpane {i}\t200\t50\t0\t1\t{pid}\n",
+                w = i / 4,
+                pid = 10_000 + i
+            )
+        })
+        .collect();
+    let ps: String = (0..PROCESSES)
+        .map(|i| {
+            let ppid = if i < PANES { 1 } else { 10_000 + i % PANES };
+            format!(
+                "{:>6} {ppid:>6} node /usr/lib/node_modules/tool{i}/cli.js --flag\n",
+                10_000 + i
+            )
+        })
+        .collect();
+
+    bench("list_panes parse", || {
+        black_box(parse_list_panes_output(black_box(&list_panes)).expect("parse"));
+    });
+    bench("ps parse (fresh)", || {
+        black_box(parse_ps_output(black_box(ps.as_bytes()), ProcessMap::new()));
+    });
+    let mut previous = parse_ps_output(ps.as_bytes(), ProcessMap::new());
+    bench("ps parse (recycled)", || {
+        previous = parse_ps_output(black_box(ps.as_bytes()), std::mem::take(&mut previous));
+    });
+    bench("deep inspect (all panes)", || {
+        for i in 0..PANES {
+            black_box(inspect_pane_processes_deep(
+                "node",
+                10_000 + i as u32,
+                &previous,
+            ));
+        }
+    });
+}
@@ -23,47 +23,78 @@ pub type ProcessMap = HashMap<u32, ProcessInfo>;
 ///
 /// Called once per tick; returns an empty map on failure (non-fatal).
 pub fn scan_all_processes() -> ProcessMap {
-    let output = match std::process::Command::new("ps")
+    rescan_processes(ProcessMap::new())
+}
+
+/// Like [`scan_all_processes`], but recycles `previous` (the last scan):
+/// processes still running keep their `args` buffer, so a steady-state
+/// rescan allocates only for new or changed processes.
+pub fn rescan_processes(previous: ProcessMap) -> ProcessMap {
+    match std::process::Command::new("ps")
         .args(["-eo", "pid=,ppid=,args="])
         .output()
     {
-        Ok(o) => o,
-        Err(_) => return ProcessMap::new(),
-    };
-    match String::from_utf8(output.stdout) {
-        Ok(s) => parse_ps_output(&s),
+        Ok(output) => parse_ps_output(&output.stdout, previous),
         Err(_) => ProcessMap::new(),
     }
 }
 
-fn parse_ps_output(output: &str) -> ProcessMap {
-    let mut map = ProcessMap::new();
-    for line in output.lines() {
-        if let Some(info) = parse_ps_line(line) {
-            map.insert(info.pid, info);
-        }
+/// Parse raw `ps -eo pid=,ppid=,args=` output, reusing entries of
+/// `previous` whose pid is still present. Works on bytes: lines and fields
+/// are sliced in place and only `args` is decoded (lossily) per process.
+pub fn parse_ps_output(output: &[u8], mut previous: ProcessMap) -> ProcessMap {
+    let mut map = ProcessMap::with_capacity(previous.len().max(64));
+    for line in output.split(|&b| b == b'\n') {
+        let Some((pid, ppid, args)) = split_ps_line(line) else {
+            continue;
+        };
+        let args = String::from_utf8_lossy(args);
+        let info = match previous.remove(&pid) {
+            Some(mut info) => {
+                info.ppid = ppid;
+                if info.args != args {
+                    info.args.clear();
+                    info.args.push_str(&args);
+                }
+                info
+            }
+            None => ProcessInfo {
+                pid,
+                ppid,
+                args: args.into_owned(),
+            },
+        };
+        map.insert(pid, info);
     }
     map
 }
 
-fn parse_ps_line(line: &str) -> Option<ProcessInfo> {
-    let s = line.trim();
-    if s.is_empty() {
-        return None;
-    }
+/// `(pid, ppid, args)` of one `ps` line, borrowing `args` from `line`.
+fn split_ps_line(line: &[u8]) -> Option<(u32, u32, &[u8])> {
+    let s = line.trim_ascii();
     // PID — first whitespace-delimited token
-    let ws = s.find(|c: char| c.is_ascii_whitespace())?;
-    let pid: u32 = s[..ws].parse().ok()?;
-    let s = s[ws..].trim_start();
+    let ws = s.iter().position(u8::is_ascii_whitespace)?;
+    let pid = parse_u32(&s[..ws])?;
+    let s = s[ws..].trim_ascii_start();
     // PPID — second token
-    let ws = s.find(|c: char| c.is_ascii_whitespace()).unwrap_or(s.len());
-    let ppid: u32 = s[..ws].parse().ok()?;
-    let args = if ws < s.len() {
-        s[ws..].trim_start().to_string()
-    } else {
-        String::new()
-    };
-    Some(ProcessInfo { pid, ppid, args })
+    let ws = s
+        .iter()
+        .position(u8::is_ascii_whitespace)
+        .unwrap_or(s.len());
+    let ppid = parse_u32(&s[..ws])?;
+    Some((pid, ppid, s[ws..].trim_ascii_start()))
+}
+
+fn parse_u32(digits: &[u8]) -> Option<u32> {
+    if digits.is_empty() {
+        return None;
+    }
+    digits.iter().try_fold(0u32, |n, &b| {
+        if !b.is_ascii_digit() {
+            return None;
+        }
+        n.checked_mul(10)?.checked_add(u32::from(b - b'0'))
+    })
 }
 
 /// Deep process-tree inspection: examines `pane_pid` and its direct children
@@ -72,6 +103,7 @@ fn parse_ps_line(line: &str) -> Option<ProcessInfo> {
 /// Returns:
 /// - `Some("claude")`          — a process argv identifies Claude Code
 /// - `Some("codex")`           — a process argv identifies Codex CLI
+/// - `Some("aider")`           — a process argv identifies aider (a Python script)
 /// - `Some("runtime_unknown")` — neutral runtime with unidentifiable children (fail-closed)
 /// - Falls through to `inspect_pane_processes(current_cmd)` when `pane_pid` has no
 ///   child processes or the command is directly identifiable (shell / explicit agent)
@@ -83,32 +115,30 @@ pub fn inspect_pane_processes_deep(
     // Fast path: directly identifiable commands skip the process-tree scan.
     let shallow = inspect_pane_processes(current_cmd);
     match shallow.as_deref() {
-        Some("shell") | Some("codex") | Some("claude") => return shallow,
+        Some("shell") | Some("codex") | Some("claude") | Some("aider") => return shallow,
         _ => {}
     }
 
-    // Collect pane_pid itself and its direct children.
-    let pids_to_check: Vec<u32> = std::iter::once(pane_pid)
-        .chain(
-            process_map
-                .values()
-                .filter(|p| p.ppid == pane_pid)
-                .map(|p| p.pid),
-        )
-        .collect();
+    // pane_pid itself, then its direct children.
+    let candidates = process_map.get(&pane_pid).into_iter().chain(
+        process_map
+            .values()
+            .filter(|p| p.ppid == pane_pid && p.pid != pane_pid),
+    );
 
     let mut found_neutral_child = false;
-    for pid in pids_to_check {
-        if let Some(info) = process_map.get(&pid) {
-            if is_claude_argv(&info.args) {
-                return Some("claude".to_string());
-            }
-            if is_codex_argv(&info.args) {
-                return Some("codex".to_string());
-            }
-            if pid != pane_pid {
-                found_neutral_child = true;
-            }
+    for info in candidates {
+        if is_claude_argv(&info.args) {
+            return Some("claude".to_string());
+        }
+        if is_codex_argv(&info.args) {
+            return Some("codex".to_string());
+        }
+        if is_aider_argv(&info.args) {
+            return Some("aider".to_string());
+        }
+        if info.pid != pane_pid {
+            found_neutral_child = true;
         }
     }
 
@@ -122,14 +152,26 @@ pub fn inspect_pane_processes_deep(
 }
 
 fn is_claude_argv(args: &str) -> bool {
-    let lower = args.to_ascii_lowercase();
-    lower.contains("claude")
-        && !lower.contains("claude_desktop")
-        && !lower.contains("claude-desktop")
+    contains_ignore_case(args, "claude")
+        && !contains_ignore_case(args, "claude_desktop")
+        && !contains_ignore_case(args, "claude-desktop")
 }
 
 fn is_codex_argv(args: &str) -> bool {
-    args.to_ascii_lowercase().contains("codex")
+    contains_ignore_case(args, "codex")
+}
+
+fn is_aider_argv(args: &str) -> bool {
+    contains_ignore_case(args, "aider")
+}
+
+/// ASCII case-insensitive substring test; `needle` must be lowercase.
+/// Avoids lowercasing every argv of every process on each tick.
+fn contains_ignore_case(haystack: &str, needle: &str) -> bool {
+    haystack
+        .as_bytes()
+        .windows(needle.len())
+        .any(|window| window.eq_ignore_ascii_case(needle.as_bytes()))
 }
 
 /// Capture the last `lines` lines of terminal output from a pane.
@@ -140,7 +182,9 @@ pub fn capture_pane(
 ) -> Result<Vec<String>, TmuxError> {
     let start_line = format!("-{lines}");
     let output = runner.run(&["capture-pane", "-p", "-S", &start_line, "-t", pane_id])?;
-    Ok(output.lines().map(String::from).collect())
+    let mut lines = Vec::with_capacity(output.matches('\n').count() + 1);
+    lines.extend(output.lines().map(String::from));
+    Ok(lines)
 }
 
 /// Known interactive shells — panes running these are plain terminals,
@@ -154,15 +198,20 @@ const SHELL_CMDS: &[&str] = &[
 /// Returns:
 /// - `Some("claude")` — Claude Code binary detected
 /// - `Some("codex")`  — Codex CLI binary detected
+/// - `Some("aider")`  — aider detected
 /// - `Some("shell")`  — plain interactive shell (zsh, bash, …); never an agent
 /// - `None`           — neutral runtime (node, python, …); may or may not be an agent
 pub fn inspect_pane_processes(current_cmd: &str) -> Option<String> {
-    let lower = current_cmd.to_ascii_lowercase();
-    if lower.contains("claude") {
+    if contains_ignore_case(current_cmd, "claude") {
         Some("claude".to_string())
-    } else if lower.contains("codex") {
+    } else if contains_ignore_case(current_cmd, "codex") {
         Some("codex".to_string())
-    } else if SHELL_CMDS.iter().any(|&s| lower == s) {
+    } else if contains_ignore_case(current_cmd, "aider") {
+        Some("aider".to_string())
+    } else if SHELL_CMDS
+        .iter()
+        .any(|s| current_cmd.eq_ignore_ascii_case(s))
+    {
         Some("shell".to_string())
     } else {
         None
@@ -177,8 +226,8 @@ mod tests {
 
     #[test]
     fn parse_ps_output_basic() {
-        let output = "    1     0 /sbin/launchd\n12345  6789 node /path/to/claude/cli.js\n";
-        let map = parse_ps_output(output);
+        let output = b"    1     0 /sbin/launchd\n12345  6789 node /path/to/claude/cli.js\n";
+        let map = parse_ps_output(output, ProcessMap::new());
         assert_eq!(map.len(), 2);
         let p1 = &map[&1];
         assert_eq!(p1.ppid, 0);
@@ -190,20 +239,35 @@ mod tests {
 
     #[test]
     fn parse_ps_output_empty_lines_skipped() {
-        let output = "\n   \n42 1 sleep 60\n";
-        let map = parse_ps_output(output);
+        let output = b"\n   \n42 1 sleep 60\n";
+        let map = parse_ps_output(output, ProcessMap::new());
         assert_eq!(map.len(), 1);
         assert!(map.contains_key(&42));
     }
 
     #[test]
     fn parse_ps_output_no_args() {
-        let output = "100 50\n"; // no args column
-        let map = parse_ps_output(output);
+        let output = b"100 50\n"; // no args column
+        let map = parse_ps_output(output, ProcessMap::new());
         assert_eq!(map.len(), 1);
         assert_eq!(map[&100].args, "");
     }
 
+    #[test]
+    fn parse_ps_output_recycles_previous_scan() {
+        let first = parse_ps_output(b"1 0 init\n2 1 node a.js\n3 1 gone\n", ProcessMap::new());
+        let kept = first[&2].args.as_ptr();
+        let map = parse_ps_output(b"1 0 init\n2 7 node a.js\n4 1 vim\n", first);
+        assert_eq!(map.len(), 3, "vanished pid 3 dropped");
+        assert_eq!(map[&2].ppid, 7);
+        assert_eq!(map[&2].args.as_ptr(), kept, "unchanged args buffer reused");
+        assert_eq!(map[&4].args, "vim");
+        assert_eq!(
+            parse_ps_output(b"x 1 bad\n5 1 \xff\n", map)[&5].args,
+            "\u{fffd}"
+        );
+    }
+
     // ─── inspect_pane_processes_deep tests ───────────────────────────
 
     fn make_pm(entries: &[(u32, u32, &str)]) -> ProcessMap {
@@ -324,6 +388,24 @@ mod tests {
         assert_eq!(inspect_pane_processes("Codex"), Some("codex".to_string()));
     }
 
+    #[test]
+    fn inspect_aider_cmd_and_python_child() {
+        assert_eq!(inspect_pane_processes("aider"), Some("aider".to_string()));
+        // On macOS tmux reports the interpreter, not the script name.
+        let pm = make_pm(&[
+            (30, 1, "zsh"),
+            (
+                31,
+                30,
+                "/usr/bin/python3 /home/u/.local/bin/aider --model sonnet",
+            ),
+        ]);
+        assert_eq!(
+            inspect_pane_processes_deep("Python", 30, &pm),
+            Some("aider".to_string())
+        );
+    }
+
     #[test]
     fn inspect_shell_cmds() {
         for shell in &[
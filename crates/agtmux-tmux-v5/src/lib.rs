@@ -13,7 +13,7 @@ pub mod snapshot;
 
 pub use capture::{
     ProcessInfo, ProcessMap, capture_pane, inspect_pane_processes, inspect_pane_processes_deep,
-    scan_all_processes,
+    rescan_processes, scan_all_processes,
 };
 pub use error::TmuxError;
 pub use executor::{TmuxCommandRunner, TmuxExecutor};
@@ -5,7 +5,7 @@ use crate::executor::TmuxCommandRunner;
 use serde::{Deserialize, Serialize};
 
 /// Tab-delimited format string for `tmux list-panes -a -F`.
-pub const LIST_PANES_FORMAT: &str = "#{session_id}\t#{session_name}\t#{window_id}\t#{window_name}\t#{pane_id}\t#{pane_current_command}\t#{pane_current_path}\t#{pane_title}\t#{pane_width}\t#{pane_height}\t#{pane_active}\t#{session_attached}\t#{pane_pid}";
+pub const LIST_PANES_FORMAT: &str = "#{session_id}\t#{session_name}\t#{window_id}\t#{window_name}\t#{pane_id}\t#{pane_current_command}\t#{pane_current_path}\t#{pane_title}\t#{pane_width}\t#{pane_height}\t#{pane_active}\t#{session_attached}\t#{pane_pid}\t#{pane_dead}\t#{pane_dead_status}";
 
 /// Full metadata for a tmux pane.
 #[derive(Debug, Clone, PartialEq, Eq, Default, Serialize, Deserialize)]
@@ -25,6 +25,10 @@ pub struct TmuxPaneInfo {
     /// PID of the process running in this pane (tmux `#{pane_pid}`).
     /// Used for deep process-tree inspection (T-128).
     pub pane_pid: Option<u32>,
+    /// The pane's process exited and the pane was kept (`remain-on-exit`).
+    pub pane_dead: bool,
+    /// Exit status of a dead pane's process (tmux `#{pane_dead_status}`).
+    pub pane_dead_status: Option<i32>,
 }
 
 /// Execute `tmux list-panes -a` and parse the output.
@@ -35,7 +39,7 @@ pub fn list_panes(runner: &impl TmuxCommandRunner) -> Result<Vec<TmuxPaneInfo>,
 
 /// Parse the raw output of `tmux list-panes -a -F <FORMAT>`.
 pub fn parse_list_panes_output(output: &str) -> Result<Vec<TmuxPaneInfo>, TmuxError> {
-    let mut panes = Vec::new();
+    let mut panes = Vec::with_capacity(output.matches('\n').count() + 1);
     for (idx, line) in output.lines().enumerate() {
         let trimmed = line.trim();
         if trimmed.is_empty() {
@@ -47,27 +51,34 @@ pub fn parse_list_panes_output(output: &str) -> Result<Vec<TmuxPaneInfo>, TmuxEr
     Ok(panes)
 }
 
+/// Fields of [`LIST_PANES_FORMAT`]; extra trailing fields are ignored.
+const LIST_PANES_FIELDS: usize = 15;
+
 fn parse_line(line: &str, line_num: usize) -> Result<TmuxPaneInfo, TmuxError> {
-    let parts: Vec<&str> = line.split('\t').collect();
-    if parts.len() < 11 {
+    // Fields are sliced into a fixed array: no per-line Vec.
+    let mut parts = [""; LIST_PANES_FIELDS];
+    let mut count = 0;
+    for field in line.split('\t') {
+        if let Some(slot) = parts.get_mut(count) {
+            *slot = field;
+        }
+        count += 1;
+    }
+    if count < 11 {
         return Err(TmuxError::ParseError {
             line_num,
-            detail: format!(
-                "expected at least 11 tab-separated fields, got {}",
-                parts.len()
-            ),
+            detail: format!("expected at least 11 tab-separated fields, got {count}"),
         });
     }
 
     let width = parts[8].parse::<u16>().unwrap_or(80);
     let height = parts[9].parse::<u16>().unwrap_or(24);
     let active = parse_bool(parts[10]);
-    let session_attached = if parts.len() > 11 {
-        parse_bool(parts[11])
-    } else {
-        false
-    };
-    let pane_pid: Option<u32> = parts.get(12).and_then(|s| s.trim().parse().ok());
+    // Missing optional fields stay "" and parse as false / None.
+    let session_attached = parse_bool(parts[11]);
+    let pane_pid: Option<u32> = parts[12].trim().parse().ok();
+    let pane_dead = parse_bool(parts[13]);
+    let pane_dead_status: Option<i32> = parts[14].trim().parse().ok();
 
     Ok(TmuxPaneInfo {
         session_id: parts[0].to_string(),
@@ -83,6 +94,8 @@ fn parse_line(line: &str, line_num: usize) -> Result<TmuxPaneInfo, TmuxError> {
         active,
         session_attached,
         pane_pid,
+        pane_dead,
+        pane_dead_status,
     })
 }
 
@@ -112,6 +125,19 @@ mod tests {
         assert!(pane.session_attached);
     }
 
+    #[test]
+    fn parse_dead_pane_status() {
+        let line = "$0\tmain\t@0\tdev\t%0\tcodex\t/home\tt\t80\t24\t0\t1\t42\t1\t2";
+        let pane = parse_line(line, 1).expect("should parse");
+        assert!(pane.pane_dead);
+        assert_eq!(pane.pane_dead_status, Some(2));
+
+        let alive = parse_line("$0\tmain\t@0\tdev\t%0\tzsh\t/\tt\t80\t24\t0\t1\t42\t0\t", 1)
+            .expect("should parse");
+        assert!(!alive.pane_dead);
+        assert_eq!(alive.pane_dead_status, None);
+    }
+
     #[test]
     fn parse_inactive_detached() {
         let line = "$1\twork\t@1\teditor\t%1\tvim\t/tmp\ttitle\t80\t24\t0\t0";
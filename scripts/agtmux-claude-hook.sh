@@ -8,17 +8,23 @@
 #   AGTMUX_HOOK_TYPE  — hook type (e.g. PreToolUse, PostToolUse, Notification, Stop)
 #   TMUX_PANE         — tmux pane ID (set by tmux)
 #   AGTMUX_SOCKET     — (optional) UDS path override
+#   AGTMUX_TOKEN      — (optional) access token sent as meta.token; needed when
+#                       the daemon's [access] gives this uid less than "act"
+#   AGTMUX_TOKEN_FILE — (optional) file whose first line is the token, used
+#                       when AGTMUX_TOKEN is unset
 #
 # Dependencies: jq, socat (or nc with unix socket support)
 # Fire-and-forget: failures are silently ignored so Claude Code is never blocked.
 
 set -euo pipefail
 
-# Determine socket path
+# Determine socket path (mirrors paths::runtime_dir in agtmux)
 if [ -n "${AGTMUX_SOCKET:-}" ]; then
     SOCKET="$AGTMUX_SOCKET"
-elif [ -n "${XDG_RUNTIME_DIR:-}" ]; then
+elif [[ "${XDG_RUNTIME_DIR:-}" == /* ]]; then
     SOCKET="${XDG_RUNTIME_DIR}/agtmux/agtmuxd.sock"
+elif [ "$(uname -s)" = "Darwin" ] && [[ "${TMPDIR:-}" == /* ]]; then
+    SOCKET="${TMPDIR%/}/agtmux/agtmuxd.sock"
 else
     SOCKET="/tmp/agtmux-${USER:-unknown}/agtmuxd.sock"
 fi
@@ -38,12 +44,19 @@ HOOK_TYPE="${AGTMUX_HOOK_TYPE:-unknown}"
 # Get pane ID from tmux environment
 PANE_ID="${TMUX_PANE:-}"
 
+# source.ingest needs the "act" scope; send a token if one is configured
+TOKEN="${AGTMUX_TOKEN:-}"
+if [ -z "$TOKEN" ] && [ -n "${AGTMUX_TOKEN_FILE:-}" ]; then
+    TOKEN=$(head -n 1 "$AGTMUX_TOKEN_FILE" 2>/dev/null || true)
+fi
+
 # Build the JSON-RPC request
 REQUEST=$(jq -n \
     --arg hook_id "$HOOK_ID" \
     --arg hook_type "$HOOK_TYPE" \
     --arg session_id "$SESSION_ID" \
     --arg pane_id "$PANE_ID" \
+    --arg token "$TOKEN" \
     --argjson data "$INPUT" \
     '{
         jsonrpc: "2.0",
@@ -59,7 +72,8 @@ REQUEST=$(jq -n \
                 pane_id: (if $pane_id == "" then null else $pane_id end),
                 data: $data
             }
-        }
+        },
+        meta: (if $token == "" then {} else {token: $token} end)
     }')
 
 # Send to daemon (fire-and-forget)